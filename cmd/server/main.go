@@ -1,19 +1,46 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/franzego/stage04/internal/adminui"
+	"github.com/franzego/stage04/internal/archive"
 	"github.com/franzego/stage04/internal/config"
 	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/jsoncase"
+	"github.com/franzego/stage04/internal/manifest"
+	"github.com/franzego/stage04/internal/metrics"
 	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/poll"
 	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/internal/queue/kafka"
+	"github.com/franzego/stage04/internal/queue/nats"
+	"github.com/franzego/stage04/internal/safety"
 	"github.com/franzego/stage04/internal/services"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/franzego/stage04/pkg/buildinfo"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/franzego/stage04/pkg/idgen"
 	"github.com/franzego/stage04/pkg/redis"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	pollMode := flag.Bool("poll", false, "drain the worker queues and exit instead of serving")
+	pollInterval := flag.Duration("poll-interval", 0, "with -poll, drain again at this interval until stopped")
+	wakeAddr := flag.String("wake-addr", "", "with -poll, also drain on POST /wake at this address until stopped")
+	flag.Parse()
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatal("Failed to load config", err)
@@ -21,34 +48,308 @@ func main() {
 	if cfg.MockServices {
 		log.Print("Running in MOCK MODE - external services simulated")
 	}
+	fingerprint, err := buildinfo.Fingerprint(cfg.Public())
+	if err != nil {
+		log.Printf("failed to fingerprint config: %v", err)
+	}
+	info := buildinfo.Get(fingerprint)
+	log.Printf("api-gateway %s (commit %s, built %s, %s), config %s",
+		info.Version, info.Commit, info.BuildTime, info.GoVersion, info.ConfigFingerprint)
+
+	var appMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		appMetrics, err = metrics.New(cfg.Metrics)
+		if err != nil {
+			log.Fatalf("invalid metrics config: %v", err)
+		}
+	}
 
-	redisClient := redis.InitRedis(cfg.Redis)
-	clientRabbit, err := queue.NewRabbitMqService(cfg.RabbitMQ)
+	redisClient, err := redis.InitRedis(cfg.Redis, appMetrics.Registerer())
 	if err != nil {
-		log.Fatalf("failed to connect to rabbitMq")
+		if redisClient == nil || !cfg.Redis.StartDegraded {
+			log.Fatalf("failed to connect to redis: %v", err)
+		}
+		log.Printf("starting without redis, health reports it unhealthy until it is back: %v", err)
+	}
+	// the in-memory queue stands in for the broker when asked for; the
+	// admin endpoints report RabbitMQ down until one turns up
+	var clientRabbit *queue.RabbitMqClient
+	var memoryQueue *queue.MemoryClient
+	if cfg.Queue.Backend == "memory" {
+		clientRabbit = queue.ConnectRabbitMqInBackground(cfg.RabbitMQ, cfg.Environment)
+		memoryQueue = queue.NewMemoryClient()
+		memoryQueue.Environment = cfg.Environment
+		defer memoryQueue.Close()
+	} else {
+		clientRabbit, err = queue.NewRabbitMqService(cfg.RabbitMQ, cfg.Environment)
+		if err != nil {
+			log.Fatalf("failed to connect to RabbitMQ: %v", err)
+		}
 	}
 	defer clientRabbit.CloseConnection()
+	// the wall clock and random IDs, everywhere the tests fake them
+	clk, ids := clock.System, idgen.UUID
+	clientRabbit.Clock = clk
+	if appMetrics != nil {
+		clientRabbit.Observer = appMetrics
+		if clientRabbit.Metrics, err = queue.NewMetrics(appMetrics.Registerer()); err != nil {
+			log.Fatalf("failed to register queue metrics: %v", err)
+		}
+	}
+	// the handlers publish to the configured backend; the workers and the
+	// queue admin endpoints stay on RabbitMQ
+	var publisher interface {
+		handlers.RabbitClient
+		handlers.BrokerHealth
+	} = clientRabbit
+	switch cfg.Queue.Backend {
+	case "", "rabbitmq", "memory":
+		if memoryQueue != nil {
+			publisher = memoryQueue
+			log.Print("publishing to the in-memory queue")
+		}
+	case "nats":
+		natsClient, err := nats.NewNATSClient(cfg.NATS, cfg.Environment)
+		if err != nil {
+			log.Fatalf("failed to connect to NATS: %v", err)
+		}
+		defer natsClient.Close()
+		publisher = natsClient
+		log.Printf("publishing to NATS stream %s", cfg.NATS.Stream)
+	case "kafka":
+		kafkaClient, err := kafka.NewKafkaClient(cfg.Kafka, cfg.Environment)
+		if err != nil {
+			log.Fatalf("failed to start the Kafka producer: %v", err)
+		}
+		defer kafkaClient.Close()
+		kafkaClient.Clock = clk
+		publisher = kafkaClient
+		log.Printf("publishing to Kafka at %v", cfg.Kafka.Brokers)
+	default:
+		log.Fatalf("invalid queue.backend %q, want \"rabbitmq\", \"nats\", \"kafka\" or \"memory\"", cfg.Queue.Backend)
+	}
 	userService := services.NewUserServiceClient(cfg.Services.UserServiceURL, cfg.MockServices)
 	templateService := services.NewTemplateClient(cfg.Services.TemplateServiceURL, cfg.MockServices)
+	templateService.CacheTemplates(cfg.Notifications.TemplateCacheSize, cfg.Notifications.TemplateCacheTTL)
+	var templateManifest *manifest.Status
+	if path := cfg.Notifications.TemplateManifest; path != "" {
+		m, err := manifest.Load(path)
+		if err != nil {
+			log.Fatalf("invalid template manifest: %v", err)
+		}
+		templateManifest = manifest.NewStatus(m, templateService)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		report, _ := templateManifest.Warm(ctx)
+		cancel()
+		log.Printf("template manifest: %s", report.Summary())
+	}
 	notificationHandler := handlers.NewNotificationService(
-		clientRabbit,
+		publisher,
 		redisClient,
 		userService,
 		templateService,
+		cfg.Notifications,
 	)
-	healthHandler := handlers.NewHealthHandler(clientRabbit, redisClient, userService, templateService)
+	notificationHandler.SetClock(clk)
+	notificationHandler.SetIDGenerator(ids)
+	notificationHandler.SetKeyPrefix(cfg.Redis.KeyPrefix)
+	if err := notificationHandler.ValidatePolicyChain(); err != nil {
+		log.Fatalf("invalid policy chain: %v", err)
+	}
+	healthHandler := handlers.NewHealthHandler(publisher, redisClient, userService, templateService)
+	if templateManifest != nil {
+		healthHandler.WatchTemplateManifest(templateManifest, cfg.Notifications.TemplateManifestGate)
+	}
+	healthHandler.WatchOutbox(notificationHandler)
+	go notificationHandler.RunOutboxFlusher(context.Background())
+	healthHandler.WatchStorage(notificationHandler)
+	go notificationHandler.RunStorageRecovery(context.Background())
+	// the workers that buffer writes run until shutdown cancels them and
+	// are waited for, so what they still hold is written out before exit
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var backgroundWorkers sync.WaitGroup
+	if cfg.Archive.Enabled {
+		openCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		statusArchive, err := archive.OpenPostgres(openCtx, cfg.Archive.DSN)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to open the status archive: %v", err)
+		}
+		defer statusArchive.Close()
+		archiver := archive.NewArchiver(statusArchive, redisClient,
+			store.Namespace(cfg.Redis.KeyPrefix).Key(archive.RetryKey), cfg.Archive)
+		backgroundWorkers.Add(1)
+		go func() {
+			defer backgroundWorkers.Done()
+			archiver.Run(background)
+		}()
+		notificationHandler.SetArchive(archiver)
+	}
+	manifestHandler := handlers.NewManifestHandler(templateManifest)
+	sendCeiling := safety.NewSendCeiling(redisClient, cfg.Safety, safety.LogAlerter{})
+	sendCeiling.SetKeyPrefix(cfg.Redis.KeyPrefix)
+	sendCeiling.SetClock(clk)
+	adminHandler := handlers.NewAdminHandler(sendCeiling, clientRabbit)
+	dashboardHandler := handlers.NewDashboardHandler(clientRabbit, sendCeiling, cfg.Notifications.DisabledChannels,
+		userService.Breaker(), templateService.Breaker())
+	usageRecorder := usage.NewRecorder(redisClient)
+	usageRecorder.SetKeyPrefix(cfg.Redis.KeyPrefix)
+	usageRecorder.SetClock(clk)
+	backgroundWorkers.Add(1)
+	go func() {
+		defer backgroundWorkers.Done()
+		usageRecorder.Run(background)
+	}()
+	usageHandler := handlers.NewUsageHandler(usageRecorder)
+	usageHandler.SetClock(clk)
+	versionHandler := handlers.NewVersionHandler(info)
+
+	// the workers consume in the background, or in poll mode are drained
+	// by runPoll
+	var pollQueues []poll.Queue
+	if cfg.Workers.Email {
+		if cfg.MockServices {
+			emailWorker := queue.NewEmailWorker(queue.LoopbackEmailSender{}, notificationHandler)
+			emailWorker.Clock = clk
+			if appMetrics != nil {
+				emailWorker.Observer = appMetrics
+			}
+			pollQueues = append(pollQueues, poll.Queue{Name: "email", Drain: func(ctx context.Context) (int, error) {
+				return clientRabbit.DrainEmail(ctx, emailWorker.Handle)
+			}})
+			switch {
+			case *pollMode:
+			case memoryQueue != nil:
+				if err := memoryQueue.Subscribe(memoryQueue.EmailQueueName(), emailWorker.Handle); err != nil {
+					log.Fatalf("failed to start the email worker: %v", err)
+				}
+			default:
+				go func() {
+					if err := clientRabbit.ConsumeEmail(context.Background(), cfg.Workers.Concurrency, emailWorker.Handle); err != nil {
+						log.Printf("email worker stopped: %v", err)
+					}
+				}()
+			}
+		} else {
+			log.Print("email worker enabled but no email provider is configured, not starting it")
+		}
+	}
+	if cfg.Workers.Push {
+		webPush, err := queue.NewWebPushSender(cfg.WebPush, userService)
+		if err != nil {
+			log.Fatalf("invalid web push config: %v", err)
+		}
+		pushRouter := &queue.PushRouter{Senders: map[queue.PushTokenType]queue.PushSender{}}
+		if cfg.MockServices {
+			// there is no FCM or APNs provider yet
+			pushRouter.Senders[queue.FCMToken] = queue.LoopbackPushSender{}
+			pushRouter.Senders[queue.APNsToken] = queue.LoopbackPushSender{}
+			pushRouter.Default = queue.LoopbackPushSender{}
+		}
+		if webPush != nil {
+			webPush.Clock = clk
+			pushRouter.Senders[queue.WebPushToken] = webPush
+		}
+		if len(pushRouter.Senders) > 0 {
+			pushWorker := queue.NewPushWorker(pushRouter, notificationHandler)
+			pushWorker.Clock = clk
+			if appMetrics != nil {
+				pushWorker.Observer = appMetrics
+			}
+			pollQueues = append(pollQueues, poll.Queue{Name: "push", Drain: func(ctx context.Context) (int, error) {
+				return clientRabbit.DrainPush(ctx, pushWorker.Handle)
+			}})
+			switch {
+			case *pollMode:
+			case memoryQueue != nil:
+				if err := memoryQueue.Subscribe(memoryQueue.PushQueueName(), pushWorker.Handle); err != nil {
+					log.Fatalf("failed to start the push worker: %v", err)
+				}
+			default:
+				go func() {
+					if err := clientRabbit.ConsumePush(context.Background(), cfg.Workers.Concurrency, pushWorker.Handle); err != nil {
+						log.Printf("push worker stopped: %v", err)
+					}
+				}()
+			}
+		} else {
+			log.Print("push worker enabled but no push provider is configured, not starting it")
+		}
+	}
+	if *pollMode {
+		code := runPoll(pollQueues, *pollInterval, *wakeAddr)
+		clientRabbit.CloseConnection()
+		os.Exit(code)
+	}
+
+	tenant := middleware.TenantMiddleware(cfg.Notifications.DefaultTenant, cfg.MockServices)
+	defaultCase, ok := jsoncase.Parse(cfg.Notifications.JSONCase.Default)
+	if !ok {
+		log.Fatalf("invalid json_case.default %q, want \"snake\" or \"camel\"", cfg.Notifications.JSONCase.Default)
+	}
+	jsonCase := middleware.JSONCase(defaultCase, cfg.Notifications.JSONCase.CamelClients, cfg.Notifications.JSONCase.CamelTenants)
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.RequestID(ids), middleware.AccessLog(), middleware.Recovery())
+	r.Use(middleware.CorrelationID(ids))
+	if appMetrics != nil {
+		r.Use(appMetrics.Middleware())
+		r.GET(cfg.Metrics.Path, gin.WrapH(appMetrics.Handler()))
+	}
+	// sends are budgeted against server.timeout; the status stream isn't
+	// bounded
+	deadline := middleware.RequestTimeout(cfg.Server.Timeout)
+	storageGate := notificationHandler.StorageGate()
 	api := r.Group("/api/v1")
-	api.Use(middleware.AuthMiddleware())
+	api.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), tenant, jsonCase, usageRecorder.Middleware())
 	{
-		api.POST("/notification/email", notificationHandler.SendEmail)
-		api.POST("/notification/push", notificationHandler.SendPush)
+		api.POST("/notification/email", deadline, sendCeiling.Middleware(), storageGate, notificationHandler.SendEmail)
+		api.POST("/notification/push", deadline, sendCeiling.Middleware(), storageGate, notificationHandler.SendPush)
+		api.POST("/notification/whatsapp", deadline, sendCeiling.Middleware(), storageGate, notificationHandler.SendWhatsApp)
+		api.POST("/notification/push/topic", deadline, sendCeiling.Middleware(), storageGate, notificationHandler.SendTopicPush)
+		api.POST("/notification/multi", deadline, sendCeiling.Middleware(), storageGate, notificationHandler.SendMulti)
+		api.GET("/notification/group/:group_id", notificationHandler.GetGroup)
+		api.GET("/notification/user/:user_id/summary", notificationHandler.GetUserSummary)
 		api.GET("/notification/status/:id", notificationHandler.GetStatus)
+		api.HEAD("/notification/status/:id", notificationHandler.HeadStatus)
+		api.GET("/notification/status/:id/stream", notificationHandler.StreamStatus)
+		api.PATCH("/notification/:id", notificationHandler.PatchNotification)
+		api.POST("/notification/:id/resend", deadline, sendCeiling.Middleware(), storageGate, notificationHandler.Resend)
+		api.POST("/notification/:id/snooze", notificationHandler.Snooze)
+		api.GET("/templates/:id/variables", notificationHandler.GetTemplateVariables)
 
 	}
 
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AdminMiddleware(cfg.Auth.JWTSecret), tenant, jsonCase)
+	{
+		admin.POST("/emergency/clear", adminHandler.ClearEmergencyStop)
+		admin.GET("/cache/stats", notificationHandler.GetCacheStats)
+		admin.GET("/history/clock-skew", notificationHandler.GetClockSkew)
+		admin.GET("/reports/duplicates", notificationHandler.GetDuplicateReport)
+		admin.GET("/privacy/inventory", notificationHandler.GetDataInventory)
+		admin.DELETE("/notification/:id", notificationHandler.PurgeNotification)
+		admin.GET("/queues", adminHandler.GetQueueDepths)
+		admin.GET("/usage", usageHandler.GetUsage)
+		admin.GET("/templates/manifest-status", manifestHandler.GetStatus)
+		admin.GET("/dashboard", dashboardHandler.GetSummary)
+		admin.GET("/notifications", notificationHandler.ListNotifications)
+		admin.GET("/approvals", notificationHandler.ListApprovals)
+		admin.POST("/approvals/:id/approve", notificationHandler.ApproveNotification)
+		admin.POST("/approvals/:id/reject", notificationHandler.RejectNotification)
+	}
+
+	internal := r.Group("/api/v1/internal")
+	internal.Use(middleware.ScopeMiddleware(cfg.Auth.JWTSecret, middleware.IngestScope), tenant, jsonCase)
+	{
+		internal.PUT("/send-time/:user_id", notificationHandler.IngestSendTimeProfile)
+	}
+
+	adminui.Register(r, middleware.AdminMiddleware(cfg.Auth.JWTSecret))
+
 	r.GET("/health", healthHandler.HealthCheck)
+	r.GET("/version", versionHandler.GetVersion)
 
 	r.GET("/Alive", func(c *gin.Context) {
 		// Return JSON response
@@ -58,5 +359,72 @@ func main() {
 		})
 	})
 
-	r.Run()
+	// listen where gin's Run would, so deployments setting PORT keep working
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	server := &http.Server{Addr: addr, Handler: r}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server stopped: %v", err)
+		}
+	}()
+	<-ctx.Done()
+	stop()
+
+	// stop taking requests and let those in flight finish, then let the
+	// publishes still under way, from handlers and workers, reach the broker
+	log.Print("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to finish in-flight requests: %v", err)
+	}
+	if err := clientRabbit.Drain(shutdownCtx); err != nil {
+		log.Printf("failed to drain publishes: %v", err)
+	}
+	// no handler queues archive records or usage events any more; write
+	// out what's queued before the deferred close of the archive
+	stopBackground()
+	backgroundWorkers.Wait()
+}
+
+// runPoll drains the queues of the enabled workers, once or, with an
+// interval or a wake address, until the process is stopped, and returns
+// the exit code.
+func runPoll(queues []poll.Queue, interval time.Duration, wakeAddr string) int {
+	if len(queues) == 0 {
+		log.Print("poll mode: no worker is enabled, nothing to drain")
+		return poll.ExitOK
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	poller := poll.New(queues...)
+	if wakeAddr == "" {
+		return poller.Run(ctx, interval)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/wake", poller)
+	server := &http.Server{Addr: wakeAddr, Handler: mux}
+	listenErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			listenErr <- err
+			stop()
+		}
+	}()
+	code := poller.Run(ctx, interval)
+	<-ctx.Done()
+	server.Shutdown(context.Background())
+	select {
+	case err := <-listenErr:
+		log.Printf("poll mode: wake endpoint failed: %v", err)
+		return poll.ExitFailed
+	default:
+		return code
+	}
 }
@@ -0,0 +1,164 @@
+// Command notifctl helps template developers iterate locally against
+// messages captured from a running gateway.
+//
+//	notifctl record --correlation-id ID [--tenant TENANT] [--out msg.json]
+//	notifctl replay --file msg.json [--target local] [--templates DIR] [--out DIR]
+//
+// record reads the notifications a request created from the gateway's Redis
+// and writes them, redacted, to a file. replay runs them through an
+// in-process email worker that renders TEMPLATES/<template_id>.tmpl into the
+// output directory, printing each status transition and the rendered email.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/redis"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "record":
+		err = record(os.Args[2:])
+	case "replay":
+		err = replay(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("notifctl %s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: notifctl record --correlation-id ID [--tenant TENANT] [--out FILE]")
+	fmt.Fprintln(os.Stderr, "       notifctl replay --file FILE [--target local] [--templates DIR] [--out DIR]")
+	os.Exit(2)
+}
+
+func record(args []string) error {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	correlationID := flags.String("correlation-id", "", "correlation ID of the request to record")
+	tenant := flags.String("tenant", "", "tenant the request was made for")
+	out := flags.String("out", "", "file to write the recording to (default stdout)")
+	flags.Parse(args)
+	if *correlationID == "" {
+		return fmt.Errorf("--correlation-id is required")
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	redisClient, err := redis.InitRedis(cfg.Redis, nil)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+	notifications := handlers.NewNotificationService(nil, redisClient, nil, nil, cfg.Notifications)
+	notifications.SetKeyPrefix(cfg.Redis.KeyPrefix)
+
+	ctx := context.Background()
+	if *tenant != "" {
+		ctx = middleware.WithTenant(ctx, *tenant)
+	}
+	messages, err := notifications.MessagesByCorrelation(ctx, *correlationID)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no notifications found for correlation ID %s", *correlationID)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := queue.WriteRecording(w, *correlationID, messages, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("recorded %d message(s)", len(messages))
+	return nil
+}
+
+func replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := flags.String("file", "", "recording to replay")
+	target := flags.String("target", "local", "where to replay; only local is supported")
+	templates := flags.String("templates", "templates", "directory of <template_id>.tmpl files")
+	out := flags.String("out", os.TempDir(), "directory to write rendered emails to")
+	flags.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	if *target != "local" {
+		return fmt.Errorf("unknown target %q", *target)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rec, err := queue.ReadRecording(f)
+	if err != nil {
+		return err
+	}
+
+	sender := queue.FilesystemEmailSender{TemplateDir: *templates, OutDir: *out}
+	worker := queue.NewEmailWorker(sender, printedStatus{w: os.Stdout})
+	return queue.Replay(context.Background(), rec, func(ctx context.Context, msg models.NotificationMessage) error {
+		if msg.Type != "email" {
+			return fmt.Errorf("no local worker for %s notifications", msg.Type)
+		}
+		if err := worker.Handle(ctx, msg); err != nil {
+			return err
+		}
+		rendered, err := os.ReadFile(sender.OutputPath(msg))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--- %s (%s)\n%s\n", msg.ID, sender.OutputPath(msg), rendered)
+		return nil
+	})
+}
+
+// printedStatus is the replay's StatusRecorder: transitions are printed
+// rather than stored.
+type printedStatus struct {
+	w io.Writer
+}
+
+func (p printedStatus) SetDeliveryStatus(ctx context.Context, notificationID, status string) error {
+	_, err := fmt.Fprintf(p.w, "%s: %s\n", notificationID, status)
+	return err
+}
+
+func (p printedStatus) RecordAttempt(ctx context.Context, notificationID string, attemptErr error) error {
+	if attemptErr == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(p.w, "%s: attempt failed: %v\n", notificationID, attemptErr)
+	return err
+}
@@ -0,0 +1,75 @@
+// Package adminui serves the admin UI: a static page, embedded in the
+// binary, showing queue depths, kill switches, breaker states and recent
+// failures from the admin JSON endpoints, refreshed every few seconds.
+//
+// A browser can't attach a bearer token to a page load, so the login page
+// keeps the admin token in a cookie scoped to the UI, which the UI's routes
+// accept in place of the Authorization header. The page's own API calls
+// send the header as any other caller does.
+package adminui
+
+import (
+	"embed"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Path is where the UI is served.
+const Path = "/admin/ui"
+
+// TokenCookie holds the admin token for the UI's page loads.
+const TokenCookie = "admin_ui_token"
+
+//go:embed assets
+var assets embed.FS
+
+// Register serves the UI on r. The login page and its stylesheet are
+// public; the rest is behind auth, which should require the admin scope.
+func Register(r gin.IRouter, auth ...gin.HandlerFunc) {
+	r.GET(Path+"/login", serve("login.html"))
+	r.GET(Path+"/style.css", serve("style.css"))
+
+	ui := r.Group(Path, append([]gin.HandlerFunc{cookieToken()}, auth...)...)
+	ui.GET("/", serve("index.html"))
+	ui.GET("/app.js", serve("app.js"))
+}
+
+// cookieToken sends a page load without a token to the login page, and
+// otherwise passes the cookie's token on as the Authorization header.
+func cookieToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+		token, err := c.Cookie(TokenCookie)
+		if err != nil || token == "" {
+			if strings.Contains(c.GetHeader("Accept"), "text/html") {
+				c.Redirect(http.StatusFound, Path+"/login")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+		c.Next()
+	}
+}
+
+func serve(name string) gin.HandlerFunc {
+	body, err := fs.ReadFile(assets, path.Join("assets", name))
+	if err != nil {
+		panic("adminui: missing asset " + name)
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, contentType, body)
+	}
+}
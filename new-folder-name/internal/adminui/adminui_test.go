@@ -0,0 +1,84 @@
+package adminui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jwtSecret = "adminui-test-secret"
+
+func token(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	require.NoError(t, err)
+	return signed
+}
+
+func router() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r, middleware.AdminMiddleware(jwtSecret))
+	return r
+}
+
+func get(r *gin.Engine, path string, header http.Header, cookie string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: TokenCookie, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAssets(t *testing.T) {
+	r := router()
+	admin := token(t, jwt.MapClaims{"sub": "ops", "scope": middleware.AdminScope})
+	tests := []struct {
+		path, contentType, contains string
+	}{
+		{Path + "/", "text/html", `<script src="/admin/ui/app.js">`},
+		{Path + "/app.js", "javascript", "/api/v1/admin/dashboard"},
+		{Path + "/style.css", "text/css", "body"},
+		{Path + "/login", "text/html", "Admin token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := get(r, tt.path, nil, admin)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Contains(t, w.Header().Get("Content-Type"), tt.contentType)
+			assert.Contains(t, w.Body.String(), tt.contains)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestAuthGating(t *testing.T) {
+	r := router()
+	admin := token(t, jwt.MapClaims{"sub": "ops", "scope": middleware.AdminScope})
+	caller := token(t, jwt.MapClaims{"sub": "client"})
+
+	w := get(r, Path+"/", http.Header{"Accept": {"text/html"}}, "")
+	assert.Equal(t, http.StatusFound, w.Code, "a page load without a token goes to the login page")
+	assert.Equal(t, Path+"/login", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusUnauthorized, get(r, Path+"/app.js", nil, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(r, Path+"/", nil, "not-a-token").Code)
+	assert.Equal(t, http.StatusForbidden, get(r, Path+"/", nil, caller).Code, "the admin scope is required")
+	assert.Equal(t, http.StatusForbidden, get(r, Path+"/app.js",
+		http.Header{"Authorization": {"Bearer " + caller}}, admin).Code, "the header wins over the cookie")
+
+	assert.Equal(t, http.StatusOK, get(r, Path+"/", http.Header{"Authorization": {"Bearer " + admin}}, "").Code)
+	assert.Equal(t, http.StatusOK, get(r, Path+"/", nil, admin).Code)
+	assert.Equal(t, http.StatusOK, get(r, Path+"/login", nil, "").Code, "the login page is public")
+}
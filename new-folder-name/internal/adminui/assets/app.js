@@ -0,0 +1,129 @@
+// Polls the dashboard summary and renders it. The token comes from the
+// login page; without one the page goes back there.
+(function () {
+  "use strict";
+
+  var REFRESH_MS = 5000;
+
+  function token() {
+    var stored = sessionStorage.getItem("admin_ui_token");
+    if (stored) {
+      return stored;
+    }
+    var match = document.cookie.match(/(?:^|; )admin_ui_token=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : "";
+  }
+
+  function signOut() {
+    sessionStorage.removeItem("admin_ui_token");
+    document.cookie = "admin_ui_token=; path=/admin/ui; max-age=0; SameSite=Strict";
+    location.href = "/admin/ui/login";
+  }
+
+  function api(method, path) {
+    return fetch(path, {
+      method: method,
+      headers: { "Authorization": "Bearer " + token(), "X-JSON-Case": "snake" }
+    }).then(function (resp) {
+      if (resp.status === 401 || resp.status === 403) {
+        signOut();
+        throw new Error("not authorized");
+      }
+      return resp.json().then(function (body) {
+        if (!resp.ok) {
+          throw new Error(body.error || body.detail || resp.statusText);
+        }
+        return body.data;
+      });
+    });
+  }
+
+  function cell(row, text, className) {
+    var td = document.createElement("td");
+    td.textContent = text;
+    if (className) {
+      td.className = className;
+    }
+    row.appendChild(td);
+  }
+
+  function fill(id, items, render, empty) {
+    var body = document.getElementById(id);
+    body.textContent = "";
+    if (!items || items.length === 0) {
+      var row = body.insertRow();
+      cell(row, empty, "muted");
+      row.firstChild.colSpan = 4;
+      return;
+    }
+    items.forEach(function (item) {
+      render(body.insertRow(), item);
+    });
+  }
+
+  function render(summary) {
+    var switches = summary.kill_switches;
+    var dl = document.getElementById("kill-switches");
+    dl.textContent = "";
+    [
+      ["Emergency stop", switches.emergency_stop_error || (switches.emergency_stop ? "engaged" : "off")],
+      ["Disabled channels", switches.disabled_channels.length ? switches.disabled_channels.join(", ") : "none"]
+    ].forEach(function (pair) {
+      var dt = document.createElement("dt");
+      var dd = document.createElement("dd");
+      dt.textContent = pair[0];
+      dd.textContent = pair[1];
+      dl.appendChild(dt);
+      dl.appendChild(dd);
+    });
+    document.getElementById("clear-stop").hidden = !switches.emergency_stop;
+
+    fill("breakers", summary.breakers, function (row, breaker) {
+      cell(row, breaker.name);
+      cell(row, breaker.state, "state-" + breaker.state);
+    }, "no breakers");
+    fill("queues", summary.queues, function (row, queue) {
+      cell(row, queue.name);
+      cell(row, queue.missing ? "–" : queue.messages);
+      cell(row, queue.missing ? "–" : queue.consumers);
+      cell(row, queue.missing ? "missing" : (queue.error || ""), "muted");
+    }, "no queues");
+    if (summary.recent_failures_error) {
+      fill("failures", [], null, summary.recent_failures_error);
+    } else {
+      fill("failures", summary.recent_failures, function (row, failure) {
+        cell(row, failure.message_id || "(no id)");
+        cell(row, failure.queue || "");
+        cell(row, failure.reason || failure.failed_reason || "");
+        cell(row, failure.dead_lettered_at ? new Date(failure.dead_lettered_at).toLocaleString() : "");
+      }, "no failed messages");
+    }
+    document.getElementById("updated").textContent = "updated " + new Date(summary.timestamp).toLocaleTimeString();
+  }
+
+  function showError(err) {
+    var el = document.getElementById("error");
+    el.textContent = err ? "Refresh failed: " + err.message : "";
+    el.hidden = !err;
+  }
+
+  function refresh() {
+    return api("GET", "/api/v1/admin/dashboard").then(function (summary) {
+      render(summary);
+      showError(null);
+    }, showError);
+  }
+
+  if (!token()) {
+    location.href = "/admin/ui/login";
+    return;
+  }
+  document.getElementById("signout").addEventListener("click", signOut);
+  document.getElementById("clear-stop").addEventListener("click", function () {
+    if (confirm("Clear the emergency stop and resume sending?")) {
+      api("POST", "/api/v1/admin/emergency/clear").then(refresh, showError);
+    }
+  });
+  refresh();
+  setInterval(refresh, REFRESH_MS);
+})();
@@ -0,0 +1,37 @@
+// Package archive keeps notification status records past their Redis TTL,
+// for the questions that outlive it: what was sent to whom, and when.
+package archive
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+)
+
+// RetryKey is the Redis list of the records waiting to be archived again,
+// before any key prefix.
+const RetryKey = "notification:archive:retry"
+
+// ErrNotFound is returned for a record the archive doesn't have.
+var ErrNotFound = errors.New("status record not archived")
+
+// Store is where archived records are kept. key is the record's Redis key,
+// tenant and key prefix included, so tenants and deployments sharing the
+// archive don't see each other's records.
+type Store interface {
+	// Store writes record under key, replacing an older version of it.
+	Store(ctx context.Context, key string, record models.NotificationStatus) error
+	// Get reads the record under key, ErrNotFound when there is none.
+	Get(ctx context.Context, key string) (models.NotificationStatus, error)
+	// Prune deletes the records last updated before before and returns
+	// how many it deleted.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Entry is a record on its way to the archive.
+type Entry struct {
+	Key    string                    `json:"key" pii:"none"`
+	Record models.NotificationStatus `json:"record" pii:"nested"`
+}
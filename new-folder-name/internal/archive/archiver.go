@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// writeTimeout bounds one write to the archive or the retry list.
+const writeTimeout = 5 * time.Second
+
+// pruneInterval is how often records past the retention are deleted.
+const pruneInterval = time.Hour
+
+// Archiver writes records to a Store in the background, so that archiving
+// never holds up a request. Records wait in a buffered channel; those that
+// find it full, or that the Store refuses, go to a list in Redis and are
+// tried again every cfg.RetryInterval.
+type Archiver struct {
+	store    Store
+	redis    *redis.Client
+	retryKey string
+	cfg      config.ArchiveConfig
+	entries  chan Entry
+	// Clock dates the retention cut-off.
+	Clock clock.Clock
+}
+
+// NewArchiver returns an archiver writing to store, keeping the records it
+// has yet to write in the Redis list retryKey.
+func NewArchiver(store Store, client *redis.Client, retryKey string, cfg config.ArchiveConfig) *Archiver {
+	return &Archiver{
+		store:    store,
+		redis:    client,
+		retryKey: retryKey,
+		cfg:      cfg,
+		entries:  make(chan Entry, max(cfg.Buffer, 1)),
+		Clock:    clock.System,
+	}
+}
+
+// Retention is how long archived records are kept.
+func (a *Archiver) Retention() time.Duration {
+	return a.cfg.Retention
+}
+
+// Archive queues record to be archived under key and returns at once.
+func (a *Archiver) Archive(key string, record models.NotificationStatus) {
+	entry := Entry{Key: key, Record: record}
+	select {
+	case a.entries <- entry:
+	default:
+		go a.retryLater(context.Background(), entry)
+	}
+}
+
+// Get reads the archived record under key, ErrNotFound when there is none.
+func (a *Archiver) Get(ctx context.Context, key string) (models.NotificationStatus, error) {
+	return a.store.Get(ctx, key)
+}
+
+// Run writes the queued records, retries the ones in the retry list and
+// prunes those past the retention, until ctx is done. The records still
+// queued then go to the retry list.
+func (a *Archiver) Run(ctx context.Context) {
+	interval := a.cfg.RetryInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	retry := time.NewTicker(interval)
+	defer retry.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+	for {
+		// checked first, as select would pick between a done ctx and a
+		// queued record at random
+		if ctx.Err() != nil {
+			a.drain()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			a.drain()
+			return
+		case entry := <-a.entries:
+			a.write(ctx, entry)
+		case <-retry.C:
+			if _, err := a.Retry(ctx); err != nil {
+				log.Printf("archive still failing, records wait in the retry list: %v", err)
+			}
+		case <-prune.C:
+			if _, err := a.Prune(ctx); err != nil {
+				log.Printf("failed to prune the archive: %v", err)
+			}
+		}
+	}
+}
+
+// drain moves the records still queued to the retry list.
+func (a *Archiver) drain() {
+	for {
+		select {
+		case entry := <-a.entries:
+			a.retryLater(context.Background(), entry)
+		default:
+			return
+		}
+	}
+}
+
+// write archives entry, sending it to the retry list when the Store
+// refuses it.
+func (a *Archiver) write(ctx context.Context, entry Entry) {
+	writeCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+	err := a.store.Store(writeCtx, entry.Key, entry.Record)
+	cancel()
+	if err != nil {
+		log.Printf("failed to archive %s, will retry: %v", entry.Record.ID, err)
+		a.retryLater(ctx, entry)
+	}
+}
+
+// retryLater adds entry to the retry list, dropping the oldest entries past
+// cfg.RetryMaxLength. An entry Redis won't take either is lost, and logged.
+func (a *Archiver) retryLater(ctx context.Context, entry Entry) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("failed to encode %s for the archive retry list: %v", entry.Record.ID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	_, err = a.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, a.retryKey, payload)
+		if a.cfg.RetryMaxLength > 0 {
+			pipe.LTrim(ctx, a.retryKey, -a.cfg.RetryMaxLength, -1)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("lost %s: neither the archive nor its retry list took it: %v", entry.Record.ID, err)
+	}
+}
+
+// Retry archives the records in the retry list, oldest first, until the
+// list is empty or the Store refuses one, which goes back to the head of
+// the list. It returns how many it archived. Gateways sharing the list each
+// take different records.
+func (a *Archiver) Retry(ctx context.Context) (int, error) {
+	archived := 0
+	for {
+		payload, err := a.redis.LPop(ctx, a.retryKey).Result()
+		if errors.Is(err, redis.Nil) {
+			return archived, nil
+		}
+		if err != nil {
+			return archived, err
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(payload), &entry); err != nil {
+			log.Printf("dropping an undecodable record from the archive retry list: %v", err)
+			continue
+		}
+		writeCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+		err = a.store.Store(writeCtx, entry.Key, entry.Record)
+		cancel()
+		if err != nil {
+			if pushErr := a.redis.LPush(context.WithoutCancel(ctx), a.retryKey, payload).Err(); pushErr != nil {
+				log.Printf("lost %s: it couldn't be put back on the archive retry list: %v", entry.Record.ID, pushErr)
+			}
+			return archived, err
+		}
+		archived++
+	}
+}
+
+// Prune deletes the records past the retention and returns how many. A
+// zero retention keeps them all.
+func (a *Archiver) Prune(ctx context.Context) (int64, error) {
+	if a.cfg.Retention <= 0 {
+		return 0, nil
+	}
+	return a.store.Prune(ctx, a.Clock.Now().Add(-a.cfg.Retention))
+}
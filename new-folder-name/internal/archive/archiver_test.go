@@ -0,0 +1,165 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store in a map that refuses every write while failing.
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]models.NotificationStatus
+	failing bool
+	pruned  time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[string]models.NotificationStatus{}}
+}
+
+func (m *memoryStore) Store(_ context.Context, key string, record models.NotificationStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failing {
+		return errors.New("connection refused")
+	}
+	m.records[key] = record
+	return nil
+}
+
+func (m *memoryStore) Get(_ context.Context, key string) (models.NotificationStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[key]
+	if !ok {
+		return models.NotificationStatus{}, ErrNotFound
+	}
+	return record, nil
+}
+
+func (m *memoryStore) Prune(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruned = before
+	return 0, nil
+}
+
+func (m *memoryStore) setFailing(failing bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failing = failing
+}
+
+func (m *memoryStore) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.records)
+}
+
+func newArchiver(t *testing.T, cfg config.ArchiveConfig) (*Archiver, *memoryStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := newMemoryStore()
+	return NewArchiver(store, client, RetryKey, cfg), store, server
+}
+
+func retryList(t *testing.T, server *miniredis.Miniredis) []string {
+	if !server.Exists(RetryKey) {
+		return nil
+	}
+	list, err := server.List(RetryKey)
+	require.NoError(t, err)
+	return list
+}
+
+func TestArchiver_WritesInBackground(t *testing.T) {
+	archiver, store, _ := newArchiver(t, config.ArchiveConfig{Buffer: 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go archiver.Run(ctx)
+
+	archiver.Archive("notification:status:n-1", models.NotificationStatus{ID: "n-1", Status: "queued"})
+	require.Eventually(t, func() bool { return store.len() == 1 }, time.Second, time.Millisecond)
+	record, err := archiver.Get(ctx, "notification:status:n-1")
+	require.NoError(t, err)
+	assert.Equal(t, "queued", record.Status)
+	_, err = archiver.Get(ctx, "notification:status:n-2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestArchiver_RetriesRefusedRecords(t *testing.T) {
+	archiver, store, server := newArchiver(t, config.ArchiveConfig{Buffer: 10, RetryInterval: time.Hour})
+	store.setFailing(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go archiver.Run(ctx)
+
+	for i := 0; i < 3; i++ {
+		archiver.Archive(fmt.Sprintf("notification:status:n-%d", i), models.NotificationStatus{ID: fmt.Sprintf("n-%d", i)})
+	}
+	require.Eventually(t, func() bool { return len(retryList(t, server)) == 3 }, time.Second, time.Millisecond)
+
+	archived, err := archiver.Retry(ctx)
+	assert.Error(t, err)
+	assert.Zero(t, archived)
+	assert.Len(t, retryList(t, server), 3, "the refused record went back")
+
+	store.setFailing(false)
+	archived, err = archiver.Retry(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, archived)
+	assert.Equal(t, 3, store.len())
+	assert.Empty(t, retryList(t, server))
+}
+
+func TestArchiver_FullBufferSpillsToRetryList(t *testing.T) {
+	archiver, store, server := newArchiver(t, config.ArchiveConfig{Buffer: 1})
+	archiver.Archive("notification:status:n-1", models.NotificationStatus{ID: "n-1"})
+	archiver.Archive("notification:status:n-2", models.NotificationStatus{ID: "n-2"})
+	require.Eventually(t, func() bool { return len(retryList(t, server)) == 1 }, time.Second, time.Millisecond)
+	assert.Contains(t, retryList(t, server)[0], `"n-2"`)
+
+	// stopping moves what is still queued there too, not to the store
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	archiver.Run(ctx)
+	assert.Len(t, retryList(t, server), 2)
+	assert.Zero(t, store.len())
+}
+
+func TestArchiver_RetryListCapped(t *testing.T) {
+	archiver, _, server := newArchiver(t, config.ArchiveConfig{RetryMaxLength: 2})
+	for i := 0; i < 3; i++ {
+		archiver.retryLater(context.Background(), Entry{Key: "k", Record: models.NotificationStatus{ID: fmt.Sprintf("n-%d", i)}})
+	}
+	list := retryList(t, server)
+	require.Len(t, list, 2)
+	assert.Contains(t, list[0], `"n-1"`, "the oldest is dropped")
+}
+
+func TestArchiver_Prune(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	archiver, store, _ := newArchiver(t, config.ArchiveConfig{Retention: 90 * 24 * time.Hour})
+	archiver.Clock = clock.NewFake(now)
+	_, err := archiver.Prune(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, -90), store.pruned)
+
+	archiver, store, _ = newArchiver(t, config.ArchiveConfig{})
+	_, err = archiver.Prune(context.Background())
+	require.NoError(t, err)
+	assert.True(t, store.pruned.IsZero(), "no retention keeps everything")
+}
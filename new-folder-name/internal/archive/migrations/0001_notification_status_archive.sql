@@ -0,0 +1,23 @@
+-- Status records kept past their Redis TTL. key is the record's Redis key,
+-- tenant and key prefix included, so that tenants and deployments sharing
+-- the archive keep apart.
+CREATE TABLE notification_status_archive (
+    key         text PRIMARY KEY,
+    id          text NOT NULL,
+    tenant_id   text NOT NULL DEFAULT '',
+    user_id     text NOT NULL DEFAULT '',
+    type        text NOT NULL DEFAULT '',
+    status      text NOT NULL DEFAULT '',
+    record      jsonb NOT NULL,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    archived_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- "what was sent to whom" reads by user, newest first
+CREATE INDEX notification_status_archive_user
+    ON notification_status_archive (tenant_id, user_id, created_at DESC);
+
+-- retention prunes by age
+CREATE INDEX notification_status_archive_updated
+    ON notification_status_archive (updated_at);
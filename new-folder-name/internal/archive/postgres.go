@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock is the advisory lock gateways starting together take turns
+// on to migrate the archive.
+const migrationLock = 7_031_845_112
+
+// Postgres is a Store in a Postgres table, notification_status_archive.
+type Postgres struct {
+	db *sql.DB
+}
+
+// OpenPostgres connects to the Postgres dsn names and brings its schema up
+// to date.
+func OpenPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive.dsn: %w", err)
+	}
+	p := &Postgres{db: db}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to the archive: %w", err)
+	}
+	if err := p.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Close closes the connections to the database.
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
+
+// Migrate applies the migrations in migrations/ the database hasn't had
+// yet, in name order, each in a transaction with its row in
+// archive_schema_migrations.
+func (p *Postgres) Migrate(ctx context.Context) error {
+	// the advisory lock belongs to the session, so everything runs on one
+	// connection
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the archive: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return fmt.Errorf("failed to lock the archive for migration: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS archive_schema_migrations (
+		version    text PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("failed to create archive_schema_migrations: %w", err)
+	}
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var applied bool
+		if err := conn.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM archive_schema_migrations WHERE version = $1)`, name).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to read archive_schema_migrations: %w", err)
+		}
+		if applied {
+			continue
+		}
+		if err := applyMigration(ctx, conn, name); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, name string) error {
+	migration, err := migrations.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, string(migration)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO archive_schema_migrations (version) VALUES ($1)`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Store writes record under key. A record is only replaced by one updated
+// no earlier, so a retried older version doesn't undo a newer one.
+func (p *Postgres) Store(ctx context.Context, key string, record models.NotificationStatus) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO notification_status_archive
+			(key, id, tenant_id, user_id, type, status, record, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (key) DO UPDATE SET
+			status = EXCLUDED.status,
+			record = EXCLUDED.record,
+			updated_at = EXCLUDED.updated_at,
+			archived_at = now()
+		WHERE notification_status_archive.updated_at <= EXCLUDED.updated_at`,
+		key, record.ID, record.TenantID, record.UserID, record.Type, record.Status,
+		recordJSON, record.CreatedAt, record.UpdatedAt)
+	return err
+}
+
+// Get reads the record under key.
+func (p *Postgres) Get(ctx context.Context, key string) (models.NotificationStatus, error) {
+	var recordJSON []byte
+	err := p.db.QueryRowContext(ctx,
+		`SELECT record FROM notification_status_archive WHERE key = $1`, key).Scan(&recordJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.NotificationStatus{}, ErrNotFound
+	}
+	if err != nil {
+		return models.NotificationStatus{}, err
+	}
+	var record models.NotificationStatus
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return models.NotificationStatus{}, fmt.Errorf("failed to decode archived %s: %w", key, err)
+	}
+	return record, nil
+}
+
+// Prune deletes the records last updated before before.
+func (p *Postgres) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := p.db.ExecContext(ctx,
+		`DELETE FROM notification_status_archive WHERE updated_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dsn = flag.String("archive-dsn", "", "run the Postgres tests against this database, whose archive tables they drop")
+
+func openPostgres(t *testing.T) *Postgres {
+	if *dsn == "" {
+		t.Skip("-archive-dsn is required")
+	}
+	ctx := context.Background()
+	p, err := OpenPostgres(ctx, *dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		p.db.ExecContext(ctx, `DROP TABLE IF EXISTS notification_status_archive, archive_schema_migrations`)
+		p.Close()
+	})
+	return p
+}
+
+func TestPostgres_StoreGetPrune(t *testing.T) {
+	p := openPostgres(t)
+	ctx := context.Background()
+	require.NoError(t, p.Migrate(ctx), "migrating again is a no-op")
+
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	record := models.NotificationStatus{ID: "n-1", UserID: "user123", Type: "email", Status: "queued", CreatedAt: created, UpdatedAt: created}
+	require.NoError(t, p.Store(ctx, "notification:status:n-1", record))
+	delivered := record
+	delivered.Status, delivered.UpdatedAt = "delivered", created.Add(time.Minute)
+	require.NoError(t, p.Store(ctx, "notification:status:n-1", delivered))
+	require.NoError(t, p.Store(ctx, "notification:status:n-1", record), "a retried older version")
+
+	got, err := p.Get(ctx, "notification:status:n-1")
+	require.NoError(t, err)
+	assert.Equal(t, "delivered", got.Status)
+	_, err = p.Get(ctx, "tenant:acme:notification:status:n-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	pruned, err := p.Prune(ctx, created)
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+	pruned, err = p.Prune(ctx, created.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+}
@@ -0,0 +1,140 @@
+// Package budget splits a request's deadline between the phases of the work
+// it does, so no phase is given longer than the request has left.
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/pkg/clock"
+)
+
+// Phase is a step of the enqueue pipeline. Phases run in the order below.
+type Phase string
+
+const (
+	// Validation covers the lookups that decide whether a send may go:
+	// user, template, preferences and policy checks, deduplication.
+	Validation Phase = "validation"
+	// Publish hands the message to the broker.
+	Publish Phase = "publish"
+	// Persistence stores the status record. It is the only phase that can
+	// be skipped: the message is already queued by then.
+	Persistence Phase = "persistence"
+)
+
+var phases = []Phase{Validation, Publish, Persistence}
+
+const (
+	defaultValidationShare  = 0.4
+	defaultPublishShare     = 0.4
+	defaultPersistenceShare = 0.2
+	defaultMinRemaining     = 50 * time.Millisecond
+)
+
+var (
+	// ErrExhausted is returned by Start for a phase that starts with less
+	// than the minimum left.
+	ErrExhausted = errors.New("request budget exhausted")
+	// ErrSkipped is returned by Start for a skippable phase that starts with
+	// less than the minimum left, when the policy is to skip it.
+	ErrSkipped = errors.New("phase skipped, request budget exhausted")
+)
+
+// Budget allots a deadline to each phase. A budget for a request without
+// a deadline allots none, and every phase runs under the request's context
+// as it is.
+type Budget struct {
+	deadline     time.Time
+	hasDeadline  bool
+	shares       map[Phase]float64
+	minRemaining time.Duration
+	skipShort    bool
+	clock        clock.Clock
+}
+
+// New returns the budget for the request whose context is ctx, timed by
+// clk.
+func New(ctx context.Context, cfg config.RequestBudgetConfig, clk clock.Clock) *Budget {
+	shares := map[Phase]float64{
+		Validation:  cfg.ValidationShare,
+		Publish:     cfg.PublishShare,
+		Persistence: cfg.PersistenceShare,
+	}
+	if shares[Validation] <= 0 && shares[Publish] <= 0 && shares[Persistence] <= 0 {
+		shares = map[Phase]float64{
+			Validation:  defaultValidationShare,
+			Publish:     defaultPublishShare,
+			Persistence: defaultPersistenceShare,
+		}
+	}
+	minRemaining := cfg.MinRemaining
+	if minRemaining <= 0 {
+		minRemaining = defaultMinRemaining
+	}
+	deadline, ok := ctx.Deadline()
+	return &Budget{
+		deadline:     deadline,
+		hasDeadline:  ok,
+		shares:       shares,
+		minRemaining: minRemaining,
+		skipShort:    cfg.ShortPhase == "skip",
+		clock:        clk,
+	}
+}
+
+// Deadline is when phase must be done if it starts now: its share of the
+// time left, split with the phases after it, so time a phase doesn't use
+// goes to the later ones. It is never after the request's deadline; the
+// last phase, and a phase without a share, gets all that is left. ok is
+// false without a request deadline.
+func (b *Budget) Deadline(phase Phase) (deadline time.Time, ok bool) {
+	if !b.hasDeadline {
+		return time.Time{}, false
+	}
+	now := b.clock.Now()
+	remaining := b.deadline.Sub(now)
+	if remaining <= 0 {
+		return b.deadline, true
+	}
+	share, rest := b.shares[phase], 0.0
+	after := false
+	for _, p := range phases {
+		if p == phase {
+			after = true
+		}
+		if after {
+			rest += max(b.shares[p], 0)
+		}
+	}
+	if share <= 0 || rest <= 0 || share >= rest {
+		return b.deadline, true
+	}
+	deadline = now.Add(time.Duration(float64(remaining) * share / rest))
+	if deadline.After(b.deadline) {
+		deadline = b.deadline
+	}
+	return deadline, true
+}
+
+// Start returns the context phase runs under, ctx bounded by the phase's
+// deadline, and the function releasing it. A phase starting with less than
+// the minimum left fails with ErrExhausted, or ErrSkipped when it is the
+// persistence phase and the policy is to skip it.
+func (b *Budget) Start(ctx context.Context, phase Phase) (context.Context, context.CancelFunc, error) {
+	deadline, ok := b.Deadline(phase)
+	if !ok {
+		return ctx, func() {}, nil
+	}
+	if remaining := b.deadline.Sub(b.clock.Now()); remaining < b.minRemaining {
+		if phase == Persistence && b.skipShort {
+			return nil, nil, fmt.Errorf("%s phase with %s left: %w", phase, remaining, ErrSkipped)
+		}
+		return nil, nil, fmt.Errorf("%s phase with %s left: %w", phase, remaining, ErrExhausted)
+	}
+	phaseCtx, cancel := context.WithDeadline(ctx, deadline)
+	return phaseCtx, cancel, nil
+}
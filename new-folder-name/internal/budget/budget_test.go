@@ -0,0 +1,132 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedBudget is a budget whose request deadline is total after start and
+// whose clock reads start until moved.
+func fixedBudget(cfg config.RequestBudgetConfig, total time.Duration) (*Budget, *clock.Fake) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(total))
+	defer cancel()
+	now := clock.NewFake(start)
+	return New(ctx, cfg, now), now
+}
+
+func TestDeadline_SplitsWhatIsLeft(t *testing.T) {
+	b, now := fixedBudget(config.RequestBudgetConfig{}, time.Second)
+	start := now.Now()
+
+	deadline, ok := b.Deadline(Validation)
+	require.True(t, ok)
+	assert.Equal(t, start.Add(400*time.Millisecond), deadline, "40% of the whole budget")
+
+	// validation took 100ms: publish gets 40/60 of the 900ms left
+	now.Set(start.Add(100 * time.Millisecond))
+	deadline, _ = b.Deadline(Publish)
+	assert.WithinDuration(t, start.Add(700*time.Millisecond), deadline, time.Microsecond)
+
+	now.Set(start.Add(300 * time.Millisecond))
+	deadline, _ = b.Deadline(Persistence)
+	assert.Equal(t, start.Add(time.Second), deadline, "the last phase gets all that is left")
+}
+
+func TestDeadline_ConfiguredShares(t *testing.T) {
+	b, now := fixedBudget(config.RequestBudgetConfig{ValidationShare: 1, PublishShare: 2, PersistenceShare: 1}, 2*time.Second)
+
+	deadline, _ := b.Deadline(Validation)
+	assert.Equal(t, now.Now().Add(500*time.Millisecond), deadline)
+	deadline, _ = b.Deadline(Publish)
+	assert.WithinDuration(t, now.Now().Add(4*time.Second/3), deadline, time.Microsecond)
+}
+
+func TestDeadline_NeverAfterTheRequest(t *testing.T) {
+	configs := []config.RequestBudgetConfig{
+		{},
+		{ValidationShare: 10, PublishShare: 0.001, PersistenceShare: 0.001},
+		{ValidationShare: 0, PublishShare: 1, PersistenceShare: 0},
+		{ValidationShare: -1, PublishShare: 3, PersistenceShare: 2},
+	}
+	for _, cfg := range configs {
+		b, now := fixedBudget(cfg, time.Second)
+		requestDeadline := now.Now().Add(time.Second)
+		for _, elapsed := range []time.Duration{0, 500 * time.Millisecond, time.Second, 2 * time.Second} {
+			now.Set(requestDeadline.Add(-time.Second + elapsed))
+			for _, phase := range phases {
+				deadline, ok := b.Deadline(phase)
+				require.True(t, ok)
+				assert.False(t, deadline.After(requestDeadline), "%+v %s after %s", cfg, phase, elapsed)
+			}
+		}
+	}
+}
+
+func TestStart_ShortPhase(t *testing.T) {
+	b, now := fixedBudget(config.RequestBudgetConfig{}, time.Second)
+	now.Advance(960 * time.Millisecond)
+
+	_, _, err := b.Start(context.Background(), Validation)
+	assert.ErrorIs(t, err, ErrExhausted)
+	_, _, err = b.Start(context.Background(), Persistence)
+	assert.ErrorIs(t, err, ErrExhausted, "failing is the default")
+
+	skipping, now := fixedBudget(config.RequestBudgetConfig{ShortPhase: "skip", MinRemaining: 100 * time.Millisecond}, time.Second)
+	now.Advance(920 * time.Millisecond)
+	_, _, err = skipping.Start(context.Background(), Persistence)
+	assert.ErrorIs(t, err, ErrSkipped)
+	_, _, err = skipping.Start(context.Background(), Publish)
+	assert.ErrorIs(t, err, ErrExhausted, "only persistence can be skipped")
+
+	now.Advance(-100 * time.Millisecond)
+	ctx, cancel, err := skipping.Start(context.Background(), Persistence)
+	require.NoError(t, err)
+	cancel()
+	assert.NotNil(t, ctx)
+}
+
+func TestStart_WithoutDeadline(t *testing.T) {
+	ctx := context.Background()
+	b := New(ctx, config.RequestBudgetConfig{}, clock.System)
+
+	for _, phase := range phases {
+		phaseCtx, cancel, err := b.Start(ctx, phase)
+		require.NoError(t, err)
+		cancel()
+		_, ok := phaseCtx.Deadline()
+		assert.False(t, ok)
+	}
+}
+
+func TestStart_NeverOutlivesTheRequest(t *testing.T) {
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Minute)
+	parentDeadline, _ := parent.Deadline()
+	b := New(parent, config.RequestBudgetConfig{}, clock.System)
+
+	var phaseCtxs []context.Context
+	for _, phase := range phases {
+		phaseCtx, cancel, err := b.Start(parent, phase)
+		require.NoError(t, err)
+		defer cancel()
+		deadline, ok := phaseCtx.Deadline()
+		require.True(t, ok)
+		assert.False(t, deadline.After(parentDeadline), phase)
+		phaseCtxs = append(phaseCtxs, phaseCtx)
+	}
+
+	cancelParent()
+	for i, phaseCtx := range phaseCtxs {
+		select {
+		case <-phaseCtx.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%s context outlived the request", phases[i])
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/franzego/stage04/pkg/clock"
+)
+
+// LRU is a small size-bounded cache whose entries also expire after a fixed
+// TTL. It is safe for concurrent use. A nil *LRU is a valid, always-empty
+// cache so callers can leave it unconfigured.
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List
+	clock    clock.Clock
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type entry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// Stats is a snapshot of the cache counters.
+type Stats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	Size     int     `json:"size"`
+}
+
+func NewLRU(capacity int, ttl time.Duration) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+		clock:    clock.System,
+	}
+}
+
+// SetClock replaces the clock the entries expire by.
+func (l *LRU) SetClock(c clock.Clock) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = c
+}
+
+func (l *LRU) Get(key string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		l.misses.Add(1)
+		return "", false
+	}
+	e := el.Value.(*entry)
+	if !l.clock.Now().Before(e.expiresAt) {
+		l.removeElement(el)
+		l.misses.Add(1)
+		return "", false
+	}
+	l.order.MoveToFront(el)
+	l.hits.Add(1)
+	return e.value, true
+}
+
+func (l *LRU) Set(key, value string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiresAt := l.clock.Now().Add(l.ttl)
+	if el, ok := l.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value = value
+		e.expiresAt = expiresAt
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for l.order.Len() > l.capacity {
+		l.removeElement(l.order.Back())
+	}
+}
+
+// Delete invalidates key. Writers call it after updating the source of truth.
+func (l *LRU) Delete(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.removeElement(el)
+	}
+}
+
+func (l *LRU) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	l.mu.Lock()
+	size := l.order.Len()
+	l.mu.Unlock()
+
+	hits, misses := l.hits.Load(), l.misses.Load()
+	stats := Stats{Hits: hits, Misses: misses, Size: size}
+	if total := hits + misses; total > 0 {
+		stats.HitRatio = float64(hits) / float64(total)
+	}
+	return stats
+}
+
+func (l *LRU) removeElement(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.items, el.Value.(*entry).key)
+}
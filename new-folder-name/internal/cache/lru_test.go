@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_ExpiresAfterTTL(t *testing.T) {
+	now := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := NewLRU(10, 2*time.Second)
+	l.SetClock(now)
+
+	l.Set("a", "1")
+	value, ok := l.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+
+	now.Advance(2 * time.Second)
+	_, ok = l.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, l.Stats().Size)
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	l := NewLRU(2, time.Minute)
+
+	l.Set("a", "1")
+	l.Set("b", "2")
+	l.Get("a") // a is now the most recently used
+	l.Set("c", "3")
+
+	_, ok := l.Get("b")
+	assert.False(t, ok)
+	_, ok = l.Get("a")
+	assert.True(t, ok)
+	_, ok = l.Get("c")
+	assert.True(t, ok)
+}
+
+func TestLRU_DeleteInvalidates(t *testing.T) {
+	l := NewLRU(10, time.Minute)
+
+	l.Set("a", "old")
+	l.Delete("a")
+	_, ok := l.Get("a")
+	assert.False(t, ok)
+}
+
+func TestLRU_Stats(t *testing.T) {
+	l := NewLRU(10, time.Minute)
+
+	l.Set("a", "1")
+	l.Get("a")
+	l.Get("a")
+	l.Get("a")
+	l.Get("missing")
+
+	stats := l.Stats()
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 0.75, stats.HitRatio)
+	assert.Equal(t, 1, stats.Size)
+}
+
+func TestLRU_NilIsAnEmptyCache(t *testing.T) {
+	var l *LRU
+
+	l.Set("a", "1")
+	_, ok := l.Get("a")
+	assert.False(t, ok)
+	l.Delete("a")
+	assert.Equal(t, Stats{}, l.Stats())
+}
+
+func BenchmarkLRU_Get(b *testing.B) {
+	l := NewLRU(1024, time.Minute)
+	for i := 0; i < 1024; i++ {
+		l.Set(fmt.Sprintf("key-%d", i), "value")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Get(fmt.Sprintf("key-%d", i%1024))
+	}
+}
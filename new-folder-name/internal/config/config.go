@@ -0,0 +1,669 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type Config struct {
+	Server        ServerConfig
+	RabbitMQ      RabbitMQConfig
+	Redis         RedisConfig
+	Services      ServicesConfig
+	Auth          AuthConfig
+	Safety        SafetyConfig
+	Notifications NotificationsConfig
+	Workers       WorkersConfig
+	Metrics       MetricsConfig
+	WebPush       WebPushConfig `mapstructure:"web_push"`
+	MockServices  bool
+	// Environment names this deployment (e.g. "production", "staging"). It
+	// is stamped on every published message.
+	Environment string      `mapstructure:"environment"`
+	Queue       QueueConfig `mapstructure:"queue"`
+	Kafka       KafkaConfig `mapstructure:"kafka"`
+	NATS        NATSConfig  `mapstructure:"nats"`
+	// Archive keeps status records in Postgres past their Redis TTL.
+	Archive ArchiveConfig `mapstructure:"archive"`
+}
+
+// ArchiveConfig configures the status archive. Every status record written
+// is also stored there, in the background, and read back from there once
+// Redis no longer has it.
+type ArchiveConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// DSN is the Postgres connection string; deployments set ARCHIVE_DSN
+	// instead of committing it.
+	DSN string `mapstructure:"dsn"`
+	// Buffer is how many records wait in memory for the archive before
+	// the rest go to the retry list.
+	Buffer int `mapstructure:"buffer"`
+	// RetryInterval is how often records that couldn't be archived are
+	// tried again, from a list in Redis holding at most RetryMaxLength.
+	RetryInterval  time.Duration `mapstructure:"retry_interval"`
+	RetryMaxLength int64         `mapstructure:"retry_max_length"`
+	// Retention is how long an archived record is kept after its last
+	// update.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// QueueConfig picks the broker the handlers publish to.
+type QueueConfig struct {
+	// Backend is "rabbitmq", "nats", "kafka" or "memory". The workers and
+	// the queue admin endpoints stay on RabbitMQ whichever it is.
+	Backend string `mapstructure:"backend"`
+}
+
+// NotificationsConfig holds the knobs the notification handlers read.
+type NotificationsConfig struct {
+	// LegacyStatusReadAllOnly restricts status records written before the
+	// creator was recorded to callers holding the read-all scope.
+	LegacyStatusReadAllOnly bool `mapstructure:"legacy_status_read_all_only"`
+	// MaxExtraRecipients caps the combined number of CC and BCC recipients.
+	MaxExtraRecipients int `mapstructure:"max_extra_recipients"`
+	// SendTimeMaxDelay bounds how far send-time optimization may defer a
+	// notification.
+	SendTimeMaxDelay time.Duration `mapstructure:"send_time_max_delay"`
+	// TopicPattern is the allowlist regular expression for broadcast topics.
+	TopicPattern string `mapstructure:"topic_pattern"`
+	// StatusCacheSize bounds the in-process cache in front of Redis for
+	// status reads and idempotency lookups. Zero disables it.
+	StatusCacheSize int           `mapstructure:"status_cache_size"`
+	StatusCacheTTL  time.Duration `mapstructure:"status_cache_ttl"`
+	// DefaultLocale is used when neither the request nor the user service
+	// provides one.
+	DefaultLocale string `mapstructure:"default_locale"`
+	// StatusStreamMaxDuration closes status event streams that have not
+	// reached a terminal state by then.
+	StatusStreamMaxDuration time.Duration `mapstructure:"status_stream_max_duration"`
+	// MaxSnoozes caps how many times one notification may be snoozed, and
+	// MaxSnoozeDuration how far ahead a snooze may reach.
+	MaxSnoozes        int           `mapstructure:"max_snoozes"`
+	MaxSnoozeDuration time.Duration `mapstructure:"max_snooze_duration"`
+	// PreferencesCacheTTL is how long user preferences are cached in Redis.
+	PreferencesCacheTTL time.Duration `mapstructure:"preferences_cache_ttl"`
+	// QuietHoursStart and QuietHoursEnd bound the nightly window, as "HH:MM"
+	// in the user's timezone, during which deliveries may be deferred. The
+	// window wraps midnight when the start is after the end.
+	QuietHoursStart string `mapstructure:"quiet_hours_start"`
+	QuietHoursEnd   string `mapstructure:"quiet_hours_end"`
+	// DedupeWindow suppresses repeats of a send to the same user with the
+	// same template and type for this long. Zero disables suppression.
+	DedupeWindow time.Duration `mapstructure:"dedupe_window"`
+	// DuplicateWindow is how long a delivery's fingerprint is kept to catch
+	// the same content going to the same recipient again. Zero turns the
+	// duplicate detector off.
+	DuplicateWindow time.Duration `mapstructure:"duplicate_window"`
+	// ConsumedTTL is how long a worker's mark on a notification it took off
+	// the queue is kept, so that a redelivery of one that already went out
+	// is acked and skipped. Zero turns consumer deduplication off.
+	ConsumedTTL time.Duration `mapstructure:"consumed_ttl"`
+	// ConsumedFailOpen sends anyway when Redis can't be asked for the mark.
+	// Off, the delivery is requeued as for a transient send failure.
+	ConsumedFailOpen bool `mapstructure:"consumed_fail_open"`
+	// StatusTTL is how long a status record, and the indexes pointing at
+	// it, are kept after it is written.
+	StatusTTL time.Duration `mapstructure:"status_ttl"`
+	// IdempotencyTTL is how long a notification ID is remembered to turn
+	// away a repeat of it.
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+	// IdempotencyFailOpen sends anyway when Redis can't be asked whether a
+	// notification ID was taken. Off, the send is refused with a 503.
+	IdempotencyFailOpen bool `mapstructure:"idempotency_fail_open"`
+	// Degraded is how the gateway carries on while Redis is unreachable.
+	Degraded DegradedConfig `mapstructure:"degraded"`
+	// UserIndexMaxLength is how many of a user's newest notifications the
+	// per-user index keeps.
+	UserIndexMaxLength int64 `mapstructure:"user_index_max_length"`
+	// EventsChannel is the Redis pub/sub channel every status change is
+	// published to, for services that react to them. Empty turns the
+	// events off.
+	EventsChannel string `mapstructure:"events_channel"`
+	// OutboxMaxLength caps each queue's outbox in Redis, where a send is
+	// kept while the broker is unreachable until the flusher can publish
+	// it. A send past the cap is rejected with 503. Zero turns the outbox
+	// off, failing such sends at once.
+	OutboxMaxLength int64 `mapstructure:"outbox_max_length"`
+	// OutboxFlushInterval is how often the outbox is drained.
+	OutboxFlushInterval time.Duration `mapstructure:"outbox_flush_interval"`
+	// ApprovalTTL is how long a send held for approval waits before it
+	// expires.
+	ApprovalTTL time.Duration `mapstructure:"approval_ttl"`
+	// DefaultTenant is assigned to callers whose token names no tenant. Its
+	// Redis keys are unprefixed, so data written before tenancy stays
+	// readable.
+	DefaultTenant string `mapstructure:"default_tenant"`
+	// TemplateSyntax is the placeholder syntax ("go" or "mustache") assumed
+	// for templates whose syntax the template service doesn't report.
+	TemplateSyntax string `mapstructure:"template_syntax"`
+	// TemplateVariableCheck is "warn" to add warnings to send responses for
+	// template variables the request doesn't provide, or "off".
+	TemplateVariableCheck string `mapstructure:"template_variable_check"`
+	// DisabledChannels turns sending off on the listed channels ("email",
+	// "push", "whatsapp") without stopping the others.
+	DisabledChannels []string `mapstructure:"disabled_channels"`
+	// TrustedClients are the callers, by client name or token subject, shown
+	// every status field. Others get the public view, which leaves out
+	// InternalStatusFields (JSON names) and reports failures by category.
+	TrustedClients       []string `mapstructure:"trusted_clients"`
+	InternalStatusFields []string `mapstructure:"internal_status_fields"`
+	// PolicyChain names the pre-send policy checks, in the order they run:
+	// the built-in "preferences" and "quiet_hours", "webhook" when
+	// PolicyWebhook has a URL, and any registered by the server.
+	PolicyChain   []string            `mapstructure:"policy_chain"`
+	PolicyWebhook PolicyWebhookConfig `mapstructure:"policy_webhook"`
+	// Budget splits a send's deadline, server.timeout, between its phases.
+	Budget RequestBudgetConfig `mapstructure:"budget"`
+	// UserSummaryWindow is how far back a user's notification summary
+	// counts, and UserSummaryCacheTTL how long a computed summary is served
+	// from Redis before it is counted again.
+	UserSummaryWindow   time.Duration `mapstructure:"user_summary_window"`
+	UserSummaryCacheTTL time.Duration `mapstructure:"user_summary_cache_ttl"`
+	// JSONCase picks the key case of API responses and status events.
+	JSONCase JSONCaseConfig `mapstructure:"json_case"`
+	// TemplateManifest is the path of the YAML or JSON list of templates the
+	// deployment uses, fetched at startup; empty disables it. With
+	// TemplateManifestGate a missing critical template fails the health
+	// check.
+	TemplateManifest     string `mapstructure:"template_manifest"`
+	TemplateManifestGate bool   `mapstructure:"template_manifest_gate"`
+	// TemplateCacheSize templates are kept for TemplateCacheTTL after they
+	// are fetched. Zero disables the cache.
+	TemplateCacheSize int           `mapstructure:"template_cache_size"`
+	TemplateCacheTTL  time.Duration `mapstructure:"template_cache_ttl"`
+}
+
+// JSONCaseConfig picks the key case, "snake" or "camel", callers get their
+// JSON in. A caller may ask for either in the X-JSON-Case header; otherwise
+// CamelClients, by client name or token subject, and CamelTenants get
+// camelCase and everyone else Default. Requests are accepted in either
+// case regardless.
+type JSONCaseConfig struct {
+	Default      string   `mapstructure:"default"`
+	CamelClients []string `mapstructure:"camel_clients"`
+	CamelTenants []string `mapstructure:"camel_tenants"`
+}
+
+// RequestBudgetConfig splits a request's deadline between the validation,
+// publish and persistence phases in proportion to their shares. A phase
+// starting with less than MinRemaining left fails the request fast, or,
+// when ShortPhase is "skip", the persistence phase is skipped instead.
+type RequestBudgetConfig struct {
+	ValidationShare  float64       `mapstructure:"validation_share"`
+	PublishShare     float64       `mapstructure:"publish_share"`
+	PersistenceShare float64       `mapstructure:"persistence_share"`
+	MinRemaining     time.Duration `mapstructure:"min_remaining"`
+	ShortPhase       string        `mapstructure:"short_phase"`
+}
+
+// PolicyWebhookConfig configures the external policy check. The service at
+// URL must answer within Timeout; when it doesn't, or answers nonsense, the
+// send is allowed if FailOpen is set and refused otherwise.
+type PolicyWebhookConfig struct {
+	URL      string        `mapstructure:"url"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	FailOpen bool          `mapstructure:"fail_open"`
+}
+
+// The policies for sends while status storage is degraded.
+const (
+	DegradedAccept = "accept"
+	DegradedReject = "reject"
+)
+
+// DegradedConfig configures degraded mode: after After Redis failures in a
+// row new status records are kept in memory, up to Capacity of them, and
+// written to Redis once a probe every ProbeInterval finds it back. Policy
+// is DegradedAccept to take sends meanwhile, skipping the idempotency
+// check, or DegradedReject to answer them 503. Zero Capacity turns
+// degraded mode off.
+type DegradedConfig struct {
+	Capacity      int           `mapstructure:"capacity"`
+	After         int           `mapstructure:"after"`
+	ProbeInterval time.Duration `mapstructure:"probe_interval"`
+	Policy        string        `mapstructure:"policy"`
+}
+
+// WorkersConfig controls the queue consumers run inside the gateway.
+type WorkersConfig struct {
+	// Email starts the email queue consumer. There is no email provider
+	// yet, so it only starts in mock mode, with the loopback sender.
+	Email bool `mapstructure:"email"`
+	// Push starts the push queue consumer, likewise only in mock mode.
+	Push bool `mapstructure:"push"`
+	// Concurrency is how many deliveries a consumer processes at once.
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+// MetricsConfig controls the Prometheus metrics. Bucket boundaries are in
+// seconds, per histogram family; an empty list keeps that family's default.
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	// MaxBuckets rejects bucket lists longer than this, since every bucket is
+	// a series per label combination.
+	MaxBuckets             int       `mapstructure:"max_buckets"`
+	RequestDurationBuckets []float64 `mapstructure:"request_duration_buckets"`
+	PublishDurationBuckets []float64 `mapstructure:"publish_duration_buckets"`
+	DeliveryLatencyBuckets []float64 `mapstructure:"delivery_latency_buckets"`
+	// NativeHistograms also exposes every histogram as a Prometheus native
+	// histogram, for scrapers that negotiate the protobuf format. The
+	// classic buckets are still exposed for those that don't.
+	NativeHistograms bool `mapstructure:"native_histograms"`
+	// NativeBucketFactor bounds the relative width of a native bucket, and
+	// NativeMaxBuckets how many a histogram may grow before its resolution
+	// is reduced.
+	NativeBucketFactor float64 `mapstructure:"native_bucket_factor"`
+	NativeMaxBuckets   uint32  `mapstructure:"native_max_buckets"`
+}
+
+type ServerConfig struct {
+	Port    string
+	Timeout time.Duration
+	// ShutdownTimeout bounds finishing the requests in flight and the
+	// publishes still under way once the server is told to stop.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+type RabbitMQConfig struct {
+	URL         string
+	EmailQueue  string
+	PushQueue   string
+	FailedQueue string
+	Exchange    string
+	// WhatsAppQueue carries WhatsApp Business template messages.
+	WhatsAppQueue string `mapstructure:"whatsapp_queue"`
+	// QuarantineQueue receives messages a consumer refused to process.
+	QuarantineQueue string `mapstructure:"quarantine_queue"`
+	// RetryExchange routes failed deliveries to the wait queue for their
+	// delay; RetryDelays lists the wait queues' delays.
+	RetryExchange    string          `mapstructure:"retry_exchange"`
+	RetryDelays      []time.Duration `mapstructure:"retry_delays"`
+	MaxRetryAttempts int             `mapstructure:"max_retry_attempts"`
+	// Compression gzips bodies longer than CompressionThreshold bytes,
+	// setting the gzip content encoding; consumers read both kinds.
+	Compression          bool `mapstructure:"compression"`
+	CompressionThreshold int  `mapstructure:"compression_threshold"`
+	// PublishWindow is how many messages PublishBatch sends before waiting
+	// for their confirms.
+	PublishWindow int `mapstructure:"publish_window"`
+	// PublisherConfirms makes Publish wait for the broker to accept each
+	// message before reporting it queued. Turning it off trades that
+	// guarantee for a round trip less per request.
+	PublisherConfirms bool `mapstructure:"publisher_confirms"`
+	// When the broker goes away the client redials, waiting from
+	// ReconnectMinBackoff up to ReconnectMaxBackoff between attempts.
+	// Publishes made meanwhile wait up to ReconnectPublishWait for the
+	// connection to come back before failing.
+	ReconnectMinBackoff  time.Duration `mapstructure:"reconnect_min_backoff"`
+	ReconnectMaxBackoff  time.Duration `mapstructure:"reconnect_max_backoff"`
+	ReconnectPublishWait time.Duration `mapstructure:"reconnect_publish_wait"`
+	// A publish failing on the connection or channel is tried up to
+	// PublishRetryAttempts times in all, waiting PublishRetryBaseDelay,
+	// doubling, plus up to PublishRetryJitter between tries. 1 disables
+	// retries.
+	PublishRetryAttempts  int           `mapstructure:"publish_retry_attempts"`
+	PublishRetryBaseDelay time.Duration `mapstructure:"publish_retry_base_delay"`
+	PublishRetryJitter    time.Duration `mapstructure:"publish_retry_jitter"`
+	// MaxPriority is the x-max-priority the work queues are declared with,
+	// up to 255; 0 declares them without priorities.
+	MaxPriority int `mapstructure:"max_priority"`
+	// Scheduled notifications wait on the broker until due. By default
+	// DelayExchange is a fanout exchange feeding DelayQueue, whose
+	// per-message TTL dead-letters them back to Exchange; with
+	// DelayedExchange set it is an x-delayed-message exchange instead,
+	// which needs the rabbitmq_delayed_message_exchange plugin.
+	DelayExchange   string `mapstructure:"delay_exchange"`
+	DelayQueue      string `mapstructure:"delay_queue"`
+	DelayedExchange bool   `mapstructure:"delayed_exchange"`
+	// QueueType is "classic" or "quorum". Quorum queues take no
+	// x-max-priority, so they need MaxPriority 0, and give a message up
+	// after DeliveryLimit deliveries (x-delivery-limit; 0 uses 20).
+	QueueType     string `mapstructure:"queue_type"`
+	DeliveryLimit int    `mapstructure:"delivery_limit"`
+	// ExchangeType is "direct" or "topic". A direct Exchange routes each
+	// message to the queue it is published under the name of. A topic one
+	// takes messages under notification.<type>.<priority>.<category> and
+	// binds the work queues with their patterns below as well as their
+	// names; a queue without patterns gets notification.<type>.#.
+	ExchangeType     string   `mapstructure:"exchange_type"`
+	EmailBindings    []string `mapstructure:"email_bindings"`
+	PushBindings     []string `mapstructure:"push_bindings"`
+	WhatsAppBindings []string `mapstructure:"whatsapp_bindings"`
+	// Mandatory publishes with the mandatory flag, so the broker returns a
+	// message no queue is bound for instead of dropping it. Returned
+	// messages are logged, counted and parked on FailedQueue. Leave it off
+	// where an alternate exchange catches them.
+	Mandatory bool `mapstructure:"mandatory"`
+	// StrictSchema rejects messages without a schema version instead of
+	// upgrading them with defaults. Turn it on once the queues hold no
+	// messages from the old gateway.
+	StrictSchema bool `mapstructure:"strict_schema"`
+	// PrefetchCount is the QoS prefetch each consumer subscribes with,
+	// independent of how many deliveries it works on at once; 0 uses the
+	// worker count. PrefetchGlobal applies the limit to the consumer's
+	// channel rather than to the consumer. Both are applied again whenever
+	// a consumer resubscribes after a reconnect.
+	PrefetchCount  int  `mapstructure:"prefetch_count"`
+	PrefetchGlobal bool `mapstructure:"prefetch_global"`
+}
+
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// ConnectAttempts is how many times the gateway pings Redis at boot
+	// before giving up, waiting ConnectBackoff after the first failure and
+	// doubling up to ConnectMaxBackoff.
+	ConnectAttempts   int           `mapstructure:"connect_attempts"`
+	ConnectBackoff    time.Duration `mapstructure:"connect_backoff"`
+	ConnectMaxBackoff time.Duration `mapstructure:"connect_max_backoff"`
+	// StartDegraded keeps the gateway up when Redis can't be reached at
+	// boot, its health check unhealthy until Redis comes back. Off, the
+	// gateway exits.
+	StartDegraded bool `mapstructure:"start_degraded"`
+	// TLS is for the managed Redis providers that require it. A rediss://
+	// addr turns it on too.
+	TLS RedisTLSConfig `mapstructure:"tls"`
+	// KeyPrefix is put in front of every key and channel the gateway uses,
+	// so deployments sharing a Redis keep apart. Empty keeps the keys
+	// written before it.
+	KeyPrefix string `mapstructure:"key_prefix"`
+	// Metrics records every command's latency and errors, by command and
+	// operation, on the metrics endpoint. It needs metrics.enabled.
+	Metrics bool `mapstructure:"metrics"`
+}
+
+type RedisTLSConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// CACert is a PEM file of the CAs to trust instead of the system's.
+	CACert string `mapstructure:"ca_cert"`
+	// InsecureSkipVerify accepts any server certificate. Development only.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+type ServicesConfig struct {
+	UserServiceURL     string
+	TemplateServiceURL string
+}
+
+type AuthConfig struct {
+	// JWTSecret is the HMAC key bearer tokens must be signed with;
+	// deployments set AUTH_JWT_SECRET instead of committing it.
+	JWTSecret string `mapstructure:"jwt_secret"`
+}
+
+// SafetyConfig holds the deployment-wide send ceilings. A zero value disables
+// the corresponding ceiling.
+type SafetyConfig struct {
+	DailyCeiling  int64 `mapstructure:"daily_ceiling"`
+	MinuteCeiling int64 `mapstructure:"minute_ceiling"`
+}
+
+// KafkaConfig is the producer used when Queue.Backend is "kafka".
+type KafkaConfig struct {
+	Brokers  []string `mapstructure:"brokers"`
+	ClientID string   `mapstructure:"client_id"`
+	// The topics the email, push and WhatsApp notifications are published
+	// to, in place of the RabbitMQ queues.
+	EmailTopic    string `mapstructure:"email_topic"`
+	PushTopic     string `mapstructure:"push_topic"`
+	WhatsAppTopic string `mapstructure:"whatsapp_topic"`
+	// PublishTimeout bounds waiting for a record's delivery report when the
+	// caller's context has no earlier deadline.
+	PublishTimeout time.Duration `mapstructure:"publish_timeout"`
+}
+
+// NATSConfig is the JetStream connection used when Queue.Backend is
+// "nats".
+type NATSConfig struct {
+	URL string `mapstructure:"url"`
+	// Name identifies the connection in the server's monitoring.
+	Name string `mapstructure:"name"`
+	// Stream is created, or updated, at startup to capture the three
+	// subjects the email, push and WhatsApp notifications are published to.
+	Stream          string `mapstructure:"stream"`
+	EmailSubject    string `mapstructure:"email_subject"`
+	PushSubject     string `mapstructure:"push_subject"`
+	WhatsAppSubject string `mapstructure:"whatsapp_subject"`
+	// PublishTimeout bounds waiting for the stream's ack when the caller's
+	// context has no earlier deadline.
+	PublishTimeout time.Duration `mapstructure:"publish_timeout"`
+	// MaxReconnects is how many times the client tries to get a lost
+	// connection back, ReconnectWait apart, before giving up; -1 never
+	// gives up.
+	MaxReconnects int           `mapstructure:"max_reconnects"`
+	ReconnectWait time.Duration `mapstructure:"reconnect_wait"`
+}
+
+// WebPushConfig holds the VAPID identity web push messages are signed
+// with. Web push is off while VAPIDPrivateKey is empty.
+type WebPushConfig struct {
+	// VAPIDPrivateKey is the raw P-256 private key, base64url encoded, as
+	// VAPID key generators print it. The public key is derived from it.
+	VAPIDPrivateKey string `mapstructure:"vapid_private_key"`
+	// Subject is the contact push services may use, a mailto: or https: URL.
+	Subject string `mapstructure:"subject"`
+	// TTL is how long a push service keeps a message for an offline browser.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+func LoadConfig() (*Config, error) {
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(".")
+	viper.AddConfigPath("./config")
+
+	// Set defaults
+	viper.SetDefault("server.port", "8080")
+	viper.SetDefault("mock_services", false)
+	viper.SetDefault("server.timeout", "10s")
+	viper.SetDefault("server.shutdown_timeout", "30s")
+	viper.SetDefault("rabbitmq.exchange", "notifications.direct")
+	viper.SetDefault("rabbitmq.email_queue", "email.queue")
+	viper.SetDefault("rabbitmq.push_queue", "push.queue")
+	viper.SetDefault("rabbitmq.whatsapp_queue", "whatsapp.queue")
+	viper.SetDefault("rabbitmq.failed_queue", "failed.queue")
+	viper.SetDefault("rabbitmq.quarantine_queue", "quarantine.queue")
+	viper.SetDefault("rabbitmq.retry_exchange", "notifications.retry")
+	viper.SetDefault("rabbitmq.retry_delays", []string{"30s", "2m", "10m", "1h"})
+	viper.SetDefault("rabbitmq.max_retry_attempts", 5)
+	viper.SetDefault("rabbitmq.publish_window", 500)
+	viper.SetDefault("rabbitmq.compression", false)
+	viper.SetDefault("rabbitmq.compression_threshold", 32768)
+	viper.SetDefault("rabbitmq.publisher_confirms", true)
+	viper.SetDefault("rabbitmq.mandatory", false)
+	viper.SetDefault("rabbitmq.strict_schema", false)
+	viper.SetDefault("rabbitmq.prefetch_count", 0)
+	viper.SetDefault("rabbitmq.prefetch_global", false)
+	viper.SetDefault("rabbitmq.reconnect_min_backoff", "500ms")
+	viper.SetDefault("rabbitmq.reconnect_max_backoff", "30s")
+	viper.SetDefault("rabbitmq.reconnect_publish_wait", "2s")
+	viper.SetDefault("rabbitmq.publish_retry_attempts", 3)
+	viper.SetDefault("rabbitmq.publish_retry_base_delay", "50ms")
+	viper.SetDefault("rabbitmq.publish_retry_jitter", "25ms")
+	viper.SetDefault("rabbitmq.max_priority", 10)
+	viper.SetDefault("rabbitmq.queue_type", "classic")
+	viper.SetDefault("rabbitmq.delivery_limit", 20)
+	viper.SetDefault("rabbitmq.exchange_type", "direct")
+	viper.SetDefault("rabbitmq.delay_exchange", "notifications.delay")
+	viper.SetDefault("rabbitmq.delay_queue", "delay.queue")
+	viper.SetDefault("rabbitmq.delayed_exchange", false)
+	viper.SetDefault("queue.backend", "rabbitmq")
+	viper.SetDefault("kafka.brokers", []string{"localhost:9092"})
+	viper.SetDefault("kafka.client_id", "api-gateway")
+	viper.SetDefault("kafka.email_topic", "notifications.email")
+	viper.SetDefault("kafka.push_topic", "notifications.push")
+	viper.SetDefault("kafka.whatsapp_topic", "notifications.whatsapp")
+	viper.SetDefault("kafka.publish_timeout", "5s")
+	viper.SetDefault("nats.url", "nats://localhost:4222")
+	viper.SetDefault("nats.name", "api-gateway")
+	viper.SetDefault("nats.stream", "NOTIFICATIONS")
+	viper.SetDefault("nats.email_subject", "notifications.email")
+	viper.SetDefault("nats.push_subject", "notifications.push")
+	viper.SetDefault("nats.whatsapp_subject", "notifications.whatsapp")
+	viper.SetDefault("nats.publish_timeout", "5s")
+	viper.SetDefault("nats.max_reconnects", -1)
+	viper.SetDefault("nats.reconnect_wait", "2s")
+	viper.SetDefault("workers.email", false)
+	viper.SetDefault("workers.push", false)
+	viper.SetDefault("workers.concurrency", 4)
+	viper.SetDefault("archive.enabled", false)
+	viper.SetDefault("archive.dsn", "")
+	viper.SetDefault("archive.buffer", 1000)
+	viper.SetDefault("archive.retry_interval", "30s")
+	viper.SetDefault("archive.retry_max_length", 100000)
+	viper.SetDefault("archive.retention", "2160h")
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.max_buckets", 20)
+	viper.SetDefault("metrics.native_histograms", false)
+	viper.SetDefault("metrics.native_bucket_factor", 1.1)
+	viper.SetDefault("metrics.native_max_buckets", 160)
+	viper.SetDefault("web_push.vapid_private_key", "")
+	viper.SetDefault("web_push.subject", "")
+	viper.SetDefault("web_push.ttl", "24h")
+	viper.SetDefault("environment", "development")
+	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("redis.connect_attempts", 5)
+	viper.SetDefault("redis.connect_backoff", "2s")
+	viper.SetDefault("redis.connect_max_backoff", "16s")
+	viper.SetDefault("redis.start_degraded", false)
+	viper.SetDefault("redis.key_prefix", "")
+	viper.SetDefault("redis.metrics", false)
+	viper.SetDefault("redis.tls.enabled", false)
+	viper.SetDefault("redis.tls.ca_cert", "")
+	viper.SetDefault("redis.tls.insecure_skip_verify", false)
+	viper.SetDefault("safety.daily_ceiling", 0)
+	viper.SetDefault("safety.minute_ceiling", 0)
+	viper.SetDefault("notifications.legacy_status_read_all_only", false)
+	viper.SetDefault("notifications.max_extra_recipients", 10)
+	viper.SetDefault("notifications.send_time_max_delay", "24h")
+	viper.SetDefault("notifications.topic_pattern", "^[a-z0-9][a-z0-9_.-]{0,63}$")
+	viper.SetDefault("notifications.status_cache_size", 0)
+	viper.SetDefault("notifications.status_cache_ttl", "2s")
+	viper.SetDefault("notifications.default_locale", "en")
+	viper.SetDefault("notifications.status_stream_max_duration", "5m")
+	viper.SetDefault("notifications.max_snoozes", 3)
+	viper.SetDefault("notifications.max_snooze_duration", "168h")
+	viper.SetDefault("notifications.preferences_cache_ttl", "1m")
+	viper.SetDefault("notifications.quiet_hours_start", "22:00")
+	viper.SetDefault("notifications.quiet_hours_end", "08:00")
+	viper.SetDefault("notifications.dedupe_window", "60s")
+	viper.SetDefault("notifications.duplicate_window", "10m")
+	viper.SetDefault("notifications.consumed_ttl", "24h")
+	viper.SetDefault("notifications.consumed_fail_open", true)
+	viper.SetDefault("notifications.status_ttl", "24h")
+	viper.SetDefault("notifications.idempotency_ttl", "24h")
+	viper.SetDefault("notifications.idempotency_fail_open", true)
+	viper.SetDefault("notifications.degraded.capacity", 10000)
+	viper.SetDefault("notifications.degraded.after", 3)
+	viper.SetDefault("notifications.degraded.probe_interval", "5s")
+	viper.SetDefault("notifications.degraded.policy", DegradedAccept)
+	viper.SetDefault("notifications.user_index_max_length", 1000)
+	viper.SetDefault("notifications.events_channel", "notification:events")
+	viper.SetDefault("notifications.outbox_max_length", 10000)
+	viper.SetDefault("notifications.outbox_flush_interval", "1s")
+	viper.SetDefault("notifications.approval_ttl", "24h")
+	viper.SetDefault("notifications.default_tenant", "default")
+	viper.SetDefault("notifications.template_syntax", "go")
+	viper.SetDefault("notifications.template_variable_check", "warn")
+	viper.SetDefault("notifications.disabled_channels", []string{})
+	viper.SetDefault("notifications.trusted_clients", []string{})
+	viper.SetDefault("notifications.internal_status_fields", []string{"queue", "last_error", "delivery"})
+	viper.SetDefault("notifications.policy_chain", []string{"preferences", "quiet_hours"})
+	viper.SetDefault("notifications.policy_webhook.url", "")
+	viper.SetDefault("notifications.policy_webhook.timeout", "300ms")
+	viper.SetDefault("notifications.policy_webhook.fail_open", false)
+	viper.SetDefault("notifications.budget.validation_share", 0.4)
+	viper.SetDefault("notifications.budget.publish_share", 0.4)
+	viper.SetDefault("notifications.budget.persistence_share", 0.2)
+	viper.SetDefault("notifications.budget.min_remaining", "50ms")
+	viper.SetDefault("notifications.budget.short_phase", "skip")
+	viper.SetDefault("notifications.user_summary_window", "24h")
+	viper.SetDefault("notifications.user_summary_cache_ttl", "10s")
+	viper.SetDefault("notifications.json_case.default", "snake")
+	viper.SetDefault("notifications.json_case.camel_clients", []string{})
+	viper.SetDefault("notifications.json_case.camel_tenants", []string{})
+	viper.SetDefault("notifications.template_manifest", "")
+	viper.SetDefault("notifications.template_manifest_gate", false)
+	viper.SetDefault("notifications.template_cache_size", 500)
+	viper.SetDefault("notifications.template_cache_ttl", "5m")
+
+	// Read from environment, REDIS_ADDR for redis.addr and so on
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	if err := viper.ReadInConfig(); err != nil {
+		// Config file not found, use environment variables
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	var config Config
+	if err := viper.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Validate rejects a config the gateway can't start with.
+func (c Config) Validate() error {
+	if c.Redis.Addr == "" {
+		return errors.New("redis.addr is required")
+	}
+	if c.Notifications.StatusTTL <= 0 {
+		return errors.New("notifications.status_ttl must be positive")
+	}
+	if c.Notifications.IdempotencyTTL <= 0 {
+		return errors.New("notifications.idempotency_ttl must be positive")
+	}
+	switch c.Notifications.Degraded.Policy {
+	case "", DegradedAccept, DegradedReject:
+	default:
+		return fmt.Errorf("notifications.degraded.policy must be %q or %q, not %q",
+			DegradedAccept, DegradedReject, c.Notifications.Degraded.Policy)
+	}
+	if c.Auth.JWTSecret == "" {
+		return errors.New("auth.jwt_secret is required")
+	}
+	if c.Archive.Enabled && c.Archive.DSN == "" {
+		return errors.New("archive.dsn is required when the archive is enabled")
+	}
+	return nil
+}
+
+// Public returns a copy of the config with secrets removed, safe to log or
+// fingerprint. Credentials embedded in URLs are dropped along with the
+// dedicated secret fields.
+func (c Config) Public() Config {
+	c.Redis.Password = ""
+	c.Redis.Addr = stripCredentials(c.Redis.Addr)
+	c.RabbitMQ.URL = stripCredentials(c.RabbitMQ.URL)
+	c.NATS.URL = stripCredentials(c.NATS.URL)
+	// a key=value DSN has its password in plain sight
+	c.Archive.DSN = ""
+	c.Auth.JWTSecret = ""
+	return c
+}
+
+// stripCredentials removes the userinfo from a URL. Values that don't parse
+// as URLs are returned unchanged.
+func stripCredentials(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
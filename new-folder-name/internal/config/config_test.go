@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Config{
+		Redis:         RedisConfig{Addr: "localhost:6379"},
+		Notifications: NotificationsConfig{StatusTTL: 24 * time.Hour, IdempotencyTTL: time.Hour},
+		Auth:          AuthConfig{JWTSecret: "jwt-secret"},
+	}
+	assert.NoError(t, valid.Validate())
+
+	noJWTSecret := valid
+	noJWTSecret.Auth.JWTSecret = ""
+	assert.ErrorContains(t, noJWTSecret.Validate(), "auth.jwt_secret is required")
+
+	noRedis := valid
+	noRedis.Redis.Addr = ""
+	assert.ErrorContains(t, noRedis.Validate(), "redis.addr is required")
+
+	noStatusTTL := valid
+	noStatusTTL.Notifications.StatusTTL = 0
+	assert.ErrorContains(t, noStatusTTL.Validate(), "notifications.status_ttl must be positive")
+
+	negativeIdempotencyTTL := valid
+	negativeIdempotencyTTL.Notifications.IdempotencyTTL = -time.Minute
+	assert.ErrorContains(t, negativeIdempotencyTTL.Validate(), "notifications.idempotency_ttl must be positive")
+
+	unknownPolicy := valid
+	unknownPolicy.Notifications.Degraded.Policy = "queue"
+	assert.ErrorContains(t, unknownPolicy.Validate(), `notifications.degraded.policy must be "accept" or "reject"`)
+}
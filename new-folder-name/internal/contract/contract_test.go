@@ -0,0 +1,188 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	baseURL    = flag.String("base-url", "", "verify against a live deployment serving /users and /templates")
+	userID     = flag.String("user-id", "", "existing user ID to use with -base-url")
+	templateID = flag.String("template-id", "", "existing template ID to use with -base-url")
+)
+
+// fixtureServer serves a golden response for every request under prefix.
+func fixtureServer(t *testing.T, prefix, fixture string) string {
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func liveOrSkip(t *testing.T, id *string, name string) {
+	if *id == "" {
+		t.Skipf("-%s is required with -base-url", name)
+	}
+}
+
+func TestContract_UserGet(t *testing.T) {
+	if *baseURL != "" {
+		liveOrSkip(t, userID, "user-id")
+		_, err := services.NewUserServiceClient(*baseURL, false).GetPreferredLocale(context.Background(), *userID)
+		assert.NoError(t, err)
+		return
+	}
+
+	for _, fixture := range []string{"user_get.json", "user_get_flat.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			client := services.NewUserServiceClient(fixtureServer(t, "/users/", fixture), false)
+			locale, err := client.GetPreferredLocale(context.Background(), "user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, "fr-CA", locale)
+
+			user, err := client.GetUser(context.Background(), "user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, &models.User{
+				ID:         "user-1",
+				Email:      "ada@example.com",
+				Phone:      "+15550100001",
+				PushTokens: []string{"token-1"},
+				Locale:     "fr-CA",
+				Timezone:   "America/Toronto",
+				Active:     true,
+			}, user, "a user without \"active\" is active")
+		})
+	}
+}
+
+// TestContract_UserStatus checks that an unknown user is told apart from a
+// user service failing, and doesn't count against its circuit breaker.
+func TestContract_UserStatus(t *testing.T) {
+	if *baseURL != "" {
+		t.Skip("fixture-only test")
+	}
+
+	serve := func(code int) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	client := services.NewUserServiceClient(serve(http.StatusNotFound), false)
+	for i := 0; i < 10; i++ {
+		_, err := client.GetUser(context.Background(), "user-1")
+		assert.ErrorIs(t, err, services.ErrUserNotFound)
+	}
+	assert.Equal(t, gobreaker.StateClosed, client.Breaker().State())
+	valid, err := client.ValidateUser(context.Background(), "user-1")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	client = services.NewUserServiceClient(serve(http.StatusBadGateway), false)
+	_, err = client.GetUser(context.Background(), "user-1")
+	assert.ErrorIs(t, err, services.ErrUserServiceUnavailable)
+	assert.NotErrorIs(t, err, services.ErrUserNotFound)
+	_, err = client.ValidateUser(context.Background(), "user-1")
+	assert.ErrorIs(t, err, services.ErrUserServiceUnavailable)
+
+	// mock mode needs no server and always finds the same user
+	client = services.NewUserServiceClient("", true)
+	user, err := client.GetUser(context.Background(), "user-1")
+	assert.NoError(t, err)
+	again, _ := client.GetUser(context.Background(), "user-1")
+	assert.Equal(t, user, again)
+	assert.True(t, user.Active)
+	assert.Equal(t, "user-1@example.com", user.Email)
+}
+
+func TestContract_TemplateGet(t *testing.T) {
+	if *baseURL != "" {
+		liveOrSkip(t, templateID, "template-id")
+		valid, err := services.NewTemplateClient(*baseURL, false).ValidateTemplate(context.Background(), *templateID)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		return
+	}
+
+	client := services.NewTemplateClient(fixtureServer(t, "/templates/", "template_get.json"), false)
+	valid, err := client.ValidateTemplate(context.Background(), "welcome_email")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	source, syntax, err := client.TemplateSource(context.Background(), "welcome_email")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi {{.name}}", source)
+	assert.Equal(t, "go", syntax)
+
+	metadata, err := client.TemplateMetadata(context.Background(), "welcome_email")
+	assert.NoError(t, err)
+	assert.Equal(t, models.TemplateMetadata{ID: "welcome_email", Type: "email"}, metadata)
+}
+
+// TestContract_Violations checks that a broken upstream response is reported
+// against the exact field at fault.
+func TestContract_Violations(t *testing.T) {
+	if *baseURL != "" {
+		t.Skip("fixture-only test")
+	}
+
+	serve := func(body string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		field   string
+		message string
+	}{
+		{"missing id", `{"data":{"locale":"fr"}}`, "id", `user-service GET /users/{id} contract violation: field "id" is required but missing`},
+		{"wrong type", `{"data":{"id":"user-1","locale":7}}`, "data.locale", `user-service GET /users/{id} contract violation: field "data.locale" is a JSON number, want string`},
+		{"not an object", `["user-1"]`, "", `user-service GET /users/{id} contract violation: body is not a JSON object`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := services.NewUserServiceClient(serve(tt.body), false).GetPreferredLocale(context.Background(), "user-1")
+			var contractErr *services.ContractError
+			if assert.True(t, errors.As(err, &contractErr), "got %v", err) {
+				assert.Equal(t, tt.field, contractErr.Field)
+				assert.Equal(t, tt.message, contractErr.Error())
+			}
+		})
+	}
+
+	_, err := services.NewTemplateClient(serve(`{"name":"Welcome"}`), false).ValidateTemplate(context.Background(), "welcome_email")
+	var contractErr *services.ContractError
+	if assert.True(t, errors.As(err, &contractErr), "got %v", err) {
+		assert.Equal(t, "template-service", contractErr.Service)
+		assert.Equal(t, "id", contractErr.Field)
+	}
+}
@@ -0,0 +1,9 @@
+// Package contract holds the contract tests for the user and template
+// service HTTP APIs.
+//
+// By default the tests replay recorded golden responses from testdata
+// through the real clients. Pointed at a live deployment they verify the
+// upstream instead:
+//
+//	go test ./contract -run Contract -args -base-url=https://staging.example.com -user-id=... -template-id=...
+package contract
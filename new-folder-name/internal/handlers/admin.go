@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+)
+
+// queueInspectTimeout keeps a sick broker from hanging the queues endpoint.
+const queueInspectTimeout = 3 * time.Second
+
+// maxFailedSample bounds how many failed messages the queues endpoint peeks.
+const maxFailedSample = 50
+
+type AdminHandler struct {
+	emergency EmergencyStop
+	queues    QueueInspector
+	clock     clock.Clock
+}
+
+// EmergencyStop defines the subset of methods used from the send ceiling.
+type EmergencyStop interface {
+	Clear(ctx context.Context) (bool, error)
+}
+
+// QueueInspector defines the subset of methods used from the RabbitMq client
+// to report queue depths.
+type QueueInspector interface {
+	QueueDepths(ctx context.Context) []queue.QueueDepth
+}
+
+// FailedInspector is implemented by queue clients that can peek at the
+// failed queue. It is optional; without it the queues endpoint refuses
+// failed_sample.
+type FailedInspector interface {
+	InspectFailed(ctx context.Context, limit int) ([]queue.FailedMessage, error)
+}
+
+func NewAdminHandler(emergency EmergencyStop, queues QueueInspector) *AdminHandler {
+	return &AdminHandler{
+		emergency: emergency,
+		queues:    queues,
+		clock:     clock.System,
+	}
+}
+
+func (a *AdminHandler) ClearEmergencyStop(c *gin.Context) {
+	ctx := c.Request.Context()
+	cleared, err := a.emergency.Clear(ctx)
+	if err != nil {
+		log.Printf("failed to clear emergency stop: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to clear emergency stop",
+			Message: "Internal server error",
+		})
+		return
+	}
+	message := "Emergency stop cleared, sending resumed"
+	if !cleared {
+		message = "Emergency stop was not engaged"
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data: gin.H{
+			"cleared": cleared,
+		},
+	})
+}
+
+// GetQueueDepths reports the depth of every queue. With ?failed_sample=N it
+// also peeks at the first N messages on the failed queue.
+func (a *AdminHandler) GetQueueDepths(c *gin.Context) {
+	sample := 0
+	if raw := c.Query("failed_sample"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxFailedSample {
+			middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Code:    models.CodeValidationError,
+				Error:   fmt.Sprintf("failed_sample must be between 1 and %d", maxFailedSample),
+				Message: "Validation failed",
+			})
+			return
+		}
+		sample = parsed
+	}
+	inspector, canInspect := a.queues.(FailedInspector)
+	if sample > 0 && !canInspect {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   "the queue client cannot inspect the failed queue",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), queueInspectTimeout)
+	defer cancel()
+
+	data := gin.H{
+		"queues":    a.queues.QueueDepths(ctx),
+		"timestamp": a.clock.Now(),
+	}
+	if sample > 0 {
+		messages, err := inspector.InspectFailed(ctx, sample)
+		if err != nil {
+			log.Printf("failed to inspect failed queue: %v", err)
+			data["failed_messages_error"] = err.Error()
+		} else {
+			data["failed_messages"] = messages
+		}
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Queue depths retrieved successfully",
+		Data:    data,
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueueInspector struct {
+	deadline time.Time
+	depths   []queue.QueueDepth
+}
+
+func (f *fakeQueueInspector) QueueDepths(ctx context.Context) []queue.QueueDepth {
+	f.deadline, _ = ctx.Deadline()
+	return f.depths
+}
+
+func TestGetQueueDepths_ReportsMissingQueues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	inspector := &fakeQueueInspector{depths: []queue.QueueDepth{
+		{Name: "email.queue", Messages: 42, Consumers: 3},
+		{Name: "push.queue", Missing: true},
+		{Name: "failed.queue", Error: "timed out"},
+	}}
+	router := gin.New()
+	router.GET("/api/v1/admin/queues", NewAdminHandler(nil, inspector).GetQueueDepths)
+
+	req, _ := http.NewRequest("GET", "/api/v1/admin/queues", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The inspection is bounded so a sick broker can't hang the request
+	assert.WithinDuration(t, time.Now().Add(queueInspectTimeout), inspector.deadline, time.Second)
+
+	var response struct {
+		models.APIResponse
+		Data struct {
+			Queues    []queue.QueueDepth `json:"queues"`
+			Timestamp time.Time          `json:"timestamp"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.True(t, response.Success)
+	assert.Equal(t, inspector.depths, response.Data.Queues)
+	assert.False(t, response.Data.Timestamp.IsZero())
+}
+
+// fakeFailedInspector is a fakeQueueInspector that can also peek at the
+// failed queue.
+type fakeFailedInspector struct {
+	fakeQueueInspector
+	failed []queue.FailedMessage
+	limit  int
+}
+
+func (f *fakeFailedInspector) InspectFailed(ctx context.Context, limit int) ([]queue.FailedMessage, error) {
+	f.limit = limit
+	return f.failed, nil
+}
+
+func TestGetQueueDepths_FailedSample(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	inspector := &fakeFailedInspector{failed: []queue.FailedMessage{
+		{MessageID: "n-1", Queue: "email.queue", Reason: "rejected", Count: 1, Body: `{"id":"n-1"}`},
+	}}
+	get := func(handler *AdminHandler, query string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/api/v1/admin/queues", handler.GetQueueDepths)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/queues"+query, nil))
+		return w
+	}
+
+	w := get(NewAdminHandler(nil, inspector), "?failed_sample=5")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 5, inspector.limit)
+	var response struct {
+		Data struct {
+			FailedMessages []queue.FailedMessage `json:"failed_messages"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, inspector.failed, response.Data.FailedMessages)
+
+	// without the parameter nothing is peeked
+	inspector.limit = 0
+	assert.NotContains(t, get(NewAdminHandler(nil, inspector), "").Body.String(), "failed_messages")
+	assert.Zero(t, inspector.limit)
+
+	assert.Equal(t, http.StatusBadRequest, get(NewAdminHandler(nil, inspector), "?failed_sample=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get(NewAdminHandler(nil, inspector), "?failed_sample=51").Code)
+	assert.Equal(t, http.StatusBadRequest, get(NewAdminHandler(nil, &fakeQueueInspector{}), "?failed_sample=5").Code)
+}
+
+type fakeUsageReporter struct {
+	from, to time.Time
+}
+
+func (f *fakeUsageReporter) Report(ctx context.Context, client string, from, to time.Time, granularity string) (usage.Report, error) {
+	f.from, f.to = from, to
+	if granularity != "day" {
+		return usage.Report{}, usage.ErrUnknownGranularity
+	}
+	return usage.Report{Client: client, Granularity: granularity}, nil
+}
+
+func TestGetUsage_QueryParsing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	reporter := &fakeUsageReporter{}
+	handler := NewUsageHandler(reporter)
+	handler.SetClock(clock.NewFake(time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC)))
+	router := gin.New()
+	router.GET("/api/v1/admin/usage", handler.GetUsage)
+
+	get := func(query string) int {
+		req, _ := http.NewRequest("GET", "/api/v1/admin/usage?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("client=billing&from=2024-03-01&to=2024-03-15"))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), reporter.from)
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), reporter.to)
+
+	// Without a range the last 30 days are reported
+	assert.Equal(t, http.StatusOK, get("client=billing"))
+	assert.Equal(t, 29*24*time.Hour, reporter.to.Sub(reporter.from))
+
+	assert.Equal(t, http.StatusBadRequest, get("from=2024-03-01"))
+	assert.Equal(t, http.StatusBadRequest, get("client=billing&from=March"))
+	assert.Equal(t, http.StatusBadRequest, get("client=billing&granularity=week"))
+}
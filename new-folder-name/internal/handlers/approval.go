@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultApprovalTTL = 24 * time.Hour
+	// pendingApprovalsKey indexes held sends by expiry time.
+	pendingApprovalsKey = "notification:approvals:pending"
+)
+
+// ApprovalPolicy is implemented by template service clients that can report
+// whether a template's sends need a second person's approval. It is
+// optional; without it nothing is held.
+type ApprovalPolicy interface {
+	RequiresApproval(ctx context.Context, templateID string) (bool, error)
+}
+
+func approvalKey(notificationID string) string {
+	return fmt.Sprintf("notification:approval:%s", notificationID)
+}
+
+func (n *NotificationHandler) requiresApproval(ctx context.Context, templateID string) (bool, error) {
+	policy, ok := n.templateService.(ApprovalPolicy)
+	if !ok {
+		return false, nil
+	}
+	return policy.RequiresApproval(ctx, templateID)
+}
+
+// holdForApproval stores the message instead of publishing it and records
+// the notification as pending_approval.
+func (n *NotificationHandler) holdForApproval(ctx context.Context, message models.NotificationMessage, record models.NotificationStatus) error {
+	now := n.clock.Now()
+	pending := models.PendingApproval{
+		Message:   message,
+		CreatedBy: record.CreatedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(n.cfg.ApprovalTTL),
+	}
+	pendingJSON, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	_, err = n.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, n.tenantKey(ctx, approvalKey(message.ID)), pendingJSON, n.cfg.ApprovalTTL)
+		pipe.ZAdd(ctx, n.tenantKey(ctx, pendingApprovalsKey), redis.Z{Score: float64(pending.ExpiresAt.Unix()), Member: message.ID})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	record.Status = "pending_approval"
+	record.ScheduledFor = message.ScheduledFor
+	if err := n.storeNotificationStatus(ctx, record); err != nil {
+		log.Printf("failed to log pending approval status: %v", err)
+	}
+	n.audit(ctx, message.ID, models.HistoryEntry{Action: "held_for_approval", Status: "pending_approval", Actor: record.CreatedBy})
+	return nil
+}
+
+// ListApprovals returns the sends waiting for approval, expiring any that
+// have run out of time.
+func (n *NotificationHandler) ListApprovals(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	ids, err := n.redis.ZRange(ctx, n.tenantKey(ctx, pendingApprovalsKey), 0, -1).Result()
+	if err != nil {
+		log.Printf("failed to list pending approvals: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to list approvals",
+			Message: "Internal server error",
+		})
+		return
+	}
+	approvals := []models.PendingApproval{}
+	if len(ids) > 0 {
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = n.tenantKey(ctx, approvalKey(id))
+		}
+		values, err := n.redis.MGet(ctx, keys...).Result()
+		if err != nil {
+			log.Printf("failed to read pending approvals: %v", err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "Failed to list approvals",
+				Message: "Internal server error",
+			})
+			return
+		}
+		now := n.clock.Now()
+		for i, value := range values {
+			raw, ok := value.(string)
+			var pending models.PendingApproval
+			if !ok || json.Unmarshal([]byte(raw), &pending) != nil || !pending.ExpiresAt.After(now) {
+				n.expireApproval(ctx, ids[i])
+				continue
+			}
+			approvals = append(approvals, pending)
+		}
+	}
+
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Pending approvals retrieved successfully",
+		Data: gin.H{
+			"approvals": approvals,
+			"count":     len(approvals),
+		},
+	})
+}
+
+// ApproveNotification publishes a held send exactly as it was captured.
+func (n *NotificationHandler) ApproveNotification(c *gin.Context) {
+	n.decideApproval(c, true)
+}
+
+// RejectNotification cancels a held send.
+func (n *NotificationHandler) RejectNotification(c *gin.Context) {
+	n.decideApproval(c, false)
+}
+
+// decideApproval applies an approver's decision. The approver must be
+// someone other than the caller who made the send. Removing the entry from
+// the pending index claims the decision, so two approvers can't both act.
+func (n *NotificationHandler) decideApproval(c *gin.Context, approve bool) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+	approver := middleware.CallerID(c)
+
+	// the reason is optional, so an empty body is fine
+	var req models.ApprovalDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Code:    models.CodeValidationError,
+				Error:   err.Error(),
+				Message: "Invalid Request Body",
+			})
+			return
+		}
+	}
+
+	pendingJSON, err := n.redis.Get(ctx, n.tenantKey(ctx, approvalKey(notificationID))).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("failed to read pending approval %s: %v", notificationID, err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to read approval",
+			Message: "Internal server error",
+		})
+		return
+	}
+	var pending models.PendingApproval
+	if err == nil {
+		err = json.Unmarshal([]byte(pendingJSON), &pending)
+	}
+	if err != nil || !pending.ExpiresAt.After(n.clock.Now()) {
+		// still indexed but gone or out of time means it expired
+		if n.redis.ZScore(ctx, n.tenantKey(ctx, pendingApprovalsKey), notificationID).Err() == nil {
+			n.expireApproval(ctx, notificationID)
+			middleware.WriteError(c, http.StatusGone, models.APIResponse{
+				Success: false,
+				Code:    models.CodeApprovalExpired,
+				Error:   "Approval expired",
+				Message: "Gone",
+			})
+			return
+		}
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeApprovalNotFound,
+			Error:   "Pending approval not found",
+			Message: "Not found",
+		})
+		return
+	}
+	if approver == "" || approver == pending.CreatedBy {
+		middleware.WriteError(c, http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Code:    models.CodeSelfApprovalRejected,
+			Error:   "approver must be different from the creator",
+			Message: "Forbidden",
+		})
+		return
+	}
+
+	removed, err := n.redis.ZRem(ctx, n.tenantKey(ctx, pendingApprovalsKey), notificationID).Result()
+	if err != nil || removed == 0 {
+		if err != nil {
+			log.Printf("failed to claim approval %s: %v", notificationID, err)
+		}
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeApprovalDecided,
+			Error:   "approval already decided",
+			Message: "Conflict",
+		})
+		return
+	}
+	n.redis.Del(ctx, n.tenantKey(ctx, approvalKey(notificationID)))
+
+	action, status, responseMessage := "rejected", "cancelled", "Notification rejected"
+	if approve {
+		action, status, responseMessage = "approved", "queued", "Notification approved and queued"
+		publish, queueName := n.publisherFor(pending.Message.Type)
+		if err := n.publishMessage(ctx, publish, queueName, pending.Message); err != nil {
+			log.Printf("failed to publish approved notification %s: %v", notificationID, err)
+			// put it back so the approval can be retried
+			n.restoreApproval(ctx, pending, pendingJSON)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeQueueUnavailable,
+				Error:   "failed to queue notification",
+				Message: "Internal Server Error",
+			})
+			return
+		}
+	}
+	if err := n.transitionStatus(ctx, notificationID, status); err != nil {
+		log.Printf("failed to update status of %s: %v", notificationID, err)
+	}
+	n.audit(ctx, notificationID, models.HistoryEntry{Action: action, Status: status, Actor: approver, Reason: req.Reason})
+
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: responseMessage,
+		Data: models.NotificationResponse{
+			NotificationID: notificationID,
+			Status:         status,
+			QueuedAt:       n.clock.Now(),
+			ScheduledFor:   pending.Message.ScheduledFor,
+		},
+	})
+}
+
+func (n *NotificationHandler) restoreApproval(ctx context.Context, pending models.PendingApproval, pendingJSON string) {
+	ttl := pending.ExpiresAt.Sub(n.clock.Now())
+	if ttl <= 0 {
+		return
+	}
+	_, err := n.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, n.tenantKey(ctx, approvalKey(pending.Message.ID)), pendingJSON, ttl)
+		pipe.ZAdd(ctx, n.tenantKey(ctx, pendingApprovalsKey), redis.Z{Score: float64(pending.ExpiresAt.Unix()), Member: pending.Message.ID})
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to restore approval %s: %v", pending.Message.ID, err)
+	}
+}
+
+// expireApproval drops a held send that ran out of time. Whoever removes it
+// from the pending index records the expiry.
+func (n *NotificationHandler) expireApproval(ctx context.Context, notificationID string) {
+	removed, err := n.redis.ZRem(ctx, n.tenantKey(ctx, pendingApprovalsKey), notificationID).Result()
+	if err != nil || removed == 0 {
+		return
+	}
+	n.redis.Del(ctx, n.tenantKey(ctx, approvalKey(notificationID)))
+	if err := n.transitionStatus(ctx, notificationID, "expired"); err != nil {
+		log.Printf("failed to expire status of %s: %v", notificationID, err)
+	}
+	n.audit(ctx, notificationID, models.HistoryEntry{Action: "expired", Status: "expired", Actor: "system"})
+}
+
+// transitionStatus sets the status of an existing record, keeping its TTL.
+func (n *NotificationHandler) transitionStatus(ctx context.Context, notificationID, status string) error {
+	return n.transitionStatusFrom(ctx, notificationID, "", status)
+}
+
+// transitionStatusFrom is transitionStatus for a record whose status is
+// still from; a record that has moved on is left alone. An empty from
+// matches any status.
+func (n *NotificationHandler) transitionStatusFrom(ctx context.Context, notificationID, from, status string) error {
+	var record models.NotificationStatus
+	var oldStatus string
+	err := n.updateStatus(ctx, notificationID, func(r *models.NotificationStatus) (bool, error) {
+		oldStatus = r.Status
+		if from != "" && r.Status != from {
+			record = *r
+			return false, nil
+		}
+		r.Status = status
+		r.UpdatedAt = n.clock.Now()
+		record = *r
+		return true, nil
+	}, func(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, _ []byte) {
+		n.dropUserSummary(ctx, pipe, record.UserID)
+	})
+	if err != nil {
+		return err
+	}
+	n.publishStatusEvent(ctx, record, oldStatus)
+	if record.Status != oldStatus {
+		n.archiveStatus(ctx, record)
+	}
+	return nil
+}
+
+// audit appends an entry to the notification's history and the log.
+func (n *NotificationHandler) audit(ctx context.Context, notificationID string, entry models.HistoryEntry) {
+	log.Printf("AUDIT notification %s %s by %q %s (request %s)", notificationID, entry.Action, entry.Actor, entry.Reason, middleware.RequestIDFromContext(ctx))
+	if err := n.recordHistory(ctx, notificationID, entry); err != nil {
+		log.Printf("failed to record history for %s: %v", notificationID, err)
+	}
+}
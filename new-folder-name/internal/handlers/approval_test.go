@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// approvalTemplateService also reports which templates need approval.
+type approvalTemplateService struct {
+	MockTemplateService
+}
+
+func (m *approvalTemplateService) RequiresApproval(ctx context.Context, templateID string) (bool, error) {
+	args := m.Called(ctx, templateID)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestIntegration_ApprovalWorkflow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	creator := signedToken(jwt.MapClaims{"sub": "accounts-service", "scope": "notifications:admin"})
+	approver := signedToken(jwt.MapClaims{"sub": "legal-reviewer", "scope": "notifications:admin"})
+
+	setup := func(t *testing.T) (*gin.Engine, *MockRabbitMQClient, *miniredis.Miniredis, *redis.Client) {
+		s := miniredis.RunT(t)
+		rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+		mockQueue := new(MockRabbitMQClient)
+		mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+		userService := new(MockUserService)
+		userService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+		templateService := new(approvalTemplateService)
+		templateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+		templateService.On("RequiresApproval", mock.Anything, "account-termination").Return(true, nil)
+		templateService.On("RequiresApproval", mock.Anything, mock.Anything).Return(false, nil)
+
+		handler := NewNotificationService(mockQueue, rdb, userService, templateService,
+			config.NotificationsConfig{ApprovalTTL: time.Hour})
+
+		router := gin.New()
+		api := router.Group("/api/v1")
+		api.Use(middleware.AuthMiddleware(testAuth.JWTSecret))
+		api.POST("/notification/email", handler.SendEmail)
+		api.GET("/notification/status/:id", handler.GetStatus)
+		admin := router.Group("/api/v1/admin")
+		admin.Use(middleware.AdminMiddleware(testAuth.JWTSecret))
+		admin.GET("/approvals", handler.ListApprovals)
+		admin.POST("/approvals/:id/approve", handler.ApproveNotification)
+		admin.POST("/approvals/:id/reject", handler.RejectNotification)
+		return router, mockQueue, s, rdb
+	}
+
+	do := func(router *gin.Engine, method, path, token string, body interface{}) (int, models.APIResponse) {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	hold := func(t *testing.T, router *gin.Engine) string {
+		code, resp := do(router, "POST", "/api/v1/notification/email", creator, models.SendEmailRequest{
+			UserID:     "user123",
+			TemplateID: "account-termination",
+		})
+		require.Equal(t, http.StatusAccepted, code)
+		data := resp.Data.(map[string]interface{})
+		assert.Equal(t, "pending_approval", data["status"])
+		return data["notification_id"].(string)
+	}
+
+	statusOf := func(t *testing.T, rdb *redis.Client, id string) string {
+		raw, err := rdb.Get(context.Background(), "notification:status:"+id).Result()
+		require.NoError(t, err)
+		var status models.NotificationStatus
+		require.NoError(t, json.Unmarshal([]byte(raw), &status))
+		return status.Status
+	}
+
+	t.Run("held sends are listed, not published", func(t *testing.T) {
+		router, mockQueue, _, _ := setup(t)
+		id := hold(t, router)
+		mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+
+		code, resp := do(router, "GET", "/api/v1/admin/approvals", approver, nil)
+		assert.Equal(t, http.StatusOK, code)
+		data := resp.Data.(map[string]interface{})
+		assert.Equal(t, float64(1), data["count"])
+		first := data["approvals"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, id, first["message"].(map[string]interface{})["id"])
+		assert.Equal(t, "accounts-service", first["created_by"])
+	})
+
+	t.Run("other templates are published straight away", func(t *testing.T) {
+		router, mockQueue, _, _ := setup(t)
+		code, _ := do(router, "POST", "/api/v1/notification/email", creator, models.SendEmailRequest{
+			UserID:     "user123",
+			TemplateID: "welcome",
+		})
+		assert.Equal(t, http.StatusOK, code)
+		mockQueue.AssertNumberOfCalls(t, "PublishEmail", 1)
+	})
+
+	t.Run("the creator cannot approve", func(t *testing.T) {
+		router, mockQueue, _, rdb := setup(t)
+		id := hold(t, router)
+
+		code, resp := do(router, "POST", "/api/v1/admin/approvals/"+id+"/approve", creator, nil)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, models.CodeSelfApprovalRejected, resp.Code)
+		mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+		assert.Equal(t, "pending_approval", statusOf(t, rdb, id))
+	})
+
+	t.Run("approval publishes the captured message", func(t *testing.T) {
+		router, mockQueue, _, rdb := setup(t)
+		id := hold(t, router)
+
+		code, resp := do(router, "POST", "/api/v1/admin/approvals/"+id+"/approve", approver,
+			models.ApprovalDecisionRequest{Reason: "termination confirmed"})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "queued", resp.Data.(map[string]interface{})["status"])
+
+		mockQueue.AssertNumberOfCalls(t, "PublishEmail", 1)
+		published := mockQueue.Calls[0].Arguments.Get(1).(models.NotificationMessage)
+		assert.Equal(t, id, published.ID)
+		assert.Equal(t, "user123", published.UserID)
+		assert.Equal(t, "account-termination", published.TemplateID)
+		assert.Equal(t, "queued", statusOf(t, rdb, id))
+
+		history, err := rdb.LRange(context.Background(), "notification:history:"+id, 0, -1).Result()
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+		var approved models.HistoryEntry
+		require.NoError(t, json.Unmarshal([]byte(history[2]), &approved))
+		assert.Equal(t, "approved", approved.Action)
+		assert.Equal(t, "queued", approved.Status)
+		assert.Equal(t, int64(3), approved.Seq)
+		assert.Equal(t, "legal-reviewer", approved.Actor)
+		assert.Equal(t, "termination confirmed", approved.Reason)
+
+		// a second decision finds nothing left to decide
+		code, resp = do(router, "POST", "/api/v1/admin/approvals/"+id+"/reject", approver, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, models.CodeApprovalNotFound, resp.Code)
+	})
+
+	t.Run("rejection cancels", func(t *testing.T) {
+		router, mockQueue, _, rdb := setup(t)
+		id := hold(t, router)
+
+		code, resp := do(router, "POST", "/api/v1/admin/approvals/"+id+"/reject", approver, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "cancelled", resp.Data.(map[string]interface{})["status"])
+		mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+		assert.Equal(t, "cancelled", statusOf(t, rdb, id))
+	})
+
+	t.Run("expired approvals cannot be approved", func(t *testing.T) {
+		router, mockQueue, s, rdb := setup(t)
+		id := hold(t, router)
+		s.FastForward(2 * time.Hour)
+
+		code, resp := do(router, "POST", "/api/v1/admin/approvals/"+id+"/approve", approver, nil)
+		assert.Equal(t, http.StatusGone, code)
+		assert.Equal(t, models.CodeApprovalExpired, resp.Code)
+		mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+		assert.Equal(t, "expired", statusOf(t, rdb, id))
+
+		code, resp = do(router, "GET", "/api/v1/admin/approvals", approver, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, float64(0), resp.Data.(map[string]interface{})["count"])
+	})
+}
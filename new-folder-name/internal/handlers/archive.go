@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/archive"
+	"github.com/franzego/stage04/internal/models"
+)
+
+// sourceArchive marks a status response read from the archive.
+const sourceArchive = "archive"
+
+// StatusArchive keeps status records past their Redis TTL. Archive must
+// return at once; the record is written in the background.
+type StatusArchive interface {
+	Archive(key string, record models.NotificationStatus)
+	// Get reads the record archived under key, archive.ErrNotFound when
+	// there is none.
+	Get(ctx context.Context, key string) (models.NotificationStatus, error)
+	// Retention is how long archived records are kept.
+	Retention() time.Duration
+}
+
+// SetArchive has every status record written, and every change of status,
+// archived as well, and GetStatus read a record from the archive once Redis
+// no longer has it.
+func (n *NotificationHandler) SetArchive(archive StatusArchive) {
+	n.archive = archive
+}
+
+// archiveStatus hands record to the archive, if there is one, under its
+// status key.
+func (n *NotificationHandler) archiveStatus(ctx context.Context, record models.NotificationStatus) {
+	if n.archive != nil {
+		n.archive.Archive(n.statusKey(ctx, record.ID), record)
+	}
+}
+
+// archivedStatus reads notificationID's record from the archive, reporting
+// false when there is no archive, it hasn't the record or it can't be read.
+func (n *NotificationHandler) archivedStatus(ctx context.Context, notificationID string) (string, bool) {
+	if n.archive == nil {
+		return "", false
+	}
+	record, err := n.archive.Get(ctx, n.statusKey(ctx, notificationID))
+	if err != nil {
+		if !errors.Is(err, archive.ErrNotFound) {
+			log.Printf("failed to read archived status of %s: %v", notificationID, err)
+		}
+		return "", false
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return "", false
+	}
+	return string(recordJSON), true
+}
@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/archive"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryArchive is a StatusArchive that archives at once.
+type memoryArchive struct {
+	mu      sync.Mutex
+	records map[string]models.NotificationStatus
+}
+
+func (m *memoryArchive) Archive(key string, record models.NotificationStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[key] = record
+}
+
+func (m *memoryArchive) Get(_ context.Context, key string) (models.NotificationStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[key]
+	if !ok {
+		return models.NotificationStatus{}, archive.ErrNotFound
+	}
+	return record, nil
+}
+
+func (m *memoryArchive) Retention() time.Duration { return 90 * 24 * time.Hour }
+
+func TestGetStatus_FallsBackToArchive(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	statusArchive := &memoryArchive{records: map[string]models.NotificationStatus{}}
+	h.Handler.SetArchive(statusArchive)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+	id := resp.NotificationID()
+	key := "notification:status:" + id
+	require.Contains(t, statusArchive.records, key)
+	require.NoError(t, h.Handler.SetDeliveryStatus(context.Background(), id, "delivered"))
+	assert.Equal(t, "delivered", statusArchive.records[key].Status, "changes of status are archived too")
+
+	status := h.GET("/api/v1/notification/status/" + id)
+	require.Equal(t, http.StatusOK, status.Code)
+	assert.Empty(t, status.API().Source, "Redis still has it")
+
+	// expired from Redis
+	h.Miniredis.Del(key)
+	status = h.GET("/api/v1/notification/status/" + id)
+	require.Equal(t, http.StatusOK, status.Code, string(status.Body))
+	assert.Equal(t, "archive", status.API().Source)
+	var record models.NotificationStatus
+	status.Decode(&record)
+	assert.Equal(t, id, record.ID)
+	assert.Equal(t, "delivered", record.Status)
+	head := h.Do(http.MethodHead, "/api/v1/notification/status/"+id, nil)
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, "delivered", head.Header.Get("X-Notification-Status"))
+
+	assert.Equal(t, http.StatusNotFound, h.GET("/api/v1/notification/status/unknown").Code)
+	assert.Equal(t, http.StatusNotFound, h.Do(http.MethodHead, "/api/v1/notification/status/unknown", nil).Code)
+
+	h.WithClaims(jwt.MapClaims{"sub": handlertest.DefaultCaller, "scope": middleware.ReadAllScope})
+	head = h.Do(http.MethodHead, "/api/v1/notification/status/"+id, nil)
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, "delivered", head.Header.Get("X-Notification-Status"))
+	assert.Equal(t, http.StatusNotFound, h.Do(http.MethodHead, "/api/v1/notification/status/unknown", nil).Code)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+)
+
+// QueueNamer is implemented by queue clients that can name the queues they
+// publish to. It is optional; without it the status record has no queue.
+type QueueNamer interface {
+	EmailQueueName() string
+	PushQueueName() string
+	WhatsAppQueueName() string
+}
+
+// DelayedPublisher is implemented by queue clients that can hold a message
+// on the broker until it is due. It is optional; without it a scheduled
+// notification is queued at once, to be held by its consumer.
+type DelayedPublisher interface {
+	PublishDelayed(ctx context.Context, routingKey string, message interface{}, delay time.Duration) error
+}
+
+func (n *NotificationHandler) emailQueue() string {
+	if namer, ok := n.rabbitClient.(QueueNamer); ok {
+		return namer.EmailQueueName()
+	}
+	return ""
+}
+
+func (n *NotificationHandler) pushQueue() string {
+	if namer, ok := n.rabbitClient.(QueueNamer); ok {
+		return namer.PushQueueName()
+	}
+	return ""
+}
+
+func (n *NotificationHandler) whatsAppQueue() string {
+	if namer, ok := n.rabbitClient.(QueueNamer); ok {
+		return namer.WhatsAppQueueName()
+	}
+	return ""
+}
+
+// publisherFor picks the publish method and queue for a notification type,
+// for paths that republish a stored notification.
+func (n *NotificationHandler) publisherFor(notificationType string) (func(context.Context, interface{}) error, string) {
+	switch notificationType {
+	case "push":
+		return n.rabbitClient.PublishPushNot, n.pushQueue()
+	case "whatsapp":
+		return n.rabbitClient.PublishWhatsApp, n.whatsAppQueue()
+	}
+	return n.rabbitClient.PublishEmail, n.emailQueue()
+}
+
+// publishMessage publishes message with publish or, when it is scheduled
+// for later and the queue client can delay it, to queueName through the
+// broker's delay.
+func (n *NotificationHandler) publishMessage(ctx context.Context, publish func(context.Context, interface{}) error, queueName string, message models.NotificationMessage) error {
+	if message.ScheduledFor != nil && queueName != "" {
+		if delayed, ok := n.rabbitClient.(DelayedPublisher); ok {
+			if delay := message.ScheduledFor.Sub(n.clock.Now()); delay > 0 {
+				return delayed.PublishDelayed(ctx, queueName, message, delay)
+			}
+		}
+	}
+	return publish(ctx, message)
+}
+
+// RecordAttempt is called by consumers each time they pick up a
+// notification. It bumps the attempt count and records the outcome; a nil
+// attemptErr clears the last error. The status is updated under WATCH so
+// concurrent consumers never lose an increment. ctx must carry the tenant
+// from the message's tenant_id header (see middleware.WithTenant).
+func (n *NotificationHandler) RecordAttempt(ctx context.Context, notificationID string, attemptErr error) error {
+	err := n.updateStatus(ctx, notificationID, func(status *models.NotificationStatus) (bool, error) {
+		now := n.clock.Now()
+		status.Attempts++
+		status.LastAttemptAt = &now
+		status.LastError = ""
+		if attemptErr != nil {
+			status.LastError = attemptErr.Error()
+		}
+		status.UpdatedAt = now
+		return true, nil
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to record attempt for %s: %w", notificationID, err)
+	}
+	return nil
+}
+
+// MarkUpgradedFromLegacy is called by consumers on a notification taken
+// from a message in the old gateway's shape, so its status shows it. ctx
+// must carry the tenant, as for RecordAttempt.
+func (n *NotificationHandler) MarkUpgradedFromLegacy(ctx context.Context, notificationID string) error {
+	err := n.updateStatus(ctx, notificationID, func(status *models.NotificationStatus) (bool, error) {
+		status.UpgradedFromLegacy = true
+		status.UpdatedAt = n.clock.Now()
+		return true, nil
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to mark %s as upgraded from legacy: %w", notificationID, err)
+	}
+	return nil
+}
+
+// SetDeliveryStatus is called by consumers as a notification moves through
+// delivery. It sets the status and adds it to the history. ctx must carry
+// the tenant, as for RecordAttempt.
+func (n *NotificationHandler) SetDeliveryStatus(ctx context.Context, notificationID, status string) error {
+	if err := n.transitionStatus(ctx, notificationID, status); err != nil {
+		return fmt.Errorf("failed to set status of %s: %w", notificationID, err)
+	}
+	entry := models.HistoryEntry{Action: "delivery", Status: status, Actor: "worker"}
+	if err := n.recordHistory(ctx, notificationID, entry); err != nil {
+		log.Printf("failed to record history for %s: %v", notificationID, err)
+	}
+	return nil
+}
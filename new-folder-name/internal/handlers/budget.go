@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/budget"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// sendContext is the context a send runs under: the request's values and
+// deadline but not its cancellation, so a client hanging up can't abandon
+// a half-made send, while nothing the send does outlives the request's
+// deadline.
+func sendContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	parent := c.Request.Context()
+	ctx := context.WithoutCancel(parent)
+	if deadline, ok := parent.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return ctx, func() {}
+}
+
+// newBudget splits the deadline of the send running under ctx between its
+// phases.
+func (n *NotificationHandler) newBudget(ctx context.Context) *budget.Budget {
+	return budget.New(ctx, n.cfg.Budget, n.clock)
+}
+
+// startPhase starts phase of b under ctx. When too little time is left for
+// it, it writes a 504 and returns false.
+func startPhase(c *gin.Context, ctx context.Context, b *budget.Budget, phase budget.Phase) (context.Context, context.CancelFunc, bool) {
+	phaseCtx, cancel, err := b.Start(ctx, phase)
+	if err != nil {
+		writeDeadlineExceeded(c, phase, err)
+		return nil, nil, false
+	}
+	return phaseCtx, cancel, true
+}
+
+func writeDeadlineExceeded(c *gin.Context, phase budget.Phase, err error) {
+	log.Printf("send failed fast: %v", err)
+	middleware.WriteError(c, http.StatusGatewayTimeout, models.APIResponse{
+		Success: false,
+		Code:    models.CodeDeadlineExceeded,
+		Error:   "Not enough time left to " + phaseAction(phase),
+		Message: "Deadline exceeded",
+	})
+}
+
+func phaseAction(phase budget.Phase) string {
+	switch phase {
+	case budget.Publish:
+		return "queue the notification"
+	case budget.Persistence:
+		return "record the notification's status"
+	}
+	return "validate the request"
+}
+
+// persistStatus stores record in the persistence phase of b. A phase
+// skipped for want of time leaves the notification queued without a status
+// record; a phase that fails writes a 504 and returns false.
+func (n *NotificationHandler) persistStatus(c *gin.Context, ctx context.Context, b *budget.Budget, record models.NotificationStatus) bool {
+	phaseCtx, cancel, err := b.Start(ctx, budget.Persistence)
+	if errors.Is(err, budget.ErrSkipped) {
+		log.Printf("notification %s queued without a status record: %v", record.ID, err)
+		return true
+	}
+	if err != nil {
+		writeDeadlineExceeded(c, budget.Persistence, err)
+		return false
+	}
+	defer cancel()
+	if err := n.storeNotificationStatus(phaseCtx, record); err != nil {
+		log.Printf("failed to log notification status: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendEmail_FailsFastWithoutTime(t *testing.T) {
+	h := handlertest.NewHarness().WithTimeout(20 * time.Millisecond).Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusGatewayTimeout, resp.Code)
+	assert.Equal(t, models.CodeDeadlineExceeded, resp.API().Code)
+	assert.Empty(t, h.Queue.Emails())
+}
+
+func TestSendEmail_ValidationGetsItsShareOfTheDeadline(t *testing.T) {
+	var checkDeadline time.Time
+	h := handlertest.NewHarness().
+		WithTimeout(2 * time.Second).
+		WithConfig(config.NotificationsConfig{PolicyChain: []string{"deadline"}}).
+		Start(t)
+	h.Handler.RegisterPolicyCheck("deadline", handlers.PolicyCheckFunc(func(ctx context.Context, req handlers.EnqueueRequest, user *handlers.UserSnapshot) (handlers.Decision, error) {
+		checkDeadline, _ = ctx.Deadline()
+		return handlers.Decision{Verdict: handlers.Allow}, nil
+	}))
+
+	sent := time.Now()
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.False(t, checkDeadline.IsZero(), "the policy chain ran under a deadline")
+	assert.WithinDuration(t, sent.Add(800*time.Millisecond), checkDeadline, 100*time.Millisecond, "40% of the request's 2s")
+	assert.Len(t, h.Queue.Emails(), 1)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// consumedCheckTimeout bounds the consumer mark's Redis calls, so a slow
+// Redis holds up a worker no longer than this.
+const consumedCheckTimeout = 250 * time.Millisecond
+
+func consumedKey(notificationID string) string {
+	return fmt.Sprintf("notification:consumed:%s", notificationID)
+}
+
+// ClaimDelivery is called by consumers before sending a notification. It
+// marks the notification consumed for the configured TTL and reports
+// whether to send it: not when it was already marked and its status is
+// terminal, as for a redelivery of one that went out before its ack. A mark
+// on a notification that isn't terminal was left by an attempt that died
+// mid-send, and doesn't stop this one. When Redis fails, ClaimDelivery
+// sends anyway if ConsumedFailOpen is set and returns the error otherwise.
+// ctx must carry the tenant, as for RecordAttempt.
+func (n *NotificationHandler) ClaimDelivery(ctx context.Context, notificationID string) (bool, error) {
+	ttl := n.cfg.ConsumedTTL
+	if ttl <= 0 {
+		return true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), consumedCheckTimeout)
+	defer cancel()
+
+	send, err := n.claimDelivery(ctx, notificationID, ttl)
+	if err != nil && n.cfg.ConsumedFailOpen {
+		log.Printf("consumer dedupe unavailable, sending %s anyway: %v", notificationID, err)
+		return true, nil
+	}
+	return send, err
+}
+
+func (n *NotificationHandler) claimDelivery(ctx context.Context, notificationID string, ttl time.Duration) (bool, error) {
+	claimed, err := n.redis.SetNX(ctx, n.tenantKey(ctx, consumedKey(notificationID)), n.clock.Now().UTC().Format(time.RFC3339), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark %s consumed: %w", notificationID, err)
+	}
+	if claimed {
+		return true, nil
+	}
+	statusJSON, err := n.statuses.Get(ctx, notificationID)
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get status of %s: %w", notificationID, err)
+	}
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+		return true, nil
+	}
+	return !terminalStatuses[status.Status], nil
+}
+
+// ReleaseDelivery drops the mark ClaimDelivery left, for a delivery that
+// failed and may be tried again.
+func (n *NotificationHandler) ReleaseDelivery(ctx context.Context, notificationID string) error {
+	if n.cfg.ConsumedTTL <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), consumedCheckTimeout)
+	defer cancel()
+	if err := n.redis.Del(ctx, n.tenantKey(ctx, consumedKey(notificationID))).Err(); err != nil {
+		return fmt.Errorf("failed to release %s: %w", notificationID, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSender counts the emails it is asked to send and fails them
+// with its errs, one per send, while it has any.
+type countingSender struct {
+	sent int
+	errs []error
+}
+
+func (s *countingSender) SendEmail(ctx context.Context, msg models.NotificationMessage) error {
+	s.sent++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func consumedHarness(t *testing.T, failOpen bool) (*handlertest.Harness, models.NotificationMessage) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{ConsumedTTL: time.Hour, ConsumedFailOpen: failOpen}).
+		Start(t)
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	emails := h.Queue.Emails()
+	require.Len(t, emails, 1)
+	return h, emails[0]
+}
+
+func TestConsumed_RedeliverySkipped(t *testing.T) {
+	h, msg := consumedHarness(t, true)
+	sender := &countingSender{}
+	worker := queue.NewEmailWorker(sender, h.Handler)
+
+	require.NoError(t, worker.Handle(context.Background(), msg))
+	// the ack was lost and the broker redelivered
+	require.NoError(t, worker.Handle(context.Background(), msg))
+	assert.Equal(t, 1, sender.sent)
+	assert.True(t, h.Miniredis.Exists("notification:consumed:"+msg.ID))
+}
+
+func TestConsumed_FailedSendRetried(t *testing.T) {
+	h, msg := consumedHarness(t, true)
+	sender := &countingSender{errs: []error{queue.Transient(errors.New("smtp timeout"))}}
+	worker := queue.NewEmailWorker(sender, h.Handler)
+
+	assert.Error(t, worker.Handle(context.Background(), msg))
+	assert.False(t, h.Miniredis.Exists("notification:consumed:"+msg.ID), "a failed send releases its mark")
+	require.NoError(t, worker.Handle(context.Background(), msg))
+	assert.Equal(t, 2, sender.sent)
+}
+
+func TestConsumed_UnfinishedAttempt(t *testing.T) {
+	h, msg := consumedHarness(t, true)
+	// a worker marked the notification and died before sending it
+	send, err := h.Handler.ClaimDelivery(context.Background(), msg.ID)
+	require.NoError(t, err)
+	require.True(t, send)
+
+	sender := &countingSender{}
+	require.NoError(t, queue.NewEmailWorker(sender, h.Handler).Handle(context.Background(), msg))
+	assert.Equal(t, 1, sender.sent, "a queued notification is still sent")
+}
+
+func TestConsumed_RedisDown(t *testing.T) {
+	t.Run("fail open", func(t *testing.T) {
+		h, msg := consumedHarness(t, true)
+		h.Miniredis.SetError("connection refused")
+		sender := &countingSender{}
+		assert.NoError(t, queue.NewEmailWorker(sender, h.Handler).Handle(context.Background(), msg))
+		assert.Equal(t, 1, sender.sent)
+	})
+	t.Run("fail closed", func(t *testing.T) {
+		h, msg := consumedHarness(t, false)
+		h.Miniredis.SetError("connection refused")
+		sender := &countingSender{}
+		err := queue.NewEmailWorker(sender, h.Handler).Handle(context.Background(), msg)
+		assert.True(t, queue.IsTransient(err), "the delivery is requeued")
+		assert.Zero(t, sender.sent)
+
+		h.Miniredis.SetError("")
+		require.NoError(t, queue.NewEmailWorker(sender, h.Handler).Handle(context.Background(), msg))
+		assert.Equal(t, 1, sender.sent)
+	})
+}
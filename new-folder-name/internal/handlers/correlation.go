@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+func correlationIndexKey(correlationID string) string {
+	return fmt.Sprintf("notification:correlation:%s", correlationID)
+}
+
+// indexCorrelation adds notificationID to the set of notifications created
+// by the request with correlationID.
+func (n *NotificationHandler) indexCorrelation(ctx context.Context, pipe redis.Pipeliner, notificationID, correlationID string) {
+	if correlationID == "" {
+		return
+	}
+	indexKey := n.tenantKey(ctx, correlationIndexKey(correlationID))
+	pipe.SAdd(ctx, indexKey, notificationID)
+	// kept as long as the status records it points at
+	pipe.Expire(ctx, indexKey, n.cfg.StatusTTL)
+}
+
+// MessagesByCorrelation rebuilds, from their status records, the queue
+// messages of the notifications created by the request with correlationID,
+// oldest first.
+func (n *NotificationHandler) MessagesByCorrelation(ctx context.Context, correlationID string) ([]models.NotificationMessage, error) {
+	ids, err := n.redis.SMembers(ctx, n.tenantKey(ctx, correlationIndexKey(correlationID))).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]models.NotificationStatus, 0, len(ids))
+	for _, id := range ids {
+		statusJSON, err := n.statuses.Get(ctx, id)
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record models.NotificationStatus
+		if err := json.Unmarshal([]byte(statusJSON), &record); err != nil {
+			log.Printf("skipping unreadable status record %s: %v", id, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	messages := make([]models.NotificationMessage, len(records))
+	for i, record := range records {
+		messages[i] = withDelivery(models.NotificationMessage{
+			ID:            record.ID,
+			TenantID:      record.TenantID,
+			Type:          record.Type,
+			UserID:        record.UserID,
+			TemplateID:    record.TemplateID,
+			Variables:     record.Variables,
+			Priority:      record.Priority,
+			ScheduledFor:  record.ScheduledFor,
+			Timestamp:     record.CreatedAt,
+			CorrelationID: record.CorrelationID,
+			Overrides:     record.Overrides,
+			Topic:         record.Topic,
+			Locale:        record.Locale,
+			Category:      record.Category,
+			Metadata:      record.Metadata,
+			GroupID:       record.GroupID,
+		}, record.Delivery)
+	}
+	return messages, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+)
+
+// dashboardFailedSample is how many failed messages the dashboard peeks.
+const dashboardFailedSample = 10
+
+// StopState defines the subset of methods used from the send ceiling to
+// report the emergency stop.
+type StopState interface {
+	IsStopped(ctx context.Context) (bool, error)
+}
+
+// Breaker is a circuit breaker the dashboard reports. *gobreaker's
+// CircuitBreaker implements it.
+type Breaker interface {
+	Name() string
+	State() gobreaker.State
+}
+
+// DashboardHandler gathers what the admin UI shows into one response.
+type DashboardHandler struct {
+	queues           QueueInspector
+	stop             StopState
+	disabledChannels []string
+	breakers         []Breaker
+	clock            clock.Clock
+}
+
+func NewDashboardHandler(queues QueueInspector, stop StopState, disabledChannels []string, breakers ...Breaker) *DashboardHandler {
+	return &DashboardHandler{
+		queues:           queues,
+		stop:             stop,
+		disabledChannels: disabledChannels,
+		breakers:         breakers,
+		clock:            clock.System,
+	}
+}
+
+// BreakerState is a circuit breaker's name and state ("closed", "half-open"
+// or "open").
+type BreakerState struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// KillSwitches are what stops sending: the emergency stop and the disabled
+// channels.
+type KillSwitches struct {
+	EmergencyStop      bool     `json:"emergency_stop"`
+	EmergencyStopError string   `json:"emergency_stop_error,omitempty"`
+	DisabledChannels   []string `json:"disabled_channels"`
+}
+
+// DashboardSummary is the admin UI's view of the gateway.
+type DashboardSummary struct {
+	Queues       []queue.QueueDepth `json:"queues"`
+	KillSwitches KillSwitches       `json:"kill_switches"`
+	Breakers     []BreakerState     `json:"breakers"`
+	// RecentFailures are the oldest messages on the failed queue, when the
+	// queue client can peek at it.
+	RecentFailures      []queue.FailedMessage `json:"recent_failures"`
+	RecentFailuresError string                `json:"recent_failures_error,omitempty"`
+	Timestamp           time.Time             `json:"timestamp"`
+}
+
+// GetSummary reports queue depths, kill switches, breaker states and the
+// recent failures in one call. A part that can't be read is reported on
+// its own rather than failing the whole summary.
+func (d *DashboardHandler) GetSummary(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), queueInspectTimeout)
+	defer cancel()
+
+	summary := DashboardSummary{
+		Queues:         d.queues.QueueDepths(ctx),
+		Breakers:       make([]BreakerState, 0, len(d.breakers)),
+		RecentFailures: []queue.FailedMessage{},
+		Timestamp:      d.clock.Now(),
+	}
+	summary.KillSwitches.DisabledChannels = append([]string{}, d.disabledChannels...)
+	stopped, err := d.stop.IsStopped(ctx)
+	if err != nil {
+		log.Printf("failed to read emergency stop: %v", err)
+		summary.KillSwitches.EmergencyStopError = err.Error()
+	}
+	summary.KillSwitches.EmergencyStop = stopped
+	for _, breaker := range d.breakers {
+		summary.Breakers = append(summary.Breakers, BreakerState{Name: breaker.Name(), State: breaker.State().String()})
+	}
+	if inspector, ok := d.queues.(FailedInspector); ok {
+		failed, err := inspector.InspectFailed(ctx, dashboardFailedSample)
+		if err != nil {
+			log.Printf("failed to inspect failed queue: %v", err)
+			summary.RecentFailuresError = err.Error()
+		} else if failed != nil {
+			summary.RecentFailures = failed
+		}
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Dashboard summary retrieved successfully",
+		Data:    summary,
+	})
+}
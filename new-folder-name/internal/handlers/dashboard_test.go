@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStopState struct {
+	stopped bool
+	err     error
+}
+
+func (f fakeStopState) IsStopped(ctx context.Context) (bool, error) { return f.stopped, f.err }
+
+type fakeBreaker struct {
+	name  string
+	state gobreaker.State
+}
+
+func (f fakeBreaker) Name() string           { return f.name }
+func (f fakeBreaker) State() gobreaker.State { return f.state }
+
+func getDashboard(t *testing.T, handler *DashboardHandler) DashboardSummary {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/admin/dashboard", handler.GetSummary)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/dashboard", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Data DashboardSummary `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data
+}
+
+func TestGetDashboardSummary(t *testing.T) {
+	inspector := &fakeFailedInspector{
+		fakeQueueInspector: fakeQueueInspector{depths: []queue.QueueDepth{
+			{Name: "email.queue", Messages: 7, Consumers: 2},
+			{Name: "failed.queue", Messages: 1},
+		}},
+		failed: []queue.FailedMessage{{MessageID: "n-1", Queue: "email.queue", Reason: "rejected", Count: 1, Body: "{}"}},
+	}
+	handler := NewDashboardHandler(inspector, fakeStopState{stopped: true}, []string{"whatsapp"},
+		fakeBreaker{"user-service", gobreaker.StateClosed}, fakeBreaker{"template-service", gobreaker.StateOpen})
+
+	summary := getDashboard(t, handler)
+	assert.Equal(t, inspector.depths, summary.Queues)
+	assert.Equal(t, KillSwitches{EmergencyStop: true, DisabledChannels: []string{"whatsapp"}}, summary.KillSwitches)
+	assert.Equal(t, []BreakerState{{"user-service", "closed"}, {"template-service", "open"}}, summary.Breakers)
+	assert.Equal(t, inspector.failed, summary.RecentFailures)
+	assert.Equal(t, dashboardFailedSample, inspector.limit)
+	assert.False(t, summary.Timestamp.IsZero())
+}
+
+func TestGetDashboardSummary_PartialFailures(t *testing.T) {
+	// a queue client that can't peek and a stop state that can't be read
+	// still give the rest of the summary
+	handler := NewDashboardHandler(&fakeQueueInspector{depths: []queue.QueueDepth{{Name: "email.queue"}}},
+		fakeStopState{err: errors.New("redis down")}, nil)
+
+	summary := getDashboard(t, handler)
+	assert.Len(t, summary.Queues, 1)
+	assert.Equal(t, "redis down", summary.KillSwitches.EmergencyStopError)
+	assert.Equal(t, []string{}, summary.KillSwitches.DisabledChannels)
+	assert.Equal(t, []BreakerState{}, summary.Breakers)
+	assert.Equal(t, []queue.FailedMessage{}, summary.RecentFailures)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dedupeWindow returns how long a send suppresses identical ones. The
+// request's dedupe_window_seconds overrides the configured window, and zero
+// disables suppression.
+func (n *NotificationHandler) dedupeWindow(requested *int) time.Duration {
+	if requested != nil {
+		return time.Duration(*requested) * time.Second
+	}
+	return n.cfg.DedupeWindow
+}
+
+func dedupeKey(userID, templateID, notificationType string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + templateID + "\x00" + notificationType))
+	return fmt.Sprintf("notification:dedupe:%s", hex.EncodeToString(sum[:]))
+}
+
+// claimDedupe records notificationID as the send for this user, template and
+// type. When another send already holds the window it returns that send's
+// ID. Redis errors let the send through.
+func (n *NotificationHandler) claimDedupe(ctx context.Context, key, notificationID string, window time.Duration) (string, bool) {
+	if window <= 0 {
+		return "", false
+	}
+	claimed, err := n.redis.SetNX(ctx, key, notificationID, window).Result()
+	if err != nil {
+		log.Printf("dedupe check failed: %v", err)
+		return "", false
+	}
+	if claimed {
+		return "", false
+	}
+	original, err := n.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// the window closed between the two calls
+		return "", false
+	}
+	if err != nil {
+		log.Printf("dedupe lookup failed: %v", err)
+		return "", false
+	}
+	return original, true
+}
+
+// releaseDedupe frees the window claimed by a send that failed to publish,
+// so a retry isn't suppressed.
+func (n *NotificationHandler) releaseDedupe(ctx context.Context, key, notificationID string, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	if current, err := n.redis.Get(ctx, key).Result(); err == nil && current == notificationID {
+		n.redis.Del(ctx, key)
+	}
+}
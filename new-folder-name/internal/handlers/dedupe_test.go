@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSendEmail_DuplicateSuppression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{DedupeWindow: time.Minute},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+
+	sendEmail := func(req models.SendEmailRequest) (models.NotificationResponse, models.ErrorCode) {
+		body, _ := json.Marshal(req)
+		httpReq, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.NotificationResponse `json:"data"`
+			Code models.ErrorCode            `json:"code"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data, response.Code
+	}
+
+	t.Run("repeat within the window is suppressed", func(t *testing.T) {
+		first, code := sendEmail(models.SendEmailRequest{UserID: "user-1", TemplateID: "welcome"})
+		assert.Equal(t, "queued", first.Status)
+		assert.Empty(t, code)
+
+		second, code := sendEmail(models.SendEmailRequest{UserID: "user-1", TemplateID: "welcome"})
+		assert.Equal(t, "suppressed", second.Status)
+		assert.Equal(t, models.CodeDuplicateRequest, code)
+		assert.Equal(t, first.NotificationID, second.NotificationID)
+		mockQueue.AssertNumberOfCalls(t, "PublishEmail", 1)
+	})
+
+	t.Run("different template is not a duplicate", func(t *testing.T) {
+		resp, _ := sendEmail(models.SendEmailRequest{UserID: "user-1", TemplateID: "receipt"})
+		assert.Equal(t, "queued", resp.Status)
+	})
+
+	t.Run("zero window disables suppression", func(t *testing.T) {
+		zero := 0
+		resp, _ := sendEmail(models.SendEmailRequest{UserID: "user-1", TemplateID: "welcome", DedupeWindowSeconds: &zero})
+		assert.Equal(t, "queued", resp.Status)
+	})
+
+	t.Run("per-request window overrides the config", func(t *testing.T) {
+		window := 300
+		sendEmail(models.SendEmailRequest{UserID: "user-2", TemplateID: "welcome", DedupeWindowSeconds: &window})
+		ttl := mockRedis.TTL(t.Context(), dedupeKey("user-2", "welcome", "email")).Val()
+		assert.Equal(t, 5*time.Minute, ttl)
+	})
+}
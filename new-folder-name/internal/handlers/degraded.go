@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultProbeInterval is how often Redis is tried again while degraded
+// when notifications.degraded.probe_interval is unset.
+const defaultProbeInterval = 5 * time.Second
+
+// StorageDegraded reports whether status records are being kept in memory
+// because Redis is unreachable.
+func (n *NotificationHandler) StorageDegraded() bool {
+	return n.statuses.Degraded()
+}
+
+// writeStorageDegraded answers a request for a record that is neither in
+// memory nor reachable in Redis while status storage is degraded.
+func writeStorageDegraded(c *gin.Context) {
+	middleware.MarkStorageDegraded(c)
+	middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+		Success: false,
+		Code:    models.CodeServiceUnavailable,
+		Error:   "Status storage unavailable",
+		Message: "Service unavailable",
+	})
+}
+
+// StorageGate guards a send route while status storage is degraded: with
+// notifications.degraded.policy "reject" the send is answered 503,
+// otherwise it goes ahead and its response carries the degraded hint.
+func (n *NotificationHandler) StorageGate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !n.statuses.Degraded() {
+			return
+		}
+		middleware.MarkStorageDegraded(c)
+		if n.cfg.Degraded.Policy == config.DegradedReject {
+			middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+				Success: false,
+				Code:    models.CodeServiceUnavailable,
+				Error:   "Status storage unavailable",
+				Message: "Service unavailable",
+			})
+			c.Abort()
+		}
+	}
+}
+
+// RunStorageRecovery probes Redis every notifications.degraded.probe_interval
+// while degraded, and writes the statuses kept in memory back once it
+// answers, until ctx is done. It returns at once when degraded mode is off.
+func (n *NotificationHandler) RunStorageRecovery(ctx context.Context) {
+	if n.fallback == nil {
+		return
+	}
+	interval := n.cfg.Degraded.ProbeInterval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	n.fallback.Run(ctx, interval)
+}
+
+// RecoverStorage writes the statuses kept in memory back to Redis if it
+// answers, returning how many it wrote.
+func (n *NotificationHandler) RecoverStorage(ctx context.Context) (int, error) {
+	if n.fallback == nil {
+		return 0, nil
+	}
+	return n.fallback.Recover(ctx)
+}
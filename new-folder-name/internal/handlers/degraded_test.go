@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// degradedHarness is a harness whose status store degrades on the first
+// Redis failure.
+func degradedHarness(t *testing.T, policy string) *handlertest.Harness {
+	return handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{
+			IdempotencyFailOpen: true,
+			Degraded:            config.DegradedConfig{Capacity: 100, After: 1, Policy: policy},
+		}).
+		Start(t)
+}
+
+func sendEmail(h *handlertest.Harness) *handlertest.Response {
+	return h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+}
+
+func TestDegraded_AcceptsAndRecovers(t *testing.T) {
+	h := degradedHarness(t, config.DegradedAccept)
+	h.Miniredis.Close()
+
+	first := sendEmail(h)
+	require.Equal(t, http.StatusOK, first.Code, string(first.Body))
+	assert.True(t, h.Handler.StorageDegraded())
+	second := sendEmail(h)
+	require.Equal(t, http.StatusOK, second.Code, string(second.Body))
+	assert.Equal(t, "degraded", second.API().Storage)
+	assert.Len(t, h.Queue.Emails(), 2)
+
+	status := h.GET("/api/v1/notification/status/" + second.NotificationID())
+	require.Equal(t, http.StatusOK, status.Code, string(status.Body))
+	assert.Equal(t, "degraded", status.API().Storage)
+	missing := h.GET("/api/v1/notification/status/unknown")
+	assert.Equal(t, http.StatusServiceUnavailable, missing.Code)
+
+	require.NoError(t, h.Miniredis.Restart())
+	var written int
+	require.Eventually(t, func() bool {
+		var err error
+		written, err = h.Handler.RecoverStorage(context.Background())
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 2, written)
+	assert.False(t, h.Handler.StorageDegraded())
+	assert.True(t, h.Miniredis.Exists("notification:status:"+first.NotificationID()))
+	status = h.GET("/api/v1/notification/status/" + first.NotificationID())
+	require.Equal(t, http.StatusOK, status.Code)
+	assert.Empty(t, status.API().Storage)
+}
+
+func TestDegraded_RecordsInMemoryAreServed(t *testing.T) {
+	h := degradedHarness(t, config.DegradedAccept)
+	h.Miniredis.Close()
+	sent := sendEmail(h)
+	require.Equal(t, http.StatusOK, sent.Code, string(sent.Body))
+	require.True(t, h.Handler.StorageDegraded())
+	id := sent.NotificationID()
+
+	head := h.Do(http.MethodHead, "/api/v1/notification/status/"+id, nil)
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, "queued", head.Header.Get("X-Notification-Status"))
+	head = h.Do(http.MethodHead, "/api/v1/notification/status/unknown", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, head.Code)
+
+	h.WithClaims(jwt.MapClaims{"sub": handlertest.DefaultCaller, "user_id": "user123"})
+	snoozed := h.POST("/api/v1/notification/"+id+"/snooze", models.SnoozeRequest{Duration: "2h"})
+	require.Equal(t, http.StatusOK, snoozed.Code, string(snoozed.Body))
+	cloneID := snoozed.NotificationID()
+	var original, clone models.NotificationStatus
+	h.GET("/api/v1/notification/status/" + id).Decode(&original)
+	assert.Equal(t, 1, original.SnoozeCount)
+	h.GET("/api/v1/notification/status/" + cloneID).Decode(&clone)
+	assert.Equal(t, "scheduled", clone.Status)
+	assert.Equal(t, id, clone.ParentID)
+
+	require.NoError(t, h.Miniredis.Restart())
+	var written int
+	require.Eventually(t, func() bool {
+		var err error
+		written, err = h.Handler.RecoverStorage(context.Background())
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 2, written, "the snoozed original and its clone")
+	stored, err := h.Miniredis.Get("notification:status:" + id)
+	require.NoError(t, err)
+	assert.Contains(t, stored, `"snooze_count":1`)
+	assert.True(t, h.Miniredis.Exists("notification:status:"+cloneID))
+}
+
+func TestDegraded_Reject(t *testing.T) {
+	h := degradedHarness(t, config.DegradedReject)
+	h.Miniredis.Close()
+	sendEmail(h)
+	require.True(t, h.Handler.StorageDegraded())
+
+	resp := sendEmail(h)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, models.CodeServiceUnavailable, resp.API().Code)
+	assert.Equal(t, "degraded", resp.API().Storage)
+	assert.Len(t, h.Queue.Emails(), 1, "only the send that found Redis down")
+}
+
+func TestHealthCheck_StorageDegraded(t *testing.T) {
+	h := degradedHarness(t, config.DegradedAccept)
+	health := handlers.NewHealthHandler(brokerState{connected: true}, h.Redis,
+		services.NewUserServiceClient("", true), services.NewTemplateClient("", true))
+	health.WatchStorage(h.Handler)
+	router := gin.New()
+	router.GET("/health", health.HealthCheck)
+	check := func() (int, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body struct {
+			Checks map[string]string `json:"checks"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body.Checks["redis"]
+	}
+
+	h.Miniredis.Close()
+	code, redisCheck := check()
+	assert.Equal(t, http.StatusServiceUnavailable, code, "down, but not degraded yet")
+	assert.Equal(t, "unhealthy", redisCheck)
+
+	sendEmail(h)
+	require.True(t, h.Handler.StorageDegraded())
+	for i := 0; i < 3; i++ {
+		code, redisCheck = check()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "degraded", redisCheck)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// duplicateCheckTimeout bounds the detector's Redis calls, so a slow Redis
+// holds up a worker no longer than this.
+const duplicateCheckTimeout = 250 * time.Millisecond
+
+// duplicateReportTTL keeps a day's duplicates for a week of reconciliation.
+const duplicateReportTTL = 8 * 24 * time.Hour
+
+// deliveryFingerprint identifies what a notification delivered: the
+// channel, the recipient, the template and a hash of the content rendered
+// into it.
+func deliveryFingerprint(msg models.NotificationMessage) (string, error) {
+	content, err := json.Marshal(struct {
+		Variables map[string]interface{} `json:"variables"`
+		Overrides *models.Overrides      `json:"overrides"`
+		Locale    string                 `json:"locale"`
+	}{msg.Variables, msg.Overrides, msg.Locale})
+	if err != nil {
+		return "", err
+	}
+	contentHash := sha256.Sum256(content)
+	recipient := "user:" + msg.UserID
+	if msg.Topic != "" {
+		recipient = "topic:" + msg.Topic
+	}
+	sum := sha256.Sum256([]byte(msg.Type + "\x00" + recipient + "\x00" + msg.TemplateID + "\x00" + hex.EncodeToString(contentHash[:])))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func deliveryKey(fingerprint string) string {
+	return fmt.Sprintf("notification:delivered:%s", fingerprint)
+}
+
+// duplicatesKey is the day's reconciliation list. It is shared by the
+// tenants, whose entries carry their tenant ID.
+func duplicatesKey(date string) string {
+	return fmt.Sprintf("notification:duplicates:%s", date)
+}
+
+// RecordDelivery is called by consumers after a notification went out. It
+// keeps the delivery's fingerprint for the configured window and, when the
+// same content already went to the same recipient within it, annotates
+// both statuses, adds the pair to the day's duplicate report and returns
+// the ID of the earlier notification. The detector must never hold up a
+// delivery: its Redis calls are bounded by duplicateCheckTimeout, and the
+// caller only logs the error. ctx must carry the tenant, as for
+// RecordAttempt.
+func (n *NotificationHandler) RecordDelivery(ctx context.Context, msg models.NotificationMessage) (string, error) {
+	window := n.cfg.DuplicateWindow
+	if window <= 0 {
+		return "", nil
+	}
+	fingerprint, err := deliveryFingerprint(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint delivery of %s: %w", msg.ID, err)
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), duplicateCheckTimeout)
+	defer cancel()
+
+	key := n.tenantKey(ctx, deliveryKey(fingerprint))
+	claimed, err := n.redis.SetNX(ctx, key, msg.ID, window).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to record delivery of %s: %w", msg.ID, err)
+	}
+	if claimed {
+		return "", nil
+	}
+	original, err := n.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// the window closed between the two calls
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up delivery of %s: %w", msg.ID, err)
+	}
+
+	log.Printf("duplicate delivery: notification %s repeated %s (fingerprint %s)", msg.ID, original, fingerprint)
+	if err := n.annotateDuplicate(ctx, msg.ID, original); err != nil {
+		log.Printf("failed to annotate duplicate %s: %v", msg.ID, err)
+	}
+	if original != msg.ID {
+		if err := n.annotateDuplicate(ctx, original, msg.ID); err != nil {
+			log.Printf("failed to annotate duplicate %s: %v", original, err)
+		}
+	}
+	now := n.clock.Now().UTC()
+	entry, err := json.Marshal(models.DuplicateDelivery{
+		DetectedAt:     now,
+		Fingerprint:    fingerprint,
+		Channel:        msg.Type,
+		TenantID:       n.tenantOf(ctx),
+		UserID:         msg.UserID,
+		Topic:          msg.Topic,
+		TemplateID:     msg.TemplateID,
+		NotificationID: msg.ID,
+		DuplicateOf:    original,
+	})
+	if err != nil {
+		return original, err
+	}
+	reportKey := n.keys.Key(duplicatesKey(now.Format(time.DateOnly)))
+	_, err = n.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, reportKey, entry)
+		pipe.Expire(ctx, reportKey, duplicateReportTTL)
+		return nil
+	})
+	if err != nil {
+		return original, fmt.Errorf("failed to report duplicate %s: %w", msg.ID, err)
+	}
+	return original, nil
+}
+
+// annotateDuplicate adds other to the duplicate deliveries on the status
+// of notificationID.
+func (n *NotificationHandler) annotateDuplicate(ctx context.Context, notificationID, other string) error {
+	return n.updateStatus(ctx, notificationID, func(status *models.NotificationStatus) (bool, error) {
+		if slices.Contains(status.DuplicateDeliveries, other) {
+			return false, nil
+		}
+		status.DuplicateDeliveries = append(status.DuplicateDeliveries, other)
+		status.UpdatedAt = n.clock.Now()
+		return true, nil
+	}, nil)
+}
+
+// GetDuplicateReport returns the duplicate deliveries detected on a day,
+// given as date=YYYY-MM-DD in UTC and defaulting to today.
+func (n *NotificationHandler) GetDuplicateReport(c *gin.Context) {
+	date := c.DefaultQuery("date", n.clock.Now().UTC().Format(time.DateOnly))
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    []models.FieldError{{Field: "date", Message: "date must be a YYYY-MM-DD date"}},
+			Error:   "Invalid date",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	entries, err := n.redis.LRange(c.Request.Context(), n.keys.Key(duplicatesKey(date)), 0, -1).Result()
+	if err != nil {
+		log.Printf("failed to read duplicate report for %s: %v", date, err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to retrieve duplicate report",
+			Message: "Internal server error",
+		})
+		return
+	}
+	report := models.DuplicateReport{Date: date, Duplicates: make([]models.DuplicateDelivery, 0, len(entries))}
+	for _, raw := range entries {
+		var entry models.DuplicateDelivery
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			log.Printf("skipping malformed duplicate report entry: %v", err)
+			continue
+		}
+		report.Duplicates = append(report.Duplicates, entry)
+	}
+	report.Total = len(report.Duplicates)
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Duplicate report retrieved successfully",
+		Data:    report,
+	})
+}
@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// duplicateCounter counts the duplicate deliveries a worker observed.
+type duplicateCounter struct {
+	duplicates map[string]int
+}
+
+func (d *duplicateCounter) ObservePublish(string, time.Duration, error) {}
+func (d *duplicateCounter) ObservePublishRetry(string)                  {}
+func (d *duplicateCounter) ObserveDelivery(string, time.Duration)       {}
+func (d *duplicateCounter) ObserveDuplicateDelivery(channel string) {
+	d.duplicates[channel]++
+}
+
+func duplicateHarness(t *testing.T, now time.Time) *handlertest.Harness {
+	return handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{DuplicateWindow: 10 * time.Minute}).
+		WithClaims(jwt.MapClaims{"sub": "ops", "scope": middleware.AdminScope}).
+		WithClock(clock.NewFake(now)).
+		Start(t)
+}
+
+func TestDuplicateDetector_ForcedDoubleSend(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := duplicateHarness(t, now)
+	send := models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email", Variables: map[string]interface{}{"name": "Ada"}}
+	first := h.POST("/api/v1/notification/email", send).NotificationID()
+	second := h.POST("/api/v1/notification/email", send).NotificationID()
+	emails := h.Queue.Emails()
+	require.Len(t, emails, 2)
+
+	observer := &duplicateCounter{duplicates: map[string]int{}}
+	worker := queue.NewEmailWorker(queue.LoopbackEmailSender{}, h.Handler)
+	worker.Observer = observer
+	ctx := context.Background()
+	require.NoError(t, worker.Handle(ctx, emails[0]))
+	assert.Zero(t, observer.duplicates["email"], "a first delivery is no duplicate")
+	// the worker crashed before acking and the message came back
+	require.NoError(t, worker.Handle(ctx, emails[0]))
+	require.NoError(t, worker.Handle(ctx, emails[1]))
+	assert.Equal(t, 2, observer.duplicates["email"])
+
+	status := func(id string) models.NotificationStatus {
+		resp := h.GET("/api/v1/notification/status/" + id)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var status models.NotificationStatus
+		resp.Decode(&status)
+		return status
+	}
+	assert.Equal(t, []string{first, second}, status(first).DuplicateDeliveries)
+	assert.Equal(t, []string{first}, status(second).DuplicateDeliveries)
+	assert.Equal(t, "sent", status(second).Status, "detection doesn't change the delivery")
+
+	resp := h.GET("/api/v1/admin/reports/duplicates?date=2026-03-01")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var report models.DuplicateReport
+	resp.Decode(&report)
+	assert.Equal(t, "2026-03-01", report.Date)
+	require.Equal(t, 2, report.Total)
+	assert.Equal(t, first, report.Duplicates[0].NotificationID)
+	assert.Equal(t, first, report.Duplicates[0].DuplicateOf)
+	assert.Equal(t, second, report.Duplicates[1].NotificationID)
+	assert.Equal(t, first, report.Duplicates[1].DuplicateOf)
+	assert.Equal(t, "email", report.Duplicates[1].Channel)
+	assert.Equal(t, "user123", report.Duplicates[1].UserID)
+	assert.Equal(t, "welcome_email", report.Duplicates[1].TemplateID)
+	assert.Equal(t, now, report.Duplicates[1].DetectedAt.UTC())
+	assert.Equal(t, report.Duplicates[0].Fingerprint, report.Duplicates[1].Fingerprint)
+
+	resp = h.GET("/api/v1/admin/reports/duplicates")
+	resp.Decode(&report)
+	assert.Equal(t, 2, report.Total, "the date defaults to today")
+}
+
+func TestDuplicateDetector_DifferentContent(t *testing.T) {
+	h := duplicateHarness(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email", Variables: map[string]interface{}{"name": "Ada"}})
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email", Variables: map[string]interface{}{"name": "Grace"}})
+
+	for _, msg := range h.Queue.Emails() {
+		original, err := h.Handler.RecordDelivery(context.Background(), msg)
+		require.NoError(t, err)
+		assert.Empty(t, original)
+	}
+	var report models.DuplicateReport
+	h.GET("/api/v1/admin/reports/duplicates?date=2026-03-01").Decode(&report)
+	assert.Zero(t, report.Total)
+	assert.NotNil(t, report.Duplicates)
+}
+
+func TestDuplicateDetector_NeverFailsDelivery(t *testing.T) {
+	h := duplicateHarness(t, time.Now())
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	msg := h.Queue.Emails()[0]
+	h.Miniredis.SetError("LOADING Redis is loading the dataset in memory")
+
+	_, err := h.Handler.RecordDelivery(context.Background(), msg)
+	assert.Error(t, err)
+	assert.NoError(t, queue.NewEmailWorker(queue.LoopbackEmailSender{}, h.Handler).Handle(context.Background(), msg))
+}
+
+func TestDuplicateReport_InvalidDate(t *testing.T) {
+	h := duplicateHarness(t, time.Now())
+	resp := h.GET("/api/v1/admin/reports/duplicates?date=yesterday")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
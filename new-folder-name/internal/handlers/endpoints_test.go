@@ -0,0 +1,234 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/franzego/stage04/pkg/idgen"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendEmail_Success(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	resp.AssertGolden("email_queued")
+
+	emails := h.Queue.Emails()
+	if assert.Len(t, emails, 1) {
+		assert.Equal(t, resp.NotificationID(), emails[0].ID)
+		assert.Equal(t, "user123", emails[0].UserID)
+		assert.Equal(t, "welcome_email", emails[0].TemplateID)
+	}
+}
+
+func TestSendEmail_InvalidUser(t *testing.T) {
+	h := handlertest.NewHarness().WithUser(false).Start(t)
+
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "invalid_user", TemplateID: "welcome_email"}).
+		AssertGolden("email_invalid_user")
+	assert.Empty(t, h.Queue.Emails())
+}
+
+func TestSendEmail_InvalidTemplate(t *testing.T) {
+	h := handlertest.NewHarness().WithTemplate(false).Start(t)
+
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user-789", TemplateID: "invalid-template"}).
+		AssertGolden("email_invalid_template")
+	assert.Empty(t, h.Queue.Emails())
+}
+
+func TestSendEmail_PublishFailure(t *testing.T) {
+	h := handlertest.NewHarness().WithQueueError(errors.New("connection failed")).Start(t)
+
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user-publish-fail", TemplateID: "template-publish-fail"}).
+		AssertGolden("email_publish_failure")
+}
+
+func TestSendPush_Success(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user-456", TemplateID: "push-promo"}).
+		AssertGolden("push_queued")
+	assert.Len(t, h.Queue.Pushes(), 1)
+}
+
+func TestGetStatus_AfterSend(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	id := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "status-user", TemplateID: "status-template"}).NotificationID()
+	resp := h.GET("/api/v1/notification/status/" + id)
+	resp.AssertGolden("status_queued")
+
+	var status models.NotificationStatus
+	resp.Decode(&status)
+	assert.Equal(t, id, status.ID)
+}
+
+func TestSend_ConfiguredTTLs(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		cfg         config.NotificationsConfig
+		status, ids time.Duration
+	}{
+		{"defaults", config.NotificationsConfig{}, 24 * time.Hour, 24 * time.Hour},
+		{"configured", config.NotificationsConfig{StatusTTL: 7 * 24 * time.Hour, IdempotencyTTL: time.Hour}, 7 * 24 * time.Hour, time.Hour},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlertest.NewHarness().WithConfig(tt.cfg).Start(t)
+			id := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}).NotificationID()
+
+			assert.Equal(t, tt.status, h.Miniredis.TTL("notification:status:"+id))
+			assert.Equal(t, tt.status, h.Miniredis.TTL("notification:index:user:user123"), "indexes follow the status")
+			assert.Equal(t, tt.ids, h.Miniredis.TTL("notification:idempotency:"+id))
+		})
+	}
+}
+
+func TestGetStatus_NotFound(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	h.GET("/api/v1/notification/status/non-existent-id").AssertGolden("status_not_found")
+}
+
+func TestGetStatus_EmptyID(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	// gin doesn't match the route without an ID
+	assert.Equal(t, http.StatusNotFound, h.GET("/api/v1/notification/status/").Code)
+}
+
+func TestHeadStatus(t *testing.T) {
+	t.Run("exists", func(t *testing.T) {
+		h := handlertest.NewHarness().Start(t)
+
+		id := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}).NotificationID()
+		resp := h.Do(http.MethodHead, "/api/v1/notification/status/"+id, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "queued", resp.Header.Get("X-Notification-Status"))
+		assert.Empty(t, resp.Body)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		h := handlertest.NewHarness().Start(t)
+
+		resp := h.Do(http.MethodHead, "/api/v1/notification/status/non-existent-id", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Empty(t, resp.Header.Get("X-Notification-Status"))
+		assert.Empty(t, resp.Body)
+	})
+
+	t.Run("another caller's record looks missing", func(t *testing.T) {
+		h := handlertest.NewHarness().Start(t)
+		h.Miniredis.Set("notification:status:n-1", `{"id":"n-1","status":"sent","created_by":"billing"}`)
+
+		resp := h.Do(http.MethodHead, "/api/v1/notification/status/n-1", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Empty(t, resp.Header.Get("X-Notification-Status"))
+	})
+
+	t.Run("read-all callers get the status of any record", func(t *testing.T) {
+		h := handlertest.NewHarness().
+			WithClaims(jwt.MapClaims{"sub": "support-console", "scope": middleware.ReadAllScope}).
+			Start(t)
+		h.Miniredis.Set("notification:status:n-1", `{"id":"n-1","status":"sent","created_by":"billing"}`)
+
+		resp := h.Do(http.MethodHead, "/api/v1/notification/status/n-1", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "sent", resp.Header.Get("X-Notification-Status"))
+		assert.Empty(t, resp.Body)
+		assert.Equal(t, http.StatusNotFound, h.Do(http.MethodHead, "/api/v1/notification/status/n-2", nil).Code)
+	})
+}
+
+func TestProblemJSON_HandlerError(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithUser(false).
+		WithHeader("Accept", middleware.ProblemContentType).
+		WithHeader(middleware.CorrelationIDHeader, "corr-123").
+		Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "invalid_user", TemplateID: "welcome_email"})
+	assert.Equal(t, middleware.ProblemContentType, resp.Header.Get("Content-Type"))
+	resp.AssertGolden("problem_invalid_user")
+}
+
+func TestProblemJSON_AuthMiddleware(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithHeader("Accept", "application/json, application/problem+json;q=0.9").
+		WithHeader("Authorization", "Bearer not-a-token").
+		WithHeader(middleware.CorrelationIDHeader, "corr-456").
+		Start(t)
+
+	resp := h.GET("/api/v1/notification/status/abc")
+	assert.Equal(t, middleware.ProblemContentType, resp.Header.Get("Content-Type"))
+	resp.AssertGolden("problem_unauthorized")
+}
+
+func TestAuthMiddleware_RejectsForgedTokens(t *testing.T) {
+	admin := jwt.MapClaims{"sub": "intruder", "scope": middleware.AdminScope}
+	wrongSecret, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, admin).SignedString([]byte("my-secret-key"))
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, admin).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for name, token := range map[string]string{"wrong secret": wrongSecret, "alg none": unsigned} {
+		t.Run(name, func(t *testing.T) {
+			h := handlertest.NewHarness().WithHeader("Authorization", "Bearer "+token).Start(t)
+			assert.Equal(t, http.StatusUnauthorized, h.GET("/api/v1/admin/notifications").Code)
+			assert.Equal(t, http.StatusUnauthorized, h.GET("/api/v1/notification/status/abc").Code)
+		})
+	}
+}
+
+func TestProblemJSON_NotRequested(t *testing.T) {
+	h := handlertest.NewHarness().WithUser(false).WithHeader("Accept", "application/json").Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "invalid_user", TemplateID: "welcome_email"})
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	resp.AssertGolden("email_invalid_user")
+}
+
+func TestSendEmail_CorrelationIDReachesMessage(t *testing.T) {
+	h := handlertest.NewHarness().WithHeader(middleware.CorrelationIDHeader, "corr-trace").Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+	assert.Equal(t, "corr-trace", resp.Header.Get(middleware.CorrelationIDHeader))
+	if emails := h.Queue.Emails(); assert.Len(t, emails, 1) {
+		assert.Equal(t, "corr-trace", emails[0].CorrelationID)
+	}
+
+	messages, err := h.Handler.MessagesByCorrelation(context.Background(), "corr-trace")
+	require.NoError(t, err)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, resp.NotificationID(), messages[0].ID)
+	}
+}
+
+func TestSendEmail_DeterministicClockAndIDs(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := handlertest.NewHarness().WithClock(clock.NewFake(now)).WithIDs(idgen.NewSequence()).Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	assert.Equal(t, "00000000-0000-4000-8000-000000000001", resp.Header.Get(middleware.RequestIDHeader))
+	assert.Equal(t, "00000000-0000-4000-8000-000000000002", resp.Header.Get(middleware.CorrelationIDHeader))
+	assert.Equal(t, "00000000-0000-4000-8000-000000000003", resp.NotificationID())
+
+	var data struct {
+		QueuedAt time.Time `json:"queued_at"`
+	}
+	resp.Decode(&data)
+	assert.Equal(t, now, data.QueuedAt.UTC())
+	if emails := h.Queue.Emails(); assert.Len(t, emails, 1) {
+		assert.Equal(t, now, emails[0].Timestamp.UTC())
+	}
+}
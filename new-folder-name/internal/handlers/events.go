@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// statusEventTimeout bounds the publish of a status event, which runs
+// after the status write and never holds it up.
+const statusEventTimeout = 250 * time.Millisecond
+
+// ErrStatusEventsDisabled is returned by SubscribeStatusEvents when
+// notifications.events_channel is empty.
+var ErrStatusEventsDisabled = errors.New("status events are disabled")
+
+// publishStatusEvent announces that record moved from oldStatus to its
+// status on the events channel. It returns at once; the publish is
+// dropped, and logged, if Redis doesn't take it in time.
+func (n *NotificationHandler) publishStatusEvent(ctx context.Context, record models.NotificationStatus, oldStatus string) {
+	if n.cfg.EventsChannel == "" || record.Status == oldStatus {
+		return
+	}
+	event, err := json.Marshal(models.StatusEvent{
+		ID:            record.ID,
+		Type:          record.Type,
+		TenantID:      record.TenantID,
+		OldStatus:     oldStatus,
+		NewStatus:     record.Status,
+		Timestamp:     n.clock.Now(),
+		CorrelationID: record.CorrelationID,
+	})
+	if err != nil {
+		log.Printf("failed to encode status event for %s: %v", record.ID, err)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), statusEventTimeout)
+		defer cancel()
+		if err := n.redis.Publish(ctx, n.keys.Key(n.cfg.EventsChannel), event).Err(); err != nil {
+			log.Printf("failed to publish status event for %s: %v", record.ID, err)
+		}
+	}()
+}
+
+// SubscribeStatusEvents delivers the status events published from now on,
+// across all tenants, until ctx is done, when the channel is closed. An
+// event that can't be decoded is skipped.
+func (n *NotificationHandler) SubscribeStatusEvents(ctx context.Context) (<-chan models.StatusEvent, error) {
+	if n.cfg.EventsChannel == "" {
+		return nil, ErrStatusEventsDisabled
+	}
+	pubsub := n.redis.Subscribe(ctx, n.keys.Key(n.cfg.EventsChannel))
+	// wait for the subscription so no event published after we return is
+	// missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	events := make(chan models.StatusEvent)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			var msg *redis.Message
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-messages:
+				if !ok {
+					return
+				}
+				msg = m
+			}
+			var event models.StatusEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("skipping unreadable status event: %v", err)
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
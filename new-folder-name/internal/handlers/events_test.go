@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, events <-chan models.StatusEvent) models.StatusEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "events closed")
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no status event")
+	}
+	return models.StatusEvent{}
+}
+
+func TestStatusEvents(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{EventsChannel: "notification:events"}).
+		Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := h.Handler.SubscribeStatusEvents(ctx)
+	require.NoError(t, err)
+
+	id := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}).NotificationID()
+	event := nextEvent(t, events)
+	assert.Equal(t, id, event.ID)
+	assert.Equal(t, "email", event.Type)
+	assert.Empty(t, event.OldStatus)
+	assert.Equal(t, "queued", event.NewStatus)
+	assert.False(t, event.Timestamp.IsZero())
+
+	// the worker's writes are announced too
+	require.NoError(t, h.Handler.SetDeliveryStatus(ctx, id, "sent"))
+	event = nextEvent(t, events)
+	assert.Equal(t, id, event.ID)
+	assert.Equal(t, "queued", event.OldStatus)
+	assert.Equal(t, "sent", event.NewStatus)
+
+	// an attempt leaves the status as it is, so it isn't an event
+	require.NoError(t, h.Handler.RecordAttempt(ctx, id, nil))
+	require.NoError(t, h.Handler.SetDeliveryStatus(ctx, id, "sent"))
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestStatusEvents_Disabled(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	_, err := h.Handler.SubscribeStatusEvents(context.Background())
+	assert.ErrorIs(t, err, handlers.ErrStatusEventsDisabled)
+}
@@ -0,0 +1,44 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPush_ExpiresIn(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	resp := h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "otp_code", ExpiresInSeconds: 300})
+	require.Equal(t, http.StatusOK, resp.Code)
+	pushes := h.Queue.Pushes()
+	require.Len(t, pushes, 1)
+	assert.Equal(t, 300, pushes[0].ExpiresInSeconds)
+}
+
+func TestSend_InvalidExpiresIn(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	for _, seconds := range []int{-1, 7*24*60*60 + 1} {
+		for path, body := range map[string]interface{}{
+			"/api/v1/notification/email":    models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email", ExpiresInSeconds: seconds},
+			"/api/v1/notification/push":     models.SendPushRequest{UserID: "user123", TemplateID: "otp_code", ExpiresInSeconds: seconds},
+			"/api/v1/notification/whatsapp": models.SendWhatsAppRequest{UserID: "user123", TemplateID: "otp_code", ExpiresInSeconds: seconds},
+		} {
+			resp := h.POST(path, body)
+			require.Equal(t, http.StatusBadRequest, resp.Code, "%s %d", path, seconds)
+			var fieldErrors []models.FieldError
+			resp.Decode(&fieldErrors)
+			if assert.Len(t, fieldErrors, 1) {
+				assert.Equal(t, "expires_in_seconds", fieldErrors[0].Field)
+			}
+		}
+	}
+	assert.Empty(t, h.Queue.Emails())
+	assert.Empty(t, h.Queue.Pushes())
+	assert.Empty(t, h.Queue.WhatsApps())
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/franzego/stage04/internal/manifest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/franzego/stage04/pkg/buildinfo"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// BrokerHealth is the broker connection state the health check reads. The
+// RabbitMQ client implements it.
+type BrokerHealth interface {
+	IsConnected() bool
+	ReconnectFailing() bool
+}
+
+// OutboxMonitor reports how many sends wait in each queue's outbox. The
+// notification handler implements it.
+type OutboxMonitor interface {
+	OutboxDepth(ctx context.Context) (map[string]int64, error)
+}
+
+// StorageMonitor reports whether status records are kept in memory while
+// Redis is unreachable. The notification handler implements it.
+type StorageMonitor interface {
+	StorageDegraded() bool
+}
+
+type HealthHandler struct {
+	queue           BrokerHealth
+	redis           *redis.Client
+	userService     *services.UserServiceClient
+	templateService *services.TemplateServiceClient
+	// manifest, when set, adds the template manifest to the checks;
+	// manifestGate makes a missing critical template unhealthy.
+	manifest     *manifest.Status
+	manifestGate bool
+	// outbox, when set, adds the outbox depths to the checks.
+	outbox OutboxMonitor
+	// storage, when set, holds the Redis check at degraded for as long as
+	// statuses are kept in memory.
+	storage StorageMonitor
+	clock   clock.Clock
+}
+
+func NewHealthHandler(
+	queue BrokerHealth,
+	redis *redis.Client,
+	userService *services.UserServiceClient,
+	templateService *services.TemplateServiceClient,
+) *HealthHandler {
+	return &HealthHandler{
+		queue:           queue,
+		redis:           redis,
+		userService:     userService,
+		templateService: templateService,
+		clock:           clock.System,
+	}
+}
+
+// WatchTemplateManifest adds the manifest's templates to the checks: any
+// missing is degraded, and with gate a missing critical one is unhealthy,
+// failing readiness until the template service has it again.
+func (h *HealthHandler) WatchTemplateManifest(status *manifest.Status, gate bool) {
+	h.manifest, h.manifestGate = status, gate
+}
+
+// WatchOutbox adds the outbox to the checks: sends waiting in it for the
+// broker are degraded, and the body reports each queue's depth.
+func (h *HealthHandler) WatchOutbox(outbox OutboxMonitor) {
+	h.outbox = outbox
+}
+
+// WatchStorage reports Redis as degraded while storage is, instead of
+// pinging it: the store has already seen it fail and probes it itself.
+func (h *HealthHandler) WatchStorage(storage StorageMonitor) {
+	h.storage = storage
+}
+
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	checks := make(map[string]string)
+
+	// Check RabbitMQ: a reconnect in progress is only degraded until an
+	// attempt fails; a closed client won't reconnect at all
+	switch {
+	case h.queue.IsConnected():
+		checks["rabbitmq"] = "healthy"
+	case h.queue.ReconnectFailing():
+		checks["rabbitmq"] = "unhealthy"
+	default:
+		checks["rabbitmq"] = "degraded"
+	}
+
+	// Check Redis, which is degraded rather than unhealthy while statuses
+	// are kept in memory
+	switch {
+	case h.storage != nil && h.storage.StorageDegraded():
+		checks["redis"] = "degraded"
+	case h.redis.Ping(ctx).Err() == nil:
+		checks["redis"] = "healthy"
+	default:
+		checks["redis"] = "unhealthy"
+	}
+
+	// Check User Service (circuit breaker aware)
+	if _, err := h.userService.ValidateUser(ctx, "health-check"); err == nil {
+		checks["user_service"] = "healthy"
+	} else {
+		checks["user_service"] = "degraded"
+	}
+
+	// Check Template Service (circuit breaker aware)
+	if _, err := h.templateService.ValidateTemplate(ctx, "health-check"); err == nil {
+		checks["template_service"] = "healthy"
+	} else {
+		checks["template_service"] = "degraded"
+	}
+
+	// Check the template manifest, fetching again only what was missing
+	if h.manifest != nil {
+		report, _ := h.manifest.Refresh(ctx)
+		switch {
+		case len(report.MissingCritical) > 0 && h.manifestGate:
+			checks["template_manifest"] = "unhealthy"
+		case len(report.Missing) > 0:
+			checks["template_manifest"] = "degraded"
+		default:
+			checks["template_manifest"] = "healthy"
+		}
+	}
+
+	// Check the outbox, where sends wait while the broker is away
+	var outboxDepth map[string]int64
+	if h.outbox != nil {
+		depth, err := h.outbox.OutboxDepth(ctx)
+		checks["outbox"] = "healthy"
+		if err != nil {
+			checks["outbox"] = "degraded"
+		}
+		for _, pending := range depth {
+			if pending > 0 {
+				checks["outbox"] = "degraded"
+			}
+		}
+		outboxDepth = depth
+	}
+
+	// Determine overall status
+	overallStatus := "healthy"
+	for _, status := range checks {
+		if status == "unhealthy" {
+			overallStatus = "unhealthy"
+			break
+		} else if status == "degraded" {
+			overallStatus = "degraded"
+		}
+	}
+
+	body := gin.H{
+		"status":    overallStatus,
+		"timestamp": h.clock.Now().Format(time.RFC3339),
+		"checks":    checks,
+		"version":   buildinfo.Version,
+	}
+	if h.outbox != nil {
+		body["outbox"] = outboxDepth
+	}
+	if overallStatus != "unhealthy" {
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	var unhealthy []string
+	for name, status := range checks {
+		if status == "unhealthy" {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+	sort.Strings(unhealthy)
+	problem := middleware.NewProblem(c, http.StatusServiceUnavailable, models.CodeServiceUnavailable,
+		"unhealthy: "+strings.Join(unhealthy, ", "))
+	middleware.Respond(c, http.StatusServiceUnavailable, problem, body)
+}
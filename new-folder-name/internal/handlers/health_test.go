@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type brokerState struct {
+	connected, failing bool
+}
+
+func (b brokerState) IsConnected() bool      { return b.connected }
+func (b brokerState) ReconnectFailing() bool { return b.failing }
+
+func TestHealthCheck_Broker(t *testing.T) {
+	tests := []struct {
+		name   string
+		broker brokerState
+		code   int
+		status string
+	}{
+		{name: "connected", broker: brokerState{connected: true}, code: http.StatusOK, status: "healthy"},
+		{name: "reconnecting", broker: brokerState{}, code: http.StatusOK, status: "degraded"},
+		{name: "closed", broker: brokerState{failing: true}, code: http.StatusServiceUnavailable, status: "unhealthy"},
+	}
+	gin.SetMode(gin.TestMode)
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer redisClient.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := handlers.NewHealthHandler(tt.broker, redisClient,
+				services.NewUserServiceClient("", true), services.NewTemplateClient("", true))
+			router := gin.New()
+			router.GET("/health", health.HealthCheck)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			var body struct {
+				Status string            `json:"status"`
+				Checks map[string]string `json:"checks"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.status, body.Status)
+			assert.Equal(t, tt.status, body.Checks["rabbitmq"])
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const historyTTL = 7 * 24 * time.Hour
+
+// History entries are written by whichever replica handles the change, and
+// replica clocks disagree by a few milliseconds. Each entry therefore takes
+// a per-notification sequence number from Redis, and the sequence, not the
+// wall time, orders a history.
+func historyKey(notificationID string) string {
+	return fmt.Sprintf("notification:history:%s", notificationID)
+}
+
+func historySeqKey(notificationID string) string {
+	return fmt.Sprintf("notification:history:%s:seq", notificationID)
+}
+
+// clockSkew counts the history gaps that came out negative and were clamped
+// to zero when a history was read.
+type clockSkew struct {
+	clamped atomic.Int64
+	maxMs   atomic.Int64
+}
+
+func (s *clockSkew) observe(skew time.Duration) {
+	s.clamped.Add(1)
+	ms := skew.Milliseconds()
+	for {
+		current := s.maxMs.Load()
+		if ms <= current || s.maxMs.CompareAndSwap(current, ms) {
+			return
+		}
+	}
+}
+
+// ClockSkewStats reports the clamped history gaps seen so far.
+type ClockSkewStats struct {
+	Clamped int64 `json:"clamped"`
+	MaxMs   int64 `json:"max_skew_ms"`
+}
+
+// recordHistory stamps entry with the wall time, the notification's next
+// sequence number and the request ID ctx carries, and appends it to the
+// history.
+func (n *NotificationHandler) recordHistory(ctx context.Context, notificationID string, entry models.HistoryEntry) error {
+	return n.recordHistories(ctx, []string{notificationID}, []models.HistoryEntry{entry})
+}
+
+// recordHistories is recordHistory for entries[i] of notificationIDs[i],
+// in two round trips however many there are: one for the sequence numbers,
+// one for the entries.
+func (n *NotificationHandler) recordHistories(ctx context.Context, notificationIDs []string, entries []models.HistoryEntry) error {
+	if len(notificationIDs) == 0 {
+		return nil
+	}
+	seqs := make([]*redis.IntCmd, len(notificationIDs))
+	_, err := n.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, notificationID := range notificationIDs {
+			seqs[i] = pipe.Incr(ctx, n.tenantKey(ctx, historySeqKey(notificationID)))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	now := n.clock.Now()
+	requestID := middleware.RequestIDFromContext(ctx)
+	entriesJSON := make([][]byte, len(entries))
+	for i, entry := range entries {
+		entry.Seq = seqs[i].Val()
+		entry.At = now
+		entry.RequestID = requestID
+		if entriesJSON[i], err = json.Marshal(entry); err != nil {
+			return err
+		}
+	}
+	_, err = n.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, notificationID := range notificationIDs {
+			key := n.tenantKey(ctx, historyKey(notificationID))
+			pipe.RPush(ctx, key, entriesJSON[i])
+			pipe.Expire(ctx, key, historyTTL)
+			pipe.Expire(ctx, n.tenantKey(ctx, historySeqKey(notificationID)), historyTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// history reads a notification's history in sequence order and fills in the
+// time since the previous entry. A gap that comes out negative is writer
+// clock skew; it is reported as zero and counted.
+func (n *NotificationHandler) history(ctx context.Context, notificationID string) ([]models.HistoryEntry, error) {
+	raw, err := n.redis.LRange(ctx, n.tenantKey(ctx, historyKey(notificationID)), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.HistoryEntry, 0, len(raw))
+	for _, entryJSON := range raw {
+		var entry models.HistoryEntry
+		if err := json.Unmarshal([]byte(entryJSON), &entry); err != nil {
+			log.Printf("skipping unreadable history entry for %s: %v", notificationID, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	// entries written before sequencing have Seq 0 and keep their list order
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+	for i := 1; i < len(entries); i++ {
+		gap := entries[i].At.Sub(entries[i-1].At)
+		if gap < 0 {
+			n.clockSkew.observe(-gap)
+			entries[i].ClockSkewed = true
+			gap = 0
+		}
+		entries[i].SincePreviousMs = gap.Milliseconds()
+	}
+	return entries, nil
+}
+
+// GetClockSkew reports how often history reads clamped a negative gap
+// between replicas' timestamps.
+func (n *NotificationHandler) GetClockSkew(c *gin.Context) {
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Clock skew retrieved successfully",
+		Data: ClockSkewStats{
+			Clamped: n.clockSkew.clamped.Load(),
+			MaxMs:   n.clockSkew.maxMs.Load(),
+		},
+	})
+}
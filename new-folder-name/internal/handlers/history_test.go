@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_SkewedWriters(t *testing.T) {
+	ctx := context.Background()
+	rdb := setupMockRedis()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// the API replica's clock runs 25ms ahead of the worker replica's
+	api := NewNotificationService(nil, rdb, nil, nil, config.NotificationsConfig{})
+	worker := NewNotificationService(nil, rdb, nil, nil, config.NotificationsConfig{})
+	apiClock := clock.NewFake(base.Add(40 * time.Millisecond))
+	api.SetClock(apiClock)
+	worker.SetClock(clock.NewFake(base.Add(15 * time.Millisecond)))
+
+	require.NoError(t, api.recordHistory(ctx, "n-1", models.HistoryEntry{Action: "created", Status: "queued"}))
+	require.NoError(t, worker.recordHistory(ctx, "n-1", models.HistoryEntry{Action: "delivered", Status: "sent"}))
+	apiClock.Advance(50 * time.Millisecond)
+	require.NoError(t, api.recordHistory(ctx, "n-1", models.HistoryEntry{Action: "opened", Status: "opened"}))
+
+	history, err := api.history(ctx, "n-1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []string{"queued", "sent", "opened"}, []string{history[0].Status, history[1].Status, history[2].Status})
+	assert.Equal(t, []int64{1, 2, 3}, []int64{history[0].Seq, history[1].Seq, history[2].Seq})
+
+	// sent's wall time is 25ms before queued's: clamped and counted
+	assert.True(t, history[1].ClockSkewed)
+	assert.Zero(t, history[1].SincePreviousMs)
+	assert.False(t, history[2].ClockSkewed)
+	assert.Equal(t, int64(75), history[2].SincePreviousMs)
+	assert.Equal(t, int64(1), api.clockSkew.clamped.Load())
+	assert.Equal(t, int64(25), api.clockSkew.maxMs.Load())
+}
+
+func TestHistory_OrderedBySequenceNotListPosition(t *testing.T) {
+	ctx := context.Background()
+	rdb := setupMockRedis()
+	handler := NewNotificationService(nil, rdb, nil, nil, config.NotificationsConfig{})
+
+	// two writers took sequences 2 and 3 but pushed in the opposite order;
+	// the first entry predates sequencing
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, entry := range []models.HistoryEntry{
+		{Action: "created", Status: "queued", At: at},
+		{Seq: 3, Action: "delivered", Status: "sent", At: at.Add(2 * time.Second)},
+		{Seq: 2, Action: "picked_up", Status: "processing", At: at.Add(time.Second)},
+	} {
+		entryJSON, _ := json.Marshal(entry)
+		rdb.RPush(ctx, "notification:history:n-1", entryJSON)
+	}
+
+	history, err := handler.history(ctx, "n-1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []string{"queued", "processing", "sent"}, []string{history[0].Status, history[1].Status, history[2].Status})
+	assert.Equal(t, int64(1000), history[1].SincePreviousMs)
+	assert.Equal(t, int64(1000), history[2].SincePreviousMs)
+	assert.Zero(t, handler.clockSkew.clamped.Load())
+}
+
+func TestGetStatus_IncludeHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	rdb := setupMockRedis()
+	handler := NewNotificationService(nil, rdb, nil, nil, config.NotificationsConfig{})
+	require.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "n-1", Type: "email", Status: "queued"}))
+	require.NoError(t, handler.transitionStatus(ctx, "n-1", "cancelled"))
+	handler.audit(ctx, "n-1", models.HistoryEntry{Action: "rejected", Status: "cancelled", Actor: "reviewer"})
+
+	router := gin.New()
+	router.GET("/status/:id", handler.GetStatus)
+	get := func(path string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp models.APIResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.(map[string]interface{})
+	}
+
+	assert.NotContains(t, get("/status/n-1"), "history")
+
+	data := get("/status/n-1?include=history")
+	assert.Equal(t, "cancelled", data["status"])
+	history := data["history"].([]interface{})
+	require.Len(t, history, 2)
+	assert.Equal(t, "created", history[0].(map[string]interface{})["action"])
+	assert.Equal(t, "rejected", history[1].(map[string]interface{})["action"])
+}
+
+func TestSetDeliveryStatus(t *testing.T) {
+	ctx := context.Background()
+	handler := NewNotificationService(nil, setupMockRedis(), nil, nil, config.NotificationsConfig{})
+	require.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "n-1", Type: "email", Status: "queued"}))
+
+	require.NoError(t, handler.SetDeliveryStatus(ctx, "n-1", "processing"))
+	require.NoError(t, handler.SetDeliveryStatus(ctx, "n-1", "sent"))
+	assert.Error(t, handler.SetDeliveryStatus(ctx, "missing", "sent"))
+
+	history, err := handler.history(ctx, "n-1")
+	require.NoError(t, err)
+	statuses := make([]string, len(history))
+	for i, entry := range history {
+		statuses[i] = entry.Status
+	}
+	assert.Equal(t, []string{"queued", "processing", "sent"}, statuses)
+	assert.Equal(t, "worker", history[2].Actor)
+}
+
+func TestMessagesByCorrelation(t *testing.T) {
+	ctx := context.Background()
+	handler := NewNotificationService(nil, setupMockRedis(), nil, nil, config.NotificationsConfig{})
+	for _, record := range []models.NotificationStatus{
+		{ID: "n-1", Type: "email", Status: "queued", UserID: "user123", TemplateID: "welcome", CorrelationID: "req-1",
+			Variables: map[string]interface{}{"name": "Ada"}},
+		{ID: "n-2", Type: "push", Status: "queued", UserID: "user123", TemplateID: "welcome_push", CorrelationID: "req-1"},
+		{ID: "n-3", Type: "email", Status: "queued", UserID: "user123", TemplateID: "welcome", CorrelationID: "req-2"},
+	} {
+		require.NoError(t, handler.storeNotificationStatus(ctx, record))
+	}
+
+	messages, err := handler.MessagesByCorrelation(ctx, "req-1")
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, []string{"n-1", "n-2"}, []string{messages[0].ID, messages[1].ID})
+	assert.Equal(t, "req-1", messages[0].CorrelationID)
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, messages[0].Variables)
+
+	messages, err = handler.MessagesByCorrelation(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+}
@@ -0,0 +1,63 @@
+package handlers_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedID hands out the same ID every time, so every send repeats the
+// first.
+type fixedID string
+
+func (id fixedID) NewID() string { return string(id) }
+
+func TestSendEmail_ConcurrentRepeatsPublishOnce(t *testing.T) {
+	h := handlertest.NewHarness().WithIDs(fixedID("n-1")).Start(t)
+	const senders = 50
+	responses := make([]*handlertest.Response, senders)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, h.Queue.Emails(), 1, "only the winner of the claim publishes")
+	repeats := 0
+	for _, resp := range responses {
+		require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+		if resp.API().Message == "Notification Already Processed" {
+			repeats++
+			assert.Equal(t, "n-1", resp.NotificationID())
+		}
+	}
+	assert.Equal(t, senders-1, repeats)
+}
+
+func TestSendEmail_IdempotencyRedisDown(t *testing.T) {
+	for _, failOpen := range []bool{true, false} {
+		h := handlertest.NewHarness().
+			WithConfig(config.NotificationsConfig{IdempotencyFailOpen: failOpen}).
+			Start(t)
+		h.Miniredis.Close()
+		resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+		if failOpen {
+			assert.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+			assert.Len(t, h.Queue.Emails(), 1)
+			continue
+		}
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, models.CodeServiceUnavailable, resp.API().Code)
+		assert.Empty(t, h.Queue.Emails())
+	}
+}
@@ -0,0 +1,1268 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// ========== Integration Tests for Notification Handler ==========
+
+// TestIntegration_IdempotencyCheck tests that duplicate notifications are handled correctly
+func TestIntegration_IdempotencyCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+
+	emailReq := models.SendEmailRequest{
+		UserID:     "user-idempotent",
+		TemplateID: "template-idempotent",
+	}
+	body, _ := json.Marshal(emailReq)
+
+	// First request
+	req1, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+	req1.Header.Set("Content-Type", "application/json")
+	w1 := httptest.NewRecorder()
+	router.ServeHTTP(w1, req1)
+
+	assert.Equal(t, http.StatusOK, w1.Code)
+	var resp1 models.APIResponse
+	json.Unmarshal(w1.Body.Bytes(), &resp1)
+
+	// Verify all mocks were called once for first request
+	mockUserService.AssertNumberOfCalls(t, "ValidateUser", 1)
+	mockTemplateService.AssertNumberOfCalls(t, "ValidateTemplate", 1)
+	mockQueue.AssertNumberOfCalls(t, "PublishEmail", 1)
+}
+
+// TestIntegration_MissingRequiredFields tests request validation
+func TestIntegration_MissingRequiredFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+
+	// Request with missing user_id
+	emailReq := map[string]string{
+		"template_id": "template-123",
+	}
+	body, _ := json.Marshal(emailReq)
+	req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.False(t, response.Success)
+}
+
+// TestIntegration_MultipleNotificationsIndependence tests that multiple notifications are independent
+func TestIntegration_MultipleNotificationsIndependence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memoryQueue := queue.NewMemoryClient()
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+
+	handler := NewNotificationService(
+		memoryQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+	router.POST("/api/v1/notification/push", handler.SendPush)
+	router.GET("/api/v1/notification/status/:id", handler.GetStatus)
+
+	// Send email notification
+	emailReq := models.SendEmailRequest{UserID: "user-multi-1", TemplateID: "template-1"}
+	emailBody, _ := json.Marshal(emailReq)
+	emailHttpReq, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(emailBody))
+	emailHttpReq.Header.Set("Content-Type", "application/json")
+	emailW := httptest.NewRecorder()
+	router.ServeHTTP(emailW, emailHttpReq)
+
+	var emailResp models.APIResponse
+	json.Unmarshal(emailW.Body.Bytes(), &emailResp)
+	emailID := emailResp.Data.(map[string]interface{})["notification_id"].(string)
+
+	// Send push notification
+	pushReq := models.SendPushRequest{UserID: "user-multi-2", TemplateID: "template-2"}
+	pushBody, _ := json.Marshal(pushReq)
+	pushHttpReq, _ := http.NewRequest("POST", "/api/v1/notification/push", bytes.NewBuffer(pushBody))
+	pushHttpReq.Header.Set("Content-Type", "application/json")
+	pushW := httptest.NewRecorder()
+	router.ServeHTTP(pushW, pushHttpReq)
+
+	var pushResp models.APIResponse
+	json.Unmarshal(pushW.Body.Bytes(), &pushResp)
+	pushID := pushResp.Data.(map[string]interface{})["notification_id"].(string)
+
+	// Verify they have different IDs
+	assert.NotEqual(t, emailID, pushID)
+
+	// Verify each can be retrieved independently
+	emailStatusReq, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notification/status/%s", emailID), nil)
+	emailStatusW := httptest.NewRecorder()
+	router.ServeHTTP(emailStatusW, emailStatusReq)
+	assert.Equal(t, http.StatusOK, emailStatusW.Code)
+
+	pushStatusReq, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notification/status/%s", pushID), nil)
+	pushStatusW := httptest.NewRecorder()
+	router.ServeHTTP(pushStatusW, pushStatusReq)
+	assert.Equal(t, http.StatusOK, pushStatusW.Code)
+
+	// Verify each went to its own queue
+	emails := memoryQueue.Messages(memoryQueue.EmailQueueName())
+	pushes := memoryQueue.Messages(memoryQueue.PushQueueName())
+	if assert.Len(t, emails, 1) && assert.Len(t, pushes, 1) {
+		assert.Equal(t, emailID, emails[0].ID)
+		assert.Equal(t, "user-multi-1", emails[0].UserID)
+		assert.Equal(t, pushID, pushes[0].ID)
+		assert.Equal(t, "user-multi-2", pushes[0].UserID)
+	}
+}
+
+// TestIntegration_MemoryQueueDelivery tests a notification going from the
+// send endpoint through the in-memory queue to a worker
+func TestIntegration_MemoryQueueDelivery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memoryQueue := queue.NewMemoryClient()
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+
+	handler := NewNotificationService(
+		memoryQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+	emailWorker := queue.NewEmailWorker(queue.LoopbackEmailSender{}, handler)
+	assert.NoError(t, memoryQueue.Subscribe(memoryQueue.EmailQueueName(), emailWorker.Handle))
+	defer memoryQueue.Close()
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+	router.GET("/api/v1/notification/status/:id", handler.GetStatus)
+
+	body, _ := json.Marshal(models.SendEmailRequest{UserID: "user-memory", TemplateID: "template-memory"})
+	req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	notificationID := resp.Data.(map[string]interface{})["notification_id"].(string)
+
+	// Verify the worker took it to sent
+	assert.Eventually(t, func() bool {
+		statusReq, _ := http.NewRequest("GET", "/api/v1/notification/status/"+notificationID, nil)
+		statusW := httptest.NewRecorder()
+		router.ServeHTTP(statusW, statusReq)
+		var statusResp models.APIResponse
+		json.Unmarshal(statusW.Body.Bytes(), &statusResp)
+		status, _ := statusResp.Data.(map[string]interface{})
+		return status["status"] == "sent"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// TestIntegration_RedisConnectionFailure tests handling of Redis connection issues
+func TestIntegration_RedisConnectionFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockRedis.Close() // Close Redis to simulate connection failure
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, "user-redis-fail").Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "template-redis-fail").Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		// the default: send anyway when Redis can't be asked
+		config.NotificationsConfig{IdempotencyFailOpen: true},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+
+	emailReq := models.SendEmailRequest{
+		UserID:     "user-redis-fail",
+		TemplateID: "template-redis-fail",
+	}
+	body, _ := json.Marshal(emailReq)
+	req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The request might still succeed but Redis operations might fail
+	// This depends on how the handler manages error scenarios
+	assert.True(t, w.Code == http.StatusOK || w.Code == http.StatusInternalServerError)
+}
+
+// TestIntegration_ConcurrentRequests tests handling of concurrent notification requests
+func TestIntegration_ConcurrentRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+
+	// Simulate 5 concurrent requests
+	numRequests := 5
+	results := make(chan int, numRequests)
+	notificationIDs := make([]string, numRequests)
+
+	for i := 0; i < numRequests; i++ {
+		go func(index int) {
+			emailReq := models.SendEmailRequest{
+				UserID:     fmt.Sprintf("concurrent-user-%d", index),
+				TemplateID: fmt.Sprintf("concurrent-template-%d", index),
+			}
+			body, _ := json.Marshal(emailReq)
+			req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response models.APIResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			id := response.Data.(map[string]interface{})["notification_id"].(string)
+			notificationIDs[index] = id
+			results <- w.Code
+		}(i)
+	}
+
+	// Collect results
+	for i := 0; i < numRequests; i++ {
+		code := <-results
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	// Verify all notification IDs are unique
+	idMap := make(map[string]bool)
+	for _, id := range notificationIDs {
+		assert.False(t, idMap[id], "Duplicate notification ID found")
+		idMap[id] = true
+	}
+}
+
+// TestIntegration_TopicPushFullFlow tests broadcasting a push notification to a topic
+func TestIntegration_TopicPushFullFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "maintenance-window").Return(true, nil)
+	mockQueue.On("PublishPushNot", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+		return msg.Type == "push_topic" && msg.Topic == "maintenance" && msg.UserID == "" &&
+			msg.Variables["starts_at"] == "02:00"
+	})).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/push/topic", handler.SendTopicPush)
+	router.GET("/api/v1/notification/status/:id", handler.GetStatus)
+
+	body, _ := json.Marshal(models.SendTopicPushRequest{
+		Topic:      "maintenance",
+		TemplateID: "maintenance-window",
+		Variables:  map[string]interface{}{"starts_at": "02:00"},
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/notification/push/topic", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.True(t, response.Success)
+	notificationID := response.Data.(map[string]interface{})["notification_id"].(string)
+
+	// Status tracking works the same as for individual pushes
+	statusReq, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notification/status/%s", notificationID), nil)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, statusReq)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	var statusResponse models.APIResponse
+	json.Unmarshal(w2.Body.Bytes(), &statusResponse)
+	statusData := statusResponse.Data.(map[string]interface{})
+	assert.Equal(t, "push_topic", statusData["type"])
+	assert.Equal(t, "maintenance", statusData["topic"])
+
+	// Broadcasts never validate a user
+	mockUserService.AssertNotCalled(t, "ValidateUser", mock.Anything, mock.Anything)
+	mockTemplateService.AssertExpectations(t)
+	mockQueue.AssertExpectations(t)
+}
+
+// TestIntegration_TopicPushValidation tests the topic allowlist and template validation
+func TestIntegration_TopicPushValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		pattern  string
+		topic    string
+		template bool
+	}{
+		{"topic outside default pattern", "", "Maintenance Window!", true},
+		{"topic outside configured allowlist", "^(maintenance|outage)$", "promo", true},
+		{"invalid template", "", "maintenance", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQueue := new(MockRabbitMQClient)
+			mockTemplateService := new(MockTemplateService)
+			mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(tt.template, nil)
+
+			handler := NewNotificationService(
+				mockQueue,
+				setupMockRedis(),
+				new(MockUserService),
+				mockTemplateService,
+				config.NotificationsConfig{TopicPattern: tt.pattern},
+			)
+
+			router := gin.New()
+			router.POST("/api/v1/notification/push/topic", handler.SendTopicPush)
+
+			body, _ := json.Marshal(models.SendTopicPushRequest{Topic: tt.topic, TemplateID: "maintenance-window"})
+			req, _ := http.NewRequest("POST", "/api/v1/notification/push/topic", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockQueue.AssertNotCalled(t, "PublishPushNot", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+// TestIntegration_StatusHotCache tests that status reads are served from the
+// in-process cache and that local writes invalidate it
+func TestIntegration_StatusHotCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+
+	handler := NewNotificationService(
+		new(MockRabbitMQClient),
+		mockRedis,
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{StatusCacheSize: 100, StatusCacheTTL: time.Minute},
+	)
+
+	router := gin.New()
+	router.GET("/api/v1/notification/status/:id", handler.GetStatus)
+
+	readStatus := func() string {
+		req, _ := http.NewRequest("GET", "/api/v1/notification/status/cached-id", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data.(map[string]interface{})["status"].(string)
+	}
+
+	ctx := context.Background()
+	err := handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "cached-id", Type: "email", Status: "queued"})
+	assert.NoError(t, err)
+	assert.Equal(t, "queued", readStatus())
+
+	// A write behind our back (another replica) is hidden until the TTL lapses
+	other, _ := json.Marshal(models.NotificationStatus{ID: "cached-id", Type: "email", Status: "processing"})
+	mockRedis.Set(ctx, "notification:status:cached-id", other, time.Hour)
+	assert.Equal(t, "queued", readStatus())
+
+	// A local write invalidates immediately
+	err = handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "cached-id", Type: "email", Status: "sent"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sent", readStatus())
+
+	stats := handler.hotCache.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+// TestIntegration_PurgeNotification tests that an admin purge removes every key for a notification
+func TestIntegration_PurgeNotification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+
+	handler := NewNotificationService(
+		new(MockRabbitMQClient),
+		mockRedis,
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{StatusCacheSize: 100, StatusCacheTTL: time.Minute},
+	)
+
+	router := gin.New()
+	admin := router.Group("/api/v1/admin")
+	admin.Use(middleware.AdminMiddleware(testAuth.JWTSecret))
+	admin.DELETE("/notification/:id", handler.PurgeNotification)
+
+	purge := func(id, token string) (int, models.APIResponse) {
+		req, _ := http.NewRequest("DELETE", "/api/v1/admin/notification/"+id, nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	ctx := context.Background()
+	err := handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "purge-me", UserID: "user123", Type: "email", Status: "sent"})
+	assert.NoError(t, err)
+	mockRedis.Set(ctx, "notification:idempotency:purge-me", "processing", time.Hour)
+	mockRedis.RPush(ctx, "notification:history:purge-me", "queued", "sent")
+	// storing the status indexed it under its user already
+	mockRedis.ZAdd(ctx, "notification:index:user:user123", redis.Z{Score: 1, Member: "other-id"})
+
+	// Only admin-scoped tokens may purge; a regular service token is refused
+	code, _ := purge("purge-me", signedToken(jwt.MapClaims{"sub": "billing-service"}))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = purge("purge-me", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	adminToken := signedToken(jwt.MapClaims{"sub": "support-console", "scope": middleware.AdminScope})
+	code, response := purge("purge-me", adminToken)
+	assert.Equal(t, http.StatusOK, code)
+	data := response.Data.(map[string]interface{})
+	assert.Equal(t, float64(4), data["keys_removed"])
+	assert.Equal(t, float64(1), data["index_entries_removed"])
+
+	for _, key := range []string{"notification:status:purge-me", "notification:idempotency:purge-me", "notification:history:purge-me", "notification:history:purge-me:seq"} {
+		exists, _ := mockRedis.Exists(ctx, key).Result()
+		assert.Zero(t, exists, key)
+	}
+	index, _ := mockRedis.ZRange(ctx, "notification:index:user:user123", 0, -1).Result()
+	assert.Equal(t, []string{"other-id"}, index)
+
+	// A second purge finds nothing
+	code, _ = purge("purge-me", adminToken)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// namedQueueClient is a queue mock that also names its queues
+type namedQueueClient struct {
+	MockRabbitMQClient
+}
+
+func (m *namedQueueClient) EmailQueueName() string    { return "email.queue" }
+func (m *namedQueueClient) PushQueueName() string     { return "push.queue" }
+func (m *namedQueueClient) WhatsAppQueueName() string { return "whatsapp.queue" }
+
+// TestIntegration_StatusAttempts tests the queue and attempt fields on the status record
+func TestIntegration_StatusAttempts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(namedQueueClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "welcome_email").Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(mockQueue, mockRedis, mockUserService, mockTemplateService, config.NotificationsConfig{})
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+	// queue and last_error are internal fields
+	router.GET("/api/v1/notification/status/:id", middleware.AuthMiddleware(testAuth.JWTSecret), handler.GetStatus)
+	token := signedToken(jwt.MapClaims{"sub": "ops", "scope": middleware.InternalScope})
+
+	readStatus := func(id string) map[string]interface{} {
+		req, _ := http.NewRequest("GET", "/api/v1/notification/status/"+id, nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data.(map[string]interface{})
+	}
+
+	body, _ := json.Marshal(models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	notificationID := response.Data.(map[string]interface{})["notification_id"].(string)
+
+	status := readStatus(notificationID)
+	assert.Equal(t, "email.queue", status["queue"])
+	assert.Equal(t, float64(0), status["attempts"])
+	assert.Nil(t, status["last_attempt_at"])
+
+	ctx := context.Background()
+	assert.NoError(t, handler.RecordAttempt(ctx, notificationID, fmt.Errorf("smtp timeout")))
+	assert.NoError(t, handler.RecordAttempt(ctx, notificationID, nil))
+	status = readStatus(notificationID)
+	assert.Equal(t, float64(2), status["attempts"])
+	assert.NotNil(t, status["last_attempt_at"])
+	assert.Nil(t, status["last_error"])
+
+	// A record written before these fields existed still parses
+	legacy := `{"id":"legacy-id","type":"email","status":"queued","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}`
+	mockRedis.Set(ctx, "notification:status:legacy-id", legacy, time.Hour)
+	status = readStatus("legacy-id")
+	assert.Equal(t, "queued", status["status"])
+	assert.Equal(t, float64(0), status["attempts"])
+
+	assert.Error(t, handler.RecordAttempt(ctx, "missing-id", nil))
+}
+
+// TestIntegration_PatchScheduledNotification tests changing a notification before dispatch
+func TestIntegration_PatchScheduledNotification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+
+	handler := NewNotificationService(
+		new(MockRabbitMQClient),
+		mockRedis,
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.PATCH("/api/v1/notification/:id", handler.PatchNotification)
+
+	patch := func(id string, body string) (int, models.APIResponse) {
+		req, _ := http.NewRequest("PATCH", "/api/v1/notification/"+id, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	ctx := context.Background()
+	sendAt := time.Now().Add(time.Hour).UTC()
+	assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{
+		ID:           "scheduled-id",
+		Type:         "email",
+		Status:       "scheduled",
+		ScheduledFor: &sendAt,
+		Variables:    map[string]interface{}{"name": "Ada"},
+		Priority:     "normal",
+	}))
+	assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "queued-id", Type: "email", Status: "queued"}))
+
+	later := time.Now().Add(3 * time.Hour).UTC().Truncate(time.Second)
+	code, _ := patch("scheduled-id", fmt.Sprintf(`{"scheduled_for":%q,"priority":"high"}`, later.Format(time.RFC3339)))
+	assert.Equal(t, http.StatusOK, code)
+
+	// Fields absent from the body are left alone
+	statusJSON, _ := mockRedis.Get(ctx, "notification:status:scheduled-id").Result()
+	var stored models.NotificationStatus
+	json.Unmarshal([]byte(statusJSON), &stored)
+	assert.True(t, later.Equal(*stored.ScheduledFor))
+	assert.Equal(t, "high", stored.Priority)
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, stored.Variables)
+	ttl, _ := mockRedis.TTL(ctx, "notification:status:scheduled-id").Result()
+	assert.True(t, ttl > 0)
+
+	code, _ = patch("queued-id", `{"priority":"high"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = patch("missing-id", `{"priority":"high"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = patch("scheduled-id", `{"priority":"urgent"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = patch("scheduled-id", fmt.Sprintf(`{"scheduled_for":%q}`, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)))
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = patch("scheduled-id", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestIntegration_Resend tests re-publishing a completed notification under a new ID
+func TestIntegration_Resend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "welcome_email").Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+		return msg.ID != "sent-id" && msg.UserID == "user123" && msg.TemplateID == "welcome_email" &&
+			msg.Variables["name"] == "Ada" && msg.Locale == "fr"
+	})).Return(nil).Once()
+
+	handler := NewNotificationService(mockQueue, mockRedis, mockUserService, mockTemplateService, config.NotificationsConfig{})
+
+	// Registered alongside the static send routes, as in main
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+	router.POST("/api/v1/notification/push/topic", handler.SendTopicPush)
+	router.POST("/api/v1/notification/:id/resend", handler.Resend)
+
+	resend := func(id string) (int, models.APIResponse) {
+		req, _ := http.NewRequest("POST", "/api/v1/notification/"+id+"/resend", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	ctx := context.Background()
+	original := models.NotificationStatus{
+		ID:         "sent-id",
+		UserID:     "user123",
+		TemplateID: "welcome_email",
+		Variables:  map[string]interface{}{"name": "Ada"},
+		Type:       "email",
+		Status:     "sent",
+		Locale:     "fr",
+	}
+	assert.NoError(t, handler.storeNotificationStatus(ctx, original))
+	originalJSON, _ := mockRedis.Get(ctx, "notification:status:sent-id").Result()
+	assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{
+		ID: "queued-id", UserID: "user123", TemplateID: "welcome_email", Type: "email", Status: "queued",
+	}))
+
+	code, response := resend("sent-id")
+	assert.Equal(t, http.StatusOK, code)
+	mockQueue.AssertExpectations(t)
+
+	newID := response.Data.(map[string]interface{})["notification_id"].(string)
+	assert.NotEqual(t, "sent-id", newID)
+
+	statusJSON, _ := mockRedis.Get(ctx, "notification:status:"+newID).Result()
+	var resent models.NotificationStatus
+	json.Unmarshal([]byte(statusJSON), &resent)
+	assert.Equal(t, "sent-id", resent.ResentFrom)
+	assert.Equal(t, "queued", resent.Status)
+
+	// The original record is untouched
+	after, _ := mockRedis.Get(ctx, "notification:status:sent-id").Result()
+	assert.Equal(t, originalJSON, after)
+
+	code, _ = resend("queued-id")
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = resend("missing-id")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// readEvent reads the next server-sent event from the stream
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended early: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return event, data
+		case strings.HasPrefix(line, "event:"):
+			event = line[len("event:"):]
+		case strings.HasPrefix(line, "data:"):
+			data = line[len("data:"):]
+		}
+	}
+}
+
+// TestIntegration_StatusStream tests the server-sent events status stream
+func TestIntegration_StatusStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+
+	handler := NewNotificationService(
+		new(MockRabbitMQClient),
+		mockRedis,
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{StatusStreamMaxDuration: time.Second},
+	)
+	handler.streamHeartbeat = 100 * time.Millisecond
+
+	router := gin.New()
+	router.GET("/api/v1/notification/status/:id/stream", handler.StreamStatus)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx := context.Background()
+	store := func(status string) {
+		assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{ID: "stream-id", Type: "email", Status: status}))
+	}
+	open := func(id string) (*http.Response, *bufio.Reader) {
+		resp, err := http.Get(server.URL + "/api/v1/notification/status/" + id + "/stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	subscribers := func() int64 {
+		counts, _ := mockRedis.PubSubNumSub(ctx, statusChannel("stream-id")).Result()
+		return counts[statusChannel("stream-id")]
+	}
+
+	t.Run("follows updates until a terminal status", func(t *testing.T) {
+		store("queued")
+		resp, r := open("stream-id")
+		defer resp.Body.Close()
+		assert.Contains(t, resp.Header.Get("Content-Type"), "text/event-stream")
+
+		event, data := readEvent(t, r)
+		assert.Equal(t, "status", event)
+		assert.Contains(t, data, `"status":"queued"`)
+
+		store("processing")
+		event, data = readEvent(t, r)
+		assert.Equal(t, "status", event)
+		assert.Contains(t, data, `"status":"processing"`)
+
+		// Idle streams are kept alive
+		event, _ = readEvent(t, r)
+		assert.Equal(t, "heartbeat", event)
+
+		store("sent")
+		for event, data = readEvent(t, r); event == "heartbeat"; event, data = readEvent(t, r) {
+		}
+		assert.Contains(t, data, `"status":"sent"`)
+		event, data = readEvent(t, r)
+		assert.Equal(t, "end", event)
+		assert.Contains(t, data, "terminal")
+	})
+
+	t.Run("ends after the max duration", func(t *testing.T) {
+		store("queued")
+		resp, r := open("stream-id")
+		defer resp.Body.Close()
+
+		event, data := readEvent(t, r)
+		for ; event != "end"; event, data = readEvent(t, r) {
+		}
+		assert.Contains(t, data, "max_duration")
+	})
+
+	t.Run("client disconnect drops the subscription", func(t *testing.T) {
+		store("queued")
+		resp, r := open("stream-id")
+		readEvent(t, r)
+		assert.Equal(t, int64(1), subscribers())
+
+		resp.Body.Close()
+		assert.Eventually(t, func() bool { return subscribers() == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("unknown notification", func(t *testing.T) {
+		resp, _ := open("missing-id")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+// TestIntegration_Snooze tests snoozing a notification as its recipient
+func TestIntegration_Snooze(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+
+	queue := new(delayingQueue)
+	queue.On("PublishDelayed", mock.Anything, "push.queue", mock.Anything, mock.Anything).Return(nil)
+	handler := NewNotificationService(
+		queue,
+		mockRedis,
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{MaxSnoozes: 2},
+	)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(middleware.AuthMiddleware(testAuth.JWTSecret))
+	api.POST("/notification/:id/snooze", handler.Snooze)
+
+	recipient := signedToken(jwt.MapClaims{"user_id": "user123"})
+	snooze := func(id, token, body string) (int, models.APIResponse) {
+		req, _ := http.NewRequest("POST", "/api/v1/notification/"+id+"/snooze", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	load := func(id string) models.NotificationStatus {
+		statusJSON, _ := mockRedis.Get(context.Background(), "notification:status:"+id).Result()
+		var status models.NotificationStatus
+		json.Unmarshal([]byte(statusJSON), &status)
+		return status
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{
+		ID: "remind-me", UserID: "user123", TemplateID: "task_due", Type: "push", Status: "sent",
+		Variables: map[string]interface{}{"task": "expenses"},
+		Delivery:  &models.Delivery{DeviceTokens: []string{"device-1"}, Platform: "ios"},
+	}))
+	assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{
+		ID: "gone", UserID: "user123", TemplateID: "task_due", Type: "push", Status: "expired",
+	}))
+
+	code, response := snooze("remind-me", recipient, `{"duration":"2h"}`)
+	assert.Equal(t, http.StatusOK, code)
+	cloneID := response.Data.(map[string]interface{})["notification_id"].(string)
+	assert.NotEqual(t, "remind-me", cloneID)
+
+	clone := load(cloneID)
+	assert.Equal(t, "remind-me", clone.ParentID)
+	assert.Equal(t, "scheduled", clone.Status)
+	assert.Equal(t, "task_due", clone.TemplateID)
+	assert.Equal(t, map[string]interface{}{"task": "expenses"}, clone.Variables)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), *clone.ScheduledFor, time.Minute)
+	assert.Equal(t, &models.Delivery{DeviceTokens: []string{"device-1"}, Platform: "ios"}, clone.Delivery)
+	// kept until a day after it is due, and written like any new notification
+	assert.Greater(t, mockRedis.TTL(ctx, "notification:status:"+cloneID).Val(), 24*time.Hour)
+	history, err := handler.history(ctx, cloneID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "created", history[0].Action)
+	}
+
+	// the reminder is held on the broker until it is due
+	queue.AssertNumberOfCalls(t, "PublishDelayed", 1)
+	published := queue.Calls[0].Arguments
+	message := published.Get(2).(models.NotificationMessage)
+	assert.Equal(t, cloneID, message.ID)
+	assert.Equal(t, "task_due", message.TemplateID)
+	assert.Equal(t, map[string]interface{}{"task": "expenses"}, message.Variables)
+	assert.Equal(t, []string{"device-1"}, message.DeviceTokens)
+	assert.Equal(t, "ios", message.Platform)
+	assert.InDelta(t, 2*time.Hour, published.Get(3).(time.Duration), float64(time.Minute))
+	assert.Equal(t, "push.queue", clone.Queue)
+
+	original := load("remind-me")
+	assert.Equal(t, "sent", original.Status)
+	assert.Equal(t, 1, original.SnoozeCount)
+	assert.True(t, clone.ScheduledFor.Equal(*original.SnoozedUntil))
+
+	// The limit is per notification
+	code, _ = snooze("remind-me", recipient, fmt.Sprintf(`{"until":%q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339)))
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = snooze("remind-me", recipient, `{"duration":"2h"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	queue.AssertNumberOfCalls(t, "PublishDelayed", 2)
+
+	code, _ = snooze("gone", recipient, `{"duration":"2h"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	// Someone else's notification looks like it does not exist
+	code, _ = snooze("gone", signedToken(jwt.MapClaims{"user_id": "user456"}), `{"duration":"2h"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	for _, body := range []string{`{}`, `{"duration":"-1h"}`, `{"duration":"9999h"}`, `{"duration":"1h","until":"2030-01-01T00:00:00Z"}`} {
+		code, _ = snooze("remind-me", recipient, body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+}
+
+// TestIntegration_SnoozeNotQueued tests that a snooze whose reminder
+// can't be queued is taken back
+func TestIntegration_SnoozeNotQueued(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+
+	queue := new(delayingQueue)
+	queue.On("PublishDelayed", mock.Anything, "push.queue", mock.Anything, mock.Anything).Return(errors.New("broker unavailable"))
+	handler := NewNotificationService(
+		queue,
+		mockRedis,
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{MaxSnoozes: 1},
+	)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(middleware.AuthMiddleware(testAuth.JWTSecret))
+	api.POST("/notification/:id/snooze", handler.Snooze)
+
+	ctx := context.Background()
+	assert.NoError(t, handler.storeNotificationStatus(ctx, models.NotificationStatus{
+		ID: "remind-me", UserID: "user123", TemplateID: "task_due", Type: "push", Status: "sent",
+	}))
+
+	req, _ := http.NewRequest("POST", "/api/v1/notification/remind-me/snooze", bytes.NewBufferString(`{"duration":"2h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", signedToken(jwt.MapClaims{"user_id": "user123"}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	statusJSON, err := mockRedis.Get(ctx, "notification:status:remind-me").Result()
+	assert.NoError(t, err)
+	var original models.NotificationStatus
+	assert.NoError(t, json.Unmarshal([]byte(statusJSON), &original))
+	assert.Zero(t, original.SnoozeCount, "the snooze is given back")
+	assert.Nil(t, original.SnoozedUntil)
+}
+
+// testAuth is the auth config the routers under test authenticate with.
+var testAuth = config.AuthConfig{JWTSecret: "integration-test-secret"}
+
+// signedToken returns an Authorization header value accepted by AuthMiddleware
+func signedToken(claims jwt.MapClaims) string {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testAuth.JWTSecret))
+	return "Bearer " + token
+}
+
+// TestIntegration_StatusAccessControl tests that callers only read the notifications they created
+func TestIntegration_StatusAccessControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owner := signedToken(jwt.MapClaims{"sub": "billing-service"})
+	other := signedToken(jwt.MapClaims{"sub": "marketing-service"})
+	admin := signedToken(jwt.MapClaims{"sub": "support-console", "scope": "notifications:read:all"})
+
+	setup := func(cfg config.NotificationsConfig) (*gin.Engine, *redis.Client) {
+		mockQueue := new(MockRabbitMQClient)
+		mockRedis := setupMockRedis()
+		mockUserService := new(MockUserService)
+		mockTemplateService := new(MockTemplateService)
+
+		mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+		mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+		mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+		handler := NewNotificationService(
+			mockQueue,
+			mockRedis,
+			mockUserService,
+			mockTemplateService,
+			cfg,
+		)
+
+		router := gin.New()
+		api := router.Group("/api/v1")
+		api.Use(middleware.AuthMiddleware(testAuth.JWTSecret))
+		api.POST("/notification/email", handler.SendEmail)
+		api.GET("/notification/status/:id", handler.GetStatus)
+		return router, mockRedis
+	}
+
+	send := func(router *gin.Engine, token string) string {
+		body, _ := json.Marshal(models.SendEmailRequest{UserID: "user-acl", TemplateID: "template-acl"})
+		req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data.(map[string]interface{})["notification_id"].(string)
+	}
+
+	read := func(router *gin.Engine, token, id string) int {
+		req, _ := http.NewRequest("GET", "/api/v1/notification/status/"+id, nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("owner can read", func(t *testing.T) {
+		router, _ := setup(config.NotificationsConfig{})
+		id := send(router, owner)
+		assert.Equal(t, http.StatusOK, read(router, owner, id))
+	})
+
+	t.Run("other caller gets not found", func(t *testing.T) {
+		router, _ := setup(config.NotificationsConfig{})
+		id := send(router, owner)
+		assert.Equal(t, http.StatusNotFound, read(router, other, id))
+	})
+
+	t.Run("read-all scope can read anything", func(t *testing.T) {
+		router, _ := setup(config.NotificationsConfig{})
+		id := send(router, owner)
+		assert.Equal(t, http.StatusOK, read(router, admin, id))
+	})
+
+	t.Run("legacy records", func(t *testing.T) {
+		legacy, _ := json.Marshal(models.NotificationStatus{ID: "legacy-id", Type: "email", Status: "queued"})
+
+		router, rdb := setup(config.NotificationsConfig{})
+		rdb.Set(context.Background(), "notification:status:legacy-id", legacy, time.Hour)
+		assert.Equal(t, http.StatusOK, read(router, other, "legacy-id"))
+
+		router, rdb = setup(config.NotificationsConfig{LegacyStatusReadAllOnly: true})
+		rdb.Set(context.Background(), "notification:status:legacy-id", legacy, time.Hour)
+		assert.Equal(t, http.StatusNotFound, read(router, other, "legacy-id"))
+		assert.Equal(t, http.StatusOK, read(router, admin, "legacy-id"))
+	})
+}
+
+// ========== Benchmarks ==========
+
+// BenchmarkEmailNotificationSend benchmarks email notification performance
+func BenchmarkEmailNotificationSend(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+
+	emailReq := models.SendEmailRequest{
+		UserID:     "bench-user",
+		TemplateID: "bench-template",
+	}
+	body, _ := json.Marshal(emailReq)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkGetNotificationStatusRedisLoad compares the Redis commands issued
+// per status poll with and without the hot cache
+func BenchmarkGetNotificationStatusRedisLoad(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	for _, size := range []int{0, 1000} {
+		b.Run(fmt.Sprintf("cache_size=%d", size), func(b *testing.B) {
+			s, err := miniredis.Run()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer s.Close()
+			rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			defer rdb.Close()
+
+			handler := NewNotificationService(
+				new(MockRabbitMQClient),
+				rdb,
+				new(MockUserService),
+				new(MockTemplateService),
+				config.NotificationsConfig{StatusCacheSize: size, StatusCacheTTL: time.Minute},
+			)
+			handler.storeNotificationStatus(context.Background(), models.NotificationStatus{ID: "bench-notif-id", Type: "email", Status: "queued"})
+
+			router := gin.New()
+			router.GET("/api/v1/notification/status/:id", handler.GetStatus)
+
+			before := s.CommandCount()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, _ := http.NewRequest("GET", "/api/v1/notification/status/bench-notif-id", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+			}
+			b.ReportMetric(float64(s.CommandCount()-before)/float64(b.N), "redis-cmds/op")
+		})
+	}
+}
+
+// BenchmarkGetNotificationStatus benchmarks status retrieval performance
+func BenchmarkGetNotificationStatus(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	defer mockRedis.Close()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	// Create a test notification first
+	statusData := models.NotificationStatus{
+		ID:        "bench-notif-id",
+		Type:      "email",
+		Status:    "queued",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	statusJSON, _ := json.Marshal(statusData)
+	mockRedis.Set(context.Background(), "notification:status:bench-notif-id", statusJSON, 24*time.Hour)
+
+	router := gin.New()
+	router.GET("/api/v1/notification/status/:id", handler.GetStatus)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest("GET", "/api/v1/notification/status/bench-notif-id", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+}
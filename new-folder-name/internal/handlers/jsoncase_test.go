@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rawJSON(t *testing.T, resp *handlertest.Response) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body, &body), "%s", resp.Body)
+	return body
+}
+
+func TestJSONCase_CamelRequestsBind(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	resp := h.POST("/api/v1/notification/email", map[string]interface{}{
+		"userId":     "user123",
+		"templateId": "welcome_email",
+		"variables":  map[string]interface{}{"firstName": "Ada", "order_ref": map[string]interface{}{"lineItem": 1}},
+		"metadata":   map[string]string{"invoiceId": "inv-1"},
+	})
+	require.Equal(t, http.StatusOK, resp.Code, "%s", resp.Body)
+	assert.Contains(t, rawJSON(t, resp)["data"], "notification_id", "snake_case by default")
+
+	emails := h.Queue.Emails()
+	require.Len(t, emails, 1)
+	assert.Equal(t, "user123", emails[0].UserID)
+	assert.Equal(t, map[string]interface{}{"firstName": "Ada", "order_ref": map[string]interface{}{"lineItem": float64(1)}}, emails[0].Variables)
+	assert.Equal(t, map[string]string{"invoiceId": "inv-1"}, emails[0].Metadata)
+}
+
+func TestJSONCase_HeaderNegotiated(t *testing.T) {
+	h := handlertest.NewHarness().WithHeader(middleware.JSONCaseHeader, "camel").Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{
+		UserID:     "user123",
+		TemplateID: "welcome_email",
+		Variables:  map[string]interface{}{"first_name": "Ada"},
+	})
+	require.Equal(t, http.StatusOK, resp.Code)
+	body := rawJSON(t, resp)
+	assert.Contains(t, body, "requestId")
+	data := body["data"].(map[string]interface{})
+	require.Contains(t, data, "notificationId")
+	id := data["notificationId"].(string)
+
+	status := rawJSON(t, h.GET("/api/v1/notification/status/"+id))["data"].(map[string]interface{})
+	assert.Equal(t, "user123", status["userId"])
+	assert.Equal(t, map[string]interface{}{"first_name": "Ada"}, status["variables"])
+
+	resp = h.POST("/api/v1/notification/email", map[string]string{"templateId": "welcome_email"})
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, rawJSON(t, resp), "requestId", "errors too")
+
+	require.NoError(t, h.Handler.SetDeliveryStatus(context.Background(), id, "sent"))
+	stream := string(h.GET("/api/v1/notification/status/" + id + "/stream").Body)
+	assert.Contains(t, stream, `"userId":"user123"`, "status events too")
+	assert.Contains(t, stream, `"first_name":"Ada"`)
+}
+
+func TestJSONCase_ConfiguredClients(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{JSONCase: config.JSONCaseConfig{CamelClients: []string{handlertest.DefaultCaller}}}).
+		Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, rawJSON(t, resp)["data"], "notificationId")
+
+	h.WithHeader(middleware.JSONCaseHeader, "snake")
+	resp = h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	assert.True(t, strings.Contains(string(resp.Body), `"notification_id"`), "the header wins over the config")
+}
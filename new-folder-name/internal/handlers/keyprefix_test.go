@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/idgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyPrefix_Isolation(t *testing.T) {
+	server := miniredis.RunT(t)
+	start := func(prefix string) *handlertest.Harness {
+		// the same ID sequence in both, so they hand out the same IDs
+		return handlertest.NewHarness().
+			WithMiniredis(server).
+			WithKeyPrefix(prefix).
+			WithIDs(idgen.NewSequence()).
+			WithConfig(config.NotificationsConfig{DedupeWindow: time.Hour, OutboxMaxLength: 10}).
+			Start(t)
+	}
+	staging, production := start("staging:"), start("production:")
+
+	var ids []string
+	for _, h := range []*handlertest.Harness{staging, production} {
+		resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+		require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+		assert.Equal(t, "Email notification queued successfully", resp.API().Message,
+			"neither sees the other's idempotency mark or dedupe claim")
+		ids = append(ids, resp.NotificationID())
+	}
+	require.Equal(t, ids[0], ids[1])
+	assert.Len(t, staging.Queue.Emails(), 1)
+	assert.Len(t, production.Queue.Emails(), 1)
+
+	// each reads its own record of the shared ID
+	require.True(t, server.Del("production:notification:status:"+ids[0]))
+	assert.Equal(t, http.StatusOK, staging.GET("/api/v1/notification/status/"+ids[0]).Code)
+	assert.Equal(t, http.StatusNotFound, production.GET("/api/v1/notification/status/"+ids[0]).Code)
+
+	// and flushes only its own outbox
+	staging.Queue.Err = queue.ErrNotConnected
+	resp := staging.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "welcome_push"})
+	require.Equal(t, http.StatusAccepted, resp.Code, string(resp.Body))
+	depth, err := production.Handler.OutboxDepth(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, depth["push"])
+	assert.Zero(t, production.Handler.FlushOutbox(context.Background()))
+	assert.Empty(t, production.Queue.Pushes())
+	staging.Queue.Err = nil
+	assert.Equal(t, 1, staging.Handler.FlushOutbox(context.Background()))
+
+	for _, key := range server.Keys() {
+		assert.True(t, strings.HasPrefix(key, "staging:") || strings.HasPrefix(key, "production:"), key)
+	}
+}
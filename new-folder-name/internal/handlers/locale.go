@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"golang.org/x/text/language"
+)
+
+const defaultLocale = "en"
+
+// LocaleResolver is implemented by user service clients that can report a
+// user's preferred locale. It is optional; without it the configured default
+// locale is used.
+type LocaleResolver interface {
+	GetPreferredLocale(ctx context.Context, userID string) (string, error)
+}
+
+// resolveLocale picks the template locale: the requested one, else the
+// user's preferred one, else the configured default. The user's record the
+// send looked up, if any, is used rather than asking again. Tags are returned in
+// canonical form.
+func (n *NotificationHandler) resolveLocale(ctx context.Context, requested, userID string) string {
+	if requested != "" {
+		if tag, err := language.Parse(requested); err == nil {
+			return tag.String()
+		}
+	}
+	if user := userFromContext(ctx, userID); user != nil {
+		if tag, err := language.Parse(user.Locale); user.Locale != "" && err == nil {
+			return tag.String()
+		}
+	} else if resolver, ok := n.userService.(LocaleResolver); ok {
+		preferred, err := resolver.GetPreferredLocale(ctx, userID)
+		if err != nil {
+			log.Printf("failed to fetch preferred locale for %s: %v", userID, err)
+		} else if tag, err := language.Parse(preferred); preferred != "" && err == nil {
+			return tag.String()
+		}
+	}
+	if n.cfg.DefaultLocale != "" {
+		return n.cfg.DefaultLocale
+	}
+	return defaultLocale
+}
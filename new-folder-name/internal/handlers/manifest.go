@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/franzego/stage04/internal/manifest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ManifestHandler reports which templates of the deployment's template
+// manifest the template service has.
+type ManifestHandler struct {
+	status *manifest.Status
+}
+
+// NewManifestHandler takes the manifest's status, nil when no manifest is
+// configured.
+func NewManifestHandler(status *manifest.Status) *ManifestHandler {
+	return &ManifestHandler{status: status}
+}
+
+// GetStatus returns the outcome of the startup warm-up. With refresh=true
+// the missing templates are fetched again first.
+func (h *ManifestHandler) GetStatus(c *gin.Context) {
+	if h.status == nil {
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "No template manifest is configured",
+		})
+		return
+	}
+	report := h.status.Report()
+	if c.Query("refresh") == "true" {
+		// the report carries the errors of the templates still missing
+		report, _ = h.status.Refresh(c.Request.Context())
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Template manifest status retrieved successfully",
+		Data:    report,
+	})
+}
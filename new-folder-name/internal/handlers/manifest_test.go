@@ -0,0 +1,141 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/manifest"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestTemplates is a template service holding the listed templates.
+type manifestTemplates map[string]bool
+
+func (m manifestTemplates) PrefetchTemplate(ctx context.Context, templateID string) error {
+	if !m[templateID] {
+		return errors.New("template not found")
+	}
+	return nil
+}
+
+func warmManifest(t *testing.T, have manifestTemplates) *manifest.Status {
+	t.Helper()
+	status := manifest.NewStatus(manifest.Manifest{Templates: []manifest.Entry{
+		{ID: "welcome", Critical: true},
+		{ID: "digest"},
+	}}, have)
+	status.Warm(context.Background())
+	return status
+}
+
+func TestHealthCheck_TemplateManifestGate(t *testing.T) {
+	tests := []struct {
+		name   string
+		have   manifestTemplates
+		gate   bool
+		code   int
+		status string
+	}{
+		{name: "all available", have: manifestTemplates{"welcome": true, "digest": true}, gate: true, code: http.StatusOK, status: "healthy"},
+		{name: "optional missing", have: manifestTemplates{"welcome": true}, gate: true, code: http.StatusOK, status: "degraded"},
+		{name: "critical missing", have: manifestTemplates{"digest": true}, gate: true, code: http.StatusServiceUnavailable, status: "unhealthy"},
+		{name: "critical missing, no gate", have: manifestTemplates{"digest": true}, code: http.StatusOK, status: "degraded"},
+	}
+	gin.SetMode(gin.TestMode)
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer redisClient.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := handlers.NewHealthHandler(brokerState{connected: true}, redisClient,
+				services.NewUserServiceClient("", true), services.NewTemplateClient("", true))
+			health.WatchTemplateManifest(warmManifest(t, tt.have), tt.gate)
+			router := gin.New()
+			router.GET("/health", health.HealthCheck)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			var body struct {
+				Checks map[string]string `json:"checks"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.status, body.Checks["template_manifest"])
+		})
+	}
+}
+
+func TestHealthCheck_TemplateManifestRecovers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer redisClient.Close()
+	have := manifestTemplates{"digest": true}
+	health := handlers.NewHealthHandler(brokerState{connected: true}, redisClient,
+		services.NewUserServiceClient("", true), services.NewTemplateClient("", true))
+	health.WatchTemplateManifest(warmManifest(t, have), true)
+	router := gin.New()
+	router.GET("/health", health.HealthCheck)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	have["welcome"] = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "the missing template is fetched again")
+}
+
+func TestGetManifestStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	have := manifestTemplates{"digest": true}
+	router := gin.New()
+	router.GET("/manifest-status", handlers.NewManifestHandler(warmManifest(t, have)).GetStatus)
+
+	get := func(path string) manifest.Report {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body struct {
+			Data manifest.Report `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Data
+	}
+
+	report := get("/manifest-status")
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.Available)
+	assert.Equal(t, []string{"welcome"}, report.Missing)
+	assert.Equal(t, []string{"welcome"}, report.MissingCritical)
+	require.Len(t, report.Templates, 2)
+	assert.Equal(t, manifest.TemplateStatus{ID: "welcome", Critical: true, Error: "template not found"}, report.Templates[0])
+
+	have["welcome"] = true
+	assert.Equal(t, []string{"welcome"}, get("/manifest-status").Missing, "the status isn't refetched unasked")
+	report = get("/manifest-status?refresh=true")
+	assert.Empty(t, report.Missing)
+	assert.Equal(t, 2, report.Available)
+}
+
+func TestGetManifestStatus_NotConfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/manifest-status", handlers.NewManifestHandler(nil).GetStatus)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/manifest-status", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "No template manifest is configured")
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// metadataIndexTTL outlives every status record, including a snoozed
+	// copy due a week out. IDs whose record has gone are dropped on read.
+	metadataIndexTTL = 8 * 24 * time.Hour
+
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// metadataIndexKey names the set of notification IDs carrying key=value.
+// Keys are restricted by validateMetadata, so the separator is unambiguous.
+func metadataIndexKey(key, value string) string {
+	return fmt.Sprintf("notification:metadata:%s:%s", key, value)
+}
+
+// indexMetadata queues the index updates for a record on pipe.
+func (n *NotificationHandler) indexMetadata(ctx context.Context, pipe redis.Pipeliner, notificationID string, metadata map[string]string) {
+	for key, value := range metadata {
+		indexKey := n.tenantKey(ctx, metadataIndexKey(key, value))
+		pipe.SAdd(ctx, indexKey, notificationID)
+		pipe.Expire(ctx, indexKey, metadataIndexTTL)
+	}
+}
+
+// ListNotifications returns the notifications whose metadata has the given
+// key and value, newest first. Without a filter there is no index to read,
+// so both are required.
+func (n *NotificationHandler) ListNotifications(c *gin.Context) {
+	ctx := c.Request.Context()
+	key, value := c.Query("metadata_key"), c.Query("metadata_value")
+	if key == "" || value == "" {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   "metadata_key and metadata_value are required",
+			Message: "Validation failed",
+		})
+		return
+	}
+	limit := defaultListLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxListLimit {
+			middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Code:    models.CodeValidationError,
+				Error:   fmt.Sprintf("limit must be between 1 and %d", maxListLimit),
+				Message: "Validation failed",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	notifications, err := n.findByMetadata(ctx, key, value)
+	if err != nil {
+		log.Printf("failed to list notifications by metadata: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to list notifications",
+			Message: "Internal server error",
+		})
+		return
+	}
+	total := len(notifications)
+	if total > limit {
+		notifications = notifications[:limit]
+	}
+	view := n.statusView(c)
+	for i := range notifications {
+		notifications[i] = n.shape(view, notifications[i])
+	}
+
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Notifications retrieved successfully",
+		Data: gin.H{
+			"notifications": notifications,
+			"count":         len(notifications),
+			"total":         total,
+		},
+	})
+}
+
+// findByMetadata reads the index for key=value and the records it points
+// at, pruning IDs whose record has expired.
+func (n *NotificationHandler) findByMetadata(ctx context.Context, key, value string) ([]models.NotificationStatus, error) {
+	indexKey := n.tenantKey(ctx, metadataIndexKey(key, value))
+	ids, err := n.redis.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	notifications := []models.NotificationStatus{}
+	if len(ids) == 0 {
+		return notifications, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = n.statusKey(ctx, id)
+	}
+	values, err := n.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var stale []interface{}
+	for i, raw := range values {
+		statusJSON, ok := raw.(string)
+		var status models.NotificationStatus
+		if !ok || json.Unmarshal([]byte(statusJSON), &status) != nil {
+			stale = append(stale, ids[i])
+			continue
+		}
+		// the record is the authority; the index may lag a rewrite
+		if status.Metadata[key] != value {
+			continue
+		}
+		notifications = append(notifications, status)
+	}
+	if len(stale) > 0 {
+		if err := n.redis.SRem(ctx, indexKey, stale...).Err(); err != nil {
+			log.Printf("failed to prune metadata index %s: %v", indexKey, err)
+		}
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.After(notifications[j].CreatedAt)
+	})
+	return notifications, nil
+}
@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendEmail_MetadataValidation(t *testing.T) {
+	tooMany := map[string]string{}
+	for _, k := range strings.Split("a b c d e f g h i j k", " ") {
+		tooMany[k] = "x"
+	}
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     []models.FieldError
+	}{
+		{
+			name:     "too many keys",
+			metadata: tooMany,
+			want:     []models.FieldError{{Field: "metadata", Message: "at most 10 metadata keys are allowed"}},
+		},
+		{
+			name:     "bad key charset",
+			metadata: map[string]string{"invoice id": "inv-1", "order/ref": "o-1"},
+			want: []models.FieldError{
+				{Field: "metadata[invoice id]", Message: "key must be 1-64 letters, digits, '_', '.' or '-'"},
+				{Field: "metadata[order/ref]", Message: "key must be 1-64 letters, digits, '_', '.' or '-'"},
+			},
+		},
+		{
+			name:     "value too long",
+			metadata: map[string]string{"invoice_id": strings.Repeat("x", 257)},
+			want:     []models.FieldError{{Field: "metadata[invoice_id]", Message: "value must be at most 256 characters"}},
+		},
+		{
+			// 256 characters but 512 bytes
+			name:     "multibyte value at the limit",
+			metadata: map[string]string{"customer": strings.Repeat("é", 256)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlertest.NewHarness().Start(t)
+			resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{
+				UserID:     "user123",
+				TemplateID: "welcome_email",
+				Metadata:   tt.metadata,
+			})
+			if tt.want == nil {
+				assert.Equal(t, http.StatusOK, resp.Code)
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			assert.Equal(t, models.CodeValidationError, resp.API().Code)
+			var fieldErrors []models.FieldError
+			resp.Decode(&fieldErrors)
+			assert.Equal(t, tt.want, fieldErrors)
+			assert.Empty(t, h.Queue.Emails())
+		})
+	}
+}
+
+func TestListNotifications_ByMetadata(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithClaims(jwt.MapClaims{"sub": "billing", "scope": middleware.AdminScope}).
+		Start(t)
+
+	send := func(path string, metadata map[string]string) string {
+		var body interface{} = models.SendEmailRequest{UserID: "user123", TemplateID: "receipt", Metadata: metadata}
+		if path == "/api/v1/notification/push" {
+			body = models.SendPushRequest{UserID: "user123", TemplateID: "receipt", Metadata: metadata}
+		}
+		resp := h.POST(path, body)
+		require.Equal(t, http.StatusOK, resp.Code)
+		return resp.NotificationID()
+	}
+	first := send("/api/v1/notification/email", map[string]string{"invoice_id": "inv-1", "order_ref": "o-9"})
+	second := send("/api/v1/notification/push", map[string]string{"invoice_id": "inv-1"})
+	send("/api/v1/notification/email", map[string]string{"invoice_id": "inv-2"})
+	send("/api/v1/notification/email", nil)
+
+	// metadata is echoed back on the status and passed to the workers
+	var status models.NotificationStatus
+	h.GET("/api/v1/notification/status/" + first).Decode(&status)
+	assert.Equal(t, map[string]string{"invoice_id": "inv-1", "order_ref": "o-9"}, status.Metadata)
+	assert.Equal(t, map[string]string{"invoice_id": "inv-1", "order_ref": "o-9"}, h.Queue.Emails()[0].Metadata)
+	assert.Equal(t, map[string]string{"invoice_id": "inv-1"}, h.Queue.Pushes()[0].Metadata)
+
+	type listing struct {
+		Notifications []models.NotificationStatus `json:"notifications"`
+		Count         int                         `json:"count"`
+		Total         int                         `json:"total"`
+	}
+	list := func(query string) (int, listing) {
+		resp := h.GET("/api/v1/admin/notifications?" + query)
+		var l listing
+		if resp.Code == http.StatusOK {
+			resp.Decode(&l)
+		}
+		return resp.Code, l
+	}
+	ids := func(l listing) []string {
+		var out []string
+		for _, n := range l.Notifications {
+			out = append(out, n.ID)
+		}
+		return out
+	}
+
+	code, l := list("metadata_key=invoice_id&metadata_value=inv-1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.ElementsMatch(t, []string{first, second}, ids(l))
+
+	code, l = list("metadata_key=order_ref&metadata_value=o-9")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{first}, ids(l))
+
+	code, l = list("metadata_key=invoice_id&metadata_value=inv-1&limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, l.Count)
+	assert.Equal(t, 2, l.Total)
+
+	code, l = list("metadata_key=invoice_id&metadata_value=inv-404")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, l.Notifications)
+
+	t.Run("expired records are pruned from the index", func(t *testing.T) {
+		h.Miniredis.Del("notification:status:" + second)
+
+		_, l := list("metadata_key=invoice_id&metadata_value=inv-1")
+		assert.Equal(t, []string{first}, ids(l))
+		members, err := h.Redis.SMembers(context.Background(), "notification:metadata:invoice_id:inv-1").Result()
+		require.NoError(t, err)
+		assert.Equal(t, []string{first}, members)
+	})
+
+	t.Run("filter is required", func(t *testing.T) {
+		for _, query := range []string{"", "metadata_key=invoice_id", "metadata_key=invoice_id&metadata_value=inv-1&limit=0"} {
+			code, _ := list(query)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+	})
+}
@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/franzego/stage04/internal/budget"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func groupKey(groupID string) string {
+	return fmt.Sprintf("notification:group:%s", groupID)
+}
+
+// indexGroup adds notificationID to the notifications of groupID.
+func (n *NotificationHandler) indexGroup(ctx context.Context, pipe redis.Pipeliner, notificationID, groupID string) {
+	if groupID == "" {
+		return
+	}
+	key := n.tenantKey(ctx, groupKey(groupID))
+	pipe.SAdd(ctx, key, notificationID)
+	// kept as long as the status records it points at
+	pipe.Expire(ctx, key, n.cfg.StatusTTL)
+}
+
+// channelDisabled reports whether sending on channel is switched off.
+func (n *NotificationHandler) channelDisabled(channel string) bool {
+	return slices.Contains(n.cfg.DisabledChannels, channel)
+}
+
+// channelEnabled writes a 503 and returns false when sending on channel is
+// switched off.
+func (n *NotificationHandler) channelEnabled(c *gin.Context, channel string) bool {
+	if !n.channelDisabled(channel) {
+		return true
+	}
+	middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+		Success: false,
+		Code:    models.CodeChannelDisabled,
+		Error:   fmt.Sprintf("%s notifications are disabled", channel),
+		Message: "Service unavailable",
+	})
+	return false
+}
+
+// SendMulti sends one template to a user on several channels. The request
+// is validated once, then every channel gets a notification of its own,
+// linked to the others by a group ID, and a result of its own, so a channel
+// that can't be sent doesn't hide the ones that were. Per channel it
+// honours the kill switch, the policy chain, approval and duplicate
+// suppression like the single-channel sends; send-time optimization and
+// quiet hours are not offered here.
+func (n *NotificationHandler) SendMulti(c *gin.Context) {
+	// keeps the tenant but not the cancellation, so a client hanging up
+	// can't abandon a half-made send; the shared checks get the validation
+	// share of the request's deadline, each channel's publish and status
+	// their shares of what is left when it gets to them
+	sendCtx, cancel := sendContext(c)
+	defer cancel()
+	sendBudget := n.newBudget(sendCtx)
+	ctx, endValidation, ok := startPhase(c, sendCtx, sendBudget, budget.Validation)
+	if !ok {
+		return
+	}
+	defer endValidation()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+
+	var req models.SendMultiRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if fieldErrors := validateChannels(req.Channels); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid channels",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateLocale(req.Locale); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid locale",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateMetadata(req.Metadata); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid metadata",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if ctx, ok = n.checkUser(c, ctx, req.UserID); !ok {
+		return
+	}
+	validTemplate, err := n.templateService.ValidateTemplate(ctx, req.TemplateID)
+	if err != nil || !validTemplate {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Validation failed",
+		})
+		return
+	}
+	needsApproval, err := n.requiresApproval(ctx, req.TemplateID)
+	if err != nil {
+		log.Printf("failed to check approval policy for %s: %v", req.TemplateID, err)
+		middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Code:    models.CodeServiceUnavailable,
+			Error:   "Template approval policy unavailable",
+			Message: "Service unavailable",
+		})
+		return
+	}
+	warnings := n.variableWarnings(ctx, req.TemplateID, req.Variables)
+
+	send := multiSend{
+		req:           req,
+		groupID:       n.ids.NewID(),
+		locale:        n.resolveLocale(ctx, req.Locale, req.UserID),
+		tenantID:      n.tenantOf(ctx),
+		createdBy:     middleware.CallerID(c),
+		correlationID: correlationID,
+		needsApproval: needsApproval,
+		phases:        sendBudget,
+		user:          userFromContext(ctx, req.UserID),
+	}
+	endValidation()
+	response := models.MultiSendResponse{GroupID: send.groupID, Results: make([]models.ChannelResult, 0, len(req.Channels))}
+	sent, queued := 0, 0
+	for _, channel := range req.Channels {
+		result := n.sendOnChannel(sendCtx, send, channel)
+		if result.Code == "" {
+			sent++
+		}
+		if result.Status == "queued" || result.Status == "deferred" {
+			queued++
+		}
+		response.Results = append(response.Results, result)
+	}
+	usage.MarkQueued(c, queued)
+
+	switch {
+	case sent == len(response.Results):
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success:  true,
+			Message:  "Notifications queued on every channel",
+			Warnings: warnings,
+			Data:     response,
+		})
+	case sent > 0:
+		middleware.WriteResponse(c, http.StatusMultiStatus, models.APIResponse{
+			Success:  true,
+			Message:  "Notifications queued on some channels",
+			Warnings: warnings,
+			Data:     response,
+		})
+	default:
+		// nothing went out: answer as a single-channel send would have
+		first := response.Results[0]
+		middleware.WriteError(c, channelFailureStatus(first.Code), models.APIResponse{
+			Success: false,
+			Code:    first.Code,
+			Data:    response,
+			Error:   "No channel could be sent",
+			Message: "Notifications not queued",
+		})
+	}
+}
+
+// multiSend is what every channel of a SendMulti request shares.
+type multiSend struct {
+	req           models.SendMultiRequest
+	groupID       string
+	locale        string
+	tenantID      string
+	createdBy     string
+	correlationID string
+	needsApproval bool
+	phases        *budget.Budget
+	// user is the recipient's record, when the user service gives one.
+	user *models.User
+}
+
+// sendOnChannel creates and publishes, or holds for approval, the
+// notification of one channel. A result without a code went out; a
+// suppressed duplicate counts as sent and points at the original.
+func (n *NotificationHandler) sendOnChannel(ctx context.Context, send multiSend, channel string) models.ChannelResult {
+	req := send.req
+	result := models.ChannelResult{Channel: channel, Status: "failed"}
+	if send.user != nil {
+		ctx = withUser(ctx, send.user)
+	}
+	if n.channelDisabled(channel) {
+		result.Code, result.Error = models.CodeChannelDisabled, fmt.Sprintf("%s notifications are disabled", channel)
+		return result
+	}
+	decision, err := n.evaluatePolicies(ctx, EnqueueRequest{
+		Channel:    channel,
+		TenantID:   send.tenantID,
+		UserID:     req.UserID,
+		TemplateID: req.TemplateID,
+		Category:   req.Category,
+		Priority:   req.Priority,
+		DeliverAt:  n.clock.Now(),
+		Metadata:   req.Metadata,
+	})
+	if err != nil {
+		log.Printf("failed to evaluate send policies for %s: %v", req.UserID, err)
+		result.Code, result.Error = models.CodeServiceUnavailable, policyErrorMessage(err)
+		return result
+	}
+	if decision.Verdict == Suppress {
+		result.Status = "skipped"
+		result.Code, result.Error = decision.Code, decision.Reason
+		return result
+	}
+
+	notificationID := n.ids.NewID()
+	suppressionKey := n.tenantKey(ctx, dedupeKey(req.UserID, req.TemplateID, channel))
+	dedupeWindow := n.dedupeWindow(nil)
+	if originalID, suppressed := n.claimDedupe(ctx, suppressionKey, notificationID, dedupeWindow); suppressed {
+		result.NotificationID, result.Status = originalID, "suppressed"
+		return result
+	}
+
+	publish, queueName := n.publisherFor(channel)
+	message := models.NotificationMessage{
+		ID:            notificationID,
+		Type:          channel,
+		UserID:        req.UserID,
+		TemplateID:    req.TemplateID,
+		Variables:     req.Variables,
+		Timestamp:     n.clock.Now(),
+		CorrelationID: send.correlationID,
+		RequestID:     middleware.RequestIDFromContext(ctx),
+		Locale:        send.locale,
+		Category:      req.Category,
+		Priority:      req.Priority,
+		TenantID:      send.tenantID,
+		Metadata:      req.Metadata,
+		GroupID:       send.groupID,
+		Recipient:     recipientHint(ctx, req.UserID, channel),
+	}
+	status := "queued"
+	if decision.Verdict == Defer {
+		message.ScheduledFor = decision.Until
+		status = "deferred"
+	}
+	record := models.NotificationStatus{
+		ID:            notificationID,
+		TenantID:      send.tenantID,
+		UserID:        req.UserID,
+		TemplateID:    req.TemplateID,
+		Variables:     req.Variables,
+		Category:      req.Category,
+		Priority:      req.Priority,
+		Metadata:      req.Metadata,
+		Type:          channel,
+		Queue:         queueName,
+		Status:        status,
+		ScheduledFor:  message.ScheduledFor,
+		Locale:        send.locale,
+		PolicyReason:  deferReason(decision),
+		CreatedBy:     send.createdBy,
+		CorrelationID: send.correlationID,
+		GroupID:       send.groupID,
+		Delivery:      deliveryOf(message),
+	}
+	if channel == "email" {
+		record.Recipients = &models.RecipientCounts{To: 1}
+	}
+
+	if send.needsApproval {
+		if err := n.holdForApproval(ctx, message, record); err != nil {
+			n.releaseDedupe(ctx, suppressionKey, notificationID, dedupeWindow)
+			log.Printf("failed to hold %s notification for approval: %v", channel, err)
+			result.Code, result.Error = models.CodeInternalError, "failed to hold notification for approval"
+			return result
+		}
+		result.NotificationID, result.Status = notificationID, "pending_approval"
+		return result
+	}
+	publishCtx, endPublish, err := send.phases.Start(ctx, budget.Publish)
+	if err != nil {
+		n.releaseDedupe(ctx, suppressionKey, notificationID, dedupeWindow)
+		log.Printf("%s notification failed fast: %v", channel, err)
+		result.Code, result.Error = models.CodeDeadlineExceeded, "Not enough time left to "+phaseAction(budget.Publish)
+		return result
+	}
+	buffered, err := n.publishOrBuffer(publishCtx, publish, queueName, message, record)
+	endPublish()
+	if err != nil {
+		n.releaseDedupe(ctx, suppressionKey, notificationID, dedupeWindow)
+		log.Printf("failed to publish %s notification: %v", channel, err)
+		result.Code, result.Error = models.CodeQueueUnavailable, "failed to queue notification"
+		if errors.Is(err, ErrOutboxFull) {
+			result.Code, result.Error = models.CodeServiceUnavailable, "Notification queue unavailable and outbox full"
+		}
+		return result
+	}
+	if buffered {
+		result.NotificationID, result.Status = notificationID, outboxStatus
+		return result
+	}
+	storeCtx, endStore, err := send.phases.Start(ctx, budget.Persistence)
+	switch {
+	case errors.Is(err, budget.ErrSkipped):
+		log.Printf("%s notification %s queued without a status record: %v", channel, notificationID, err)
+	case err != nil:
+		log.Printf("%s notification failed fast: %v", channel, err)
+		result.NotificationID = notificationID
+		result.Code, result.Error = models.CodeDeadlineExceeded, "Not enough time left to "+phaseAction(budget.Persistence)
+		return result
+	default:
+		if err := n.storeNotificationStatus(storeCtx, record); err != nil {
+			log.Printf("failed to log %s notification status: %v", channel, err)
+		}
+		endStore()
+	}
+	result.NotificationID, result.Status = notificationID, status
+	return result
+}
+
+// channelFailureStatus is the status a single-channel send answers with
+// for the same failure.
+func channelFailureStatus(code models.ErrorCode) int {
+	switch code {
+	case models.CodeUserOptedOut, models.CodeSuppressedByPolicy:
+		return http.StatusUnprocessableEntity
+	case models.CodeChannelDisabled, models.CodeServiceUnavailable:
+		return http.StatusServiceUnavailable
+	case models.CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// validateChannels rejects a channel listed twice, which would send the
+// user the same notification twice.
+func validateChannels(channels []string) []models.FieldError {
+	var fieldErrors []models.FieldError
+	seen := make(map[string]bool, len(channels))
+	for i, channel := range channels {
+		if seen[channel] {
+			fieldErrors = append(fieldErrors, models.FieldError{
+				Field:   fmt.Sprintf("channels[%d]", i),
+				Message: fmt.Sprintf("%s is listed more than once", channel),
+			})
+		}
+		seen[channel] = true
+	}
+	return fieldErrors
+}
+
+// GetGroup aggregates the statuses of the notifications a multi-channel
+// send created.
+func (n *NotificationHandler) GetGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	groupID := c.Param("group_id")
+
+	ids, err := n.redis.SMembers(ctx, n.tenantKey(ctx, groupKey(groupID))).Result()
+	if err != nil {
+		log.Printf("failed to read group %s: %v", groupID, err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to retrieve group",
+			Message: "Internal server error",
+		})
+		return
+	}
+	group := models.GroupStatus{GroupID: groupID, Counts: map[string]int{}, Notifications: []models.NotificationStatus{}}
+	view := n.statusView(c)
+	for _, id := range ids {
+		statusJSON, err := n.statuses.Get(ctx, id)
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("failed to read status %s of group %s: %v", id, groupID, err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "Failed to retrieve group",
+				Message: "Internal server error",
+			})
+			return
+		}
+		var status models.NotificationStatus
+		if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+			log.Printf("skipping unreadable status record %s: %v", id, err)
+			continue
+		}
+		if !n.canRead(c, status) {
+			continue
+		}
+		group.Notifications = append(group.Notifications, n.shape(view, status))
+		group.Counts[status.Status]++
+	}
+	// answer like a missing record so IDs can't be probed for existence
+	if len(group.Notifications) == 0 {
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Group not found",
+			Message: "Not found",
+		})
+		return
+	}
+	sort.Slice(group.Notifications, func(i, j int) bool {
+		return group.Notifications[i].Type < group.Notifications[j].Type
+	})
+	group.Status = "mixed"
+	if len(group.Counts) == 1 {
+		group.Status = group.Notifications[0].Status
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Group status retrieved successfully",
+		Data:    group,
+	})
+}
@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func multiRequest(channels ...string) models.SendMultiRequest {
+	return models.SendMultiRequest{
+		UserID:     "user-123",
+		TemplateID: "order_shipped",
+		Channels:   channels,
+		Variables:  map[string]interface{}{"order": "A-1"},
+	}
+}
+
+func TestSendMulti_AllChannels(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	resp := h.POST("/api/v1/notification/multi", multiRequest("email", "push"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var data models.MultiSendResponse
+	resp.Decode(&data)
+	require.NotEmpty(t, data.GroupID)
+	require.Len(t, data.Results, 2)
+	assert.Equal(t, "email", data.Results[0].Channel)
+	assert.Equal(t, "push", data.Results[1].Channel)
+	for _, result := range data.Results {
+		assert.Equal(t, "queued", result.Status)
+		assert.Empty(t, result.Code)
+	}
+
+	emails, pushes := h.Queue.Emails(), h.Queue.Pushes()
+	require.Len(t, emails, 1)
+	require.Len(t, pushes, 1)
+	assert.Equal(t, data.Results[0].NotificationID, emails[0].ID)
+	assert.Equal(t, data.Results[1].NotificationID, pushes[0].ID)
+	assert.Equal(t, data.GroupID, emails[0].GroupID)
+	assert.Equal(t, data.GroupID, pushes[0].GroupID)
+}
+
+func TestSendMulti_PartialFailure(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{DisabledChannels: []string{"push"}}).
+		Start(t)
+
+	resp := h.POST("/api/v1/notification/multi", multiRequest("email", "push"))
+	require.Equal(t, http.StatusMultiStatus, resp.Code)
+	assert.True(t, resp.API().Success)
+	var data models.MultiSendResponse
+	resp.Decode(&data)
+	require.Len(t, data.Results, 2)
+	assert.Equal(t, "queued", data.Results[0].Status)
+	assert.NotEmpty(t, data.Results[0].NotificationID)
+	assert.Equal(t, models.ChannelResult{
+		Channel: "push",
+		Status:  "failed",
+		Code:    models.CodeChannelDisabled,
+		Error:   "push notifications are disabled",
+	}, data.Results[1])
+
+	assert.Len(t, h.Queue.Emails(), 1)
+	assert.Empty(t, h.Queue.Pushes())
+
+	// the kill switch holds for the single-channel endpoint too
+	resp = h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user-123", TemplateID: "order_shipped"})
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, models.CodeChannelDisabled, resp.API().Code)
+}
+
+func TestSendMulti_NothingSent(t *testing.T) {
+	h := handlertest.NewHarness().WithQueueError(errors.New("connection failed")).Start(t)
+
+	resp := h.POST("/api/v1/notification/multi", multiRequest("email", "push"))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	api := resp.API()
+	assert.False(t, api.Success)
+	assert.Equal(t, models.CodeQueueUnavailable, api.Code)
+	var data models.MultiSendResponse
+	resp.Decode(&data)
+	for _, result := range data.Results {
+		assert.Equal(t, "failed", result.Status)
+		assert.Empty(t, result.NotificationID)
+	}
+}
+
+func TestSendMulti_RejectsRepeatedChannel(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	resp := h.POST("/api/v1/notification/multi", multiRequest("push", "push"))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, models.CodeValidationError, resp.API().Code)
+	assert.Empty(t, h.Queue.Pushes())
+
+	resp = h.POST("/api/v1/notification/multi", multiRequest("email", "sms"))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetGroup_AggregatesStatuses(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	var sent models.MultiSendResponse
+	h.POST("/api/v1/notification/multi", multiRequest("email", "push")).Decode(&sent)
+	require.Len(t, sent.Results, 2)
+
+	resp := h.GET("/api/v1/notification/group/" + sent.GroupID)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var group models.GroupStatus
+	resp.Decode(&group)
+	assert.Equal(t, sent.GroupID, group.GroupID)
+	assert.Equal(t, "queued", group.Status)
+	assert.Equal(t, map[string]int{"queued": 2}, group.Counts)
+	require.Len(t, group.Notifications, 2)
+	assert.Equal(t, "email", group.Notifications[0].Type)
+	assert.Equal(t, "push", group.Notifications[1].Type)
+	assert.Equal(t, sent.GroupID, group.Notifications[0].GroupID)
+
+	require.NoError(t, h.Handler.SetDeliveryStatus(context.Background(), sent.Results[0].NotificationID, "sent"))
+	h.GET("/api/v1/notification/group/" + sent.GroupID).Decode(&group)
+	assert.Equal(t, "mixed", group.Status)
+	assert.Equal(t, map[string]int{"queued": 1, "sent": 1}, group.Counts)
+
+	resp = h.GET("/api/v1/notification/group/no-such-group")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
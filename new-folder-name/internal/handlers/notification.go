@@ -0,0 +1,1072 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/franzego/stage04/internal/budget"
+	"github.com/franzego/stage04/internal/cache"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/franzego/stage04/pkg/idgen"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultStatusCacheTTL keeps cached entries short-lived so replicas never
+// serve a stale status for long.
+const defaultStatusCacheTTL = 2 * time.Second
+
+type NotificationHandler struct {
+	rabbitClient    RabbitClient
+	redis           *redis.Client
+	userService     UserService
+	templateService TemplateService
+	cfg             config.NotificationsConfig
+	topicPattern    *regexp.Regexp
+	// hotCache absorbs repeated status polls and idempotency lookups. It is
+	// nil when disabled.
+	hotCache *cache.LRU
+	// streamHeartbeat is how often an idle status stream is pinged.
+	streamHeartbeat time.Duration
+	quietHours      quietWindow
+	// variablesCache holds the variables extracted from template sources.
+	variablesCache *cache.LRU
+	// clock stamps statuses, messages and history entries; ids names new
+	// notifications and groups.
+	clock     clock.Clock
+	ids       idgen.Generator
+	clockSkew clockSkew
+	// trustedClients get the full status view; internalFields are the
+	// NotificationStatus fields the public view leaves out.
+	trustedClients map[string]bool
+	internalFields []int
+	// policyChecks are the checks the policy chain can name.
+	policyChecks map[string]PolicyCheck
+	// userIndex lists each user's notifications, newest first.
+	userIndex *store.UserIndex
+	// statuses writes status records with their indexes; idempotency
+	// claims notification IDs. fallback, when degraded mode is on, is
+	// statuses keeping records in memory while Redis is down.
+	statuses    store.Statuses
+	fallback    *store.FallbackStatuses
+	idempotency *store.Idempotency
+	// keys is put in front of every key the handler uses, see SetKeyPrefix.
+	keys store.Namespace
+	// archive, when set, keeps status records past their TTL.
+	archive StatusArchive
+}
+
+// RabbitClient defines the methods used from the RabbitMq client. Using an
+// interface makes testing easier (mocks can implement this).
+type RabbitClient interface {
+	PublishEmail(ctx context.Context, message interface{}) error
+	PublishPushNot(ctx context.Context, message interface{}) error
+	PublishWhatsApp(ctx context.Context, message interface{}) error
+	IsConnected() bool
+}
+
+func NewNotificationService(
+	queue RabbitClient,
+	redis *redis.Client,
+	userService UserService,
+	templateService TemplateService,
+	cfg config.NotificationsConfig,
+) *NotificationHandler {
+	if cfg.MaxExtraRecipients <= 0 {
+		cfg.MaxExtraRecipients = defaultMaxExtraRecipients
+	}
+	topicPattern, err := regexp.Compile(cfg.TopicPattern)
+	if cfg.TopicPattern == "" || err != nil {
+		if err != nil {
+			log.Printf("invalid topic pattern %q, using the default: %v", cfg.TopicPattern, err)
+		}
+		topicPattern = defaultTopicPattern
+	}
+	var hotCache *cache.LRU
+	if cfg.StatusCacheSize > 0 {
+		ttl := cfg.StatusCacheTTL
+		if ttl <= 0 {
+			ttl = defaultStatusCacheTTL
+		}
+		hotCache = cache.NewLRU(cfg.StatusCacheSize, ttl)
+	}
+	if cfg.StatusStreamMaxDuration <= 0 {
+		cfg.StatusStreamMaxDuration = defaultStatusStreamMaxDuration
+	}
+	if cfg.MaxSnoozes <= 0 {
+		cfg.MaxSnoozes = defaultMaxSnoozes
+	}
+	if cfg.MaxSnoozeDuration <= 0 {
+		cfg.MaxSnoozeDuration = defaultMaxSnoozeDuration
+	}
+	if cfg.PreferencesCacheTTL <= 0 {
+		cfg.PreferencesCacheTTL = defaultPreferencesCacheTTL
+	}
+	if cfg.DefaultTenant == "" {
+		cfg.DefaultTenant = defaultTenant
+	}
+	if cfg.ApprovalTTL <= 0 {
+		cfg.ApprovalTTL = defaultApprovalTTL
+	}
+	if cfg.StatusTTL <= 0 {
+		cfg.StatusTTL = defaultStatusTTL
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = defaultIdempotencyTTL
+	}
+	if cfg.InternalStatusFields == nil {
+		cfg.InternalStatusFields = defaultInternalStatusFields
+	}
+	if cfg.PolicyChain == nil {
+		cfg.PolicyChain = defaultPolicyChain
+	}
+	trustedClients := make(map[string]bool, len(cfg.TrustedClients))
+	for _, client := range cfg.TrustedClients {
+		trustedClients[client] = true
+	}
+	n := &NotificationHandler{
+		rabbitClient:    queue,
+		redis:           redis,
+		userService:     userService,
+		templateService: templateService,
+		cfg:             cfg,
+		topicPattern:    topicPattern,
+		hotCache:        hotCache,
+		streamHeartbeat: statusStreamHeartbeat,
+		quietHours:      parseQuietWindow(cfg.QuietHoursStart, cfg.QuietHoursEnd),
+		variablesCache:  cache.NewLRU(templateVariablesCacheSize, templateVariablesCacheTTL),
+		clock:           clock.System,
+		ids:             idgen.UUID,
+		trustedClients:  trustedClients,
+		internalFields:  internalFieldIndexes(cfg.InternalStatusFields),
+		policyChecks:    map[string]PolicyCheck{},
+	}
+	n.userIndex = store.NewUserIndex(redis, n.tenantKey, cfg.UserIndexMaxLength, cfg.StatusTTL)
+	statuses := store.NewStatusStore(redis, n.tenantKey, cfg.StatusTTL, n.statusWrites)
+	n.statuses = statuses
+	if cfg.Degraded.Capacity > 0 {
+		n.fallback = store.NewFallbackStatuses(statuses, cfg.Degraded.After, cfg.Degraded.Capacity)
+		n.statuses = n.fallback
+	}
+	n.idempotency = store.NewIdempotency(redis, n.tenantKey, cfg.IdempotencyTTL)
+	n.RegisterPolicyCheck("preferences", preferencesCheck{})
+	n.RegisterPolicyCheck("quiet_hours", quietHoursCheck{n})
+	if cfg.PolicyWebhook.URL != "" {
+		n.RegisterPolicyCheck("webhook", NewWebhookPolicyCheck(cfg.PolicyWebhook))
+	}
+	return n
+}
+
+// SetClock replaces the wall clock the handler reads, for tests that need
+// predictable timestamps.
+func (n *NotificationHandler) SetClock(c clock.Clock) {
+	n.clock = c
+	n.hotCache.SetClock(c)
+	n.variablesCache.SetClock(c)
+}
+
+// SetKeyPrefix puts every key and channel the handler uses in Redis behind
+// prefix, redis.key_prefix, so deployments sharing a Redis keep apart. It
+// must be called before the handler serves.
+func (n *NotificationHandler) SetKeyPrefix(prefix string) {
+	n.keys = store.Namespace(prefix)
+}
+
+// SetIDGenerator replaces the random IDs the handler hands out.
+func (n *NotificationHandler) SetIDGenerator(ids idgen.Generator) {
+	n.ids = ids
+}
+
+// UserService defines the subset of methods used from the user service client.
+type UserService interface {
+	ValidateUser(ctx context.Context, userID string) (bool, error)
+	GetPreferences(ctx context.Context, userID string) (models.Preferences, error)
+}
+
+// TemplateService defines the subset of methods used from the template service client.
+type TemplateService interface {
+	ValidateTemplate(ctx context.Context, templateID string) (bool, error)
+}
+
+func (n *NotificationHandler) SendEmail(c *gin.Context) {
+	if !n.channelEnabled(c, "email") {
+		return
+	}
+	// keeps the tenant but not the cancellation, so a client hanging up
+	// can't abandon a half-made send; each phase gets its share of the
+	// request's deadline
+	sendCtx, cancel := sendContext(c)
+	defer cancel()
+	sendBudget := n.newBudget(sendCtx)
+	ctx, endValidation, ok := startPhase(c, sendCtx, sendBudget, budget.Validation)
+	if !ok {
+		return
+	}
+	defer endValidation()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+	now := n.clock.Now()
+	// parse the req
+	var req models.SendEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if fieldErrors := validateAttachments(req.Attachments); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid attachments",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateLocale(req.Locale); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid locale",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateMetadata(req.Metadata); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid metadata",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateExpiresIn(req.ExpiresInSeconds); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid expiry",
+			Message: "Validation failed",
+		})
+		return
+	}
+	notificationID := n.ids.NewID()
+	if !n.claimNotification(c, notificationID, now) {
+		return
+	}
+	if ctx, ok = n.checkUser(c, ctx, req.UserID); !ok {
+		return
+	}
+	status, responseMessage := "queued", "Email notification queued successfully"
+	var scheduledFor *time.Time
+	if req.SendTimeOptimization {
+		// without a profile the email simply goes out immediately
+		if sendAt := n.optimizedSendTime(ctx, req.UserID, n.clock.Now()); sendAt != nil {
+			scheduledFor = sendAt
+			status, responseMessage = "scheduled_sto", "Email notification scheduled for the user's preferred hour"
+		}
+	}
+	deliverAt := n.clock.Now()
+	if scheduledFor != nil {
+		deliverAt = *scheduledFor
+	}
+	decision, ok := n.applyPolicies(c, ctx, EnqueueRequest{
+		Channel:           "email",
+		TenantID:          n.tenantOf(ctx),
+		UserID:            req.UserID,
+		TemplateID:        req.TemplateID,
+		Category:          req.Category,
+		Priority:          req.Priority,
+		RespectQuietHours: req.RespectQuietHours,
+		DeliverAt:         deliverAt,
+		Metadata:          req.Metadata,
+	})
+	if !ok {
+		return
+	}
+	if decision.Verdict == Defer {
+		scheduledFor = decision.Until
+		status, responseMessage = "deferred", "Email notification deferred "+decision.Reason
+	}
+	fieldErrors, err := n.validateExtraRecipients(ctx, req.CC, req.BCC)
+	if err != nil {
+		log.Printf("failed to check cc/bcc recipients: %v", err)
+		writeUserServiceUnavailable(c)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeRecipientNotFound,
+			Data:    fieldErrors,
+			Error:   "CC/BCC recipients not found or unavailable",
+			Message: "Validation failed",
+		})
+		return
+	}
+	validTemplate, err := n.templateService.ValidateTemplate(ctx, req.TemplateID)
+	if err != nil || !validTemplate {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Validation failed",
+		})
+		return
+	}
+	warnings := n.variableWarnings(ctx, req.TemplateID, req.Variables)
+	message := models.NotificationMessage{
+		ID:               notificationID,
+		Type:             "email",
+		UserID:           req.UserID,
+		TemplateID:       req.TemplateID,
+		Variables:        req.Variables,
+		Timestamp:        n.clock.Now(),
+		CorrelationID:    correlationID,
+		RequestID:        middleware.RequestIDFromContext(ctx),
+		Attachments:      req.Attachments,
+		CC:               req.CC,
+		BCC:              req.BCC,
+		Locale:           n.resolveLocale(ctx, req.Locale, req.UserID),
+		Category:         req.Category,
+		Priority:         req.Priority,
+		TenantID:         n.tenantOf(ctx),
+		Metadata:         req.Metadata,
+		ExpiresInSeconds: req.ExpiresInSeconds,
+		Recipient:        recipientHint(ctx, req.UserID, "email"),
+	}
+	if req.RecipientEmail != "" {
+		message.Overrides = &models.Overrides{RecipientEmail: req.RecipientEmail}
+	}
+	message.ScheduledFor = scheduledFor
+	needsApproval, err := n.requiresApproval(ctx, req.TemplateID)
+	if err != nil {
+		log.Printf("failed to check approval policy for %s: %v", req.TemplateID, err)
+		middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Code:    models.CodeServiceUnavailable,
+			Error:   "Template approval policy unavailable",
+			Message: "Service unavailable",
+		})
+		return
+	}
+	suppressionKey := n.tenantKey(ctx, dedupeKey(req.UserID, req.TemplateID, "email"))
+	dedupeWindow := n.dedupeWindow(req.DedupeWindowSeconds)
+	if originalID, suppressed := n.claimDedupe(ctx, suppressionKey, notificationID, dedupeWindow); suppressed {
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Code:    models.CodeDuplicateRequest,
+			Message: "Duplicate email notification suppressed",
+			Data: models.NotificationResponse{
+				NotificationID: originalID,
+				Status:         "suppressed",
+				QueuedAt:       now,
+			},
+		})
+		return
+	}
+	record := models.NotificationStatus{
+		ID:           notificationID,
+		TenantID:     message.TenantID,
+		UserID:       req.UserID,
+		TemplateID:   req.TemplateID,
+		Variables:    message.Variables,
+		Category:     message.Category,
+		Priority:     message.Priority,
+		Metadata:     message.Metadata,
+		Type:         "email",
+		Queue:        n.emailQueue(),
+		Status:       status,
+		Overrides:    message.Overrides,
+		ScheduledFor: message.ScheduledFor,
+		Locale:       message.Locale,
+		PolicyReason: deferReason(decision),
+		Recipients: &models.RecipientCounts{
+			To:  1,
+			CC:  len(req.CC),
+			BCC: len(req.BCC),
+		},
+		CreatedBy:     middleware.CallerID(c),
+		CorrelationID: correlationID,
+		Delivery:      deliveryOf(message),
+	}
+	if needsApproval {
+		if err := n.holdForApproval(ctx, message, record); err != nil {
+			n.releaseDedupe(ctx, suppressionKey, notificationID, dedupeWindow)
+			log.Printf("failed to hold email for approval: %v", err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "failed to hold notification for approval",
+				Message: "Internal Server Error",
+			})
+			return
+		}
+		middleware.WriteResponse(c, http.StatusAccepted, models.APIResponse{
+			Success:  true,
+			Message:  "Email notification held for approval",
+			Warnings: warnings,
+			Data: models.NotificationResponse{
+				NotificationID: notificationID,
+				Status:         "pending_approval",
+				QueuedAt:       n.clock.Now(),
+				ScheduledFor:   message.ScheduledFor,
+			},
+		})
+		return
+	}
+	endValidation()
+	publishCtx, endPublish, ok := startPhase(c, sendCtx, sendBudget, budget.Publish)
+	if !ok {
+		n.releaseDedupe(sendCtx, suppressionKey, notificationID, dedupeWindow)
+		return
+	}
+	buffered, err := n.publishOrBuffer(publishCtx, n.rabbitClient.PublishEmail, n.emailQueue(), message, record)
+	endPublish()
+	if err != nil {
+		n.releaseDedupe(sendCtx, suppressionKey, notificationID, dedupeWindow)
+		log.Printf("failed to publish email")
+		writePublishError(c, err, "failed to queue notification")
+		return
+	}
+	code := http.StatusOK
+	if buffered {
+		code, status, responseMessage = http.StatusAccepted, outboxStatus, "Email notification accepted, to be queued once the broker is back"
+	} else if !n.persistStatus(c, sendCtx, sendBudget, record) {
+		return
+	}
+	usage.MarkQueued(c, 1)
+	middleware.WriteResponse(c, code, models.APIResponse{
+		Success:  true,
+		Message:  responseMessage,
+		Warnings: warnings,
+		Data: models.NotificationResponse{
+			NotificationID: notificationID,
+			Status:         status,
+			QueuedAt:       n.clock.Now(),
+			ScheduledFor:   message.ScheduledFor,
+		},
+	})
+
+}
+func (n *NotificationHandler) SendPush(c *gin.Context) {
+	if !n.channelEnabled(c, "push") {
+		return
+	}
+	// keeps the tenant but not the cancellation, so a client hanging up
+	// can't abandon a half-made send; each phase gets its share of the
+	// request's deadline
+	sendCtx, cancel := sendContext(c)
+	defer cancel()
+	sendBudget := n.newBudget(sendCtx)
+	ctx, endValidation, ok := startPhase(c, sendCtx, sendBudget, budget.Validation)
+	if !ok {
+		return
+	}
+	defer endValidation()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+	now := n.clock.Now()
+	var req models.SendPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if len(req.Attachments) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data: []models.FieldError{
+				{Field: "attachments", Message: "attachments are not supported for push notifications"},
+			},
+			Error:   "Attachments not supported",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateDeviceTokens(req.DeviceTokens); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid device tokens",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateLocale(req.Locale); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid locale",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateMetadata(req.Metadata); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid metadata",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateExpiresIn(req.ExpiresInSeconds); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid expiry",
+			Message: "Validation failed",
+		})
+		return
+	}
+	notificationID := n.ids.NewID()
+	if !n.claimNotification(c, notificationID, now) {
+		return
+	}
+	if ctx, ok = n.checkUser(c, ctx, req.UserID); !ok {
+		return
+	}
+	decision, ok := n.applyPolicies(c, ctx, EnqueueRequest{
+		Channel:           "push",
+		TenantID:          n.tenantOf(ctx),
+		UserID:            req.UserID,
+		TemplateID:        req.TemplateID,
+		Category:          req.Category,
+		Priority:          req.Priority,
+		RespectQuietHours: req.RespectQuietHours,
+		DeliverAt:         n.clock.Now(),
+		Metadata:          req.Metadata,
+	})
+	if !ok {
+		return
+	}
+	validTemplate, err := n.templateService.ValidateTemplate(ctx, req.TemplateID)
+	if err != nil || !validTemplate {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Validation failed",
+		})
+		return
+	}
+	warnings := n.variableWarnings(ctx, req.TemplateID, req.Variables)
+	message := models.NotificationMessage{
+		ID:               notificationID,
+		Type:             "push",
+		UserID:           req.UserID,
+		TemplateID:       req.TemplateID,
+		Variables:        req.Variables,
+		Timestamp:        n.clock.Now(),
+		CorrelationID:    correlationID,
+		RequestID:        middleware.RequestIDFromContext(ctx),
+		DeviceTokens:     req.DeviceTokens,
+		Platform:         req.Platform,
+		Locale:           n.resolveLocale(ctx, req.Locale, req.UserID),
+		Category:         req.Category,
+		Priority:         req.Priority,
+		TenantID:         n.tenantOf(ctx),
+		Metadata:         req.Metadata,
+		ExpiresInSeconds: req.ExpiresInSeconds,
+		Recipient:        recipientHint(ctx, req.UserID, "push"),
+	}
+	status, responseMessage := "queued", "Push notification queued successfully"
+	if decision.Verdict == Defer {
+		message.ScheduledFor = decision.Until
+		status, responseMessage = "deferred", "Push notification deferred "+decision.Reason
+	}
+	needsApproval, err := n.requiresApproval(ctx, req.TemplateID)
+	if err != nil {
+		log.Printf("failed to check approval policy for %s: %v", req.TemplateID, err)
+		middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Code:    models.CodeServiceUnavailable,
+			Error:   "Template approval policy unavailable",
+			Message: "Service unavailable",
+		})
+		return
+	}
+	suppressionKey := n.tenantKey(ctx, dedupeKey(req.UserID, req.TemplateID, "push"))
+	dedupeWindow := n.dedupeWindow(req.DedupeWindowSeconds)
+	if originalID, suppressed := n.claimDedupe(ctx, suppressionKey, notificationID, dedupeWindow); suppressed {
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Code:    models.CodeDuplicateRequest,
+			Message: "Duplicate push notification suppressed",
+			Data: models.NotificationResponse{
+				NotificationID: originalID,
+				Status:         "suppressed",
+				QueuedAt:       now,
+			},
+		})
+		return
+	}
+	record := models.NotificationStatus{
+		ID:            notificationID,
+		TenantID:      message.TenantID,
+		UserID:        req.UserID,
+		TemplateID:    req.TemplateID,
+		Variables:     message.Variables,
+		Category:      message.Category,
+		Priority:      message.Priority,
+		Metadata:      message.Metadata,
+		Type:          "push",
+		Queue:         n.pushQueue(),
+		Status:        status,
+		TargetDevices: len(req.DeviceTokens),
+		ScheduledFor:  message.ScheduledFor,
+		Locale:        message.Locale,
+		PolicyReason:  deferReason(decision),
+		CreatedBy:     middleware.CallerID(c),
+		CorrelationID: correlationID,
+		Delivery:      deliveryOf(message),
+	}
+	if needsApproval {
+		if err := n.holdForApproval(ctx, message, record); err != nil {
+			n.releaseDedupe(ctx, suppressionKey, notificationID, dedupeWindow)
+			log.Printf("failed to hold push notification for approval: %v", err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "failed to hold notification for approval",
+				Message: "Internal Server Error",
+			})
+			return
+		}
+		middleware.WriteResponse(c, http.StatusAccepted, models.APIResponse{
+			Success:  true,
+			Message:  "Push notification held for approval",
+			Warnings: warnings,
+			Data: models.NotificationResponse{
+				NotificationID: notificationID,
+				Status:         "pending_approval",
+				QueuedAt:       n.clock.Now(),
+				ScheduledFor:   message.ScheduledFor,
+			},
+		})
+		return
+	}
+	endValidation()
+	publishCtx, endPublish, ok := startPhase(c, sendCtx, sendBudget, budget.Publish)
+	if !ok {
+		n.releaseDedupe(sendCtx, suppressionKey, notificationID, dedupeWindow)
+		return
+	}
+	buffered, err := n.publishOrBuffer(publishCtx, n.rabbitClient.PublishPushNot, n.pushQueue(), message, record)
+	endPublish()
+	if err != nil {
+		n.releaseDedupe(sendCtx, suppressionKey, notificationID, dedupeWindow)
+		log.Printf("failed to publish push notification")
+		writePublishError(c, err, "failed to queue push notification")
+		return
+	}
+	code := http.StatusOK
+	if buffered {
+		code, status, responseMessage = http.StatusAccepted, outboxStatus, "Push notification accepted, to be queued once the broker is back"
+	} else if !n.persistStatus(c, sendCtx, sendBudget, record) {
+		return
+	}
+	usage.MarkQueued(c, 1)
+	middleware.WriteResponse(c, code, models.APIResponse{
+		Success:  true,
+		Message:  responseMessage,
+		Warnings: warnings,
+		Data: models.NotificationResponse{
+			NotificationID: notificationID,
+			Status:         status,
+			QueuedAt:       n.clock.Now(),
+			ScheduledFor:   message.ScheduledFor,
+		},
+	})
+
+}
+
+// CheckIdempoteny claims notificationID for a send accepted at acceptedAt.
+// It reports a repeat as a duplicate, with the record of the send that
+// claimed the ID. A Redis failure is returned for the caller to decide on.
+func (n *NotificationHandler) CheckIdempoteny(ctx context.Context, notificationID string, acceptedAt time.Time) (models.IdempotencyRecord, bool, error) {
+	key := n.idempotency.Key(ctx, notificationID)
+	if cached, ok := n.hotCache.Get(key); ok {
+		return store.ParseIdempotencyRecord(notificationID, cached), true, nil
+	}
+	holder, claimed, err := n.idempotency.Claim(ctx, models.IdempotencyRecord{NotificationID: notificationID, AcceptedAt: acceptedAt})
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	if payload, err := json.Marshal(holder); err == nil {
+		n.hotCache.Set(key, string(payload))
+	}
+	return holder, !claimed, nil
+}
+
+// claimNotification claims notificationID for the send c carries. A repeat
+// is answered with the send that claimed it first. When Redis can't be
+// asked, the send goes ahead with notifications.idempotency_fail_open and
+// is refused with a 503 otherwise. It returns whether to go on.
+func (n *NotificationHandler) claimNotification(c *gin.Context, notificationID string, acceptedAt time.Time) bool {
+	if n.statuses.Degraded() {
+		// Redis is known to be down; StorageGate let the send through
+		return true
+	}
+	holder, duplicate, err := n.CheckIdempoteny(c.Request.Context(), notificationID, acceptedAt)
+	switch {
+	case err != nil && n.cfg.IdempotencyFailOpen:
+		log.Printf("idempotency check unavailable, sending %s anyway: %v", notificationID, err)
+	case err != nil:
+		log.Printf("idempotency check failed: %v", err)
+		middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Code:    models.CodeServiceUnavailable,
+			Error:   "Idempotency check unavailable",
+			Message: "Service unavailable",
+		})
+		return false
+	case duplicate:
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Notification Already Processed",
+			Data: models.NotificationResponse{
+				NotificationID: holder.NotificationID,
+				Status:         "processing",
+				QueuedAt:       holder.AcceptedAt,
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// defaultStatusTTL and defaultIdempotencyTTL are the TTLs when
+// notifications.status_ttl and notifications.idempotency_ttl are unset.
+const (
+	defaultStatusTTL      = 24 * time.Hour
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// statusKey is where a notification's status record is stored. Everything
+// reading or writing the record goes through it.
+func (n *NotificationHandler) statusKey(ctx context.Context, notificationID string) string {
+	return n.statuses.Key(ctx, notificationID)
+}
+
+func (n *NotificationHandler) storeNotificationStatus(ctx context.Context, statusData models.NotificationStatus) error {
+	return n.storeNotificationStatuses(ctx, []models.NotificationStatus{statusData})
+}
+
+// storeNotificationStatuses stores new status records with their indexes
+// and "created" history entries. The records go in one transaction and the
+// history in two more round trips, so a batch costs what a single send does.
+func (n *NotificationHandler) storeNotificationStatuses(ctx context.Context, records []models.NotificationStatus) error {
+	now := n.clock.Now()
+	records = slices.Clone(records)
+	for i := range records {
+		records[i].CreatedAt = now
+		records[i].UpdatedAt = now
+	}
+	if _, err := n.statuses.StoreMany(ctx, records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		n.archiveStatus(ctx, record)
+	}
+	if n.statuses.Degraded() {
+		// kept in memory; the history and events need Redis too
+		return nil
+	}
+	ids := make([]string, len(records))
+	entries := make([]models.HistoryEntry, len(records))
+	for i, record := range records {
+		n.hotCache.Delete(n.statusKey(ctx, record.ID))
+		n.publishStatusEvent(ctx, record, "")
+		ids[i] = record.ID
+		entries[i] = models.HistoryEntry{Action: "created", Status: record.Status, Actor: record.CreatedBy}
+	}
+	if err := n.recordHistories(ctx, ids, entries); err != nil {
+		log.Printf("failed to record history for %d notifications: %v", len(ids), err)
+	}
+	return nil
+}
+
+// statusWrites queues what goes with a new status record in its
+// transaction: its indexes and the update to the record's watchers.
+func (n *NotificationHandler) statusWrites(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, recordJSON []byte) {
+	n.indexMetadata(ctx, pipe, record.ID, record.Metadata)
+	n.indexCorrelation(ctx, pipe, record.ID, record.CorrelationID)
+	n.indexGroup(ctx, pipe, record.ID, record.GroupID)
+	n.indexUser(ctx, pipe, record.ID, record.UserID, record.CreatedAt)
+	pipe.Publish(ctx, n.tenantKey(ctx, statusChannel(record.ID)), recordJSON)
+}
+
+// deliveryOf is what a status record keeps of message beyond its own
+// fields; nil when there is nothing.
+func deliveryOf(message models.NotificationMessage) *models.Delivery {
+	delivery := models.Delivery{
+		Attachments:  message.Attachments,
+		CC:           message.CC,
+		BCC:          message.BCC,
+		DeviceTokens: message.DeviceTokens,
+		Platform:     message.Platform,
+		Recipient:    message.Recipient,
+	}
+	if len(delivery.Attachments) == 0 && len(delivery.CC) == 0 && len(delivery.BCC) == 0 &&
+		len(delivery.DeviceTokens) == 0 && delivery.Platform == "" && delivery.Recipient == nil {
+		return nil
+	}
+	return &delivery
+}
+
+// withDelivery puts what delivery kept back on message.
+func withDelivery(message models.NotificationMessage, delivery *models.Delivery) models.NotificationMessage {
+	if delivery != nil {
+		message.Attachments = delivery.Attachments
+		message.CC = delivery.CC
+		message.BCC = delivery.BCC
+		message.DeviceTokens = delivery.DeviceTokens
+		message.Platform = delivery.Platform
+		message.Recipient = delivery.Recipient
+	}
+	return message
+}
+
+// updateStatus changes notificationID's record through the status store.
+// The record's watchers are told in the same transaction, with whatever
+// else with queues.
+func (n *NotificationHandler) updateStatus(ctx context.Context, notificationID string, change store.StatusChange, with store.StatusWrites) error {
+	err := n.statuses.Update(ctx, notificationID, change, func(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, recordJSON []byte) {
+		pipe.Publish(ctx, n.tenantKey(ctx, statusChannel(notificationID)), recordJSON)
+		if with != nil {
+			with(ctx, pipe, record, recordJSON)
+		}
+	})
+	n.hotCache.Delete(n.statusKey(ctx, notificationID))
+	return err
+}
+
+// GetStatus returns a notification's status record and, with
+// ?include=history, its history in sequence order.
+func (n *NotificationHandler) GetStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+
+	if notificationID == "" {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   "Notification ID required",
+			Message: "Invalid request",
+		})
+		return
+	}
+
+	// Get status from the hot cache, falling back to the status store
+	statusKey := n.statusKey(ctx, notificationID)
+	statusJSON, cached := n.hotCache.Get(statusKey)
+	var source string
+	if !cached {
+		var err error
+		statusJSON, err = n.statuses.Get(ctx, notificationID)
+		// expired from Redis, or out of reach: the archive may have it
+		if err == redis.Nil || errors.Is(err, store.ErrStorageDegraded) {
+			if archived, ok := n.archivedStatus(ctx, notificationID); ok {
+				statusJSON, source, err = archived, sourceArchive, nil
+			}
+		}
+		if errors.Is(err, store.ErrStorageDegraded) {
+			writeStorageDegraded(c)
+			return
+		}
+		if err == redis.Nil {
+			middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Code:    models.CodeNotificationNotFound,
+				Error:   "Notification not found",
+				Message: "Not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Print("Failed to get notification status")
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "Failed to retrieve status",
+				Message: "Internal server error",
+			})
+			return
+		}
+		if source == "" {
+			n.hotCache.Set(statusKey, statusJSON)
+		}
+	}
+
+	if n.statuses.Degraded() {
+		middleware.MarkStorageDegraded(c)
+	}
+
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+		log.Print("Failed to unmarshal status")
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to parse status",
+			Message: "Internal server error",
+		})
+		return
+	}
+	// answer like a missing record so IDs can't be probed for existence
+	if !n.canRead(c, status) {
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Notification not found",
+			Message: "Not found",
+		})
+		return
+	}
+	status = n.shape(n.statusView(c), status)
+
+	// the history costs a read the hot cache can't absorb, so it is opt-in
+	if c.Query("include") == "history" {
+		history, err := n.history(ctx, notificationID)
+		if err != nil {
+			log.Printf("failed to read history for %s: %v", notificationID, err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "Failed to retrieve history",
+				Message: "Internal server error",
+			})
+			return
+		}
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Status retrieved successfully",
+			Data:    statusWithHistory{NotificationStatus: status, History: history},
+			Source:  source,
+		})
+		return
+	}
+
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Status retrieved successfully",
+		Data:    status,
+		Source:  source,
+	})
+}
+
+// statusWithHistory is the status response with ?include=history.
+type statusWithHistory struct {
+	models.NotificationStatus
+	History []models.HistoryEntry `json:"history"`
+}
+
+// HeadStatus answers whether a notification exists without sending the
+// record, with its status in X-Notification-Status. The record is read for
+// every caller, read-all ones included, and only shown to those who may see
+// it, so GetStatus's anti-probing rule holds. Like GetStatus, a record gone
+// from Redis, or out of reach, is looked for in the archive.
+func (n *NotificationHandler) HeadStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+	statusKey := n.statusKey(ctx, notificationID)
+
+	statusJSON, cached := n.hotCache.Get(statusKey)
+	if !cached {
+		var err error
+		var archived bool
+		statusJSON, err = n.statuses.Get(ctx, notificationID)
+		if err == redis.Nil || errors.Is(err, store.ErrStorageDegraded) {
+			statusJSON, archived = n.archivedStatus(ctx, notificationID)
+			if archived {
+				err = nil
+			}
+		}
+		if err == redis.Nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrStorageDegraded) {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			log.Printf("failed to get notification status: %v", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if !archived {
+			n.hotCache.Set(statusKey, statusJSON)
+		}
+	}
+
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+		log.Print("Failed to unmarshal status")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if !n.canRead(c, status) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("X-Notification-Status", status.Status)
+	c.Status(http.StatusOK)
+}
+
+// canRead reports whether the caller may see a status record. Records of
+// another tenant are never visible. Within a tenant, callers only
+// see what they created unless they hold the read-all scope. Records written
+// before the creator was stored are open to everyone unless the legacy switch
+// restricts them to read-all holders.
+func (n *NotificationHandler) canRead(c *gin.Context, status models.NotificationStatus) bool {
+	if !n.sameTenant(c, status) {
+		return false
+	}
+	if middleware.CallerHasScope(c, middleware.ReadAllScope) {
+		return true
+	}
+	if status.CreatedBy == "" {
+		return !n.cfg.LegacyStatusReadAllOnly
+	}
+	return status.CreatedBy == middleware.CallerID(c)
+}
+
+// GetCacheStats reports the hit ratio of the in-process hot cache.
+func (n *NotificationHandler) GetCacheStats(c *gin.Context) {
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Cache stats retrieved successfully",
+		Data:    n.hotCache.Stats(),
+	})
+}
@@ -0,0 +1,733 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	// tests are in the same package; do not import the package under test
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Mock RabbitMQ Client
+type MockRabbitMQClient struct {
+	mock.Mock
+}
+
+func (m *MockRabbitMQClient) PublishEmail(ctx context.Context, message interface{}) error {
+	args := m.Called(ctx, message)
+	return args.Error(0)
+}
+
+func (m *MockRabbitMQClient) PublishPushNot(ctx context.Context, message interface{}) error {
+	args := m.Called(ctx, message)
+	return args.Error(0)
+}
+
+func (m *MockRabbitMQClient) PublishWhatsApp(ctx context.Context, message interface{}) error {
+	args := m.Called(ctx, message)
+	return args.Error(0)
+}
+
+func (m *MockRabbitMQClient) IsConnected() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+// Mock User Service
+type MockUserService struct {
+	mock.Mock
+}
+
+func (m *MockUserService) ValidateUser(ctx context.Context, userID string) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserService) GetPreferences(ctx context.Context, userID string) (models.Preferences, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(models.Preferences), args.Error(1)
+}
+
+// localeUserService also reports a preferred locale.
+type localeUserService struct {
+	MockUserService
+}
+
+func (m *localeUserService) GetPreferredLocale(ctx context.Context, userID string) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+// Mock Template Service
+type MockTemplateService struct {
+	mock.Mock
+}
+
+func (m *MockTemplateService) ValidateTemplate(ctx context.Context, templateID string) (bool, error) {
+	args := m.Called(ctx, templateID)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestSendEmail_RecipientOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	// The user must still exist even when the destination is overridden
+	mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "welcome_email").Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+		return msg.Overrides != nil && msg.Overrides.RecipientEmail == "qa@example.com"
+	})).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/email", handler.SendEmail)
+
+	reqBody := models.SendEmailRequest{
+		UserID:         "user123",
+		TemplateID:     "welcome_email",
+		RecipientEmail: "qa@example.com",
+	}
+	body, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	notificationID := response.Data.(map[string]interface{})["notification_id"].(string)
+
+	// The override must be recorded on the stored status for audits
+	statusJSON, err := mockRedis.Get(context.Background(), "notification:status:"+notificationID).Result()
+	assert.NoError(t, err)
+	var status models.NotificationStatus
+	json.Unmarshal([]byte(statusJSON), &status)
+	if assert.NotNil(t, status.Overrides) {
+		assert.Equal(t, "qa@example.com", status.Overrides.RecipientEmail)
+	}
+
+	mockUserService.AssertExpectations(t)
+	mockQueue.AssertExpectations(t)
+}
+
+func TestSendEmail_InvalidRecipientEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/email", handler.SendEmail)
+
+	reqBody := models.SendEmailRequest{
+		UserID:         "user123",
+		TemplateID:     "welcome_email",
+		RecipientEmail: "not-an-email",
+	}
+	body, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockUserService.AssertNotCalled(t, "ValidateUser", mock.Anything, mock.Anything)
+	mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+}
+
+func TestSendEmail_AttachmentsForwarded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	attachment := models.Attachment{
+		URL:         "https://files.example.com/receipts/42.pdf",
+		Filename:    "receipt-42.pdf",
+		ContentType: "application/pdf",
+	}
+	mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "receipt").Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+		return len(msg.Attachments) == 1 && msg.Attachments[0] == attachment
+	})).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/email", handler.SendEmail)
+
+	reqBody := models.SendEmailRequest{
+		UserID:      "user123",
+		TemplateID:  "receipt",
+		Attachments: []models.Attachment{attachment},
+	}
+	body, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockQueue.AssertExpectations(t)
+}
+
+func TestSendEmail_InvalidAttachments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	valid := models.Attachment{URL: "https://files.example.com/a.pdf", Filename: "a.pdf", ContentType: "application/pdf"}
+	tests := []struct {
+		name        string
+		attachments []models.Attachment
+		fields      []string
+	}{
+		{
+			name:        "plain http",
+			attachments: []models.Attachment{{URL: "http://files.example.com/a.pdf", Filename: "a.pdf", ContentType: "application/pdf"}},
+			fields:      []string{"attachments[0].url"},
+		},
+		{
+			name:        "path traversal filename",
+			attachments: []models.Attachment{valid, {URL: "https://files.example.com/b.pdf", Filename: "../etc/passwd", ContentType: "application/pdf"}},
+			fields:      []string{"attachments[1].filename"},
+		},
+		{
+			name:        "malformed entry",
+			attachments: []models.Attachment{{URL: "not a url", Filename: "", ContentType: "pdf/"}},
+			fields:      []string{"attachments[0].url", "attachments[0].filename", "attachments[0].content_type"},
+		},
+		{
+			name:        "too many",
+			attachments: []models.Attachment{valid, valid, valid, valid, valid, valid},
+			fields:      []string{"attachments"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQueue := new(MockRabbitMQClient)
+			mockUserService := new(MockUserService)
+			handler := NewNotificationService(
+				mockQueue,
+				setupMockRedis(),
+				mockUserService,
+				new(MockTemplateService),
+				config.NotificationsConfig{},
+			)
+
+			router := gin.New()
+			router.POST("/notifications/email", handler.SendEmail)
+
+			body, _ := json.Marshal(models.SendEmailRequest{
+				UserID:      "user123",
+				TemplateID:  "receipt",
+				Attachments: tt.attachments,
+			})
+			req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response struct {
+				Data []models.FieldError `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			var fields []string
+			for _, fe := range response.Data {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+			mockUserService.AssertNotCalled(t, "ValidateUser", mock.Anything, mock.Anything)
+			mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSendPush_RejectsAttachments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	handler := NewNotificationService(
+		mockQueue,
+		setupMockRedis(),
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/push", handler.SendPush)
+
+	body, _ := json.Marshal(models.SendPushRequest{
+		UserID:      "user123",
+		TemplateID:  "promo",
+		Attachments: []models.Attachment{{URL: "https://files.example.com/a.pdf", Filename: "a.pdf", ContentType: "application/pdf"}},
+	})
+	req, _ := http.NewRequest("POST", "/notifications/push", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockQueue.AssertNotCalled(t, "PublishPushNot", mock.Anything, mock.Anything)
+}
+
+func TestSendEmail_CCAndBCC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "invoice").Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+		return assert.ObjectsAreEqual([]string{"billing-1", "billing-2"}, msg.CC) &&
+			assert.ObjectsAreEqual([]string{"audit-1"}, msg.BCC)
+	})).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/email", handler.SendEmail)
+
+	body, _ := json.Marshal(models.SendEmailRequest{
+		UserID:     "owner",
+		TemplateID: "invoice",
+		CC:         []string{"billing-1", "billing-2"},
+		BCC:        []string{"audit-1"},
+	})
+	req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockQueue.AssertExpectations(t)
+	mockUserService.AssertNumberOfCalls(t, "ValidateUser", 4)
+
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	notificationID := response.Data.(map[string]interface{})["notification_id"].(string)
+
+	statusJSON, _ := mockRedis.Get(context.Background(), "notification:status:"+notificationID).Result()
+	var status models.NotificationStatus
+	json.Unmarshal([]byte(statusJSON), &status)
+	assert.Equal(t, &models.RecipientCounts{To: 1, CC: 2, BCC: 1}, status.Recipients)
+}
+
+func TestSendEmail_InvalidCCRecipients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, "owner").Return(true, nil)
+	mockUserService.On("ValidateUser", mock.Anything, "billing-1").Return(true, nil)
+	mockUserService.On("ValidateUser", mock.Anything, "ghost").Return(false, nil)
+	mockUserService.On("ValidateUser", mock.Anything, "broken").Return(false, fmt.Errorf("user service down"))
+
+	handler := NewNotificationService(
+		mockQueue,
+		setupMockRedis(),
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/email", handler.SendEmail)
+
+	body, _ := json.Marshal(models.SendEmailRequest{
+		UserID:     "owner",
+		TemplateID: "invoice",
+		CC:         []string{"billing-1", "ghost"},
+		BCC:        []string{"broken"},
+	})
+	req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response struct {
+		Data []models.FieldError `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if assert.Len(t, response.Data, 2) {
+		assert.Equal(t, "cc[1]", response.Data[0].Field)
+		assert.Contains(t, response.Data[0].Message, "ghost")
+		assert.Equal(t, "bcc[0]", response.Data[1].Field)
+		assert.Contains(t, response.Data[1].Message, "broken")
+	}
+	mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+}
+
+func TestSendEmail_TooManyExtraRecipients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockUserService := new(MockUserService)
+	mockUserService.On("ValidateUser", mock.Anything, "owner").Return(true, nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		setupMockRedis(),
+		mockUserService,
+		new(MockTemplateService),
+		config.NotificationsConfig{MaxExtraRecipients: 2},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/email", handler.SendEmail)
+
+	body, _ := json.Marshal(models.SendEmailRequest{
+		UserID:     "owner",
+		TemplateID: "invoice",
+		CC:         []string{"a", "b"},
+		BCC:        []string{"c"},
+	})
+	req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	// the cap is enforced before any CC/BCC lookup is made
+	mockUserService.AssertNumberOfCalls(t, "ValidateUser", 1)
+	mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+}
+
+func TestSendPush_DeviceTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	tokens := []string{"fcm-token:APA91bHun4MxP5egoKMwt2KZFBaFUH", "fcm-token:APA91bE9qxyz0123456789"}
+	mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, "promo").Return(true, nil)
+	mockQueue.On("PublishPushNot", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+		return assert.ObjectsAreEqual(tokens, msg.DeviceTokens) && msg.Platform == "android"
+	})).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/push", handler.SendPush)
+
+	body, _ := json.Marshal(models.SendPushRequest{
+		UserID:       "user123",
+		TemplateID:   "promo",
+		DeviceTokens: tokens,
+		Platform:     "android",
+	})
+	req, _ := http.NewRequest("POST", "/notifications/push", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockQueue.AssertExpectations(t)
+
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	notificationID := response.Data.(map[string]interface{})["notification_id"].(string)
+
+	statusJSON, _ := mockRedis.Get(context.Background(), "notification:status:"+notificationID).Result()
+	var status models.NotificationStatus
+	json.Unmarshal([]byte(statusJSON), &status)
+	assert.Equal(t, 2, status.TargetDevices)
+}
+
+func TestSendPush_InvalidDeviceTargeting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tooMany := make([]string, 21)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("device-token-%02d", i)
+	}
+	tests := []struct {
+		name string
+		req  models.SendPushRequest
+	}{
+		{"malformed token", models.SendPushRequest{UserID: "u", TemplateID: "t", DeviceTokens: []string{"has spaces in it"}}},
+		{"too short", models.SendPushRequest{UserID: "u", TemplateID: "t", DeviceTokens: []string{"abc"}}},
+		{"too many tokens", models.SendPushRequest{UserID: "u", TemplateID: "t", DeviceTokens: tooMany}},
+		{"unknown platform", models.SendPushRequest{UserID: "u", TemplateID: "t", Platform: "blackberry"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQueue := new(MockRabbitMQClient)
+			handler := NewNotificationService(
+				mockQueue,
+				setupMockRedis(),
+				new(MockUserService),
+				new(MockTemplateService),
+				config.NotificationsConfig{},
+			)
+
+			router := gin.New()
+			router.POST("/notifications/push", handler.SendPush)
+
+			body, _ := json.Marshal(tt.req)
+			req, _ := http.NewRequest("POST", "/notifications/push", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockQueue.AssertNotCalled(t, "PublishPushNot", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSendEmail_LocaleSelection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		requested string
+		preferred string
+		cfg       config.NotificationsConfig
+		want      string
+	}{
+		{"explicit locale is canonicalized", "pt-br", "fr", config.NotificationsConfig{}, "pt-BR"},
+		{"falls back to user preference", "", "fr", config.NotificationsConfig{}, "fr"},
+		{"falls back to configured default", "", "", config.NotificationsConfig{DefaultLocale: "de"}, "de"},
+		{"falls back to en", "", "", config.NotificationsConfig{}, "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQueue := new(MockRabbitMQClient)
+			userService := new(localeUserService)
+			mockTemplateService := new(MockTemplateService)
+
+			userService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+			userService.On("GetPreferredLocale", mock.Anything, "user123").Return(tt.preferred, nil)
+			mockTemplateService.On("ValidateTemplate", mock.Anything, "welcome_email").Return(true, nil)
+			mockQueue.On("PublishEmail", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+				return msg.Locale == tt.want
+			})).Return(nil)
+
+			handler := NewNotificationService(mockQueue, setupMockRedis(), userService, mockTemplateService, tt.cfg)
+
+			router := gin.New()
+			router.POST("/notifications/email", handler.SendEmail)
+
+			body, _ := json.Marshal(models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email", Locale: tt.requested})
+			req, _ := http.NewRequest("POST", "/notifications/email", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			mockQueue.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSendPush_InvalidLocale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	handler := NewNotificationService(
+		mockQueue,
+		setupMockRedis(),
+		new(MockUserService),
+		new(MockTemplateService),
+		config.NotificationsConfig{},
+	)
+
+	router := gin.New()
+	router.POST("/notifications/push", handler.SendPush)
+
+	body, _ := json.Marshal(models.SendPushRequest{UserID: "u", TemplateID: "t", Locale: "not a locale"})
+	req, _ := http.NewRequest("POST", "/notifications/push", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, models.CodeValidationError, response.Code)
+	mockQueue.AssertNotCalled(t, "PublishPushNot", mock.Anything, mock.Anything)
+}
+
+func TestSend_MarketingOptOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(handler *NotificationHandler, path string, body interface{}) (int, models.APIResponse) {
+		router := gin.New()
+		router.POST("/notifications/email", handler.SendEmail)
+		router.POST("/notifications/push", handler.SendPush)
+
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	t.Run("marketing email to an opted-out user is refused", func(t *testing.T) {
+		mockQueue := new(MockRabbitMQClient)
+		mockUserService := new(MockUserService)
+		mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+		mockUserService.On("GetPreferences", mock.Anything, "user123").Return(models.Preferences{EmailOptOut: true}, nil).Once()
+		handler := NewNotificationService(mockQueue, setupMockRedis(), mockUserService, new(MockTemplateService), config.NotificationsConfig{})
+
+		code, response := send(handler, "/notifications/email", models.SendEmailRequest{UserID: "user123", TemplateID: "promo", Category: "marketing"})
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		assert.Equal(t, models.CodeUserOptedOut, response.Code)
+
+		// The second lookup is served from the Redis cache
+		code, _ = send(handler, "/notifications/email", models.SendEmailRequest{UserID: "user123", TemplateID: "promo", Category: "marketing"})
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		mockUserService.AssertExpectations(t)
+		mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("opt-out is per channel", func(t *testing.T) {
+		mockQueue := new(MockRabbitMQClient)
+		mockUserService := new(MockUserService)
+		mockTemplateService := new(MockTemplateService)
+		mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+		mockUserService.On("GetPreferences", mock.Anything, "user123").Return(models.Preferences{EmailOptOut: true}, nil)
+		mockTemplateService.On("ValidateTemplate", mock.Anything, "promo").Return(true, nil)
+		mockQueue.On("PublishPushNot", mock.Anything, mock.MatchedBy(func(msg models.NotificationMessage) bool {
+			return msg.Category == "marketing"
+		})).Return(nil)
+		handler := NewNotificationService(mockQueue, setupMockRedis(), mockUserService, mockTemplateService, config.NotificationsConfig{})
+
+		code, _ := send(handler, "/notifications/push", models.SendPushRequest{UserID: "user123", TemplateID: "promo", Category: "marketing"})
+		assert.Equal(t, http.StatusOK, code)
+		mockQueue.AssertExpectations(t)
+	})
+
+	t.Run("transactional mail ignores the opt-out", func(t *testing.T) {
+		mockQueue := new(MockRabbitMQClient)
+		mockUserService := new(MockUserService)
+		mockTemplateService := new(MockTemplateService)
+		mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+		mockTemplateService.On("ValidateTemplate", mock.Anything, "receipt").Return(true, nil)
+		mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+		handler := NewNotificationService(mockQueue, setupMockRedis(), mockUserService, mockTemplateService, config.NotificationsConfig{})
+
+		code, _ := send(handler, "/notifications/email", models.SendEmailRequest{UserID: "user123", TemplateID: "receipt", Category: "transactional"})
+		assert.Equal(t, http.StatusOK, code)
+		mockUserService.AssertNotCalled(t, "GetPreferences", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown preferences hold marketing back", func(t *testing.T) {
+		mockQueue := new(MockRabbitMQClient)
+		mockUserService := new(MockUserService)
+		mockUserService.On("ValidateUser", mock.Anything, "user123").Return(true, nil)
+		mockUserService.On("GetPreferences", mock.Anything, "user123").Return(models.Preferences{}, fmt.Errorf("user service down"))
+		handler := NewNotificationService(mockQueue, setupMockRedis(), mockUserService, new(MockTemplateService), config.NotificationsConfig{})
+
+		code, _ := send(handler, "/notifications/email", models.SendEmailRequest{UserID: "user123", TemplateID: "promo", Category: "marketing"})
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		mockQueue.AssertNotCalled(t, "PublishEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown category", func(t *testing.T) {
+		handler := NewNotificationService(new(MockRabbitMQClient), setupMockRedis(), new(MockUserService), new(MockTemplateService), config.NotificationsConfig{})
+		code, _ := send(handler, "/notifications/email", models.SendEmailRequest{UserID: "user123", TemplateID: "promo", Category: "newsletter"})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func setupMockRedis() *redis.Client {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	return rdb
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// outboxStatus is the status of a send kept in the outbox until the broker
+// takes it.
+const outboxStatus = "accepted_pending"
+
+// outboxLockTTL bounds how long one gateway holds a queue's outbox while it
+// flushes it, should it die mid-flush.
+const outboxLockTTL = 30 * time.Second
+
+// ErrOutboxFull is returned for a send the broker couldn't take when its
+// queue's outbox is at notifications.outbox_max_length.
+var ErrOutboxFull = errors.New("notification outbox is full")
+
+// outboxEntry is a send kept in the outbox, with the status it gets once
+// it is published.
+type outboxEntry struct {
+	Status  string                     `json:"status" pii:"none"`
+	Message models.NotificationMessage `json:"message" pii:"nested"`
+}
+
+// outboxKey is the Redis list of a queue's outbox. The outboxes are shared
+// by all tenants so each queue's sends are flushed in the order they came.
+func outboxKey(name string) string {
+	return fmt.Sprintf("notification:outbox:%s", name)
+}
+
+// outboxName is the outbox of sends to queueName, named for the
+// notification type when the queue client doesn't name its queues.
+func outboxName(queueName, notificationType string) string {
+	if queueName != "" {
+		return queueName
+	}
+	return notificationType
+}
+
+// outboxNames lists the outbox of every queue the handlers publish to.
+func (n *NotificationHandler) outboxNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, notificationType := range []string{"email", "push", "whatsapp"} {
+		_, queueName := n.publisherFor(notificationType)
+		name := outboxName(queueName, notificationType)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// retriablePublishError reports whether a publish failed because the broker
+// can't be reached for now, rather than because of the message.
+func retriablePublishError(err error) bool {
+	return errors.Is(err, queue.ErrNotConnected) ||
+		errors.Is(err, queue.ErrShuttingDown) ||
+		errors.Is(err, queue.ErrConfirmChannelClosed) ||
+		errors.Is(err, queue.ErrPublishNacked)
+}
+
+// publishOrBuffer publishes message like publishMessage. When the broker
+// can't be reached and the outbox is on, it instead stores record with
+// status accepted_pending and appends the message to its queue's outbox,
+// reporting buffered; the record's own status is what the flusher sets
+// once the message is published. A full outbox fails with ErrOutboxFull.
+func (n *NotificationHandler) publishOrBuffer(ctx context.Context, publish func(context.Context, interface{}) error, queueName string, message models.NotificationMessage, record models.NotificationStatus) (bool, error) {
+	err := n.publishMessage(ctx, publish, queueName, message)
+	if err == nil || n.cfg.OutboxMaxLength <= 0 || !retriablePublishError(err) {
+		return false, err
+	}
+	key := n.keys.Key(outboxKey(outboxName(queueName, message.Type)))
+	// the cap is checked before the push, so concurrent sends may overshoot
+	// it by a few
+	depth, lenErr := n.redis.LLen(ctx, key).Result()
+	if lenErr != nil {
+		return false, fmt.Errorf("%w; outbox unavailable: %v", err, lenErr)
+	}
+	if depth >= n.cfg.OutboxMaxLength {
+		return false, fmt.Errorf("%w: %v", ErrOutboxFull, err)
+	}
+	entry, marshalErr := json.Marshal(outboxEntry{Status: record.Status, Message: message})
+	if marshalErr != nil {
+		return false, marshalErr
+	}
+	// the status goes first so the flusher always finds it to update
+	record.Status = outboxStatus
+	if storeErr := n.storeNotificationStatus(ctx, record); storeErr != nil {
+		log.Printf("failed to log notification status: %v", storeErr)
+	}
+	if pushErr := n.redis.RPush(ctx, key, entry).Err(); pushErr != nil {
+		if statusErr := n.transitionStatus(ctx, message.ID, "failed"); statusErr != nil {
+			log.Printf("failed to fail status of %s: %v", message.ID, statusErr)
+		}
+		return false, fmt.Errorf("%w; outbox unavailable: %v", err, pushErr)
+	}
+	log.Printf("broker unavailable, notification %s kept in the outbox: %v", message.ID, err)
+	return true, nil
+}
+
+// writePublishError answers a send whose publish failed: 503 when the
+// outbox is full, otherwise 500 with description.
+func writePublishError(c *gin.Context, err error, description string) {
+	if errors.Is(err, ErrOutboxFull) {
+		middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Code:    models.CodeServiceUnavailable,
+			Error:   "Notification queue unavailable and outbox full",
+			Message: "Service unavailable",
+		})
+		return
+	}
+	middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+		Success: false,
+		Code:    models.CodeQueueUnavailable,
+		Error:   description,
+		Message: "Internal Server Error",
+	})
+}
+
+// OutboxDepth returns how many sends wait in each queue's outbox.
+func (n *NotificationHandler) OutboxDepth(ctx context.Context) (map[string]int64, error) {
+	names := n.outboxNames()
+	lengths := make([]*redis.IntCmd, len(names))
+	_, err := n.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, name := range names {
+			lengths[i] = pipe.LLen(ctx, n.keys.Key(outboxKey(name)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	depth := make(map[string]int64, len(names))
+	for i, name := range names {
+		depth[name] = lengths[i].Val()
+	}
+	return depth, nil
+}
+
+// RunOutboxFlusher drains the outboxes into the broker every
+// notifications.outbox_flush_interval until ctx is done. It returns at once
+// when the outbox is off.
+func (n *NotificationHandler) RunOutboxFlusher(ctx context.Context) {
+	if n.cfg.OutboxMaxLength <= 0 {
+		return
+	}
+	interval := n.cfg.OutboxFlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.FlushOutbox(ctx)
+		}
+	}
+}
+
+// FlushOutbox publishes what waits in the outboxes, oldest first, and sets
+// each status from accepted_pending to what it would have been. A queue's
+// flush stops at the first send the broker won't take, so none overtakes
+// another; it is tried again on the next flush. It returns how many sends
+// were published.
+func (n *NotificationHandler) FlushOutbox(ctx context.Context) int {
+	if !n.rabbitClient.IsConnected() {
+		return 0
+	}
+	flushed := 0
+	for _, name := range n.outboxNames() {
+		count, err := n.flushOutbox(ctx, name)
+		flushed += count
+		if err != nil {
+			log.Printf("outbox %s: flushed %d, stopped: %v", name, count, err)
+		}
+	}
+	return flushed
+}
+
+// flushOutbox drains one queue's outbox. It holds the queue's lock so only
+// one gateway flushes it at a time, and removes a send only once it is
+// published.
+func (n *NotificationHandler) flushOutbox(ctx context.Context, name string) (int, error) {
+	key := n.keys.Key(outboxKey(name))
+	lock := key + ":lock"
+	held, err := n.redis.SetNX(ctx, lock, 1, outboxLockTTL).Result()
+	if err != nil || !held {
+		return 0, err
+	}
+	defer n.redis.Del(context.WithoutCancel(ctx), lock)
+
+	flushed := 0
+	for ctx.Err() == nil {
+		raw, err := n.redis.LIndex(ctx, key, 0).Result()
+		if errors.Is(err, redis.Nil) {
+			return flushed, nil
+		}
+		if err != nil {
+			return flushed, err
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			log.Printf("dropping unreadable outbox entry from %s: %v", name, err)
+			if err := n.redis.LPop(ctx, key).Err(); err != nil {
+				return flushed, err
+			}
+			continue
+		}
+		msgCtx := middleware.WithTenant(ctx, entry.Message.TenantID)
+		publish, queueName := n.publisherFor(entry.Message.Type)
+		if err := n.publishMessage(msgCtx, publish, queueName, entry.Message); err != nil {
+			if retriablePublishError(err) {
+				return flushed, err
+			}
+			// the broker will never take it; it mustn't hold up the rest
+			log.Printf("dropping notification %s from outbox %s: %v", entry.Message.ID, name, err)
+			if err := n.redis.LPop(ctx, key).Err(); err != nil {
+				return flushed, err
+			}
+			if err := n.transitionStatusFrom(msgCtx, entry.Message.ID, outboxStatus, "failed"); err != nil && !errors.Is(err, redis.Nil) {
+				log.Printf("failed to fail status of %s: %v", entry.Message.ID, err)
+			}
+			continue
+		}
+		if err := n.redis.LPop(ctx, key).Err(); err != nil {
+			return flushed, err
+		}
+		flushed++
+		n.redis.Expire(ctx, lock, outboxLockTTL)
+
+		err = n.transitionStatusFrom(msgCtx, entry.Message.ID, outboxStatus, entry.Status)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("failed to update status of %s after flushing it: %v", entry.Message.ID, err)
+		}
+		history := models.HistoryEntry{Action: "flushed", Status: entry.Status, Actor: "outbox"}
+		if err := n.recordHistory(msgCtx, entry.Message.ID, history); err != nil {
+			log.Printf("failed to record history for %s: %v", entry.Message.ID, err)
+		}
+	}
+	return flushed, ctx.Err()
+}
@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outboxHarness is a harness whose broker is down, with room for max sends
+// in each outbox.
+func outboxHarness(t *testing.T, max int64) *handlertest.Harness {
+	return handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{OutboxMaxLength: max}).
+		WithQueueError(queue.ErrNotConnected).
+		Start(t)
+}
+
+func statusOf(h *handlertest.Harness, id string) string {
+	var status models.NotificationStatus
+	h.GET("/api/v1/notification/status/" + id).Decode(&status)
+	return status.Status
+}
+
+func TestOutbox_BufferedUntilBrokerBack(t *testing.T) {
+	h := outboxHarness(t, 10)
+	var ids []string
+	for _, templateID := range []string{"welcome_email", "receipt_email", "reset_email"} {
+		resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: templateID})
+		require.Equal(t, http.StatusAccepted, resp.Code, string(resp.Body))
+		var data models.NotificationResponse
+		resp.Decode(&data)
+		assert.Equal(t, "accepted_pending", data.Status)
+		ids = append(ids, data.NotificationID)
+	}
+	assert.Equal(t, "accepted_pending", statusOf(h, ids[0]))
+	outbox, err := h.Miniredis.List("notification:outbox:email")
+	require.NoError(t, err)
+	assert.Len(t, outbox, 3)
+
+	// still down: nothing leaves the outbox, nothing is reordered
+	assert.Zero(t, h.Handler.FlushOutbox(context.Background()))
+	outbox, _ = h.Miniredis.List("notification:outbox:email")
+	assert.Len(t, outbox, 3)
+
+	h.Queue.Err = nil
+	assert.Equal(t, 3, h.Handler.FlushOutbox(context.Background()))
+	var published []string
+	for _, msg := range h.Queue.Emails() {
+		published = append(published, msg.ID)
+	}
+	assert.Equal(t, ids, published, "flushed in the order accepted")
+	assert.False(t, h.Miniredis.Exists("notification:outbox:email"))
+	for _, id := range ids {
+		assert.Equal(t, "queued", statusOf(h, id))
+	}
+	assert.False(t, h.Miniredis.Exists("notification:outbox:email:lock"))
+}
+
+func TestOutbox_Full(t *testing.T) {
+	h := outboxHarness(t, 1)
+	first := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusAccepted, first.Code)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "receipt_email"})
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, models.CodeServiceUnavailable, resp.API().Code)
+
+	// each queue has its own outbox
+	push := h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "welcome_push"})
+	assert.Equal(t, http.StatusAccepted, push.Code, string(push.Body))
+}
+
+func TestOutbox_Off(t *testing.T) {
+	h := outboxHarness(t, 0)
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, models.CodeQueueUnavailable, resp.API().Code)
+	assert.False(t, h.Miniredis.Exists("notification:outbox:email"))
+}
+
+func TestOutbox_PermanentErrorNotBuffered(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{OutboxMaxLength: 10}).
+		WithQueueError(queue.ErrNoDelayExchange).
+		Start(t)
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.False(t, h.Miniredis.Exists("notification:outbox:email"))
+}
+
+func TestHealthCheck_OutboxDepth(t *testing.T) {
+	h := outboxHarness(t, 10)
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+
+	health := handlers.NewHealthHandler(brokerState{connected: true}, h.Redis,
+		services.NewUserServiceClient("", true), services.NewTemplateClient("", true))
+	health.WatchOutbox(h.Handler)
+	router := gin.New()
+	router.GET("/health", health.HealthCheck)
+	check := func() (string, map[string]int64) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body struct {
+			Checks map[string]string `json:"checks"`
+			Outbox map[string]int64  `json:"outbox"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Checks["outbox"], body.Outbox
+	}
+
+	status, depth := check()
+	assert.Equal(t, "degraded", status)
+	assert.Equal(t, map[string]int64{"email": 1, "push": 0, "whatsapp": 0}, depth)
+
+	h.Queue.Err = nil
+	h.Handler.FlushOutbox(context.Background())
+	status, depth = check()
+	assert.Equal(t, "healthy", status)
+	assert.Equal(t, int64(0), depth["email"])
+}
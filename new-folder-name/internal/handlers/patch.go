@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	errNotificationNotFound = errors.New("notification not found")
+	errNotScheduled         = errors.New("notification is not scheduled")
+)
+
+// PatchNotification changes the variables, send time or priority of a
+// notification that is still waiting to be dispatched. The record is
+// rewritten under WATCH, so if the dispatcher picks it up between our read
+// and write the update is refused rather than applied to a message that has
+// already gone out.
+func (n *NotificationHandler) PatchNotification(c *gin.Context) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+
+	var req models.PatchNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if req.Variables == nil && req.ScheduledFor == nil && req.Priority == nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   "at least one of variables, scheduled_for or priority is required",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if req.ScheduledFor != nil && !req.ScheduledFor.After(n.clock.Now()) {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    []models.FieldError{{Field: "scheduled_for", Message: "scheduled_for must be in the future"}},
+			Error:   "Invalid scheduled_for",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	var status models.NotificationStatus
+	err := n.updateStatus(ctx, notificationID, func(record *models.NotificationStatus) (bool, error) {
+		status = *record
+		if !n.canRead(c, status) {
+			return false, errNotificationNotFound
+		}
+		if status.Status != "scheduled" {
+			return false, errNotScheduled
+		}
+
+		if req.Variables != nil {
+			status.Variables = req.Variables
+		}
+		if req.ScheduledFor != nil {
+			scheduledFor := req.ScheduledFor.UTC()
+			status.ScheduledFor = &scheduledFor
+		}
+		if req.Priority != nil {
+			status.Priority = *req.Priority
+		}
+		status.UpdatedAt = n.clock.Now()
+		*record = status
+		return true, nil
+	}, nil)
+
+	switch {
+	case errors.Is(err, errNotificationNotFound), errors.Is(err, redis.Nil):
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Notification not found",
+			Message: "Not found",
+		})
+	case errors.Is(err, errNotScheduled):
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInvalidState,
+			Error:   fmt.Sprintf("notification is %s and can no longer be changed", status.Status),
+			Message: "Conflict",
+		})
+	case errors.Is(err, store.ErrStorageDegraded):
+		writeStorageDegraded(c)
+	case errors.Is(err, redis.TxFailedErr):
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeConcurrentUpdate,
+			Error:   "notification changed while it was being updated",
+			Message: "Conflict",
+		})
+	case err != nil:
+		log.Printf("failed to patch notification %s: %v", notificationID, err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to update notification",
+			Message: "Internal server error",
+		})
+	default:
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Notification updated",
+			Data:    n.shape(n.statusView(c), status),
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Verdict is what a policy check decides about a send.
+type Verdict string
+
+const (
+	Allow    Verdict = "allow"
+	Suppress Verdict = "suppress"
+	Defer    Verdict = "defer"
+)
+
+// Decision is a policy check's verdict. Reason says why, to the caller and
+// on the status record. Until is when a deferred send should go out; Code
+// is what a suppressed one is refused with, CodeSuppressedByPolicy when
+// empty.
+type Decision struct {
+	Verdict Verdict
+	Reason  string
+	Until   *time.Time
+	Code    models.ErrorCode
+}
+
+// EnqueueRequest is what policy checks see of a send.
+type EnqueueRequest struct {
+	Channel           string
+	TenantID          string
+	UserID            string
+	TemplateID        string
+	Category          string
+	Priority          string
+	RespectQuietHours bool
+	// DeliverAt is when the notification is due to go out, as planned by
+	// the request and deferred by the checks before.
+	DeliverAt time.Time
+	Metadata  map[string]string
+}
+
+// UserSnapshot gives checks the recipient's details. Each is read on first
+// use and shared by the rest of the chain, so checks that don't need one
+// cost nothing.
+type UserSnapshot struct {
+	UserID string
+
+	n         *NotificationHandler
+	prefsOnce sync.Once
+	prefs     models.Preferences
+	prefsErr  error
+}
+
+// Preferences returns the user's notification preferences.
+func (u *UserSnapshot) Preferences(ctx context.Context) (models.Preferences, error) {
+	u.prefsOnce.Do(func() {
+		u.prefs, u.prefsErr = u.n.preferences(ctx, u.UserID)
+	})
+	return u.prefs, u.prefsErr
+}
+
+// PolicyCheck decides whether a send may be queued. An error means the
+// check couldn't decide, and the send is refused as unavailable.
+type PolicyCheck interface {
+	Evaluate(ctx context.Context, req EnqueueRequest, user *UserSnapshot) (Decision, error)
+}
+
+// PolicyCheckFunc adapts a function to PolicyCheck.
+type PolicyCheckFunc func(ctx context.Context, req EnqueueRequest, user *UserSnapshot) (Decision, error)
+
+func (f PolicyCheckFunc) Evaluate(ctx context.Context, req EnqueueRequest, user *UserSnapshot) (Decision, error) {
+	return f(ctx, req, user)
+}
+
+// defaultPolicyChain runs when the config names no checks.
+var defaultPolicyChain = []string{"preferences", "quiet_hours"}
+
+// RegisterPolicyCheck makes check available to the policy chain under name,
+// replacing any check registered under it. It is meant to be called while
+// the server is composed, before it serves.
+func (n *NotificationHandler) RegisterPolicyCheck(name string, check PolicyCheck) {
+	n.policyChecks[name] = check
+}
+
+// ValidatePolicyChain reports a configured check that isn't registered.
+func (n *NotificationHandler) ValidatePolicyChain() error {
+	for _, name := range n.cfg.PolicyChain {
+		if _, ok := n.policyChecks[name]; !ok {
+			return fmt.Errorf("policy chain names unknown check %q", name)
+		}
+	}
+	return nil
+}
+
+// PolicyError is a check failing to decide.
+type PolicyError struct {
+	Check string
+	Err   error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy check %s: %v", e.Check, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error { return e.Err }
+
+// evaluatePolicies runs the chain in order. The first suppression ends it.
+// A deferral moves req.DeliverAt for the checks after it, so the decision
+// returned is the latest deferral, or Allow.
+func (n *NotificationHandler) evaluatePolicies(ctx context.Context, req EnqueueRequest) (Decision, error) {
+	user := &UserSnapshot{UserID: req.UserID, n: n}
+	result := Decision{Verdict: Allow}
+	for _, name := range n.cfg.PolicyChain {
+		check, ok := n.policyChecks[name]
+		if !ok {
+			return Decision{}, &PolicyError{Check: name, Err: errors.New("not registered")}
+		}
+		decision, err := check.Evaluate(ctx, req, user)
+		if err != nil {
+			return Decision{}, &PolicyError{Check: name, Err: err}
+		}
+		switch decision.Verdict {
+		case Suppress:
+			if decision.Code == "" {
+				decision.Code = models.CodeSuppressedByPolicy
+			}
+			return decision, nil
+		case Defer:
+			if decision.Until != nil && decision.Until.After(req.DeliverAt) {
+				req.DeliverAt = *decision.Until
+				result = decision
+			}
+		}
+	}
+	return result, nil
+}
+
+// applyPolicies runs the chain for a send. It writes the error response and
+// returns false when the send is suppressed or the chain can't decide.
+func (n *NotificationHandler) applyPolicies(c *gin.Context, ctx context.Context, req EnqueueRequest) (Decision, bool) {
+	decision, err := n.evaluatePolicies(ctx, req)
+	if err != nil {
+		log.Printf("failed to evaluate send policies for %s: %v", req.UserID, err)
+		middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Code:    models.CodeServiceUnavailable,
+			Error:   policyErrorMessage(err),
+			Message: "Service unavailable",
+		})
+		return Decision{}, false
+	}
+	if decision.Verdict == Suppress {
+		middleware.WriteError(c, http.StatusUnprocessableEntity, models.APIResponse{
+			Success: false,
+			Code:    decision.Code,
+			Error:   strings.ToLower(string(decision.Code)),
+			Message: decision.Reason,
+		})
+		return decision, false
+	}
+	return decision, true
+}
+
+// deferReason is the reason stored on the status of a send the chain
+// deferred.
+func deferReason(decision Decision) string {
+	if decision.Verdict != Defer {
+		return ""
+	}
+	return decision.Reason
+}
+
+// policyErrorMessage is the error shown for a chain that couldn't decide.
+func policyErrorMessage(err error) string {
+	var policyErr *PolicyError
+	if errors.As(err, &policyErr) && policyErr.Check == "preferences" {
+		return "Unable to verify user preferences"
+	}
+	return "Unable to evaluate send policies"
+}
+
+// preferencesCheck suppresses marketing on channels the user opted out of.
+// Transactional notifications always pass. When the preferences cannot be
+// read it fails, holding a marketing send back, since sending it could
+// breach the opt-out.
+type preferencesCheck struct{}
+
+func (preferencesCheck) Evaluate(ctx context.Context, req EnqueueRequest, user *UserSnapshot) (Decision, error) {
+	if req.Category != "marketing" {
+		return Decision{Verdict: Allow}, nil
+	}
+	prefs, err := user.Preferences(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	if optedOutOf(prefs, req.Channel) {
+		return Decision{
+			Verdict: Suppress,
+			Reason:  fmt.Sprintf("User has opted out of marketing %s notifications", req.Channel),
+			Code:    models.CodeUserOptedOut,
+		}, nil
+	}
+	return Decision{Verdict: Allow}, nil
+}
+
+// quietHoursCheck defers sends that asked for it out of the user's quiet
+// hours. High-priority notifications are never deferred.
+type quietHoursCheck struct {
+	n *NotificationHandler
+}
+
+func (q quietHoursCheck) Evaluate(ctx context.Context, req EnqueueRequest, user *UserSnapshot) (Decision, error) {
+	if sendAt := q.n.deferForQuietHours(ctx, req.RespectQuietHours, req.Priority, req.UserID, req.DeliverAt); sendAt != nil {
+		return Decision{Verdict: Defer, Reason: "until the end of the user's quiet hours", Until: sendAt}, nil
+	}
+	return Decision{Verdict: Allow}, nil
+}
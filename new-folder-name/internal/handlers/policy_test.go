@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingCheck records that it ran and answers decision.
+func recordingCheck(name string, ran *[]string, decision handlers.Decision) handlers.PolicyCheck {
+	return handlers.PolicyCheckFunc(func(ctx context.Context, req handlers.EnqueueRequest, user *handlers.UserSnapshot) (handlers.Decision, error) {
+		*ran = append(*ran, name)
+		return decision, nil
+	})
+}
+
+func TestPolicyChain_RunsInOrder(t *testing.T) {
+	var ran []string
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{PolicyChain: []string{"second", "first"}}).
+		Start(t)
+	h.Handler.RegisterPolicyCheck("first", recordingCheck("first", &ran, handlers.Decision{Verdict: handlers.Allow}))
+	h.Handler.RegisterPolicyCheck("second", recordingCheck("second", &ran, handlers.Decision{Verdict: handlers.Allow}))
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, []string{"second", "first"}, ran)
+}
+
+func TestPolicyChain_SuppressShortCircuits(t *testing.T) {
+	var ran []string
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{PolicyChain: []string{"blocklist", "later"}}).
+		Start(t)
+	h.Handler.RegisterPolicyCheck("blocklist", recordingCheck("blocklist", &ran, handlers.Decision{Verdict: handlers.Suppress, Reason: "Recipient is on the blocklist"}))
+	h.Handler.RegisterPolicyCheck("later", recordingCheck("later", &ran, handlers.Decision{Verdict: handlers.Allow}))
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	api := resp.API()
+	assert.Equal(t, models.CodeSuppressedByPolicy, api.Code)
+	assert.Equal(t, "Recipient is on the blocklist", api.Message)
+	assert.Equal(t, []string{"blocklist"}, ran)
+	assert.Empty(t, h.Queue.Emails())
+}
+
+func TestPolicyChain_DeferReasonOnStatus(t *testing.T) {
+	until := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{PolicyChain: []string{"frequency"}}).
+		Start(t)
+	h.Handler.RegisterPolicyCheck("frequency", handlers.PolicyCheckFunc(func(ctx context.Context, req handlers.EnqueueRequest, user *handlers.UserSnapshot) (handlers.Decision, error) {
+		return handlers.Decision{Verdict: handlers.Defer, Reason: "until the frequency cap resets", Until: &until}, nil
+	}))
+
+	resp := h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "promo"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	var sent models.NotificationResponse
+	resp.Decode(&sent)
+	assert.Equal(t, "deferred", sent.Status)
+	if assert.NotNil(t, sent.ScheduledFor) {
+		assert.True(t, until.Equal(*sent.ScheduledFor))
+	}
+
+	var status models.NotificationStatus
+	h.GET("/api/v1/notification/status/" + sent.NotificationID).Decode(&status)
+	assert.Equal(t, "until the frequency cap resets", status.PolicyReason)
+}
+
+func TestPolicyChain_UnknownCheckIsRejected(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{PolicyChain: []string{"preferences", "missing"}}).
+		Start(t)
+
+	assert.Error(t, h.Handler.ValidatePolicyChain())
+}
+
+func TestPolicyWebhook(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]string{"decision": "allow"})
+	}))
+	defer slow.Close()
+	suppressing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "email", req["channel"])
+		assert.Equal(t, "user123", req["user_id"])
+		json.NewEncoder(w).Encode(map[string]string{"decision": "suppress", "reason": "Over the daily quota"})
+	}))
+	defer suppressing.Close()
+
+	tests := []struct {
+		name     string
+		webhook  config.PolicyWebhookConfig
+		status   int
+		code     models.ErrorCode
+		enqueued int
+	}{
+		{"timeout fails closed", config.PolicyWebhookConfig{URL: slow.URL, Timeout: 20 * time.Millisecond}, http.StatusServiceUnavailable, models.CodeServiceUnavailable, 0},
+		{"timeout fails open", config.PolicyWebhookConfig{URL: slow.URL, Timeout: 20 * time.Millisecond, FailOpen: true}, http.StatusOK, "", 1},
+		{"suppressed by the webhook", config.PolicyWebhookConfig{URL: suppressing.URL}, http.StatusUnprocessableEntity, models.CodeSuppressedByPolicy, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlertest.NewHarness().
+				WithConfig(config.NotificationsConfig{PolicyChain: []string{"webhook"}, PolicyWebhook: tt.webhook}).
+				Start(t)
+			require.NoError(t, h.Handler.ValidatePolicyChain())
+
+			resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+			require.Equal(t, tt.status, resp.Code)
+			assert.Equal(t, tt.code, resp.API().Code)
+			assert.Len(t, h.Queue.Emails(), tt.enqueued)
+		})
+	}
+}
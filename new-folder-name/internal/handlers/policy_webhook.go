@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+)
+
+const defaultPolicyWebhookTimeout = 300 * time.Millisecond
+
+// webhookPolicyRequest is what the policy webhook is sent.
+type webhookPolicyRequest struct {
+	Channel    string            `json:"channel"`
+	TenantID   string            `json:"tenant_id,omitempty"`
+	UserID     string            `json:"user_id"`
+	TemplateID string            `json:"template_id"`
+	Category   string            `json:"category,omitempty"`
+	Priority   string            `json:"priority,omitempty"`
+	DeliverAt  time.Time         `json:"deliver_at"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// webhookPolicyResponse is the webhook's answer. Until is required with a
+// "defer" decision.
+type webhookPolicyResponse struct {
+	Decision Verdict    `json:"decision"`
+	Reason   string     `json:"reason,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// WebhookPolicyCheck asks an external service about each send. The service
+// gets the send as JSON and answers with a decision; a service that errors,
+// times out or answers something else fails open or closed as configured.
+type WebhookPolicyCheck struct {
+	url      string
+	timeout  time.Duration
+	failOpen bool
+	client   *http.Client
+}
+
+// NewWebhookPolicyCheck builds the check from cfg.
+func NewWebhookPolicyCheck(cfg config.PolicyWebhookConfig) *WebhookPolicyCheck {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultPolicyWebhookTimeout
+	}
+	return &WebhookPolicyCheck{
+		url:      cfg.URL,
+		timeout:  timeout,
+		failOpen: cfg.FailOpen,
+		client:   &http.Client{},
+	}
+}
+
+func (w *WebhookPolicyCheck) Evaluate(ctx context.Context, req EnqueueRequest, user *UserSnapshot) (Decision, error) {
+	decision, err := w.ask(ctx, req)
+	if err != nil {
+		if w.failOpen {
+			log.Printf("policy webhook failed, allowing the send to %s: %v", req.UserID, err)
+			return Decision{Verdict: Allow}, nil
+		}
+		return Decision{}, err
+	}
+	return decision, nil
+}
+
+func (w *WebhookPolicyCheck) ask(ctx context.Context, req EnqueueRequest) (Decision, error) {
+	body, err := json.Marshal(webhookPolicyRequest{
+		Channel:    req.Channel,
+		TenantID:   req.TenantID,
+		UserID:     req.UserID,
+		TemplateID: req.TemplateID,
+		Category:   req.Category,
+		Priority:   req.Priority,
+		DeliverAt:  req.DeliverAt,
+		Metadata:   req.Metadata,
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("policy webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("policy webhook answered %d", resp.StatusCode)
+	}
+	var answer webhookPolicyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&answer); err != nil {
+		return Decision{}, fmt.Errorf("policy webhook answer is not JSON: %w", err)
+	}
+	switch answer.Decision {
+	case Allow, Suppress:
+		return Decision{Verdict: answer.Decision, Reason: answer.Reason}, nil
+	case Defer:
+		if answer.Until == nil {
+			return Decision{}, fmt.Errorf("policy webhook deferred without a time")
+		}
+		return Decision{Verdict: Defer, Reason: answer.Reason, Until: answer.Until}, nil
+	}
+	return Decision{}, fmt.Errorf("policy webhook answered unknown decision %q", answer.Decision)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+)
+
+const defaultPreferencesCacheTTL = time.Minute
+
+// optedOutOf reports whether prefs opt out of marketing on channel.
+func optedOutOf(prefs models.Preferences, channel string) bool {
+	return channel == "email" && prefs.EmailOptOut ||
+		channel == "push" && prefs.PushOptOut ||
+		channel == "whatsapp" && prefs.WhatsAppOptOut
+}
+
+// preferences returns the user's preferences from the record the send
+// looked up. Without one, or when the record left them out, it reads them
+// through a short-lived Redis cache so marketing sends don't double user
+// service traffic.
+func (n *NotificationHandler) preferences(ctx context.Context, userID string) (models.Preferences, error) {
+	if user := userFromContext(ctx, userID); user != nil && user.Preferences != nil {
+		return *user.Preferences, nil
+	}
+	key := n.tenantKey(ctx, fmt.Sprintf("notification:prefs:%s", userID))
+	var prefs models.Preferences
+	if cached, err := n.redis.Get(ctx, key).Result(); err == nil {
+		if err := json.Unmarshal([]byte(cached), &prefs); err == nil {
+			return prefs, nil
+		}
+	}
+
+	prefs, err := n.userService.GetPreferences(ctx, userID)
+	if err != nil {
+		return prefs, err
+	}
+	if prefsJSON, err := json.Marshal(prefs); err == nil {
+		if err := n.redis.Set(ctx, key, prefsJSON, n.cfg.PreferencesCacheTTL).Err(); err != nil {
+			log.Printf("failed to cache preferences for %s: %v", userID, err)
+		}
+	}
+	return prefs, nil
+}
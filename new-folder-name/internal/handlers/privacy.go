@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/archive"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+// dataStores lists every model the handlers persist, where and for how
+// long. A new Redis write of a model belongs here too.
+func (n *NotificationHandler) dataStores() []privacy.Store {
+	stores := []privacy.Store{
+		{Name: "status", Key: "notification:status:<id>", TTL: n.cfg.StatusTTL, Model: models.NotificationStatus{}},
+		{Name: "idempotency", Key: "notification:idempotency:<id>", TTL: n.cfg.IdempotencyTTL, Model: models.IdempotencyRecord{}},
+		{Name: "history", Key: "notification:history:<id>", TTL: historyTTL, Model: models.HistoryEntry{}},
+		{Name: "pending approval", Key: "notification:approval:<id>", TTL: n.cfg.ApprovalTTL, Model: models.PendingApproval{}},
+		{Name: "preferences cache", Key: "notification:prefs:<user_id>", TTL: n.cfg.PreferencesCacheTTL, Model: models.Preferences{}},
+		{Name: "user summary cache", Key: "notification:user:<user_id>:summary", TTL: n.cfg.UserSummaryCacheTTL, Model: models.UserNotificationSummary{}},
+		{Name: "send-time profile", Key: "notification:sto:<user_id>", TTL: sendTimeProfileTTL, Model: models.SendTimeProfile{}},
+		{Name: "outbox", Key: "notification:outbox:<queue>", Model: outboxEntry{}},
+	}
+	if n.archive != nil {
+		stores = append(stores,
+			privacy.Store{Name: "status archive", Key: "postgres notification_status_archive", TTL: n.archive.Retention(), Model: models.NotificationStatus{}},
+			privacy.Store{Name: "status archive retry", Key: archive.RetryKey, Model: archive.Entry{}},
+		)
+	}
+	return stores
+}
+
+// GetDataInventory reports the personal data persisted in each store, from
+// the pii tags on the models, for privacy review.
+func (n *NotificationHandler) GetDataInventory(c *gin.Context) {
+	stores, err := privacy.Inventory(n.dataStores())
+	if err != nil {
+		log.Printf("failed to build data inventory: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to build data inventory",
+			Message: "Internal server error",
+		})
+		return
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Data inventory retrieved successfully",
+		Data: gin.H{
+			"stores":     stores,
+			"categories": privacy.Categories,
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/privacy"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDataInventory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewNotificationService(nil, setupMockRedis(), nil, nil, config.NotificationsConfig{})
+	router := gin.New()
+	router.GET("/privacy/inventory", handler.GetDataInventory)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/privacy/inventory", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data struct {
+			Stores []privacy.Store `json:"stores"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	stores := make(map[string]privacy.Store)
+	for _, store := range resp.Data.Stores {
+		stores[store.Name] = store
+	}
+	require.Contains(t, stores, "status")
+	status := stores["status"]
+	assert.Equal(t, "notification:status:<id>", status.Key)
+	assert.Equal(t, int64(86400), status.TTLSeconds)
+	assert.Contains(t, status.Fields, privacy.Field{Path: "overrides.recipient_email", Category: "email"})
+	assert.Contains(t, status.Fields, privacy.Field{Path: "user_id", Category: "identifier"})
+
+	// approvals hold the whole queued message, attachments included
+	assert.Contains(t, stores["pending approval"].Fields, privacy.Field{Path: "message.attachments[].url", Category: "content"})
+	assert.Equal(t, int64(defaultApprovalTTL.Seconds()), stores["pending approval"].TTLSeconds)
+	assert.Contains(t, stores, "history")
+}
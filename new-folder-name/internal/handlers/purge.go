@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// PurgeNotification deletes every Redis key held for a notification: its
+// status, idempotency marker, history list and sequence, and its entry in
+// the owning user's index. The deletes run in a single MULTI/EXEC so a
+// purge is never left half done.
+func (n *NotificationHandler) PurgeNotification(c *gin.Context) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+
+	statusKey := n.statusKey(ctx, notificationID)
+	idempotencyKey := n.idempotency.Key(ctx, notificationID)
+	historyListKey := n.tenantKey(ctx, historyKey(notificationID))
+	seqKey := n.tenantKey(ctx, historySeqKey(notificationID))
+
+	// The status names the user whose index holds this notification
+	var status models.NotificationStatus
+	statusJSON, err := n.statuses.Get(ctx, notificationID)
+	if err != nil && err != redis.Nil {
+		log.Printf("failed to read notification status for purge: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to purge notification",
+			Message: "Internal server error",
+		})
+		return
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+			log.Printf("purging unparseable status for %s", notificationID)
+		}
+	}
+
+	var dels []*redis.IntCmd
+	var indexRem *redis.IntCmd
+	_, err = n.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range []string{statusKey, idempotencyKey, historyListKey, seqKey} {
+			dels = append(dels, pipe.Del(ctx, key))
+		}
+		if status.UserID != "" {
+			indexRem = n.userIndex.Remove(ctx, pipe, status.UserID, notificationID)
+			n.dropUserSummary(ctx, pipe, status.UserID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to purge notification %s: %v", notificationID, err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to purge notification",
+			Message: "Internal server error",
+		})
+		return
+	}
+	n.hotCache.Delete(statusKey)
+	n.hotCache.Delete(idempotencyKey)
+
+	var keysRemoved int64
+	for _, del := range dels {
+		keysRemoved += del.Val()
+	}
+	var indexEntriesRemoved int64
+	if indexRem != nil {
+		indexEntriesRemoved = indexRem.Val()
+	}
+
+	if keysRemoved == 0 && indexEntriesRemoved == 0 {
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Notification not found",
+			Message: "Not found",
+		})
+		return
+	}
+
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Notification purged",
+		Data: gin.H{
+			"notification_id":       notificationID,
+			"keys_removed":          keysRemoved,
+			"index_entries_removed": indexEntriesRemoved,
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	defaultQuietHoursStart = 22 * 60
+	defaultQuietHoursEnd   = 8 * 60
+)
+
+// TimezoneResolver is implemented by user service clients that can report a
+// user's timezone. It is optional; without it quiet hours are never applied.
+type TimezoneResolver interface {
+	GetTimezone(ctx context.Context, userID string) (string, error)
+}
+
+// quietWindow is a daily window in minutes after local midnight. It wraps
+// midnight when start is after end, and is empty when they are equal.
+type quietWindow struct {
+	start, end int
+}
+
+// parseQuietWindow reads "HH:MM" bounds, falling back to the default for a
+// bound that is missing or malformed.
+func parseQuietWindow(start, end string) quietWindow {
+	return quietWindow{
+		start: parseClock(start, defaultQuietHoursStart),
+		end:   parseClock(end, defaultQuietHoursEnd),
+	}
+}
+
+func parseClock(value string, fallback int) int {
+	if value == "" {
+		return fallback
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		log.Printf("invalid quiet hours bound %q, using the default: %v", value, err)
+		return fallback
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// contains reports whether the local time falls inside the window.
+func (w quietWindow) contains(local time.Time) bool {
+	minute := local.Hour()*60 + local.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// endAfter returns the first end of the window after t, in UTC.
+func (w quietWindow) endAfter(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), w.end/60, w.end%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, w.end/60, w.end%60, 0, 0, t.Location())
+	}
+	return end.UTC()
+}
+
+// quietHoursEnd returns when a delivery due at the given time should go out
+// instead, or nil when it falls outside the user's quiet hours. Users whose
+// timezone is unknown are never deferred.
+func (n *NotificationHandler) quietHoursEnd(ctx context.Context, userID string, at time.Time) *time.Time {
+	var timezone string
+	if user := userFromContext(ctx, userID); user != nil {
+		timezone = user.Timezone
+	} else {
+		resolver, ok := n.userService.(TimezoneResolver)
+		if !ok {
+			return nil
+		}
+		var err error
+		timezone, err = resolver.GetTimezone(ctx, userID)
+		if err != nil {
+			log.Printf("failed to fetch timezone for %s: %v", userID, err)
+			return nil
+		}
+	}
+	if timezone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Printf("ignoring unknown timezone %q for %s", timezone, userID)
+		return nil
+	}
+	local := at.In(loc)
+	if !n.quietHours.contains(local) {
+		return nil
+	}
+	deliverAt := n.quietHours.endAfter(local)
+	return &deliverAt
+}
+
+// deferForQuietHours applies quiet hours to a send. It returns the deferred
+// delivery time, or nil when the notification should go out as planned.
+func (n *NotificationHandler) deferForQuietHours(ctx context.Context, respect bool, priority, userID string, at time.Time) *time.Time {
+	if !respect || priority == "high" {
+		return nil
+	}
+	return n.quietHoursEnd(ctx, userID, at)
+}
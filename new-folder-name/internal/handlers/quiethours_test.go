@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// timezoneUserService also reports the user's timezone.
+type timezoneUserService struct {
+	MockUserService
+}
+
+func (m *timezoneUserService) GetTimezone(ctx context.Context, userID string) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func TestQuietWindow(t *testing.T) {
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+	night := parseQuietWindow("22:00", "08:00")
+	afternoon := parseQuietWindow("13:00", "15:30")
+
+	tests := []struct {
+		name   string
+		window quietWindow
+		local  time.Time
+		inside bool
+		end    time.Time
+	}{
+		{"before midnight", night, time.Date(2024, 6, 10, 23, 15, 0, 0, lagos), true, time.Date(2024, 6, 11, 7, 0, 0, 0, time.UTC)},
+		{"after midnight", night, time.Date(2024, 6, 11, 3, 0, 0, 0, lagos), true, time.Date(2024, 6, 11, 7, 0, 0, 0, time.UTC)},
+		{"start is inclusive", night, time.Date(2024, 6, 10, 22, 0, 0, 0, lagos), true, time.Date(2024, 6, 11, 7, 0, 0, 0, time.UTC)},
+		{"end is exclusive", night, time.Date(2024, 6, 11, 8, 0, 0, 0, lagos), false, time.Time{}},
+		{"daytime", night, time.Date(2024, 6, 11, 12, 0, 0, 0, lagos), false, time.Time{}},
+		{"same-day window", afternoon, time.Date(2024, 6, 11, 14, 0, 0, 0, lagos), true, time.Date(2024, 6, 11, 14, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.inside, tt.window.contains(tt.local))
+			if tt.inside {
+				assert.Equal(t, tt.end, tt.window.endAfter(tt.local))
+			}
+		})
+	}
+
+	t.Run("malformed bounds use the defaults", func(t *testing.T) {
+		assert.Equal(t, night, parseQuietWindow("late", ""))
+	})
+}
+
+func TestSendPush_QuietHours(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	userService := new(timezoneUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	userService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	userService.On("GetTimezone", mock.Anything, mock.Anything).Return("UTC", nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishPushNot", mock.Anything, mock.Anything).Return(nil)
+
+	// a window covering the whole current UTC hour, whatever it is
+	hour := time.Now().UTC().Hour()
+	start := time.Date(2000, 1, 1, hour, 0, 0, 0, time.UTC).Format("15:04")
+	end := time.Date(2000, 1, 1, hour+1, 0, 0, 0, time.UTC).Format("15:04")
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		userService,
+		mockTemplateService,
+		config.NotificationsConfig{QuietHoursStart: start, QuietHoursEnd: end},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/push", handler.SendPush)
+
+	sendPush := func(req models.SendPushRequest) models.NotificationResponse {
+		body, _ := json.Marshal(req)
+		httpReq, _ := http.NewRequest("POST", "/api/v1/notification/push", bytes.NewBuffer(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.NotificationResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data
+	}
+
+	t.Run("deferred to the end of the window", func(t *testing.T) {
+		resp := sendPush(models.SendPushRequest{UserID: "user-1", TemplateID: "promo", RespectQuietHours: true})
+		assert.Equal(t, "deferred", resp.Status)
+		if assert.NotNil(t, resp.ScheduledFor) {
+			assert.Equal(t, (hour+1)%24, resp.ScheduledFor.UTC().Hour())
+			assert.Equal(t, 0, resp.ScheduledFor.Minute())
+		}
+	})
+
+	t.Run("ignored without the flag", func(t *testing.T) {
+		resp := sendPush(models.SendPushRequest{UserID: "user-1", TemplateID: "promo"})
+		assert.Equal(t, "queued", resp.Status)
+		assert.Nil(t, resp.ScheduledFor)
+	})
+
+	t.Run("high priority bypasses quiet hours", func(t *testing.T) {
+		resp := sendPush(models.SendPushRequest{UserID: "user-1", TemplateID: "alert", RespectQuietHours: true, Priority: "high"})
+		assert.Equal(t, "queued", resp.Status)
+		assert.Nil(t, resp.ScheduledFor)
+	})
+}
+
+// delayingQueue names its queues and can delay messages on the broker.
+type delayingQueue struct {
+	MockRabbitMQClient
+}
+
+func (m *delayingQueue) EmailQueueName() string    { return "email.queue" }
+func (m *delayingQueue) PushQueueName() string     { return "push.queue" }
+func (m *delayingQueue) WhatsAppQueueName() string { return "whatsapp.queue" }
+
+func (m *delayingQueue) PublishDelayed(ctx context.Context, routingKey string, message interface{}, delay time.Duration) error {
+	args := m.Called(ctx, routingKey, message, delay)
+	return args.Error(0)
+}
+
+func TestSendPush_QuietHoursDelayedOnTheBroker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	queue := new(delayingQueue)
+	userService := new(timezoneUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	userService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	userService.On("GetTimezone", mock.Anything, mock.Anything).Return("UTC", nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	queue.On("PublishDelayed", mock.Anything, "push.queue", mock.Anything, mock.MatchedBy(func(delay time.Duration) bool {
+		return delay > 0 && delay <= time.Hour
+	})).Return(nil)
+	queue.On("PublishPushNot", mock.Anything, mock.Anything).Return(nil)
+
+	hour := time.Now().UTC().Hour()
+	start := time.Date(2000, 1, 1, hour, 0, 0, 0, time.UTC).Format("15:04")
+	end := time.Date(2000, 1, 1, hour+1, 0, 0, 0, time.UTC).Format("15:04")
+	handler := NewNotificationService(queue, setupMockRedis(), userService, mockTemplateService,
+		config.NotificationsConfig{QuietHoursStart: start, QuietHoursEnd: end})
+
+	router := gin.New()
+	router.POST("/api/v1/notification/push", handler.SendPush)
+
+	for _, req := range []models.SendPushRequest{
+		{UserID: "user-1", TemplateID: "promo", RespectQuietHours: true},
+		{UserID: "user-1", TemplateID: "promo"},
+	} {
+		body, _ := json.Marshal(req)
+		httpReq, _ := http.NewRequest("POST", "/api/v1/notification/push", bytes.NewBuffer(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	queue.AssertNumberOfCalls(t, "PublishDelayed", 1)
+	queue.AssertNumberOfCalls(t, "PublishPushNot", 1)
+}
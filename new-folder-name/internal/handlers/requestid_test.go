@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID_Success(t *testing.T) {
+	h := handlertest.NewHarness().WithHeader(middleware.RequestIDHeader, "client-req-42").Start(t)
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "client-req-42", resp.Header.Get(middleware.RequestIDHeader))
+	assert.Equal(t, "client-req-42", resp.API().RequestID)
+	assert.NotEqual(t, resp.Header.Get(middleware.CorrelationIDHeader), "client-req-42", "the request ID is not the correlation ID")
+
+	emails := h.Queue.Emails()
+	require.Len(t, emails, 1)
+	assert.Equal(t, "client-req-42", emails[0].RequestID)
+
+	history, err := h.Miniredis.List("notification:history:" + resp.NotificationID())
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	var entry models.HistoryEntry
+	require.NoError(t, json.Unmarshal([]byte(history[0]), &entry))
+	assert.Equal(t, "client-req-42", entry.RequestID)
+}
+
+func TestRequestID_GeneratedWhenMissingOrUnusable(t *testing.T) {
+	for _, sent := range []string{"", "has spaces\nand a newline", string(make([]byte, 200))} {
+		h := handlertest.NewHarness().WithHeader(middleware.RequestIDHeader, sent).Start(t)
+
+		resp := h.GET("/api/v1/notification/status/missing")
+		requestID := resp.Header.Get(middleware.RequestIDHeader)
+		assert.NotEmpty(t, requestID)
+		assert.NotEqual(t, sent, requestID)
+		assert.Equal(t, requestID, resp.API().RequestID)
+	}
+}
+
+func TestRequestID_ValidationFailure(t *testing.T) {
+	h := handlertest.NewHarness().WithHeader(middleware.RequestIDHeader, "client-req-43").Start(t)
+
+	resp := h.POST("/api/v1/notification/email", map[string]string{"user_id": "user123"})
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "client-req-43", resp.Header.Get(middleware.RequestIDHeader))
+	assert.Equal(t, "client-req-43", resp.API().RequestID)
+}
+
+func TestRequestID_AuthFailure(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+
+	for _, accept := range []string{"application/json", middleware.ProblemContentType} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/notification/status/n-1", nil)
+		req.Header.Set(middleware.RequestIDHeader, "client-req-44")
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.Router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "client-req-44", w.Header().Get(middleware.RequestIDHeader))
+		var body struct {
+			RequestID string `json:"request_id"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "client-req-44", body.RequestID, accept)
+	}
+}
+
+func TestRequestID_PanicRecovery(t *testing.T) {
+	h := handlertest.NewHarness().WithHeader(middleware.RequestIDHeader, "client-req-45").Start(t)
+	h.Router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	resp := h.GET("/panic")
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "client-req-45", resp.Header.Get(middleware.RequestIDHeader))
+	api := resp.API()
+	assert.Equal(t, "client-req-45", api.RequestID)
+	assert.Equal(t, models.CodeInternalError, api.Code)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/budget"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// pendingStatuses have not been delivered yet, so resending them would
+// double send.
+var pendingStatuses = map[string]bool{
+	"queued":           true,
+	"scheduled":        true,
+	"scheduled_sto":    true,
+	"deferred":         true,
+	"pending_approval": true,
+}
+
+// resendableTypes are the notification types addressed to a single user.
+// Topic pushes have no user to revalidate.
+var resendableTypes = map[string]bool{
+	"email":    true,
+	"push":     true,
+	"whatsapp": true,
+}
+
+// Resend publishes a previously sent email, push or WhatsApp notification
+// again under a new ID linked to the original. The user and template are
+// revalidated since either may have gone away. A push resend goes to the
+// user's registered devices; explicit device tokens are not kept on the
+// record.
+func (n *NotificationHandler) Resend(c *gin.Context) {
+	sendCtx, cancel := sendContext(c)
+	defer cancel()
+	sendBudget := n.newBudget(sendCtx)
+	ctx, endValidation, ok := startPhase(c, sendCtx, sendBudget, budget.Validation)
+	if !ok {
+		return
+	}
+	defer endValidation()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+	originalID := c.Param("id")
+
+	statusJSON, err := n.statuses.Get(ctx, originalID)
+	if errors.Is(err, store.ErrStorageDegraded) {
+		writeStorageDegraded(c)
+		return
+	}
+	if err != nil && err != redis.Nil {
+		log.Printf("failed to read notification status for resend: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to retrieve status",
+			Message: "Internal server error",
+		})
+		return
+	}
+	var original models.NotificationStatus
+	if err == nil {
+		err = json.Unmarshal([]byte(statusJSON), &original)
+	}
+	if err != nil || !n.canRead(c, original) {
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Notification not found",
+			Message: "Not found",
+		})
+		return
+	}
+	if pendingStatuses[original.Status] {
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInvalidState,
+			Error:   fmt.Sprintf("notification is still %s", original.Status),
+			Message: "Conflict",
+		})
+		return
+	}
+	if !resendableTypes[original.Type] || original.UserID == "" || original.TemplateID == "" {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotResendable,
+			Error:   "notification does not carry enough detail to be resent",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	if ctx, ok = n.checkUser(c, ctx, original.UserID); !ok {
+		return
+	}
+	if !n.channelEnabled(c, original.Type) {
+		return
+	}
+	decision, ok := n.applyPolicies(c, ctx, EnqueueRequest{
+		Channel:    original.Type,
+		TenantID:   n.tenantOf(ctx),
+		UserID:     original.UserID,
+		TemplateID: original.TemplateID,
+		Category:   original.Category,
+		Priority:   original.Priority,
+		DeliverAt:  n.clock.Now(),
+		Metadata:   original.Metadata,
+	})
+	if !ok {
+		return
+	}
+	validTemplate, err := n.templateService.ValidateTemplate(ctx, original.TemplateID)
+	if err != nil || !validTemplate {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	notificationID := n.ids.NewID()
+	message := models.NotificationMessage{
+		ID:            notificationID,
+		TenantID:      n.tenantOf(ctx),
+		Type:          original.Type,
+		UserID:        original.UserID,
+		TemplateID:    original.TemplateID,
+		Variables:     original.Variables,
+		Priority:      original.Priority,
+		Category:      original.Category,
+		Metadata:      original.Metadata,
+		Timestamp:     n.clock.Now(),
+		CorrelationID: correlationID,
+		RequestID:     middleware.RequestIDFromContext(ctx),
+		Overrides:     original.Overrides,
+		Locale:        original.Locale,
+		Recipient:     recipientHint(ctx, original.UserID, original.Type),
+	}
+	status, responseMessage := "queued", "Notification resent successfully"
+	if decision.Verdict == Defer {
+		message.ScheduledFor = decision.Until
+		status, responseMessage = "deferred", "Notification resend deferred "+decision.Reason
+	}
+	publish, queueName := n.publisherFor(original.Type)
+	endValidation()
+	publishCtx, endPublish, ok := startPhase(c, sendCtx, sendBudget, budget.Publish)
+	if !ok {
+		return
+	}
+	record := models.NotificationStatus{
+		ID:            notificationID,
+		TenantID:      n.tenantOf(ctx),
+		UserID:        original.UserID,
+		TemplateID:    original.TemplateID,
+		Variables:     original.Variables,
+		Priority:      original.Priority,
+		Category:      original.Category,
+		Metadata:      original.Metadata,
+		Type:          original.Type,
+		Queue:         queueName,
+		Status:        status,
+		ScheduledFor:  message.ScheduledFor,
+		Overrides:     original.Overrides,
+		Locale:        original.Locale,
+		PolicyReason:  deferReason(decision),
+		CreatedBy:     middleware.CallerID(c),
+		ResentFrom:    originalID,
+		CorrelationID: correlationID,
+		Delivery:      deliveryOf(message),
+	}
+	buffered, err := n.publishOrBuffer(publishCtx, publish, queueName, message, record)
+	endPublish()
+	if err != nil {
+		log.Printf("failed to publish resend of %s: %v", originalID, err)
+		writePublishError(c, err, "failed to queue notification")
+		return
+	}
+	code := http.StatusOK
+	if buffered {
+		code, status, responseMessage = http.StatusAccepted, outboxStatus, "Notification resend accepted, to be queued once the broker is back"
+	} else if !n.persistStatus(c, sendCtx, sendBudget, record) {
+		return
+	}
+	usage.MarkQueued(c, 1)
+	middleware.WriteResponse(c, code, models.APIResponse{
+		Success: true,
+		Message: responseMessage,
+		Data: models.NotificationResponse{
+			NotificationID: notificationID,
+			Status:         status,
+			QueuedAt:       n.clock.Now(),
+			ScheduledFor:   message.ScheduledFor,
+		},
+	})
+}
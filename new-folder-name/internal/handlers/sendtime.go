@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultSendTimeMaxDelay = 24 * time.Hour
+	// sendTimeProfileTTL keeps a profile around between model refreshes.
+	sendTimeProfileTTL = 30 * 24 * time.Hour
+)
+
+// IngestSendTimeProfile stores the preferred engagement hour computed for a
+// user by the send-time model.
+func (n *NotificationHandler) IngestSendTimeProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param("user_id")
+
+	var profile models.SendTimeProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if _, err := time.LoadLocation(profile.Timezone); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   fmt.Sprintf("unknown timezone %q", profile.Timezone),
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	profileJSON, err := json.Marshal(profile)
+	if err != nil {
+		log.Printf("failed to marshal send-time profile: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to store profile",
+			Message: "Internal server error",
+		})
+		return
+	}
+	key := n.tenantKey(ctx, fmt.Sprintf("notification:sto:%s", userID))
+	if err := n.redis.Set(ctx, key, profileJSON, sendTimeProfileTTL).Err(); err != nil {
+		log.Printf("failed to store send-time profile: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to store profile",
+			Message: "Internal server error",
+		})
+		return
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Send-time profile stored",
+		Data:    profile,
+	})
+}
+
+// optimizedSendTime returns when the user should receive the notification,
+// or nil when there is no profile and it should go out immediately.
+func (n *NotificationHandler) optimizedSendTime(ctx context.Context, userID string, now time.Time) *time.Time {
+	key := n.tenantKey(ctx, fmt.Sprintf("notification:sto:%s", userID))
+	profileJSON, err := n.redis.Get(ctx, key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("failed to read send-time profile: %v", err)
+		}
+		return nil
+	}
+	var profile models.SendTimeProfile
+	if err := json.Unmarshal([]byte(profileJSON), &profile); err != nil || profile.PreferredHour == nil {
+		log.Printf("ignoring malformed send-time profile for %s", userID)
+		return nil
+	}
+	loc, err := time.LoadLocation(profile.Timezone)
+	if err != nil {
+		return nil
+	}
+
+	maxDelay := n.cfg.SendTimeMaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultSendTimeMaxDelay
+	}
+	sendAt := nextSendTime(now, *profile.PreferredHour, loc, maxDelay)
+	return &sendAt
+}
+
+// nextSendTime returns the next start of hour in loc at or after now, clamped
+// to now+maxDelay.
+func nextSendTime(now time.Time, hour int, loc *time.Location, maxDelay time.Duration) time.Time {
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	if next.Before(local) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, hour, 0, 0, 0, loc)
+	}
+	if latest := now.Add(maxDelay); next.After(latest) {
+		next = latest
+	}
+	return next.UTC()
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNextSendTime(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+	newYork, _ := time.LoadLocation("America/New_York")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	// 2024-06-10 12:30 UTC
+	now := time.Date(2024, 6, 10, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		hour     int
+		loc      *time.Location
+		maxDelay time.Duration
+		want     time.Time
+	}{
+		// 14:30 in Berlin, 18:00 is later the same day
+		{"later today", 18, berlin, 24 * time.Hour, time.Date(2024, 6, 10, 16, 0, 0, 0, time.UTC)},
+		// 13:30 in Lagos, 09:00 has passed so tomorrow
+		{"passed today", 9, lagos, 24 * time.Hour, time.Date(2024, 6, 11, 8, 0, 0, 0, time.UTC)},
+		// 08:30 in New York
+		{"behind utc", 9, newYork, 24 * time.Hour, time.Date(2024, 6, 10, 13, 0, 0, 0, time.UTC)},
+		// 21:30 in Tokyo, the preferred 07:00 is on the next local day
+		{"ahead of utc", 7, tokyo, 24 * time.Hour, time.Date(2024, 6, 10, 22, 0, 0, 0, time.UTC)},
+		{"clamped to max delay", 9, lagos, 6 * time.Hour, time.Date(2024, 6, 10, 18, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextSendTime(now, tt.hour, tt.loc, tt.maxDelay))
+		})
+	}
+}
+
+func TestSendEmail_SendTimeOptimization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(
+		mockQueue,
+		mockRedis,
+		mockUserService,
+		mockTemplateService,
+		config.NotificationsConfig{SendTimeMaxDelay: 2 * time.Hour},
+	)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", handler.SendEmail)
+	router.PUT("/api/v1/internal/send-time/:user_id", handler.IngestSendTimeProfile)
+
+	sendEmail := func(userID string) models.NotificationResponse {
+		body, _ := json.Marshal(models.SendEmailRequest{
+			UserID:               userID,
+			TemplateID:           "digest",
+			SendTimeOptimization: true,
+		})
+		req, _ := http.NewRequest("POST", "/api/v1/notification/email", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.NotificationResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data
+	}
+
+	t.Run("no data falls back to immediate", func(t *testing.T) {
+		resp := sendEmail("user-without-profile")
+		assert.Equal(t, "queued", resp.Status)
+		assert.Nil(t, resp.ScheduledFor)
+	})
+
+	t.Run("profile schedules within the max delay", func(t *testing.T) {
+		hour := (time.Now().UTC().Hour() + 1) % 24
+		body, _ := json.Marshal(map[string]interface{}{"preferred_hour": hour, "timezone": "UTC"})
+		req, _ := http.NewRequest("PUT", "/api/v1/internal/send-time/user-with-profile", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		before := time.Now()
+		resp := sendEmail("user-with-profile")
+		assert.Equal(t, "scheduled_sto", resp.Status)
+		if assert.NotNil(t, resp.ScheduledFor) {
+			assert.Equal(t, hour, resp.ScheduledFor.Hour())
+			assert.True(t, resp.ScheduledFor.After(before))
+			assert.True(t, resp.ScheduledFor.Before(before.Add(2*time.Hour)))
+		}
+	})
+
+	t.Run("ingestion rejects unknown timezones", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{"preferred_hour": 9, "timezone": "Mars/Olympus"})
+		req, _ := http.NewRequest("PUT", "/api/v1/internal/send-time/user-x", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultMaxSnoozes        = 3
+	defaultMaxSnoozeDuration = 7 * 24 * time.Hour
+)
+
+var (
+	errSnoozeLimit    = errors.New("snooze limit reached")
+	errNotSnoozable   = errors.New("notification can no longer be snoozed")
+	unsnoozableStatus = map[string]bool{"expired": true, "cancelled": true}
+)
+
+// Snooze lets the recipient have a notification delivered again later. The
+// original is annotated with snoozed_until under WATCH, so concurrent
+// snoozes cannot exceed the limit, and cloned under a new ID as a scheduled
+// notification linked by parent_id. The clone is stored like any new
+// notification and published for delivery at snoozed_until; if either
+// fails, the snooze on the original is taken back.
+func (n *NotificationHandler) Snooze(c *gin.Context) {
+	ctx := c.Request.Context()
+	originalID := c.Param("id")
+
+	var req models.SnoozeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	now := n.clock.Now().UTC()
+	until, fieldErrors := n.snoozeUntil(req, now)
+	if len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid snooze",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	cloneID := n.ids.NewID()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+	var original, clone models.NotificationStatus
+	// previousUntil is the original's snoozed_until before this snooze
+	var previousUntil *time.Time
+	err := n.updateStatus(ctx, originalID, func(record *models.NotificationStatus) (bool, error) {
+		original = *record
+		previousUntil = original.SnoozedUntil
+		// Only the recipient may snooze their own notification
+		if userID, _ := c.Get("user_id"); original.UserID == "" || fmt.Sprint(userID) != original.UserID {
+			return false, errNotificationNotFound
+		}
+		if unsnoozableStatus[original.Status] {
+			return false, errNotSnoozable
+		}
+		if original.SnoozeCount >= n.cfg.MaxSnoozes {
+			return false, errSnoozeLimit
+		}
+
+		_, queueName := n.publisherFor(original.Type)
+		clone = models.NotificationStatus{
+			ID:            cloneID,
+			TenantID:      original.TenantID,
+			UserID:        original.UserID,
+			TemplateID:    original.TemplateID,
+			Variables:     original.Variables,
+			Priority:      original.Priority,
+			Category:      original.Category,
+			Metadata:      original.Metadata,
+			Type:          original.Type,
+			Queue:         queueName,
+			Status:        "scheduled",
+			Overrides:     original.Overrides,
+			Locale:        original.Locale,
+			Topic:         original.Topic,
+			CreatedBy:     original.CreatedBy,
+			CorrelationID: correlationID,
+			ParentID:      originalID,
+			ScheduledFor:  &until,
+			Delivery:      original.Delivery,
+		}
+		original.SnoozedUntil = &until
+		original.SnoozeCount++
+		original.UpdatedAt = now
+		*record = original
+		return true, nil
+	}, nil)
+	if err == nil {
+		if err = n.storeNotificationStatuses(ctx, []models.NotificationStatus{clone}); err == nil {
+			n.keepSnoozedClone(ctx, cloneID, until.Sub(now))
+		} else if undoErr := n.unsnooze(ctx, original, previousUntil); undoErr != nil {
+			log.Printf("failed to take back the snooze of %s: %v", originalID, undoErr)
+		}
+	}
+
+	switch {
+	case errors.Is(err, errNotificationNotFound), errors.Is(err, redis.Nil):
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Notification not found",
+			Message: "Not found",
+		})
+	case errors.Is(err, errNotSnoozable):
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInvalidState,
+			Error:   fmt.Sprintf("notification is %s and can no longer be snoozed", original.Status),
+			Message: "Conflict",
+		})
+	case errors.Is(err, errSnoozeLimit):
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeSnoozeLimitReached,
+			Error:   fmt.Sprintf("notification has already been snoozed %d times", n.cfg.MaxSnoozes),
+			Message: "Conflict",
+		})
+	case errors.Is(err, store.ErrStorageDegraded):
+		writeStorageDegraded(c)
+	case errors.Is(err, redis.TxFailedErr):
+		middleware.WriteError(c, http.StatusConflict, models.APIResponse{
+			Success: false,
+			Code:    models.CodeConcurrentUpdate,
+			Error:   "notification changed while it was being snoozed",
+			Message: "Conflict",
+		})
+	case err != nil:
+		log.Printf("failed to snooze notification %s: %v", originalID, err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to snooze notification",
+			Message: "Internal server error",
+		})
+	default:
+		publish, queueName := n.publisherFor(clone.Type)
+		message := withDelivery(models.NotificationMessage{
+			ID:            cloneID,
+			TenantID:      clone.TenantID,
+			Type:          clone.Type,
+			UserID:        clone.UserID,
+			TemplateID:    clone.TemplateID,
+			Variables:     clone.Variables,
+			Priority:      clone.Priority,
+			ScheduledFor:  clone.ScheduledFor,
+			Timestamp:     now,
+			CorrelationID: correlationID,
+			RequestID:     middleware.RequestIDFromContext(ctx),
+			Overrides:     clone.Overrides,
+			Locale:        clone.Locale,
+			Category:      clone.Category,
+			Metadata:      clone.Metadata,
+			Topic:         clone.Topic,
+		}, clone.Delivery)
+		// the broker holds the reminder until it is due
+		if err := n.publishMessage(ctx, publish, queueName, message); err != nil {
+			log.Printf("failed to publish snoozed notification %s: %v", cloneID, err)
+			if statusErr := n.transitionStatus(ctx, cloneID, "failed"); statusErr != nil {
+				log.Printf("failed to fail status of %s: %v", cloneID, statusErr)
+			}
+			if undoErr := n.unsnooze(ctx, original, previousUntil); undoErr != nil {
+				log.Printf("failed to take back the snooze of %s: %v", originalID, undoErr)
+			}
+			writePublishError(c, err, "failed to queue notification")
+			return
+		}
+		middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Notification snoozed",
+			Data: models.NotificationResponse{
+				NotificationID: cloneID,
+				Status:         "scheduled",
+				QueuedAt:       now,
+				ScheduledFor:   &until,
+			},
+		})
+	}
+}
+
+// snoozeUntil resolves the request to an absolute time within the allowed
+// snooze window.
+func (n *NotificationHandler) snoozeUntil(req models.SnoozeRequest, now time.Time) (time.Time, []models.FieldError) {
+	var until time.Time
+	switch {
+	case req.Duration != "" && req.Until != nil:
+		return until, []models.FieldError{{Field: "duration", Message: "give either duration or until, not both"}}
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return until, []models.FieldError{{Field: "duration", Message: "duration must be a positive duration such as 2h"}}
+		}
+		until = now.Add(d)
+	case req.Until != nil:
+		until = req.Until.UTC()
+		if !until.After(now) {
+			return until, []models.FieldError{{Field: "until", Message: "until must be in the future"}}
+		}
+	default:
+		return until, []models.FieldError{{Field: "duration", Message: "duration or until is required"}}
+	}
+	if until.After(now.Add(n.cfg.MaxSnoozeDuration)) {
+		return until, []models.FieldError{{Field: "duration", Message: fmt.Sprintf("snoozes may not exceed %s", n.cfg.MaxSnoozeDuration)}}
+	}
+	return until, nil
+}
+
+// keepSnoozedClone keeps the clone's record until StatusTTL after it is
+// due, like any other status, rather than StatusTTL after the snooze.
+func (n *NotificationHandler) keepSnoozedClone(ctx context.Context, cloneID string, due time.Duration) {
+	if n.statuses.Degraded() {
+		return
+	}
+	if err := n.redis.Expire(ctx, n.statusKey(ctx, cloneID), due+n.cfg.StatusTTL).Err(); err != nil {
+		log.Printf("failed to keep snoozed notification %s until it is due: %v", cloneID, err)
+	}
+}
+
+// unsnooze takes back the snooze that left snoozed as it is, restoring its
+// snoozed_until to previousUntil and giving the snooze back. A record that
+// has changed since is left alone.
+func (n *NotificationHandler) unsnooze(ctx context.Context, snoozed models.NotificationStatus, previousUntil *time.Time) error {
+	return n.updateStatus(ctx, snoozed.ID, func(record *models.NotificationStatus) (bool, error) {
+		if record.SnoozeCount != snoozed.SnoozeCount || record.SnoozedUntil == nil ||
+			!record.SnoozedUntil.Equal(*snoozed.SnoozedUntil) {
+			return false, nil
+		}
+		record.SnoozedUntil = previousUntil
+		record.SnoozeCount--
+		record.UpdatedAt = n.clock.Now().UTC()
+		return true, nil
+	}, nil)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	statusStreamHeartbeat          = 15 * time.Second
+	defaultStatusStreamMaxDuration = 5 * time.Minute
+)
+
+// terminalStatuses end a status stream; nothing changes after them.
+var terminalStatuses = map[string]bool{
+	"sent":      true,
+	"failed":    true,
+	"expired":   true,
+	"cancelled": true,
+}
+
+// statusChannel is the pub/sub channel status writers publish every update
+// of a notification to.
+func statusChannel(notificationID string) string {
+	return fmt.Sprintf("notification:status:updates:%s", notificationID)
+}
+
+// StreamStatus sends the notification's status as server-sent events: the
+// current status straight away, then every change until a terminal status,
+// the configured maximum duration, or the client going away.
+func (n *NotificationHandler) StreamStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+
+	// Subscribe before reading so no update can slip in between
+	pubsub := n.redis.Subscribe(ctx, n.tenantKey(ctx, statusChannel(notificationID)))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("failed to subscribe to status updates: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to stream status",
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	statusJSON, err := n.statuses.Get(ctx, notificationID)
+	if errors.Is(err, store.ErrStorageDegraded) {
+		writeStorageDegraded(c)
+		return
+	}
+	if err != nil && err != redis.Nil {
+		log.Printf("failed to get notification status: %v", err)
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to retrieve status",
+			Message: "Internal server error",
+		})
+		return
+	}
+	var status models.NotificationStatus
+	if err == nil {
+		err = json.Unmarshal([]byte(statusJSON), &status)
+	}
+	if err != nil || !n.canRead(c, status) {
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeNotificationNotFound,
+			Error:   "Notification not found",
+			Message: "Not found",
+		})
+		return
+	}
+
+	view := n.statusView(c)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	if shaped, ok := n.shapeJSON(view, statusJSON); ok {
+		middleware.WriteEvent(c, "status", json.RawMessage(shaped))
+	}
+	c.Writer.Flush()
+	if terminalStatuses[status.Status] {
+		middleware.WriteEvent(c, "end", gin.H{"reason": "terminal", "status": status.Status})
+		return
+	}
+
+	heartbeat := time.NewTicker(n.streamHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(n.cfg.StatusStreamMaxDuration)
+	defer deadline.Stop()
+	updates := pubsub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-updates:
+			if !ok {
+				return
+			}
+			if shaped, ok := n.shapeJSON(view, msg.Payload); ok {
+				middleware.WriteEvent(c, "status", json.RawMessage(shaped))
+			}
+			var update models.NotificationStatus
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err == nil && terminalStatuses[update.Status] {
+				middleware.WriteEvent(c, "end", gin.H{"reason": "terminal", "status": update.Status})
+				return
+			}
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			middleware.WriteEvent(c, "heartbeat", n.clock.Now().UTC())
+			c.Writer.Flush()
+		case <-deadline.C:
+			middleware.WriteEvent(c, "end", gin.H{"reason": "max_duration"})
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// userIndexPage is how many index entries a summary reads at once.
+const userIndexPage = 100
+
+// userSummaryKey holds a user's computed summaries, one field per viewer,
+// since what a caller may see depends on who they are.
+func userSummaryKey(userID string) string {
+	return fmt.Sprintf("notification:user:%s:summary", userID)
+}
+
+// indexUser adds notificationID, created at createdAt, to the notifications
+// of userID and drops the user's cached summaries.
+func (n *NotificationHandler) indexUser(ctx context.Context, pipe redis.Pipeliner, notificationID, userID string, createdAt time.Time) {
+	if userID == "" {
+		return
+	}
+	n.userIndex.Add(ctx, pipe, userID, notificationID, createdAt)
+	n.dropUserSummary(ctx, pipe, userID)
+}
+
+// dropUserSummary drops the cached summaries of userID, for a change to one
+// of their notifications' status.
+func (n *NotificationHandler) dropUserSummary(ctx context.Context, pipe redis.Pipeliner, userID string) {
+	if userID == "" {
+		return
+	}
+	pipe.Del(ctx, n.tenantKey(ctx, userSummaryKey(userID)))
+}
+
+// summaryViewer names the cache field for the caller: read-all callers
+// share one summary, everyone else gets their own.
+func summaryViewer(c *gin.Context) string {
+	if middleware.CallerHasScope(c, middleware.ReadAllScope) {
+		return "*"
+	}
+	return "caller:" + middleware.CallerID(c)
+}
+
+// GetUserSummary counts the notifications of a user created within the
+// summary window, by status and channel, among those the caller may read.
+// Summaries are cached briefly and carry an ETag, so pollers get a 304
+// while nothing has changed.
+func (n *NotificationHandler) GetUserSummary(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param("user_id")
+
+	summaryKey := n.tenantKey(ctx, userSummaryKey(userID))
+	viewer := summaryViewer(c)
+	summaryJSON, err := n.redis.HGet(ctx, summaryKey, viewer).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("failed to read cached summary of %s: %v", userID, err)
+		}
+		summary, err := n.userSummary(c, userID)
+		if err != nil {
+			log.Printf("failed to summarize notifications of %s: %v", userID, err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "Failed to summarize notifications",
+				Message: "Internal server error",
+			})
+			return
+		}
+		if summaryJSON, err = json.Marshal(summary); err != nil {
+			log.Printf("failed to encode summary of %s: %v", userID, err)
+			middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Code:    models.CodeInternalError,
+				Error:   "Failed to summarize notifications",
+				Message: "Internal server error",
+			})
+			return
+		}
+		if ttl := n.cfg.UserSummaryCacheTTL; ttl > 0 {
+			_, err := n.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, summaryKey, viewer, summaryJSON)
+				pipe.Expire(ctx, summaryKey, ttl)
+				return nil
+			})
+			if err != nil {
+				log.Printf("failed to cache summary of %s: %v", userID, err)
+			}
+		}
+	}
+
+	sum := sha256.Sum256(summaryJSON)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Notification summary retrieved successfully",
+		Data:    json.RawMessage(summaryJSON),
+	})
+}
+
+// userSummary counts the user's notifications created within the window,
+// from the per-user index.
+func (n *NotificationHandler) userSummary(c *gin.Context, userID string) (models.UserNotificationSummary, error) {
+	ctx := c.Request.Context()
+	summary := models.UserNotificationSummary{
+		UserID:        userID,
+		WindowSeconds: int64(n.cfg.UserSummaryWindow / time.Second),
+		ByStatus:      map[string]int{},
+		ByChannel:     map[string]int{},
+	}
+	var since time.Time
+	if n.cfg.UserSummaryWindow > 0 {
+		since = n.clock.Now().Add(-n.cfg.UserSummaryWindow)
+	}
+
+	for offset := int64(0); ; offset += userIndexPage {
+		ids, err := n.userIndex.Newest(ctx, userID, since, offset, userIndexPage)
+		if err != nil {
+			return summary, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = n.statusKey(ctx, id)
+		}
+		values, err := n.redis.MGet(ctx, keys...).Result()
+		if err != nil {
+			return summary, err
+		}
+		for i, value := range values {
+			statusJSON, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var status models.NotificationStatus
+			if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+				log.Printf("skipping unreadable status record %s: %v", ids[i], err)
+				continue
+			}
+			if status.CreatedAt.Before(since) {
+				continue
+			}
+			if !n.canRead(c, status) {
+				continue
+			}
+			summary.Total++
+			summary.ByStatus[status.Status]++
+			summary.ByChannel[status.Type]++
+			if summary.LatestAt == nil || status.CreatedAt.After(*summary.LatestAt) {
+				createdAt := status.CreatedAt
+				summary.LatestAt = &createdAt
+			}
+		}
+		if len(ids) < userIndexPage {
+			break
+		}
+	}
+	return summary, nil
+}
+
+// etagMatches reports whether an If-None-Match header names etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const summaryPath = "/api/v1/notification/user/user123/summary"
+
+func summaryHarness(t *testing.T) *handlertest.Harness {
+	return handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{UserSummaryWindow: 24 * time.Hour, UserSummaryCacheTTL: time.Minute}).
+		Start(t)
+}
+
+func TestGetUserSummary_CountsAfterTransitions(t *testing.T) {
+	h := summaryHarness(t)
+	first := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}).NotificationID()
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "welcome_email"})
+
+	var summary models.UserNotificationSummary
+	resp := h.GET(summaryPath)
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp.Decode(&summary)
+	assert.Equal(t, "user123", summary.UserID)
+	assert.Equal(t, int64(86400), summary.WindowSeconds)
+	assert.Equal(t, 3, summary.Total)
+	assert.Equal(t, map[string]int{"queued": 3}, summary.ByStatus)
+	assert.Equal(t, map[string]int{"email": 2, "push": 1}, summary.ByChannel)
+	require.NotNil(t, summary.LatestAt)
+	assert.WithinDuration(t, time.Now(), *summary.LatestAt, time.Minute)
+
+	require.NoError(t, h.Handler.SetDeliveryStatus(context.Background(), first, "sent"))
+	h.GET(summaryPath).Decode(&summary)
+	assert.Equal(t, map[string]int{"queued": 2, "sent": 1}, summary.ByStatus, "a transition drops the cached summary")
+	assert.Less(t, len(h.GET(summaryPath).Body), 1024)
+}
+
+func TestGetUserSummary_ETag(t *testing.T) {
+	h := summaryHarness(t)
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+
+	resp := h.GET(summaryPath)
+	require.Equal(t, http.StatusOK, resp.Code)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, etag, h.GET(summaryPath).Header.Get("ETag"), "unchanged while nothing changes")
+
+	h.WithHeader("If-None-Match", etag)
+	resp = h.GET(summaryPath)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Body)
+
+	h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "welcome_email"})
+	resp = h.GET(summaryPath)
+	require.Equal(t, http.StatusOK, resp.Code, "a new send drops the cached summary")
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	var summary models.UserNotificationSummary
+	resp.Decode(&summary)
+	assert.Equal(t, 2, summary.Total)
+}
+
+func TestGetUserSummary_Window(t *testing.T) {
+	h := summaryHarness(t)
+	old := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}).NotificationID()
+
+	key := "notification:status:" + old
+	stored, err := h.Miniredis.Get(key)
+	require.NoError(t, err)
+	var status models.NotificationStatus
+	require.NoError(t, json.Unmarshal([]byte(stored), &status))
+	status.CreatedAt = time.Now().Add(-48 * time.Hour)
+	aged, err := json.Marshal(status)
+	require.NoError(t, err)
+	require.NoError(t, h.Miniredis.Set(key, string(aged)))
+
+	h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "welcome_email"})
+
+	var summary models.UserNotificationSummary
+	h.GET(summaryPath).Decode(&summary)
+	assert.Equal(t, 1, summary.Total)
+	assert.Equal(t, map[string]int{"push": 1}, summary.ByChannel)
+}
+
+func TestGetUserSummary_OnlyWhatTheCallerMayRead(t *testing.T) {
+	h := summaryHarness(t)
+	h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+
+	h.WithClaims(jwt.MapClaims{"sub": "someone-else"})
+	var summary models.UserNotificationSummary
+	resp := h.GET(summaryPath)
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp.Decode(&summary)
+	assert.Zero(t, summary.Total)
+	assert.Nil(t, summary.LatestAt)
+}
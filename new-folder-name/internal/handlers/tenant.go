@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultTenant = "default"
+
+// tenantKey scopes a Redis key or channel to the tenant on ctx, in the
+// handler's namespace. The default tenant keeps keys without a tenant
+// prefix so single-tenant deployments read the data they wrote before
+// tenancy.
+func (n *NotificationHandler) tenantKey(ctx context.Context, key string) string {
+	tenant := middleware.TenantFromContext(ctx)
+	if tenant == "" || tenant == n.cfg.DefaultTenant {
+		return n.keys.Key(key)
+	}
+	return n.keys.Key("tenant:" + tenant + ":" + key)
+}
+
+// tenantOf is the tenant a send on ctx belongs to.
+func (n *NotificationHandler) tenantOf(ctx context.Context) string {
+	if tenant := middleware.TenantFromContext(ctx); tenant != "" {
+		return tenant
+	}
+	return n.cfg.DefaultTenant
+}
+
+// sameTenant reports whether a status record belongs to the caller's tenant.
+// Records written before tenancy belong to the default tenant.
+func (n *NotificationHandler) sameTenant(c *gin.Context, status models.NotificationStatus) bool {
+	owner := status.TenantID
+	if owner == "" {
+		owner = n.cfg.DefaultTenant
+	}
+	return owner == n.tenantOf(c.Request.Context())
+}
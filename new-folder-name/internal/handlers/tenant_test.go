@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_TenantIsolation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockQueue := new(MockRabbitMQClient)
+	mockRedis := setupMockRedis()
+	mockUserService := new(MockUserService)
+	mockTemplateService := new(MockTemplateService)
+	mockUserService.On("ValidateUser", mock.Anything, mock.Anything).Return(true, nil)
+	mockTemplateService.On("ValidateTemplate", mock.Anything, mock.Anything).Return(true, nil)
+	mockQueue.On("PublishEmail", mock.Anything, mock.Anything).Return(nil)
+
+	handler := NewNotificationService(mockQueue, mockRedis, mockUserService, mockTemplateService,
+		config.NotificationsConfig{DefaultTenant: "default"})
+
+	newRouter := func(headerFallback bool) *gin.Engine {
+		router := gin.New()
+		api := router.Group("/api/v1")
+		api.Use(middleware.AuthMiddleware(testAuth.JWTSecret), middleware.TenantMiddleware("default", headerFallback))
+		api.POST("/notification/email", handler.SendEmail)
+		api.GET("/notification/status/:id", handler.GetStatus)
+		return router
+	}
+	router := newRouter(false)
+
+	do := func(router *gin.Engine, method, path, token string, headers map[string]string, body interface{}) (int, models.APIResponse) {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	send := func(router *gin.Engine, token string, headers map[string]string) string {
+		code, resp := do(router, "POST", "/api/v1/notification/email", token, headers,
+			models.SendEmailRequest{UserID: "user123", TemplateID: "welcome"})
+		require.Equal(t, http.StatusOK, code)
+		return resp.Data.(map[string]interface{})["notification_id"].(string)
+	}
+
+	shopA := signedToken(jwt.MapClaims{"sub": "checkout", "tenant_id": "shop-a"})
+	shopB := signedToken(jwt.MapClaims{"sub": "checkout", "tenant_id": "shop-b", "scope": "notifications:read:all"})
+	legacy := signedToken(jwt.MapClaims{"sub": "checkout"})
+	ctx := context.Background()
+
+	t.Run("keys, message and status carry the tenant", func(t *testing.T) {
+		id := send(router, shopA, nil)
+
+		assert.EqualValues(t, 1, mockRedis.Exists(ctx, "tenant:shop-a:notification:status:"+id).Val())
+		assert.EqualValues(t, 0, mockRedis.Exists(ctx, "notification:status:"+id).Val())
+
+		last := mockQueue.Calls[len(mockQueue.Calls)-1]
+		assert.Equal(t, "shop-a", last.Arguments.Get(1).(models.NotificationMessage).TenantID)
+
+		code, resp := do(router, "GET", "/api/v1/notification/status/"+id, shopA, nil, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "shop-a", resp.Data.(map[string]interface{})["tenant_id"])
+	})
+
+	t.Run("other tenants cannot read it, even with read-all", func(t *testing.T) {
+		id := send(router, shopA, nil)
+
+		code, _ := do(router, "GET", "/api/v1/notification/status/"+id, shopB, nil, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = do(router, "GET", "/api/v1/notification/status/"+id, legacy, nil, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("tokens without a tenant use the default tenant's unprefixed keys", func(t *testing.T) {
+		id := send(router, legacy, nil)
+		assert.EqualValues(t, 1, mockRedis.Exists(ctx, "notification:status:"+id).Val())
+
+		code, _ := do(router, "GET", "/api/v1/notification/status/"+id, legacy, nil, nil)
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = do(router, "GET", "/api/v1/notification/status/"+id, shopA, nil, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("the header is only honoured in mock mode", func(t *testing.T) {
+		header := map[string]string{middleware.TenantHeader: "shop-c"}
+
+		id := send(router, legacy, header)
+		assert.EqualValues(t, 1, mockRedis.Exists(ctx, "notification:status:"+id).Val())
+
+		id = send(newRouter(true), legacy, header)
+		assert.EqualValues(t, 1, mockRedis.Exists(ctx, "tenant:shop-c:notification:status:"+id).Val())
+	})
+}
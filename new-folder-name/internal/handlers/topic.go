@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/gin-gonic/gin"
+)
+
+var defaultTopicPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// SendTopicPush broadcasts a push notification to every device subscribed to
+// a topic. There is no single recipient, so user validation is skipped.
+func (n *NotificationHandler) SendTopicPush(c *gin.Context) {
+	if !n.channelEnabled(c, "push") {
+		return
+	}
+	ctx := c.Request.Context()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+
+	var req models.SendTopicPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if !n.topicPattern.MatchString(req.Topic) {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data: []models.FieldError{
+				{Field: "topic", Message: "topic is not allowed"},
+			},
+			Error:   "Invalid topic",
+			Message: "Validation failed",
+		})
+		return
+	}
+	validTemplate, err := n.templateService.ValidateTemplate(ctx, req.TemplateID)
+	if err != nil || !validTemplate {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	notificationID := n.ids.NewID()
+	message := models.NotificationMessage{
+		ID:            notificationID,
+		TenantID:      n.tenantOf(ctx),
+		Type:          "push_topic",
+		Topic:         req.Topic,
+		TemplateID:    req.TemplateID,
+		Variables:     req.Variables,
+		Timestamp:     n.clock.Now(),
+		CorrelationID: correlationID,
+		RequestID:     middleware.RequestIDFromContext(ctx),
+	}
+	if err := n.rabbitClient.PublishPushNot(ctx, message); err != nil {
+		log.Printf("failed to publish topic push notification")
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeQueueUnavailable,
+			Error:   "failed to queue push notification",
+			Message: "Internal Server Error",
+		})
+		return
+	}
+	if err := n.storeNotificationStatus(ctx, models.NotificationStatus{
+		ID:            notificationID,
+		TenantID:      n.tenantOf(ctx),
+		TemplateID:    req.TemplateID,
+		Variables:     req.Variables,
+		Type:          "push_topic",
+		Status:        "queued",
+		Queue:         n.pushQueue(),
+		Topic:         req.Topic,
+		CreatedBy:     middleware.CallerID(c),
+		CorrelationID: correlationID,
+	}); err != nil {
+		log.Printf("failed to log topic push notification status: %v", err)
+	}
+	usage.MarkQueued(c, 1)
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Topic push notification queued successfully",
+		Data: models.NotificationResponse{
+			NotificationID: notificationID,
+			Status:         "queued",
+			QueuedAt:       n.clock.Now(),
+		},
+	})
+}
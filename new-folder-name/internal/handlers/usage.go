@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultUsageDays is the report range when the caller gives no from date.
+const defaultUsageDays = 30
+
+// UsageReporter defines the subset of methods used from the usage recorder.
+type UsageReporter interface {
+	Report(ctx context.Context, client string, from, to time.Time, granularity string) (usage.Report, error)
+}
+
+type UsageHandler struct {
+	usage UsageReporter
+	clock clock.Clock
+}
+
+func NewUsageHandler(usage UsageReporter) *UsageHandler {
+	return &UsageHandler{
+		usage: usage,
+		clock: clock.System,
+	}
+}
+
+// SetClock replaces the clock the default report range ends at.
+func (u *UsageHandler) SetClock(c clock.Clock) {
+	u.clock = c
+}
+
+// GetUsage returns a client's request and error counts over a date range.
+// Dates are YYYY-MM-DD in UTC and both ends are inclusive.
+func (u *UsageHandler) GetUsage(c *gin.Context) {
+	client := c.Query("client")
+	if client == "" {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   "client is required",
+			Message: "Validation failed",
+		})
+		return
+	}
+
+	to := u.clock.Now().UTC()
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Code:    models.CodeValidationError,
+				Data:    []models.FieldError{{Field: "to", Message: "to must be a YYYY-MM-DD date"}},
+				Error:   "Invalid to",
+				Message: "Validation failed",
+			})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -(defaultUsageDays - 1))
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Code:    models.CodeValidationError,
+				Data:    []models.FieldError{{Field: "from", Message: "from must be a YYYY-MM-DD date"}},
+				Error:   "Invalid from",
+				Message: "Validation failed",
+			})
+			return
+		}
+		from = parsed
+	}
+
+	report, err := u.usage.Report(c.Request.Context(), client, from, to, c.DefaultQuery("granularity", "day"))
+	if errors.Is(err, usage.ErrUnknownGranularity) || errors.Is(err, usage.ErrInvalidRange) {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Validation failed",
+		})
+		return
+	}
+	if err != nil {
+		middleware.WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Failed to retrieve usage",
+			Message: "Internal server error",
+		})
+		return
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Usage retrieved successfully",
+		Data:    report,
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// UserLookup is implemented by user service clients that return the whole
+// user record. It is optional; without it recipients are only validated and
+// messages carry no delivery hints.
+type UserLookup interface {
+	GetUser(ctx context.Context, userID string) (*models.User, error)
+}
+
+type userKey struct{}
+
+// withUser returns ctx carrying user, for the locale and the quiet hours to
+// read instead of asking the user service again.
+func withUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// userFromContext returns the record of userID the send looked up, or nil.
+func userFromContext(ctx context.Context, userID string) *models.User {
+	user, _ := ctx.Value(userKey{}).(*models.User)
+	if user == nil || user.ID != userID {
+		return nil
+	}
+	return user
+}
+
+// checkUser answers the request with an error unless userID names an
+// active user. It returns ctx carrying the user's record when the user
+// service gives one.
+func (n *NotificationHandler) checkUser(c *gin.Context, ctx context.Context, userID string) (context.Context, bool) {
+	lookup, ok := n.userService.(UserLookup)
+	if !ok {
+		valid, err := n.userService.ValidateUser(ctx, userID)
+		if err != nil || !valid {
+			writeUserNotFound(c)
+			return ctx, false
+		}
+		return ctx, true
+	}
+
+	user, err := lookup.GetUser(ctx, userID)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		writeUserNotFound(c)
+		return ctx, false
+	case err != nil:
+		log.Printf("failed to look up user %s: %v", userID, err)
+		writeUserServiceUnavailable(c)
+		return ctx, false
+	case !user.Active:
+		writeUserNotFound(c)
+		return ctx, false
+	}
+	if user.ID == "" {
+		user.ID = userID
+	}
+	return withUser(ctx, user), true
+}
+
+// userActive reports whether userID names an active user, asking for the
+// whole record when the user service gives one. It fails, as checkUser
+// does, when that lookup fails for any reason but an unknown user.
+func (n *NotificationHandler) userActive(ctx context.Context, userID string) (bool, error) {
+	if lookup, ok := n.userService.(UserLookup); ok {
+		user, err := lookup.GetUser(ctx, userID)
+		if errors.Is(err, services.ErrUserNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return user.Active, nil
+	}
+	valid, err := n.userService.ValidateUser(ctx, userID)
+	return err == nil && valid, nil
+}
+
+func writeUserServiceUnavailable(c *gin.Context) {
+	middleware.WriteError(c, http.StatusServiceUnavailable, models.APIResponse{
+		Success: false,
+		Code:    models.CodeServiceUnavailable,
+		Error:   "User service unavailable, try again later",
+		Message: "User not available",
+	})
+}
+
+func writeUserNotFound(c *gin.Context) {
+	middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+		Success: false,
+		Code:    models.CodeUserNotFound,
+		Error:   "User not found or unavailable",
+		Message: "User not available",
+	})
+}
+
+// recipientHint returns the user's address on channel as the send looked it
+// up, or nil when it didn't or the user has none.
+func recipientHint(ctx context.Context, userID, channel string) *models.Recipient {
+	user := userFromContext(ctx, userID)
+	if user == nil {
+		return nil
+	}
+	var hint models.Recipient
+	switch channel {
+	case "email":
+		hint.Email = user.Email
+	case "push":
+		hint.PushTokens = user.PushTokens
+	case "whatsapp":
+		hint.Phone = user.Phone
+	}
+	if hint.Email == "" && hint.Phone == "" && len(hint.PushTokens) == 0 {
+		return nil
+	}
+	return &hint
+}
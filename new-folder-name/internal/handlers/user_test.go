@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend_AttachesRecipientHints(t *testing.T) {
+	h := handlertest.NewHarness().WithTemplateType("order_shipped", "whatsapp").Start(t)
+	h.Users.User = models.User{
+		Email:      "ada@example.com",
+		Phone:      "+15550100001",
+		PushTokens: []string{"token-1"},
+		Locale:     "fr-CA",
+	}
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"})
+	require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+	resp = h.POST("/api/v1/notification/push", models.SendPushRequest{UserID: "user123", TemplateID: "welcome_push"})
+	require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+	resp = h.POST("/api/v1/notification/whatsapp", models.SendWhatsAppRequest{UserID: "user123", TemplateID: "order_shipped"})
+	require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+
+	email := h.Queue.Emails()[0]
+	assert.Equal(t, &models.Recipient{Email: "ada@example.com"}, email.Recipient)
+	assert.Equal(t, "fr-CA", email.Locale, "the record's locale is used")
+	assert.Equal(t, &models.Recipient{PushTokens: []string{"token-1"}}, h.Queue.Pushes()[0].Recipient)
+	assert.Equal(t, &models.Recipient{Phone: "+15550100001"}, h.Queue.WhatsApps()[0].Recipient)
+}
+
+func TestSend_PreferencesFromUserRecord(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	h.Users.Preferences = models.Preferences{EmailOptOut: true}
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "promo", Category: "marketing"})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Equal(t, models.CodeUserOptedOut, resp.API().Code)
+	assert.Empty(t, h.Queue.Emails())
+	assert.Zero(t, h.Users.PreferenceLookups.Load(), "the preferences come with the user record")
+}
+
+func TestSend_PreferencesMissingFromUserRecord(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	h.Users.Preferences = models.Preferences{EmailOptOut: true}
+	h.Users.OmitPreferences = true
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "promo", Category: "marketing"})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Equal(t, models.CodeUserOptedOut, resp.API().Code)
+	assert.Empty(t, h.Queue.Emails())
+	assert.Equal(t, int64(1), h.Users.PreferenceLookups.Load(), "read from the preferences endpoint")
+}
+
+func TestSendEmail_CCCheckedWithUserRecord(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	h.Users.Inactive = map[string]bool{"billing-2": true}
+
+	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{
+		UserID:     "user123",
+		TemplateID: "welcome_email",
+		CC:         []string{"billing-1", "billing-2"},
+		BCC:        []string{"audit-1"},
+	})
+	require.Equal(t, http.StatusBadRequest, resp.Code, string(resp.Body))
+	var fieldErrors []models.FieldError
+	resp.Decode(&fieldErrors)
+	require.Len(t, fieldErrors, 1)
+	assert.Equal(t, "cc[1]", fieldErrors[0].Field)
+	assert.Empty(t, h.Queue.Emails())
+}
+
+func TestSend_UserLookupFailures(t *testing.T) {
+	send := models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}
+
+	h := handlertest.NewHarness().WithUser(false).Start(t)
+	resp := h.POST("/api/v1/notification/email", send)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, models.CodeUserNotFound, resp.API().Code)
+
+	h = handlertest.NewHarness().Start(t)
+	h.Users.Err = fmt.Errorf("%w: status 502", services.ErrUserServiceUnavailable)
+	resp = h.POST("/api/v1/notification/email", send)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "a transient failure is not the user's fault")
+	assert.Equal(t, models.CodeServiceUnavailable, resp.API().Code)
+	assert.Empty(t, h.Queue.Emails())
+
+	h = handlertest.NewHarness().Start(t)
+	h.Users.Errs = map[string]error{"billing-1": fmt.Errorf("%w: status 503", services.ErrUserServiceUnavailable)}
+	send.CC = []string{"billing-1"}
+	resp = h.POST("/api/v1/notification/email", send)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "nor is one looking up a cc")
+	assert.Equal(t, models.CodeServiceUnavailable, resp.API().Code)
+	assert.Empty(t, h.Queue.Emails())
+}
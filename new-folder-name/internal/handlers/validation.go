@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"golang.org/x/text/language"
+)
+
+const (
+	maxAttachments        = 5
+	maxAttachmentURL      = 2048
+	maxAttachmentFilename = 255
+
+	maxDeviceTokens   = 20
+	minDeviceTokenLen = 8
+	maxDeviceTokenLen = 4096
+
+	defaultMaxExtraRecipients = 10
+	// maxRecipientLookups bounds the concurrent user service calls made for
+	// one request's CC/BCC list.
+	maxRecipientLookups = 4
+
+	maxMetadataKeys  = 10
+	maxMetadataValue = 256
+
+	// maxExpiresIn bounds a notification's time in the queue.
+	maxExpiresIn = 7 * 24 * time.Hour
+)
+
+var (
+	safeFilename = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._ -]*$`)
+	// deviceToken accepts the FCM, APNs and web push token alphabets.
+	deviceToken = regexp.MustCompile(`^[A-Za-z0-9_:.\-]+$`)
+	// metadataKey keeps keys safe to embed in index keys and query strings.
+	metadataKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+// validateAttachments checks every attachment reference and returns one
+// FieldError per problem so the caller can fix them all in one go.
+func validateAttachments(attachments []models.Attachment) []models.FieldError {
+	var errs []models.FieldError
+	if len(attachments) > maxAttachments {
+		errs = append(errs, models.FieldError{
+			Field:   "attachments",
+			Message: fmt.Sprintf("at most %d attachments are allowed", maxAttachments),
+		})
+	}
+	for i, a := range attachments {
+		field := fmt.Sprintf("attachments[%d]", i)
+
+		switch u, err := url.Parse(a.URL); {
+		case a.URL == "":
+			errs = append(errs, models.FieldError{Field: field + ".url", Message: "url is required"})
+		case len(a.URL) > maxAttachmentURL:
+			errs = append(errs, models.FieldError{Field: field + ".url", Message: "url is too long"})
+		case err != nil || u.Host == "":
+			errs = append(errs, models.FieldError{Field: field + ".url", Message: "url is malformed"})
+		case u.Scheme != "https":
+			errs = append(errs, models.FieldError{Field: field + ".url", Message: "url must use https"})
+		}
+
+		switch {
+		case a.Filename == "":
+			errs = append(errs, models.FieldError{Field: field + ".filename", Message: "filename is required"})
+		case len(a.Filename) > maxAttachmentFilename:
+			errs = append(errs, models.FieldError{Field: field + ".filename", Message: "filename is too long"})
+		case strings.Contains(a.Filename, "..") || !safeFilename.MatchString(a.Filename):
+			errs = append(errs, models.FieldError{Field: field + ".filename", Message: "filename contains unsafe characters"})
+		}
+
+		if _, _, err := mime.ParseMediaType(a.ContentType); err != nil {
+			errs = append(errs, models.FieldError{Field: field + ".content_type", Message: "content_type must be a valid media type"})
+		}
+	}
+	return errs
+}
+
+// validateLocale accepts an empty locale or a well-formed BCP-47 tag.
+func validateLocale(locale string) []models.FieldError {
+	if locale == "" {
+		return nil
+	}
+	if _, err := language.Parse(locale); err != nil {
+		return []models.FieldError{{Field: "locale", Message: "locale must be a BCP-47 language tag"}}
+	}
+	return nil
+}
+
+// validateDeviceTokens does a minimal format check; the push provider is the
+// authority on whether a token is still registered.
+func validateDeviceTokens(tokens []string) []models.FieldError {
+	var errs []models.FieldError
+	if len(tokens) > maxDeviceTokens {
+		errs = append(errs, models.FieldError{
+			Field:   "device_tokens",
+			Message: fmt.Sprintf("at most %d device tokens are allowed", maxDeviceTokens),
+		})
+	}
+	for i, token := range tokens {
+		if len(token) < minDeviceTokenLen || len(token) > maxDeviceTokenLen || !deviceToken.MatchString(token) {
+			errs = append(errs, models.FieldError{
+				Field:   fmt.Sprintf("device_tokens[%d]", i),
+				Message: "device token is malformed",
+			})
+			continue
+		}
+		if strings.HasPrefix(token, queue.WebPushTokenPrefix) {
+			if _, err := queue.ParseWebPushToken(token); err != nil {
+				errs = append(errs, models.FieldError{
+					Field:   fmt.Sprintf("device_tokens[%d]", i),
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+	return errs
+}
+
+// validateMetadata checks the caller's metadata. Keys are reported in
+// sorted order so the errors are stable.
+func validateMetadata(metadata map[string]string) []models.FieldError {
+	var errs []models.FieldError
+	if len(metadata) > maxMetadataKeys {
+		errs = append(errs, models.FieldError{
+			Field:   "metadata",
+			Message: fmt.Sprintf("at most %d metadata keys are allowed", maxMetadataKeys),
+		})
+	}
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field := fmt.Sprintf("metadata[%s]", key)
+		if !metadataKey.MatchString(key) {
+			errs = append(errs, models.FieldError{
+				Field:   field,
+				Message: "key must be 1-64 letters, digits, '_', '.' or '-'",
+			})
+		}
+		if utf8.RuneCountInString(metadata[key]) > maxMetadataValue {
+			errs = append(errs, models.FieldError{
+				Field:   field,
+				Message: fmt.Sprintf("value must be at most %d characters", maxMetadataValue),
+			})
+		}
+	}
+	return errs
+}
+
+// validateExpiresIn checks a request's expires_in_seconds; 0 means the
+// notification doesn't expire.
+func validateExpiresIn(seconds int) []models.FieldError {
+	if seconds < 0 || seconds > int(maxExpiresIn/time.Second) {
+		return []models.FieldError{{
+			Field:   "expires_in_seconds",
+			Message: fmt.Sprintf("must be between 1 and %d seconds", int(maxExpiresIn.Seconds())),
+		}}
+	}
+	return nil
+}
+
+// validateExtraRecipients checks the CC/BCC user IDs against the user
+// service concurrently and returns a FieldError for every one that fails.
+// A lookup the user service couldn't answer is returned as the error
+// instead.
+func (n *NotificationHandler) validateExtraRecipients(ctx context.Context, cc, bcc []string) ([]models.FieldError, error) {
+	if total := len(cc) + len(bcc); total > n.cfg.MaxExtraRecipients {
+		return []models.FieldError{{
+			Field:   "cc",
+			Message: fmt.Sprintf("at most %d cc/bcc recipients are allowed, got %d", n.cfg.MaxExtraRecipients, total),
+		}}, nil
+	}
+
+	type lookup struct {
+		field  string
+		userID string
+	}
+	var lookups []lookup
+	for i, id := range cc {
+		lookups = append(lookups, lookup{field: fmt.Sprintf("cc[%d]", i), userID: id})
+	}
+	for i, id := range bcc {
+		lookups = append(lookups, lookup{field: fmt.Sprintf("bcc[%d]", i), userID: id})
+	}
+
+	failed := make([]bool, len(lookups))
+	lookupErrs := make([]error, len(lookups))
+	sem := make(chan struct{}, maxRecipientLookups)
+	var wg sync.WaitGroup
+	for i, l := range lookups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, userID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			active, err := n.userActive(ctx, userID)
+			failed[i], lookupErrs[i] = !active, err
+		}(i, l.userID)
+	}
+	wg.Wait()
+	for i, err := range lookupErrs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %w", lookups[i].field, err)
+		}
+	}
+
+	var errs []models.FieldError
+	for i, l := range lookups {
+		if failed[i] {
+			errs = append(errs, models.FieldError{
+				Field:   l.field,
+				Message: fmt.Sprintf("user %s not found or unavailable", l.userID),
+			})
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/render"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	templateVariablesCacheSize = 256
+	templateVariablesCacheTTL  = 5 * time.Minute
+)
+
+// TemplateSourcer is implemented by template service clients that can
+// return a template's source. It is optional; without it nothing is
+// extracted and sends carry no variable warnings.
+type TemplateSourcer interface {
+	TemplateSource(ctx context.Context, templateID string) (source, syntax string, err error)
+}
+
+// TemplateVariables is what the variables endpoint reports for a template.
+type TemplateVariables struct {
+	TemplateID string `json:"template_id"`
+	Syntax     string `json:"syntax,omitempty"`
+	// SourceAvailable is false when the template service didn't return the
+	// source, in which case Variables is empty rather than known to be.
+	SourceAvailable bool     `json:"source_available"`
+	Variables       []string `json:"variables"`
+}
+
+// errTemplateSource wraps a template whose source couldn't be parsed.
+type errTemplateSource struct{ err error }
+
+func (e errTemplateSource) Error() string { return e.err.Error() }
+
+// templateVariables extracts the variables of a template, caching the
+// result so sends don't refetch the source every time.
+func (n *NotificationHandler) templateVariables(ctx context.Context, templateID string) (TemplateVariables, error) {
+	if cached, ok := n.variablesCache.Get(templateID); ok {
+		var vars TemplateVariables
+		if json.Unmarshal([]byte(cached), &vars) == nil {
+			return vars, nil
+		}
+	}
+
+	vars := TemplateVariables{TemplateID: templateID, Variables: []string{}}
+	sourcer, ok := n.templateService.(TemplateSourcer)
+	if !ok {
+		return vars, nil
+	}
+	source, syntaxName, err := sourcer.TemplateSource(ctx, templateID)
+	if err != nil {
+		return vars, err
+	}
+	if syntaxName == "" {
+		syntaxName = n.cfg.TemplateSyntax
+	}
+	syntax, err := render.ParseSyntax(syntaxName)
+	if err != nil {
+		return vars, errTemplateSource{err}
+	}
+	vars.Syntax = string(syntax)
+	if source != "" {
+		paths, err := render.ExtractVariables(source, syntax)
+		if err != nil {
+			return vars, errTemplateSource{err}
+		}
+		vars.SourceAvailable = true
+		vars.Variables = paths
+	}
+
+	if encoded, err := json.Marshal(vars); err == nil {
+		n.variablesCache.Set(templateID, string(encoded))
+	}
+	return vars, nil
+}
+
+// GetTemplateVariables lists the variables a template refers to, for
+// templates that have no schema to consult.
+func (n *NotificationHandler) GetTemplateVariables(c *gin.Context) {
+	ctx := c.Request.Context()
+	templateID := c.Param("id")
+
+	vars, err := n.templateVariables(ctx, templateID)
+	if err != nil {
+		if parseErr, ok := err.(errTemplateSource); ok {
+			middleware.WriteError(c, http.StatusUnprocessableEntity, models.APIResponse{
+				Success: false,
+				Code:    models.CodeTemplateUnparseable,
+				Error:   parseErr.Error(),
+				Message: "Template source could not be parsed",
+			})
+			return
+		}
+		log.Printf("failed to read template %s: %v", templateID, err)
+		middleware.WriteError(c, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Not found",
+		})
+		return
+	}
+	middleware.WriteResponse(c, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Template variables retrieved successfully",
+		Data:    vars,
+	})
+}
+
+// variableWarnings names the template variables the request doesn't
+// provide. It never fails a send: a template it can't read yields no
+// warnings.
+func (n *NotificationHandler) variableWarnings(ctx context.Context, templateID string, provided map[string]interface{}) []string {
+	if n.cfg.TemplateVariableCheck != "warn" {
+		return nil
+	}
+	vars, err := n.templateVariables(ctx, templateID)
+	if err != nil {
+		log.Printf("skipping variable check for template %s: %v", templateID, err)
+		return nil
+	}
+	var warnings []string
+	for _, name := range render.MissingVariables(vars.Variables, provided) {
+		warnings = append(warnings, fmt.Sprintf("variable %s referenced by template but not provided", name))
+	}
+	return warnings
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const receiptSource = `Hi {{.name}}, {{range .items}}{{.sku}} {{.price}}{{end}}{{if .coupon}}{{.coupon.code}}{{end}}`
+
+func TestGetTemplateVariables(t *testing.T) {
+	t.Run("extracted from the source", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateSource("receipt", receiptSource).Start(t)
+
+		resp := h.GET("/api/v1/templates/receipt/variables")
+		require.Equal(t, http.StatusOK, resp.Code)
+		var vars handlers.TemplateVariables
+		resp.Decode(&vars)
+		assert.Equal(t, handlers.TemplateVariables{
+			TemplateID:      "receipt",
+			Syntax:          "go",
+			SourceAvailable: true,
+			Variables:       []string{"coupon", "coupon.code", "items", "items[].price", "items[].sku", "name"},
+		}, vars)
+	})
+
+	t.Run("syntax reported by the template service", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateSource("welcome", "Hi {{first_name}}{{#vip}} {{tier}}{{/vip}}").Start(t)
+		h.Templates.Syntax = "mustache"
+
+		var vars handlers.TemplateVariables
+		h.GET("/api/v1/templates/welcome/variables").Decode(&vars)
+		assert.Equal(t, []string{"first_name", "vip", "vip.tier"}, vars.Variables)
+	})
+
+	t.Run("no source", func(t *testing.T) {
+		h := handlertest.NewHarness().Start(t)
+
+		resp := h.GET("/api/v1/templates/legacy/variables")
+		require.Equal(t, http.StatusOK, resp.Code)
+		var vars handlers.TemplateVariables
+		resp.Decode(&vars)
+		assert.False(t, vars.SourceAvailable)
+		assert.Empty(t, vars.Variables)
+	})
+
+	t.Run("malformed source", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateSource("broken", "{{if .x}}unterminated").Start(t)
+
+		resp := h.GET("/api/v1/templates/broken/variables")
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		assert.Equal(t, models.CodeTemplateUnparseable, resp.API().Code)
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplate(false).Start(t)
+
+		resp := h.GET("/api/v1/templates/missing/variables")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Equal(t, models.CodeTemplateNotFound, resp.API().Code)
+	})
+}
+
+func TestSend_VariableWarnings(t *testing.T) {
+	warn := config.NotificationsConfig{TemplateVariableCheck: "warn"}
+
+	t.Run("missing variables are warned about, not rejected", func(t *testing.T) {
+		h := handlertest.NewHarness().WithConfig(warn).WithTemplateSource("receipt", receiptSource).Start(t)
+
+		resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{
+			UserID:     "user123",
+			TemplateID: "receipt",
+			Variables:  map[string]interface{}{"name": "Ada"},
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, []string{
+			"variable coupon referenced by template but not provided",
+			"variable items referenced by template but not provided",
+		}, resp.API().Warnings)
+		if emails := h.Queue.Emails(); assert.Len(t, emails, 1) {
+			assert.Equal(t, map[string]interface{}{"name": "Ada"}, emails[0].Variables)
+		}
+	})
+
+	t.Run("all provided", func(t *testing.T) {
+		h := handlertest.NewHarness().WithConfig(warn).WithTemplateSource("receipt", receiptSource).Start(t)
+
+		resp := h.POST("/api/v1/notification/push", models.SendPushRequest{
+			UserID:     "user123",
+			TemplateID: "receipt",
+			Variables:  map[string]interface{}{"name": "Ada", "items": []interface{}{}, "coupon": nil},
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.API().Warnings)
+	})
+
+	t.Run("unreadable templates don't block sends", func(t *testing.T) {
+		h := handlertest.NewHarness().WithConfig(warn).WithTemplateSource("broken", "{{.name").Start(t)
+
+		resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "broken"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.API().Warnings)
+	})
+
+	t.Run("off unless configured", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateSource("receipt", receiptSource).Start(t)
+
+		resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "receipt"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.API().Warnings)
+	})
+}
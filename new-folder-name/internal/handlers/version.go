@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/franzego/stage04/pkg/buildinfo"
+	"github.com/gin-gonic/gin"
+)
+
+// VersionHandler reports which build is running and with which config.
+type VersionHandler struct {
+	info buildinfo.Info
+}
+
+func NewVersionHandler(info buildinfo.Info) *VersionHandler {
+	return &VersionHandler{info: info}
+}
+
+// GetVersion is unauthenticated so ops can compare instances directly.
+func (h *VersionHandler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, h.info)
+}
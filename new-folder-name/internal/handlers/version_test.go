@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franzego/stage04/pkg/buildinfo"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewVersionHandler(buildinfo.Get("0123456789abcdef"))
+	router := gin.New()
+	router.GET("/version", handler.GetVersion)
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	for _, field := range []string{"version", "commit", "build_time", "go_version", "config_fingerprint"} {
+		assert.NotEmpty(t, body[field], field)
+	}
+	assert.Equal(t, "0123456789abcdef", body["config_fingerprint"])
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// statusView is how much of a status record a caller is shown.
+type statusView string
+
+const (
+	// fullView is every field, for internal and trusted callers.
+	fullView statusView = "full"
+	// publicView leaves out the fields in Config.InternalStatusFields and
+	// reports a failure by its category instead of the provider's error.
+	publicView statusView = "public"
+)
+
+// defaultInternalStatusFields are left out of the public view unless
+// configured otherwise: the queue is deployment detail, the last error is
+// the provider's raw message, and delivery holds the recipients' addresses.
+var defaultInternalStatusFields = []string{"queue", "last_error", "delivery"}
+
+// internalFieldIndexes maps the JSON names in fields to their
+// NotificationStatus field indexes. Unknown names are logged and skipped.
+func internalFieldIndexes(fields []string) []int {
+	byName := map[string]int{}
+	statusType := reflect.TypeOf(models.NotificationStatus{})
+	for i := 0; i < statusType.NumField(); i++ {
+		name, _, _ := strings.Cut(statusType.Field(i).Tag.Get("json"), ",")
+		byName[name] = i
+	}
+	indexes := make([]int, 0, len(fields))
+	for _, field := range fields {
+		index, ok := byName[field]
+		if !ok || field == "id" || field == "status" {
+			log.Printf("ignoring internal status field %q: not a redactable field", field)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// statusView picks the view for the caller: full for admins, holders of the
+// internal scope and the configured trusted clients, public for everyone
+// else.
+func (n *NotificationHandler) statusView(c *gin.Context) statusView {
+	view := publicView
+	caller := middleware.CallerID(c)
+	switch {
+	case middleware.CallerHasScope(c, middleware.AdminScope),
+		middleware.CallerHasScope(c, middleware.InternalScope),
+		caller != "" && n.trustedClients[caller]:
+		view = fullView
+	}
+	log.Printf("serving %s status view to %q on %s", view, caller, c.FullPath())
+	return view
+}
+
+// shape returns status as the view shows it.
+func (n *NotificationHandler) shape(view statusView, status models.NotificationStatus) models.NotificationStatus {
+	if view == fullView {
+		return status
+	}
+	status.ErrorCategory = errorCategory(status.LastError)
+	fields := reflect.ValueOf(&status).Elem()
+	for _, index := range n.internalFields {
+		field := fields.Field(index)
+		field.Set(reflect.Zero(field.Type()))
+	}
+	return status
+}
+
+// shapeJSON is shape for a record still in its stored form. A record that
+// doesn't decode is only passed through in the full view.
+func (n *NotificationHandler) shapeJSON(view statusView, statusJSON string) (string, bool) {
+	if view == fullView {
+		return statusJSON, true
+	}
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+		return "", false
+	}
+	shaped, err := json.Marshal(n.shape(view, status))
+	if err != nil {
+		return "", false
+	}
+	return string(shaped), true
+}
+
+// errorCategory sorts a provider error into the generic category untrusted
+// callers see. Empty when there is no error.
+func errorCategory(lastError string) string {
+	if lastError == "" {
+		return ""
+	}
+	lower := strings.ToLower(lastError)
+	for _, hint := range []string{"timeout", "timed out", "unavailable", "temporar", "connection", "rate limit", "throttl"} {
+		if strings.Contains(lower, hint) {
+			return "temporary_failure"
+		}
+	}
+	for _, hint := range []string{"reject", "invalid", "bounce", "blocked", "unsubscribed", "not registered"} {
+		if strings.Contains(lower, hint) {
+			return "rejected"
+		}
+	}
+	return "delivery_error"
+}
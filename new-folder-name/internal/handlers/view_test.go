@@ -0,0 +1,190 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failedSend sends a multi-channel email, records a failed attempt on it and
+// marks it failed. It returns the notification and group IDs.
+func failedSend(t *testing.T, h *handlertest.Harness) (string, string) {
+	t.Helper()
+	resp := h.POST("/api/v1/notification/multi", multiRequest("email"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var data models.MultiSendResponse
+	resp.Decode(&data)
+	id := data.Results[0].NotificationID
+	ctx := context.Background()
+	require.NoError(t, h.Handler.RecordAttempt(ctx, id, errors.New("smtp 550: mailbox rejected by mx.example.net")))
+	require.NoError(t, h.Handler.SetDeliveryStatus(ctx, id, "failed"))
+	return id, data.GroupID
+}
+
+// readViews reads the failed notification through every read endpoint open
+// to the harness caller and returns what each one showed.
+func readViews(t *testing.T, h *handlertest.Harness, id, groupID string) map[string]map[string]interface{} {
+	t.Helper()
+	views := map[string]map[string]interface{}{}
+
+	resp := h.GET("/api/v1/notification/status/" + id)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var status map[string]interface{}
+	resp.Decode(&status)
+	views["status"] = status
+
+	resp = h.GET("/api/v1/notification/status/" + id + "?include=history")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var withHistory map[string]interface{}
+	resp.Decode(&withHistory)
+	views["status with history"] = withHistory
+
+	resp = h.GET("/api/v1/notification/group/" + groupID)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var group struct {
+		Notifications []map[string]interface{} `json:"notifications"`
+	}
+	resp.Decode(&group)
+	require.Len(t, group.Notifications, 1)
+	views["group"] = group.Notifications[0]
+
+	// a failed notification is terminal, so the stream ends after one status
+	resp = h.GET("/api/v1/notification/status/" + id + "/stream")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var streamed map[string]interface{}
+	for _, line := range strings.Split(string(resp.Body), "\n") {
+		if data, ok := strings.CutPrefix(line, "data:"); ok && streamed == nil {
+			require.NoError(t, json.Unmarshal([]byte(data), &streamed))
+		}
+	}
+	require.NotNil(t, streamed)
+	views["stream"] = streamed
+	return views
+}
+
+func TestStatusView_Untrusted(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	id, groupID := failedSend(t, h)
+
+	for endpoint, status := range readViews(t, h, id, groupID) {
+		assert.Equal(t, id, status["id"], endpoint)
+		assert.Equal(t, "failed", status["status"], endpoint)
+		assert.Equal(t, float64(1), status["attempts"], endpoint)
+		assert.Equal(t, "rejected", status["error_category"], endpoint)
+		assert.NotContains(t, status, "last_error", endpoint)
+		assert.NotContains(t, status, "queue", endpoint)
+		assert.NotContains(t, status, "delivery", endpoint)
+	}
+}
+
+func TestStatusView_Trusted(t *testing.T) {
+	tests := []struct {
+		name    string
+		harness *handlertest.Harness
+	}{
+		{
+			name: "internal scope",
+			harness: handlertest.NewHarness().
+				WithClaims(jwt.MapClaims{"sub": handlertest.DefaultCaller, "scope": middleware.InternalScope}),
+		},
+		{
+			name: "trusted client",
+			harness: handlertest.NewHarness().
+				WithConfig(config.NotificationsConfig{TrustedClients: []string{handlertest.DefaultCaller}}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.harness.Start(t)
+			id, groupID := failedSend(t, h)
+
+			for endpoint, status := range readViews(t, h, id, groupID) {
+				assert.Equal(t, "smtp 550: mailbox rejected by mx.example.net", status["last_error"], endpoint)
+				assert.NotContains(t, status, "error_category", endpoint)
+			}
+		})
+	}
+}
+
+func TestStatusView_ConfiguredFields(t *testing.T) {
+	h := handlertest.NewHarness().
+		WithConfig(config.NotificationsConfig{InternalStatusFields: []string{"last_error", "variables"}}).
+		Start(t)
+	id, groupID := failedSend(t, h)
+
+	for endpoint, status := range readViews(t, h, id, groupID) {
+		assert.NotContains(t, status, "last_error", endpoint)
+		assert.NotContains(t, status, "variables", endpoint)
+		assert.Equal(t, "rejected", status["error_category"], endpoint)
+	}
+}
+
+func TestStatusView_Patch(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	h.Miniredis.Set("notification:status:n-1",
+		`{"id":"n-1","type":"email","status":"scheduled","created_by":"test-client","queue":"email.queue","last_error":"provider timeout"}`)
+
+	high := "high"
+	resp := h.Do(http.MethodPatch, "/api/v1/notification/n-1", models.PatchNotificationRequest{Priority: &high})
+	require.Equal(t, http.StatusOK, resp.Code)
+	var status map[string]interface{}
+	resp.Decode(&status)
+	assert.Equal(t, "high", status["priority"])
+	assert.Equal(t, "temporary_failure", status["error_category"])
+	assert.NotContains(t, status, "last_error")
+	assert.NotContains(t, status, "queue")
+}
+
+func TestStatusView_AdminList(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	req := multiRequest("email")
+	req.Metadata = map[string]string{"order": "A-1"}
+	resp := h.POST("/api/v1/notification/multi", req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var sent models.MultiSendResponse
+	resp.Decode(&sent)
+	require.NoError(t, h.Handler.RecordAttempt(context.Background(), sent.Results[0].NotificationID, errors.New("smtp timeout")))
+
+	// admins always get the full view
+	list := httptest.NewRequest(http.MethodGet, "/api/v1/admin/notifications?metadata_key=order&metadata_value=A-1", nil)
+	list.Header.Set("Authorization", handlertest.Token(jwt.MapClaims{"sub": "ops", "scope": middleware.AdminScope}))
+	w := httptest.NewRecorder()
+	h.Router.ServeHTTP(w, list)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data struct {
+			Notifications []map[string]interface{} `json:"notifications"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Data.Notifications, 1)
+	assert.Equal(t, "smtp timeout", body.Data.Notifications[0]["last_error"])
+}
+
+func TestMarkUpgradedFromLegacy(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	id := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "user123", TemplateID: "welcome_email"}).NotificationID()
+
+	require.NoError(t, h.Handler.MarkUpgradedFromLegacy(context.Background(), id))
+
+	resp := h.GET("/api/v1/notification/status/" + id)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var status models.NotificationStatus
+	resp.Decode(&status)
+	assert.True(t, status.UpgradedFromLegacy)
+	assert.Equal(t, "queued", status.Status, "only the flag changes")
+
+	assert.Error(t, h.Handler.MarkUpgradedFromLegacy(context.Background(), "missing"))
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/franzego/stage04/internal/budget"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/usage"
+	"github.com/gin-gonic/gin"
+)
+
+// TemplateDescriber is implemented by template service clients that return
+// a template's metadata rather than only whether it exists. WhatsApp sends
+// need it to check the template's type; without it they are refused.
+type TemplateDescriber interface {
+	TemplateMetadata(ctx context.Context, templateID string) (models.TemplateMetadata, error)
+}
+
+// SendWhatsApp queues a WhatsApp Business template message for a user.
+func (n *NotificationHandler) SendWhatsApp(c *gin.Context) {
+	if !n.channelEnabled(c, "whatsapp") {
+		return
+	}
+	// keeps the tenant but not the cancellation, so a client hanging up
+	// can't abandon a half-made send; each phase gets its share of the
+	// request's deadline
+	sendCtx, cancel := sendContext(c)
+	defer cancel()
+	sendBudget := n.newBudget(sendCtx)
+	ctx, endValidation, ok := startPhase(c, sendCtx, sendBudget, budget.Validation)
+	if !ok {
+		return
+	}
+	defer endValidation()
+	correlationIDVal, _ := c.Get(middleware.CorrelationIDKey)
+	correlationID, _ := correlationIDVal.(string)
+
+	var req models.SendWhatsAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Error:   err.Error(),
+			Message: "Invalid Request Body",
+		})
+		return
+	}
+	if fieldErrors := validateLocale(req.Locale); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid locale",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateMetadata(req.Metadata); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid metadata",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if fieldErrors := validateExpiresIn(req.ExpiresInSeconds); len(fieldErrors) > 0 {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data:    fieldErrors,
+			Error:   "Invalid expiry",
+			Message: "Validation failed",
+		})
+		return
+	}
+	if ctx, ok = n.checkUser(c, ctx, req.UserID); !ok {
+		return
+	}
+	decision, ok := n.applyPolicies(c, ctx, EnqueueRequest{
+		Channel:    "whatsapp",
+		TenantID:   n.tenantOf(ctx),
+		UserID:     req.UserID,
+		TemplateID: req.TemplateID,
+		Category:   req.Category,
+		DeliverAt:  n.clock.Now(),
+		Metadata:   req.Metadata,
+	})
+	if !ok {
+		return
+	}
+	if !n.isWhatsAppTemplate(c, req.TemplateID) {
+		return
+	}
+
+	warnings := n.variableWarnings(ctx, req.TemplateID, req.Variables)
+	notificationID := n.ids.NewID()
+	message := models.NotificationMessage{
+		ID:               notificationID,
+		TenantID:         n.tenantOf(ctx),
+		Type:             "whatsapp",
+		UserID:           req.UserID,
+		TemplateID:       req.TemplateID,
+		Variables:        req.Variables,
+		Timestamp:        n.clock.Now(),
+		CorrelationID:    correlationID,
+		RequestID:        middleware.RequestIDFromContext(ctx),
+		Locale:           n.resolveLocale(ctx, req.Locale, req.UserID),
+		Category:         req.Category,
+		Metadata:         req.Metadata,
+		ExpiresInSeconds: req.ExpiresInSeconds,
+		Recipient:        recipientHint(ctx, req.UserID, "whatsapp"),
+	}
+	status, responseMessage := "queued", "WhatsApp notification queued successfully"
+	if decision.Verdict == Defer {
+		message.ScheduledFor = decision.Until
+		status, responseMessage = "deferred", "WhatsApp notification deferred "+decision.Reason
+	}
+	endValidation()
+	publishCtx, endPublish, ok := startPhase(c, sendCtx, sendBudget, budget.Publish)
+	if !ok {
+		return
+	}
+	record := models.NotificationStatus{
+		ID:            notificationID,
+		TenantID:      message.TenantID,
+		UserID:        req.UserID,
+		TemplateID:    req.TemplateID,
+		Variables:     message.Variables,
+		Category:      message.Category,
+		Metadata:      message.Metadata,
+		Type:          "whatsapp",
+		Queue:         n.whatsAppQueue(),
+		Status:        status,
+		ScheduledFor:  message.ScheduledFor,
+		Locale:        message.Locale,
+		PolicyReason:  deferReason(decision),
+		CreatedBy:     middleware.CallerID(c),
+		CorrelationID: correlationID,
+		Delivery:      deliveryOf(message),
+	}
+	buffered, err := n.publishOrBuffer(publishCtx, n.rabbitClient.PublishWhatsApp, n.whatsAppQueue(), message, record)
+	endPublish()
+	if err != nil {
+		log.Printf("failed to publish whatsapp notification: %v", err)
+		writePublishError(c, err, "failed to queue whatsapp notification")
+		return
+	}
+	code := http.StatusOK
+	if buffered {
+		code, status, responseMessage = http.StatusAccepted, outboxStatus, "WhatsApp notification accepted, to be queued once the broker is back"
+	} else if !n.persistStatus(c, sendCtx, sendBudget, record) {
+		return
+	}
+	usage.MarkQueued(c, 1)
+	middleware.WriteResponse(c, code, models.APIResponse{
+		Success:  true,
+		Message:  responseMessage,
+		Warnings: warnings,
+		Data: models.NotificationResponse{
+			NotificationID: notificationID,
+			Status:         status,
+			QueuedAt:       n.clock.Now(),
+			ScheduledFor:   message.ScheduledFor,
+		},
+	})
+}
+
+// isWhatsAppTemplate writes a 400 and returns false unless the template
+// service lists the template as a WhatsApp one.
+func (n *NotificationHandler) isWhatsAppTemplate(c *gin.Context, templateID string) bool {
+	describer, ok := n.templateService.(TemplateDescriber)
+	if !ok {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template service cannot confirm WhatsApp templates",
+			Message: "Validation failed",
+		})
+		return false
+	}
+	metadata, err := describer.TemplateMetadata(c.Request.Context(), templateID)
+	if err != nil {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeTemplateNotFound,
+			Error:   "Template not found or unavailable",
+			Message: "Validation failed",
+		})
+		return false
+	}
+	if metadata.Type != "whatsapp" {
+		middleware.WriteError(c, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Code:    models.CodeValidationError,
+			Data: []models.FieldError{
+				{Field: "template_id", Message: "template is not a WhatsApp template"},
+			},
+			Error:   "Invalid template type",
+			Message: "Validation failed",
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/franzego/stage04/internal/handlertest"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendWhatsApp(t *testing.T) {
+	send := models.SendWhatsAppRequest{
+		UserID:     "user123",
+		TemplateID: "order_shipped",
+		Variables:  map[string]interface{}{"order": "A-1"},
+	}
+
+	t.Run("queued and readable on the status endpoint", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateType("order_shipped", "whatsapp").Start(t)
+
+		resp := h.POST("/api/v1/notification/whatsapp", send)
+		resp.AssertGolden("whatsapp_queued")
+
+		messages := h.Queue.WhatsApps()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "whatsapp", messages[0].Type)
+		assert.Equal(t, "order_shipped", messages[0].TemplateID)
+		assert.Equal(t, map[string]interface{}{"order": "A-1"}, messages[0].Variables)
+		assert.Empty(t, h.Queue.Emails())
+		assert.Empty(t, h.Queue.Pushes())
+
+		var status models.NotificationStatus
+		h.GET("/api/v1/notification/status/" + resp.NotificationID()).Decode(&status)
+		assert.Equal(t, "whatsapp", status.Type)
+		assert.Equal(t, "queued", status.Status)
+	})
+
+	t.Run("template of another type", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateType("order_shipped", "email").Start(t)
+
+		resp := h.POST("/api/v1/notification/whatsapp", send)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		api := resp.API()
+		assert.Equal(t, models.CodeValidationError, api.Code)
+		assert.Equal(t, "Invalid template type", api.Error)
+		assert.Empty(t, h.Queue.WhatsApps())
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplate(false).Start(t)
+
+		resp := h.POST("/api/v1/notification/whatsapp", send)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Equal(t, models.CodeTemplateNotFound, resp.API().Code)
+	})
+
+	t.Run("marketing opt-out", func(t *testing.T) {
+		h := handlertest.NewHarness().WithTemplateType("order_shipped", "whatsapp").Start(t)
+		h.Users.Preferences = models.Preferences{WhatsAppOptOut: true}
+
+		marketing := send
+		marketing.Category = "marketing"
+		resp := h.POST("/api/v1/notification/whatsapp", marketing)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		assert.Equal(t, models.CodeUserOptedOut, resp.API().Code)
+
+		// transactional sends ignore the opt-out
+		assert.Equal(t, http.StatusOK, h.POST("/api/v1/notification/whatsapp", send).Code)
+	})
+
+	t.Run("queue unavailable", func(t *testing.T) {
+		h := handlertest.NewHarness().
+			WithTemplateType("order_shipped", "whatsapp").
+			WithQueueError(errors.New("connection refused")).
+			Start(t)
+
+		resp := h.POST("/api/v1/notification/whatsapp", send)
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+		assert.Equal(t, models.CodeQueueUnavailable, resp.API().Code)
+	})
+}
+
+func TestResend_WhatsApp(t *testing.T) {
+	h := handlertest.NewHarness().Start(t)
+	h.Miniredis.Set("notification:status:wa-1",
+		`{"id":"wa-1","type":"whatsapp","status":"delivered","user_id":"user123","template_id":"order_shipped","created_by":"test-client"}`)
+
+	resp := h.POST("/api/v1/notification/wa-1/resend", nil)
+	require.Equal(t, http.StatusOK, resp.Code, string(resp.Body))
+	if messages := h.Queue.WhatsApps(); assert.Len(t, messages, 1) {
+		assert.Equal(t, "whatsapp", messages[0].Type)
+	}
+}
@@ -0,0 +1,141 @@
+package handlertest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/services"
+)
+
+// Queue records what the handlers publish. When Err is set every publish
+// fails with it and nothing is recorded.
+type Queue struct {
+	mu        sync.Mutex
+	Err       error
+	emails    []models.NotificationMessage
+	pushes    []models.NotificationMessage
+	whatsApps []models.NotificationMessage
+}
+
+func (q *Queue) PublishEmail(ctx context.Context, message interface{}) error {
+	return q.publish(&q.emails, message)
+}
+
+func (q *Queue) PublishPushNot(ctx context.Context, message interface{}) error {
+	return q.publish(&q.pushes, message)
+}
+
+func (q *Queue) PublishWhatsApp(ctx context.Context, message interface{}) error {
+	return q.publish(&q.whatsApps, message)
+}
+
+func (q *Queue) IsConnected() bool {
+	return true
+}
+
+func (q *Queue) publish(into *[]models.NotificationMessage, message interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.Err != nil {
+		return q.Err
+	}
+	msg, _ := message.(models.NotificationMessage)
+	*into = append(*into, msg)
+	return nil
+}
+
+// Emails returns the email messages published so far.
+func (q *Queue) Emails() []models.NotificationMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]models.NotificationMessage(nil), q.emails...)
+}
+
+// Pushes returns the push messages published so far.
+func (q *Queue) Pushes() []models.NotificationMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]models.NotificationMessage(nil), q.pushes...)
+}
+
+// WhatsApps returns the WhatsApp messages published so far.
+func (q *Queue) WhatsApps() []models.NotificationMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]models.NotificationMessage(nil), q.whatsApps...)
+}
+
+// Users answers every user lookup with Valid and Preferences. GetUser
+// returns User with Preferences, unless OmitPreferences is set, under the
+// ID asked for, inactive when the ID is in Inactive, and fails with Err
+// when it is set or with the ID's error in Errs. PreferenceLookups counts
+// the GetPreferences calls.
+type Users struct {
+	Valid             bool
+	Preferences       models.Preferences
+	OmitPreferences   bool
+	User              models.User
+	Inactive          map[string]bool
+	Err               error
+	Errs              map[string]error
+	PreferenceLookups atomic.Int64
+}
+
+func (u *Users) ValidateUser(ctx context.Context, userID string) (bool, error) {
+	return u.Valid, nil
+}
+
+func (u *Users) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	if u.Err != nil {
+		return nil, u.Err
+	}
+	if err := u.Errs[userID]; err != nil {
+		return nil, err
+	}
+	if !u.Valid {
+		return nil, services.ErrUserNotFound
+	}
+	user := u.User
+	user.ID, user.Active = userID, !u.Inactive[userID]
+	if !u.OmitPreferences {
+		prefs := u.Preferences
+		user.Preferences = &prefs
+	}
+	return &user, nil
+}
+
+func (u *Users) GetPreferences(ctx context.Context, userID string) (models.Preferences, error) {
+	u.PreferenceLookups.Add(1)
+	return u.Preferences, nil
+}
+
+// Templates answers every template lookup with Valid. Sources holds the
+// source of the templates that have one, all written in Syntax, and Types
+// the type of those that have one.
+type Templates struct {
+	Valid   bool
+	Sources map[string]string
+	Syntax  string
+	Types   map[string]string
+}
+
+func (t *Templates) ValidateTemplate(ctx context.Context, templateID string) (bool, error) {
+	return t.Valid, nil
+}
+
+func (t *Templates) TemplateSource(ctx context.Context, templateID string) (string, string, error) {
+	if !t.Valid {
+		return "", "", errors.New("template not found")
+	}
+	return t.Sources[templateID], t.Syntax, nil
+}
+
+func (t *Templates) TemplateMetadata(ctx context.Context, templateID string) (models.TemplateMetadata, error) {
+	if !t.Valid {
+		return models.TemplateMetadata{}, errors.New("template not found")
+	}
+	return models.TemplateMetadata{ID: templateID, Type: t.Types[templateID]}, nil
+}
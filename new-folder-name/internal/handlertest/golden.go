@@ -0,0 +1,108 @@
+package handlertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current responses")
+
+// A Normalizer replaces a JSON value that varies between runs with a stable
+// placeholder. key is the name of the field holding the value.
+type Normalizer func(key string, value interface{}) interface{}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Timestamps replaces RFC 3339 strings with "<timestamp>".
+func Timestamps(key string, value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return "<timestamp>"
+		}
+	}
+	return value
+}
+
+// IDs replaces UUIDs with "<id>".
+func IDs(key string, value interface{}) interface{} {
+	if s, ok := value.(string); ok && uuidPattern.MatchString(s) {
+		return "<id>"
+	}
+	return value
+}
+
+// Field replaces the value of every field named name with placeholder.
+func Field(name, placeholder string) Normalizer {
+	return func(key string, value interface{}) interface{} {
+		if key == name {
+			return placeholder
+		}
+		return value
+	}
+}
+
+// AssertGolden compares the response code and body with
+// testdata/golden/<name>.json. Timestamps and IDs are always normalized.
+// Run the tests with -update to rewrite the file.
+func (r *Response) AssertGolden(name string, normalizers ...Normalizer) {
+	r.t.Helper()
+	normalizers = append([]Normalizer{Timestamps, IDs}, normalizers...)
+
+	var body interface{}
+	if err := json.Unmarshal(r.Body, &body); err != nil {
+		r.t.Fatalf("response is not JSON: %v\n%s", err, r.Body)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]interface{}{
+		"code": r.Code,
+		"body": normalize("", body, normalizers),
+	}); err != nil {
+		r.t.Fatalf("encoding golden value: %v", err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		r.t.Errorf("response does not match %s (run with -update to accept it)\nwant:\n%s\ngot:\n%s", path, want, got)
+	}
+}
+
+func normalize(key string, value interface{}, normalizers []Normalizer) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = normalize(k, child, normalizers)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalize(key, child, normalizers)
+		}
+		return v
+	}
+	for _, n := range normalizers {
+		value = n(key, value)
+	}
+	return value
+}
@@ -0,0 +1,301 @@
+// Package handlertest assembles the notification handlers behind the same
+// routes and middleware as the server, with fake user, template and queue
+// services and an in-memory Redis, so endpoint tests only state what
+// differs:
+//
+//	h := handlertest.NewHarness().WithUser(false).Start(t)
+//	resp := h.POST("/api/v1/notification/email", models.SendEmailRequest{UserID: "u", TemplateID: "t"})
+//	resp.AssertGolden("email_invalid_user")
+package handlertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/internal/jsoncase"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/franzego/stage04/pkg/idgen"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultCaller is the subject of the token the harness sends unless
+// WithClaims says otherwise.
+const DefaultCaller = "test-client"
+
+// JWTSecret is the auth.jwt_secret the harness's auth middleware checks
+// tokens against.
+const JWTSecret = "handlertest-secret"
+
+// Harness is built with NewHarness and the With methods, then started.
+type Harness struct {
+	t      testing.TB
+	cfg    config.NotificationsConfig
+	claims jwt.MapClaims
+	header http.Header
+	// timeout is the deadline given to every request, as server.timeout
+	// gives the sends.
+	timeout time.Duration
+	clock   clock.Clock
+	ids     idgen.Generator
+	// keyPrefix is the handler's redis.key_prefix.
+	keyPrefix string
+
+	Queue     *Queue
+	Users     *Users
+	Templates *Templates
+	Miniredis *miniredis.Miniredis
+	Redis     *redis.Client
+	Handler   *handlers.NotificationHandler
+	Router    *gin.Engine
+}
+
+// NewHarness returns a harness where users and templates are valid and
+// publishing succeeds.
+func NewHarness() *Harness {
+	return &Harness{
+		claims:    jwt.MapClaims{"sub": DefaultCaller},
+		header:    http.Header{},
+		clock:     clock.System,
+		ids:       idgen.UUID,
+		Queue:     &Queue{},
+		Users:     &Users{Valid: true},
+		Templates: &Templates{Valid: true},
+	}
+}
+
+// WithUser sets whether the user service accepts every user.
+func (h *Harness) WithUser(valid bool) *Harness {
+	h.Users.Valid = valid
+	return h
+}
+
+// WithTemplate sets whether the template service accepts every template.
+func (h *Harness) WithTemplate(valid bool) *Harness {
+	h.Templates.Valid = valid
+	return h
+}
+
+// WithTemplateSource gives a template its source.
+func (h *Harness) WithTemplateSource(templateID, source string) *Harness {
+	if h.Templates.Sources == nil {
+		h.Templates.Sources = map[string]string{}
+	}
+	h.Templates.Sources[templateID] = source
+	return h
+}
+
+// WithTemplateType gives a template its type.
+func (h *Harness) WithTemplateType(templateID, templateType string) *Harness {
+	if h.Templates.Types == nil {
+		h.Templates.Types = map[string]string{}
+	}
+	h.Templates.Types[templateID] = templateType
+	return h
+}
+
+// WithQueueError makes every publish fail with err.
+func (h *Harness) WithQueueError(err error) *Harness {
+	h.Queue.Err = err
+	return h
+}
+
+// WithConfig sets the notifications config given to the handler.
+func (h *Harness) WithConfig(cfg config.NotificationsConfig) *Harness {
+	h.cfg = cfg
+	return h
+}
+
+// WithClaims sets the claims of the token sent with every request.
+func (h *Harness) WithClaims(claims jwt.MapClaims) *Harness {
+	h.claims = claims
+	return h
+}
+
+// WithTimeout gives every request a deadline timeout from when it is
+// served.
+func (h *Harness) WithTimeout(timeout time.Duration) *Harness {
+	h.timeout = timeout
+	return h
+}
+
+// WithClock gives the handler c for the wall clock, so statuses and
+// messages are stamped with times the test knows.
+func (h *Harness) WithClock(c clock.Clock) *Harness {
+	h.clock = c
+	return h
+}
+
+// WithIDs makes the handler and middleware draw every ID they generate,
+// request, correlation and notification IDs alike, from ids.
+func (h *Harness) WithIDs(ids idgen.Generator) *Harness {
+	h.ids = ids
+	return h
+}
+
+// WithMiniredis runs the handler against server instead of a Redis of its
+// own, for tests of handlers sharing one.
+func (h *Harness) WithMiniredis(server *miniredis.Miniredis) *Harness {
+	h.Miniredis = server
+	return h
+}
+
+// WithKeyPrefix puts the handler's keys behind prefix, as redis.key_prefix
+// does.
+func (h *Harness) WithKeyPrefix(prefix string) *Harness {
+	h.keyPrefix = prefix
+	return h
+}
+
+// WithHeader adds a header to every request.
+func (h *Harness) WithHeader(key, value string) *Harness {
+	h.header.Add(key, value)
+	return h
+}
+
+// Start builds the handler and router. Redis is torn down with the test.
+func (h *Harness) Start(t testing.TB) *Harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	h.t = t
+	if h.Miniredis == nil {
+		h.Miniredis = miniredis.RunT(t)
+	}
+	h.Redis = redis.NewClient(&redis.Options{Addr: h.Miniredis.Addr()})
+	t.Cleanup(func() { h.Redis.Close() })
+
+	h.Handler = handlers.NewNotificationService(h.Queue, h.Redis, h.Users, h.Templates, h.cfg)
+	h.Handler.SetClock(h.clock)
+	h.Handler.SetIDGenerator(h.ids)
+	h.Handler.SetKeyPrefix(h.keyPrefix)
+	h.Router = gin.New()
+	h.Router.Use(middleware.RequestID(h.ids), middleware.Recovery(), middleware.CorrelationID(h.ids), middleware.RequestTimeout(h.timeout))
+	tenant := middleware.TenantMiddleware(h.cfg.DefaultTenant, false)
+	defaultCase, ok := jsoncase.Parse(h.cfg.JSONCase.Default)
+	if !ok {
+		defaultCase = jsoncase.Snake
+	}
+	jsonCase := middleware.JSONCase(defaultCase, h.cfg.JSONCase.CamelClients, h.cfg.JSONCase.CamelTenants)
+
+	api := h.Router.Group("/api/v1")
+	api.Use(middleware.AuthMiddleware(JWTSecret), tenant, jsonCase)
+	storageGate := h.Handler.StorageGate()
+	api.POST("/notification/email", storageGate, h.Handler.SendEmail)
+	api.POST("/notification/push", storageGate, h.Handler.SendPush)
+	api.POST("/notification/whatsapp", storageGate, h.Handler.SendWhatsApp)
+	api.POST("/notification/push/topic", storageGate, h.Handler.SendTopicPush)
+	api.POST("/notification/multi", storageGate, h.Handler.SendMulti)
+	api.GET("/notification/group/:group_id", h.Handler.GetGroup)
+	api.GET("/notification/user/:user_id/summary", h.Handler.GetUserSummary)
+	api.GET("/templates/:id/variables", h.Handler.GetTemplateVariables)
+	api.GET("/notification/status/:id", h.Handler.GetStatus)
+	api.HEAD("/notification/status/:id", h.Handler.HeadStatus)
+	api.GET("/notification/status/:id/stream", h.Handler.StreamStatus)
+	api.PATCH("/notification/:id", h.Handler.PatchNotification)
+	api.POST("/notification/:id/resend", storageGate, h.Handler.Resend)
+	api.POST("/notification/:id/snooze", h.Handler.Snooze)
+
+	admin := h.Router.Group("/api/v1/admin")
+	admin.Use(middleware.AdminMiddleware(JWTSecret), tenant, jsonCase)
+	admin.GET("/cache/stats", h.Handler.GetCacheStats)
+	admin.GET("/history/clock-skew", h.Handler.GetClockSkew)
+	admin.GET("/reports/duplicates", h.Handler.GetDuplicateReport)
+	admin.GET("/privacy/inventory", h.Handler.GetDataInventory)
+	admin.DELETE("/notification/:id", h.Handler.PurgeNotification)
+	admin.GET("/notifications", h.Handler.ListNotifications)
+	admin.GET("/approvals", h.Handler.ListApprovals)
+	admin.POST("/approvals/:id/approve", h.Handler.ApproveNotification)
+	admin.POST("/approvals/:id/reject", h.Handler.RejectNotification)
+
+	internal := h.Router.Group("/api/v1/internal")
+	internal.Use(middleware.ScopeMiddleware(JWTSecret, middleware.IngestScope), tenant, jsonCase)
+	internal.PUT("/send-time/:user_id", h.Handler.IngestSendTimeProfile)
+	return h
+}
+
+// Token signs claims the way the auth middleware expects.
+func Token(claims jwt.MapClaims) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(JWTSecret))
+	return "Bearer " + signed
+}
+
+// Do sends a request with the harness token. A non-nil body is sent as
+// JSON.
+func (h *Harness) Do(method, path string, body interface{}) *Response {
+	h.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			h.t.Fatalf("encoding request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", Token(h.claims))
+	for key, values := range h.header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	h.Router.ServeHTTP(w, req)
+	return &Response{t: h.t, Code: w.Code, Body: w.Body.Bytes(), Header: w.Header()}
+}
+
+func (h *Harness) GET(path string) *Response {
+	h.t.Helper()
+	return h.Do(http.MethodGet, path, nil)
+}
+
+func (h *Harness) POST(path string, body interface{}) *Response {
+	h.t.Helper()
+	return h.Do(http.MethodPost, path, body)
+}
+
+// Response is a recorded handler response.
+type Response struct {
+	t      testing.TB
+	Code   int
+	Body   []byte
+	Header http.Header
+}
+
+// API decodes the standard response envelope.
+func (r *Response) API() models.APIResponse {
+	r.t.Helper()
+	var resp models.APIResponse
+	if err := json.Unmarshal(r.Body, &resp); err != nil {
+		r.t.Fatalf("decoding response %q: %v", r.Body, err)
+	}
+	return resp
+}
+
+// Decode unmarshals the envelope's data into v.
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(r.Body, &resp); err != nil {
+		r.t.Fatalf("decoding response %q: %v", r.Body, err)
+	}
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		r.t.Fatalf("decoding response data %q: %v", resp.Data, err)
+	}
+}
+
+// NotificationID returns data.notification_id from a send response.
+func (r *Response) NotificationID() string {
+	r.t.Helper()
+	var data models.NotificationResponse
+	r.Decode(&data)
+	return data.NotificationID
+}
@@ -0,0 +1,180 @@
+// Package jsoncase rewrites the keys of JSON documents between snake_case,
+// the case the models are tagged in, and camelCase, for clients that want
+// it. Keys are rewritten as the document streams through, so field order is
+// kept; the values of Opaque fields are caller data and pass through as
+// they are.
+package jsoncase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Case is a key naming convention.
+type Case string
+
+const (
+	Snake Case = "snake"
+	Camel Case = "camel"
+)
+
+// Parse returns the case named s, ignoring letter case, and whether s names
+// one.
+func Parse(s string) (Case, bool) {
+	switch Case(strings.ToLower(strings.TrimSpace(s))) {
+	case Snake:
+		return Snake, true
+	case Camel:
+		return Camel, true
+	}
+	return "", false
+}
+
+// Opaque lists, by snake_case name, the fields whose values are maps keyed
+// by caller data or by status and channel names. Their keys are never
+// rewritten, at any depth.
+var Opaque = map[string]bool{
+	"variables":  true,
+	"metadata":   true,
+	"counts":     true,
+	"by_status":  true,
+	"by_channel": true,
+}
+
+// Key returns name in case to.
+func Key(name string, to Case) string {
+	if to == Camel {
+		return toCamel(name)
+	}
+	return toSnake(name)
+}
+
+func toCamel(name string) string {
+	if !strings.Contains(strings.Trim(name, "_"), "_") {
+		return name
+	}
+	var b strings.Builder
+	upper := false
+	for i, r := range name {
+		if r == '_' && i > 0 {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func toSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// a word starts at an upper case letter after a lower case one or
+			// a digit, and at the last capital of an initialism: userID,
+			// HTTPStatus
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Transform returns the JSON document data with every object key in case
+// to, except within Opaque fields.
+func Transform(data []byte, to Case) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := transformValue(dec, &buf, to); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("jsoncase: data after the top-level value")
+	}
+	return buf.Bytes(), nil
+}
+
+func transformValue(dec *json.Decoder, buf *bytes.Buffer, to Case) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		buf.WriteByte('{')
+		for first := true; dec.More(); first = false {
+			if !first {
+				buf.WriteByte(',')
+			}
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, ok := token.(string)
+			if !ok {
+				return fmt.Errorf("jsoncase: object key %v is not a string", token)
+			}
+			if err := writeScalar(buf, Key(key, to)); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if Opaque[toSnake(key)] {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				if err := json.Compact(buf, raw); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := transformValue(dec, buf, to); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	case json.Delim('['):
+		buf.WriteByte('[')
+		for first := true; dec.More(); first = false {
+			if !first {
+				buf.WriteByte(',')
+			}
+			if err := transformValue(dec, buf, to); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte(']')
+	default:
+		return writeScalar(buf, token)
+	}
+	return nil
+}
+
+func writeScalar(buf *bytes.Buffer, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(encoded)
+	return nil
+}
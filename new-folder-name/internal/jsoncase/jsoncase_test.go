@@ -0,0 +1,108 @@
+package jsoncase
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		snake, camel string
+	}{
+		{"id", "id"},
+		{"user_id", "userId"},
+		{"notification_id", "notificationId"},
+		{"last_attempt_at", "lastAttemptAt"},
+		{"expires_in_seconds", "expiresInSeconds"},
+		{"_private", "_private"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.camel, Key(tt.snake, Camel), tt.snake)
+		assert.Equal(t, tt.snake, Key(tt.camel, Snake), tt.camel)
+		assert.Equal(t, tt.snake, Key(tt.snake, Snake), "snake_case keys are left alone")
+	}
+	assert.Equal(t, "notification_id", Key("notificationID", Snake))
+	assert.Equal(t, "http_status", Key("HTTPStatus", Snake))
+}
+
+func TestParse(t *testing.T) {
+	c, ok := Parse(" Camel ")
+	assert.True(t, ok)
+	assert.Equal(t, Camel, c)
+	_, ok = Parse("kebab")
+	assert.False(t, ok)
+}
+
+func roundTrip(t *testing.T, v interface{}) (camel map[string]interface{}) {
+	t.Helper()
+	snake, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	camelJSON, err := Transform(snake, Camel)
+	require.NoError(t, err)
+	back, err := Transform(camelJSON, Snake)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(snake), string(back), "camel and back is the identity")
+
+	require.NoError(t, json.Unmarshal(camelJSON, &camel))
+	return camel
+}
+
+func TestTransform_StatusResponse(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	status := models.NotificationStatus{
+		ID:            "n-1",
+		UserID:        "user123",
+		Type:          "email",
+		Status:        "queued",
+		LastAttemptAt: &at,
+		Overrides:     &models.Overrides{RecipientEmail: "a@example.com"},
+		Variables: map[string]interface{}{
+			"first_name": "Ada",
+			"order":      map[string]interface{}{"line_items": []interface{}{map[string]interface{}{"unit_price": 1.5}}},
+		},
+		Metadata: map[string]string{"invoice_id": "inv-1"},
+	}
+	camel := roundTrip(t, models.APIResponse{Success: true, Data: status, RequestID: "req-1"})
+
+	assert.Equal(t, "req-1", camel["requestId"])
+	data := camel["data"].(map[string]interface{})
+	assert.Equal(t, "user123", data["userId"])
+	assert.Contains(t, data, "lastAttemptAt")
+	assert.NotContains(t, data, "user_id")
+	assert.Equal(t, "a@example.com", data["overrides"].(map[string]interface{})["recipientEmail"])
+
+	variables := data["variables"].(map[string]interface{})
+	assert.Equal(t, "Ada", variables["first_name"], "variables are caller data")
+	item := variables["order"].(map[string]interface{})["line_items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, 1.5, item["unit_price"], "at any depth")
+	assert.Equal(t, map[string]interface{}{"invoice_id": "inv-1"}, data["metadata"])
+}
+
+func TestTransform_CountsKeepStatusNames(t *testing.T) {
+	camel := roundTrip(t, models.UserNotificationSummary{
+		UserID:    "user123",
+		ByStatus:  map[string]int{"pending_approval": 1},
+		ByChannel: map[string]int{"push_topic": 2},
+	})
+	assert.Equal(t, map[string]interface{}{"pending_approval": float64(1)}, camel["byStatus"])
+	assert.Equal(t, map[string]interface{}{"push_topic": float64(2)}, camel["byChannel"])
+}
+
+func TestTransform_KeepsOrderAndNumbers(t *testing.T) {
+	out, err := Transform([]byte(`{"z_key": 12345678901234567890, "a_key": [1, {"b_c": null}], "m": "x_y"}`), Camel)
+	require.NoError(t, err)
+	assert.Equal(t, `{"zKey":12345678901234567890,"aKey":[1,{"bC":null}],"m":"x_y"}`, string(out))
+}
+
+func TestTransform_Invalid(t *testing.T) {
+	for _, data := range []string{`{"a":`, `{"a":1}{}`, ``} {
+		_, err := Transform([]byte(data), Camel)
+		assert.Error(t, err, data)
+	}
+}
@@ -0,0 +1,186 @@
+// Package manifest pre-warms the templates a deployment depends on. The
+// manifest lists them; at startup each is fetched into the template
+// client's cache, and the ones the template service doesn't have are
+// reported rather than discovered by the first send using them.
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/spf13/viper"
+)
+
+// Entry is a template the deployment depends on. A critical one missing
+// can fail readiness.
+type Entry struct {
+	ID       string `mapstructure:"id"`
+	Critical bool   `mapstructure:"critical"`
+}
+
+// Manifest is the list of templates, read from YAML or JSON:
+//
+//	templates:
+//	  - id: welcome-email
+//	    critical: true
+//	  - id: weekly-digest
+type Manifest struct {
+	Templates []Entry `mapstructure:"templates"`
+}
+
+// Load reads the manifest at path, its format taken from the extension.
+func Load(path string) (Manifest, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return Manifest{}, fmt.Errorf("reading template manifest: %w", err)
+	}
+	var m Manifest
+	if err := v.Unmarshal(&m); err != nil {
+		return Manifest{}, fmt.Errorf("parsing template manifest %s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return Manifest{}, fmt.Errorf("template manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m Manifest) validate() error {
+	seen := make(map[string]bool, len(m.Templates))
+	for i, entry := range m.Templates {
+		if entry.ID == "" {
+			return fmt.Errorf("templates[%d] has no id", i)
+		}
+		if seen[entry.ID] {
+			return fmt.Errorf("template %q is listed twice", entry.ID)
+		}
+		seen[entry.ID] = true
+	}
+	return nil
+}
+
+// Fetcher fetches a template into the cache. The template client
+// implements it.
+type Fetcher interface {
+	PrefetchTemplate(ctx context.Context, templateID string) error
+}
+
+// TemplateStatus is whether one template of the manifest was fetched, and
+// why not.
+type TemplateStatus struct {
+	ID        string `json:"id"`
+	Critical  bool   `json:"critical"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the outcome of the last warm-up.
+type Report struct {
+	CheckedAt       time.Time        `json:"checked_at"`
+	Total           int              `json:"total"`
+	Available       int              `json:"available"`
+	Missing         []string         `json:"missing"`
+	MissingCritical []string         `json:"missing_critical"`
+	Templates       []TemplateStatus `json:"templates"`
+}
+
+// Status tracks which templates of a manifest are available.
+type Status struct {
+	manifest Manifest
+	fetcher  Fetcher
+	clock    clock.Clock
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	templates map[string]TemplateStatus
+}
+
+func NewStatus(m Manifest, fetcher Fetcher) *Status {
+	return &Status{manifest: m, fetcher: fetcher, clock: clock.System, templates: map[string]TemplateStatus{}}
+}
+
+// Warm fetches every template of the manifest and returns the report. The
+// error joins those of the templates that couldn't be fetched.
+func (s *Status) Warm(ctx context.Context) (Report, error) {
+	return s.fetch(ctx, func(TemplateStatus, bool) bool { return true })
+}
+
+// Refresh fetches again only the templates that were missing, so a
+// template published after startup is picked up without refetching the
+// rest.
+func (s *Status) Refresh(ctx context.Context) (Report, error) {
+	return s.fetch(ctx, func(status TemplateStatus, checked bool) bool { return !checked || !status.Available })
+}
+
+func (s *Status) fetch(ctx context.Context, due func(TemplateStatus, bool) bool) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, entry := range s.manifest.Templates {
+		status, checked := s.templates[entry.ID]
+		if !due(status, checked) {
+			continue
+		}
+		status = TemplateStatus{ID: entry.ID, Critical: entry.Critical, Available: true}
+		if err := s.fetcher.PrefetchTemplate(ctx, entry.ID); err != nil {
+			status.Available, status.Error = false, err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", entry.ID, err))
+		}
+		s.templates[entry.ID] = status
+	}
+	s.checkedAt = s.clock.Now()
+	return s.report(), errors.Join(errs...)
+}
+
+// Report returns the outcome of the last warm-up or refresh without
+// fetching anything.
+func (s *Status) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.report()
+}
+
+func (s *Status) report() Report {
+	report := Report{
+		CheckedAt:       s.checkedAt,
+		Total:           len(s.manifest.Templates),
+		Missing:         []string{},
+		MissingCritical: []string{},
+		Templates:       make([]TemplateStatus, 0, len(s.manifest.Templates)),
+	}
+	for _, entry := range s.manifest.Templates {
+		status, ok := s.templates[entry.ID]
+		if !ok {
+			status = TemplateStatus{ID: entry.ID, Critical: entry.Critical, Error: "not checked yet"}
+		}
+		report.Templates = append(report.Templates, status)
+		if status.Available {
+			report.Available++
+			continue
+		}
+		report.Missing = append(report.Missing, entry.ID)
+		if entry.Critical {
+			report.MissingCritical = append(report.MissingCritical, entry.ID)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.MissingCritical)
+	return report
+}
+
+// Summary is the one-line startup summary of the report.
+func (r Report) Summary() string {
+	summary := fmt.Sprintf("%d/%d templates available", r.Available, r.Total)
+	if len(r.Missing) > 0 {
+		summary += fmt.Sprintf("; missing %v", r.Missing)
+	}
+	if len(r.MissingCritical) > 0 {
+		summary += fmt.Sprintf(" (critical: %v)", r.MissingCritical)
+	}
+	return summary
+}
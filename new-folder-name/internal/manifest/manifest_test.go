@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeManifest(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	want := Manifest{Templates: []Entry{{ID: "welcome", Critical: true}, {ID: "digest"}}}
+
+	m, err := Load(writeManifest(t, "templates.yaml", `
+templates:
+  - id: welcome
+    critical: true
+  - id: digest
+`))
+	require.NoError(t, err)
+	assert.Equal(t, want, m)
+
+	m, err = Load(writeManifest(t, "templates.json",
+		`{"templates": [{"id": "welcome", "critical": true}, {"id": "digest"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, want, m)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"no id", "m.yaml", "templates:\n  - critical: true\n", "templates[0] has no id"},
+		{"duplicate", "m.yaml", "templates:\n  - id: a\n  - id: a\n", `template "a" is listed twice`},
+		{"malformed", "m.json", `{"templates": [`, "reading template manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeManifest(t, tt.file, tt.content))
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+// templates is a template service holding the listed templates.
+type templates struct {
+	have    map[string]bool
+	fetched []string
+}
+
+func (f *templates) PrefetchTemplate(ctx context.Context, templateID string) error {
+	f.fetched = append(f.fetched, templateID)
+	if !f.have[templateID] {
+		return errors.New("template not found")
+	}
+	return nil
+}
+
+func TestStatus_WarmAndRefresh(t *testing.T) {
+	service := &templates{have: map[string]bool{"welcome": true}}
+	status := NewStatus(Manifest{Templates: []Entry{
+		{ID: "welcome", Critical: true},
+		{ID: "reset", Critical: true},
+		{ID: "digest"},
+	}}, service)
+
+	report, err := status.Warm(context.Background())
+	assert.ErrorContains(t, err, "reset: template not found")
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 1, report.Available)
+	assert.Equal(t, []string{"digest", "reset"}, report.Missing)
+	assert.Equal(t, []string{"reset"}, report.MissingCritical)
+	assert.Equal(t, "1/3 templates available; missing [digest reset] (critical: [reset])", report.Summary())
+
+	service.have["reset"] = true
+	service.fetched = nil
+	report, err = status.Refresh(context.Background())
+	assert.ErrorContains(t, err, "digest")
+	assert.Equal(t, []string{"reset", "digest"}, service.fetched, "available templates aren't fetched again")
+	assert.Empty(t, report.MissingCritical)
+	assert.Equal(t, report, status.Report())
+}
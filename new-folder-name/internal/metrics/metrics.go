@@ -0,0 +1,195 @@
+// Package metrics exposes the gateway's Prometheus metrics: HTTP request
+// duration, queue publish duration and the latency from queueing a
+// notification to delivering it.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ErrTooManyBuckets is returned for a bucket list over MetricsConfig.MaxBuckets.
+var ErrTooManyBuckets = errors.New("too many histogram buckets")
+
+// The default buckets are finer than Prometheus's below 50ms, where most
+// requests and publishes land, and stop before the slow tail.
+var (
+	DefaultRequestDurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.02, 0.03, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+	DefaultPublishDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}
+	DefaultDeliveryLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+)
+
+// nativeMinResetDuration stops a native histogram that hit its bucket limit
+// from being reset more often than this.
+const nativeMinResetDuration = time.Hour
+
+// Metrics holds the gateway's collectors on a registry of its own.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requestDuration *prometheus.HistogramVec
+	publishDuration *prometheus.HistogramVec
+	deliveryLatency *prometheus.HistogramVec
+	publishRetries  *prometheus.CounterVec
+	returned        *prometheus.CounterVec
+	legacy          *prometheus.CounterVec
+	duplicates      *prometheus.CounterVec
+	// clock times the requests.
+	clock clock.Clock
+}
+
+// New builds the collectors from cfg. It fails if a family's buckets are
+// not strictly increasing or number more than cfg.MaxBuckets.
+func New(cfg config.MetricsConfig) (*Metrics, error) {
+	if cfg.NativeHistograms && cfg.NativeBucketFactor <= 1 {
+		return nil, fmt.Errorf("native_bucket_factor must be greater than 1, got %g", cfg.NativeBucketFactor)
+	}
+	m := &Metrics{registry: prometheus.NewRegistry(), clock: clock.System}
+	var err error
+	if m.requestDuration, err = histogram(cfg, "http_request_duration_seconds",
+		"Time taken to serve HTTP requests.",
+		cfg.RequestDurationBuckets, DefaultRequestDurationBuckets, "method", "route", "status"); err != nil {
+		return nil, err
+	}
+	if m.publishDuration, err = histogram(cfg, "queue_publish_duration_seconds",
+		"Time taken to publish a message to the broker.",
+		cfg.PublishDurationBuckets, DefaultPublishDurationBuckets, "routing_key", "result"); err != nil {
+		return nil, err
+	}
+	if m.deliveryLatency, err = histogram(cfg, "delivery_latency_seconds",
+		"Time from a notification being queued to it being delivered.",
+		cfg.DeliveryLatencyBuckets, DefaultDeliveryLatencyBuckets, "channel"); err != nil {
+		return nil, err
+	}
+	m.publishRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notifications",
+		Name:      "queue_publish_retries_total",
+		Help:      "Publishes repeated after failing on the broker connection or channel.",
+	}, []string{"routing_key"})
+	m.returned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notifications",
+		Name:      "queue_returned_total",
+		Help:      "Messages published with the mandatory flag that the broker returned as unroutable.",
+	}, []string{"routing_key"})
+	m.legacy = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notifications",
+		Name:      "queue_legacy_messages_total",
+		Help:      "Messages consumed in the old gateway's shape, without a schema version.",
+	}, []string{"queue"})
+	m.duplicates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notifications",
+		Name:      "duplicate_delivery_detected_total",
+		Help:      "Deliveries that repeated content already delivered to the same recipient within the duplicate window.",
+	}, []string{"channel"})
+	m.registry.MustRegister(m.requestDuration, m.publishDuration, m.deliveryLatency, m.publishRetries, m.returned, m.legacy, m.duplicates)
+	return m, nil
+}
+
+func histogram(cfg config.MetricsConfig, name, help string, configured, defaults []float64, labels ...string) (*prometheus.HistogramVec, error) {
+	buckets := configured
+	if len(buckets) == 0 {
+		buckets = defaults
+	}
+	if err := validateBuckets(name, buckets, cfg.MaxBuckets); err != nil {
+		return nil, err
+	}
+	opts := prometheus.HistogramOpts{
+		Namespace: "notifications",
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}
+	if cfg.NativeHistograms {
+		opts.NativeHistogramBucketFactor = cfg.NativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = cfg.NativeMaxBuckets
+		opts.NativeHistogramMinResetDuration = nativeMinResetDuration
+	}
+	return prometheus.NewHistogramVec(opts, labels), nil
+}
+
+func validateBuckets(name string, buckets []float64, max int) error {
+	if max > 0 && len(buckets) > max {
+		return fmt.Errorf("%w: %s has %d, the limit is %d", ErrTooManyBuckets, name, len(buckets), max)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("%s buckets must be strictly increasing, got %g after %g", name, buckets[i], buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// Registerer is the registry Handler serves, for collectors kept by other
+// packages, like the queue client's. A nil *Metrics has none.
+func (m *Metrics) Registerer() prometheus.Registerer {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// Handler serves the metrics. Scrapers that ask for the protobuf format
+// get native histograms when they are enabled.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware times every request. Requests that matched no route share one
+// label value so unknown paths can't add series.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := m.clock.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(m.clock.Now().Sub(start).Seconds())
+	}
+}
+
+// ObservePublish records one publish to routingKey.
+func (m *Metrics) ObservePublish(routingKey string, elapsed time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.publishDuration.WithLabelValues(routingKey, result).Observe(elapsed.Seconds())
+}
+
+// ObservePublishRetry counts one publish to routingKey being tried again.
+func (m *Metrics) ObservePublishRetry(routingKey string) {
+	m.publishRetries.WithLabelValues(routingKey).Inc()
+}
+
+// ObserveReturn counts one message published to routingKey coming back
+// unroutable.
+func (m *Metrics) ObserveReturn(routingKey string) {
+	m.returned.WithLabelValues(routingKey).Inc()
+}
+
+// ObserveLegacyMessage counts one message without a schema version
+// consumed from queueName.
+func (m *Metrics) ObserveLegacyMessage(queueName string) {
+	m.legacy.WithLabelValues(queueName).Inc()
+}
+
+// ObserveDuplicateDelivery counts one duplicate delivery on channel.
+func (m *Metrics) ObserveDuplicateDelivery(channel string) {
+	m.duplicates.WithLabelValues(channel).Inc()
+}
+
+// ObserveDelivery records how long a notification on channel took from
+// being queued to being delivered.
+func (m *Metrics) ObserveDelivery(channel string, latency time.Duration) {
+	m.deliveryLatency.WithLabelValues(channel).Observe(latency.Seconds())
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/gin-gonic/gin"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestConfiguredBucketsAreExposed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, err := New(config.MetricsConfig{
+		MaxBuckets:             20,
+		RequestDurationBuckets: []float64{0.005, 0.015, 0.04},
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere/123", nil))
+	m.ObservePublish("email.queue", 3*time.Millisecond, nil)
+	m.ObserveDelivery("email", 2*time.Second)
+	m.ObservePublishRetry("email.queue")
+	m.ObserveReturn("push.queue")
+	m.ObserveLegacyMessage("email.queue")
+	m.ObserveDuplicateDelivery("email")
+
+	body := scrape(t, m)
+	for _, le := range []string{"0.005", "0.015", "0.04", "+Inf"} {
+		assert.Contains(t, body, `notifications_http_request_duration_seconds_bucket{method="GET",route="/ping",status="204",le="`+le+`"}`)
+	}
+	assert.NotContains(t, body, `route="/ping",status="204",le="0.001"`, "configured buckets replace the defaults")
+	assert.Contains(t, body, `route="unmatched"`)
+	assert.NotContains(t, body, "/nowhere/123")
+
+	// families left unconfigured keep their defaults
+	assert.Contains(t, body, `notifications_queue_publish_duration_seconds_bucket{result="ok",routing_key="email.queue",le="0.0005"} 0`)
+	assert.Contains(t, body, `notifications_queue_publish_retries_total{routing_key="email.queue"} 1`)
+	assert.Contains(t, body, `notifications_queue_returned_total{routing_key="push.queue"} 1`)
+	assert.Contains(t, body, `notifications_queue_legacy_messages_total{queue="email.queue"} 1`)
+	assert.Contains(t, body, `notifications_duplicate_delivery_detected_total{channel="email"} 1`)
+	assert.Contains(t, body, `notifications_delivery_latency_seconds_bucket{channel="email",le="2.5"} 1`)
+}
+
+func TestNativeHistograms(t *testing.T) {
+	m, err := New(config.MetricsConfig{
+		MaxBuckets:             20,
+		PublishDurationBuckets: []float64{0.001, 0.01},
+		NativeHistograms:       true,
+		NativeBucketFactor:     1.1,
+		NativeMaxBuckets:       160,
+	})
+	require.NoError(t, err)
+	m.ObservePublish("push.queue", 4*time.Millisecond, errors.New("channel closed"))
+
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+	var histogram *dto.Histogram
+	for _, family := range families {
+		if family.GetName() == "notifications_queue_publish_duration_seconds" {
+			histogram = family.GetMetric()[0].GetHistogram()
+		}
+	}
+	require.NotNil(t, histogram)
+	assert.NotNil(t, histogram.Schema, "native schema is set")
+	assert.NotEmpty(t, histogram.GetPositiveSpan())
+	// the classic buckets are still there for scrapers without native support
+	assert.Len(t, histogram.GetBucket(), 2)
+}
+
+func TestBucketGuard(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.MetricsConfig
+		is   error
+	}{
+		{
+			"more buckets than allowed",
+			config.MetricsConfig{MaxBuckets: 3, DeliveryLatencyBuckets: []float64{1, 2, 3, 4}},
+			ErrTooManyBuckets,
+		},
+		{
+			"defaults over a lower limit",
+			config.MetricsConfig{MaxBuckets: 5},
+			ErrTooManyBuckets,
+		},
+		{"not increasing", config.MetricsConfig{MaxBuckets: 20, PublishDurationBuckets: []float64{0.01, 0.005}}, nil},
+		{"native factor of one", config.MetricsConfig{MaxBuckets: 20, NativeHistograms: true, NativeBucketFactor: 1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			require.Error(t, err)
+			if tt.is != nil {
+				assert.ErrorIs(t, err, tt.is)
+			}
+		})
+	}
+
+	_, err := New(config.MetricsConfig{MaxBuckets: 20})
+	assert.NoError(t, err, "the defaults fit the default limit")
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/franzego/stage04/internal/jsoncase"
+	"github.com/gin-gonic/gin"
+)
+
+// JSONCaseHeader lets a client pick the key case of the JSON it gets back:
+// "camel" or "snake".
+const JSONCaseHeader = "X-JSON-Case"
+
+const jsonCaseKey = "json_case"
+
+// JSONCase resolves the key case of the caller's responses: the one named
+// in X-JSON-Case, else camelCase for camelClients, by client name or token
+// subject, and camelTenants, else defaultCase. It also rewrites the keys of
+// JSON request bodies to snake_case, so requests bind in either case. It
+// must run after the authentication and tenant middlewares.
+func JSONCase(defaultCase jsoncase.Case, camelClients, camelTenants []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		responseCase, ok := jsoncase.Parse(c.GetHeader(JSONCaseHeader))
+		switch {
+		case ok:
+		case slices.Contains(camelClients, CallerID(c)), slices.Contains(camelTenants, CallerTenant(c)):
+			responseCase = jsoncase.Camel
+		default:
+			responseCase = defaultCase
+		}
+		c.Set(jsonCaseKey, responseCase)
+
+		if isJSON(c.Request) && c.Request.Body != nil {
+			body, err := io.ReadAll(c.Request.Body)
+			c.Request.Body.Close()
+			if err != nil {
+				body = nil
+			}
+			// a body that doesn't parse is left for binding to reject
+			if snake, err := jsoncase.Transform(body, jsoncase.Snake); err == nil {
+				body = snake
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+		}
+		c.Next()
+	}
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// ResponseCase returns the key case the caller's JSON is written in. Before
+// the JSONCase middleware has run, only X-JSON-Case is honoured.
+func ResponseCase(c *gin.Context) jsoncase.Case {
+	if responseCase, ok := c.Get(jsonCaseKey); ok {
+		return responseCase.(jsoncase.Case)
+	}
+	if responseCase, ok := jsoncase.Parse(c.GetHeader(JSONCaseHeader)); ok {
+		return responseCase
+	}
+	return jsoncase.Snake
+}
+
+// encodeJSON marshals v with its keys in the caller's case.
+func encodeJSON(c *gin.Context, v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil || ResponseCase(c) == jsoncase.Snake {
+		return body, err
+	}
+	return jsoncase.Transform(body, ResponseCase(c))
+}
+
+// writeJSON writes v as a JSON body of contentType in the caller's case.
+func writeJSON(c *gin.Context, status int, contentType string, v interface{}) {
+	body, err := encodeJSON(c, v)
+	if err != nil {
+		log.Printf("failed to encode response: %v", err)
+		c.JSON(status, v)
+		return
+	}
+	c.Data(status, contentType, body)
+}
+
+// WriteEvent sends a server-sent event whose data is v as JSON in the
+// caller's case.
+func WriteEvent(c *gin.Context, name string, v interface{}) {
+	body, err := encodeJSON(c, v)
+	if err != nil {
+		log.Printf("failed to encode %s event: %v", name, err)
+		return
+	}
+	c.SSEvent(name, json.RawMessage(body))
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/idgen"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// CorrelationIDHeader carries the request's correlation ID.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// CorrelationIDKey is the gin context key the middleware stores the
+// request's correlation ID under.
+const CorrelationIDKey = "correlation_id"
+
+// needed to ensure we have the id for tracking every request for its lifetime;
+// ids names the flows the client didn't name
+func CorrelationID(ids idgen.Generator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		correlationId := ctx.GetHeader(CorrelationIDHeader)
+		if correlationId == "" {
+			correlationId = ids.NewID()
+		}
+		ctx.Set(CorrelationIDKey, correlationId)
+		ctx.Header(CorrelationIDHeader, correlationId)
+		ctx.Next()
+	}
+}
+
+// RequestTimeout gives the request a deadline timeout from now, which the
+// handler's work is budgeted against. Zero leaves the request without one.
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// AuthMiddleware authenticates the caller by a bearer JWT signed with
+// secret, auth.jwt_secret.
+func AuthMiddleware(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c, secret)
+		if !ok {
+			return
+		}
+		c.Set("user_id", claims["user_id"])
+		c.Set(claimsKey, claims)
+		c.Next()
+
+	}
+}
+
+// AdminMiddleware authenticates the caller like AuthMiddleware and also
+// requires the admin scope.
+func AdminMiddleware(secret string) gin.HandlerFunc {
+	return ScopeMiddleware(secret, AdminScope)
+}
+
+// ScopeMiddleware authenticates the caller like AuthMiddleware and also
+// requires the token to grant scope.
+func ScopeMiddleware(secret, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c, secret)
+		if !ok {
+			return
+		}
+		if !HasScope(claims, scope) {
+			WriteError(c, http.StatusForbidden, models.APIResponse{
+				Success: false,
+				Code:    models.CodeForbidden,
+				Error:   "Scope " + scope + " required",
+				Message: "Forbidden",
+			})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", claims["user_id"])
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+const (
+	// AdminScope is the token scope required by the admin endpoints.
+	AdminScope = "notifications:admin"
+	// ReadAllScope lets a caller read notifications created by anyone.
+	ReadAllScope = "notifications:read:all"
+	// IngestScope is required by the internal data ingestion endpoints.
+	IngestScope = "notifications:ingest"
+	// InternalScope marks internal callers, which are shown every field of a
+	// status record.
+	InternalScope = "notifications:internal"
+
+	claimsKey = "claims"
+)
+
+// CallerID identifies the authenticated caller: the client name when the
+// token carries one, otherwise its subject. Empty when unauthenticated.
+func CallerID(c *gin.Context) string {
+	claims, _ := c.Get(claimsKey)
+	mapClaims, _ := claims.(jwt.MapClaims)
+	if name, ok := mapClaims["client_name"].(string); ok && name != "" {
+		return name
+	}
+	sub, _ := mapClaims["sub"].(string)
+	return sub
+}
+
+// CallerHasScope reports whether the authenticated caller holds scope.
+func CallerHasScope(c *gin.Context, scope string) bool {
+	claims, _ := c.Get(claimsKey)
+	mapClaims, _ := claims.(jwt.MapClaims)
+	return HasScope(mapClaims, scope)
+}
+
+// HasScope reports whether the token grants scope, either through a space
+// separated "scope" claim or a "scopes" list claim.
+func HasScope(claims jwt.MapClaims, scope string) bool {
+	if raw, ok := claims["scope"].(string); ok {
+		for _, s := range strings.Fields(raw) {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	if list, ok := claims["scopes"].([]interface{}); ok {
+		for _, s := range list {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticate validates the bearer token, which must be HMAC-signed with
+// secret, and returns its claims. On failure it writes the 401 response and
+// aborts the request.
+func authenticate(c *gin.Context, secret string) (jwt.MapClaims, bool) {
+	authKey := c.GetHeader("Authorization")
+	if authKey == "" {
+		WriteError(c, http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Code:    models.CodeUnauthorized,
+			Error:   "Authorization header required",
+			Message: "Unauthorized",
+		})
+		c.Abort()
+		return nil, false
+	}
+	parts := strings.SplitN(authKey, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		WriteError(c, http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Code:    models.CodeUnauthorized,
+			Error:   "Invalid Api Key",
+			Message: "Unauthorized",
+		})
+		c.Abort()
+		return nil, false
+	}
+	tokenString := parts[1]
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		if secret == "" {
+			return nil, errors.New("no JWT secret configured")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || !token.Valid {
+		WriteError(c, http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Code:    models.CodeUnauthorized,
+			Error:   "Invalid Token",
+			Message: "Unauthorized",
+		})
+		c.Abort()
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		claims = jwt.MapClaims{}
+	}
+	return claims, true
+}
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// will return to deal with it
+	}
+}
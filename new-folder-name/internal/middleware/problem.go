@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the RFC 7807 media type. Clients that list it in
+// Accept get errors as Problem documents instead of APIResponse.
+const ProblemContentType = "application/problem+json"
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// Problem is an RFC 7807 Problem Details document. Code, Errors and
+// RequestID are extension members.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      models.ErrorCode    `json:"code,omitempty"`
+	Errors    []models.FieldError `json:"errors,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+}
+
+// NewProblem describes an error response. The type is derived from the
+// error code so clients can tell problems apart without parsing detail.
+func NewProblem(c *gin.Context, status int, code models.ErrorCode, detail string) Problem {
+	problemType := "about:blank"
+	if code != "" {
+		problemType = "urn:problem-type:notifications:" + strings.ToLower(strings.ReplaceAll(string(code), "_", "-"))
+	}
+	return Problem{
+		Type:      problemType,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  correlationID(c),
+		Code:      code,
+		RequestID: CallerRequestID(c),
+	}
+}
+
+// WantsProblem reports whether the client asked for problem+json.
+func WantsProblem(c *gin.Context) bool {
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteError writes an error response, as a Problem when the client asked
+// for one and as resp otherwise, stamped with the request ID. It does not
+// abort the request.
+func WriteError(c *gin.Context, status int, resp models.APIResponse) {
+	resp.RequestID = CallerRequestID(c)
+	resp.Storage = storageHint(c)
+	problem := NewProblem(c, status, resp.Code, resp.Error)
+	if fieldErrors, ok := resp.Data.([]models.FieldError); ok {
+		problem.Errors = fieldErrors
+	}
+	Respond(c, status, problem, resp)
+}
+
+// Respond writes problem when the client asked for problem+json and
+// fallback, in whatever shape the endpoint normally uses, otherwise.
+func Respond(c *gin.Context, status int, problem Problem, fallback interface{}) {
+	if !WantsProblem(c) {
+		writeJSON(c, status, jsonContentType, fallback)
+		return
+	}
+	writeJSON(c, status, ProblemContentType, problem)
+}
+
+func correlationID(c *gin.Context) string {
+	if id := c.GetString(CorrelationIDKey); id != "" {
+		return id
+	}
+	return c.GetHeader(CorrelationIDHeader)
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/idgen"
+	"github.com/gin-gonic/gin"
+)
+
+// Three IDs follow a notification through the system, each naming
+// something different:
+//
+//   - the request ID names one HTTP call. Clients may send their own in
+//     X-Request-ID so they can join their logs with ours; otherwise one is
+//     generated. It is echoed on every response, logged in the access log,
+//     and stamped on the audit entries and queue messages the call made.
+//   - the correlation ID names a business flow, which may take several
+//     calls and notifications, in X-Correlation-ID.
+//   - the notification ID names one notification, whichever calls create,
+//     read or change it.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds a client's request ID; longer ones, or ones
+// with anything but printable ASCII, are replaced rather than logged.
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a copy of ctx carrying requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty
+// string.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// RequestID takes the client's X-Request-ID, or generates one when it is
+// missing or unusable, and puts it on the request context, the gin context
+// and the response. It must run before every middleware that can respond.
+// Generated IDs come from ids.
+func RequestID(ids idgen.Generator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = ids.NewID()
+		}
+		c.Set(RequestIDHeader, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
+
+// CallerRequestID returns the request ID of the request.
+func CallerRequestID(c *gin.Context) string {
+	return c.GetString(RequestIDHeader)
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteResponse writes resp as JSON in the caller's key case, stamped with
+// the request ID.
+func WriteResponse(c *gin.Context, status int, resp models.APIResponse) {
+	resp.RequestID = CallerRequestID(c)
+	resp.Storage = storageHint(c)
+	writeJSON(c, status, jsonContentType, resp)
+}
+
+// AccessLog logs every request like gin's logger, with its request ID.
+func AccessLog() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		requestID, _ := p.Keys[RequestIDHeader].(string)
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | request_id=%s\n%s",
+			p.TimeStamp.Format(time.RFC3339),
+			p.StatusCode,
+			p.Latency,
+			p.ClientIP,
+			p.Method,
+			p.Path,
+			requestID,
+			p.ErrorMessage,
+		)
+	})
+}
+
+// Recovery turns a panic into a 500 error response, which carries the
+// request ID like any other, instead of gin's empty one.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		WriteError(c, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Code:    models.CodeInternalError,
+			Error:   "Internal server error",
+			Message: "Internal server error",
+		})
+		c.Abort()
+	})
+}
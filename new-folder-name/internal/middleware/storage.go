@@ -0,0 +1,19 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// StorageDegraded is the storage hint of a response served while status
+// records are kept in memory.
+const StorageDegraded = "degraded"
+
+const storageKey = "storage"
+
+// MarkStorageDegraded makes the responses to c carry the degraded storage
+// hint.
+func MarkStorageDegraded(c *gin.Context) {
+	c.Set(storageKey, StorageDegraded)
+}
+
+func storageHint(c *gin.Context) string {
+	return c.GetString(storageKey)
+}
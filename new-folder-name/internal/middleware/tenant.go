@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// TenantHeader names the tenant in mock mode, where tokens carry no claim.
+const TenantHeader = "X-Tenant-ID"
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx, or an empty string.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// TenantMiddleware resolves the caller's tenant from the token's tenant_id
+// claim and puts it on the request context. It must run after the
+// authentication middleware. When headerFallback is set (mock mode) the
+// X-Tenant-ID header is used for tokens without the claim. Callers with
+// neither belong to defaultTenant, so single-tenant deployments keep working.
+func TenantMiddleware(defaultTenant string, headerFallback bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get(claimsKey)
+		mapClaims, _ := claims.(jwt.MapClaims)
+		tenant, _ := mapClaims["tenant_id"].(string)
+		if tenant == "" && headerFallback {
+			tenant = c.GetHeader(TenantHeader)
+		}
+		if tenant == "" {
+			tenant = defaultTenant
+		}
+		c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+// CallerTenant returns the tenant resolved for the request.
+func CallerTenant(c *gin.Context) string {
+	return TenantFromContext(c.Request.Context())
+}
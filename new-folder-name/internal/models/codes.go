@@ -0,0 +1,47 @@
+package models
+
+// ErrorCode is the machine-readable reason for a response. Codes are part
+// of the v1 API: a code is never renamed or given a new meaning, only added.
+type ErrorCode string
+
+const (
+	// Request problems
+	CodeValidationError ErrorCode = "VALIDATION_ERROR"
+	CodeUnauthorized    ErrorCode = "UNAUTHORIZED"
+	CodeForbidden       ErrorCode = "FORBIDDEN"
+
+	// Referenced entities
+	CodeUserNotFound         ErrorCode = "USER_NOT_FOUND"
+	CodeRecipientNotFound    ErrorCode = "RECIPIENT_NOT_FOUND"
+	CodeTemplateNotFound     ErrorCode = "TEMPLATE_NOT_FOUND"
+	CodeTemplateUnparseable  ErrorCode = "TEMPLATE_UNPARSEABLE"
+	CodeNotificationNotFound ErrorCode = "NOTIFICATION_NOT_FOUND"
+	CodeUserOptedOut         ErrorCode = "USER_OPTED_OUT"
+	// CodeSuppressedByPolicy refuses a send a pre-send policy check
+	// suppressed without a code of its own.
+	CodeSuppressedByPolicy ErrorCode = "SUPPRESSED_BY_POLICY"
+
+	// Notification lifecycle
+	CodeDuplicateRequest     ErrorCode = "DUPLICATE_REQUEST"
+	CodeInvalidState         ErrorCode = "INVALID_STATE"
+	CodeConcurrentUpdate     ErrorCode = "CONCURRENT_UPDATE"
+	CodeSnoozeLimitReached   ErrorCode = "SNOOZE_LIMIT_REACHED"
+	CodeNotResendable        ErrorCode = "NOT_RESENDABLE"
+	CodeApprovalNotFound     ErrorCode = "APPROVAL_NOT_FOUND"
+	CodeApprovalExpired      ErrorCode = "APPROVAL_EXPIRED"
+	CodeApprovalDecided      ErrorCode = "APPROVAL_ALREADY_DECIDED"
+	CodeSelfApprovalRejected ErrorCode = "SELF_APPROVAL"
+
+	// Sending limits
+	CodeEmergencyStop   ErrorCode = "EMERGENCY_STOP"
+	CodeGlobalCeiling   ErrorCode = "GLOBAL_CEILING"
+	CodeChannelDisabled ErrorCode = "CHANNEL_DISABLED"
+
+	// Server side
+	CodeQueueUnavailable   ErrorCode = "QUEUE_UNAVAILABLE"
+	CodeServiceUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeInternalError      ErrorCode = "INTERNAL_ERROR"
+	// CodeDeadlineExceeded fails a send fast when too little of the
+	// request's deadline is left for its next step.
+	CodeDeadlineExceeded ErrorCode = "DEADLINE_EXCEEDED"
+)
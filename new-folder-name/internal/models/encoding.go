@@ -0,0 +1,58 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GzipEncoding is the content encoding of a compressed message body.
+const GzipEncoding = "gzip"
+
+// MaxDecompressedBody caps what a compressed body may inflate to, so a
+// hostile or corrupt message can't exhaust a worker's memory.
+const MaxDecompressedBody = 32 << 20
+
+// ErrBodyTooLarge is returned by DecompressBody for a body that inflates
+// past MaxDecompressedBody.
+var ErrBodyTooLarge = errors.New("decompressed message body is too large")
+
+// gzipMagic starts every gzip stream; no JSON body starts with it.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsCompressed reports whether body is gzip-compressed.
+func IsCompressed(body []byte) bool {
+	return bytes.HasPrefix(body, gzipMagic)
+}
+
+// CompressBody gzips body.
+func CompressBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecompressBody inflates a body compressed by CompressBody.
+func DecompressBody(body []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress message: %w", err)
+	}
+	defer zr.Close()
+	inflated, err := io.ReadAll(io.LimitReader(zr, MaxDecompressedBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress message: %w", err)
+	}
+	if len(inflated) > MaxDecompressedBody {
+		return nil, ErrBodyTooLarge
+	}
+	return inflated, nil
+}
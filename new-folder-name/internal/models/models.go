@@ -0,0 +1,438 @@
+// Package models holds the gateway's request, response, queue and storage
+// types. Every exported field carries a pii tag classifying the personal
+// data it holds, from which package privacy builds its inventory.
+package models
+
+import "time"
+
+type NotificationMessage struct {
+	ID            string                 `json:"id" pii:"none"`
+	Type          string                 `json:"type" pii:"none"` // "email" or "push"
+	UserID        string                 `json:"user_id" pii:"identifier"`
+	TemplateID    string                 `json:"template_id" pii:"none"`
+	Variables     map[string]interface{} `json:"variables" pii:"content"`
+	Priority      string                 `json:"priority" pii:"none"`
+	ScheduledFor  *time.Time             `json:"scheduled_for,omitempty" pii:"none"`
+	Timestamp     time.Time              `json:"timestamp" pii:"none"`
+	CorrelationID string                 `json:"correlation_id" pii:"none"`
+	Overrides     *Overrides             `json:"overrides,omitempty" pii:"nested"`
+	Attachments   []Attachment           `json:"attachments,omitempty" pii:"nested"`
+	CC            []string               `json:"cc,omitempty" pii:"identifier"`
+	BCC           []string               `json:"bcc,omitempty" pii:"identifier"`
+	// DeviceTokens, when set, tell the push worker to skip device lookup.
+	DeviceTokens []string `json:"device_tokens,omitempty" pii:"contact"`
+	Platform     string   `json:"platform,omitempty" pii:"none"`
+	// Topic is set on "push_topic" broadcasts, which have no UserID.
+	Topic string `json:"topic,omitempty" pii:"none"`
+	// Locale is the BCP-47 tag of the template variant to render.
+	Locale string `json:"locale,omitempty" pii:"preference"`
+	// Environment is stamped by the publisher so consumers can refuse
+	// messages from another deployment.
+	Environment string `json:"environment,omitempty" pii:"none"`
+	Category    string `json:"category,omitempty" pii:"none"`
+	// TenantID is the product the notification was sent on behalf of.
+	TenantID string `json:"tenant_id,omitempty" pii:"none"`
+	// Metadata is passed through so workers can echo it in callbacks.
+	Metadata map[string]string `json:"metadata,omitempty" pii:"content"`
+	// GroupID links the notifications of one multi-channel send.
+	GroupID string `json:"group_id,omitempty" pii:"none"`
+	// RequestID names the HTTP call that queued the message.
+	RequestID string `json:"request_id,omitempty" pii:"none"`
+	// ExpiresInSeconds, when set, is how long the message may wait in the
+	// queue before the broker dead-letters it to the failed queue.
+	ExpiresInSeconds int `json:"expires_in_seconds,omitempty" pii:"none"`
+	// SchemaVersion is stamped by the publisher. Messages from the old
+	// gateway have none.
+	SchemaVersion int `json:"schema_version,omitempty" pii:"none"`
+	// Recipient carries what the gateway learned about reaching the user
+	// for this channel, so the worker needn't ask the user service again.
+	// Overrides and DeviceTokens still take precedence.
+	Recipient *Recipient `json:"recipient,omitempty" pii:"nested"`
+	// UpgradedFromLegacy is set by the consumer on a message decoded from
+	// the old gateway's shape, with defaults filled in. It is never sent.
+	UpgradedFromLegacy bool `json:"-" pii:"none"`
+}
+
+// User is a user as the user service returns them.
+type User struct {
+	ID         string   `json:"id" pii:"identifier"`
+	Email      string   `json:"email,omitempty" pii:"email"`
+	Phone      string   `json:"phone,omitempty" pii:"contact"`
+	PushTokens []string `json:"push_tokens,omitempty" pii:"contact"`
+	Locale     string   `json:"locale,omitempty" pii:"preference"`
+	Timezone   string   `json:"timezone,omitempty" pii:"location"`
+	// Active is false for a deactivated user, who is sent nothing.
+	Active bool `json:"active" pii:"none"`
+	// Preferences is nil when the record came without them; they are then
+	// read from the preferences endpoint.
+	Preferences *Preferences `json:"preferences,omitempty" pii:"nested"`
+}
+
+// Recipient is the delivery hint a message carries: the user's address on
+// its channel, resolved when the notification was queued.
+type Recipient struct {
+	Email      string   `json:"email,omitempty" pii:"email"`
+	Phone      string   `json:"phone,omitempty" pii:"contact"`
+	PushTokens []string `json:"push_tokens,omitempty" pii:"contact"`
+}
+
+// Preferences are the user's per-channel opt-outs from marketing
+// notifications.
+type Preferences struct {
+	EmailOptOut    bool `json:"email_opt_out" pii:"preference"`
+	PushOptOut     bool `json:"push_opt_out" pii:"preference"`
+	WhatsAppOptOut bool `json:"whatsapp_opt_out" pii:"preference"`
+}
+
+// TemplateMetadata describes a template as the template service stores it.
+// Type is the channel the template was written and approved for.
+type TemplateMetadata struct {
+	ID               string `json:"id" pii:"none"`
+	Type             string `json:"type,omitempty" pii:"none"`
+	RequiresApproval bool   `json:"requires_approval" pii:"none"`
+}
+
+// Overrides carries per-request delivery overrides that workers should
+// prefer over the details resolved from the user service.
+type Overrides struct {
+	RecipientEmail string `json:"recipient_email,omitempty" pii:"email"`
+}
+type SendEmailRequest struct {
+	UserID         string                 `json:"user_id" binding:"required" pii:"identifier"`
+	TemplateID     string                 `json:"template_id" binding:"required" pii:"none"`
+	Variables      map[string]interface{} `json:"variables,omitempty" pii:"content"`
+	RecipientEmail string                 `json:"recipient_email,omitempty" binding:"omitempty,email" pii:"email"`
+	Attachments    []Attachment           `json:"attachments,omitempty" pii:"nested"`
+	// CC and BCC hold user IDs, each validated against the user service.
+	CC  []string `json:"cc,omitempty" pii:"identifier"`
+	BCC []string `json:"bcc,omitempty" pii:"identifier"`
+	// SendTimeOptimization defers delivery to the hour the user engages most.
+	SendTimeOptimization bool `json:"send_time_optimization,omitempty" pii:"none"`
+	// Locale is a BCP-47 tag; the user's preferred locale is used when empty.
+	Locale string `json:"locale,omitempty" pii:"preference"`
+	// Category decides whether the user's opt-out applies. It defaults to
+	// transactional, which always goes through.
+	Category string `json:"category,omitempty" binding:"omitempty,oneof=transactional marketing" pii:"none"`
+	// RespectQuietHours defers delivery until the end of the user's quiet
+	// hours. High-priority notifications are never deferred.
+	RespectQuietHours bool   `json:"respect_quiet_hours,omitempty" pii:"none"`
+	Priority          string `json:"priority,omitempty" binding:"omitempty,oneof=low normal high" pii:"none"`
+	// DedupeWindowSeconds overrides the configured duplicate-suppression
+	// window; 0 disables suppression for this request.
+	DedupeWindowSeconds *int `json:"dedupe_window_seconds,omitempty" binding:"omitempty,min=0" pii:"none"`
+	// Metadata is the caller's own references (an invoice or order ID). It
+	// is never rendered, only echoed back on the status and in events.
+	Metadata map[string]string `json:"metadata,omitempty" pii:"content"`
+	// ExpiresInSeconds drops the notification, up to 7 days after it is
+	// queued, if no worker has picked it up by then. Scheduled and
+	// deferred notifications wait in the queue too, so it must cover the
+	// wait.
+	ExpiresInSeconds int `json:"expires_in_seconds,omitempty" pii:"none"`
+}
+
+// SendTimeProfile is the per-user engagement model supplied by the
+// ingestion endpoint.
+type SendTimeProfile struct {
+	PreferredHour *int   `json:"preferred_hour" binding:"required,min=0,max=23" pii:"preference"`
+	Timezone      string `json:"timezone" binding:"required" pii:"location"`
+}
+
+// Attachment references a file in the object store that the email worker
+// fetches and attaches. The gateway never accepts raw file bytes.
+type Attachment struct {
+	URL         string `json:"url" pii:"content"`
+	Filename    string `json:"filename" pii:"content"`
+	ContentType string `json:"content_type" pii:"none"`
+}
+
+type SendPushRequest struct {
+	UserID     string                 `json:"user_id" binding:"required" pii:"identifier"`
+	TemplateID string                 `json:"template_id" binding:"required" pii:"none"`
+	Variables  map[string]interface{} `json:"variables,omitempty" pii:"content"`
+	// Attachments are not supported for push; the field only exists so the
+	// handler can reject requests that send them.
+	Attachments  []Attachment `json:"attachments,omitempty" pii:"nested"`
+	DeviceTokens []string     `json:"device_tokens,omitempty" pii:"contact"`
+	Platform     string       `json:"platform,omitempty" binding:"omitempty,oneof=ios android web" pii:"none"`
+	Locale       string       `json:"locale,omitempty" pii:"preference"`
+	Category     string       `json:"category,omitempty" binding:"omitempty,oneof=transactional marketing" pii:"none"`
+	// RespectQuietHours, Priority and DedupeWindowSeconds behave as on
+	// SendEmailRequest.
+	RespectQuietHours   bool              `json:"respect_quiet_hours,omitempty" pii:"none"`
+	Priority            string            `json:"priority,omitempty" binding:"omitempty,oneof=low normal high" pii:"none"`
+	DedupeWindowSeconds *int              `json:"dedupe_window_seconds,omitempty" binding:"omitempty,min=0" pii:"none"`
+	Metadata            map[string]string `json:"metadata,omitempty" pii:"content"`
+	// ExpiresInSeconds behaves as on SendEmailRequest; one-time codes are
+	// what it is for.
+	ExpiresInSeconds int `json:"expires_in_seconds,omitempty" pii:"none"`
+}
+
+// SendWhatsAppRequest sends a WhatsApp Business template message. The
+// template must be one the template service lists with type "whatsapp",
+// since WhatsApp only delivers templates Meta has approved.
+type SendWhatsAppRequest struct {
+	UserID     string                 `json:"user_id" binding:"required" pii:"identifier"`
+	TemplateID string                 `json:"template_id" binding:"required" pii:"none"`
+	Variables  map[string]interface{} `json:"variables,omitempty" pii:"content"`
+	Locale     string                 `json:"locale,omitempty" pii:"preference"`
+	Category   string                 `json:"category,omitempty" binding:"omitempty,oneof=transactional marketing" pii:"none"`
+	Metadata   map[string]string      `json:"metadata,omitempty" pii:"content"`
+	// ExpiresInSeconds behaves as on SendEmailRequest.
+	ExpiresInSeconds int `json:"expires_in_seconds,omitempty" pii:"none"`
+}
+
+// PatchNotificationRequest changes a scheduled notification before it is
+// dispatched. Only the fields present in the body are changed.
+type PatchNotificationRequest struct {
+	Variables    map[string]interface{} `json:"variables,omitempty" pii:"content"`
+	ScheduledFor *time.Time             `json:"scheduled_for,omitempty" pii:"none"`
+	Priority     *string                `json:"priority,omitempty" binding:"omitempty,oneof=low normal high" pii:"none"`
+}
+
+// SnoozeRequest asks for a notification to be delivered again later,
+// either after Duration (e.g. "2h") or at Until.
+type SnoozeRequest struct {
+	Duration string     `json:"duration,omitempty" pii:"none"`
+	Until    *time.Time `json:"until,omitempty" pii:"none"`
+}
+
+// PendingApproval is a send held until a second person approves it. Message
+// is published unchanged on approval.
+type PendingApproval struct {
+	Message   NotificationMessage `json:"message" pii:"nested"`
+	CreatedBy string              `json:"created_by,omitempty" pii:"identifier"`
+	CreatedAt time.Time           `json:"created_at" pii:"none"`
+	ExpiresAt time.Time           `json:"expires_at" pii:"none"`
+}
+
+// ApprovalDecisionRequest optionally explains an approval or rejection.
+type ApprovalDecisionRequest struct {
+	Reason string `json:"reason,omitempty" pii:"content"`
+}
+
+// StatusEvent is published on notifications.events_channel each time a
+// notification's status changes. OldStatus is empty for a new notification.
+type StatusEvent struct {
+	ID            string    `json:"id" pii:"none"`
+	Type          string    `json:"type" pii:"none"`
+	TenantID      string    `json:"tenant_id,omitempty" pii:"none"`
+	OldStatus     string    `json:"old_status" pii:"none"`
+	NewStatus     string    `json:"new_status" pii:"none"`
+	Timestamp     time.Time `json:"timestamp" pii:"none"`
+	CorrelationID string    `json:"correlation_id,omitempty" pii:"none"`
+}
+
+// HistoryEntry is one audited action taken on a notification. Status is
+// the notification's status after the action, when it changed one. Seq
+// orders a history; At is the writer's wall clock and only informative.
+type HistoryEntry struct {
+	Seq    int64     `json:"seq" pii:"none"`
+	Action string    `json:"action" pii:"none"`
+	Status string    `json:"status,omitempty" pii:"none"`
+	Actor  string    `json:"actor" pii:"identifier"`
+	Reason string    `json:"reason,omitempty" pii:"content"`
+	At     time.Time `json:"at" pii:"none"`
+	// RequestID names the HTTP call that took the action; consumers'
+	// entries have none.
+	RequestID string `json:"request_id,omitempty" pii:"none"`
+	// SincePreviousMs and ClockSkewed are filled in when a history is read.
+	// A negative gap from a skewed writer is reported as zero.
+	SincePreviousMs int64 `json:"since_previous_ms,omitempty" pii:"none"`
+	ClockSkewed     bool  `json:"clock_skewed,omitempty" pii:"none"`
+}
+
+// IdempotencyRecord is kept under a notification ID by the send that
+// claimed it, and answers any repeat of that send.
+type IdempotencyRecord struct {
+	NotificationID string    `json:"notification_id" pii:"none"`
+	AcceptedAt     time.Time `json:"accepted_at" pii:"none"`
+}
+
+type SendTopicPushRequest struct {
+	Topic      string                 `json:"topic" binding:"required" pii:"none"`
+	TemplateID string                 `json:"template_id" binding:"required" pii:"none"`
+	Variables  map[string]interface{} `json:"variables,omitempty" pii:"content"`
+}
+
+type APIResponse struct {
+	Success bool        `json:"success" pii:"none"`
+	Data    interface{} `json:"data,omitempty" pii:"none"`
+	// Code is what clients should branch on; Error and Message are for
+	// people and may be reworded at any time.
+	Code    ErrorCode `json:"code,omitempty" pii:"none"`
+	Error   string    `json:"error,omitempty" pii:"none"`
+	Message string    `json:"message" pii:"none"`
+	// Warnings point out likely mistakes that didn't stop the request.
+	Warnings []string `json:"warnings,omitempty" pii:"none"`
+	// RequestID names the HTTP call, see middleware.RequestIDHeader.
+	RequestID string `json:"request_id,omitempty" pii:"none"`
+	// Storage is "degraded" while status records are kept in memory
+	// because Redis is unreachable.
+	Storage string `json:"storage,omitempty" pii:"none"`
+	// Source is "archive" for a status record read from the archive after
+	// Redis expired it.
+	Source string `json:"source,omitempty" pii:"none"`
+}
+
+// FieldError points at a single invalid request field.
+type FieldError struct {
+	Field   string `json:"field" pii:"none"`
+	Message string `json:"message" pii:"none"`
+}
+
+type NotificationResponse struct {
+	NotificationID string     `json:"notification_id" pii:"none"`
+	Status         string     `json:"status" pii:"none"`
+	QueuedAt       time.Time  `json:"queued_at" pii:"none"`
+	ScheduledFor   *time.Time `json:"scheduled_for,omitempty" pii:"none"`
+}
+
+// SendMultiRequest sends one template to a user on several channels at
+// once, creating a notification per channel.
+type SendMultiRequest struct {
+	UserID     string                 `json:"user_id" binding:"required" pii:"identifier"`
+	TemplateID string                 `json:"template_id" binding:"required" pii:"none"`
+	Channels   []string               `json:"channels" binding:"required,min=1,dive,oneof=email push" pii:"none"`
+	Variables  map[string]interface{} `json:"variables,omitempty" pii:"content"`
+	Locale     string                 `json:"locale,omitempty" pii:"preference"`
+	Category   string                 `json:"category,omitempty" binding:"omitempty,oneof=transactional marketing" pii:"none"`
+	Priority   string                 `json:"priority,omitempty" binding:"omitempty,oneof=low normal high" pii:"none"`
+	Metadata   map[string]string      `json:"metadata,omitempty" pii:"content"`
+}
+
+// ChannelResult is the outcome of one channel of a multi-channel send. A
+// channel that wasn't queued has no notification, and Code says why.
+type ChannelResult struct {
+	Channel        string    `json:"channel" pii:"none"`
+	NotificationID string    `json:"notification_id,omitempty" pii:"none"`
+	Status         string    `json:"status" pii:"none"`
+	Code           ErrorCode `json:"code,omitempty" pii:"none"`
+	Error          string    `json:"error,omitempty" pii:"none"`
+}
+
+// MultiSendResponse reports every channel of a multi-channel send.
+type MultiSendResponse struct {
+	GroupID string          `json:"group_id" pii:"none"`
+	Results []ChannelResult `json:"results" pii:"nested"`
+}
+
+// GroupStatus aggregates the notifications of a multi-channel send. Status
+// is their common status, or "mixed" when they differ; Counts tallies them.
+type GroupStatus struct {
+	GroupID       string               `json:"group_id" pii:"none"`
+	Status        string               `json:"status" pii:"none"`
+	Counts        map[string]int       `json:"counts" pii:"none"`
+	Notifications []NotificationStatus `json:"notifications" pii:"nested"`
+}
+
+// RecipientCounts records how many recipients an email was addressed to.
+type RecipientCounts struct {
+	To  int `json:"to" pii:"none"`
+	CC  int `json:"cc" pii:"none"`
+	BCC int `json:"bcc" pii:"none"`
+}
+
+type NotificationStatus struct {
+	ID         string           `json:"id" pii:"none"`
+	TenantID   string           `json:"tenant_id,omitempty" pii:"none"`
+	UserID     string           `json:"user_id,omitempty" pii:"identifier"`
+	TemplateID string           `json:"template_id,omitempty" pii:"none"`
+	Type       string           `json:"type" pii:"none"`
+	Status     string           `json:"status" pii:"none"`
+	Overrides  *Overrides       `json:"overrides,omitempty" pii:"nested"`
+	Recipients *RecipientCounts `json:"recipients,omitempty" pii:"nested"`
+	// TargetDevices is the number of device tokens a push was addressed to.
+	TargetDevices int        `json:"target_devices,omitempty" pii:"none"`
+	ScheduledFor  *time.Time `json:"scheduled_for,omitempty" pii:"none"`
+	Topic         string     `json:"topic,omitempty" pii:"none"`
+	Locale        string     `json:"locale,omitempty" pii:"preference"`
+	CreatedBy     string     `json:"created_by,omitempty" pii:"identifier"`
+	// CorrelationID is the ID of the request that created the notification.
+	CorrelationID string `json:"correlation_id,omitempty" pii:"none"`
+	// ResentFrom links a resend to the notification it repeats.
+	ResentFrom string `json:"resent_from,omitempty" pii:"none"`
+	// GroupID links the notifications of one multi-channel send.
+	GroupID string `json:"group_id,omitempty" pii:"none"`
+	// ParentID links a snoozed copy to the notification it was cloned from.
+	// SnoozedUntil and SnoozeCount are set on the original.
+	ParentID     string     `json:"parent_id,omitempty" pii:"none"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty" pii:"none"`
+	SnoozeCount  int        `json:"snooze_count,omitempty" pii:"none"`
+	// Delivery is what the notification's message carried beyond the
+	// fields above, so a copy of it goes out the same.
+	Delivery *Delivery `json:"delivery,omitempty" pii:"nested"`
+	// Variables and Priority are kept so scheduled notifications can be
+	// dispatched, and sent ones resent, from this record.
+	Variables map[string]interface{} `json:"variables,omitempty" pii:"content"`
+	Priority  string                 `json:"priority,omitempty" pii:"none"`
+	Category  string                 `json:"category,omitempty" pii:"none"`
+	Metadata  map[string]string      `json:"metadata,omitempty" pii:"content"`
+	// PolicyReason is why a pre-send policy check deferred the
+	// notification.
+	PolicyReason string `json:"policy_reason,omitempty" pii:"none"`
+	// Queue is the queue the notification was published to. Attempts,
+	// LastAttemptAt and LastError are maintained by the consumers. Records
+	// stored before these fields existed decode with their zero values.
+	Queue         string     `json:"queue,omitempty" pii:"none"`
+	Attempts      int        `json:"attempts" pii:"none"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty" pii:"none"`
+	LastError     string     `json:"last_error,omitempty" pii:"content"`
+	// UpgradedFromLegacy is set once a consumer has taken the notification
+	// from a message in the old gateway's shape.
+	UpgradedFromLegacy bool `json:"upgraded_from_legacy,omitempty" pii:"none"`
+	// DuplicateDeliveries are the notifications that delivered the same
+	// content to the same recipient within the detector's window; the
+	// notification's own ID when it went out twice itself.
+	DuplicateDeliveries []string `json:"duplicate_deliveries,omitempty" pii:"none"`
+	// ErrorCategory stands in for LastError in responses to callers that
+	// may not see the provider's message. It is never stored.
+	ErrorCategory string    `json:"error_category,omitempty" pii:"none"`
+	CreatedAt     time.Time `json:"created_at" pii:"none"`
+	UpdatedAt     time.Time `json:"updated_at" pii:"none"`
+}
+
+// Delivery holds the message fields a status record keeps only to send the
+// notification again.
+type Delivery struct {
+	Attachments  []Attachment `json:"attachments,omitempty" pii:"nested"`
+	CC           []string     `json:"cc,omitempty" pii:"identifier"`
+	BCC          []string     `json:"bcc,omitempty" pii:"identifier"`
+	DeviceTokens []string     `json:"device_tokens,omitempty" pii:"contact"`
+	Platform     string       `json:"platform,omitempty" pii:"none"`
+	Recipient    *Recipient   `json:"recipient,omitempty" pii:"nested"`
+}
+
+// DuplicateDelivery is a delivery the duplicate detector caught repeating
+// an earlier one: NotificationID went out with the content DuplicateOf
+// delivered to the same recipient, within the window.
+type DuplicateDelivery struct {
+	DetectedAt     time.Time `json:"detected_at" pii:"none"`
+	Fingerprint    string    `json:"fingerprint" pii:"none"`
+	Channel        string    `json:"channel" pii:"none"`
+	TenantID       string    `json:"tenant_id,omitempty" pii:"none"`
+	UserID         string    `json:"user_id,omitempty" pii:"identifier"`
+	Topic          string    `json:"topic,omitempty" pii:"none"`
+	TemplateID     string    `json:"template_id" pii:"none"`
+	NotificationID string    `json:"notification_id" pii:"none"`
+	DuplicateOf    string    `json:"duplicate_of" pii:"none"`
+}
+
+// DuplicateReport is the day's duplicate deliveries, oldest first, for
+// reconciliation.
+type DuplicateReport struct {
+	Date       string              `json:"date" pii:"none"`
+	Total      int                 `json:"total" pii:"none"`
+	Duplicates []DuplicateDelivery `json:"duplicates" pii:"nested"`
+}
+
+// UserNotificationSummary counts a user's notifications created in the last
+// WindowSeconds, by status and by channel. LatestAt is when the newest of
+// them was created; it is absent when there are none.
+type UserNotificationSummary struct {
+	UserID        string         `json:"user_id" pii:"identifier"`
+	WindowSeconds int64          `json:"window_seconds" pii:"none"`
+	Total         int            `json:"total" pii:"none"`
+	ByStatus      map[string]int `json:"by_status" pii:"none"`
+	ByChannel     map[string]int `json:"by_channel" pii:"none"`
+	LatestAt      *time.Time     `json:"latest_at,omitempty" pii:"none"`
+}
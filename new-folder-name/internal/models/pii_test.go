@@ -0,0 +1,70 @@
+package models
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/franzego/stage04/internal/privacy"
+)
+
+// TestPIITags reads the package source, so a field added to any struct,
+// including a new one, fails here until it is classified.
+func TestPIITags(t *testing.T) {
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	checked := 0
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, entry.Name(), nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			structType, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			for _, field := range structType.Fields.List {
+				for _, name := range field.Names {
+					if !name.IsExported() {
+						continue
+					}
+					checked++
+					var tag reflect.StructTag
+					if field.Tag != nil {
+						raw, _ := strconv.Unquote(field.Tag.Value)
+						tag = reflect.StructTag(raw)
+					}
+					value, ok := tag.Lookup(privacy.TagName)
+					if !ok {
+						t.Errorf("%s: %s.%s has no pii tag", fset.Position(name.Pos()), spec.Name.Name, name.Name)
+						continue
+					}
+					category, _, _ := strings.Cut(value, ",")
+					if _, known := privacy.Categories[category]; !known {
+						t.Errorf("%s: %s.%s has unknown pii category %q", fset.Position(name.Pos()), spec.Name.Name, name.Name, category)
+					}
+				}
+			}
+			return false
+		})
+	}
+	if checked == 0 {
+		t.Fatal("no fields found; is the test running in the models directory?")
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// CurrentSchemaVersion is the version of the NotificationMessage body the
+// publishers stamp, bumped when a change to it would break the workers.
+// Bodies without one, version 0, come from the old gateway.
+const CurrentSchemaVersion = 1
+
+// ErrUnsupportedSchema is returned by DecodeNotificationMessage for a body
+// of a version newer than this build reads, so the consumer dead-letters it
+// instead of handling it wrong.
+var ErrUnsupportedSchema = errors.New("unsupported message schema version")
+
+// The defaults a legacy message gets for the fields the old gateway didn't
+// send. LegacyTenant matches the default of notifications.default_tenant,
+// whose statuses live under the unprefixed keys the old gateway wrote.
+const (
+	LegacyCategory = "transactional"
+	LegacyTenant   = "default"
+	LegacyPriority = "normal"
+)
+
+// schemaUpgrades[v] brings a message decoded from a version v body up to
+// version v+1. Bumping CurrentSchemaVersion means adding a step here.
+var schemaUpgrades = [CurrentSchemaVersion]func(msg *NotificationMessage){
+	0: upgradeLegacy,
+}
+
+// DecodeNotificationMessage decodes a body of any version up to
+// CurrentSchemaVersion and upgrades it to the current one, filling in the
+// defaults for fields its version didn't have. A body from the old gateway
+// comes back marked UpgradedFromLegacy. A body of an unknown version fails
+// with ErrUnsupportedSchema. A compressed body is decompressed first,
+// whether or not its content encoding came with it.
+func DecodeNotificationMessage(body []byte) (NotificationMessage, error) {
+	var msg NotificationMessage
+	if IsCompressed(body) {
+		inflated, err := DecompressBody(body)
+		if err != nil {
+			return msg, err
+		}
+		body = inflated
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return msg, fmt.Errorf("failed to decode message: %w", err)
+	}
+	if msg.SchemaVersion < 0 || msg.SchemaVersion > CurrentSchemaVersion {
+		return msg, fmt.Errorf("message %s has schema version %d, newest supported is %d: %w",
+			msg.ID, msg.SchemaVersion, CurrentSchemaVersion, ErrUnsupportedSchema)
+	}
+	for version := msg.SchemaVersion; version < CurrentSchemaVersion; version++ {
+		schemaUpgrades[version](&msg)
+	}
+	msg.SchemaVersion = CurrentSchemaVersion
+	return msg, nil
+}
+
+// upgradeLegacy fills in the fields the old gateway didn't send.
+func upgradeLegacy(msg *NotificationMessage) {
+	if msg.Category == "" {
+		msg.Category = LegacyCategory
+	}
+	if msg.TenantID == "" {
+		msg.TenantID = LegacyTenant
+	}
+	if msg.Priority == "" {
+		msg.Priority = LegacyPriority
+	}
+	msg.UpgradedFromLegacy = true
+}
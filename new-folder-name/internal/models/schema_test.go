@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaFixtures are a body of every supported schema version, as its
+// publishers sent it.
+var schemaFixtures = map[int]string{
+	0: `{"id":"n-1","type":"email","user_id":"user123","template_id":"welcome_email",
+		"variables":{"name":"Ada"},"priority":"high","timestamp":"2025-11-03T09:14:22.418Z",
+		"correlation_id":"corr-1"}`,
+	1: `{"id":"n-1","type":"email","user_id":"user123","template_id":"welcome_email",
+		"variables":{"name":"Ada"},"priority":"high","timestamp":"2025-11-03T09:14:22.418Z",
+		"correlation_id":"corr-1","category":"marketing","tenant_id":"acme",
+		"metadata":{"order":"42"},"overrides":{"recipient_email":"ada@example.com"},"schema_version":1}`,
+}
+
+func TestDecodeNotificationMessage_RoundTrip(t *testing.T) {
+	for version := 0; version <= CurrentSchemaVersion; version++ {
+		body, ok := schemaFixtures[version]
+		require.True(t, ok, "no fixture for schema version %d", version)
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			msg, err := DecodeNotificationMessage([]byte(body))
+			require.NoError(t, err)
+			assert.Equal(t, CurrentSchemaVersion, msg.SchemaVersion)
+			assert.Equal(t, "n-1", msg.ID)
+			assert.Equal(t, "high", msg.Priority)
+			assert.NotEmpty(t, msg.Category)
+			assert.NotEmpty(t, msg.TenantID)
+			assert.Equal(t, version == 0, msg.UpgradedFromLegacy)
+
+			// what a consumer republishes reads back the same
+			again, err := json.Marshal(msg)
+			require.NoError(t, err)
+			roundTripped, err := DecodeNotificationMessage(again)
+			require.NoError(t, err)
+			roundTripped.UpgradedFromLegacy = msg.UpgradedFromLegacy
+			assert.Equal(t, msg, roundTripped)
+		})
+	}
+}
+
+func TestDecodeNotificationMessage_Defaults(t *testing.T) {
+	msg, err := DecodeNotificationMessage([]byte(schemaFixtures[0]))
+	require.NoError(t, err)
+	assert.Equal(t, LegacyCategory, msg.Category)
+	assert.Equal(t, LegacyTenant, msg.TenantID)
+
+	msg, err = DecodeNotificationMessage([]byte(`{"id":"n-2","schema_version":1}`))
+	require.NoError(t, err)
+	assert.Empty(t, msg.Category, "current messages get no defaults")
+}
+
+func TestDecodeNotificationMessage_Unsupported(t *testing.T) {
+	for _, body := range []string{
+		fmt.Sprintf(`{"id":"n-1","schema_version":%d,"channels":["email"]}`, CurrentSchemaVersion+1),
+		`{"id":"n-1","schema_version":-1}`,
+	} {
+		_, err := DecodeNotificationMessage([]byte(body))
+		assert.ErrorIs(t, err, ErrUnsupportedSchema, body)
+	}
+
+	_, err := DecodeNotificationMessage([]byte(`{"id":`))
+	assert.ErrorContains(t, err, "failed to decode message")
+	assert.NotErrorIs(t, err, ErrUnsupportedSchema)
+}
+
+func TestDecodeNotificationMessage_Compressed(t *testing.T) {
+	compressed, err := CompressBody([]byte(schemaFixtures[CurrentSchemaVersion]))
+	require.NoError(t, err)
+	require.True(t, IsCompressed(compressed))
+	msg, err := DecodeNotificationMessage(compressed)
+	require.NoError(t, err)
+	assert.Equal(t, "n-1", msg.ID)
+
+	bomb, err := CompressBody(make([]byte, MaxDecompressedBody+1))
+	require.NoError(t, err)
+	_, err = DecodeNotificationMessage(bomb)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
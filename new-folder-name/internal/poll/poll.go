@@ -0,0 +1,112 @@
+// Package poll runs the queue workers as a job rather than a daemon: each
+// run drains the queues and returns, for deployments too quiet to keep
+// consumers running. Runs are started by the process itself, on an
+// interval, or by a scheduler calling the wake endpoint.
+package poll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Exit codes of a poll-mode process. A run that found the queues empty
+// and one that drained them both exit cleanly.
+const (
+	ExitOK     = 0
+	ExitFailed = 1
+)
+
+// Queue is a queue the poller drains. Drain handles its messages until it
+// is empty and returns how many it handled.
+type Queue struct {
+	Name  string
+	Drain func(ctx context.Context) (int, error)
+}
+
+// Poller drains its queues, one run at a time.
+type Poller struct {
+	queues []Queue
+	mu     sync.Mutex
+}
+
+func New(queues ...Queue) *Poller {
+	return &Poller{queues: queues}
+}
+
+// Drain drains every queue once and returns how many messages each had. A
+// queue that fails to drain doesn't stop the others; the errors are
+// joined.
+func (p *Poller) Drain(ctx context.Context) (map[string]int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	handled := make(map[string]int, len(p.queues))
+	var errs []error
+	for _, q := range p.queues {
+		n, err := q.Drain(ctx)
+		handled[q.Name] = n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", q.Name, err))
+		}
+	}
+	return handled, errors.Join(errs...)
+}
+
+// Run drains the queues and returns the exit code. With an interval it
+// drains again on every tick until ctx is cancelled; a failed run is then
+// only logged, and the exit code is that of the first.
+func (p *Poller) Run(ctx context.Context, interval time.Duration) int {
+	code := p.run(ctx)
+	if interval <= 0 {
+		return code
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return code
+		case <-ticker.C:
+			p.run(ctx)
+		}
+	}
+}
+
+func (p *Poller) run(ctx context.Context) int {
+	handled, err := p.Drain(ctx)
+	log.Printf("poll: drained %v", handled)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("poll: %v", err)
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+// ServeHTTP is the wake endpoint: a POST drains the queues and answers
+// with how many messages each had, or a 500 when one failed.
+func (p *Poller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	handled, err := p.Drain(r.Context())
+	body := struct {
+		Handled map[string]int `json:"handled"`
+		Error   string         `json:"error,omitempty"`
+	}{Handled: handled}
+	status := http.StatusOK
+	if err != nil {
+		log.Printf("poll: %v", err)
+		body.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
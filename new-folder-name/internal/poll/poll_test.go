@@ -0,0 +1,108 @@
+package poll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backlog is a queue holding n messages; each drain takes them all.
+type backlog struct {
+	mu     sync.Mutex
+	n      int
+	drains int
+	err    error
+}
+
+func (b *backlog) add(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.n += n
+}
+
+func (b *backlog) queue(name string) Queue {
+	return Queue{Name: name, Drain: func(ctx context.Context) (int, error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drains++
+		n := b.n
+		b.n = 0
+		return n, b.err
+	}}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	email, push := &backlog{n: 3}, &backlog{}
+	p := New(email.queue("email"), push.queue("push"))
+	assert.Equal(t, ExitOK, p.Run(context.Background(), 0), "a run with messages")
+	assert.Zero(t, email.n)
+
+	assert.Equal(t, ExitOK, p.Run(context.Background(), 0), "an empty run")
+	assert.Equal(t, 2, push.drains)
+
+	push.err = errors.New("broker unreachable")
+	email.add(1)
+	assert.Equal(t, ExitFailed, p.Run(context.Background(), 0))
+	assert.Zero(t, email.n, "a failing queue doesn't stop the others")
+}
+
+func TestDrain_Counts(t *testing.T) {
+	email, push := &backlog{n: 2}, &backlog{n: 5}
+	handled, err := New(email.queue("email"), push.queue("push")).Drain(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"email": 2, "push": 5}, handled)
+}
+
+func TestRun_Interval(t *testing.T) {
+	email := &backlog{}
+	p := New(email.queue("email"))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- p.Run(ctx, 5*time.Millisecond) }()
+
+	require.Eventually(t, func() bool {
+		email.mu.Lock()
+		defer email.mu.Unlock()
+		return email.drains >= 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		assert.Equal(t, ExitOK, code)
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return once stopped")
+	}
+}
+
+func TestServeHTTP_Wake(t *testing.T) {
+	email := &backlog{n: 4}
+	p := New(email.queue("email"))
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/wake", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Handled map[string]int `json:"handled"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]int{"email": 4}, body.Handled)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/wake", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, 1, email.drains)
+
+	email.err = errors.New("broker unreachable")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/wake", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "broker unreachable")
+}
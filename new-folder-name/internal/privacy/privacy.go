@@ -0,0 +1,122 @@
+// Package privacy inventories the personal data the gateway persists. Every
+// exported field of the models carries a pii struct tag naming what kind of
+// personal data it holds; the inventory is built from those tags, so it
+// can't drift from the models.
+package privacy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TagName is the struct tag classifying a field.
+const TagName = "pii"
+
+// Categories are the values a pii tag may take. "nested" marks a field of
+// struct type whose own fields are classified.
+var Categories = map[string]string{
+	"none":       "holds no personal data",
+	"identifier": "an ID that points at a person, such as a user ID",
+	"email":      "an email address",
+	"name":       "a person's name",
+	"contact":    "a way to reach a person other than email, such as a device token",
+	"location":   "where a person is, including their timezone",
+	"preference": "a person's choices or behaviour",
+	"content":    "caller-supplied free text or values, which may hold anything",
+	"nested":     "a struct whose own fields are classified",
+}
+
+// maskedOption marks a field as stored masked or hashed: pii:"email,masked".
+const maskedOption = "masked"
+
+// Field is one classified leaf field of a persisted model.
+type Field struct {
+	// Path is the field's JSON path, with [] after lists (attachments[].url).
+	Path     string `json:"path"`
+	Category string `json:"category"`
+	Masked   bool   `json:"masked"`
+}
+
+// Store is one place the gateway persists a model.
+type Store struct {
+	Name string `json:"name"`
+	// Key is the Redis key pattern, before any tenant prefix.
+	Key        string        `json:"key"`
+	TTL        time.Duration `json:"-"`
+	TTLSeconds int64         `json:"ttl_seconds"`
+	// Model is a zero value of the stored type.
+	Model  interface{} `json:"-"`
+	Fields []Field     `json:"fields"`
+}
+
+// Inventory classifies the fields of every store's model.
+func Inventory(stores []Store) ([]Store, error) {
+	out := make([]Store, len(stores))
+	for i, store := range stores {
+		fields, err := Fields(store.Model)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", store.Name, err)
+		}
+		store.Fields = fields
+		store.TTLSeconds = int64(store.TTL / time.Second)
+		out[i] = store
+	}
+	return out, nil
+}
+
+// Fields lists the classified leaf fields of model, a struct or pointer to
+// one. It fails on an exported field without a known pii tag.
+func Fields(model interface{}) ([]Field, error) {
+	var fields []Field
+	err := walk(reflect.TypeOf(model), "", &fields)
+	return fields, err
+}
+
+func walk(t reflect.Type, prefix string, fields *[]Field) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not a struct", t)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		path := prefix + jsonName(field)
+		tag, ok := field.Tag.Lookup(TagName)
+		if !ok {
+			return fmt.Errorf("%s.%s has no %s tag", t.Name(), field.Name, TagName)
+		}
+		category, options, _ := strings.Cut(tag, ",")
+		if _, known := Categories[category]; !known {
+			return fmt.Errorf("%s.%s has unknown %s category %q", t.Name(), field.Name, TagName, category)
+		}
+		if category != "nested" {
+			*fields = append(*fields, Field{Path: path, Category: category, Masked: options == maskedOption})
+			continue
+		}
+		elem := field.Type
+		for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Slice {
+			if elem.Kind() == reflect.Slice {
+				path += "[]"
+			}
+			elem = elem.Elem()
+		}
+		if err := walk(elem, path+".", fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
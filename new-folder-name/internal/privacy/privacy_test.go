@@ -0,0 +1,68 @@
+package privacy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type contact struct {
+	Email string `json:"email" pii:"email,masked"`
+	Kind  string `json:"kind" pii:"none"`
+}
+
+type account struct {
+	ID       string    `json:"id" pii:"none"`
+	Name     string    `json:"full_name" pii:"name"`
+	Primary  *contact  `json:"primary,omitempty" pii:"nested"`
+	Others   []contact `json:"others" pii:"nested"`
+	Created  time.Time `json:"created_at" pii:"none"`
+	internal string
+}
+
+func TestFields(t *testing.T) {
+	fields, err := Fields(&account{})
+	require.NoError(t, err)
+	assert.Equal(t, []Field{
+		{Path: "id", Category: "none"},
+		{Path: "full_name", Category: "name"},
+		{Path: "primary.email", Category: "email", Masked: true},
+		{Path: "primary.kind", Category: "none"},
+		{Path: "others[].email", Category: "email", Masked: true},
+		{Path: "others[].kind", Category: "none"},
+		{Path: "created_at", Category: "none"},
+	}, fields)
+}
+
+func TestFields_RejectsUnclassifiedFields(t *testing.T) {
+	type untagged struct {
+		Phone string `json:"phone"`
+	}
+	_, err := Fields(untagged{})
+	assert.ErrorContains(t, err, "untagged.Phone has no pii tag")
+
+	type unknown struct {
+		Phone string `json:"phone" pii:"phone"`
+	}
+	_, err = Fields(unknown{})
+	assert.ErrorContains(t, err, `unknown pii category "phone"`)
+
+	type nestedUntagged struct {
+		Inner untagged `json:"inner" pii:"nested"`
+	}
+	_, err = Fields(nestedUntagged{})
+	assert.Error(t, err)
+}
+
+func TestInventory(t *testing.T) {
+	stores, err := Inventory([]Store{{Name: "accounts", Key: "account:<id>", TTL: 2 * time.Hour, Model: account{}}})
+	require.NoError(t, err)
+	require.Len(t, stores, 1)
+	assert.Equal(t, int64(7200), stores[0].TTLSeconds)
+	assert.Len(t, stores[0].Fields, 7)
+
+	_, err = Inventory([]Store{{Name: "broken", Model: struct{ X int }{}}})
+	assert.ErrorContains(t, err, "broken:")
+}
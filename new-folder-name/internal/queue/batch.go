@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultPublishWindow is used when no window is configured.
+const DefaultPublishWindow = 500
+
+// ErrConfirmChannelClosed is returned when the broker closes the channel
+// while confirms are outstanding. The publisher can't be used again.
+var ErrConfirmChannelClosed = errors.New("confirm channel closed")
+
+// ConfirmChannel is the part of *amqp.Channel batch publishing uses.
+type ConfirmChannel interface {
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// BatchResult reports which messages of a batch the broker confirmed, by
+// their index in the slice that was published. Every index is in exactly
+// one of the two lists.
+type BatchResult struct {
+	Succeeded []int `json:"succeeded"`
+	Failed    []int `json:"failed"`
+}
+
+// OK reports whether every message was confirmed.
+func (r BatchResult) OK() bool {
+	return len(r.Failed) == 0
+}
+
+// BatchPublisher publishes on a channel in confirm mode. Messages go out a
+// window at a time without waiting on each other, then the window's confirms
+// are collected by delivery tag, so a batch costs one round trip per window
+// instead of one per message.
+type BatchPublisher struct {
+	// Mandatory publishes with the mandatory flag, and Clock stamps the
+	// messages; set them before the first batch.
+	Mandatory bool
+	Clock     clock.Clock
+	// CompressAbove compresses the bodies, as for PublishOptions.
+	CompressAbove int
+
+	mu          sync.Mutex
+	channel     ConfirmChannel
+	confirms    chan amqp.Confirmation
+	exchange    string
+	environment string
+	window      int
+	// nextTag is the delivery tag the broker gives the next publish. Tags
+	// count from 1 once the channel is in confirm mode, and a publish the
+	// channel refuses doesn't use one.
+	nextTag uint64
+	closed  bool
+}
+
+// NewBatchPublisher puts channel in confirm mode. The channel must not be
+// shared: its delivery tags are counted here.
+func NewBatchPublisher(channel ConfirmChannel, exchange, environment string, window int) (*BatchPublisher, error) {
+	if window <= 0 {
+		window = DefaultPublishWindow
+	}
+	if err := channel.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to put channel in confirm mode: %w", err)
+	}
+	// room for a window abandoned on cancellation as well as the current one,
+	// so late confirms never stall the connection's reader
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 2*window))
+	return &BatchPublisher{
+		channel:     channel,
+		confirms:    confirms,
+		exchange:    exchange,
+		environment: environment,
+		Clock:       clock.System,
+		window:      window,
+		nextTag:     1,
+	}, nil
+}
+
+// PublishBatch publishes messages to routingKey and waits for the broker to
+// confirm them. A nacked or unsendable message is reported in the result's
+// Failed list without stopping the batch. The error is for failures that end
+// the batch early, such as the channel closing or ctx ending; everything not
+// confirmed by then is reported as failed.
+func (p *BatchPublisher) PublishBatch(ctx context.Context, routingKey string, messages []models.NotificationMessage) (BatchResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := BatchResult{Succeeded: []int{}, Failed: []int{}}
+	var err error
+	if p.closed {
+		err = ErrConfirmChannelClosed
+	}
+	start := 0
+	for ; err == nil && start < len(messages); start += p.window {
+		end := start + p.window
+		if end > len(messages) {
+			end = len(messages)
+		}
+		err = p.publishWindow(ctx, routingKey, messages, start, end, &result)
+	}
+	for i := start; i < len(messages); i++ {
+		result.Failed = append(result.Failed, i)
+	}
+	sort.Ints(result.Succeeded)
+	sort.Ints(result.Failed)
+	return result, err
+}
+
+// Close closes the channel.
+func (p *BatchPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.channel.Close()
+}
+
+func (p *BatchPublisher) publishWindow(ctx context.Context, routingKey string, messages []models.NotificationMessage, start, end int, result *BatchResult) error {
+	// pending maps the delivery tag of each publish to its message
+	pending := make(map[uint64]int, end-start)
+	var publishErr error
+	for i := start; i < end; i++ {
+		if publishErr != nil {
+			result.Failed = append(result.Failed, i)
+			continue
+		}
+		opts := defaultPublishOptions(messages[i])
+		opts.CompressAbove = p.CompressAbove
+		publishing, err := newPublishing(p.Clock.Now(), p.environment, messages[i], opts)
+		if err != nil {
+			result.Failed = append(result.Failed, i)
+			continue
+		}
+		if err := p.channel.PublishWithContext(ctx, p.exchange, routingKey, p.Mandatory, false, publishing); err != nil {
+			// the channel is likely gone; collect what was sent and stop
+			result.Failed = append(result.Failed, i)
+			publishErr = fmt.Errorf("failed to publish message %d: %w", i, err)
+			continue
+		}
+		pending[p.nextTag] = i
+		p.nextTag++
+	}
+
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			failPending(pending, result)
+			return ctx.Err()
+		case confirm, ok := <-p.confirms:
+			if !ok {
+				p.closed = true
+				failPending(pending, result)
+				return ErrConfirmChannelClosed
+			}
+			i, mine := pending[confirm.DeliveryTag]
+			if !mine {
+				// a late confirm for a window abandoned on cancellation
+				continue
+			}
+			delete(pending, confirm.DeliveryTag)
+			if confirm.Ack {
+				result.Succeeded = append(result.Succeeded, i)
+			} else {
+				result.Failed = append(result.Failed, i)
+			}
+		}
+	}
+	return publishErr
+}
+
+func failPending(pending map[uint64]int, result *BatchResult) {
+	for _, i := range pending {
+		result.Failed = append(result.Failed, i)
+	}
+}
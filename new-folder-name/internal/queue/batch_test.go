@@ -0,0 +1,229 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConfirmChannel acks every publish by delivery tag unless told to nack
+// it, hold it back, or refuse the publish.
+type fakeConfirmChannel struct {
+	mu         sync.Mutex
+	confirms   chan amqp.Confirmation
+	tag        uint64
+	published  []publishCall
+	nack       map[uint64]bool
+	refuse     map[int]error // by publish attempt, counting from 1
+	attempts   int
+	hold       bool
+	held       []amqp.Confirmation
+	latency    time.Duration
+	confirmErr error
+	closed     bool
+}
+
+func newFakeConfirmChannel() *fakeConfirmChannel {
+	return &fakeConfirmChannel{nack: map[uint64]bool{}, refuse: map[int]error{}}
+}
+
+func (f *fakeConfirmChannel) Confirm(noWait bool) error {
+	return f.confirmErr
+}
+
+func (f *fakeConfirmChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	f.confirms = confirm
+	return confirm
+}
+
+func (f *fakeConfirmChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if err := f.refuse[f.attempts]; err != nil {
+		return err
+	}
+	f.tag++
+	f.published = append(f.published, publishCall{exchange: exchange, key: key, msg: msg})
+	confirm := amqp.Confirmation{DeliveryTag: f.tag, Ack: !f.nack[f.tag]}
+	switch {
+	case f.hold:
+		f.held = append(f.held, confirm)
+	case f.latency > 0:
+		time.AfterFunc(f.latency, func() { f.confirms <- confirm })
+	default:
+		f.confirms <- confirm
+	}
+	return nil
+}
+
+// release delivers the held confirms and stops holding.
+func (f *fakeConfirmChannel) release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hold = false
+	for _, confirm := range f.held {
+		f.confirms <- confirm
+	}
+	f.held = nil
+}
+
+func (f *fakeConfirmChannel) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.confirms)
+	}
+	return nil
+}
+
+func batchOf(n int) []models.NotificationMessage {
+	messages := make([]models.NotificationMessage, n)
+	for i := range messages {
+		messages[i] = models.NotificationMessage{ID: fmt.Sprintf("n-%d", i), Type: "push", TenantID: "shop-a"}
+	}
+	return messages
+}
+
+func newTestBatchPublisher(t *testing.T, ch *fakeConfirmChannel, window int) *BatchPublisher {
+	t.Helper()
+	publisher, err := NewBatchPublisher(ch, "notifications.direct", "staging", window)
+	require.NoError(t, err)
+	return publisher
+}
+
+func TestPublishBatch_AllConfirmed(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	publisher := newTestBatchPublisher(t, ch, 2)
+
+	result, err := publisher.PublishBatch(context.Background(), "push.queue", batchOf(5))
+	require.NoError(t, err)
+	assert.True(t, result.OK())
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, result.Succeeded)
+	assert.Empty(t, result.Failed)
+
+	require.Len(t, ch.published, 5)
+	first := ch.published[0]
+	assert.Equal(t, "notifications.direct", first.exchange)
+	assert.Equal(t, "push.queue", first.key)
+	assert.Equal(t, "staging", first.msg.Headers[EnvironmentHeader])
+	assert.Equal(t, "shop-a", first.msg.Headers[TenantHeader])
+	assert.Equal(t, amqp.Persistent, first.msg.DeliveryMode)
+}
+
+func TestPublishBatch_PartialNack(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.nack[2] = true
+	ch.nack[5] = true
+	publisher := newTestBatchPublisher(t, ch, 10)
+
+	result, err := publisher.PublishBatch(context.Background(), "email.queue", batchOf(6))
+	require.NoError(t, err)
+	assert.False(t, result.OK())
+	assert.Equal(t, []int{0, 2, 3, 5}, result.Succeeded)
+	assert.Equal(t, []int{1, 4}, result.Failed)
+}
+
+func TestPublishBatch_NackAcrossWindows(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	publisher := newTestBatchPublisher(t, ch, 2)
+
+	// tags carry on from one batch to the next
+	_, err := publisher.PublishBatch(context.Background(), "email.queue", batchOf(3))
+	require.NoError(t, err)
+	ch.nack[6] = true
+
+	result, err := publisher.PublishBatch(context.Background(), "email.queue", batchOf(4))
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 3}, result.Succeeded)
+	assert.Equal(t, []int{2}, result.Failed)
+}
+
+func TestPublishBatch_RefusedPublishEndsBatch(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.refuse[3] = errors.New("channel/connection is not open")
+	publisher := newTestBatchPublisher(t, ch, 4)
+
+	result, err := publisher.PublishBatch(context.Background(), "email.queue", batchOf(8))
+	require.Error(t, err)
+	assert.Equal(t, []int{0, 1}, result.Succeeded)
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7}, result.Failed)
+	assert.Len(t, ch.published, 2)
+}
+
+func TestPublishBatch_ChannelClosedWhileWaiting(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.hold = true
+	publisher := newTestBatchPublisher(t, ch, 4)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ch.Close()
+	}()
+	result, err := publisher.PublishBatch(context.Background(), "email.queue", batchOf(6))
+	assert.ErrorIs(t, err, ErrConfirmChannelClosed)
+	assert.Empty(t, result.Succeeded)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, result.Failed)
+
+	_, err = publisher.PublishBatch(context.Background(), "email.queue", batchOf(1))
+	assert.ErrorIs(t, err, ErrConfirmChannelClosed)
+}
+
+func TestPublishBatch_LateConfirmsOfAnAbandonedWindow(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.hold = true
+	publisher := newTestBatchPublisher(t, ch, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result, err := publisher.PublishBatch(ctx, "email.queue", batchOf(3))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []int{0, 1, 2}, result.Failed)
+
+	// the abandoned tags 1-3 are nacked late and must not be credited to
+	// the next batch
+	ch.held[0].Ack, ch.held[1].Ack, ch.held[2].Ack = false, false, false
+	ch.release()
+	result, err = publisher.PublishBatch(context.Background(), "email.queue", batchOf(2))
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, result.Succeeded)
+	assert.Empty(t, result.Failed)
+}
+
+func TestNewBatchPublisher_ConfirmModeRefused(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.confirmErr = errors.New("not supported")
+
+	_, err := NewBatchPublisher(ch, "notifications.direct", "staging", 0)
+	assert.Error(t, err)
+}
+
+// BenchmarkPublishBatch publishes 1,000 messages against a broker that
+// confirms each publish 200µs after it is sent. A window of 1 is the
+// sequential publish-then-wait loop.
+func BenchmarkPublishBatch(b *testing.B) {
+	messages := batchOf(1000)
+	for _, window := range []int{1, 50, 500} {
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			ch := newFakeConfirmChannel()
+			ch.latency = 200 * time.Microsecond
+			publisher, err := NewBatchPublisher(ch, "notifications.direct", "staging", window)
+			require.NoError(b, err)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := publisher.PublishBatch(context.Background(), "push.queue", messages); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
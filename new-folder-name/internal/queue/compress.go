@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrUnsupportedEncoding is returned for a delivery whose content encoding
+// isn't gzip or none.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// compressAbove is the PublishOptions.CompressAbove the client publishes
+// with: off unless Config.Compression is set, and then every body when the
+// threshold isn't positive.
+func (r *RabbitMqClient) compressAbove() int {
+	if !r.Config.Compression {
+		return 0
+	}
+	return max(r.Config.CompressionThreshold, 1)
+}
+
+// deliveryBody is d's body as it was marshaled, decompressed by its
+// content encoding.
+func deliveryBody(d amqp.Delivery) ([]byte, error) {
+	switch d.ContentEncoding {
+	case "":
+		return d.Body, nil
+	case models.GzipEncoding:
+		return models.DecompressBody(d.Body)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, d.ContentEncoding)
+}
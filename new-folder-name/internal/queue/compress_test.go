@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkMessage is a notification with a variable map of about size bytes.
+func bulkMessage(id string, size int) models.NotificationMessage {
+	vars := map[string]interface{}{}
+	for i := 0; i*100 < size; i++ {
+		vars[fmt.Sprintf("line_%d", i)] = strings.Repeat(fmt.Sprintf("item %d ", i), 12)
+	}
+	return models.NotificationMessage{ID: id, Type: "email", UserID: "user123", TemplateID: "digest", Variables: vars}
+}
+
+func TestPublish_Compression(t *testing.T) {
+	cfg := reconnectConfig(0)
+	cfg.Compression = true
+	cfg.CompressionThreshold = 4096
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	ctx := context.Background()
+	large := bulkMessage("n-large", 64<<10)
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-small", TemplateID: "welcome"}))
+	require.NoError(t, client.PublishEmail(ctx, large))
+	require.Len(t, broker.messages, 2)
+	small, compressed := broker.messages[0], broker.messages[1]
+	assert.Empty(t, small.ContentEncoding)
+	assert.Equal(t, models.GzipEncoding, compressed.ContentEncoding)
+	assert.Less(t, len(compressed.Body), 16<<10)
+
+	// both kinds sit in the same queue; the worker reads them alike
+	sender := &fakeEmailSender{}
+	handler := HandleMessages(NewEmailWorker(sender, &fakeStatusRecorder{}).Handle)
+	ch := newFakeChannel(0)
+	for i, publishing := range broker.messages {
+		d := amqp.Delivery{Acknowledger: ch, DeliveryTag: uint64(i + 1), RoutingKey: "email.queue",
+			MessageId: publishing.MessageId, ContentEncoding: publishing.ContentEncoding, Body: publishing.Body}
+		assert.Equal(t, settledAcked, settle(ctx, "email.queue", handler, nil, nil, d))
+	}
+	require.Len(t, sender.sent, 2)
+	assert.Equal(t, "n-small", sender.sent[0].ID)
+	assert.Equal(t, large.Variables, sender.sent[1].Variables)
+
+	// the decode helper reads a compressed body whose encoding was lost
+	msg, err := models.DecodeNotificationMessage(compressed.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "n-large", msg.ID)
+}
+
+func TestPublish_CompressionOff(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	require.NoError(t, client.PublishEmail(context.Background(), bulkMessage("n-1", 64<<10)))
+	assert.Empty(t, broker.messages[0].ContentEncoding, "compression is opt-in")
+}
+
+func TestDeliveryBody_UnsupportedEncoding(t *testing.T) {
+	ch := newFakeChannel(0)
+	d := amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, ContentEncoding: "br", Body: []byte(`{"id":"n-1"}`)}
+	sender := &fakeEmailSender{}
+	outcome := settle(context.Background(), "email.queue", HandleMessages(NewEmailWorker(sender, &fakeStatusRecorder{}).Handle), nil, nil, d)
+	assert.Equal(t, settledRejected, outcome)
+	assert.Empty(t, sender.sent)
+
+	_, err := deliveryBody(d)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestRetry_KeepsContentEncoding(t *testing.T) {
+	ch := newFakeRetryChannel()
+	r := NewRetryDispatcher(ch, "notifications.direct", "notifications.retry", "failed.queue", nil, 3)
+	require.NoError(t, r.Retry(context.Background(), amqp.Delivery{RoutingKey: "email.queue", ContentEncoding: models.GzipEncoding}, "timeout"))
+	assert.Equal(t, models.GzipEncoding, ch.published[0].msg.ContentEncoding)
+}
+
+// BenchmarkNewPublishing shows what compression costs in CPU for what it
+// saves on the wire, by body size.
+func BenchmarkNewPublishing(b *testing.B) {
+	for _, size := range []int{4 << 10, 64 << 10, 512 << 10} {
+		msg := bulkMessage("n-1", size)
+		for _, compress := range []bool{false, true} {
+			opts := defaultPublishOptions(msg)
+			name := fmt.Sprintf("%dKiB/plain", size>>10)
+			if compress {
+				opts.CompressAbove = 1
+				name = fmt.Sprintf("%dKiB/gzip", size>>10)
+			}
+			b.Run(name, func(b *testing.B) {
+				var bodySize int
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					publishing, err := newPublishing(time.Time{}, "bench", msg, opts)
+					if err != nil {
+						b.Fatal(err)
+					}
+					bodySize = len(publishing.Body)
+				}
+				b.ReportMetric(float64(bodySize), "body-bytes")
+			})
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/franzego/stage04/pkg/clock"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrPublishNacked is returned when the broker refuses a published message.
+var ErrPublishNacked = errors.New("broker nacked message")
+
+// confirmBuffer bounds how many confirms can arrive ahead of the goroutine
+// handing them out before the connection's reader blocks.
+const confirmBuffer = 256
+
+// ConfirmPublisher publishes single messages on a channel in confirm mode and
+// waits for the broker to take each one. Publishes from concurrent callers
+// share the channel: each waits on its own delivery tag only.
+type ConfirmPublisher struct {
+	// Mandatory publishes with the mandatory flag, and Clock stamps the
+	// messages; set them before the first publish.
+	Mandatory bool
+	Clock     clock.Clock
+
+	mu          sync.Mutex
+	channel     ConfirmChannel
+	exchange    string
+	environment string
+	// nextTag is the delivery tag the broker gives the next publish, as in
+	// BatchPublisher.
+	nextTag uint64
+	waiters map[uint64]chan bool
+	closed  bool
+}
+
+// NewConfirmPublisher puts channel in confirm mode. The channel must not be
+// shared: its delivery tags are counted here.
+func NewConfirmPublisher(channel ConfirmChannel, exchange, environment string) (*ConfirmPublisher, error) {
+	if err := channel.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to put channel in confirm mode: %w", err)
+	}
+	p := &ConfirmPublisher{
+		channel:     channel,
+		exchange:    exchange,
+		environment: environment,
+		Clock:       clock.System,
+		nextTag:     1,
+		waiters:     make(map[uint64]chan bool),
+	}
+	go p.dispatch(channel.NotifyPublish(make(chan amqp.Confirmation, confirmBuffer)))
+	return p, nil
+}
+
+// Publish publishes message to routingKey and returns once the broker has
+// confirmed it. It fails with ErrPublishNacked when the broker refuses the
+// message, with ctx's error when ctx ends first, and with
+// ErrConfirmChannelClosed when the channel goes away; in every case the
+// message may or may not have been queued, and the caller must not report it
+// as queued. opts sets the message's properties.
+func (p *ConfirmPublisher) Publish(ctx context.Context, routingKey string, message interface{}, opts PublishOptions) error {
+	publishing, err := newPublishing(p.Clock.Now(), p.environment, message, opts)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrConfirmChannelClosed
+	}
+	exchange := p.exchange
+	if opts.Exchange != "" {
+		exchange = opts.Exchange
+	}
+	if err := p.channel.PublishWithContext(ctx, exchange, routingKey, p.Mandatory, false, publishing); err != nil {
+		p.mu.Unlock()
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	// registered before the lock is released, so dispatch can't see the
+	// confirm before the waiter
+	tag := p.nextTag
+	p.nextTag++
+	acked := make(chan bool, 1)
+	p.waiters[tag] = acked
+	p.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.waiters, tag)
+		p.mu.Unlock()
+		return fmt.Errorf("no confirm for message: %w", ctx.Err())
+	case ack, ok := <-acked:
+		if !ok {
+			return ErrConfirmChannelClosed
+		}
+		if !ack {
+			return ErrPublishNacked
+		}
+		return nil
+	}
+}
+
+// Close closes the channel.
+func (p *ConfirmPublisher) Close() error {
+	return p.channel.Close()
+}
+
+// dispatch hands each confirm to the publish waiting on its tag. Confirms
+// for publishes that stopped waiting are dropped. Once the channel closes,
+// every publish still waiting is failed.
+func (p *ConfirmPublisher) dispatch(confirms <-chan amqp.Confirmation) {
+	for confirm := range confirms {
+		p.mu.Lock()
+		acked, ok := p.waiters[confirm.DeliveryTag]
+		delete(p.waiters, confirm.DeliveryTag)
+		p.mu.Unlock()
+		if ok {
+			acked <- confirm.Ack
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for tag, acked := range p.waiters {
+		close(acked)
+		delete(p.waiters, tag)
+	}
+}
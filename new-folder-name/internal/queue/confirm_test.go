@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfirmPublisher(t *testing.T, ch *fakeConfirmChannel) *ConfirmPublisher {
+	t.Helper()
+	publisher, err := NewConfirmPublisher(ch, "notifications.direct", "staging")
+	require.NoError(t, err)
+	return publisher
+}
+
+func TestConfirmPublisher_Acked(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	publisher := newTestConfirmPublisher(t, ch)
+
+	msg := models.NotificationMessage{ID: "n-1", Type: "email", TenantID: "shop-a"}
+	require.NoError(t, publisher.Publish(context.Background(), "email.queue", msg, PublishOptions{}))
+
+	require.Len(t, ch.published, 1)
+	assert.Equal(t, "notifications.direct", ch.published[0].exchange)
+	assert.Equal(t, "email.queue", ch.published[0].key)
+	assert.Equal(t, "staging", ch.published[0].msg.Headers[EnvironmentHeader])
+	assert.Equal(t, "shop-a", ch.published[0].msg.Headers[TenantHeader])
+	assert.Equal(t, "n-1", ch.published[0].msg.MessageId)
+	assert.Equal(t, "email", ch.published[0].msg.Headers[NotificationTypeHeader])
+}
+
+func TestConfirmPublisher_Nacked(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.nack[2] = true
+	publisher := newTestConfirmPublisher(t, ch)
+
+	assert.NoError(t, publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-1"}, PublishOptions{}))
+	assert.ErrorIs(t, publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-2"}, PublishOptions{}), ErrPublishNacked)
+	assert.NoError(t, publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-3"}, PublishOptions{}))
+}
+
+func TestConfirmPublisher_Timeout(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.hold = true
+	publisher := newTestConfirmPublisher(t, ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := publisher.Publish(ctx, "email.queue", models.NotificationMessage{ID: "n-1"}, PublishOptions{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the late confirm for tag 1 is dropped, not credited to the next publish
+	ch.held[0].Ack = false
+	ch.release()
+	assert.NoError(t, publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-2"}, PublishOptions{}))
+}
+
+func TestConfirmPublisher_ConcurrentPublishesWaitOnTheirOwnTags(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.hold = true
+	ch.nack[1] = true
+	publisher := newTestConfirmPublisher(t, ch)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-1"}, PublishOptions{})
+	}()
+	require.Eventually(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return len(ch.held) == 1
+	}, time.Second, time.Millisecond)
+	go func() {
+		errs <- publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-2"}, PublishOptions{})
+	}()
+	require.Eventually(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return len(ch.held) == 2
+	}, time.Second, time.Millisecond)
+	ch.release()
+
+	results := []error{<-errs, <-errs}
+	assert.Contains(t, results, error(nil))
+	assert.True(t, errors.Is(results[0], ErrPublishNacked) || errors.Is(results[1], ErrPublishNacked))
+}
+
+func TestConfirmPublisher_ChannelClosedWhileWaiting(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.hold = true
+	publisher := newTestConfirmPublisher(t, ch)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ch.Close()
+	}()
+	err := publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-1"}, PublishOptions{})
+	assert.ErrorIs(t, err, ErrConfirmChannelClosed)
+
+	err = publisher.Publish(context.Background(), "email.queue", models.NotificationMessage{ID: "n-2"}, PublishOptions{})
+	assert.ErrorIs(t, err, ErrConfirmChannelClosed)
+}
+
+func TestNewConfirmPublisher_ConfirmModeRefused(t *testing.T) {
+	ch := newFakeConfirmChannel()
+	ch.confirmErr = errors.New("not supported")
+
+	_, err := NewConfirmPublisher(ch, "notifications.direct", "staging")
+	assert.Error(t, err)
+}
@@ -0,0 +1,302 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultDrainTimeout bounds how long shutdown waits for the broker to close
+// the delivery stream after the consumer is cancelled.
+const defaultDrainTimeout = 5 * time.Second
+
+// ErrDeliveriesClosed is returned by Run when the broker closes the delivery
+// stream without a shutdown being requested.
+var ErrDeliveriesClosed = errors.New("delivery channel closed by broker")
+
+// ConsumerChannel is the subset of *amqp.Channel used by Consumer.
+type ConsumerChannel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Close() error
+}
+
+// DeliveryHandler processes one delivery. A nil error acks it; a transient
+// error (see Transient) has it tried again, by Consumer.Retrier or else by
+// a nack with requeue, once; and any other error, or a transient one on
+// the last attempt, rejects it (see Consumer.Rejecter).
+type DeliveryHandler func(ctx context.Context, d amqp.Delivery) error
+
+// FailedReasonHeader carries why a rejected delivery failed.
+const FailedReasonHeader = "x-failed-reason"
+
+// Rejecter parks deliveries that failed permanently.
+type Rejecter interface {
+	Reject(ctx context.Context, d amqp.Delivery, reason string) error
+}
+
+// Retrier schedules another attempt at deliveries that failed transiently.
+// RetryDispatcher implements it.
+type Retrier interface {
+	// Retry republishes d for a later attempt, or parks it with reason once
+	// it is out of attempts.
+	Retry(ctx context.Context, d amqp.Delivery, reason string) error
+	// LastAttempt reports whether Retry would park d.
+	LastAttempt(d amqp.Delivery) bool
+}
+
+// transientError marks a failure worth retrying.
+type transientError struct{ err error }
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+// Transient marks err as worth retrying: the delivery is requeued rather
+// than dead-lettered.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err}
+}
+
+// IsTransient reports whether err, or an error it wraps, was marked with
+// Transient.
+func IsTransient(err error) bool {
+	var transient transientError
+	return errors.As(err, &transient)
+}
+
+// Consumer runs a handler over a queue with bounded concurrency and drains
+// cleanly on shutdown: consumption is cancelled first, deliveries that were
+// prefetched but not started are requeued straight away so another worker
+// can take them, in-flight ones are finished, and only then is the channel
+// closed.
+type Consumer struct {
+	channel      ConsumerChannel
+	queue        string
+	tag          string
+	prefetch     int
+	workers      int
+	handler      DeliveryHandler
+	drainTimeout time.Duration
+	// Rejecter, when set, is handed every rejected delivery, with the error
+	// as the reason, and the delivery is then acked. Without it rejected
+	// deliveries are nacked without requeue, so the broker dead-letters
+	// them, with x-death, or drops them if the queue has no dead-letter
+	// exchange.
+	Rejecter Rejecter
+	// Retrier, when set, is handed every delivery that failed transiently,
+	// which is acked once republished. It counts the attempts in the
+	// message's headers, where the broker only tells a redelivery, so a
+	// poison message is retried a bounded number of times with a backoff
+	// rather than requeued once and rejected.
+	Retrier Retrier
+	// Metrics, when set, counts the deliveries by how they were settled.
+	Metrics *Metrics
+	// PrefetchGlobal applies the prefetch limit to the whole channel
+	// rather than to this consumer.
+	PrefetchGlobal bool
+
+	requeuedOnShutdown atomic.Uint64
+}
+
+// NewConsumer returns a consumer running up to workers deliveries at once,
+// with at most prefetch unacked, those running included; prefetch 0 uses
+// workers. A prefetch below workers leaves workers idle.
+func NewConsumer(channel ConsumerChannel, queue, tag string, prefetch, workers int, handler DeliveryHandler) *Consumer {
+	if workers <= 0 {
+		workers = 1
+	}
+	if prefetch <= 0 {
+		prefetch = workers
+	}
+	return &Consumer{
+		channel:      channel,
+		queue:        queue,
+		tag:          tag,
+		prefetch:     prefetch,
+		workers:      workers,
+		handler:      handler,
+		drainTimeout: defaultDrainTimeout,
+	}
+}
+
+// Run consumes until ctx is cancelled, then drains and closes the channel.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.channel.Qos(c.prefetch, 0, c.PrefetchGlobal); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	deliveries, err := c.channel.Consume(c.queue, c.tag, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start consuming %s: %w", c.queue, err)
+	}
+
+	// In-flight work must finish even though ctx is the shutdown signal
+	workCtx := context.WithoutCancel(ctx)
+	var inFlight sync.WaitGroup
+	sem := make(chan struct{}, c.workers)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return c.drain(deliveries, &inFlight)
+		case d, ok := <-deliveries:
+			if !ok {
+				inFlight.Wait()
+				return ErrDeliveriesClosed
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return c.drain(deliveries, &inFlight, d)
+			}
+			inFlight.Add(1)
+			go func(d amqp.Delivery) {
+				defer inFlight.Done()
+				defer func() { <-sem }()
+				c.process(workCtx, d)
+			}(d)
+		}
+	}
+}
+
+// RequeuedOnShutdown is the number of prefetched deliveries handed back to
+// the broker by drains since startup.
+func (c *Consumer) RequeuedOnShutdown() uint64 {
+	return c.requeuedOnShutdown.Load()
+}
+
+func (c *Consumer) process(ctx context.Context, d amqp.Delivery) {
+	c.Metrics.observeConsume(c.queue, settle(ctx, c.queue, c.handler, c.Rejecter, c.Retrier, d))
+}
+
+// How settle left a delivery.
+const (
+	settledAcked    = "acked"
+	settledRequeued = "requeued"
+	settledRejected = "rejected"
+	settledRetried  = "retried"
+)
+
+// settle runs handler over d, taken from queueName, and acks, requeues,
+// retries or rejects it by the outcome, as Consumer documents. It returns
+// which. The handler is told through ctx when d is on its last attempt.
+func settle(ctx context.Context, queueName string, handler DeliveryHandler, rejecter Rejecter, retrier Retrier, d amqp.Delivery) string {
+	last := d.Redelivered
+	if retrier != nil {
+		last = retrier.LastAttempt(d)
+	}
+	if last {
+		ctx = withLastAttempt(ctx)
+	}
+	if err := handler(ctx, d); err != nil {
+		log.Printf("failed to process message %s from %s: %v", d.MessageId, queueName, err)
+		if IsTransient(err) && retrier != nil {
+			return retry(ctx, retrier, d, err, last)
+		}
+		// The broker only says whether a delivery was seen before, so the
+		// retry budget is a single requeue
+		requeue := IsTransient(err) && !d.Redelivered
+		if IsTransient(err) && d.Redelivered {
+			log.Printf("message %s from %s failed again after a requeue, rejecting it", d.MessageId, queueName)
+		}
+		if !requeue && rejecter != nil {
+			return reject(ctx, rejecter, d, err)
+		}
+		if err := d.Nack(false, requeue); err != nil {
+			log.Printf("failed to nack message %s: %v", d.MessageId, err)
+		}
+		if requeue {
+			return settledRequeued
+		}
+		return settledRejected
+	}
+	if err := d.Ack(false); err != nil {
+		log.Printf("failed to ack message %s: %v", d.MessageId, err)
+	}
+	return settledAcked
+}
+
+// retry hands d to retrier and acks it once republished, so it is never
+// both retried and redelivered. If it can't be republished it is requeued.
+func retry(ctx context.Context, retrier Retrier, d amqp.Delivery, cause error, last bool) string {
+	if err := retrier.Retry(ctx, d, cause.Error()); err != nil {
+		log.Printf("failed to retry message %s: %v", d.MessageId, err)
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("failed to nack message %s: %v", d.MessageId, err)
+		}
+		return settledRequeued
+	}
+	if err := d.Ack(false); err != nil {
+		log.Printf("failed to ack message %s: %v", d.MessageId, err)
+	}
+	if last {
+		log.Printf("message %s out of retries, parked in the failed queue", d.MessageId)
+		return settledRejected
+	}
+	return settledRetried
+}
+
+// reject parks d with rejecter and acks it. If it can't be parked it is
+// requeued, so nothing is dropped while the broker is unwell.
+func reject(ctx context.Context, rejecter Rejecter, d amqp.Delivery, cause error) string {
+	if err := rejecter.Reject(ctx, d, cause.Error()); err != nil {
+		log.Printf("failed to reject message %s: %v", d.MessageId, err)
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("failed to nack message %s: %v", d.MessageId, err)
+		}
+		return settledRequeued
+	}
+	if err := d.Ack(false); err != nil {
+		log.Printf("failed to ack message %s: %v", d.MessageId, err)
+	}
+	return settledRejected
+}
+
+// drain stops consumption and requeues pending, a delivery received but not
+// started, along with everything else still prefetched.
+func (c *Consumer) drain(deliveries <-chan amqp.Delivery, inFlight *sync.WaitGroup, pending ...amqp.Delivery) error {
+	if err := c.channel.Cancel(c.tag, false); err != nil {
+		log.Printf("failed to cancel consumer %s: %v", c.tag, err)
+	}
+	for _, d := range pending {
+		c.requeue(d)
+	}
+
+	// After a cancel the broker sends nothing new and the client closes the
+	// stream once the prefetched deliveries have been read
+	timeout := time.NewTimer(c.drainTimeout)
+	defer timeout.Stop()
+drain:
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				break drain
+			}
+			c.requeue(d)
+		case <-timeout.C:
+			log.Printf("delivery stream for %s still open after %s, closing anyway", c.tag, c.drainTimeout)
+			break drain
+		}
+	}
+
+	inFlight.Wait()
+	return c.channel.Close()
+}
+
+func (c *Consumer) requeue(d amqp.Delivery) {
+	if err := d.Nack(false, true); err != nil {
+		log.Printf("failed to requeue message %s: %v", d.MessageId, err)
+		return
+	}
+	c.requeuedOnShutdown.Add(1)
+}
@@ -0,0 +1,281 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChannel records the calls made on it and the outcome of every delivery
+type fakeChannel struct {
+	mu         sync.Mutex
+	deliveries chan amqp.Delivery
+	events     []string
+	outcomes   map[uint64]string
+	// prefetchCount and prefetchGlobal are the last Qos call's.
+	prefetchCount  int
+	prefetchGlobal bool
+}
+
+func newFakeChannel(n int) *fakeChannel {
+	ch := &fakeChannel{
+		deliveries: make(chan amqp.Delivery, n),
+		outcomes:   make(map[uint64]string),
+	}
+	for tag := uint64(1); tag <= uint64(n); tag++ {
+		ch.deliveries <- amqp.Delivery{Acknowledger: ch, DeliveryTag: tag}
+	}
+	return ch
+}
+
+func (f *fakeChannel) record(event string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func (f *fakeChannel) settle(tag uint64, outcome string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if prev, ok := f.outcomes[tag]; ok {
+		f.outcomes[tag] = prev + "+" + outcome
+	} else {
+		f.outcomes[tag] = outcome
+	}
+	f.events = append(f.events, outcome)
+	return nil
+}
+
+func (f *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	f.mu.Lock()
+	f.prefetchCount, f.prefetchGlobal = prefetchCount, global
+	f.mu.Unlock()
+	f.record("qos")
+	return nil
+}
+
+// qos returns the last Qos call's prefetch, once consumption started.
+func (f *fakeChannel) qos() (count int, global bool, consuming bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, event := range f.events {
+		if event == "consume" {
+			consuming = true
+		}
+	}
+	return f.prefetchCount, f.prefetchGlobal, consuming
+}
+
+func (f *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	f.record("consume")
+	return f.deliveries, nil
+}
+
+func (f *fakeChannel) Cancel(consumer string, noWait bool) error {
+	f.record("cancel")
+	close(f.deliveries)
+	return nil
+}
+
+func (f *fakeChannel) Close() error {
+	f.record("close")
+	return nil
+}
+
+func (f *fakeChannel) Ack(tag uint64, multiple bool) error {
+	return f.settle(tag, "ack")
+}
+
+func (f *fakeChannel) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return f.settle(tag, "requeue")
+	}
+	return f.settle(tag, "nack")
+}
+
+func (f *fakeChannel) Reject(tag uint64, requeue bool) error {
+	return f.Nack(tag, false, requeue)
+}
+
+func TestConsumer_ShutdownCancelsFinishesAndRequeues(t *testing.T) {
+	ch := newFakeChannel(4)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	consumer := NewConsumer(ch, "email.queue", "worker-1", 4, 1, func(ctx context.Context, d amqp.Delivery) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+
+	// Delivery 1 is in flight, 2-4 are prefetched behind it
+	<-started
+	cancel()
+
+	// The prefetched deliveries go back before the in-flight one finishes
+	assert.Eventually(t, func() bool { return consumer.RequeuedOnShutdown() == 3 }, time.Second, 5*time.Millisecond)
+	close(release)
+	assert.NoError(t, <-done)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	assert.Equal(t, map[uint64]string{1: "ack", 2: "requeue", 3: "requeue", 4: "requeue"}, ch.outcomes)
+	assert.Equal(t, []string{"qos", "consume", "cancel", "requeue", "requeue", "requeue", "ack", "close"}, ch.events)
+}
+
+func TestConsumer_HandlerErrorDeadLetters(t *testing.T) {
+	ch := newFakeChannel(2)
+
+	processed := make(chan struct{}, 2)
+	consumer := NewConsumer(ch, "email.queue", "worker-1", 2, 2, func(ctx context.Context, d amqp.Delivery) error {
+		defer func() { processed <- struct{}{} }()
+		if d.DeliveryTag == 2 {
+			return assert.AnError
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+
+	<-processed
+	<-processed
+	cancel()
+	assert.NoError(t, <-done)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	assert.Equal(t, map[uint64]string{1: "ack", 2: "nack"}, ch.outcomes)
+	assert.Zero(t, consumer.RequeuedOnShutdown())
+}
+
+func TestConsumer_TransientErrorRequeues(t *testing.T) {
+	ch := newFakeChannel(1)
+
+	processed := make(chan struct{}, 1)
+	consumer := NewConsumer(ch, "email.queue", "worker-1", 1, 1, func(ctx context.Context, d amqp.Delivery) error {
+		defer func() { processed <- struct{}{} }()
+		return fmt.Errorf("smtp: %w", Transient(assert.AnError))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+
+	<-processed
+	cancel()
+	assert.NoError(t, <-done)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	assert.Equal(t, map[uint64]string{1: "requeue"}, ch.outcomes)
+	// a handler requeue is not a shutdown requeue
+	assert.Zero(t, consumer.RequeuedOnShutdown())
+}
+
+func TestConsumer_TransientErrorOnRedeliveryRejects(t *testing.T) {
+	ch := &fakeChannel{deliveries: make(chan amqp.Delivery, 1), outcomes: make(map[uint64]string)}
+	ch.deliveries <- amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, Redelivered: true}
+
+	processed := make(chan struct{}, 1)
+	consumer := NewConsumer(ch, "email.queue", "worker-1", 1, 1, func(ctx context.Context, d amqp.Delivery) error {
+		defer func() { processed <- struct{}{} }()
+		return Transient(assert.AnError)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+
+	<-processed
+	cancel()
+	assert.NoError(t, <-done)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	// the retry budget is spent: dead-lettered rather than requeued again
+	assert.Equal(t, map[uint64]string{1: "nack"}, ch.outcomes)
+}
+
+func TestConsumer_Qos(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		prefetch, workers int
+		global            bool
+		want              int
+	}{
+		{"configured", 10, 2, true, 10},
+		{"below the workers", 1, 4, false, 1},
+		{"unset uses the workers", 0, 3, false, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := newFakeChannel(0)
+			consumer := NewConsumer(ch, "email.queue", "worker-1", tc.prefetch, tc.workers, nil)
+			consumer.PrefetchGlobal = tc.global
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			assert.NoError(t, consumer.Run(ctx))
+
+			count, global, _ := ch.qos()
+			assert.Equal(t, tc.want, count)
+			assert.Equal(t, tc.global, global)
+		})
+	}
+}
+
+func TestConsume_PrefetchReappliedOnResubscribe(t *testing.T) {
+	broker := &fakeBroker{}
+	cfg := reconnectConfig(0)
+	cfg.PrefetchCount = 25
+	cfg.PrefetchGlobal = true
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+	channels := make(chan *fakeChannel, 2)
+	client.openConsumerChannel = func() (ConsumerChannel, error) {
+		ch := newFakeChannel(0)
+		channels <- ch
+		return ch, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.ConsumeEmail(ctx, 4, func(context.Context, models.NotificationMessage) error { return nil })
+	}()
+	subscribed := func(ch *fakeChannel) (int, bool) {
+		require.Eventually(t, func() bool {
+			_, _, consuming := ch.qos()
+			return consuming
+		}, time.Second, time.Millisecond)
+		count, global, _ := ch.qos()
+		return count, global
+	}
+
+	first := <-channels
+	count, global := subscribed(first)
+	assert.Equal(t, 25, count, "the prefetch is independent of the 4 workers")
+	assert.True(t, global)
+
+	// the broker closes the channel; the new one gets the new prefetch
+	client.SetPrefetch(50, false)
+	close(first.deliveries)
+	count, global = subscribed(<-channels)
+	assert.Equal(t, 50, count)
+	assert.False(t, global)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
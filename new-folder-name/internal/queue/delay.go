@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DelayHeader is the delay, in milliseconds, the delayed-message plugin
+// holds a message for.
+const DelayHeader = "x-delay"
+
+// delayedMessageExchange is the exchange type of the delayed-message plugin.
+const delayedMessageExchange = "x-delayed-message"
+
+// maxPluginDelay is the longest delay the plugin honours; it keeps x-delay
+// in 32 bits.
+const maxPluginDelay = (1<<32 - 1) * time.Millisecond
+
+// ErrNoDelayExchange is returned by PublishDelayed when no delay exchange is
+// configured.
+var ErrNoDelayExchange = errors.New("rabbitmq.delay_exchange is not set")
+
+// declareDelayTopology declares where delayed messages wait. Nothing is
+// declared without a delay exchange.
+//
+// With the TTL hop, the delay exchange fans every message out to the delay
+// queue, which has no consumers: each message sits there until its
+// per-message TTL runs out and is dead-lettered to the working exchange
+// under its original routing key. RabbitMQ only expires messages at the
+// head of a queue, so a message waits at least as long as every message
+// published before it; a short delay behind a long one is delivered late.
+// Expiry is to the millisecond otherwise, give or take the broker's
+// scheduling.
+//
+// With the plugin, the delay exchange routes like the working exchange,
+// direct or topic, once each message's x-delay is over, so delays are independent of each other.
+// The plugin keeps waiting messages on one node, not replicated, and caps
+// delays at about 49 days.
+func (r *RabbitMqClient) declareDelayTopology(channel amqpChannel, workQueues []string) error {
+	exchange := r.Config.DelayExchange
+	if exchange == "" {
+		return nil
+	}
+	if r.Config.DelayedExchange {
+		if err := channel.ExchangeDeclare(exchange, delayedMessageExchange, true, false, false, false,
+			amqp.Table{"x-delayed-type": r.exchangeKind()}); err != nil {
+			return fmt.Errorf("failed to declare delayed-message exchange %s (needs the rabbitmq_delayed_message_exchange plugin): %w", exchange, err)
+		}
+		for _, queueName := range workQueues {
+			if queueName == "" {
+				continue
+			}
+			for _, key := range r.bindingKeys(queueName) {
+				if err := channel.QueueBind(queueName, key, exchange, false, nil); err != nil {
+					return fmt.Errorf("failed to bind queue %s to %s: %w", queueName, exchange, err)
+				}
+			}
+		}
+		return nil
+	}
+	if err := channel.ExchangeDeclare(exchange, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare delay exchange %s: %w", exchange, err)
+	}
+	args := r.queueArgs(amqp.Table{"x-dead-letter-exchange": r.Config.Exchange})
+	if _, err := channel.QueueDeclare(r.Config.DelayQueue, true, false, false, false, args); err != nil {
+		return queueDeclareError(r.Config.DelayQueue, args, err)
+	}
+	if err := channel.QueueBind(r.Config.DelayQueue, "", exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s: %w", r.Config.DelayQueue, err)
+	}
+	return nil
+}
+
+// PublishDelayed publishes message to routingKey to be delivered after
+// delay, through the delay exchange; see declareDelayTopology for how
+// precise that is. A delay of zero or less publishes at once.
+//
+// With the TTL hop the delay is the message's expiration, so a
+// notification's own expiry can't be set as well: the broker drops the
+// expiration when it dead-letters the message, and a delayed notification
+// doesn't expire.
+func (r *RabbitMqClient) PublishDelayed(ctx context.Context, routingKey string, message interface{}, delay time.Duration) error {
+	if delay <= 0 {
+		return r.Publish(ctx, routingKey, message)
+	}
+	if r.Config.DelayExchange == "" {
+		return ErrNoDelayExchange
+	}
+	opts := defaultPublishOptions(message)
+	opts.Exchange = r.Config.DelayExchange
+	if r.Config.DelayedExchange {
+		if delay > maxPluginDelay {
+			return fmt.Errorf("delay %s is longer than the delayed-message exchange allows", delay)
+		}
+		opts.Headers = amqp.Table{DelayHeader: max(delay.Milliseconds(), 1)}
+	} else {
+		opts.Expiration = delay
+	}
+	return r.PublishWithOptions(ctx, routingKey, message, opts)
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func delayConfig(plugin bool) config.RabbitMQConfig {
+	cfg := reconnectConfig(0)
+	cfg.DelayExchange = "notifications.delay"
+	cfg.DelayQueue = "delay.queue"
+	cfg.DelayedExchange = plugin
+	return cfg
+}
+
+func TestPublishDelayed_TTLHop(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(delayConfig(false), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	assert.Equal(t, amqp.ExchangeFanout, broker.exchangeKinds["notifications.delay"])
+	assert.Equal(t, amqp.Table{"x-dead-letter-exchange": "notifications.direct"}, broker.queueArgs["delay.queue"])
+	assert.Equal(t, []string{"delay.queue"}, broker.bindings["notifications.delay"])
+
+	msg := models.NotificationMessage{ID: "n-1", Priority: "high", ExpiresInSeconds: 60, TenantID: "acme"}
+	require.NoError(t, client.PublishDelayed(context.Background(), "email.queue", msg, 90*time.Minute))
+
+	require.Len(t, broker.messages, 1)
+	assert.Equal(t, "notifications.delay", broker.publishedTo[0])
+	assert.Equal(t, "email.queue", broker.published[0], "the routing key survives the dead-letter hop")
+	published := broker.messages[0]
+	assert.Equal(t, "5400000", published.Expiration, "the delay is the TTL, not the notification's expiry")
+	assert.Equal(t, HighPriority, published.Priority)
+	assert.Equal(t, "acme", published.Headers[TenantHeader])
+	assert.NotContains(t, published.Headers, DelayHeader)
+}
+
+func TestPublishDelayed_Plugin(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(delayConfig(true), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	assert.Equal(t, "x-delayed-message", broker.exchangeKinds["notifications.delay"])
+	assert.ElementsMatch(t, []string{"email.queue", "push.queue"}, broker.bindings["notifications.delay"])
+	assert.NotContains(t, broker.queueArgs, "delay.queue")
+
+	msg := models.NotificationMessage{ID: "n-1", ExpiresInSeconds: 60}
+	require.NoError(t, client.PublishDelayed(context.Background(), "push.queue", msg, 1500*time.Millisecond))
+
+	require.Len(t, broker.messages, 1)
+	assert.Equal(t, "notifications.delay", broker.publishedTo[0])
+	assert.Equal(t, "push.queue", broker.published[0])
+	published := broker.messages[0]
+	assert.Equal(t, int64(1500), published.Headers[DelayHeader])
+	assert.Equal(t, "60000", published.Expiration, "the notification's expiry is kept")
+
+	err = client.PublishDelayed(context.Background(), "push.queue", msg, 60*24*time.Hour)
+	assert.Error(t, err, "longer than the plugin allows")
+}
+
+func TestPublishDelayed_NotDue(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(delayConfig(false), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	require.NoError(t, client.PublishDelayed(context.Background(), "email.queue", models.NotificationMessage{ID: "n-1"}, 0))
+
+	require.Len(t, broker.messages, 1)
+	assert.Equal(t, "notifications.direct", broker.publishedTo[0])
+	assert.Empty(t, broker.messages[0].Expiration)
+}
+
+func TestPublishDelayed_NoDelayExchange(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	err = client.PublishDelayed(context.Background(), "email.queue", models.NotificationMessage{ID: "n-1"}, time.Minute)
+	assert.ErrorIs(t, err, ErrNoDelayExchange)
+	assert.Empty(t, broker.messages)
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// GetChannel is the subset of *amqp.Channel used by Drain.
+type GetChannel interface {
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+}
+
+// Drain takes messages from queueName one at a time with basic.get and
+// runs handler over each, settling them as a Consumer would, until the
+// queue is empty or ctx is cancelled. It returns how many it handled. A
+// message requeued after a transient failure is taken again in the same
+// drain, and rejected if it fails again.
+func Drain(ctx context.Context, channel GetChannel, queueName string, handler DeliveryHandler) (int, error) {
+	// a message taken is finished even if ctx is cancelled meanwhile
+	workCtx := context.WithoutCancel(ctx)
+	handled := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return handled, err
+		}
+		d, ok, err := channel.Get(queueName, false)
+		if err != nil {
+			return handled, fmt.Errorf("failed to get from %s: %w", queueName, err)
+		}
+		if !ok {
+			return handled, nil
+		}
+		settle(workCtx, queueName, handler, nil, nil, d)
+		handled++
+	}
+}
+
+// drain runs Drain over queueName on a channel of its own, once the client
+// is connected.
+func (r *RabbitMqClient) drain(ctx context.Context, queueName string, handler MessageHandler) (int, error) {
+	if err := r.awaitConnection(ctx); err != nil {
+		return 0, err
+	}
+	channel, err := r.openChannel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open a channel to drain %s: %w", queueName, err)
+	}
+	defer channel.Close()
+	return Drain(ctx, channel, queueName, r.decoder().HandleMessages(handler))
+}
+
+// DrainEmail runs handler over the email queue until it is empty. It is
+// the poll-mode counterpart of ConsumeEmail.
+func (r *RabbitMqClient) DrainEmail(ctx context.Context, handler MessageHandler) (int, error) {
+	return r.drain(ctx, r.Config.EmailQueue, handler)
+}
+
+// DrainPush runs handler over the push queue until it is empty. It is the
+// poll-mode counterpart of ConsumePush.
+func (r *RabbitMqClient) DrainPush(ctx context.Context, handler MessageHandler) (int, error) {
+	return r.drain(ctx, r.Config.PushQueue, handler)
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueue is a queue served by basic.get. Requeued messages go back to
+// the front, redelivered, as the broker does.
+type fakeQueue struct {
+	mu       sync.Mutex
+	ready    []amqp.Delivery
+	nextTag  uint64
+	unacked  map[uint64]amqp.Delivery
+	outcomes map[string][]string
+	getErr   error
+}
+
+func newFakeQueue(t *testing.T, msgs ...models.NotificationMessage) *fakeQueue {
+	q := &fakeQueue{unacked: map[uint64]amqp.Delivery{}, outcomes: map[string][]string{}}
+	for _, msg := range msgs {
+		body, err := json.Marshal(msg)
+		require.NoError(t, err)
+		q.ready = append(q.ready, amqp.Delivery{MessageId: msg.ID, Body: body})
+	}
+	return q
+}
+
+func (q *fakeQueue) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.getErr != nil {
+		return amqp.Delivery{}, false, q.getErr
+	}
+	if len(q.ready) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+	d := q.ready[0]
+	q.ready = q.ready[1:]
+	q.nextTag++
+	d.DeliveryTag, d.Acknowledger = q.nextTag, q
+	q.unacked[d.DeliveryTag] = d
+	return d, true, nil
+}
+
+func (q *fakeQueue) settle(tag uint64, outcome string, requeue bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := q.unacked[tag]
+	delete(q.unacked, tag)
+	q.outcomes[d.MessageId] = append(q.outcomes[d.MessageId], outcome)
+	if requeue {
+		d.Redelivered = true
+		q.ready = append([]amqp.Delivery{d}, q.ready...)
+	}
+	return nil
+}
+
+func (q *fakeQueue) Ack(tag uint64, multiple bool) error { return q.settle(tag, "ack", false) }
+func (q *fakeQueue) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return q.settle(tag, "requeue", true)
+	}
+	return q.settle(tag, "nack", false)
+}
+func (q *fakeQueue) Reject(tag uint64, requeue bool) error { return q.settle(tag, "reject", requeue) }
+
+// flakySender fails the messages named in fail, transiently or not.
+type flakySender struct {
+	fail map[string]error
+	sent []string
+}
+
+func (f *flakySender) SendEmail(ctx context.Context, msg models.NotificationMessage) error {
+	f.sent = append(f.sent, msg.ID)
+	return f.fail[msg.ID]
+}
+
+func TestDrain_SeededBacklog(t *testing.T) {
+	q := newFakeQueue(t,
+		models.NotificationMessage{ID: "n-1", Type: "email"},
+		models.NotificationMessage{ID: "n-2", Type: "email"},
+		models.NotificationMessage{ID: "n-3", Type: "email"},
+		models.NotificationMessage{ID: "n-4", Type: "email"},
+	)
+	sender := &flakySender{fail: map[string]error{
+		"n-2": Transient(errors.New("smtp timeout")),
+		"n-3": errors.New("mailbox does not exist"),
+	}}
+	status := &fakeStatusRecorder{}
+	worker := NewEmailWorker(sender, status)
+
+	handled, err := Drain(context.Background(), q, "email.queue", HandleMessages(worker.Handle))
+	require.NoError(t, err)
+
+	assert.Empty(t, q.ready, "the queue is drained")
+	assert.Empty(t, q.unacked, "every message is settled")
+	assert.Equal(t, 5, handled, "n-2 is taken again after its requeue")
+	assert.Equal(t, []string{"n-1", "n-2", "n-2", "n-3", "n-4"}, sender.sent)
+	assert.Equal(t, map[string][]string{
+		"n-1": {"ack"},
+		"n-2": {"requeue", "nack"},
+		"n-3": {"nack"},
+		"n-4": {"ack"},
+	}, q.outcomes)
+	assert.Contains(t, status.statuses, "sent")
+	assert.Contains(t, status.statuses, "failed")
+}
+
+func TestDrain_Empty(t *testing.T) {
+	handled, err := Drain(context.Background(), newFakeQueue(t), "email.queue", func(ctx context.Context, d amqp.Delivery) error {
+		t.Fatal("nothing to handle")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Zero(t, handled)
+}
+
+func TestDrain_Stops(t *testing.T) {
+	q := newFakeQueue(t, models.NotificationMessage{ID: "n-1"}, models.NotificationMessage{ID: "n-2"})
+	ctx, cancel := context.WithCancel(context.Background())
+	handled, err := Drain(ctx, q, "email.queue", func(ctx context.Context, d amqp.Delivery) error {
+		cancel()
+		assert.NoError(t, ctx.Err(), "a message taken is finished")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, handled)
+	assert.Len(t, q.ready, 1, "the rest stay on the queue")
+
+	q.getErr = errors.New("channel closed")
+	_, err = Drain(context.Background(), q, "email.queue", HandleMessages(func(ctx context.Context, msg models.NotificationMessage) error { return nil }))
+	assert.ErrorContains(t, err, "channel closed")
+}
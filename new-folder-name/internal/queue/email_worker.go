@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"context"
+	"log"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+)
+
+// EmailSender delivers an email notification. Errors wrapped with
+// Transient are retried.
+type EmailSender interface {
+	SendEmail(ctx context.Context, msg models.NotificationMessage) error
+}
+
+// LoopbackEmailSender logs instead of sending, so the worker can run end to
+// end in mock mode.
+type LoopbackEmailSender struct{}
+
+func (LoopbackEmailSender) SendEmail(ctx context.Context, msg models.NotificationMessage) error {
+	log.Printf("loopback: email %s to user %s with template %s", msg.ID, msg.UserID, msg.TemplateID)
+	return nil
+}
+
+// EmailWorker sends the notifications consumed from the email queue.
+type EmailWorker struct {
+	deliveryWorker
+}
+
+func NewEmailWorker(sender EmailSender, status StatusRecorder) *EmailWorker {
+	return &EmailWorker{deliveryWorker{channel: "email", send: sender.SendEmail, status: status, Clock: clock.System}}
+}
+
+// ConsumeEmail runs handler over the email queue until ctx is cancelled.
+func (r *RabbitMqClient) ConsumeEmail(ctx context.Context, workers int, handler MessageHandler) error {
+	return r.consume(ctx, r.Config.EmailQueue, "email-worker", workers, handler)
+}
@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEmailSender struct {
+	err  error
+	sent []models.NotificationMessage
+}
+
+func (f *fakeEmailSender) SendEmail(ctx context.Context, msg models.NotificationMessage) error {
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+// fakeStatusRecorder records the statuses and attempts reported for each
+// notification. When err is set every write fails.
+type fakeStatusRecorder struct {
+	err      error
+	statuses []string
+	attempts []error
+}
+
+func (f *fakeStatusRecorder) SetDeliveryStatus(ctx context.Context, notificationID, status string) error {
+	f.statuses = append(f.statuses, status)
+	return f.err
+}
+
+func (f *fakeStatusRecorder) RecordAttempt(ctx context.Context, notificationID string, attemptErr error) error {
+	f.attempts = append(f.attempts, attemptErr)
+	return f.err
+}
+
+func TestEmailWorker(t *testing.T) {
+	msg := models.NotificationMessage{ID: "n-1", Type: "email", UserID: "user123", TemplateID: "welcome"}
+	smtpDown := errors.New("connection refused")
+	rejected := errors.New("mailbox does not exist")
+
+	tests := []struct {
+		name      string
+		sendErr   error
+		statuses  []string
+		transient bool
+	}{
+		{"sent", nil, []string{"processing", "sent"}, false},
+		{"transient failure goes back on the queue", Transient(smtpDown), []string{"processing", "queued"}, true},
+		{"permanent failure", rejected, []string{"processing", "failed"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeEmailSender{err: tt.sendErr}
+			status := &fakeStatusRecorder{}
+
+			err := NewEmailWorker(sender, status).Handle(context.Background(), msg)
+			assert.Equal(t, tt.sendErr, err)
+			assert.Equal(t, tt.transient, IsTransient(err))
+			assert.Equal(t, []models.NotificationMessage{msg}, sender.sent)
+			assert.Equal(t, tt.statuses, status.statuses)
+			assert.Equal(t, []error{tt.sendErr}, status.attempts)
+		})
+	}
+
+	t.Run("transient failure on the last attempt", func(t *testing.T) {
+		status := &fakeStatusRecorder{}
+		err := NewEmailWorker(&fakeEmailSender{err: Transient(smtpDown)}, status).Handle(withLastAttempt(context.Background()), msg)
+		assert.True(t, IsTransient(err))
+		assert.Equal(t, []string{"processing", "failed"}, status.statuses)
+	})
+
+	t.Run("status writes failing don't fail a sent email", func(t *testing.T) {
+		status := &fakeStatusRecorder{err: errors.New("redis: connection refused")}
+		assert.NoError(t, NewEmailWorker(&fakeEmailSender{}, status).Handle(context.Background(), msg))
+		assert.Equal(t, []string{"processing", "sent"}, status.statuses)
+	})
+
+	t.Run("loopback sender", func(t *testing.T) {
+		status := &fakeStatusRecorder{}
+		assert.NoError(t, NewEmailWorker(LoopbackEmailSender{}, status).Handle(context.Background(), msg))
+		assert.Equal(t, []string{"processing", "sent"}, status.statuses)
+	})
+}
+
+func TestHandleMessages(t *testing.T) {
+	var got models.NotificationMessage
+	var tenant string
+	handler := HandleMessages(func(ctx context.Context, msg models.NotificationMessage) error {
+		got, tenant = msg, middleware.TenantFromContext(ctx)
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), amqp.Delivery{
+		Body:    []byte(`{"id":"n-1","type":"email","tenant_id":"shop-a"}`),
+		Headers: amqp.Table{TenantHeader: "shop-b"},
+	}))
+	assert.Equal(t, "n-1", got.ID)
+	assert.Equal(t, "shop-b", tenant, "the header wins")
+
+	require.NoError(t, handler(context.Background(), amqp.Delivery{Body: []byte(`{"id":"n-2","tenant_id":"shop-a"}`)}))
+	assert.Equal(t, "shop-a", tenant)
+
+	require.NoError(t, handler(context.Background(), amqp.Delivery{Body: []byte(`{"id":"n-3","schema_version":1}`)}))
+	assert.Empty(t, tenant)
+
+	err := handler(context.Background(), amqp.Delivery{Body: []byte(`not json`)})
+	assert.Error(t, err)
+	assert.False(t, IsTransient(err), "undecodable bodies dead-letter")
+}
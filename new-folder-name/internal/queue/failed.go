@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// FailedMessage is a message peeked from the failed queue.
+type FailedMessage struct {
+	MessageID string `json:"message_id,omitempty"`
+	// Queue, Reason and Count come from the newest x-death entry the broker
+	// added when it dead-lettered the message: the queue it left, why
+	// ("rejected", "expired" or "maxlen") and how often.
+	Queue          string     `json:"queue,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	Count          int64      `json:"count,omitempty"`
+	DeadLetteredAt *time.Time `json:"dead_lettered_at,omitempty"`
+	// FailedReason is set on messages parked by Reject instead.
+	FailedReason string `json:"failed_reason,omitempty"`
+	Body         string `json:"body"`
+}
+
+// deadLetterArgs make a work queue dead-letter what it rejects or expires
+// to the failed queue, through the working exchange the failed queue is
+// bound to under its own name.
+func (r *RabbitMqClient) deadLetterArgs() amqp.Table {
+	return amqp.Table{
+		"x-dead-letter-exchange":    r.Config.Exchange,
+		"x-dead-letter-routing-key": r.Config.FailedQueue,
+	}
+}
+
+// workQueueArgs are the arguments the email, push and WhatsApp queues are
+// declared with: deadLetterArgs, plus x-max-priority unless
+// Config.MaxPriority is 0.
+func (r *RabbitMqClient) workQueueArgs() amqp.Table {
+	args := r.deadLetterArgs()
+	if r.Config.MaxPriority > 0 {
+		args["x-max-priority"] = int32(r.Config.MaxPriority)
+	}
+	return args
+}
+
+// queueDeclareError explains the error a declare gets when the queue
+// already exists with other arguments, which AMQP won't change in place,
+// naming the arguments it should have. Note the broker closes the channel
+// along with it.
+func queueDeclareError(queueName string, args amqp.Table, err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("queue %s already exists with different arguments than %s, probably from an earlier version; "+
+			"drain and delete it so it can be declared again, or, when only x-max-priority differs, set rabbitmq.max_priority to the queue's: %w",
+			queueName, formatQueueArgs(args), err)
+	}
+	return fmt.Errorf("error declaring queue %s: %w", queueName, err)
+}
+
+// formatQueueArgs lists args sorted by name, as key=value pairs.
+func formatQueueArgs(args amqp.Table) string {
+	if len(args) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", k, args[k])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// failedGetter is the subset of *amqp.Channel used to peek the failed queue.
+type failedGetter interface {
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	Close() error
+}
+
+// InspectFailed peeks at up to limit messages at the head of the failed
+// queue without removing them. It uses a channel of its own, since the
+// peeked messages stay unacked until that channel is closed.
+func (r *RabbitMqClient) InspectFailed(ctx context.Context, limit int) ([]FailedMessage, error) {
+	type result struct {
+		messages []FailedMessage
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ch, err := r.openChannel()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		messages, err := peekFailed(ch, r.Config.FailedQueue, limit)
+		done <- result{messages: messages, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.messages, res.err
+	}
+}
+
+// peekFailed gets up to limit messages and closes ch, which puts them all
+// back. Nacking each one instead would requeue it at the head, and the
+// next get would return it again.
+func peekFailed(ch failedGetter, queueName string, limit int) ([]FailedMessage, error) {
+	defer ch.Close()
+	messages := []FailedMessage{}
+	for len(messages) < limit {
+		d, ok, err := ch.Get(queueName, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to peek %s: %w", queueName, err)
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, failedMessage(d))
+	}
+	return messages, nil
+}
+
+func failedMessage(d amqp.Delivery) FailedMessage {
+	body, err := deliveryBody(d)
+	if err != nil {
+		body = d.Body
+	}
+	msg := FailedMessage{MessageID: d.MessageId, Body: string(body)}
+	msg.FailedReason, _ = d.Headers[FailedReasonHeader].(string)
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return msg
+	}
+	death, _ := deaths[0].(amqp.Table)
+	msg.Queue, _ = death["queue"].(string)
+	msg.Reason, _ = death["reason"].(string)
+	msg.Count, _ = death["count"].(int64)
+	if at, ok := death["time"].(time.Time); ok {
+		msg.DeadLetteredAt = &at
+	}
+	return msg
+}
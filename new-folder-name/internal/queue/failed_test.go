@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFailedChannel struct {
+	messages []amqp.Delivery
+	err      error
+	gets     int
+	closed   bool
+}
+
+func (f *fakeFailedChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	if f.err != nil {
+		return amqp.Delivery{}, false, f.err
+	}
+	if f.gets == len(f.messages) {
+		return amqp.Delivery{}, false, nil
+	}
+	f.gets++
+	return f.messages[f.gets-1], true, nil
+}
+
+func (f *fakeFailedChannel) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestPeekFailed(t *testing.T) {
+	deadAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	newChannel := func() *fakeFailedChannel {
+		return &fakeFailedChannel{messages: []amqp.Delivery{
+			{
+				MessageId: "n-1",
+				Body:      []byte(`{"id":"n-1","type":"email"}`),
+				Headers: amqp.Table{"x-death": []interface{}{
+					amqp.Table{"queue": "email.queue", "reason": "rejected", "count": int64(1), "time": deadAt},
+				}},
+			},
+			{Body: []byte(`{"id":"n-2",`), Headers: amqp.Table{FailedReasonHeader: "failed to decode message"}},
+		}}
+	}
+
+	ch := newChannel()
+	messages, err := peekFailed(ch, "failed.queue", 5)
+	require.NoError(t, err)
+	assert.True(t, ch.closed, "closing the channel puts the peeked messages back")
+	assert.Equal(t, []FailedMessage{
+		{MessageID: "n-1", Queue: "email.queue", Reason: "rejected", Count: 1, DeadLetteredAt: &deadAt, Body: `{"id":"n-1","type":"email"}`},
+		{FailedReason: "failed to decode message", Body: `{"id":"n-2",`},
+	}, messages)
+
+	ch = newChannel()
+	messages, err = peekFailed(ch, "failed.queue", 1)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, 1, ch.gets)
+
+	messages, err = peekFailed(&fakeFailedChannel{}, "failed.queue", 5)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	ch = &fakeFailedChannel{err: errors.New("channel closed")}
+	_, err = peekFailed(ch, "failed.queue", 5)
+	assert.Error(t, err)
+	assert.True(t, ch.closed)
+}
+
+func TestDeadLetterArgs(t *testing.T) {
+	client := &RabbitMqClient{Config: config.RabbitMQConfig{Exchange: "notifications.direct", FailedQueue: "failed.queue"}}
+	assert.Equal(t, amqp.Table{
+		"x-dead-letter-exchange":    "notifications.direct",
+		"x-dead-letter-routing-key": "failed.queue",
+	}, client.deadLetterArgs())
+}
+
+func TestWorkQueueArgs(t *testing.T) {
+	client := &RabbitMqClient{Config: config.RabbitMQConfig{Exchange: "notifications.direct", FailedQueue: "failed.queue", MaxPriority: 10}}
+	assert.Equal(t, amqp.Table{
+		"x-dead-letter-exchange":    "notifications.direct",
+		"x-dead-letter-routing-key": "failed.queue",
+		"x-max-priority":            int32(10),
+	}, client.workQueueArgs())
+
+	client.Config.MaxPriority = 0
+	assert.Equal(t, client.deadLetterArgs(), client.workQueueArgs())
+}
+
+func TestQueueDeclareError(t *testing.T) {
+	inequivalent := &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'x-dead-letter-exchange'"}
+	args := amqp.Table{"x-dead-letter-exchange": "notifications.direct", "x-max-priority": int32(10)}
+	err := queueDeclareError("email.queue", args, inequivalent)
+	assert.ErrorContains(t, err, "queue email.queue already exists with different arguments than x-dead-letter-exchange=notifications.direct x-max-priority=10")
+	assert.ErrorContains(t, err, "rabbitmq.max_priority")
+	assert.ErrorIs(t, err, inequivalent)
+
+	err = queueDeclareError("email.queue", args, amqp.ErrClosed)
+	assert.NotContains(t, err.Error(), "different arguments")
+	assert.ErrorIs(t, err, amqp.ErrClosed)
+}
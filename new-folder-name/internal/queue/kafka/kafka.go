@@ -0,0 +1,210 @@
+// Package kafka publishes notifications to Kafka topics. Its KafkaClient
+// stands in for the RabbitMQ client behind the handlers' RabbitClient
+// interface, so the gateway can publish to either broker.
+//
+// Delivery is at least once, as with RabbitMQ, but the edges differ:
+//
+//   - A publish returns once the record's delivery report comes back, which
+//     with acks from all in-sync replicas is the counterpart of a publisher
+//     confirm. A publish that failed or timed out may still have been
+//     written, so a retried send can reach the topic twice; consumers must
+//     deduplicate on the notification ID, carried in the x-notification-id
+//     header.
+//   - Consumers commit offsets instead of acking messages: one that crashes
+//     after sending but before committing gets the record again, and so do
+//     the records after it in the partition that it had already handled.
+//   - Order is kept per partition only. Records are keyed by recipient, so
+//     a user's notifications stay in order; there are no priorities.
+//   - There is no per-message expiration, dead-lettering or delayed
+//     delivery. Scheduled notifications are published at once, to be held
+//     by their consumer.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/clock"
+)
+
+// NotificationIDHeader carries the notification ID consumers deduplicate
+// on.
+const NotificationIDHeader = "x-notification-id"
+
+// pingTimeout bounds the cluster round trip IsConnected makes.
+const pingTimeout = 2 * time.Second
+
+// defaultPublishTimeout is used when the config sets no publish timeout.
+const defaultPublishTimeout = 5 * time.Second
+
+// ErrNotBuilt is returned by NewKafkaClient from a binary built without
+// the kafka build tag.
+var ErrNotBuilt = errors.New("kafka support is not built in; build with -tags kafka")
+
+// Record is one message to produce.
+type Record struct {
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// Producer is the part of a Kafka producer the client uses. Produce hands
+// the record over without blocking on the broker and calls report once,
+// with the delivery result, from any goroutine.
+type Producer interface {
+	Produce(ctx context.Context, record Record, report func(error))
+	Ping(ctx context.Context) error
+	Close()
+}
+
+type KafkaClient struct {
+	Config config.KafkaConfig
+	// Environment is stamped on every message this client publishes.
+	Environment string
+	// Clock stamps published messages.
+	Clock clock.Clock
+
+	producer Producer
+	closed   atomic.Bool
+}
+
+// NewKafkaClient starts a producer for cfg's brokers. The producer
+// connects, and reconnects, on its own; a cluster that is down fails the
+// publishes, not the start.
+func NewKafkaClient(cfg config.KafkaConfig, environment string) (*KafkaClient, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafka.brokers is empty")
+	}
+	producer, err := newProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewKafkaClientWithProducer(cfg, environment, producer), nil
+}
+
+// NewKafkaClientWithProducer returns a client publishing through producer.
+func NewKafkaClientWithProducer(cfg config.KafkaConfig, environment string, producer Producer) *KafkaClient {
+	return &KafkaClient{
+		Config:      cfg,
+		Environment: environment,
+		Clock:       clock.System,
+		producer:    producer,
+	}
+}
+
+func (k *KafkaClient) PublishEmail(ctx context.Context, message interface{}) error {
+	return k.Publish(ctx, k.Config.EmailTopic, message)
+}
+
+func (k *KafkaClient) PublishPushNot(ctx context.Context, message interface{}) error {
+	return k.Publish(ctx, k.Config.PushTopic, message)
+}
+
+func (k *KafkaClient) PublishWhatsApp(ctx context.Context, message interface{}) error {
+	return k.Publish(ctx, k.Config.WhatsAppTopic, message)
+}
+
+// EmailQueueName, PushQueueName and WhatsAppQueueName name the topics, for
+// the status records.
+func (k *KafkaClient) EmailQueueName() string    { return k.Config.EmailTopic }
+func (k *KafkaClient) PushQueueName() string     { return k.Config.PushTopic }
+func (k *KafkaClient) WhatsAppQueueName() string { return k.Config.WhatsAppTopic }
+
+// Publish produces message to topic and waits for its delivery report. It
+// fails with the report's error, or with ctx's when ctx ends first or the
+// publish timeout passes; either way the record may or may not have been
+// written, and the caller must not report it as queued.
+func (k *KafkaClient) Publish(ctx context.Context, topic string, message interface{}) error {
+	record, err := k.newRecord(topic, message)
+	if err != nil {
+		return err
+	}
+	timeout := k.Config.PublishTimeout
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	reported := make(chan error, 1)
+	k.producer.Produce(ctx, record, func(err error) { reported <- err })
+	select {
+	case err := <-reported:
+		if err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", topic, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no delivery report from %s: %w", topic, ctx.Err())
+	}
+}
+
+// newRecord stamps message with the environment and schema version and
+// builds its record. A NotificationMessage is keyed by its recipient and
+// carries the same metadata headers as on RabbitMQ.
+func (k *KafkaClient) newRecord(topic string, message interface{}) (Record, error) {
+	headers := map[string]string{queue.EnvironmentHeader: k.Environment}
+	var key []byte
+	if msg, ok := message.(models.NotificationMessage); ok {
+		msg.Environment = k.Environment
+		msg.SchemaVersion = queue.MessageSchemaVersion
+		headers[NotificationIDHeader] = msg.ID
+		headers[queue.SchemaVersionHeader] = fmt.Sprint(queue.MessageSchemaVersion)
+		for name, value := range map[string]string{
+			queue.TenantHeader:           msg.TenantID,
+			queue.RequestIDHeader:        msg.RequestID,
+			queue.CorrelationIDHeader:    msg.CorrelationID,
+			queue.NotificationTypeHeader: msg.Type,
+			queue.PriorityHeader:         msg.Priority,
+		} {
+			if value != "" {
+				headers[name] = value
+			}
+		}
+		switch {
+		case msg.UserID != "":
+			key = []byte(msg.UserID)
+		case msg.Topic != "":
+			key = []byte("topic:" + msg.Topic)
+		}
+		message = msg
+	}
+	value, err := json.Marshal(message)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return Record{Topic: topic, Key: key, Value: value, Headers: headers, Timestamp: k.Clock.Now()}, nil
+}
+
+// IsConnected reports whether the cluster answers a ping, within
+// pingTimeout.
+func (k *KafkaClient) IsConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return k.producer.Ping(ctx) == nil
+}
+
+// ReconnectFailing reports whether the client was closed. The producer
+// keeps retrying the brokers for as long as it is open, so a cluster that
+// doesn't answer reads as degraded rather than failing.
+func (k *KafkaClient) ReconnectFailing() bool {
+	return k.closed.Load()
+}
+
+// Close flushes what the producer still holds, as far as it can, and
+// closes it.
+func (k *KafkaClient) Close() {
+	if k.closed.Swap(true) {
+		return
+	}
+	k.producer.Close()
+}
@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProducer records what it is given and reports reportErr from its own
+// goroutine, as a real producer does; with silent set it never reports.
+type fakeProducer struct {
+	mu        sync.Mutex
+	records   []Record
+	reportErr error
+	silent    bool
+	pingErr   error
+	closed    bool
+}
+
+func (p *fakeProducer) Produce(ctx context.Context, record Record, report func(error)) {
+	p.mu.Lock()
+	p.records = append(p.records, record)
+	p.mu.Unlock()
+	if !p.silent {
+		go report(p.reportErr)
+	}
+}
+
+func (p *fakeProducer) Ping(ctx context.Context) error { return p.pingErr }
+
+func (p *fakeProducer) Close() { p.closed = true }
+
+func testConfig() config.KafkaConfig {
+	return config.KafkaConfig{
+		Brokers:        []string{"localhost:9092"},
+		EmailTopic:     "notifications.email",
+		PushTopic:      "notifications.push",
+		WhatsAppTopic:  "notifications.whatsapp",
+		PublishTimeout: time.Second,
+	}
+}
+
+func TestPublish_Record(t *testing.T) {
+	producer := &fakeProducer{}
+	client := NewKafkaClientWithProducer(testConfig(), "staging", producer)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	client.Clock = clock.NewFake(now)
+
+	msg := models.NotificationMessage{
+		ID:            "n-1",
+		Type:          "email",
+		UserID:        "user123",
+		TenantID:      "acme",
+		RequestID:     "req-1",
+		CorrelationID: "corr-1",
+		Priority:      "high",
+	}
+	require.NoError(t, client.PublishEmail(context.Background(), msg))
+	require.Len(t, producer.records, 1)
+	record := producer.records[0]
+	assert.Equal(t, "notifications.email", record.Topic)
+	assert.Equal(t, []byte("user123"), record.Key)
+	assert.Equal(t, now, record.Timestamp)
+	assert.Equal(t, map[string]string{
+		NotificationIDHeader:         "n-1",
+		queue.EnvironmentHeader:      "staging",
+		queue.SchemaVersionHeader:    "1",
+		queue.TenantHeader:           "acme",
+		queue.RequestIDHeader:        "req-1",
+		queue.CorrelationIDHeader:    "corr-1",
+		queue.NotificationTypeHeader: "email",
+		queue.PriorityHeader:         "high",
+	}, record.Headers)
+
+	var published models.NotificationMessage
+	require.NoError(t, json.Unmarshal(record.Value, &published))
+	assert.Equal(t, "staging", published.Environment)
+	assert.Equal(t, queue.MessageSchemaVersion, published.SchemaVersion)
+}
+
+func TestPublish_Topics(t *testing.T) {
+	producer := &fakeProducer{}
+	client := NewKafkaClientWithProducer(testConfig(), "test", producer)
+	ctx := context.Background()
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-1"}))
+	require.NoError(t, client.PublishPushNot(ctx, models.NotificationMessage{ID: "n-2", Topic: "news"}))
+	require.NoError(t, client.PublishWhatsApp(ctx, models.NotificationMessage{ID: "n-3"}))
+
+	require.Len(t, producer.records, 3)
+	assert.Equal(t, "notifications.email", producer.records[0].Topic)
+	assert.Nil(t, producer.records[0].Key, "no recipient, no key")
+	assert.Equal(t, "notifications.push", producer.records[1].Topic)
+	assert.Equal(t, []byte("topic:news"), producer.records[1].Key)
+	assert.Equal(t, "notifications.whatsapp", producer.records[2].Topic)
+	assert.Equal(t, "notifications.push", client.PushQueueName())
+}
+
+func TestPublish_Failures(t *testing.T) {
+	producer := &fakeProducer{reportErr: errors.New("NOT_ENOUGH_REPLICAS")}
+	client := NewKafkaClientWithProducer(testConfig(), "test", producer)
+	err := client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	assert.ErrorContains(t, err, "failed to publish to notifications.email")
+	assert.ErrorContains(t, err, "NOT_ENOUGH_REPLICAS")
+
+	cfg := testConfig()
+	cfg.PublishTimeout = 10 * time.Millisecond
+	client = NewKafkaClientWithProducer(cfg, "test", &fakeProducer{silent: true})
+	err = client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestIsConnected(t *testing.T) {
+	producer := &fakeProducer{}
+	client := NewKafkaClientWithProducer(testConfig(), "test", producer)
+	assert.True(t, client.IsConnected())
+	producer.pingErr = errors.New("no brokers")
+	assert.False(t, client.IsConnected())
+	assert.False(t, client.ReconnectFailing(), "the producer keeps retrying")
+	client.Close()
+	assert.True(t, producer.closed)
+	assert.True(t, client.ReconnectFailing())
+}
+
+func TestNewKafkaClient(t *testing.T) {
+	_, err := NewKafkaClient(config.KafkaConfig{}, "test")
+	assert.ErrorContains(t, err, "kafka.brokers is empty")
+}
@@ -0,0 +1,55 @@
+//go:build kafka
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// franzProducer is the Producer on a franz-go client. The client batches
+// records, retries what the brokers refuse as retriable, and calls each
+// record's promise with the final result.
+type franzProducer struct {
+	client *kgo.Client
+}
+
+func newProducer(cfg config.KafkaConfig) (Producer, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	}
+	if cfg.ClientID != "" {
+		opts = append(opts, kgo.ClientID(cfg.ClientID))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+	return franzProducer{client: client}, nil
+}
+
+func (p franzProducer) Produce(ctx context.Context, record Record, report func(error)) {
+	r := &kgo.Record{
+		Topic:     record.Topic,
+		Key:       record.Key,
+		Value:     record.Value,
+		Timestamp: record.Timestamp,
+	}
+	for key, value := range record.Headers {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+	}
+	p.client.Produce(ctx, r, func(_ *kgo.Record, err error) { report(err) })
+}
+
+func (p franzProducer) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx)
+}
+
+func (p franzProducer) Close() {
+	p.client.Flush(context.Background())
+	p.client.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !kafka
+
+package kafka
+
+import "github.com/franzego/stage04/internal/config"
+
+// newProducer fails: the franz-go producer is only compiled in with the
+// kafka build tag, so the default build doesn't carry its dependencies.
+func newProducer(config.KafkaConfig) (Producer, error) {
+	return nil, ErrNotBuilt
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/franzego/stage04/internal/models"
+)
+
+// ErrLegacyMessage is returned by a strict Decoder for a body without a
+// schema version.
+var ErrLegacyMessage = errors.New("message has no schema version")
+
+// The defaults a legacy message gets; see models.LegacyCategory.
+const (
+	LegacyCategory = models.LegacyCategory
+	LegacyTenant   = models.LegacyTenant
+	LegacyPriority = models.LegacyPriority
+)
+
+// LegacyObserver is told of every legacy message a Decoder upgrades. The
+// metrics package implements it; an Observer that doesn't isn't told.
+type LegacyObserver interface {
+	ObserveLegacyMessage(queueName string)
+}
+
+// Decoder decodes delivery bodies into notifications with
+// models.DecodeNotificationMessage. Messages left in the queues by the old
+// gateway have no schema version; they are upgraded with the Legacy
+// defaults and marked UpgradedFromLegacy, or with Strict set, refused with
+// ErrLegacyMessage so the consumer rejects them. So are messages of a
+// schema version newer than this build reads, with
+// models.ErrUnsupportedSchema.
+type Decoder struct {
+	Strict bool
+	// Observer, when it implements LegacyObserver, counts the legacy
+	// messages.
+	Observer Observer
+}
+
+// Decode decodes body, taken from queueName.
+func (dec Decoder) Decode(queueName string, body []byte) (models.NotificationMessage, error) {
+	msg, err := models.DecodeNotificationMessage(body)
+	if err != nil || !msg.UpgradedFromLegacy {
+		return msg, err
+	}
+	if observer, ok := dec.Observer.(LegacyObserver); ok {
+		observer.ObserveLegacyMessage(queueName)
+	}
+	if dec.Strict {
+		return msg, fmt.Errorf("failed to decode message %s: %w", msg.ID, ErrLegacyMessage)
+	}
+	return msg, nil
+}
+
+// decoder is the Decoder the client's consumers use.
+func (r *RabbitMqClient) decoder() Decoder {
+	return Decoder{Strict: r.Config.StrictSchema, Observer: r.Observer}
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyObserver counts the legacy messages, as well as the retries.
+type legacyObserver struct {
+	retryObserver
+	legacyMu sync.Mutex
+	legacy   map[string]int
+}
+
+func (o *legacyObserver) ObserveLegacyMessage(queueName string) {
+	o.legacyMu.Lock()
+	defer o.legacyMu.Unlock()
+	if o.legacy == nil {
+		o.legacy = map[string]int{}
+	}
+	o.legacy[queueName]++
+}
+
+// legacyStatusRecorder records the notifications marked as upgraded.
+type legacyStatusRecorder struct {
+	fakeStatusRecorder
+	upgraded []string
+}
+
+func (f *legacyStatusRecorder) MarkUpgradedFromLegacy(ctx context.Context, notificationID string) error {
+	f.upgraded = append(f.upgraded, notificationID)
+	return f.err
+}
+
+func TestDecoder_LegacyFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "legacy", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			body, err := os.ReadFile(path)
+			require.NoError(t, err)
+			observer := &legacyObserver{}
+
+			msg, err := Decoder{Observer: observer}.Decode("email.queue", body)
+			require.NoError(t, err)
+			assert.NotEmpty(t, msg.ID)
+			assert.NotEmpty(t, msg.TemplateID)
+			assert.True(t, msg.UpgradedFromLegacy)
+			assert.Equal(t, LegacyCategory, msg.Category)
+			assert.Equal(t, LegacyTenant, msg.TenantID)
+			assert.NotEmpty(t, msg.Priority)
+			assert.Equal(t, 1, observer.legacy["email.queue"])
+
+			_, err = Decoder{Strict: true}.Decode("email.queue", body)
+			assert.ErrorIs(t, err, ErrLegacyMessage)
+		})
+	}
+}
+
+func TestDecoder_Defaults(t *testing.T) {
+	msg, err := Decoder{}.Decode("push.queue", []byte(`{"id":"n-1","priority":"","category":"marketing","tenant_id":"shop-a"}`))
+	require.NoError(t, err)
+	assert.Equal(t, LegacyPriority, msg.Priority)
+	assert.Equal(t, "marketing", msg.Category, "fields the message has are kept")
+	assert.Equal(t, "shop-a", msg.TenantID)
+
+	observer := &legacyObserver{}
+	msg, err = Decoder{Strict: true, Observer: observer}.Decode("push.queue", []byte(`{"id":"n-2","schema_version":1}`))
+	require.NoError(t, err)
+	assert.False(t, msg.UpgradedFromLegacy)
+	assert.Empty(t, msg.Category, "current messages get no defaults")
+	assert.Empty(t, observer.legacy)
+}
+
+func TestDecoder_FutureSchemaRejected(t *testing.T) {
+	ch := newFakeChannel(0)
+	d := amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, Body: []byte(`{"id":"n-1","schema_version":99}`)}
+	sender := &fakeEmailSender{}
+	outcome := settle(context.Background(), "email.queue", HandleMessages(NewEmailWorker(sender, &fakeStatusRecorder{}).Handle), nil, nil, d)
+
+	assert.Equal(t, settledRejected, outcome, "dead-lettered rather than requeued")
+	assert.Equal(t, "nack", ch.outcomes[1])
+	assert.Empty(t, sender.sent)
+	_, err := Decoder{}.Decode("email.queue", d.Body)
+	assert.ErrorIs(t, err, models.ErrUnsupportedSchema)
+}
+
+func TestDecoder_PublishedMessagesAreCurrent(t *testing.T) {
+	publishing, err := newPublishing(time.Time{}, "test", models.NotificationMessage{ID: "n-1"}, PublishOptions{})
+	require.NoError(t, err)
+	msg, err := Decoder{Strict: true}.Decode("email.queue", publishing.Body)
+	require.NoError(t, err)
+	assert.Equal(t, MessageSchemaVersion, msg.SchemaVersion)
+}
+
+func TestDecoder_HandleMessages(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "legacy", "email.json"))
+	require.NoError(t, err)
+	sender := &fakeEmailSender{}
+	status := &legacyStatusRecorder{}
+	var tenant string
+	worker := NewEmailWorker(sender, status)
+	handler := Decoder{}.HandleMessages(func(ctx context.Context, msg models.NotificationMessage) error {
+		tenant = middleware.TenantFromContext(ctx)
+		return worker.Handle(ctx, msg)
+	})
+
+	require.NoError(t, handler(context.Background(), amqp.Delivery{RoutingKey: "email.queue", Body: body}))
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, []string{sender.sent[0].ID}, status.upgraded)
+	assert.Equal(t, []string{"processing", "sent"}, status.statuses)
+	assert.Equal(t, LegacyTenant, tenant)
+
+	err = Decoder{Strict: true}.HandleMessages(worker.Handle)(context.Background(), amqp.Delivery{RoutingKey: "email.queue", Body: body})
+	assert.ErrorIs(t, err, ErrLegacyMessage)
+	assert.False(t, IsTransient(err), "legacy messages are rejected in strict mode")
+	assert.Len(t, sender.sent, 1)
+}
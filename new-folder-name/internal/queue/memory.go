@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+)
+
+// DefaultMemoryCapacity is how many messages a MemoryClient queue keeps when
+// the client sets no capacity.
+const DefaultMemoryCapacity = 1000
+
+// The queues a MemoryClient publishes to.
+const (
+	MemoryEmailQueue    = "memory.email"
+	MemoryPushQueue     = "memory.push"
+	MemoryWhatsAppQueue = "memory.whatsapp"
+)
+
+// ErrMemoryQueueFull is returned by a MemoryClient publish when the queue's
+// subscriber has Capacity messages still to process.
+var ErrMemoryQueueFull = errors.New("memory queue is full")
+
+// ErrMemoryClientClosed is returned by a MemoryClient after Close.
+var ErrMemoryClientClosed = errors.New("memory client closed")
+
+// MemoryClient keeps published notifications in the process, for running
+// the gateway without a broker and for tests. Each queue keeps its last
+// Capacity messages, dropping the oldest; a queue with a subscriber also
+// hands every message to it, on the subscriber's own goroutine. There is
+// no redelivery: a message whose handler fails is logged and dropped.
+// Messages are lost on restart.
+type MemoryClient struct {
+	// Environment is stamped on every message this client publishes.
+	Environment string
+	Capacity    int
+
+	mu          sync.Mutex
+	queues      map[string][]models.NotificationMessage
+	subscribers map[string]chan models.NotificationMessage
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		Capacity:    DefaultMemoryCapacity,
+		queues:      map[string][]models.NotificationMessage{},
+		subscribers: map[string]chan models.NotificationMessage{},
+	}
+}
+
+func (m *MemoryClient) PublishEmail(ctx context.Context, message interface{}) error {
+	return m.publish(MemoryEmailQueue, message)
+}
+
+func (m *MemoryClient) PublishPushNot(ctx context.Context, message interface{}) error {
+	return m.publish(MemoryPushQueue, message)
+}
+
+func (m *MemoryClient) PublishWhatsApp(ctx context.Context, message interface{}) error {
+	return m.publish(MemoryWhatsAppQueue, message)
+}
+
+func (m *MemoryClient) EmailQueueName() string    { return MemoryEmailQueue }
+func (m *MemoryClient) PushQueueName() string     { return MemoryPushQueue }
+func (m *MemoryClient) WhatsAppQueueName() string { return MemoryWhatsAppQueue }
+
+func (m *MemoryClient) capacity() int {
+	if m.Capacity <= 0 {
+		return DefaultMemoryCapacity
+	}
+	return m.Capacity
+}
+
+// publish stamps message as the broker clients do, keeps it and hands it
+// to the queue's subscriber. Anything but a NotificationMessage is kept as
+// the message its JSON decodes to.
+func (m *MemoryClient) publish(queueName string, message interface{}) error {
+	msg, ok := message.(models.NotificationMessage)
+	if !ok {
+		by, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		if err := json.Unmarshal(by, &msg); err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", queueName, err)
+		}
+	}
+	msg.Environment = m.Environment
+	msg.SchemaVersion = MessageSchemaVersion
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return fmt.Errorf("failed to publish to %s: %w", queueName, ErrMemoryClientClosed)
+	}
+	if deliveries, ok := m.subscribers[queueName]; ok {
+		select {
+		case deliveries <- msg:
+		default:
+			return fmt.Errorf("failed to publish to %s: %w", queueName, ErrMemoryQueueFull)
+		}
+	}
+	kept := append(m.queues[queueName], msg)
+	if capacity := m.capacity(); len(kept) > capacity {
+		kept = append([]models.NotificationMessage(nil), kept[len(kept)-capacity:]...)
+	}
+	m.queues[queueName] = kept
+	return nil
+}
+
+// Subscribe has handler process the messages published to queueName from
+// now on, one at a time on a goroutine of its own, with the message's
+// tenant on ctx as for HandleMessages. A queue has one subscriber;
+// subscribing again replaces nothing and fails.
+func (m *MemoryClient) Subscribe(queueName string, handler MessageHandler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMemoryClientClosed
+	}
+	if _, ok := m.subscribers[queueName]; ok {
+		return fmt.Errorf("%s already has a subscriber", queueName)
+	}
+	deliveries := make(chan models.NotificationMessage, m.capacity())
+	m.subscribers[queueName] = deliveries
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for msg := range deliveries {
+			ctx := context.Background()
+			if msg.TenantID != "" {
+				ctx = middleware.WithTenant(ctx, msg.TenantID)
+			}
+			if err := handler(ctx, msg); err != nil {
+				log.Printf("memory queue %s: dropping %s: %v", queueName, msg.ID, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Messages returns the messages kept for queueName, oldest first.
+func (m *MemoryClient) Messages(queueName string) []models.NotificationMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.NotificationMessage(nil), m.queues[queueName]...)
+}
+
+// IsConnected is true until the client is closed: there is no connection
+// to lose.
+func (m *MemoryClient) IsConnected() bool {
+	return !m.ReconnectFailing()
+}
+
+func (m *MemoryClient) ReconnectFailing() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// Close stops taking publishes and waits for the subscribers to process
+// what they were handed.
+func (m *MemoryClient) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	for _, deliveries := range m.subscribers {
+		close(deliveries)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryClient_Publish(t *testing.T) {
+	client := NewMemoryClient()
+	client.Environment = "dev"
+	ctx := context.Background()
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-1"}))
+	require.NoError(t, client.PublishPushNot(ctx, models.NotificationMessage{ID: "n-2"}))
+	require.NoError(t, client.PublishWhatsApp(ctx, map[string]string{"id": "n-3"}))
+
+	emails := client.Messages(MemoryEmailQueue)
+	require.Len(t, emails, 1)
+	assert.Equal(t, "n-1", emails[0].ID)
+	assert.Equal(t, "dev", emails[0].Environment)
+	assert.Equal(t, MessageSchemaVersion, emails[0].SchemaVersion)
+	assert.Len(t, client.Messages(MemoryPushQueue), 1)
+	assert.Equal(t, "n-3", client.Messages(MemoryWhatsAppQueue)[0].ID)
+	assert.True(t, client.IsConnected())
+}
+
+func TestMemoryClient_Capacity(t *testing.T) {
+	client := NewMemoryClient()
+	client.Capacity = 2
+	for _, id := range []string{"n-1", "n-2", "n-3"} {
+		require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: id}))
+	}
+	emails := client.Messages(MemoryEmailQueue)
+	require.Len(t, emails, 2)
+	assert.Equal(t, "n-2", emails[0].ID, "the oldest is dropped")
+	assert.Equal(t, "n-3", emails[1].ID)
+}
+
+func TestMemoryClient_Subscribe(t *testing.T) {
+	client := NewMemoryClient()
+	delivered := make(chan string, 2)
+	require.NoError(t, client.Subscribe(MemoryEmailQueue, func(ctx context.Context, msg models.NotificationMessage) error {
+		delivered <- msg.ID + "@" + middleware.TenantFromContext(ctx)
+		return assert.AnError
+	}))
+	assert.Error(t, client.Subscribe(MemoryEmailQueue, nil), "one subscriber per queue")
+
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1", TenantID: "acme"}))
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-2", TenantID: "acme"}))
+	for _, want := range []string{"n-1@acme", "n-2@acme"} {
+		select {
+		case got := <-delivered:
+			assert.Equal(t, want, got, "a failed handler doesn't stop the queue")
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not delivered", want)
+		}
+	}
+	assert.Len(t, client.Messages(MemoryEmailQueue), 2)
+}
+
+func TestMemoryClient_Full(t *testing.T) {
+	client := NewMemoryClient()
+	client.Capacity = 1
+	release := make(chan struct{})
+	started := make(chan struct{})
+	require.NoError(t, client.Subscribe(MemoryEmailQueue, func(ctx context.Context, msg models.NotificationMessage) error {
+		if msg.ID == "n-1" {
+			close(started)
+		}
+		<-release
+		return nil
+	}))
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+	<-started
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-2"}))
+	err := client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-3"})
+	assert.ErrorIs(t, err, ErrMemoryQueueFull)
+
+	close(release)
+	client.Close()
+	assert.False(t, client.IsConnected())
+	assert.ErrorIs(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-4"}), ErrMemoryClientClosed)
+}
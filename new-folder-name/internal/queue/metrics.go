@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// publishDurationBuckets are finer below 10ms, where a publish to a healthy
+// broker lands with or without confirms.
+var publishDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}
+
+// Metrics are the client's own collectors: publishes by outcome and how
+// long they took, deliveries consumed by how they were settled, and
+// reconnects. The collectors are created once, so recording one costs a
+// label lookup and an atomic add. A nil *Metrics records nothing.
+type Metrics struct {
+	published       *prometheus.CounterVec
+	publishDuration *prometheus.HistogramVec
+	consumed        *prometheus.CounterVec
+	reconnects      prometheus.Counter
+}
+
+// NewMetrics builds the collectors and registers them with reg, the
+// gateway's registry or a test's own.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notifications_published_total",
+			Help: "Messages published, by queue and result (ok or error).",
+		}, []string{"queue", "result"}),
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "notification_publish_duration_seconds",
+			Help:    "Time taken to publish a message, including the broker's confirm when confirms are on.",
+			Buckets: publishDurationBuckets,
+		}, []string{"queue"}),
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notifications_consumed_total",
+			Help: "Deliveries consumed, by queue and how they were settled (acked, requeued, retried or rejected).",
+		}, []string{"queue", "result"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "rabbitmq_reconnects_total",
+			Help: "Times the client got its broker connection back after losing it.",
+		}),
+	}
+	for _, collector := range []prometheus.Collector{m.published, m.publishDuration, m.consumed, m.reconnects} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) observePublish(queueName string, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.published.WithLabelValues(queueName, result).Inc()
+	m.publishDuration.WithLabelValues(queueName).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) observeConsume(queueName, result string) {
+	if m == nil {
+		return
+	}
+	m.consumed.WithLabelValues(queueName, result).Inc()
+}
+
+func (m *Metrics) observeReconnect() {
+	if m == nil {
+		return
+	}
+	m.reconnects.Inc()
+}
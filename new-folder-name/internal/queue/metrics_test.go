@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_Publish(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+	reg := prometheus.NewRegistry()
+	client.Metrics, err = NewMetrics(reg)
+	require.NoError(t, err)
+
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-2"}))
+	client.CloseConnection()
+	assert.Error(t, client.PublishPushNot(context.Background(), models.NotificationMessage{ID: "n-3"}))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(client.Metrics.published.WithLabelValues("email.queue", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(client.Metrics.published.WithLabelValues("push.queue", "error")))
+	assert.Equal(t, 2, testutil.CollectAndCount(client.Metrics.publishDuration), "one series per queue")
+
+	_, err = NewMetrics(reg)
+	assert.Error(t, err, "registering twice fails")
+}
+
+func TestMetrics_Reconnect(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(time.Second), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+	client.Metrics, err = NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	broker.bounce()
+	require.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, time.Millisecond)
+	broker.up()
+	require.Eventually(t, func() bool { return testutil.ToFloat64(client.Metrics.reconnects) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestMetrics_Consume(t *testing.T) {
+	ch := newFakeChannel(3)
+	processed := make(chan struct{}, 3)
+	consumer := NewConsumer(ch, "email.queue", "worker-1", 1, 1, func(ctx context.Context, d amqp.Delivery) error {
+		defer func() { processed <- struct{}{} }()
+		switch d.DeliveryTag {
+		case 2:
+			return Transient(assert.AnError)
+		case 3:
+			return assert.AnError
+		}
+		return nil
+	})
+	var err error
+	consumer.Metrics, err = NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	for range 3 {
+		<-processed
+	}
+	cancel()
+	assert.NoError(t, <-done)
+
+	for _, result := range []string{settledAcked, settledRequeued, settledRejected} {
+		assert.Equal(t, 1.0, testutil.ToFloat64(consumer.Metrics.consumed.WithLabelValues("email.queue", result)), result)
+	}
+}
+
+// benchmarkPublish publishes to a fake broker, with the client's metrics
+// when withMetrics is set, so the two runs compare what recording costs.
+func benchmarkPublish(b *testing.B, withMetrics bool) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(b, err)
+	defer client.CloseConnection()
+	if withMetrics {
+		client.Metrics, err = NewMetrics(prometheus.NewRegistry())
+		require.NoError(b, err)
+	}
+	msg := models.NotificationMessage{ID: "n-1", Type: "email", TemplateID: "welcome"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.PublishEmail(context.Background(), msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPublish_NoMetrics(b *testing.B) { benchmarkPublish(b, false) }
+
+func BenchmarkPublish_Metrics(b *testing.B) { benchmarkPublish(b, true) }
@@ -0,0 +1,216 @@
+// Package nats publishes notifications to NATS JetStream. Its NATSClient
+// stands in for the RabbitMQ client behind the handlers' RabbitClient
+// interface, for deployments that would rather run a single NATS server.
+//
+// A publish returns once the stream acks the message, which is the
+// counterpart of a publisher confirm. Each message carries its
+// notification ID as the Nats-Msg-Id header, so the stream drops a retried
+// publish that already landed within its duplicate window. As with Kafka
+// there are no priorities, per-message expiration, dead-lettering or
+// delayed delivery.
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// defaultPublishTimeout is used when the config sets no publish timeout.
+const defaultPublishTimeout = 5 * time.Second
+
+// setupTimeout bounds creating or updating the stream at startup.
+const setupTimeout = 10 * time.Second
+
+// streamPublisher is the part of JetStream the client publishes through.
+type streamPublisher interface {
+	PublishMsg(ctx context.Context, msg *natsio.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+type NATSClient struct {
+	Config config.NATSConfig
+	// Environment is stamped on every message this client publishes.
+	Environment string
+
+	conn      *natsio.Conn
+	js        streamPublisher
+	connected atomic.Bool
+	closed    atomic.Bool
+}
+
+// NewNATSClient connects to cfg.URL and creates, or updates, the stream
+// capturing the notification subjects. A lost connection is brought back
+// by the NATS client itself, up to cfg.MaxReconnects tries; publishes fail
+// while it is down.
+func NewNATSClient(cfg config.NATSConfig, environment string) (*NATSClient, error) {
+	if cfg.Stream == "" {
+		return nil, errors.New("nats.stream is empty")
+	}
+	c := newNATSClient(cfg, environment, nil)
+	conn, err := natsio.Connect(cfg.URL,
+		natsio.Name(cfg.Name),
+		natsio.MaxReconnects(cfg.MaxReconnects),
+		natsio.ReconnectWait(cfg.ReconnectWait),
+		natsio.DisconnectErrHandler(func(_ *natsio.Conn, err error) { c.disconnected(err) }),
+		natsio.ReconnectHandler(func(*natsio.Conn) { c.reconnected() }),
+		natsio.ClosedHandler(func(*natsio.Conn) { c.connClosed() }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream,
+		Subjects: []string{cfg.EmailSubject, cfg.PushSubject, cfg.WhatsAppSubject},
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set up stream %s: %w", cfg.Stream, err)
+	}
+	c.conn, c.js = conn, js
+	c.connected.Store(conn.IsConnected())
+	return c, nil
+}
+
+func newNATSClient(cfg config.NATSConfig, environment string, js streamPublisher) *NATSClient {
+	c := &NATSClient{
+		Config:      cfg,
+		Environment: environment,
+		js:          js,
+	}
+	c.connected.Store(js != nil)
+	return c
+}
+
+// disconnected, reconnected and connClosed follow the connection's status
+// callbacks; IsConnected reads what they recorded.
+func (c *NATSClient) disconnected(err error) {
+	c.connected.Store(false)
+	if err != nil {
+		log.Printf("NATS connection lost, reconnecting: %v", err)
+	}
+}
+
+func (c *NATSClient) reconnected() {
+	c.connected.Store(true)
+	log.Print("NATS connection restored")
+}
+
+func (c *NATSClient) connClosed() {
+	c.connected.Store(false)
+	c.closed.Store(true)
+}
+
+func (c *NATSClient) PublishEmail(ctx context.Context, message interface{}) error {
+	return c.Publish(ctx, c.Config.EmailSubject, message)
+}
+
+func (c *NATSClient) PublishPushNot(ctx context.Context, message interface{}) error {
+	return c.Publish(ctx, c.Config.PushSubject, message)
+}
+
+func (c *NATSClient) PublishWhatsApp(ctx context.Context, message interface{}) error {
+	return c.Publish(ctx, c.Config.WhatsAppSubject, message)
+}
+
+// EmailQueueName, PushQueueName and WhatsAppQueueName name the subjects,
+// for the status records.
+func (c *NATSClient) EmailQueueName() string    { return c.Config.EmailSubject }
+func (c *NATSClient) PushQueueName() string     { return c.Config.PushSubject }
+func (c *NATSClient) WhatsAppQueueName() string { return c.Config.WhatsAppSubject }
+
+// Publish publishes message to subject and waits for the stream's ack. It
+// fails fast while the connection is down, and otherwise with the ack's
+// error or ctx's, when ctx ends first or the publish timeout passes.
+func (c *NATSClient) Publish(ctx context.Context, subject string, message interface{}) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("failed to publish to %s: %w", subject, natsio.ErrConnectionClosed)
+	}
+	msg, opts, err := c.newMsg(subject, message)
+	if err != nil {
+		return err
+	}
+	timeout := c.Config.PublishTimeout
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if _, err := c.js.PublishMsg(ctx, msg, opts...); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+	return nil
+}
+
+// newMsg stamps message with the environment and schema version and builds
+// its NATS message. A NotificationMessage carries the same metadata
+// headers as on RabbitMQ, and its ID for the stream to deduplicate on.
+func (c *NATSClient) newMsg(subject string, message interface{}) (*natsio.Msg, []jetstream.PublishOpt, error) {
+	header := natsio.Header{}
+	header.Set(queue.EnvironmentHeader, c.Environment)
+	opts := []jetstream.PublishOpt{jetstream.WithExpectStream(c.Config.Stream)}
+	if msg, ok := message.(models.NotificationMessage); ok {
+		msg.Environment = c.Environment
+		msg.SchemaVersion = queue.MessageSchemaVersion
+		header.Set(queue.SchemaVersionHeader, fmt.Sprint(queue.MessageSchemaVersion))
+		for name, value := range map[string]string{
+			queue.TenantHeader:           msg.TenantID,
+			queue.RequestIDHeader:        msg.RequestID,
+			queue.CorrelationIDHeader:    msg.CorrelationID,
+			queue.NotificationTypeHeader: msg.Type,
+			queue.PriorityHeader:         msg.Priority,
+		} {
+			if value != "" {
+				header.Set(name, value)
+			}
+		}
+		if msg.ID != "" {
+			opts = append(opts, jetstream.WithMsgID(msg.ID))
+		}
+		message = msg
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return &natsio.Msg{Subject: subject, Header: header, Data: data}, opts, nil
+}
+
+// IsConnected reports the connection's state as its status callbacks last
+// left it.
+func (c *NATSClient) IsConnected() bool {
+	return c.connected.Load()
+}
+
+// ReconnectFailing reports whether the connection is closed for good,
+// because the client ran out of reconnect attempts or was closed.
+func (c *NATSClient) ReconnectFailing() bool {
+	return c.closed.Load()
+}
+
+// Close closes the connection. Publishes wait for their acks, so none is
+// left behind.
+func (c *NATSClient) Close() {
+	c.connClosed()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
@@ -0,0 +1,150 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/queue"
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStream records what is published and acks with err; with hang set
+// it never acks and waits out the context instead.
+type fakeStream struct {
+	mu   sync.Mutex
+	msgs []*natsio.Msg
+	opts [][]jetstream.PublishOpt
+	err  error
+	hang bool
+}
+
+func (s *fakeStream) PublishMsg(ctx context.Context, msg *natsio.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	s.mu.Lock()
+	s.msgs = append(s.msgs, msg)
+	s.opts = append(s.opts, opts)
+	s.mu.Unlock()
+	if s.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &jetstream.PubAck{Stream: "NOTIFICATIONS", Sequence: uint64(len(s.msgs))}, nil
+}
+
+func testConfig() config.NATSConfig {
+	return config.NATSConfig{
+		Stream:          "NOTIFICATIONS",
+		EmailSubject:    "notifications.email",
+		PushSubject:     "notifications.push",
+		WhatsAppSubject: "notifications.whatsapp",
+		PublishTimeout:  time.Second,
+	}
+}
+
+func TestPublish_Msg(t *testing.T) {
+	stream := &fakeStream{}
+	client := newNATSClient(testConfig(), "staging", stream)
+
+	msg := models.NotificationMessage{
+		ID:            "n-1",
+		Type:          "email",
+		TenantID:      "acme",
+		RequestID:     "req-1",
+		CorrelationID: "corr-1",
+		Priority:      "high",
+	}
+	require.NoError(t, client.PublishEmail(context.Background(), msg))
+	require.Len(t, stream.msgs, 1)
+	published := stream.msgs[0]
+	assert.Equal(t, "notifications.email", published.Subject)
+	for name, want := range map[string]string{
+		queue.EnvironmentHeader:      "staging",
+		queue.SchemaVersionHeader:    "1",
+		queue.TenantHeader:           "acme",
+		queue.RequestIDHeader:        "req-1",
+		queue.CorrelationIDHeader:    "corr-1",
+		queue.NotificationTypeHeader: "email",
+		queue.PriorityHeader:         "high",
+	} {
+		assert.Equal(t, want, published.Header.Get(name), name)
+	}
+	assert.Len(t, stream.opts[0], 2, "the expected stream and the message ID")
+
+	var body models.NotificationMessage
+	require.NoError(t, json.Unmarshal(published.Data, &body))
+	assert.Equal(t, "staging", body.Environment)
+	assert.Equal(t, queue.MessageSchemaVersion, body.SchemaVersion)
+}
+
+func TestPublish_Subjects(t *testing.T) {
+	stream := &fakeStream{}
+	client := newNATSClient(testConfig(), "test", stream)
+	ctx := context.Background()
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-1"}))
+	require.NoError(t, client.PublishPushNot(ctx, models.NotificationMessage{ID: "n-2"}))
+	require.NoError(t, client.PublishWhatsApp(ctx, models.NotificationMessage{ID: "n-3"}))
+
+	require.Len(t, stream.msgs, 3)
+	assert.Equal(t, "notifications.email", stream.msgs[0].Subject)
+	assert.Equal(t, "notifications.push", stream.msgs[1].Subject)
+	assert.Equal(t, "notifications.whatsapp", stream.msgs[2].Subject)
+	assert.Equal(t, "notifications.whatsapp", client.WhatsAppQueueName())
+}
+
+func TestPublish_Failures(t *testing.T) {
+	client := newNATSClient(testConfig(), "test", &fakeStream{err: jetstream.ErrNoStreamResponse})
+	err := client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	assert.ErrorContains(t, err, "failed to publish to notifications.email")
+	assert.ErrorIs(t, err, jetstream.ErrNoStreamResponse)
+
+	cfg := testConfig()
+	cfg.PublishTimeout = 10 * time.Millisecond
+	client = newNATSClient(cfg, "test", &fakeStream{hang: true})
+	err = client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConnectionStatus(t *testing.T) {
+	stream := &fakeStream{}
+	client := newNATSClient(testConfig(), "test", stream)
+	assert.True(t, client.IsConnected())
+
+	client.disconnected(errors.New("read: connection reset by peer"))
+	assert.False(t, client.IsConnected())
+	assert.False(t, client.ReconnectFailing(), "the client is still reconnecting")
+	err := client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	assert.ErrorIs(t, err, natsio.ErrConnectionClosed)
+	assert.Empty(t, stream.msgs, "a publish fails fast while disconnected")
+
+	client.reconnected()
+	assert.True(t, client.IsConnected())
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+
+	// the client ran out of reconnect attempts
+	client.connClosed()
+	assert.False(t, client.IsConnected())
+	assert.True(t, client.ReconnectFailing())
+}
+
+func TestNewNATSClient(t *testing.T) {
+	cfg := testConfig()
+	cfg.Stream = ""
+	_, err := NewNATSClient(cfg, "test")
+	assert.ErrorContains(t, err, "nats.stream is empty")
+
+	cfg = testConfig()
+	cfg.URL = "nats://127.0.0.1:1"
+	_, err = NewNATSClient(cfg, "test")
+	assert.ErrorContains(t, err, "failed to connect to NATS")
+}
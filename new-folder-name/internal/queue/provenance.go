@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/franzego/stage04/pkg/clock"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// EnvironmentHeader carries the publishing deployment's environment.
+	EnvironmentHeader        = "environment"
+	QuarantineReasonHeader   = "x-quarantine-reason"
+	OriginalRoutingKeyHeader = "x-original-routing-key"
+)
+
+// Quarantiner parks deliveries a consumer refused to process.
+type Quarantiner interface {
+	Quarantine(ctx context.Context, d amqp.Delivery, reason string) error
+}
+
+// ProvenanceEvent is reported whenever a delivery from another environment
+// is seen, whether it was quarantined or let through by a forced override.
+type ProvenanceEvent struct {
+	MessageEnvironment  string    `json:"message_environment"`
+	ConsumerEnvironment string    `json:"consumer_environment"`
+	RoutingKey          string    `json:"routing_key"`
+	MessageID           string    `json:"message_id"`
+	Forced              bool      `json:"forced"`
+	Actor               string    `json:"actor,omitempty"`
+	Timestamp           time.Time `json:"timestamp"`
+}
+
+// ProvenanceAuditor receives provenance events. Implementations must not block.
+type ProvenanceAuditor interface {
+	ForeignMessage(ctx context.Context, event ProvenanceEvent)
+}
+
+// LogProvenanceAuditor writes provenance events to the standard logger.
+type LogProvenanceAuditor struct{}
+
+func (LogProvenanceAuditor) ForeignMessage(ctx context.Context, event ProvenanceEvent) {
+	if event.Forced {
+		log.Printf("AUDIT cross-environment message %s from %q consumed in %q, forced by %s",
+			event.MessageID, event.MessageEnvironment, event.ConsumerEnvironment, event.Actor)
+		return
+	}
+	log.Printf("ALERT foreign_environment_message: %s from %q quarantined in %q (routing key %s)",
+		event.MessageID, event.MessageEnvironment, event.ConsumerEnvironment, event.RoutingKey)
+}
+
+// ProvenanceGuard is run by consumers before processing a delivery. Messages
+// stamped with a different environment, or not stamped at all, are
+// quarantined instead of delivered.
+type ProvenanceGuard struct {
+	environment string
+	quarantine  Quarantiner
+	auditor     ProvenanceAuditor
+	// Clock stamps the quarantine events.
+	Clock clock.Clock
+
+	quarantined atomic.Uint64
+	forced      atomic.Uint64
+}
+
+func NewProvenanceGuard(environment string, quarantine Quarantiner, auditor ProvenanceAuditor) *ProvenanceGuard {
+	return &ProvenanceGuard{
+		environment: environment,
+		quarantine:  quarantine,
+		auditor:     auditor,
+		Clock:       clock.System,
+	}
+}
+
+// Accept reports whether d may be processed. A foreign delivery is
+// quarantined and reported; the caller should ack it and move on.
+func (g *ProvenanceGuard) Accept(ctx context.Context, d amqp.Delivery) (bool, error) {
+	env := messageEnvironment(d)
+	if env == g.environment {
+		return true, nil
+	}
+
+	g.quarantined.Add(1)
+	g.auditor.ForeignMessage(ctx, g.event(d, env, false, ""))
+	reason := fmt.Sprintf("environment %q does not match consumer environment %q", env, g.environment)
+	if err := g.quarantine.Quarantine(ctx, d, reason); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// AcceptForced lets a delivery through regardless of its environment. It
+// backs the replay tooling's --force-cross-env flag; every cross-environment
+// use is audited under actor.
+func (g *ProvenanceGuard) AcceptForced(ctx context.Context, d amqp.Delivery, actor string) bool {
+	if env := messageEnvironment(d); env != g.environment {
+		g.forced.Add(1)
+		g.auditor.ForeignMessage(ctx, g.event(d, env, true, actor))
+	}
+	return true
+}
+
+// Quarantined is the number of deliveries refused since startup.
+func (g *ProvenanceGuard) Quarantined() uint64 {
+	return g.quarantined.Load()
+}
+
+// Forced is the number of cross-environment deliveries let through by an
+// override since startup.
+func (g *ProvenanceGuard) Forced() uint64 {
+	return g.forced.Load()
+}
+
+func (g *ProvenanceGuard) event(d amqp.Delivery, env string, forced bool, actor string) ProvenanceEvent {
+	return ProvenanceEvent{
+		MessageEnvironment:  env,
+		ConsumerEnvironment: g.environment,
+		RoutingKey:          d.RoutingKey,
+		MessageID:           d.MessageId,
+		Forced:              forced,
+		Actor:               actor,
+		Timestamp:           g.Clock.Now(),
+	}
+}
+
+func messageEnvironment(d amqp.Delivery) string {
+	env, _ := d.Headers[EnvironmentHeader].(string)
+	return env
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingQuarantine struct {
+	deliveries []amqp.Delivery
+	reasons    []string
+	err        error
+}
+
+func (r *recordingQuarantine) Quarantine(ctx context.Context, d amqp.Delivery, reason string) error {
+	r.deliveries = append(r.deliveries, d)
+	r.reasons = append(r.reasons, reason)
+	return r.err
+}
+
+type recordingAuditor struct {
+	mu     sync.Mutex
+	events []ProvenanceEvent
+}
+
+func (r *recordingAuditor) ForeignMessage(ctx context.Context, event ProvenanceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func delivery(env string) amqp.Delivery {
+	d := amqp.Delivery{MessageId: "msg-1", RoutingKey: "email.queue", Body: []byte(`{}`)}
+	if env != "" {
+		d.Headers = amqp.Table{EnvironmentHeader: env}
+	}
+	return d
+}
+
+func TestProvenanceGuard_MatchingEnvironment(t *testing.T) {
+	quarantine, auditor := &recordingQuarantine{}, &recordingAuditor{}
+	guard := NewProvenanceGuard("production", quarantine, auditor)
+
+	ok, err := guard.Accept(context.Background(), delivery("production"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, quarantine.deliveries)
+	assert.Empty(t, auditor.events)
+	assert.Zero(t, guard.Quarantined())
+}
+
+func TestProvenanceGuard_MismatchIsQuarantined(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+	}{
+		{"other environment", "staging"},
+		{"unstamped", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine, auditor := &recordingQuarantine{}, &recordingAuditor{}
+			guard := NewProvenanceGuard("production", quarantine, auditor)
+
+			ok, err := guard.Accept(context.Background(), delivery(tt.env))
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.Len(t, quarantine.deliveries, 1)
+			assert.Equal(t, uint64(1), guard.Quarantined())
+			if assert.Len(t, auditor.events, 1) {
+				assert.Equal(t, tt.env, auditor.events[0].MessageEnvironment)
+				assert.Equal(t, "production", auditor.events[0].ConsumerEnvironment)
+				assert.False(t, auditor.events[0].Forced)
+			}
+		})
+	}
+}
+
+func TestProvenanceGuard_QuarantineFailure(t *testing.T) {
+	quarantine := &recordingQuarantine{err: errors.New("channel closed")}
+	guard := NewProvenanceGuard("production", quarantine, &recordingAuditor{})
+
+	// The delivery must still be refused so the caller can nack it
+	ok, err := guard.Accept(context.Background(), delivery("staging"))
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestProvenanceGuard_ForcedOverrideIsAudited(t *testing.T) {
+	quarantine, auditor := &recordingQuarantine{}, &recordingAuditor{}
+	guard := NewProvenanceGuard("production", quarantine, auditor)
+
+	assert.True(t, guard.AcceptForced(context.Background(), delivery("staging"), "ops@example.com"))
+	assert.Empty(t, quarantine.deliveries)
+	assert.Equal(t, uint64(1), guard.Forced())
+	if assert.Len(t, auditor.events, 1) {
+		assert.True(t, auditor.events[0].Forced)
+		assert.Equal(t, "ops@example.com", auditor.events[0].Actor)
+	}
+
+	// Forcing a same-environment message is not worth an audit entry
+	assert.True(t, guard.AcceptForced(context.Background(), delivery("production"), "ops@example.com"))
+	assert.Len(t, auditor.events, 1)
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+)
+
+// PushSender delivers a push notification. Errors wrapped with Transient
+// are retried.
+type PushSender interface {
+	SendPush(ctx context.Context, msg models.NotificationMessage) error
+}
+
+// LoopbackPushSender logs instead of sending, so the worker can run end to
+// end in mock mode.
+type LoopbackPushSender struct{}
+
+func (LoopbackPushSender) SendPush(ctx context.Context, msg models.NotificationMessage) error {
+	log.Printf("loopback: push %s to user %s with template %s", msg.ID, msg.UserID, msg.TemplateID)
+	return nil
+}
+
+// PushTokenType is the push service a device token belongs to.
+type PushTokenType string
+
+const (
+	FCMToken     PushTokenType = "fcm"
+	APNsToken    PushTokenType = "apns"
+	WebPushToken PushTokenType = "webpush"
+)
+
+// apnsToken is the 32-byte device token APNs hands out, in hex.
+var apnsToken = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// ClassifyPushToken tells which push service token belongs to. Tokens that
+// are neither Web Push subscriptions nor APNs tokens are taken for FCM's.
+func ClassifyPushToken(token string) PushTokenType {
+	switch {
+	case strings.HasPrefix(token, WebPushTokenPrefix):
+		return WebPushToken
+	case apnsToken.MatchString(token):
+		return APNsToken
+	}
+	return FCMToken
+}
+
+// PushRouter sends each of a message's device tokens through the sender for
+// its token type. A message without tokens goes to Default, which looks the
+// user's devices up itself.
+type PushRouter struct {
+	Senders map[PushTokenType]PushSender
+	Default PushSender
+}
+
+// SendPush calls each sender once, with the message narrowed to that
+// sender's tokens. Tokens of a type without a sender fail the send
+// permanently, after the others have been tried.
+func (p *PushRouter) SendPush(ctx context.Context, msg models.NotificationMessage) error {
+	if len(msg.DeviceTokens) == 0 {
+		if p.Default == nil {
+			return errors.New("no device tokens and no default push sender")
+		}
+		return p.Default.SendPush(ctx, msg)
+	}
+	var order []PushTokenType
+	byType := map[PushTokenType][]string{}
+	for _, token := range msg.DeviceTokens {
+		tokenType := ClassifyPushToken(token)
+		if _, seen := byType[tokenType]; !seen {
+			order = append(order, tokenType)
+		}
+		byType[tokenType] = append(byType[tokenType], token)
+	}
+	var errs []error
+	for _, tokenType := range order {
+		sender, ok := p.Senders[tokenType]
+		if !ok {
+			errs = append(errs, fmt.Errorf("no push sender for %s tokens", tokenType))
+			continue
+		}
+		narrowed := msg
+		narrowed.DeviceTokens = byType[tokenType]
+		if err := sender.SendPush(ctx, narrowed); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tokenType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PushWorker sends the notifications consumed from the push queue.
+type PushWorker struct {
+	deliveryWorker
+}
+
+func NewPushWorker(sender PushSender, status StatusRecorder) *PushWorker {
+	return &PushWorker{deliveryWorker{channel: "push", send: sender.SendPush, status: status, Clock: clock.System}}
+}
+
+// ConsumePush runs handler over the push queue until ctx is cancelled.
+func (r *RabbitMqClient) ConsumePush(ctx context.Context, workers int, handler MessageHandler) error {
+	return r.consume(ctx, r.Config.PushQueue, "push-worker", workers, handler)
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePushSender struct {
+	err  map[string]error
+	sent []string
+}
+
+func (f *fakePushSender) SendPush(ctx context.Context, msg models.NotificationMessage) error {
+	f.sent = append(f.sent, msg.ID)
+	return f.err[msg.ID]
+}
+
+// fakeRejecter records the reason every delivery was rejected with. When
+// err is set rejecting fails.
+type fakeRejecter struct {
+	mu      sync.Mutex
+	err     error
+	reasons map[uint64]string
+}
+
+func (f *fakeRejecter) Reject(ctx context.Context, d amqp.Delivery, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reasons == nil {
+		f.reasons = make(map[uint64]string)
+	}
+	f.reasons[d.DeliveryTag] = reason
+	return f.err
+}
+
+func TestPushConsumer(t *testing.T) {
+	ch := &fakeChannel{deliveries: make(chan amqp.Delivery, 3), outcomes: make(map[uint64]string)}
+	for tag, body := range []string{
+		`{"id":"p-1","type":"push","user_id":"user123","template_id":"welcome"}`,
+		`{"id":"p-2","type":"push",`,
+		`{"id":"p-3","type":"push","user_id":"user456","template_id":"welcome"}`,
+	} {
+		ch.deliveries <- amqp.Delivery{Acknowledger: ch, DeliveryTag: uint64(tag + 1), Body: []byte(body)}
+	}
+
+	sender := &fakePushSender{err: map[string]error{"p-3": errors.New("device token unregistered")}}
+	status := &fakeStatusRecorder{}
+	rejecter := &fakeRejecter{}
+	consumer := NewConsumer(ch, "push.queue", "push-worker", 1, 1, HandleMessages(NewPushWorker(sender, status).Handle))
+	consumer.Rejecter = rejecter
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return len(ch.outcomes) == 3
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+
+	// rejected deliveries are acked once they are parked, never requeued
+	assert.Equal(t, map[uint64]string{1: "ack", 2: "ack", 3: "ack"}, ch.outcomes)
+	assert.Equal(t, []string{"p-1", "p-3"}, sender.sent)
+	assert.Equal(t, []string{"processing", "sent", "processing", "failed"}, status.statuses)
+	require.Len(t, rejecter.reasons, 2)
+	assert.Contains(t, rejecter.reasons[2], "failed to decode message")
+	assert.Equal(t, "device token unregistered", rejecter.reasons[3])
+}
+
+func TestConsumer_RejectFailureRequeues(t *testing.T) {
+	ch := newFakeChannel(1)
+	processed := make(chan struct{}, 1)
+	consumer := NewConsumer(ch, "push.queue", "push-worker", 1, 1, func(ctx context.Context, d amqp.Delivery) error {
+		defer func() { processed <- struct{}{} }()
+		return assert.AnError
+	})
+	consumer.Rejecter = &fakeRejecter{err: errors.New("channel closed")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	<-processed
+	require.Eventually(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return len(ch.outcomes) == 1
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+
+	assert.Equal(t, map[uint64]string{1: "requeue"}, ch.outcomes)
+}
+
+// tokenSender records the tokens of every message it is given.
+type tokenSender struct {
+	tokens [][]string
+	err    error
+}
+
+func (s *tokenSender) SendPush(ctx context.Context, msg models.NotificationMessage) error {
+	s.tokens = append(s.tokens, msg.DeviceTokens)
+	return s.err
+}
+
+func TestClassifyPushToken(t *testing.T) {
+	assert.Equal(t, WebPushToken, ClassifyPushToken(WebPushTokenPrefix+"eyJ9"))
+	assert.Equal(t, APNsToken, ClassifyPushToken("740f4707bebcf74f9b7c25d48e3358945f6aa01da5ddb387462c7eaf61bb78ad"))
+	assert.Equal(t, FCMToken, ClassifyPushToken("dQw4w9WgXcQ:APA91bH-fcm-token"))
+}
+
+func TestPushRouter(t *testing.T) {
+	fcm, apns, web, fallback := &tokenSender{}, &tokenSender{}, &tokenSender{err: Transient(errors.New("push service down"))}, &tokenSender{}
+	router := &PushRouter{
+		Senders: map[PushTokenType]PushSender{FCMToken: fcm, APNsToken: apns, WebPushToken: web},
+		Default: fallback,
+	}
+	apnsToken := "740f4707bebcf74f9b7c25d48e3358945f6aa01da5ddb387462c7eaf61bb78ad"
+
+	err := router.SendPush(context.Background(), models.NotificationMessage{
+		ID:           "n-1",
+		DeviceTokens: []string{"fcm-1", WebPushTokenPrefix + "a", apnsToken, "fcm-2"},
+	})
+	assert.True(t, IsTransient(err), "a transient failure on one type is retried")
+	assert.Equal(t, [][]string{{"fcm-1", "fcm-2"}}, fcm.tokens)
+	assert.Equal(t, [][]string{{apnsToken}}, apns.tokens)
+	assert.Equal(t, [][]string{{WebPushTokenPrefix + "a"}}, web.tokens)
+	assert.Empty(t, fallback.tokens)
+
+	require.NoError(t, router.SendPush(context.Background(), models.NotificationMessage{ID: "n-2"}))
+	assert.Len(t, fallback.tokens, 1, "messages without tokens go to the default sender")
+
+	webOnly := &PushRouter{Senders: map[PushTokenType]PushSender{WebPushToken: &tokenSender{}}}
+	err = webOnly.SendPush(context.Background(), models.NotificationMessage{ID: "n-3", DeviceTokens: []string{"fcm-1"}})
+	assert.ErrorContains(t, err, "no push sender for fcm tokens")
+	assert.False(t, IsTransient(err))
+}
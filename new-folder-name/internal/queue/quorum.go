@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Queue types for Config.QueueType.
+const (
+	ClassicQueues = "classic"
+	QuorumQueues  = "quorum"
+)
+
+// defaultDeliveryLimit is the x-delivery-limit of quorum queues when
+// Config.DeliveryLimit is unset. The consumers give up on a message after
+// its first redelivery, so only a consumer crashing on a message again and
+// again gets near it.
+const defaultDeliveryLimit = 20
+
+// quorum reports whether the queues are declared as quorum queues.
+func (r *RabbitMqClient) quorum() bool {
+	return r.Config.QueueType == QuorumQueues
+}
+
+// validateQueueOptions fails on settings the broker would refuse for the
+// configured queue type, before anything is declared, rather than leaving
+// it to the broker's error for the first declare.
+func (r *RabbitMqClient) validateQueueOptions() error {
+	switch r.Config.QueueType {
+	case "", ClassicQueues:
+		return nil
+	case QuorumQueues:
+	default:
+		return fmt.Errorf("rabbitmq.queue_type must be %q or %q, got %q", ClassicQueues, QuorumQueues, r.Config.QueueType)
+	}
+	if r.Config.MaxPriority > 0 {
+		return fmt.Errorf("rabbitmq.max_priority is %d, but quorum queues can't be declared with x-max-priority; "+
+			"set rabbitmq.max_priority to 0 to use rabbitmq.queue_type %q", r.Config.MaxPriority, QuorumQueues)
+	}
+	if r.Config.DeliveryLimit < 0 {
+		return fmt.Errorf("rabbitmq.delivery_limit must not be negative, got %d", r.Config.DeliveryLimit)
+	}
+	return nil
+}
+
+// queueArgs returns args with the arguments of the configured queue type
+// added: nothing for classic queues; x-queue-type and x-delivery-limit for
+// quorum ones. args is not modified.
+func (r *RabbitMqClient) queueArgs(args amqp.Table) amqp.Table {
+	if !r.quorum() {
+		return args
+	}
+	limit := r.Config.DeliveryLimit
+	if limit == 0 {
+		limit = defaultDeliveryLimit
+	}
+	typed := amqp.Table{
+		"x-queue-type":     QuorumQueues,
+		"x-delivery-limit": int32(limit),
+	}
+	for k, v := range args {
+		typed[k] = v
+	}
+	return typed
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuorumQueues_Declared(t *testing.T) {
+	cfg := reconnectConfig(0)
+	cfg.QueueType = QuorumQueues
+	cfg.DeliveryLimit = 5
+	cfg.RetryExchange = "notifications.retry"
+	cfg.RetryDelays = []time.Duration{30 * time.Second}
+	cfg.DelayExchange, cfg.DelayQueue = "notifications.delay", "delay.queue"
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	assert.Equal(t, amqp.Table{
+		"x-queue-type":              "quorum",
+		"x-delivery-limit":          int32(5),
+		"x-dead-letter-exchange":    "notifications.direct",
+		"x-dead-letter-routing-key": "failed.queue",
+	}, broker.queueArgs["email.queue"])
+	for name, args := range broker.queueArgs {
+		assert.Equal(t, "quorum", args["x-queue-type"], name)
+		assert.NotContains(t, args, "x-max-priority", name)
+	}
+	assert.Contains(t, broker.queueArgs, "failed.queue")
+	assert.Contains(t, broker.queueArgs, "delay.queue")
+	assert.Contains(t, broker.queueArgs, "retry.wait.30s")
+}
+
+func TestQuorumQueues_DefaultDeliveryLimit(t *testing.T) {
+	client := &RabbitMqClient{}
+	client.Config.QueueType = QuorumQueues
+	assert.Equal(t, amqp.Table{"x-queue-type": "quorum", "x-delivery-limit": int32(defaultDeliveryLimit)}, client.queueArgs(nil))
+
+	client.Config.QueueType = ClassicQueues
+	assert.Nil(t, client.queueArgs(nil))
+	args := amqp.Table{"x-max-priority": int32(10)}
+	assert.Equal(t, args, client.queueArgs(args))
+}
+
+func TestQuorumQueues_InvalidOptionsFailFast(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueType string
+		priority  int
+		limit     int
+		want      string
+	}{
+		{"priority", QuorumQueues, 10, 0, "rabbitmq.max_priority is 10, but quorum queues can't be declared with x-max-priority"},
+		{"delivery limit", QuorumQueues, 0, -1, "rabbitmq.delivery_limit must not be negative"},
+		{"unknown type", "stream", 0, 0, `rabbitmq.queue_type must be "classic" or "quorum", got "stream"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := reconnectConfig(0)
+			cfg.QueueType, cfg.MaxPriority, cfg.DeliveryLimit = tt.queueType, tt.priority, tt.limit
+			broker := &fakeBroker{}
+			_, err := connectRabbitMq(cfg, "test", broker.dial)
+			assert.ErrorContains(t, err, tt.want)
+			dials, _, _ := broker.stats()
+			assert.Zero(t, dials, "nothing is declared")
+		})
+	}
+
+	cfg := reconnectConfig(0)
+	cfg.MaxPriority = 10
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err, "classic queues take priorities")
+	client.CloseConnection()
+}
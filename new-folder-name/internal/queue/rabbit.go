@@ -0,0 +1,716 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type RabbitMqClient struct {
+	Config config.RabbitMQConfig
+	// Environment is stamped on every message this client publishes.
+	Environment string
+	// Observer, when set, is told how long every Publish took and of every
+	// publish retried.
+	Observer Observer
+	// Metrics, when set, counts publishes, consumed deliveries and
+	// reconnects on the registry they were built for.
+	Metrics *Metrics
+	// Clock stamps published messages and times publishes.
+	Clock clock.Clock
+
+	dial dialFunc
+	// closing is closed by CloseConnection and stops the reconnect loop.
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// mu guards the connection, which the reconnect loop swaps when the
+	// broker goes away. ready is closed while connected and replaced when
+	// the connection drops; failedAttempts counts the redials since.
+	mu             sync.RWMutex
+	conn           amqpConnection
+	channel        amqpChannel
+	connected      bool
+	ready          chan struct{}
+	failedAttempts int
+
+	batchMu sync.Mutex
+	batch   *BatchPublisher
+
+	confirmMu sync.Mutex
+	confirm   *ConfirmPublisher
+
+	// drainMu guards draining, set by Drain; inflight counts the
+	// publishes under way.
+	drainMu  sync.RWMutex
+	draining bool
+	inflight sync.WaitGroup
+
+	// qosMu guards the prefetch consumers subscribe with, Config's until
+	// SetPrefetch changes it.
+	qosMu          sync.Mutex
+	prefetchCount  int
+	prefetchGlobal bool
+	// openConsumerChannel, when set, replaces openChannel for consumers.
+	openConsumerChannel func() (ConsumerChannel, error)
+}
+
+// NewRabbitMqService connects to the broker and declares the exchanges and
+// queues, so a fresh deployment has them, then verifies them. It fails, without retrying, when
+// the broker can't be reached or the declarations are refused. Once
+// connected the client keeps the connection up: when the broker goes away
+// it redials in the background, see supervise, and publishes made
+// meanwhile wait briefly or fail with ErrNotConnected.
+func NewRabbitMqService(cfg config.RabbitMQConfig, environment string) (*RabbitMqClient, error) {
+	return connectRabbitMq(cfg, environment, dialAMQP)
+}
+
+// ConnectRabbitMqInBackground returns a client that isn't connected yet and
+// dials the broker in the background, with the reconnect backoff, until it
+// gets through. Publishes fail with ErrNotConnected until then. It lets the
+// gateway serve without a broker, in mock mode.
+func ConnectRabbitMqInBackground(cfg config.RabbitMQConfig, environment string) *RabbitMqClient {
+	return connectInBackground(cfg, environment, dialAMQP)
+}
+
+func newRabbitMqClient(cfg config.RabbitMQConfig, environment string, dial dialFunc) *RabbitMqClient {
+	return &RabbitMqClient{
+		Config:      cfg,
+		Environment: environment,
+		Clock:       clock.System,
+		dial:        dial,
+		closing:     make(chan struct{}),
+		ready:       make(chan struct{}),
+
+		prefetchCount:  cfg.PrefetchCount,
+		prefetchGlobal: cfg.PrefetchGlobal,
+	}
+}
+
+func connectRabbitMq(cfg config.RabbitMQConfig, environment string, dial dialFunc) (*RabbitMqClient, error) {
+	r := newRabbitMqClient(cfg, environment, dial)
+	if err := r.validateQueueOptions(); err != nil {
+		return nil, err
+	}
+	conn, channel, err := dial(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setUpTopology(channel); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to declare rabbitmq topology: %w", err)
+	}
+	r.setConnected(conn, channel)
+	go r.supervise(conn, channel)
+	return r, nil
+}
+
+func connectInBackground(cfg config.RabbitMQConfig, environment string, dial dialFunc) *RabbitMqClient {
+	r := newRabbitMqClient(cfg, environment, dial)
+	go func() {
+		conn, channel, ok := r.redial()
+		if !ok || !r.setConnected(conn, channel) {
+			return
+		}
+		log.Print("rabbitmq connected")
+		r.supervise(conn, channel)
+	}()
+	return r
+}
+
+// IsConnected reports whether the client has a live connection. It is false
+// while a reconnect is in progress.
+func (r *RabbitMqClient) IsConnected() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.connected && r.conn != nil && !r.conn.IsClosed()
+}
+
+// CloseConnection closes the connection for good and stops the reconnect
+// loop. Calling it again does nothing.
+func (r *RabbitMqClient) CloseConnection() error {
+	r.closeOnce.Do(func() { close(r.closing) })
+	r.dropPublishers()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.connected {
+		r.connected = false
+		r.ready = make(chan struct{})
+	}
+	conn, channel := r.conn, r.channel
+	r.conn, r.channel = nil, nil
+	if channel != nil {
+		channel.Close()
+	}
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// dropPublishers closes the confirm-mode publishers; they are reopened on
+// next use.
+func (r *RabbitMqClient) dropPublishers() {
+	r.batchMu.Lock()
+	if r.batch != nil {
+		r.batch.Close()
+		r.batch = nil
+	}
+	r.batchMu.Unlock()
+	r.confirmMu.Lock()
+	if r.confirm != nil {
+		r.confirm.Close()
+		r.confirm = nil
+	}
+	r.confirmMu.Unlock()
+}
+
+// SetUpExchangeAndQueue declares the exchanges and queues again and
+// verifies them. The constructor and every reconnect already do; it is for
+// callers that want to be sure after changing them on the broker.
+func (r *RabbitMqClient) SetUpExchangeAndQueue() error {
+	if err := r.awaitConnection(context.Background()); err != nil {
+		return err
+	}
+	channel, err := r.currentChannel()
+	if err != nil {
+		return err
+	}
+	return r.setUpTopology(channel)
+}
+
+// setUpTopology declares the topology on channel and verifies it.
+func (r *RabbitMqClient) setUpTopology(channel amqpChannel) error {
+	if err := r.declareTopology(channel); err != nil {
+		return err
+	}
+	return r.verifyTopology(channel)
+}
+
+// verifyTopology declares the exchange and the queues again passively, so
+// a broker that acknowledged the declarations without keeping them, such
+// as one whose policy deletes them, fails startup rather than leaving every
+// publish unroutable. AMQP has no passive bind; the binds were
+// acknowledged by the broker as declareTopology made them. A passive
+// declare of something missing closes the channel along with it.
+func (r *RabbitMqClient) verifyTopology(channel amqpChannel) error {
+	if err := channel.ExchangeDeclarePassive(r.Config.Exchange, r.exchangeKind(), true, false, false, false, nil); err != nil {
+		return fmt.Errorf("exchange %s is missing after declaring it: %w", r.Config.Exchange, err)
+	}
+	for _, queueName := range []string{r.Config.EmailQueue, r.Config.PushQueue, r.Config.WhatsAppQueue, r.Config.FailedQueue, r.Config.QuarantineQueue} {
+		if queueName == "" {
+			continue
+		}
+		if _, err := channel.QueueDeclarePassive(queueName, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("queue %s is missing after declaring it: %w", queueName, err)
+		}
+	}
+	return nil
+}
+
+// declareTopology declares the exchanges and queues on channel. It runs
+// again on every reconnect, in case the broker came back without them.
+func (r *RabbitMqClient) declareTopology(channel amqpChannel) error {
+	if err := r.validateExchangeType(); err != nil {
+		return err
+	}
+	if err := channel.ExchangeDeclare(
+		r.Config.Exchange,
+		r.exchangeKind(),
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		nil,   // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", r.Config.Exchange, err)
+	}
+	if r.Config.MaxPriority < 0 || r.Config.MaxPriority > 255 {
+		return fmt.Errorf("rabbitmq.max_priority must be between 0 and 255, got %d", r.Config.MaxPriority)
+	}
+	if err := r.validateQueueOptions(); err != nil {
+		return err
+	}
+	// the work queues dead-letter to the failed queue and take priorities;
+	// the failed and quarantine queues are where messages end up, so they
+	// don't
+	work := r.queueArgs(r.workQueueArgs())
+	queues := []struct {
+		name string
+		args amqp.Table
+	}{
+		{r.Config.EmailQueue, work},
+		{r.Config.PushQueue, work},
+		{r.Config.WhatsAppQueue, work},
+		{r.Config.FailedQueue, r.queueArgs(nil)},
+		{r.Config.QuarantineQueue, r.queueArgs(nil)},
+	}
+	for _, q := range queues {
+		queueName := q.name
+		if _, err := channel.QueueDeclare(
+			queueName,
+			true,
+			false,
+			false,
+			false,
+			q.args,
+		); err != nil {
+			return queueDeclareError(queueName, q.args, err)
+		}
+		for _, key := range r.bindingKeys(queueName) {
+			if err := channel.QueueBind(queueName, key, r.Config.Exchange, false, nil); err != nil {
+				return fmt.Errorf("failed to bind queue %s to %s: %w", queueName, key, err)
+			}
+		}
+	}
+	if err := r.declareDelayTopology(channel, []string{r.Config.EmailQueue, r.Config.PushQueue, r.Config.WhatsAppQueue}); err != nil {
+		return err
+	}
+	return declareRetryQueues(channel, r.Config.Exchange, r.Config.RetryExchange, WaitQueues(r.Config.RetryDelays), r.queueArgs(nil))
+}
+
+// RetryDispatcher returns a dispatcher publishing on this client's channel,
+// whichever it is after reconnects.
+func (r *RabbitMqClient) RetryDispatcher() *RetryDispatcher {
+	return NewRetryDispatcher(liveChannel{r}, r.Config.Exchange, r.Config.RetryExchange, r.Config.FailedQueue, r.Config.RetryDelays, r.Config.MaxRetryAttempts)
+}
+
+// TenantHeader carries the tenant a message belongs to so consumers can
+// segregate processing.
+const TenantHeader = "tenant_id"
+
+// RequestIDHeader carries the ID of the HTTP call that queued a message, so
+// consumers' logs can be joined with the gateway's.
+const RequestIDHeader = "request_id"
+
+// Headers carrying a notification's metadata, so consumers and broker
+// tooling can route and log a message without unmarshalling its body.
+const (
+	CorrelationIDHeader    = "x-correlation-id"
+	NotificationTypeHeader = "x-notification-type"
+	PriorityHeader         = "x-priority"
+	SchemaVersionHeader    = "x-schema-version"
+)
+
+// MessageSchemaVersion is the version of the NotificationMessage body the
+// clients publish; see models.CurrentSchemaVersion.
+const MessageSchemaVersion = models.CurrentSchemaVersion
+
+// PublishOptions are the per-message AMQP properties a publish sets.
+type PublishOptions struct {
+	// Priority is honoured up to the queue's x-max-priority; RabbitMQ
+	// treats anything above as the maximum.
+	Priority uint8
+	// Expiration, when positive, is how long the message may wait in the
+	// queue. The work queues then dead-letter it to the failed queue, where
+	// its x-death reason is "expired".
+	Expiration time.Duration
+	// Headers are added to the message. The environment header, and for
+	// a NotificationMessage the tenant, request ID and metadata headers,
+	// are always set by the client and win over these.
+	Headers amqp.Table
+	// Exchange, when set, is published to instead of the client's
+	// exchange.
+	Exchange string
+	// CompressAbove, when positive, gzips a body longer than this many
+	// bytes. The client publishes with Config.CompressionThreshold when it
+	// is zero and Config.Compression is set.
+	CompressAbove int
+}
+
+// Message priorities for the notification priorities, on a scale that fits
+// the default x-max-priority of 10.
+const (
+	LowPriority    uint8 = 1
+	NormalPriority uint8 = 5
+	HighPriority   uint8 = 9
+)
+
+// defaultPublishOptions are the options Publish uses: the priority and
+// expiration follow the notification's, when message is one.
+func defaultPublishOptions(message interface{}) PublishOptions {
+	opts := PublishOptions{Priority: NormalPriority}
+	if msg, ok := message.(models.NotificationMessage); ok {
+		switch msg.Priority {
+		case "high":
+			opts.Priority = HighPriority
+		case "low":
+			opts.Priority = LowPriority
+		}
+		opts.Expiration = time.Duration(msg.ExpiresInSeconds) * time.Second
+	}
+	return opts
+}
+
+// Publish publishes message to routingKey with defaultPublishOptions. See
+// PublishWithOptions.
+func (r *RabbitMqClient) Publish(ctx context.Context, routingKey string, message interface{}) error {
+	return r.PublishWithOptions(ctx, routingKey, message, defaultPublishOptions(message))
+}
+
+// PublishWithOptions publishes message to routingKey with opts. With
+// publisher confirms on, it returns only once the broker has accepted the
+// message, or with an error when the broker nacks it or ctx ends first;
+// with them off it returns as soon as the message is written to the socket.
+// While the client is reconnecting it waits up to
+// Config.ReconnectPublishWait, then fails with ErrNotConnected. A publish
+// that fails on the connection or channel is retried, see publishWithRetry.
+// Once Drain has started it fails with ErrShuttingDown.
+func (r *RabbitMqClient) PublishWithOptions(ctx context.Context, routingKey string, message interface{}, opts PublishOptions) error {
+	if err := r.beginPublish(); err != nil {
+		return err
+	}
+	defer r.endPublish()
+	if opts.CompressAbove == 0 {
+		opts.CompressAbove = r.compressAbove()
+	}
+	start := r.Clock.Now()
+	err := r.publishWithRetry(ctx, routingKey, message, opts)
+	elapsed := r.Clock.Now().Sub(start)
+	if r.Observer != nil {
+		r.Observer.ObservePublish(routingKey, elapsed, err)
+	}
+	r.Metrics.observePublish(routingKey, elapsed, err)
+	return err
+}
+
+func (r *RabbitMqClient) publish(ctx context.Context, routingKey string, message interface{}, opts PublishOptions) error {
+	if err := r.waitToPublish(ctx); err != nil {
+		return err
+	}
+	if r.Config.PublisherConfirms {
+		publisher, err := r.confirmPublisher()
+		if err != nil {
+			return err
+		}
+		err = publisher.Publish(ctx, routingKey, message, opts)
+		if errors.Is(err, ErrConfirmChannelClosed) {
+			r.confirmMu.Lock()
+			if r.confirm == publisher {
+				r.confirm = nil
+			}
+			r.confirmMu.Unlock()
+		}
+		return err
+	}
+	publishing, err := newPublishing(r.Clock.Now(), r.Environment, message, opts)
+	if err != nil {
+		return err
+	}
+	channel, err := r.currentChannel()
+	if err != nil {
+		return err
+	}
+	exchange := r.Config.Exchange
+	if opts.Exchange != "" {
+		exchange = opts.Exchange
+	}
+	if err := channel.PublishWithContext(
+		ctx,
+		exchange,
+		routingKey,
+		r.Config.Mandatory,
+		false,
+		publishing,
+	); err != nil {
+		if errors.Is(err, amqp.ErrClosed) {
+			// the connection dropped under us; the reconnect loop has it
+			return fmt.Errorf("failed to publish message: %w", ErrNotConnected)
+		}
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// confirmPublisher returns the confirm-mode publisher, opening its channel
+// on first use and again once the broker has closed it. Confirms get a
+// channel of their own so quarantine and retry publishes on the main channel
+// don't use up delivery tags.
+func (r *RabbitMqClient) confirmPublisher() (*ConfirmPublisher, error) {
+	r.confirmMu.Lock()
+	defer r.confirmMu.Unlock()
+	if r.confirm != nil {
+		return r.confirm, nil
+	}
+	channel, err := r.openChannel()
+	if err != nil {
+		return nil, fmt.Errorf("error creating confirm channel: %w", err)
+	}
+	publisher, err := NewConfirmPublisher(channel, r.Config.Exchange, r.Environment)
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+	publisher.Clock = r.Clock
+	if r.Config.Mandatory {
+		publisher.Mandatory = true
+		r.watchReturns(channel)
+	}
+	r.confirm = publisher
+	return publisher, nil
+}
+
+// newPublishing stamps message with the environment and builds the
+// persistent JSON publishing every path sends, with opts' properties,
+// compressed as opts.CompressAbove asks. A NotificationMessage also sets
+// the message and correlation IDs and the metadata headers from its
+// fields.
+func newPublishing(now time.Time, environment string, message interface{}, opts PublishOptions) (amqp.Publishing, error) {
+	headers := amqp.Table{}
+	for k, v := range opts.Headers {
+		headers[k] = v
+	}
+	headers[EnvironmentHeader] = environment
+	var messageID, correlationID string
+	if msg, ok := message.(models.NotificationMessage); ok {
+		msg.Environment = environment
+		if msg.TenantID != "" {
+			headers[TenantHeader] = msg.TenantID
+		}
+		if msg.RequestID != "" {
+			headers[RequestIDHeader] = msg.RequestID
+		}
+		if msg.CorrelationID != "" {
+			headers[CorrelationIDHeader] = msg.CorrelationID
+		}
+		if msg.Type != "" {
+			headers[NotificationTypeHeader] = msg.Type
+		}
+		if msg.Priority != "" {
+			headers[PriorityHeader] = msg.Priority
+		}
+		msg.SchemaVersion = MessageSchemaVersion
+		headers[SchemaVersionHeader] = int32(MessageSchemaVersion)
+		messageID, correlationID = msg.ID, msg.CorrelationID
+		message = msg
+	}
+	by, err := json.Marshal(message)
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	var contentEncoding string
+	if opts.CompressAbove > 0 && len(by) > opts.CompressAbove {
+		if by, err = models.CompressBody(by); err != nil {
+			return amqp.Publishing{}, err
+		}
+		contentEncoding = models.GzipEncoding
+	}
+	return amqp.Publishing{
+		ContentType:     "application/json",
+		ContentEncoding: contentEncoding,
+		Body:            by,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        opts.Priority,
+		Expiration:      formatExpiration(opts.Expiration),
+		Timestamp:       now,
+		MessageId:       messageID,
+		CorrelationId:   correlationID,
+		Headers:         headers,
+	}, nil
+}
+
+// formatExpiration renders d as the per-message TTL property, whole
+// milliseconds; zero or less means none.
+func formatExpiration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(max(d.Milliseconds(), 1), 10)
+}
+
+// PublishBatch publishes messages with batched confirms on a channel of
+// its own, opened on first use and replaced once the broker closes it.
+func (r *RabbitMqClient) PublishBatch(ctx context.Context, routingKey string, messages []models.NotificationMessage) (BatchResult, error) {
+	if err := r.beginPublish(); err != nil {
+		return failedBatch(len(messages)), err
+	}
+	defer r.endPublish()
+	publisher, err := r.batchPublisher()
+	if err != nil {
+		return failedBatch(len(messages)), err
+	}
+	result, err := publisher.PublishBatch(ctx, routingKey, messages)
+	if errors.Is(err, ErrConfirmChannelClosed) {
+		r.batchMu.Lock()
+		if r.batch == publisher {
+			r.batch = nil
+		}
+		r.batchMu.Unlock()
+	}
+	return result, err
+}
+
+// failedBatch is the result of a batch of n messages none of which was
+// published.
+func failedBatch(n int) BatchResult {
+	result := BatchResult{Succeeded: []int{}, Failed: make([]int, n)}
+	for i := range result.Failed {
+		result.Failed[i] = i
+	}
+	return result
+}
+
+func (r *RabbitMqClient) batchPublisher() (*BatchPublisher, error) {
+	r.batchMu.Lock()
+	defer r.batchMu.Unlock()
+	if r.batch != nil {
+		return r.batch, nil
+	}
+	channel, err := r.openChannel()
+	if err != nil {
+		return nil, fmt.Errorf("error creating batch channel: %w", err)
+	}
+	publisher, err := NewBatchPublisher(channel, r.Config.Exchange, r.Environment, r.Config.PublishWindow)
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+	publisher.Clock = r.Clock
+	publisher.CompressAbove = r.compressAbove()
+	if r.Config.Mandatory {
+		publisher.Mandatory = true
+		r.watchReturns(channel)
+	}
+	r.batch = publisher
+	return publisher, nil
+}
+
+func (r *RabbitMqClient) EmailQueueName() string {
+	return r.Config.EmailQueue
+}
+func (r *RabbitMqClient) PushQueueName() string {
+	return r.Config.PushQueue
+}
+func (r *RabbitMqClient) WhatsAppQueueName() string {
+	return r.Config.WhatsAppQueue
+}
+func (r *RabbitMqClient) PublishEmail(ctx context.Context, message interface{}) error {
+	return r.Publish(ctx, r.routingKey(r.Config.EmailQueue, emailChannel, message), message)
+}
+func (r *RabbitMqClient) PublishPushNot(ctx context.Context, message interface{}) error {
+	return r.Publish(ctx, r.routingKey(r.Config.PushQueue, pushChannel, message), message)
+}
+func (r *RabbitMqClient) PublishWhatsApp(ctx context.Context, message interface{}) error {
+	return r.Publish(ctx, r.routingKey(r.Config.WhatsAppQueue, whatsAppChannel, message), message)
+}
+
+// Quarantine parks a refused delivery on the quarantine queue untouched,
+// adding the reason it was refused.
+func (r *RabbitMqClient) Quarantine(ctx context.Context, d amqp.Delivery, reason string) error {
+	if err := r.park(ctx, d, r.Config.QuarantineQueue, QuarantineReasonHeader, reason); err != nil {
+		return fmt.Errorf("failed to quarantine message: %w", err)
+	}
+	return nil
+}
+
+// Reject parks a delivery that failed permanently on the failed queue
+// untouched, adding the reason it failed.
+func (r *RabbitMqClient) Reject(ctx context.Context, d amqp.Delivery, reason string) error {
+	if err := r.park(ctx, d, r.Config.FailedQueue, FailedReasonHeader, reason); err != nil {
+		return fmt.Errorf("failed to reject message: %w", err)
+	}
+	return nil
+}
+
+// park republishes d to queueName with its headers, its original routing
+// key and reason under reasonHeader.
+func (r *RabbitMqClient) park(ctx context.Context, d amqp.Delivery, queueName, reasonHeader, reason string) error {
+	if err := r.beginPublish(); err != nil {
+		return err
+	}
+	defer r.endPublish()
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[reasonHeader] = reason
+	headers[OriginalRoutingKeyHeader] = d.RoutingKey
+
+	return liveChannel{r}.PublishWithContext(
+		ctx,
+		r.Config.Exchange,
+		queueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			Body:            d.Body,
+			DeliveryMode:    amqp.Persistent,
+			Timestamp:       d.Timestamp,
+			MessageId:       d.MessageId,
+			Headers:         headers,
+		},
+	)
+}
+
+// QueueDepth is a point-in-time view of one queue.
+type QueueDepth struct {
+	Name      string `json:"name"`
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+	Missing   bool   `json:"missing,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// QueueDepths reads the message and consumer counts of the configured
+// queues. A queue that cannot be read is reported on its own entry rather
+// than failing the whole call.
+func (r *RabbitMqClient) QueueDepths(ctx context.Context) []QueueDepth {
+	names := []string{r.Config.EmailQueue, r.Config.PushQueue, r.Config.WhatsAppQueue, r.Config.FailedQueue}
+	depths := make([]QueueDepth, 0, len(names))
+	for _, name := range names {
+		depths = append(depths, r.inspectQueue(ctx, name))
+	}
+	return depths
+}
+
+// inspectQueue does a passive declare on a throwaway channel: the broker
+// closes the channel when the queue does not exist, and that must not take
+// down the channel used for publishing.
+func (r *RabbitMqClient) inspectQueue(ctx context.Context, name string) QueueDepth {
+	depth := QueueDepth{Name: name}
+
+	type result struct {
+		queue amqp.Queue
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ch, err := r.openChannel()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer ch.Close()
+		q, err := ch.QueueDeclarePassive(name, true, false, false, false, nil)
+		done <- result{queue: q, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		depth.Error = "timed out"
+	case res := <-done:
+		var amqpErr *amqp.Error
+		switch {
+		case errors.As(res.err, &amqpErr) && amqpErr.Code == amqp.NotFound:
+			depth.Missing = true
+		case res.err != nil:
+			depth.Error = res.err.Error()
+		default:
+			depth.Messages = res.queue.Messages
+			depth.Consumers = res.queue.Consumers
+		}
+	}
+	return depth
+}
@@ -0,0 +1,275 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConnected is returned while the client is reconnecting to the
+// broker. It is worth retrying: the same call may succeed moments later.
+var ErrNotConnected = errors.New("not connected to rabbitmq")
+
+const (
+	defaultReconnectMinBackoff = 500 * time.Millisecond
+	defaultReconnectMaxBackoff = 30 * time.Second
+)
+
+// amqpConnection is the part of *amqp.Connection the client uses.
+type amqpConnection interface {
+	Channel() (*amqp.Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+// amqpChannel is the part of *amqp.Channel the client declares its topology
+// and publishes on.
+type amqpChannel interface {
+	RetryDeclarer
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	RetryPublisher
+	returnNotifier
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// dialFunc opens a connection and the channel the client publishes on.
+type dialFunc func(url string) (amqpConnection, amqpChannel, error)
+
+func dialAMQP(url string) (amqpConnection, amqpChannel, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to rabbitMQ: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("error creating rabbitmq channel: %w", err)
+	}
+	return conn, channel, nil
+}
+
+// supervise waits for the connection or its channel to close, then redials
+// until it gets a new one, declares the topology on it and swaps it in. It
+// returns once CloseConnection is called.
+func (r *RabbitMqClient) supervise(conn amqpConnection, channel amqpChannel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+		var reason *amqp.Error
+		select {
+		case <-r.closing:
+			return
+		case reason = <-connClosed:
+		case reason = <-channelClosed:
+		}
+		select {
+		case <-r.closing:
+			return
+		default:
+		}
+
+		log.Printf("rabbitmq connection lost (%v), reconnecting", reason)
+		r.setDisconnected()
+		// a lone channel closing takes the connection with it: consumers
+		// resubscribe either way, and one recovery path is easier to trust
+		conn.Close()
+
+		var ok bool
+		if conn, channel, ok = r.redial(); !ok {
+			return
+		}
+		if !r.setConnected(conn, channel) {
+			return
+		}
+		log.Print("rabbitmq reconnected")
+		r.Metrics.observeReconnect()
+	}
+}
+
+// redial dials with exponential backoff and jitter until a connection comes
+// up with the topology declared, or CloseConnection is called.
+func (r *RabbitMqClient) redial() (amqpConnection, amqpChannel, bool) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(r.backoff(attempt))
+			select {
+			case <-r.closing:
+				timer.Stop()
+				return nil, nil, false
+			case <-timer.C:
+			}
+		}
+		conn, channel, err := r.dial(r.Config.URL)
+		if err == nil {
+			if err = r.setUpTopology(channel); err != nil {
+				conn.Close()
+			}
+		}
+		if err == nil {
+			return conn, channel, true
+		}
+		r.mu.Lock()
+		r.failedAttempts++
+		r.mu.Unlock()
+		log.Printf("rabbitmq reconnect attempt %d failed: %v", attempt+1, err)
+	}
+}
+
+// backoff is the wait before the given redial attempt, counting from 1: it
+// doubles from the minimum up to the maximum, and a random half of it is
+// jitter so gateways restarted together don't redial in step.
+func (r *RabbitMqClient) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := r.Config.ReconnectMinBackoff, r.Config.ReconnectMaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultReconnectMinBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = max(defaultReconnectMaxBackoff, minBackoff)
+	}
+	d := minBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// setConnected swaps in a new connection. It reports false, closing conn,
+// if the client was closed meanwhile.
+func (r *RabbitMqClient) setConnected(conn amqpConnection, channel amqpChannel) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.closing:
+		conn.Close()
+		return false
+	default:
+	}
+	r.conn, r.channel = conn, channel
+	if r.Config.Mandatory {
+		r.watchReturns(channel)
+	}
+	r.connected = true
+	r.failedAttempts = 0
+	close(r.ready)
+	return true
+}
+
+// setDisconnected marks the connection down and drops the confirm-mode
+// publishers, whose channels went with it.
+func (r *RabbitMqClient) setDisconnected() {
+	r.mu.Lock()
+	if r.connected {
+		r.connected = false
+		r.ready = make(chan struct{})
+	}
+	r.mu.Unlock()
+	r.dropPublishers()
+}
+
+// awaitConnection returns once the client is connected, ctx ends, or the
+// client is closed.
+func (r *RabbitMqClient) awaitConnection(ctx context.Context) error {
+	r.mu.RLock()
+	ready := r.ready
+	// the connection can close a moment before supervise hears of it;
+	// don't hand it out meanwhile
+	dead := r.connected && r.conn.IsClosed()
+	r.mu.RUnlock()
+	if dead {
+		r.setDisconnected()
+		r.mu.RLock()
+		ready = r.ready
+		r.mu.RUnlock()
+	}
+	select {
+	case <-ready:
+		return nil
+	default:
+	}
+	select {
+	case <-ready:
+		return nil
+	case <-r.closing:
+		return ErrNotConnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitToPublish gives a reconnect in progress up to
+// Config.ReconnectPublishWait to finish before a publish fails with
+// ErrNotConnected.
+func (r *RabbitMqClient) waitToPublish(ctx context.Context) error {
+	waitCtx, cancel := context.WithTimeout(ctx, r.Config.ReconnectPublishWait)
+	defer cancel()
+	if err := r.awaitConnection(waitCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// ReconnectFailing reports whether the connection is down with no recovery
+// in sight: at least one attempt to bring it back has failed, or the client
+// was closed and won't try. A reconnect that is still on its first try
+// doesn't count.
+func (r *RabbitMqClient) ReconnectFailing() bool {
+	select {
+	case <-r.closing:
+		return true
+	default:
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.connected && r.failedAttempts > 0
+}
+
+// openChannel opens a channel on the current connection.
+func (r *RabbitMqClient) openChannel() (*amqp.Channel, error) {
+	r.mu.RLock()
+	conn, connected := r.conn, r.connected
+	r.mu.RUnlock()
+	if !connected || conn == nil {
+		return nil, ErrNotConnected
+	}
+	return conn.Channel()
+}
+
+// currentChannel is the publishing channel of the current connection. It
+// fails once the client is closed.
+func (r *RabbitMqClient) currentChannel() (amqpChannel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.channel == nil {
+		return nil, ErrNotConnected
+	}
+	return r.channel, nil
+}
+
+// liveChannel publishes on whichever channel is current, so a
+// RetryDispatcher outlives reconnects.
+type liveChannel struct {
+	client *RabbitMqClient
+}
+
+func (l liveChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if err := l.client.waitToPublish(ctx); err != nil {
+		return err
+	}
+	channel, err := l.client.currentChannel()
+	if err != nil {
+		return err
+	}
+	return channel.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
@@ -0,0 +1,351 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker hands out connections that close when the broker bounces, and
+// refuses dials while it is down.
+type fakeBroker struct {
+	mu        sync.Mutex
+	down      bool
+	dials     int
+	declared  int
+	conns     []*fakeBrokerConn
+	published []string
+	messages  []amqp.Publishing
+	// publishedTo is the exchange of each publish.
+	publishedTo []string
+	// mandatory is the mandatory flag of each publish.
+	mandatory []bool
+	// exchangeKinds are the declared exchanges' kinds, bindings the queues
+	// bound to each exchange.
+	exchangeKinds map[string]string
+	bindings      map[string][]string
+	// boundKeys are the keys each queue was bound with, on any exchange.
+	boundKeys map[string][]string
+	// queueArgs are the arguments each queue was last declared with.
+	queueArgs map[string]amqp.Table
+	// publishErrs fail the next publishes, one each.
+	publishErrs []error
+	// refuseDeclare fails every exchange declaration.
+	refuseDeclare bool
+	// inequivalentQueue, when set, names a queue that already exists with
+	// other arguments.
+	inequivalentQueue string
+	// publishDelay holds every publish up before the broker takes it.
+	publishDelay time.Duration
+	// vanishingQueue, when set, names a queue the broker drops as soon as
+	// it is declared; verified lists the passive declares.
+	vanishingQueue string
+	verified       []string
+}
+
+func (b *fakeBroker) dial(url string) (amqpConnection, amqpChannel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dials++
+	if b.down {
+		return nil, nil, errors.New("connection refused")
+	}
+	conn := &fakeBrokerConn{}
+	b.conns = append(b.conns, conn)
+	return conn, &fakeBrokerChannel{broker: b, conn: conn}, nil
+}
+
+// bounce takes the broker down, closing every connection, until up is called.
+func (b *fakeBroker) bounce() {
+	b.mu.Lock()
+	b.down = true
+	conns := b.conns
+	b.conns = nil
+	b.mu.Unlock()
+	for _, conn := range conns {
+		conn.closeWith(&amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED - broker shutdown"})
+	}
+}
+
+func (b *fakeBroker) up() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = false
+}
+
+func (b *fakeBroker) stats() (dials, declared, published int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dials, b.declared, len(b.published)
+}
+
+type fakeBrokerConn struct {
+	mu        sync.Mutex
+	closed    bool
+	listeners []chan *amqp.Error
+	// returns are the channels' return listeners, closed with it.
+	returns []chan amqp.Return
+}
+
+// returnMessage has the broker return ret to the connection's listeners,
+// reporting how many there were.
+func (c *fakeBrokerConn) returnMessage(ret amqp.Return) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, listener := range c.returns {
+		listener <- ret
+	}
+	return len(c.returns)
+}
+
+func (c *fakeBrokerConn) Channel() (*amqp.Channel, error) {
+	return nil, errors.New("fake connection opens no extra channels")
+}
+
+func (c *fakeBrokerConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		close(receiver)
+	} else {
+		c.listeners = append(c.listeners, receiver)
+	}
+	return receiver
+}
+
+func (c *fakeBrokerConn) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeBrokerConn) Close() error {
+	c.closeWith(nil)
+	return nil
+}
+
+func (c *fakeBrokerConn) closeWith(reason *amqp.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for _, listener := range c.listeners {
+		if reason != nil {
+			listener <- reason
+		}
+		close(listener)
+	}
+	c.listeners = nil
+	for _, listener := range c.returns {
+		close(listener)
+	}
+	c.returns = nil
+}
+
+// fakeBrokerChannel closes along with its connection.
+type fakeBrokerChannel struct {
+	broker *fakeBroker
+	conn   *fakeBrokerConn
+}
+
+func (c *fakeBrokerChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.broker.mu.Lock()
+	refuse := c.broker.refuseDeclare
+	c.broker.mu.Unlock()
+	if refuse {
+		return &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED"}
+	}
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.broker.exchangeKinds == nil {
+		c.broker.exchangeKinds = map[string]string{}
+	}
+	c.broker.exchangeKinds[name] = kind
+	if name == "notifications.direct" {
+		c.broker.declared++
+	}
+	return nil
+}
+
+func (c *fakeBrokerChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if name != "" && name == c.broker.inequivalentQueue {
+		return amqp.Queue{}, &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'x-max-priority'"}
+	}
+	if c.broker.queueArgs == nil {
+		c.broker.queueArgs = map[string]amqp.Table{}
+	}
+	c.broker.queueArgs[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeBrokerChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.verified = append(c.broker.verified, name)
+	if _, ok := c.broker.exchangeKinds[name]; !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange '" + name + "'"}
+	}
+	return nil
+}
+
+func (c *fakeBrokerChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.verified = append(c.broker.verified, name)
+	if _, ok := c.broker.queueArgs[name]; !ok || name == c.broker.vanishingQueue {
+		return amqp.Queue{}, &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no queue '" + name + "'"}
+	}
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeBrokerChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.broker.bindings == nil {
+		c.broker.bindings = map[string][]string{}
+	}
+	c.broker.bindings[exchange] = append(c.broker.bindings[exchange], name)
+	if c.broker.boundKeys == nil {
+		c.broker.boundKeys = map[string][]string{}
+	}
+	c.broker.boundKeys[name] = append(c.broker.boundKeys[name], key)
+	return nil
+}
+
+func (c *fakeBrokerChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if c.conn.IsClosed() {
+		return amqp.ErrClosed
+	}
+	c.broker.mu.Lock()
+	delay := c.broker.publishDelay
+	c.broker.mu.Unlock()
+	time.Sleep(delay)
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if len(c.broker.publishErrs) > 0 {
+		err := c.broker.publishErrs[0]
+		c.broker.publishErrs = c.broker.publishErrs[1:]
+		return err
+	}
+	c.broker.published = append(c.broker.published, key)
+	c.broker.messages = append(c.broker.messages, msg)
+	c.broker.publishedTo = append(c.broker.publishedTo, exchange)
+	c.broker.mandatory = append(c.broker.mandatory, mandatory)
+	return nil
+}
+
+func (c *fakeBrokerChannel) NotifyReturn(receiver chan amqp.Return) chan amqp.Return {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	if c.conn.closed {
+		close(receiver)
+	} else {
+		c.conn.returns = append(c.conn.returns, receiver)
+	}
+	return receiver
+}
+
+func (c *fakeBrokerChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	return c.conn.NotifyClose(receiver)
+}
+
+func (c *fakeBrokerChannel) Close() error {
+	return nil
+}
+
+func reconnectConfig(publishWait time.Duration) config.RabbitMQConfig {
+	return config.RabbitMQConfig{
+		Exchange:             "notifications.direct",
+		EmailQueue:           "email.queue",
+		PushQueue:            "push.queue",
+		FailedQueue:          "failed.queue",
+		ReconnectMinBackoff:  5 * time.Millisecond,
+		ReconnectMaxBackoff:  20 * time.Millisecond,
+		ReconnectPublishWait: publishWait,
+	}
+}
+
+func TestRabbitMqClient_ReconnectsAfterBrokerBounce(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(50*time.Millisecond), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	ctx := context.Background()
+	require.True(t, client.IsConnected())
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-1"}))
+
+	broker.bounce()
+	require.Eventually(t, client.ReconnectFailing, time.Second, time.Millisecond)
+	assert.False(t, client.IsConnected())
+
+	// the broker stays down past the publish wait: fail with a retriable error
+	err = client.PublishEmail(ctx, models.NotificationMessage{ID: "n-2"})
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	broker.up()
+	require.Eventually(t, client.IsConnected, time.Second, time.Millisecond)
+	assert.False(t, client.ReconnectFailing())
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-3"}))
+
+	dials, declared, published := broker.stats()
+	assert.Greater(t, dials, 2, "redialled with backoff while the broker was down")
+	assert.Equal(t, 2, declared, "topology declared on connect and again on the new connection")
+	assert.Equal(t, 2, published)
+}
+
+func TestRabbitMqClient_PublishWaitsOutAShortBounce(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(time.Second), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	broker.bounce()
+	require.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, time.Millisecond)
+	time.AfterFunc(20*time.Millisecond, broker.up)
+
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+	_, _, published := broker.stats()
+	assert.Equal(t, 1, published)
+}
+
+func TestRabbitMqClient_CloseStopsReconnecting(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+
+	broker.bounce()
+	require.Eventually(t, client.ReconnectFailing, time.Second, time.Millisecond)
+	require.NoError(t, client.CloseConnection())
+
+	dials, _, _ := broker.stats()
+	time.Sleep(50 * time.Millisecond)
+	after, _, _ := broker.stats()
+	assert.LessOrEqual(t, after, dials+1, "at most the dial in flight at close")
+
+	err = client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
+
+func TestRabbitMqClient_Backoff(t *testing.T) {
+	client := &RabbitMqClient{Config: reconnectConfig(0)}
+	for i := 0; i < 20; i++ {
+		first := client.backoff(1)
+		assert.GreaterOrEqual(t, first, 2500*time.Microsecond)
+		assert.LessOrEqual(t, first, 5*time.Millisecond)
+		assert.LessOrEqual(t, client.backoff(30), 20*time.Millisecond)
+		assert.GreaterOrEqual(t, client.backoff(30), 10*time.Millisecond)
+	}
+}
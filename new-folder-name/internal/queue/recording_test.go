@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recordedMessage() models.NotificationMessage {
+	return models.NotificationMessage{
+		ID:            "n-1",
+		TenantID:      "shop-a",
+		Type:          "email",
+		UserID:        "user123",
+		TemplateID:    "welcome",
+		CorrelationID: "req-1",
+		Variables: map[string]interface{}{
+			"name":  "Ada Lovelace",
+			"order": map[string]interface{}{"total": 42.5, "items": []interface{}{"Notebook"}},
+			"vip":   true,
+		},
+		Metadata:     map[string]string{"campaign": "spring"},
+		Overrides:    &models.Overrides{RecipientEmail: "ada@example.com"},
+		CC:           []string{"user456"},
+		DeviceTokens: []string{"token-1"},
+		Attachments:  []models.Attachment{{URL: "https://files.example.com/signed?sig=abc", Filename: "invoice.pdf"}},
+	}
+}
+
+func TestRecording_RoundTripIsRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	recordedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, WriteRecording(&buf, "req-1", []models.NotificationMessage{recordedMessage()}, recordedAt))
+	for _, secret := range []string{"Ada Lovelace", "user123", "user456", "ada@example.com", "spring", "token-1", "sig=abc", "Notebook"} {
+		assert.NotContains(t, buf.String(), secret)
+	}
+
+	rec, err := ReadRecording(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, RecordingVersion, rec.Version)
+	assert.Equal(t, recordedAt, rec.RecordedAt)
+	assert.Equal(t, "req-1", rec.CorrelationID)
+	require.Len(t, rec.Messages, 1)
+
+	msg := rec.Messages[0]
+	assert.Equal(t, "welcome", msg.TemplateID)
+	assert.Equal(t, "shop-a", msg.TenantID)
+	assert.Equal(t, map[string]interface{}{
+		"name":  redacted,
+		"order": map[string]interface{}{"total": 42.5, "items": []interface{}{redacted}},
+		"vip":   true,
+	}, msg.Variables)
+	assert.Equal(t, map[string]string{"campaign": redacted}, msg.Metadata)
+	assert.Equal(t, "invoice.pdf", msg.Attachments[0].Filename)
+}
+
+func TestReadRecording_Versions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"newer version", `{"version":2,"messages":[]}`},
+		{"no version", `{"messages":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadRecording(strings.NewReader(tt.body))
+			assert.ErrorIs(t, err, ErrUnsupportedRecording)
+		})
+	}
+
+	_, err := ReadRecording(strings.NewReader(`not json`))
+	assert.Error(t, err)
+}
+
+func TestReplay_FilesystemSender(t *testing.T) {
+	templates, out := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templates, "welcome.tmpl"), []byte("Hi {{.name}}, your total is {{.order.total}}"), 0o644))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecording(&buf, "req-1", []models.NotificationMessage{recordedMessage()}, time.Now()))
+	rec, err := ReadRecording(&buf)
+	require.NoError(t, err)
+
+	sender := FilesystemEmailSender{TemplateDir: templates, OutDir: out}
+	status := &fakeStatusRecorder{}
+	require.NoError(t, Replay(context.Background(), rec, NewEmailWorker(sender, status).Handle))
+
+	rendered, err := os.ReadFile(sender.OutputPath(rec.Messages[0]))
+	require.NoError(t, err)
+	assert.Equal(t, "Hi [redacted], your total is 42.5", string(rendered))
+	assert.Equal(t, []string{"processing", "sent"}, status.statuses)
+
+	t.Run("template edits that need a variable the message lacks", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(templates, "welcome.tmpl"), []byte("Hi {{.nickname}}"), 0o644))
+		status := &fakeStatusRecorder{}
+
+		err := Replay(context.Background(), rec, NewEmailWorker(sender, status).Handle)
+		assert.ErrorContains(t, err, "nickname")
+		assert.Equal(t, []string{"processing", "failed"}, status.statuses)
+	})
+}
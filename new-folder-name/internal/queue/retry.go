@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// RetryAttemptHeader counts how many times a message has been retried.
+	RetryAttemptHeader = "x-retry-attempt"
+	// RetryDelayHeader selects the wait queue on the retry exchange.
+	RetryDelayHeader = "x-retry-delay"
+)
+
+var defaultRetryDelays = []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute, time.Hour}
+
+const defaultMaxRetryAttempts = 5
+
+// WaitQueue holds retried messages for Delay, then dead-letters them back
+// to the working exchange under their original routing key.
+type WaitQueue struct {
+	Name  string
+	Delay time.Duration
+}
+
+// WaitQueues returns the wait queues for delays, shortest first.
+func WaitQueues(delays []time.Duration) []WaitQueue {
+	if len(delays) == 0 {
+		delays = defaultRetryDelays
+	}
+	queues := make([]WaitQueue, 0, len(delays))
+	for _, delay := range delays {
+		queues = append(queues, WaitQueue{Name: "retry.wait." + formatDelay(delay), Delay: delay})
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Delay < queues[j].Delay })
+	return queues
+}
+
+// formatDelay writes 30s, 2m, 1h rather than time.Duration's 2m0s.
+func formatDelay(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// RetryDeclarer is the subset of *amqp.Channel used to declare the retry
+// topology.
+type RetryDeclarer interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+}
+
+// declareRetryQueues declares the retry exchange and a wait queue per delay.
+// The retry exchange matches on RetryDelayHeader, so a retried message keeps
+// its original routing key and the broker dead-letters it straight back to
+// the queue it came from once the wait queue's TTL runs out. The wait queues
+// also get typeArgs, the arguments of the configured queue type.
+func declareRetryQueues(ch RetryDeclarer, workingExchange, retryExchange string, queues []WaitQueue, typeArgs amqp.Table) error {
+	if err := ch.ExchangeDeclare(retryExchange, amqp.ExchangeHeaders, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare retry exchange %s: %w", retryExchange, err)
+	}
+	for _, wq := range queues {
+		args := amqp.Table{
+			"x-message-ttl":          wq.Delay.Milliseconds(),
+			"x-dead-letter-exchange": workingExchange,
+		}
+		for k, v := range typeArgs {
+			args[k] = v
+		}
+		if _, err := ch.QueueDeclare(wq.Name, true, false, false, false, args); err != nil {
+			return fmt.Errorf("failed to declare wait queue %s: %w", wq.Name, err)
+		}
+		binding := amqp.Table{"x-match": "all", RetryDelayHeader: formatDelay(wq.Delay)}
+		if err := ch.QueueBind(wq.Name, "", retryExchange, false, binding); err != nil {
+			return fmt.Errorf("failed to bind wait queue %s: %w", wq.Name, err)
+		}
+	}
+	return nil
+}
+
+// RetryPublisher is the subset of *amqp.Channel used by RetryDispatcher.
+type RetryPublisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// RetryDispatcher sends failed deliveries to the broker to wait out their
+// backoff, so nothing is held in worker memory across a restart.
+type RetryDispatcher struct {
+	channel       RetryPublisher
+	retryExchange string
+	exchange      string
+	failedQueue   string
+	queues        []WaitQueue
+	maxAttempts   int
+	// Backoff returns how long to wait before the given attempt, counting
+	// from 1.
+	Backoff func(attempt int) time.Duration
+}
+
+func NewRetryDispatcher(channel RetryPublisher, exchange, retryExchange, failedQueue string, delays []time.Duration, maxAttempts int) *RetryDispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxRetryAttempts
+	}
+	return &RetryDispatcher{
+		channel:       channel,
+		retryExchange: retryExchange,
+		exchange:      exchange,
+		failedQueue:   failedQueue,
+		queues:        WaitQueues(delays),
+		maxAttempts:   maxAttempts,
+		Backoff:       ExponentialBackoff(30*time.Second, time.Hour),
+	}
+}
+
+// ExponentialBackoff quadruples base on every attempt up to max.
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		backoff := base
+		for i := 1; i < attempt && backoff < max; i++ {
+			backoff *= 4
+		}
+		if backoff > max {
+			backoff = max
+		}
+		return backoff
+	}
+}
+
+// WaitQueueFor picks the wait queue whose delay is nearest backoff. A tie
+// goes to the longer delay so a retry never comes back sooner than asked.
+func (r *RetryDispatcher) WaitQueueFor(backoff time.Duration) WaitQueue {
+	best := r.queues[0]
+	for _, wq := range r.queues[1:] {
+		if absDuration(wq.Delay-backoff) <= absDuration(best.Delay-backoff) {
+			best = wq
+		}
+	}
+	return best
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Retry republishes d to the wait queue for its next attempt, or to the
+// failed queue, with reason in FailedReasonHeader, once it has used up its
+// attempts. The caller acks d after a nil return.
+func (r *RetryDispatcher) Retry(ctx context.Context, d amqp.Delivery, reason string) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	routingKey, _ := headers[OriginalRoutingKeyHeader].(string)
+	if routingKey == "" {
+		routingKey = d.RoutingKey
+		headers[OriginalRoutingKeyHeader] = routingKey
+	}
+	attempt := retryAttempt(d.Headers) + 1
+	headers[RetryAttemptHeader] = int32(attempt)
+
+	exchange, key := r.exchange, r.failedQueue
+	if attempt <= r.maxAttempts {
+		wq := r.WaitQueueFor(r.Backoff(attempt))
+		headers[RetryDelayHeader] = formatDelay(wq.Delay)
+		exchange, key = r.retryExchange, routingKey
+	} else {
+		delete(headers, RetryDelayHeader)
+		headers[FailedReasonHeader] = reason
+	}
+
+	err := r.channel.PublishWithContext(ctx, exchange, key, false, false, amqp.Publishing{
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		Body:            d.Body,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        d.Priority,
+		Timestamp:       d.Timestamp,
+		MessageId:       d.MessageId,
+		Headers:         headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule retry of %s: %w", d.MessageId, err)
+	}
+	return nil
+}
+
+// LastAttempt reports whether d has used up its retries, so Retry would
+// send it to the failed queue.
+func (r *RetryDispatcher) LastAttempt(d amqp.Delivery) bool {
+	return retryAttempt(d.Headers) >= r.maxAttempts
+}
+
+type lastAttemptKey struct{}
+
+func withLastAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lastAttemptKey{}, true)
+}
+
+// IsLastAttempt reports whether the delivery being handled on ctx won't be
+// tried again if it fails, transiently or not: the consumer parks it in
+// the failed queue instead.
+func IsLastAttempt(ctx context.Context) bool {
+	last, _ := ctx.Value(lastAttemptKey{}).(bool)
+	return last
+}
+
+// retryAttempt reads RetryAttemptHeader, which the broker may hand back as
+// any integer width.
+func retryAttempt(headers amqp.Table) int {
+	switch v := headers[RetryAttemptHeader].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type publishCall struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+// fakeRetryChannel records declarations and publishes.
+type fakeRetryChannel struct {
+	exchanges map[string]string
+	queues    map[string]amqp.Table
+	bindings  map[string]amqp.Table
+	published []publishCall
+}
+
+func newFakeRetryChannel() *fakeRetryChannel {
+	return &fakeRetryChannel{
+		exchanges: map[string]string{},
+		queues:    map[string]amqp.Table{},
+		bindings:  map[string]amqp.Table{},
+	}
+}
+
+func (f *fakeRetryChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	f.exchanges[name] = kind
+	return nil
+}
+
+func (f *fakeRetryChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	f.queues[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (f *fakeRetryChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	f.bindings[name] = args
+	return nil
+}
+
+func (f *fakeRetryChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.published = append(f.published, publishCall{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+// deadLetter is what a consumer of the working queue receives once the wait
+// queue's TTL runs out: the broker keeps the routing key and headers.
+func deadLetter(call publishCall) amqp.Delivery {
+	return amqp.Delivery{
+		RoutingKey:  call.key,
+		Headers:     call.msg.Headers,
+		Body:        call.msg.Body,
+		MessageId:   call.msg.MessageId,
+		ContentType: call.msg.ContentType,
+	}
+}
+
+func TestDeclareRetryQueues(t *testing.T) {
+	ch := newFakeRetryChannel()
+	queues := WaitQueues([]time.Duration{time.Hour, 30 * time.Second, 2 * time.Minute, 10 * time.Minute})
+
+	require.NoError(t, declareRetryQueues(ch, "notifications.direct", "notifications.retry", queues, nil))
+
+	assert.Equal(t, amqp.ExchangeHeaders, ch.exchanges["notifications.retry"])
+	assert.Equal(t, []string{"retry.wait.30s", "retry.wait.2m", "retry.wait.10m", "retry.wait.1h"},
+		[]string{queues[0].Name, queues[1].Name, queues[2].Name, queues[3].Name})
+	assert.Equal(t, amqp.Table{"x-message-ttl": int64(120000), "x-dead-letter-exchange": "notifications.direct"},
+		ch.queues["retry.wait.2m"])
+	assert.Equal(t, amqp.Table{"x-match": "all", RetryDelayHeader: "2m"}, ch.bindings["retry.wait.2m"])
+}
+
+func TestRetryDispatcher_WaitQueueFor(t *testing.T) {
+	r := NewRetryDispatcher(newFakeRetryChannel(), "notifications.direct", "notifications.retry", "failed.queue", nil, 0)
+
+	tests := []struct {
+		backoff time.Duration
+		want    string
+	}{
+		{0, "retry.wait.30s"},
+		{10 * time.Second, "retry.wait.30s"},
+		{75 * time.Second, "retry.wait.2m"}, // equidistant from 30s and 2m
+		{5 * time.Minute, "retry.wait.2m"},
+		{8 * time.Minute, "retry.wait.10m"},
+		{40 * time.Minute, "retry.wait.1h"},
+		{24 * time.Hour, "retry.wait.1h"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, r.WaitQueueFor(tt.backoff).Name, "backoff %s", tt.backoff)
+	}
+}
+
+func TestRetryDispatcher_HeadersSurviveRoundTrip(t *testing.T) {
+	ch := newFakeRetryChannel()
+	r := NewRetryDispatcher(ch, "notifications.direct", "notifications.retry", "failed.queue", nil, 3)
+	ctx := context.Background()
+
+	d := amqp.Delivery{
+		RoutingKey: "email.queue",
+		MessageId:  "msg-1",
+		Body:       []byte(`{"id":"n-1"}`),
+		Headers:    amqp.Table{EnvironmentHeader: "production", TenantHeader: "acme"},
+	}
+	wantDelays := []string{"30s", "2m", "10m"}
+	for i, delay := range wantDelays {
+		require.NoError(t, r.Retry(ctx, d, "smtp timeout"))
+		call := ch.published[i]
+		assert.Equal(t, "notifications.retry", call.exchange)
+		assert.Equal(t, "email.queue", call.key)
+		assert.Equal(t, delay, call.msg.Headers[RetryDelayHeader])
+		assert.Equal(t, int32(i+1), call.msg.Headers[RetryAttemptHeader])
+		assert.Equal(t, "email.queue", call.msg.Headers[OriginalRoutingKeyHeader])
+		assert.Equal(t, "production", call.msg.Headers[EnvironmentHeader])
+		assert.Equal(t, "acme", call.msg.Headers[TenantHeader])
+		assert.Equal(t, d.Body, call.msg.Body)
+		d = deadLetter(call)
+	}
+
+	// out of attempts
+	require.NoError(t, r.Retry(ctx, d, "smtp timeout"))
+	last := ch.published[len(ch.published)-1]
+	assert.Equal(t, "notifications.direct", last.exchange)
+	assert.Equal(t, "failed.queue", last.key)
+	assert.Equal(t, int32(4), last.msg.Headers[RetryAttemptHeader])
+	assert.Equal(t, "email.queue", last.msg.Headers[OriginalRoutingKeyHeader])
+	assert.Equal(t, "smtp timeout", last.msg.Headers[FailedReasonHeader])
+	assert.NotContains(t, last.msg.Headers, RetryDelayHeader)
+}
+
+// settleRetries settles a delivery with r as the consumer does, handing
+// each retry back once its wait is over as the broker would, until the
+// handler succeeds or the delivery is parked. It returns how each attempt
+// was settled and whether the handler was told it was the last.
+func settleRetries(t *testing.T, r *RetryDispatcher, ch *fakeRetryChannel, handler DeliveryHandler) ([]string, []bool) {
+	t.Helper()
+	acks := newFakeChannel(0)
+	d := amqp.Delivery{Acknowledger: acks, DeliveryTag: 1, RoutingKey: "email.queue", MessageId: "msg-1", Body: []byte(`{"id":"n-1"}`)}
+	var outcomes []string
+	var last []bool
+	for tag := uint64(2); ; tag++ {
+		outcome := settle(context.Background(), "email.queue", func(ctx context.Context, d amqp.Delivery) error {
+			last = append(last, IsLastAttempt(ctx))
+			return handler(ctx, d)
+		}, nil, r, d)
+		outcomes = append(outcomes, outcome)
+		if outcome != settledRetried {
+			break
+		}
+		d = deadLetter(ch.published[len(ch.published)-1])
+		d.Acknowledger, d.DeliveryTag = acks, tag
+	}
+	for tag, outcome := range acks.outcomes {
+		assert.Equal(t, "ack", outcome, "delivery %d is acked once republished", tag)
+	}
+	return outcomes, last
+}
+
+func TestSettle_RetriesUntilSuccess(t *testing.T) {
+	ch := newFakeRetryChannel()
+	r := NewRetryDispatcher(ch, "notifications.direct", "notifications.retry", "failed.queue", nil, 5)
+	failures := 2
+	outcomes, last := settleRetries(t, r, ch, func(ctx context.Context, d amqp.Delivery) error {
+		if failures > 0 {
+			failures--
+			return Transient(assert.AnError)
+		}
+		return nil
+	})
+
+	assert.Equal(t, []string{settledRetried, settledRetried, settledAcked}, outcomes)
+	assert.Equal(t, []bool{false, false, false}, last)
+	require.Len(t, ch.published, 2)
+	for _, call := range ch.published {
+		assert.Equal(t, "notifications.retry", call.exchange)
+	}
+}
+
+func TestSettle_RetriesExhausted(t *testing.T) {
+	ch := newFakeRetryChannel()
+	r := NewRetryDispatcher(ch, "notifications.direct", "notifications.retry", "failed.queue", nil, 0)
+	outcomes, last := settleRetries(t, r, ch, func(ctx context.Context, d amqp.Delivery) error {
+		return fmt.Errorf("smtp: %w", Transient(errors.New("connection refused")))
+	})
+
+	// the first attempt and the default five retries
+	require.Len(t, outcomes, defaultMaxRetryAttempts+1)
+	assert.Equal(t, settledRejected, outcomes[len(outcomes)-1])
+	assert.Equal(t, []bool{false, false, false, false, false, true}, last)
+	parked := ch.published[len(ch.published)-1]
+	assert.Equal(t, "failed.queue", parked.key)
+	assert.Equal(t, int32(defaultMaxRetryAttempts+1), parked.msg.Headers[RetryAttemptHeader])
+	assert.Equal(t, "smtp: connection refused", parked.msg.Headers[FailedReasonHeader])
+}
+
+func TestRetryAttempt_IntegerWidths(t *testing.T) {
+	for _, v := range []interface{}{int(2), int16(2), int32(2), int64(2)} {
+		assert.Equal(t, 2, retryAttempt(amqp.Table{RetryAttemptHeader: v}))
+	}
+	assert.Zero(t, retryAttempt(nil))
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// returnBuffer bounds how many returned messages can wait on the goroutine
+// parking them before the connection's reader blocks.
+const returnBuffer = 64
+
+// returnParkTimeout bounds parking one returned message.
+const returnParkTimeout = 5 * time.Second
+
+// ReturnObserver is told of every message the broker returned as
+// unroutable. The metrics package implements it; an Observer that doesn't
+// isn't told.
+type ReturnObserver interface {
+	ObserveReturn(routingKey string)
+}
+
+// returnNotifier is the part of *amqp.Channel that hands out returned
+// messages.
+type returnNotifier interface {
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+}
+
+// watchReturns parks the messages returned on channel until it closes.
+// Every channel published on with the mandatory flag needs it, so it is
+// called again for the channels opened after a reconnect.
+func (r *RabbitMqClient) watchReturns(channel returnNotifier) {
+	returns := channel.NotifyReturn(make(chan amqp.Return, returnBuffer))
+	go func() {
+		for ret := range returns {
+			r.handleReturn(ret)
+		}
+	}()
+}
+
+// handleReturn logs and counts a returned message and parks it on the
+// failed queue, with the reason and the routing key it was published to.
+// The park is published without the mandatory flag, so a missing failed
+// queue can't return it again.
+func (r *RabbitMqClient) handleReturn(ret amqp.Return) {
+	log.Printf("rabbitmq returned message %s published to %q on %q: %d %s",
+		ret.MessageId, ret.RoutingKey, ret.Exchange, ret.ReplyCode, ret.ReplyText)
+	if observer, ok := r.Observer.(ReturnObserver); ok {
+		observer.ObserveReturn(ret.RoutingKey)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), returnParkTimeout)
+	defer cancel()
+	d := amqp.Delivery{
+		Headers:     ret.Headers,
+		ContentType: ret.ContentType,
+		MessageId:   ret.MessageId,
+		Timestamp:   ret.Timestamp,
+		RoutingKey:  ret.RoutingKey,
+		Body:        ret.Body,
+	}
+	reason := fmt.Sprintf("unroutable: %d %s", ret.ReplyCode, ret.ReplyText)
+	if err := r.park(ctx, d, r.Config.FailedQueue, FailedReasonHeader, reason); err != nil {
+		log.Printf("failed to park returned message %s: %v", ret.MessageId, err)
+	}
+}
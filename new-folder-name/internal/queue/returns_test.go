@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// returnObserver counts the messages returned, as well as the retries.
+type returnObserver struct {
+	retryObserver
+	returned map[string]int
+}
+
+func (o *returnObserver) ObserveReturn(routingKey string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.returned == nil {
+		o.returned = map[string]int{}
+	}
+	o.returned[routingKey]++
+}
+
+func (o *returnObserver) returns(routingKey string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.returned[routingKey]
+}
+
+func (b *fakeBroker) latestConn() *fakeBrokerConn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conns[len(b.conns)-1]
+}
+
+// parked returns the messages published to the failed queue.
+func (b *fakeBroker) parked() []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var parked []amqp.Publishing
+	for i, key := range b.published {
+		if key == "failed.queue" {
+			parked = append(parked, b.messages[i])
+		}
+	}
+	return parked
+}
+
+func TestMandatory_ReturnedMessagesAreParked(t *testing.T) {
+	cfg := reconnectConfig(time.Second)
+	cfg.Mandatory = true
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+	observer := &returnObserver{}
+	client.Observer = observer
+
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+	assert.Equal(t, []bool{true}, broker.mandatory)
+
+	ret := amqp.Return{
+		ReplyCode:   amqp.NoRoute,
+		ReplyText:   "NO_ROUTE",
+		Exchange:    "notifications.direct",
+		RoutingKey:  "email.queue",
+		MessageId:   "n-1",
+		ContentType: "application/json",
+		Headers:     amqp.Table{"x-environment": "test"},
+		Body:        []byte(`{"id":"n-1"}`),
+	}
+	require.Equal(t, 1, broker.latestConn().returnMessage(ret))
+	require.Eventually(t, func() bool { return len(broker.parked()) == 1 }, time.Second, time.Millisecond)
+
+	parked := broker.parked()[0]
+	assert.Equal(t, "n-1", parked.MessageId)
+	assert.Equal(t, ret.Body, parked.Body)
+	assert.Equal(t, "unroutable: 312 NO_ROUTE", parked.Headers[FailedReasonHeader])
+	assert.Equal(t, "email.queue", parked.Headers[OriginalRoutingKeyHeader])
+	assert.Equal(t, "test", parked.Headers["x-environment"])
+	assert.Equal(t, []bool{true, false}, broker.mandatory, "the park can't be returned again")
+	assert.Equal(t, 1, observer.returns("email.queue"))
+}
+
+func TestMandatory_ListenerSurvivesReconnect(t *testing.T) {
+	cfg := reconnectConfig(time.Second)
+	cfg.Mandatory = true
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	first := broker.latestConn()
+	broker.bounce()
+	require.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, time.Millisecond)
+	broker.up()
+	require.Eventually(t, client.IsConnected, time.Second, time.Millisecond)
+	require.NotSame(t, first, broker.latestConn())
+
+	require.Equal(t, 1, broker.latestConn().returnMessage(amqp.Return{RoutingKey: "push.queue", MessageId: "n-2"}),
+		"the new channel has a listener")
+	require.Eventually(t, func() bool { return len(broker.parked()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, "n-2", broker.parked()[0].MessageId)
+}
+
+func TestMandatory_Off(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+	assert.Equal(t, []bool{false}, broker.mandatory)
+	assert.Zero(t, broker.latestConn().returnMessage(amqp.Return{}), "no return listener")
+}
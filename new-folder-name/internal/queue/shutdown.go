@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrShuttingDown is returned by publishes made once Drain has started.
+var ErrShuttingDown = errors.New("rabbitmq client is shutting down")
+
+// beginPublish counts a publish in, unless the client is draining. Every
+// publish it lets through must call endPublish.
+func (r *RabbitMqClient) beginPublish() error {
+	r.drainMu.RLock()
+	defer r.drainMu.RUnlock()
+	if r.draining {
+		return ErrShuttingDown
+	}
+	r.inflight.Add(1)
+	return nil
+}
+
+func (r *RabbitMqClient) endPublish() {
+	r.inflight.Done()
+}
+
+// Drain shuts the client down without losing publishes: it refuses new
+// ones with ErrShuttingDown, waits for those under way to finish,
+// confirms included, and then closes the connection as CloseConnection
+// does. When ctx ends first it closes the connection anyway, failing what
+// is left, and returns ctx's error. Not to be confused with the Drain
+// function, which empties a queue.
+func (r *RabbitMqClient) Drain(ctx context.Context) error {
+	r.drainMu.Lock()
+	r.draining = true
+	r.drainMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.inflight.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if closeErr := r.CloseConnection(); err == nil {
+		err = closeErr
+	}
+	return err
+}
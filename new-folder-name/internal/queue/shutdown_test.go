@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain_ConcurrentSenders(t *testing.T) {
+	broker := &fakeBroker{publishDelay: time.Millisecond}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+
+	// senders publish until they are refused; every publish that returned
+	// nil must have reached the broker
+	var mu sync.Mutex
+	var accepted []string
+	var wg sync.WaitGroup
+	started := make(chan struct{}, 8)
+	for sender := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				id := fmt.Sprintf("n-%d-%d", sender, i)
+				err := client.PublishEmail(context.Background(), models.NotificationMessage{ID: id})
+				if errors.Is(err, ErrShuttingDown) {
+					return
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				accepted = append(accepted, id)
+				mu.Unlock()
+				if i == 0 {
+					started <- struct{}{}
+				}
+			}
+		}()
+	}
+	for range 8 {
+		<-started
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Drain(ctx))
+	wg.Wait()
+
+	published := map[string]bool{}
+	broker.mu.Lock()
+	for _, msg := range broker.messages {
+		published[msg.MessageId] = true
+	}
+	broker.mu.Unlock()
+	require.NotEmpty(t, accepted)
+	for _, id := range accepted {
+		assert.True(t, published[id], "%s was accepted but never reached the broker", id)
+	}
+	assert.False(t, client.IsConnected())
+	assert.ErrorIs(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "late"}), ErrShuttingDown)
+}
+
+func TestDrain_WaitsForPublish(t *testing.T) {
+	broker := &fakeBroker{publishDelay: 50 * time.Millisecond}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+
+	published := make(chan error, 1)
+	go func() {
+		published <- client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	}()
+	// the publish is held up at the broker
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, client.Drain(context.Background()))
+
+	require.NoError(t, <-published)
+	_, _, n := broker.stats()
+	assert.Equal(t, 1, n)
+}
+
+func TestDrain_Deadline(t *testing.T) {
+	broker := &fakeBroker{publishDelay: time.Second}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+
+	go client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, client.Drain(ctx), context.DeadlineExceeded)
+	assert.False(t, client.IsConnected(), "the connection is closed anyway")
+}
+
+func TestDrain_Batch(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+	require.NoError(t, client.Drain(context.Background()))
+
+	result, err := client.PublishBatch(context.Background(), "email.queue", make([]models.NotificationMessage, 2))
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	assert.Equal(t, []int{0, 1}, result.Failed)
+}
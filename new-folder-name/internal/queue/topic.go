@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange types for Config.ExchangeType.
+const (
+	DirectExchange = "direct"
+	TopicExchange  = "topic"
+)
+
+// topicKeyPrefix starts every routing key a topic exchange is published
+// to.
+const topicKeyPrefix = "notification"
+
+// The channels routing keys name, whatever the message's own type: push
+// topic broadcasts go out on the push queue as push.
+const (
+	emailChannel    = "email"
+	pushChannel     = "push"
+	whatsAppChannel = "whatsapp"
+)
+
+// topic reports whether the working exchange is a topic exchange.
+func (r *RabbitMqClient) topic() bool {
+	return r.Config.ExchangeType == TopicExchange
+}
+
+// exchangeKind is the type the working exchange is declared as.
+func (r *RabbitMqClient) exchangeKind() string {
+	if r.topic() {
+		return amqp.ExchangeTopic
+	}
+	return amqp.ExchangeDirect
+}
+
+func (r *RabbitMqClient) validateExchangeType() error {
+	switch r.Config.ExchangeType {
+	case "", DirectExchange, TopicExchange:
+		return nil
+	}
+	return fmt.Errorf("rabbitmq.exchange_type must be %q or %q, got %q", DirectExchange, TopicExchange, r.Config.ExchangeType)
+}
+
+// routingKey is the key a message for queueName, on channel, is published
+// under: the queue's name with a direct exchange, topicRoutingKey with a
+// topic one.
+func (r *RabbitMqClient) routingKey(queueName, channel string, message interface{}) string {
+	if !r.topic() {
+		return queueName
+	}
+	return topicRoutingKey(channel, message)
+}
+
+// topicRoutingKey builds notification.<channel>.<priority>.<category> from
+// a NotificationMessage's fields. A missing priority is normal and a
+// missing category transactional, as the API defaults them, and so is
+// everything about a message of another type.
+func topicRoutingKey(channel string, message interface{}) string {
+	priority, category := "normal", "transactional"
+	if msg, ok := message.(models.NotificationMessage); ok {
+		if msg.Priority != "" {
+			priority = topicWord(msg.Priority)
+		}
+		if msg.Category != "" {
+			category = topicWord(msg.Category)
+		}
+	}
+	return strings.Join([]string{topicKeyPrefix, channel, priority, category}, ".")
+}
+
+// topicWord keeps s one word of a routing key: dots would split it and
+// wildcards have no place in a key.
+var topicWord = strings.NewReplacer(".", "_", "*", "_", "#", "_").Replace
+
+// bindingKeys are the keys queueName is bound to the working exchange
+// with. Every queue is bound under its own name, which the failed and
+// quarantine queues are published to and delayed and parked messages may
+// be; in topic mode the work queues get their patterns too.
+func (r *RabbitMqClient) bindingKeys(queueName string) []string {
+	keys := []string{queueName}
+	if !r.topic() {
+		return keys
+	}
+	var patterns []string
+	var channel string
+	switch queueName {
+	case r.Config.EmailQueue:
+		patterns, channel = r.Config.EmailBindings, emailChannel
+	case r.Config.PushQueue:
+		patterns, channel = r.Config.PushBindings, pushChannel
+	case r.Config.WhatsAppQueue:
+		patterns, channel = r.Config.WhatsAppBindings, whatsAppChannel
+	default:
+		return keys
+	}
+	if len(patterns) == 0 {
+		patterns = []string{topicKeyPrefix + "." + channel + ".#"}
+	}
+	return append(keys, patterns...)
+}
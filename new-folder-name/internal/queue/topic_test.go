@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicRoutingKey(t *testing.T) {
+	for _, channel := range []string{emailChannel, pushChannel, whatsAppChannel} {
+		for _, priority := range []string{"low", "normal", "high"} {
+			for _, category := range []string{"transactional", "marketing"} {
+				msg := models.NotificationMessage{Type: channel, Priority: priority, Category: category}
+				want := "notification." + channel + "." + priority + "." + category
+				assert.Equal(t, want, topicRoutingKey(channel, msg))
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		channel string
+		message interface{}
+		want    string
+	}{
+		{"defaults", emailChannel, models.NotificationMessage{}, "notification.email.normal.transactional"},
+		{"push topic broadcast", pushChannel, models.NotificationMessage{Type: "push_topic", Priority: "high"}, "notification.push.high.transactional"},
+		{"not a notification", whatsAppChannel, map[string]string{"priority": "high"}, "notification.whatsapp.normal.transactional"},
+		{"no extra words", emailChannel, models.NotificationMessage{Category: "promo.*"}, "notification.email.normal.promo__"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, topicRoutingKey(tt.channel, tt.message))
+		})
+	}
+}
+
+func topicConfig() config.RabbitMQConfig {
+	cfg := reconnectConfig(0)
+	cfg.WhatsAppQueue = "whatsapp.queue"
+	cfg.ExchangeType = TopicExchange
+	return cfg
+}
+
+func TestTopicExchange_Publish(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(topicConfig(), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	ctx := context.Background()
+	require.NoError(t, client.PublishEmail(ctx, models.NotificationMessage{ID: "n-1", Priority: "high", Category: "marketing"}))
+	require.NoError(t, client.PublishPushNot(ctx, models.NotificationMessage{ID: "n-2", Priority: "low"}))
+	require.NoError(t, client.PublishWhatsApp(ctx, models.NotificationMessage{ID: "n-3"}))
+	assert.Equal(t, []string{
+		"notification.email.high.marketing",
+		"notification.push.low.transactional",
+		"notification.whatsapp.normal.transactional",
+	}, broker.published)
+}
+
+func TestTopicExchange_Topology(t *testing.T) {
+	cfg := topicConfig()
+	cfg.EmailBindings = []string{"notification.email.high.*", "notification.*.*.marketing"}
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	assert.Equal(t, "topic", broker.exchangeKinds["notifications.direct"])
+	assert.Equal(t, []string{"email.queue", "notification.email.high.*", "notification.*.*.marketing"}, broker.boundKeys["email.queue"])
+	assert.Equal(t, []string{"push.queue", "notification.push.#"}, broker.boundKeys["push.queue"])
+	assert.Equal(t, []string{"whatsapp.queue", "notification.whatsapp.#"}, broker.boundKeys["whatsapp.queue"])
+	assert.Equal(t, []string{"failed.queue"}, broker.boundKeys["failed.queue"], "parked messages are published under the queue's name")
+}
+
+func TestDirectExchange_Unchanged(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := connectRabbitMq(reconnectConfig(0), "test", broker.dial)
+	require.NoError(t, err)
+	defer client.CloseConnection()
+
+	assert.Equal(t, "direct", broker.exchangeKinds["notifications.direct"])
+	assert.Equal(t, []string{"email.queue"}, broker.boundKeys["email.queue"])
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1", Priority: "high"}))
+	assert.Equal(t, []string{"email.queue"}, broker.published)
+
+	cfg := reconnectConfig(0)
+	cfg.ExchangeType = "fanout"
+	_, err = connectRabbitMq(cfg, "test", (&fakeBroker{}).dial)
+	assert.ErrorContains(t, err, "rabbitmq.exchange_type")
+}
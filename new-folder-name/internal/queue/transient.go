@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultPublishRetryAttempts  = 3
+	defaultPublishRetryBaseDelay = 50 * time.Millisecond
+)
+
+// transientPublishError reports whether a failed publish is worth repeating:
+// the connection or channel went away under it, and a moment later it is
+// back. Marshal errors, nacks and the caller's context ending are not.
+func transientPublishError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrNotConnected) || errors.Is(err, ErrConfirmChannelClosed) || errors.Is(err, amqp.ErrClosed) {
+		return true
+	}
+	var amqpErr *amqp.Error
+	return errors.As(err, &amqpErr)
+}
+
+// publishWithRetry publishes, and repeats a publish that failed on the
+// connection or channel up to Config.PublishRetryAttempts attempts in all,
+// waiting from Config.PublishRetryBaseDelay, doubling, plus up to
+// Config.PublishRetryJitter. It gives up early rather than wait past ctx's
+// deadline, returning the last publish error. A confirm channel closing
+// mid-publish may have taken the message first, so a retry can queue it
+// twice; consumers already see redeliveries.
+func (r *RabbitMqClient) publishWithRetry(ctx context.Context, routingKey string, message interface{}, opts PublishOptions) error {
+	attempts := r.Config.PublishRetryAttempts
+	if attempts <= 0 {
+		attempts = defaultPublishRetryAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		err := r.publish(ctx, routingKey, message, opts)
+		if err == nil || attempt >= attempts || !transientPublishError(err) {
+			return err
+		}
+		delay := r.publishRetryDelay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(r.Clock.Now()) < delay {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if r.Observer != nil {
+			r.Observer.ObservePublishRetry(routingKey)
+		}
+	}
+}
+
+// publishRetryDelay is the wait after the given failed attempt, counting
+// from 1. The doubling stops after ten steps; a deadline cuts in long before.
+func (r *RabbitMqClient) publishRetryDelay(attempt int) time.Duration {
+	base := r.Config.PublishRetryBaseDelay
+	if base <= 0 {
+		base = defaultPublishRetryBaseDelay
+	}
+	d := base << min(attempt-1, 10)
+	if jitter := r.Config.PublishRetryJitter; jitter > 0 {
+		d += rand.N(jitter + 1)
+	}
+	return d
+}
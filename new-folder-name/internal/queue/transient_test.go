@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// retryObserver counts the publishes retried.
+type retryObserver struct {
+	mu      sync.Mutex
+	retries map[string]int
+}
+
+func (o *retryObserver) ObservePublish(string, time.Duration, error) {}
+func (o *retryObserver) ObserveDelivery(string, time.Duration)       {}
+
+func (o *retryObserver) ObservePublishRetry(routingKey string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.retries == nil {
+		o.retries = map[string]int{}
+	}
+	o.retries[routingKey]++
+}
+
+func (o *retryObserver) count(routingKey string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.retries[routingKey]
+}
+
+func retryingClient(t *testing.T, broker *fakeBroker, attempts int, baseDelay time.Duration) (*RabbitMqClient, *retryObserver) {
+	t.Helper()
+	cfg := reconnectConfig(time.Second)
+	cfg.PublishRetryAttempts = attempts
+	cfg.PublishRetryBaseDelay = baseDelay
+	cfg.PublishRetryJitter = time.Millisecond
+	client, err := connectRabbitMq(cfg, "test", broker.dial)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.CloseConnection() })
+	observer := &retryObserver{}
+	client.Observer = observer
+	return client, observer
+}
+
+var channelError = &amqp.Error{Code: amqp.ChannelError, Reason: "CHANNEL_ERROR - unexpected frame"}
+
+func TestPublish_RetriesTransientErrors(t *testing.T) {
+	broker := &fakeBroker{publishErrs: []error{channelError, amqp.ErrClosed}}
+	client, observer := retryingClient(t, broker, 3, time.Millisecond)
+
+	require.NoError(t, client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"}))
+	_, _, published := broker.stats()
+	assert.Equal(t, 1, published)
+	assert.Equal(t, 2, observer.count("email.queue"))
+}
+
+func TestPublish_GivesUpAfterMaxAttempts(t *testing.T) {
+	broker := &fakeBroker{publishErrs: []error{channelError, channelError, channelError}}
+	client, observer := retryingClient(t, broker, 2, time.Millisecond)
+
+	err := client.PublishEmail(context.Background(), models.NotificationMessage{ID: "n-1"})
+	var amqpErr *amqp.Error
+	assert.ErrorAs(t, err, &amqpErr)
+	assert.Equal(t, 1, observer.count("email.queue"))
+	_, _, published := broker.stats()
+	assert.Zero(t, published)
+}
+
+func TestPublish_DoesNotRetryPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		message interface{}
+	}{
+		{name: "marshal error", message: map[string]interface{}{"bad": func() {}}},
+		{name: "publish error", errs: []error{errors.New("message too large")}, message: models.NotificationMessage{ID: "n-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{publishErrs: tt.errs}
+			client, observer := retryingClient(t, broker, 3, time.Millisecond)
+
+			assert.Error(t, client.PublishEmail(context.Background(), tt.message))
+			assert.Zero(t, observer.count("email.queue"))
+		})
+	}
+}
+
+func TestPublish_RetryRespectsDeadline(t *testing.T) {
+	broker := &fakeBroker{publishErrs: []error{channelError}}
+	client, observer := retryingClient(t, broker, 3, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.PublishEmail(ctx, models.NotificationMessage{ID: "n-1"})
+	assert.ErrorAs(t, err, new(*amqp.Error))
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "the retry would outlast the deadline, so it isn't waited for")
+	assert.Zero(t, observer.count("email.queue"))
+}
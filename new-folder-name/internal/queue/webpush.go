@@ -0,0 +1,335 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/golang-jwt/jwt"
+)
+
+// WebPushTokenPrefix starts the device tokens that carry a Web Push
+// subscription: the prefix is followed by the subscription's JSON, as the
+// browser's PushSubscription.toJSON() gives it, base64url encoded.
+const WebPushTokenPrefix = "webpush:"
+
+const (
+	defaultWebPushTTL = 24 * time.Hour
+	// webPushRecordSize is the aes128gcm record size. The whole message is
+	// one record, so it also bounds the payload.
+	webPushRecordSize = 4096
+	// vapidExpiry is how long a VAPID token is valid; push services refuse
+	// more than 24 hours.
+	vapidExpiry = 12 * time.Hour
+)
+
+// ErrWebPushPayloadTooLarge is returned for a notification whose payload
+// doesn't fit one encrypted record.
+var ErrWebPushPayloadTooLarge = errors.New("web push payload too large")
+
+// WebPushSubscription is a browser's push subscription.
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		// P256dh is the browser's public key, Auth the shared auth secret,
+		// both base64url encoded.
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// ParseWebPushToken decodes a device token made with WebPushTokenPrefix.
+func ParseWebPushToken(token string) (WebPushSubscription, error) {
+	var sub WebPushSubscription
+	encoded, ok := strings.CutPrefix(token, WebPushTokenPrefix)
+	if !ok {
+		return sub, errors.New("not a web push token")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return sub, fmt.Errorf("web push token is not base64url: %w", err)
+	}
+	if err := json.Unmarshal(raw, &sub); err != nil {
+		return sub, fmt.Errorf("web push token is not a subscription: %w", err)
+	}
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		return sub, errors.New("web push subscription endpoint must be an https URL")
+	}
+	if sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return sub, errors.New("web push subscription has no keys")
+	}
+	return sub, nil
+}
+
+// DeviceTokenRemover forgets device tokens the push service says are gone.
+// The user service client implements it.
+type DeviceTokenRemover interface {
+	RemoveDeviceToken(ctx context.Context, userID, token string) error
+}
+
+// webPushPayload is what the service worker receives once decrypted.
+type webPushPayload struct {
+	NotificationID string                 `json:"notification_id"`
+	TemplateID     string                 `json:"template_id"`
+	Variables      map[string]interface{} `json:"variables,omitempty"`
+	Locale         string                 `json:"locale,omitempty"`
+	Category       string                 `json:"category,omitempty"`
+	Metadata       map[string]string      `json:"metadata,omitempty"`
+}
+
+// WebPushSender delivers push notifications to the Web Push subscriptions
+// among a message's device tokens, encrypted as RFC 8291 requires and
+// signed with the VAPID key (RFC 8292).
+type WebPushSender struct {
+	client    *http.Client
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+	ttl       time.Duration
+	removed   DeviceTokenRemover
+	// Clock dates the VAPID signatures.
+	Clock clock.Clock
+}
+
+// NewWebPushSender builds the sender from cfg. It returns nil and no error
+// when no VAPID key is configured. removed, when not nil, is told of every
+// subscription the push service reports gone.
+func NewWebPushSender(cfg config.WebPushConfig, removed DeviceTokenRemover) (*WebPushSender, error) {
+	if cfg.VAPIDPrivateKey == "" {
+		return nil, nil
+	}
+	if cfg.Subject == "" {
+		return nil, errors.New("web push needs a VAPID subject (a mailto: or https: URL)")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cfg.VAPIDPrivateKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("VAPID private key is not base64url: %w", err)
+	}
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public, err := key.PublicKey.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultWebPushTTL
+	}
+	return &WebPushSender{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(public),
+		subject:   cfg.Subject,
+		ttl:       ttl,
+		removed:   removed,
+		Clock:     clock.System,
+	}, nil
+}
+
+// SendPush sends msg to each of its Web Push tokens; other tokens are
+// ignored. A subscription the push service reports gone is removed and
+// doesn't fail the send. Rate limiting and push service errors are
+// transient.
+func (s *WebPushSender) SendPush(ctx context.Context, msg models.NotificationMessage) error {
+	payload, err := json.Marshal(webPushPayload{
+		NotificationID: msg.ID,
+		TemplateID:     msg.TemplateID,
+		Variables:      msg.Variables,
+		Locale:         msg.Locale,
+		Category:       msg.Category,
+		Metadata:       msg.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal web push payload: %w", err)
+	}
+	var errs []error
+	for _, token := range msg.DeviceTokens {
+		if !strings.HasPrefix(token, WebPushTokenPrefix) {
+			continue
+		}
+		sub, err := ParseWebPushToken(token)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		gone, err := s.send(ctx, sub, payload, msg.Priority)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if gone {
+			log.Printf("web push subscription of user %s is gone, removing it", msg.UserID)
+			if s.removed != nil {
+				if err := s.removed.RemoveDeviceToken(ctx, msg.UserID, token); err != nil {
+					log.Printf("failed to remove web push subscription of user %s: %v", msg.UserID, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send posts one encrypted message to the subscription's push service. It
+// reports whether the subscription is gone.
+func (s *WebPushSender) send(ctx context.Context, sub WebPushSubscription, payload []byte, priority string) (bool, error) {
+	body, err := encryptWebPush(sub, payload)
+	if err != nil {
+		return false, err
+	}
+	authorization, err := s.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.ttl.Seconds())))
+	req.Header.Set("Urgency", webPushUrgency(priority))
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, Transient(fmt.Errorf("web push request failed: %w", err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return false, Transient(fmt.Errorf("push service answered %d", resp.StatusCode))
+	default:
+		return false, fmt.Errorf("push service refused the message: %d", resp.StatusCode)
+	}
+}
+
+// vapidAuthorization signs a VAPID token for the push service behind
+// endpoint.
+func (s *WebPushSender) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": s.Clock.Now().Add(vapidExpiry).Unix(),
+		"sub": s.subject,
+	}).SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", token, s.publicKey), nil
+}
+
+// webPushUrgency maps a notification priority to the Urgency header.
+func webPushUrgency(priority string) string {
+	switch priority {
+	case "high":
+		return "high"
+	case "low":
+		return "low"
+	}
+	return "normal"
+}
+
+// encryptWebPush encrypts payload for sub as a single aes128gcm record
+// (RFC 8188), with the key derived as RFC 8291 describes.
+func encryptWebPush(sub WebPushSubscription, payload []byte) ([]byte, error) {
+	if len(payload)+1+16 > webPushRecordSize {
+		return nil, ErrWebPushPayloadTooLarge
+	}
+	uaPublicRaw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, fmt.Errorf("web push p256dh key is not base64url: %w", err)
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil {
+		return nil, fmt.Errorf("web push auth secret is not base64url: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid web push p256dh key: %w", err)
+	}
+
+	// a fresh key pair and salt for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicRaw) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// header: salt, record size, key ID length and the key ID, which is
+	// our public key; then the one record, padded with the last-record
+	// delimiter
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	record := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
@@ -0,0 +1,261 @@
+package queue
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// browser is the subscribing end: it holds the keys a push message is
+// encrypted to.
+type browser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &browser{key: key, auth: auth}
+}
+
+// token is the device token for the browser's subscription to endpoint.
+func (b *browser) token(t *testing.T, endpoint string) string {
+	t.Helper()
+	var sub WebPushSubscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(b.auth)
+	raw, err := json.Marshal(sub)
+	require.NoError(t, err)
+	return WebPushTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decrypt undoes encryptWebPush the way a browser would.
+func (b *browser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	require.Greater(t, len(body), 21)
+	salt := body[:16]
+	assert.Equal(t, uint32(webPushRecordSize), binary.BigEndian.Uint32(body[16:20]))
+	idLen := int(body[20])
+	asPublicRaw := body[21 : 21+idLen]
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicRaw)
+	require.NoError(t, err)
+	shared, err := b.key.ECDH(asPublic)
+	require.NoError(t, err)
+
+	keyInfo := "WebPush: info\x00" + string(b.key.PublicKey().Bytes()) + string(asPublicRaw)
+	ikm, err := hkdf.Key(sha256.New, shared, b.auth, keyInfo, 32)
+	require.NoError(t, err)
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	require.NoError(t, err)
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	require.NoError(t, err)
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	record, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x02), record[len(record)-1], "last record delimiter")
+	return record[:len(record)-1]
+}
+
+// pushService stubs a push service endpoint.
+type pushService struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (p *pushService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, r)
+	p.bodies = append(p.bodies, body)
+	w.WriteHeader(p.status)
+}
+
+type fakeTokenRemover struct {
+	mu      sync.Mutex
+	removed []string
+}
+
+func (f *fakeTokenRemover) RemoveDeviceToken(ctx context.Context, userID, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, userID+" "+token)
+	return nil
+}
+
+func newTestWebPushSender(t *testing.T, server *httptest.Server, remover DeviceTokenRemover) (*WebPushSender, *ecdsa.PublicKey) {
+	t.Helper()
+	vapidKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	raw, err := vapidKey.Bytes()
+	require.NoError(t, err)
+	sender, err := NewWebPushSender(config.WebPushConfig{
+		VAPIDPrivateKey: base64.RawURLEncoding.EncodeToString(raw),
+		Subject:         "mailto:ops@example.com",
+	}, remover)
+	require.NoError(t, err)
+	sender.client = server.Client()
+	return sender, &vapidKey.PublicKey
+}
+
+func TestWebPushSender_EncryptsAndSigns(t *testing.T) {
+	service := &pushService{status: http.StatusCreated}
+	server := httptest.NewTLSServer(service)
+	defer server.Close()
+	sender, vapidPublic := newTestWebPushSender(t, server, nil)
+	b := newBrowser(t)
+
+	err := sender.SendPush(context.Background(), models.NotificationMessage{
+		ID:           "n-1",
+		UserID:       "user-1",
+		TemplateID:   "order_shipped",
+		Variables:    map[string]interface{}{"order": "A-1"},
+		Priority:     "high",
+		Locale:       "fr",
+		DeviceTokens: []string{b.token(t, server.URL+"/push/abc"), "fcm-token:APA91b"},
+	})
+	require.NoError(t, err)
+	require.Len(t, service.requests, 1, "only the web push token is sent to")
+
+	req := service.requests[0]
+	assert.Equal(t, "/push/abc", req.URL.Path)
+	assert.Equal(t, "aes128gcm", req.Header.Get("Content-Encoding"))
+	assert.Equal(t, "application/octet-stream", req.Header.Get("Content-Type"))
+	assert.Equal(t, "86400", req.Header.Get("TTL"))
+	assert.Equal(t, "high", req.Header.Get("Urgency"))
+
+	// the VAPID token is signed by the configured key, for this push service
+	tokenPart, keyPart, ok := strings.Cut(strings.TrimPrefix(req.Header.Get("Authorization"), "vapid t="), ", k=")
+	require.True(t, ok, req.Header.Get("Authorization"))
+	publicRaw, err := vapidPublic.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(publicRaw), keyPart)
+	parsed, err := jwt.Parse(tokenPart, func(*jwt.Token) (interface{}, error) { return vapidPublic, nil })
+	require.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, server.URL, claims["aud"])
+	assert.Equal(t, "mailto:ops@example.com", claims["sub"])
+
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(b.decrypt(t, service.bodies[0]), &payload))
+	assert.Equal(t, map[string]interface{}{
+		"notification_id": "n-1",
+		"template_id":     "order_shipped",
+		"variables":       map[string]interface{}{"order": "A-1"},
+		"locale":          "fr",
+	}, payload)
+}
+
+func TestWebPushSender_RemovesGoneSubscriptions(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		service := &pushService{status: status}
+		server := httptest.NewTLSServer(service)
+		remover := &fakeTokenRemover{}
+		sender, _ := newTestWebPushSender(t, server, remover)
+		token := newBrowser(t).token(t, server.URL+"/push/gone")
+
+		err := sender.SendPush(context.Background(), models.NotificationMessage{ID: "n-1", UserID: "user-1", DeviceTokens: []string{token}})
+		assert.NoError(t, err, "a gone subscription doesn't fail the send")
+		assert.Equal(t, []string{"user-1 " + token}, remover.removed)
+		server.Close()
+	}
+}
+
+func TestWebPushSender_Errors(t *testing.T) {
+	tests := []struct {
+		status    int
+		transient bool
+	}{
+		{status: http.StatusTooManyRequests, transient: true},
+		{status: http.StatusServiceUnavailable, transient: true},
+		{status: http.StatusBadRequest, transient: false},
+		{status: http.StatusRequestEntityTooLarge, transient: false},
+	}
+	for _, tt := range tests {
+		service := &pushService{status: tt.status}
+		server := httptest.NewTLSServer(service)
+		remover := &fakeTokenRemover{}
+		sender, _ := newTestWebPushSender(t, server, remover)
+		token := newBrowser(t).token(t, server.URL+"/push/x")
+
+		err := sender.SendPush(context.Background(), models.NotificationMessage{ID: "n-1", DeviceTokens: []string{token}})
+		require.Error(t, err, tt.status)
+		assert.Equal(t, tt.transient, IsTransient(err), tt.status)
+		assert.Empty(t, remover.removed)
+		server.Close()
+	}
+}
+
+func TestWebPushSender_PayloadTooLarge(t *testing.T) {
+	service := &pushService{status: http.StatusCreated}
+	server := httptest.NewTLSServer(service)
+	defer server.Close()
+	sender, _ := newTestWebPushSender(t, server, nil)
+
+	err := sender.SendPush(context.Background(), models.NotificationMessage{
+		ID:           "n-1",
+		Variables:    map[string]interface{}{"body": strings.Repeat("x", webPushRecordSize)},
+		DeviceTokens: []string{newBrowser(t).token(t, server.URL+"/push/x")},
+	})
+	assert.ErrorIs(t, err, ErrWebPushPayloadTooLarge)
+	assert.Empty(t, service.requests)
+}
+
+func TestNewWebPushSender_Disabled(t *testing.T) {
+	sender, err := NewWebPushSender(config.WebPushConfig{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, sender)
+
+	_, err = NewWebPushSender(config.WebPushConfig{VAPIDPrivateKey: "not a key", Subject: "mailto:ops@example.com"}, nil)
+	assert.Error(t, err)
+}
+
+func TestParseWebPushToken(t *testing.T) {
+	b := newBrowser(t)
+	sub, err := ParseWebPushToken(b.token(t, "https://push.example.com/abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://push.example.com/abc", sub.Endpoint)
+
+	for _, token := range []string{
+		"fcm-token",
+		WebPushTokenPrefix + "!!!",
+		WebPushTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(`{"endpoint":"http://push.example.com","keys":{"p256dh":"a","auth":"b"}}`)),
+		WebPushTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(`{"endpoint":"https://push.example.com"}`)),
+	} {
+		_, err := ParseWebPushToken(token)
+		assert.Error(t, err, token)
+	}
+}
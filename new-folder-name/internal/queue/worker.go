@@ -0,0 +1,249 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/clock"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MessageHandler processes one decoded notification. Its error is treated
+// as for DeliveryHandler.
+type MessageHandler func(ctx context.Context, msg models.NotificationMessage) error
+
+// HandleMessages adapts handler to a DeliveryHandler with the default
+// Decoder, which upgrades legacy messages. See Decoder.HandleMessages.
+func HandleMessages(handler MessageHandler) DeliveryHandler {
+	return Decoder{}.HandleMessages(handler)
+}
+
+// HandleMessages adapts handler to a DeliveryHandler. The body is
+// decompressed by its content encoding and decoded, and the message's
+// tenant put on ctx, so status writes land in the tenant's
+// keys. Bodies that don't decode fail permanently, so they are rejected
+// rather than redelivered. The delivery's routing key names the queue to
+// the Observer, as the work queues are bound by their names.
+func (dec Decoder) HandleMessages(handler MessageHandler) DeliveryHandler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		body, err := deliveryBody(d)
+		if err != nil {
+			return fmt.Errorf("failed to decode message %s: %w", d.MessageId, err)
+		}
+		msg, err := dec.Decode(d.RoutingKey, body)
+		if err != nil {
+			return err
+		}
+		tenant, _ := d.Headers[TenantHeader].(string)
+		if tenant == "" {
+			tenant = msg.TenantID
+		}
+		if tenant != "" {
+			ctx = middleware.WithTenant(ctx, tenant)
+		}
+		return handler(ctx, msg)
+	}
+}
+
+// Observer receives the timings the publisher and workers take, and the
+// publisher's retries. The
+// metrics package implements it.
+type Observer interface {
+	ObservePublish(routingKey string, elapsed time.Duration, err error)
+	ObservePublishRetry(routingKey string)
+	ObserveDelivery(channel string, latency time.Duration)
+}
+
+// StatusRecorder is where workers report a notification's progress. The
+// notification handler implements it.
+type StatusRecorder interface {
+	SetDeliveryStatus(ctx context.Context, notificationID, status string) error
+	RecordAttempt(ctx context.Context, notificationID string, attemptErr error) error
+}
+
+// DeliveryRecorder is a StatusRecorder that keeps a fingerprint of every
+// delivery to catch the same content going out twice. RecordDelivery
+// returns the notification a delivery repeated, if any. The notification
+// handler implements it.
+type DeliveryRecorder interface {
+	RecordDelivery(ctx context.Context, msg models.NotificationMessage) (string, error)
+}
+
+// DuplicateObserver is told of every duplicate delivery a worker's
+// DeliveryRecorder detected. The metrics package implements it.
+type DuplicateObserver interface {
+	ObserveDuplicateDelivery(channel string)
+}
+
+// LegacyRecorder is a StatusRecorder that can mark a notification as taken
+// from a legacy message. The notification handler implements it.
+type LegacyRecorder interface {
+	MarkUpgradedFromLegacy(ctx context.Context, notificationID string) error
+}
+
+// DeliveryClaimer is a StatusRecorder that marks a notification consumed
+// before it is sent, so a redelivery of one already sent is skipped.
+// ClaimDelivery reports whether to send; ReleaseDelivery drops the mark
+// after a failed send, so the retry isn't taken for a redelivery. The
+// notification handler implements it.
+type DeliveryClaimer interface {
+	ClaimDelivery(ctx context.Context, notificationID string) (bool, error)
+	ReleaseDelivery(ctx context.Context, notificationID string) error
+}
+
+// deliveryWorker sends the notifications consumed from one queue and moves
+// their status from processing to sent or failed. A transient send failure
+// puts the status back to queued and the message back on the queue, unless
+// it was the message's last attempt. The
+// channel workers embed it with their sender's method as send.
+type deliveryWorker struct {
+	channel string
+	send    MessageHandler
+	status  StatusRecorder
+	// Observer, when set, is told how long each sent notification took from
+	// being queued.
+	Observer Observer
+	// Clock times the notifications the Observer is told of.
+	Clock clock.Clock
+}
+
+// Handle is the worker's MessageHandler. Status writes are best effort: a
+// Redis hiccup must not resend a notification that went out. A message the
+// DeliveryClaimer turns down is acked without sending; one it can't check
+// is requeued.
+func (w *deliveryWorker) Handle(ctx context.Context, msg models.NotificationMessage) error {
+	claimer, _ := w.status.(DeliveryClaimer)
+	if claimer != nil {
+		send, err := claimer.ClaimDelivery(ctx, msg.ID)
+		if err != nil {
+			return Transient(err)
+		}
+		if !send {
+			log.Printf("%s worker: skipping %s, already delivered", w.channel, msg.ID)
+			return nil
+		}
+	}
+	if recorder, ok := w.status.(LegacyRecorder); ok && msg.UpgradedFromLegacy {
+		if err := recorder.MarkUpgradedFromLegacy(ctx, msg.ID); err != nil {
+			log.Printf("%s worker: %v", w.channel, err)
+		}
+	}
+	w.setStatus(ctx, msg.ID, "processing")
+	sendErr := w.send(ctx, msg)
+	if sendErr != nil && claimer != nil {
+		if err := claimer.ReleaseDelivery(ctx, msg.ID); err != nil {
+			log.Printf("%s worker: %v", w.channel, err)
+		}
+	}
+	if err := w.status.RecordAttempt(ctx, msg.ID, sendErr); err != nil {
+		log.Printf("%s worker: %v", w.channel, err)
+	}
+	switch {
+	case sendErr == nil:
+		w.setStatus(ctx, msg.ID, "sent")
+		if w.Observer != nil && !msg.Timestamp.IsZero() {
+			w.Observer.ObserveDelivery(w.channel, w.Clock.Now().Sub(msg.Timestamp))
+		}
+		w.recordDelivery(ctx, msg)
+	case IsTransient(sendErr) && !IsLastAttempt(ctx):
+		w.setStatus(ctx, msg.ID, "queued")
+	default:
+		w.setStatus(ctx, msg.ID, "failed")
+	}
+	return sendErr
+}
+
+// recordDelivery hands a sent notification to the duplicate detector, when
+// the status recorder has one. It only logs what goes wrong: the
+// notification is out either way.
+func (w *deliveryWorker) recordDelivery(ctx context.Context, msg models.NotificationMessage) {
+	recorder, ok := w.status.(DeliveryRecorder)
+	if !ok {
+		return
+	}
+	original, err := recorder.RecordDelivery(ctx, msg)
+	if err != nil {
+		log.Printf("%s worker: %v", w.channel, err)
+	}
+	if original == "" {
+		return
+	}
+	if observer, ok := w.Observer.(DuplicateObserver); ok {
+		observer.ObserveDuplicateDelivery(w.channel)
+	}
+}
+
+func (w *deliveryWorker) setStatus(ctx context.Context, notificationID, status string) {
+	if err := w.status.SetDeliveryStatus(ctx, notificationID, status); err != nil {
+		log.Printf("%s worker: %v", w.channel, err)
+	}
+}
+
+// consume runs handler over queueName on a channel of its own with workers
+// deliveries in flight at once, until ctx is cancelled. Rejected deliveries,
+// including those that don't decode, are dead-lettered by the broker to the
+// failed queue with their payload and x-death intact; the error is only
+// logged. When the broker closes the channel, consume waits for the client
+// to reconnect and subscribes again, with the prefetch then current.
+func (r *RabbitMqClient) consume(ctx context.Context, queueName, tag string, workers int, handler MessageHandler) error {
+	for {
+		if err := r.awaitConnection(ctx); err != nil {
+			return err
+		}
+		channel, err := r.consumerChannel()
+		if err != nil {
+			// the connection may have dropped before the reconnect loop
+			// noticed; give it a moment
+			log.Printf("%s: error creating consumer channel: %v", tag, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.backoff(1)):
+			}
+			continue
+		}
+		prefetch, global := r.prefetch()
+		consumer := NewConsumer(channel, queueName, tag, prefetch, workers, r.decoder().HandleMessages(handler))
+		consumer.PrefetchGlobal = global
+		consumer.Metrics = r.Metrics
+		if r.Config.RetryExchange != "" {
+			consumer.Retrier = r.RetryDispatcher()
+		}
+		err = consumer.Run(ctx)
+		if !errors.Is(err, ErrDeliveriesClosed) {
+			return err
+		}
+		log.Printf("%s: lost its channel, subscribing again once reconnected", tag)
+	}
+}
+
+// SetPrefetch changes the prefetch the consumers subscribe with, see
+// RabbitMQConfig.PrefetchCount. Running consumers keep theirs until they
+// next subscribe, after their channel is recovered.
+func (r *RabbitMqClient) SetPrefetch(count int, global bool) {
+	r.qosMu.Lock()
+	defer r.qosMu.Unlock()
+	r.prefetchCount, r.prefetchGlobal = count, global
+}
+
+func (r *RabbitMqClient) prefetch() (int, bool) {
+	r.qosMu.Lock()
+	defer r.qosMu.Unlock()
+	return r.prefetchCount, r.prefetchGlobal
+}
+
+func (r *RabbitMqClient) consumerChannel() (ConsumerChannel, error) {
+	if r.openConsumerChannel != nil {
+		return r.openConsumerChannel()
+	}
+	channel, err := r.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
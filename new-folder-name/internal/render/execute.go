@@ -0,0 +1,22 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Execute renders a Go template source with vars. A variable the template
+// refers to but vars lacks is an error rather than "<no value>", so a
+// replay shows what a send would be missing.
+func Execute(source string, vars map[string]interface{}) (string, error) {
+	tmpl, err := template.New("replay").Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("parse template: %w", err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return out.String(), nil
+}
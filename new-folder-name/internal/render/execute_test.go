@@ -0,0 +1,23 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute(t *testing.T) {
+	out, err := Execute("Hi {{.user.name}}, {{len .items}} items", map[string]interface{}{
+		"user":  map[string]interface{}{"name": "Ada"},
+		"items": []interface{}{1, 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Hi Ada, 2 items", out)
+
+	_, err = Execute("Hi {{.name}}", map[string]interface{}{})
+	assert.Error(t, err, "missing variables fail rather than render <no value>")
+
+	_, err = Execute("Hi {{.name", nil)
+	assert.Error(t, err)
+}
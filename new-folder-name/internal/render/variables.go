@@ -0,0 +1,307 @@
+// Package render inspects template sources. The gateway never renders a
+// notification itself; it only needs to know which variables a template
+// refers to so callers can be told what to send. Execute exists for local
+// replays, where template developers render against their working copy.
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Syntax is the placeholder syntax of a template source.
+type Syntax string
+
+const (
+	SyntaxGo       Syntax = "go"
+	SyntaxMustache Syntax = "mustache"
+)
+
+// ParseSyntax accepts the names used in config and by the template service.
+// An empty name means Go templates.
+func ParseSyntax(name string) (Syntax, error) {
+	switch Syntax(strings.ToLower(name)) {
+	case "", SyntaxGo:
+		return SyntaxGo, nil
+	case SyntaxMustache, "handlebars":
+		return SyntaxMustache, nil
+	}
+	return "", fmt.Errorf("unknown template syntax %q", name)
+}
+
+// ExtractVariables returns the sorted variable paths source refers to.
+// Nested fields are dotted (user.name). Fields of the elements of a Go range
+// are reported under the collection with a "[]" suffix (items[].price);
+// names inside a mustache section are reported under the section
+// (order.total), since that is where mustache looks first. It is best
+// effort: references it can't resolve, such as fields of a function's
+// result, are left out.
+func ExtractVariables(source string, syntax Syntax) ([]string, error) {
+	found := map[string]bool{}
+	var err error
+	switch syntax {
+	case SyntaxGo:
+		err = extractGo(source, found)
+	case SyntaxMustache:
+		err = extractMustache(source, found)
+	default:
+		err = fmt.Errorf("unknown template syntax %q", syntax)
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// MissingVariables returns the paths whose top-level variable is not in
+// provided. Only the top level is checked since nested values are opaque
+// JSON to the gateway.
+func MissingVariables(paths []string, provided map[string]interface{}) []string {
+	var missing []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		root := strings.TrimSuffix(strings.SplitN(path, ".", 2)[0], "[]")
+		if _, ok := provided[root]; ok || seen[root] {
+			continue
+		}
+		seen[root] = true
+		missing = append(missing, root)
+	}
+	return missing
+}
+
+// scope is what dot refers to while walking a Go template.
+type scope struct {
+	path  string
+	known bool
+}
+
+func (s scope) field(idents ...string) scope {
+	if !s.known {
+		return s
+	}
+	if s.path == "" {
+		return scope{path: strings.Join(idents, "."), known: true}
+	}
+	return scope{path: s.path + "." + strings.Join(idents, "."), known: true}
+}
+
+type goWalker struct {
+	found map[string]bool
+}
+
+func extractGo(source string, found map[string]bool) error {
+	tree := parse.New("template")
+	// the workers own the function map, so any function name is accepted
+	tree.Mode = parse.SkipFuncCheck
+	trees := map[string]*parse.Tree{}
+	if _, err := tree.Parse(source, "", "", trees); err != nil {
+		return err
+	}
+	w := goWalker{found: found}
+	root := scope{known: true}
+	for _, t := range trees {
+		if t.Root != nil {
+			w.walk(t.Root, root, map[string]scope{"$": root})
+		}
+	}
+	return nil
+}
+
+func (w goWalker) record(s scope) {
+	if s.known && s.path != "" {
+		w.found[s.path] = true
+	}
+}
+
+func (w goWalker) walk(node parse.Node, dot scope, vars map[string]scope) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, dot, vars)
+		}
+	case *parse.ActionNode:
+		w.pipe(n.Pipe, dot, vars)
+	case *parse.IfNode:
+		w.pipe(n.Pipe, dot, vars)
+		w.walk(n.List, dot, vars)
+		w.walk(n.ElseList, dot, vars)
+	case *parse.WithNode:
+		inner := w.pipe(n.Pipe, dot, vars)
+		w.walk(n.List, inner, vars)
+		w.walk(n.ElseList, dot, vars)
+	case *parse.RangeNode:
+		collection := w.eval(n.Pipe, dot, vars)
+		elem := scope{known: collection.known}
+		if collection.known {
+			elem.path = collection.path + "[]"
+		}
+		inner := copyVars(vars)
+		switch len(n.Pipe.Decl) {
+		case 1:
+			inner[n.Pipe.Decl[0].Ident[0]] = elem
+		case 2:
+			inner[n.Pipe.Decl[0].Ident[0]] = scope{}
+			inner[n.Pipe.Decl[1].Ident[0]] = elem
+		}
+		w.walk(n.List, elem, inner)
+		w.walk(n.ElseList, dot, vars)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			w.pipe(n.Pipe, dot, vars)
+		}
+	}
+}
+
+// pipe is eval followed by adding the pipeline's declarations to vars.
+func (w goWalker) pipe(p *parse.PipeNode, dot scope, vars map[string]scope) scope {
+	result := w.eval(p, dot, vars)
+	if p != nil {
+		for _, decl := range p.Decl {
+			vars[decl.Ident[0]] = result
+		}
+	}
+	return result
+}
+
+// eval records the references in a pipeline and returns what it evaluates
+// to when that is a plain reference.
+func (w goWalker) eval(p *parse.PipeNode, dot scope, vars map[string]scope) scope {
+	if p == nil {
+		return scope{}
+	}
+	var result scope
+	for _, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			s := w.arg(arg, dot, vars)
+			if len(p.Cmds) == 1 && len(cmd.Args) == 1 {
+				result = s
+			}
+		}
+	}
+	return result
+}
+
+func (w goWalker) arg(node parse.Node, dot scope, vars map[string]scope) scope {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		s := dot.field(n.Ident...)
+		w.record(s)
+		return s
+	case *parse.VariableNode:
+		base, ok := vars[n.Ident[0]]
+		if !ok || len(n.Ident) == 1 {
+			return base
+		}
+		s := base.field(n.Ident[1:]...)
+		w.record(s)
+		return s
+	case *parse.ChainNode:
+		w.arg(n.Node, dot, vars)
+	case *parse.PipeNode:
+		w.pipe(n, dot, vars)
+	}
+	return scope{}
+}
+
+func copyVars(vars map[string]scope) map[string]scope {
+	copied := make(map[string]scope, len(vars)+2)
+	for k, v := range vars {
+		copied[k] = v
+	}
+	return copied
+}
+
+type mustacheSection struct {
+	name     string
+	path     string
+	inverted bool
+}
+
+func extractMustache(source string, found map[string]bool) error {
+	var stack []mustacheSection
+	// prefix is the path of the innermost section that pushes a context
+	prefix := func() string {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if !stack[i].inverted {
+				return stack[i].path + "."
+			}
+		}
+		return ""
+	}
+
+	rest := source
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		rest = rest[start+2:]
+		closing := "}}"
+		if strings.HasPrefix(rest, "{") {
+			rest = rest[1:]
+			closing = "}}}"
+		}
+		end := strings.Index(rest, closing)
+		if end < 0 {
+			return fmt.Errorf("unclosed tag near %q", truncate(rest))
+		}
+		tag := strings.TrimSpace(rest[:end])
+		rest = rest[end+len(closing):]
+		if tag == "" {
+			return fmt.Errorf("empty tag")
+		}
+
+		sigil := tag[0]
+		name := strings.TrimSpace(tag[1:])
+		switch sigil {
+		case '!', '>':
+			continue
+		case '=':
+			return fmt.Errorf("custom delimiters are not supported")
+		case '#', '^':
+			if name == "" {
+				return fmt.Errorf("section without a name")
+			}
+			path := prefix() + name
+			found[path] = true
+			stack = append(stack, mustacheSection{name: name, path: path, inverted: sigil == '^'})
+		case '/':
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return fmt.Errorf("unexpected closing tag {{/%s}}", name)
+			}
+			stack = stack[:len(stack)-1]
+		case '&':
+			if name != "." {
+				found[prefix()+name] = true
+			}
+		default:
+			if tag != "." {
+				found[prefix()+tag] = true
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("section %q is never closed", stack[len(stack)-1].name)
+	}
+	return nil
+}
+
+func truncate(s string) string {
+	if len(s) > 20 {
+		return s[:20] + "..."
+	}
+	return s
+}
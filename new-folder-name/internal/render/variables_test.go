@@ -0,0 +1,109 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractVariables_Go(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"plain", "Hi {{.name}}", []string{"name"}},
+		{"nested fields", "{{.user.profile.first_name}} {{.user.email}}", []string{"user.email", "user.profile.first_name"}},
+		{
+			"range block",
+			"{{range .items}}{{.title}}: {{.price.amount}}{{end}}",
+			[]string{"items", "items[].price.amount", "items[].title"},
+		},
+		{
+			"range with declared element",
+			"{{range $i, $item := .items}}{{$i}} {{$item.sku}} for {{$.customer}}{{end}}",
+			[]string{"customer", "items", "items[].sku"},
+		},
+		{"range over a root variable", "{{with .a}}{{range $.items}}{{.sku}}{{end}}{{end}}", []string{"a", "items", "items[].sku"}},
+		{
+			"conditionals",
+			"{{if .is_vip}}Dear {{.title}}{{else if gt .points 100}}Hi{{else}}{{.fallback}}{{end}}",
+			[]string{"fallback", "is_vip", "points", "title"},
+		},
+		{"with rescopes dot", "{{with .order}}#{{.number}}{{else}}{{.none}}{{end}}", []string{"none", "order", "order.number"}},
+		{"variables", "{{$u := .user}}{{$u.name}}", []string{"user", "user.name"}},
+		{"functions are allowed", "{{upper .name | printf \"%s!\"}}", []string{"name"}},
+		{"defined templates", `{{define "footer"}}{{.unsubscribe_url}}{{end}}{{template "footer" .}}`, []string{"unsubscribe_url"}},
+		{"no variables", "Hello world", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractVariables(tt.source, SyntaxGo)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractVariables_Mustache(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"plain and unescaped", "Hi {{name}}, {{{bio}}} {{& signature }}", []string{"bio", "name", "signature"}},
+		{"dotted", "{{user.first_name}}", []string{"user.first_name"}},
+		{"sections", "{{#items}}{{title}} {{.}}{{/items}}", []string{"items", "items.title"}},
+		{"nested sections", "{{#order}}{{#lines}}{{sku}}{{/lines}}{{/order}}", []string{"order", "order.lines", "order.lines.sku"}},
+		{"inverted sections keep the outer context", "{{^items}}{{empty_message}}{{/items}}", []string{"empty_message", "items"}},
+		{"comments and partials", "{{! note }}{{> footer}}{{name}}", []string{"name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractVariables(tt.source, SyntaxMustache)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractVariables_Malformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		syntax Syntax
+	}{
+		{"go unclosed action", "Hi {{.name", SyntaxGo},
+		{"go missing end", "{{if .x}}yes", SyntaxGo},
+		{"go stray end", "{{end}}", SyntaxGo},
+		{"mustache unclosed tag", "Hi {{name", SyntaxMustache},
+		{"mustache unclosed section", "{{#items}}{{title}}", SyntaxMustache},
+		{"mustache mismatched close", "{{#a}}{{/b}}", SyntaxMustache},
+		{"mustache delimiters", "{{=<% %>=}}", SyntaxMustache},
+		{"unknown syntax", "{{name}}", Syntax("jinja")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExtractVariables(tt.source, tt.syntax)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMissingVariables(t *testing.T) {
+	paths := []string{"items", "items[].title", "name", "user.email", "user.name"}
+	missing := MissingVariables(paths, map[string]interface{}{"name": "Ada"})
+	assert.Equal(t, []string{"items", "user"}, missing)
+	assert.Empty(t, MissingVariables(paths, map[string]interface{}{"items": nil, "name": "", "user": map[string]interface{}{}}))
+}
+
+func TestParseSyntax(t *testing.T) {
+	for name, want := range map[string]Syntax{"": SyntaxGo, "go": SyntaxGo, "Mustache": SyntaxMustache, "handlebars": SyntaxMustache} {
+		got, err := ParseSyntax(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseSyntax("jinja")
+	assert.Error(t, err)
+}
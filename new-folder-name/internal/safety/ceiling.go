@@ -0,0 +1,212 @@
+package safety
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const emergencyStopKey = "notification:emergency:stop"
+
+// AlertEvent describes something operations must look at immediately.
+type AlertEvent struct {
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Count     int64     `json:"count"`
+	Limit     int64     `json:"limit"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Alerter receives alert events. Implementations must not block.
+type Alerter interface {
+	Alert(ctx context.Context, event AlertEvent)
+}
+
+// LogAlerter writes alert events to the standard logger.
+type LogAlerter struct{}
+
+func (LogAlerter) Alert(ctx context.Context, event AlertEvent) {
+	log.Printf("ALERT %s: %s (count=%d limit=%d)", event.Name, event.Reason, event.Count, event.Limit)
+}
+
+// SendCeiling enforces the global per-minute and daily send ceilings. The
+// counters live in Redis so every replica shares them. Crossing the per-minute
+// ceiling engages an emergency stop that stays on until cleared by an admin.
+type SendCeiling struct {
+	redis   *redis.Client
+	cfg     config.SafetyConfig
+	alerter Alerter
+	clock   clock.Clock
+	keys    store.Namespace
+}
+
+func NewSendCeiling(redis *redis.Client, cfg config.SafetyConfig, alerter Alerter) *SendCeiling {
+	return &SendCeiling{
+		redis:   redis,
+		cfg:     cfg,
+		alerter: alerter,
+		clock:   clock.System,
+	}
+}
+
+// SetClock replaces the clock the ceilings are counted by.
+func (s *SendCeiling) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetKeyPrefix puts the counters and the emergency stop behind prefix,
+// redis.key_prefix.
+func (s *SendCeiling) SetKeyPrefix(prefix string) {
+	s.keys = store.Namespace(prefix)
+}
+
+// Middleware guards the send endpoints for all channels. Only sends the
+// handler accepted, with a 2xx, are counted, so requests rejected here or
+// by validation can't run the counters up.
+func (s *SendCeiling) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		stopped, err := s.IsStopped(ctx)
+		if err != nil {
+			// fail open, the ceiling must not take sends down with redis
+			log.Printf("emergency stop check failed: %v", err)
+		}
+		if stopped {
+			s.reject(c, http.StatusServiceUnavailable, models.CodeEmergencyStop, "Sending is halted by the emergency stop")
+			return
+		}
+
+		minute, day, err := s.counts(ctx)
+		if err != nil {
+			log.Printf("send ceiling counters failed: %v", err)
+		}
+		// one more send would cross a ceiling
+		if s.cfg.MinuteCeiling > 0 && minute >= s.cfg.MinuteCeiling {
+			s.engage(ctx, minute)
+			s.reject(c, http.StatusServiceUnavailable, models.CodeEmergencyStop, "Sending is halted by the emergency stop")
+			return
+		}
+		if s.cfg.DailyCeiling > 0 && day >= s.cfg.DailyCeiling {
+			s.reject(c, http.StatusTooManyRequests, models.CodeGlobalCeiling, "Global daily send ceiling reached")
+			return
+		}
+		c.Next()
+
+		if status := c.Writer.Status(); status < 200 || status >= 300 {
+			return
+		}
+		minute, _, err = s.increment(ctx)
+		if err != nil {
+			log.Printf("send ceiling counters failed: %v", err)
+			return
+		}
+		// replicas sending at once can take the count past the ceiling
+		// between the check and the send
+		if s.cfg.MinuteCeiling > 0 && minute > s.cfg.MinuteCeiling {
+			s.engage(ctx, minute)
+		}
+	}
+}
+
+// IsStopped reports whether the emergency stop is engaged.
+func (s *SendCeiling) IsStopped(ctx context.Context) (bool, error) {
+	exists, err := s.redis.Exists(ctx, s.keys.Key(emergencyStopKey)).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+// Clear lifts the emergency stop. It reports whether a stop was engaged.
+func (s *SendCeiling) Clear(ctx context.Context) (bool, error) {
+	removed, err := s.redis.Del(ctx, s.keys.Key(emergencyStopKey)).Result()
+	if err != nil {
+		return false, err
+	}
+	if removed > 0 {
+		log.Print("emergency stop cleared")
+	}
+	return removed > 0, nil
+}
+
+// counterKeys are the current minute's and day's counters.
+func (s *SendCeiling) counterKeys() (string, string) {
+	now := s.clock.Now().UTC()
+	return s.keys.Key(fmt.Sprintf("notification:ceiling:minute:%s", now.Format("200601021504"))),
+		s.keys.Key(fmt.Sprintf("notification:ceiling:day:%s", now.Format("20060102")))
+}
+
+// counts reads the sends counted this minute and today.
+func (s *SendCeiling) counts(ctx context.Context) (int64, int64, error) {
+	minuteKey, dayKey := s.counterKeys()
+	values, err := s.redis.MGet(ctx, minuteKey, dayKey).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	var counts [2]int64
+	for i, value := range values {
+		if text, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(text, 10, 64)
+		}
+	}
+	return counts[0], counts[1], nil
+}
+
+// increment counts one send.
+func (s *SendCeiling) increment(ctx context.Context) (int64, int64, error) {
+	minuteKey, dayKey := s.counterKeys()
+	pipe := s.redis.TxPipeline()
+	minute := pipe.Incr(ctx, minuteKey)
+	pipe.Expire(ctx, minuteKey, 2*time.Minute)
+	day := pipe.Incr(ctx, dayKey)
+	pipe.Expire(ctx, dayKey, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return minute.Val(), day.Val(), nil
+}
+
+// engage sets the emergency stop. Only the replica that actually flips it
+// raises the alert so a burst doesn't produce an alert storm.
+func (s *SendCeiling) engage(ctx context.Context, count int64) {
+	set, err := s.redis.SetNX(ctx, s.keys.Key(emergencyStopKey), s.clock.Now().UTC().Format(time.RFC3339), 0).Result()
+	if err != nil {
+		log.Printf("failed to engage emergency stop: %v", err)
+		return
+	}
+	if !set {
+		return
+	}
+	s.alerter.Alert(ctx, AlertEvent{
+		Name:      "emergency_stop_engaged",
+		Reason:    "global per-minute send ceiling crossed",
+		Count:     count,
+		Limit:     s.cfg.MinuteCeiling,
+		Timestamp: s.clock.Now(),
+	})
+}
+
+// reject writes the error. "error" carried the code before APIResponse had
+// a code field and is kept for older clients.
+func (s *SendCeiling) reject(c *gin.Context, status int, code models.ErrorCode, message string) {
+	middleware.Respond(c, status, middleware.NewProblem(c, status, code, message), gin.H{
+		"success":    false,
+		"code":       code,
+		"error":      code,
+		"message":    message,
+		"request_id": middleware.CallerRequestID(c),
+	})
+	c.Abort()
+}
@@ -0,0 +1,139 @@
+package safety
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/handlers"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingAlerter struct {
+	mu     sync.Mutex
+	events []AlertEvent
+}
+
+func (r *recordingAlerter) Alert(ctx context.Context, event AlertEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func setupCeiling(t *testing.T, cfg config.SafetyConfig) (*SendCeiling, *recordingAlerter, *gin.Engine, *clock.Fake) {
+	gin.SetMode(gin.TestMode)
+
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	alerter := &recordingAlerter{}
+	ceiling := NewSendCeiling(rdb, cfg, alerter)
+	now := clock.NewFake(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	ceiling.SetClock(now)
+
+	router := gin.New()
+	router.POST("/api/v1/notification/email", ceiling.Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/api/v1/notification/push", ceiling.Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/api/v1/admin/emergency/clear", handlers.NewAdminHandler(ceiling, nil).ClearEmergencyStop)
+
+	return ceiling, alerter, router, now
+}
+
+func send(router *gin.Engine, path string) int {
+	req, _ := http.NewRequest("POST", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSendCeiling_BurstEngagesEmergencyStop(t *testing.T) {
+	ceiling, alerter, router, now := setupCeiling(t, config.SafetyConfig{MinuteCeiling: 5})
+
+	// Burst within the same minute: the first five pass, the sixth trips the stop
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/email"))
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, send(router, "/api/v1/notification/email"))
+
+	stopped, err := ceiling.IsStopped(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, stopped)
+
+	// Only one alert even though the burst keeps going
+	send(router, "/api/v1/notification/email")
+	if assert.Len(t, alerter.events, 1) {
+		assert.Equal(t, "emergency_stop_engaged", alerter.events[0].Name)
+		assert.Equal(t, int64(5), alerter.events[0].Limit)
+	}
+
+	// The stop covers every channel and outlives the minute window
+	now.Advance(2 * time.Minute)
+	assert.Equal(t, http.StatusServiceUnavailable, send(router, "/api/v1/notification/push"))
+
+	// An explicit admin clear resumes sending
+	assert.Equal(t, http.StatusOK, send(router, "/api/v1/admin/emergency/clear"))
+	assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/push"))
+}
+
+func TestSendCeiling_DailyCeilingRejectsWith429(t *testing.T) {
+	ceiling, alerter, router, now := setupCeiling(t, config.SafetyConfig{DailyCeiling: 3})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/email"))
+		now.Advance(time.Minute)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, send(router, "/api/v1/notification/email"))
+
+	// The daily ceiling rejects but never engages the emergency stop
+	stopped, _ := ceiling.IsStopped(context.Background())
+	assert.False(t, stopped)
+	assert.Empty(t, alerter.events)
+
+	// A new day starts a fresh counter
+	now.Advance(24 * time.Hour)
+	assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/email"))
+}
+
+func TestSendCeiling_DisabledByDefault(t *testing.T) {
+	_, _, router, _ := setupCeiling(t, config.SafetyConfig{})
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/email"))
+	}
+}
+
+func TestSendCeiling_OnlyAcceptedSendsCount(t *testing.T) {
+	ceiling, alerter, router, _ := setupCeiling(t, config.SafetyConfig{MinuteCeiling: 2, DailyCeiling: 10})
+	router.POST("/api/v1/notification/invalid", ceiling.Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusBadRequest)
+	})
+
+	// malformed requests, however many, never trip the stop
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, http.StatusBadRequest, send(router, "/api/v1/notification/invalid"))
+	}
+	stopped, err := ceiling.IsStopped(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, stopped)
+	assert.Empty(t, alerter.events)
+
+	assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/email"))
+	assert.Equal(t, http.StatusOK, send(router, "/api/v1/notification/email"))
+	assert.Equal(t, http.StatusServiceUnavailable, send(router, "/api/v1/notification/email"))
+}
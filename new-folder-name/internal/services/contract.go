@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ContractError reports an upstream response that does not have the shape
+// this client relies on. Field names the offending JSON path so the
+// upstream team can be pointed at the exact change.
+type ContractError struct {
+	Service  string
+	Endpoint string
+	Field    string
+	Problem  string
+}
+
+func (e *ContractError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s %s contract violation: %s", e.Service, e.Endpoint, e.Problem)
+	}
+	return fmt.Sprintf("%s %s contract violation: field %q %s", e.Service, e.Endpoint, e.Field, e.Problem)
+}
+
+// decodeResponse decodes a JSON object body into v after checking that every
+// required field is present and not null. Unknown fields are allowed so
+// upstream can add to a response without breaking us. A required field is a
+// dotted path; "a|b" is satisfied by either path.
+func decodeResponse(service, endpoint string, body io.Reader, v interface{}, required ...string) error {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", service, err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return &ContractError{Service: service, Endpoint: endpoint, Problem: "body is not a JSON object"}
+	}
+	for _, spec := range required {
+		alternatives := strings.Split(spec, "|")
+		found := false
+		for _, path := range alternatives {
+			if lookupPath(root, path) != nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ContractError{Service: service, Endpoint: endpoint, Field: alternatives[0], Problem: "is required but missing"}
+		}
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return &ContractError{
+				Service:  service,
+				Endpoint: endpoint,
+				Field:    typeErr.Field,
+				Problem:  fmt.Sprintf("is a JSON %s, want %s", typeErr.Value, typeErr.Type),
+			}
+		}
+		return &ContractError{Service: service, Endpoint: endpoint, Problem: err.Error()}
+	}
+	return nil
+}
+
+func lookupPath(root map[string]interface{}, path string) interface{} {
+	var current interface{} = root
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/franzego/stage04/internal/cache"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/circuitbreaker"
+	"github.com/sony/gobreaker"
+)
+
+type TemplateServiceClient struct {
+	baseUrl    string
+	httpClient *http.Client
+	cb         *gobreaker.CircuitBreaker
+	mockMode   bool
+	// cache holds templates fetched recently, as JSON; nil until
+	// CacheTemplates is called.
+	cache *cache.LRU
+}
+
+// templateFields are the parts of a template this client reads. Type,
+// Content and Syntax are optional; older template services don't return
+// them.
+type templateFields struct {
+	ID               string `json:"id"`
+	Type             string `json:"type"`
+	RequiresApproval bool   `json:"requires_approval"`
+	Content          string `json:"content"`
+	Syntax           string `json:"syntax"`
+}
+
+// templateResponse accepts the template either at the top level or nested
+// under "data".
+type templateResponse struct {
+	templateFields
+	Data *templateFields `json:"data"`
+}
+
+func (r templateResponse) fields() templateFields {
+	if r.Data != nil {
+		return *r.Data
+	}
+	return r.templateFields
+}
+
+func NewTemplateClient(baseUrl string, mockmode bool) *TemplateServiceClient {
+	return &TemplateServiceClient{
+		baseUrl: baseUrl,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		cb:       circuitbreaker.NewCircuitBreaker("template-service"),
+		mockMode: mockmode,
+	}
+}
+
+// Breaker is the circuit breaker guarding calls to the template service.
+func (t *TemplateServiceClient) Breaker() *gobreaker.CircuitBreaker {
+	return t.cb
+}
+
+func (t *TemplateServiceClient) ValidateTemplate(ctx context.Context, templateID string) (bool, error) {
+	if t.mockMode {
+		log.Print("Mock mode enabled: Simulating template validation")
+		return true, nil
+	}
+	if _, err := t.getTemplate(ctx, templateID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RequiresApproval reports whether sends using the template must be approved
+// by a second person before they are published.
+func (t *TemplateServiceClient) RequiresApproval(ctx context.Context, templateID string) (bool, error) {
+	if t.mockMode {
+		return false, nil
+	}
+	template, err := t.getTemplate(ctx, templateID)
+	if err != nil {
+		return false, err
+	}
+	return template.RequiresApproval, nil
+}
+
+// TemplateMetadata describes the template. Mock mode has no templates to
+// describe, so it reports every template as a WhatsApp one, the only type
+// any caller checks.
+func (t *TemplateServiceClient) TemplateMetadata(ctx context.Context, templateID string) (models.TemplateMetadata, error) {
+	if t.mockMode {
+		return models.TemplateMetadata{ID: templateID, Type: "whatsapp"}, nil
+	}
+	template, err := t.getTemplate(ctx, templateID)
+	if err != nil {
+		return models.TemplateMetadata{}, err
+	}
+	return models.TemplateMetadata{
+		ID:               template.ID,
+		Type:             template.Type,
+		RequiresApproval: template.RequiresApproval,
+	}, nil
+}
+
+// TemplateSource returns the template's source and its placeholder syntax.
+// Both are empty when the template service doesn't expose the source.
+func (t *TemplateServiceClient) TemplateSource(ctx context.Context, templateID string) (string, string, error) {
+	if t.mockMode {
+		return "", "", nil
+	}
+	template, err := t.getTemplate(ctx, templateID)
+	if err != nil {
+		return "", "", err
+	}
+	return template.Content, template.Syntax, nil
+}
+
+// CacheTemplates keeps up to size templates for ttl after they are
+// fetched, so repeat lookups skip the template service. Misses aren't
+// cached. A size of 0 leaves caching off.
+func (t *TemplateServiceClient) CacheTemplates(size int, ttl time.Duration) {
+	if size > 0 {
+		t.cache = cache.NewLRU(size, ttl)
+	}
+}
+
+// PrefetchTemplate fetches the template into the cache, failing when the
+// template service doesn't have it.
+func (t *TemplateServiceClient) PrefetchTemplate(ctx context.Context, templateID string) error {
+	if t.mockMode {
+		return nil
+	}
+	_, err := t.getTemplate(ctx, templateID)
+	return err
+}
+
+func (t *TemplateServiceClient) getTemplate(ctx context.Context, templateID string) (templateFields, error) {
+	if cached, ok := t.cache.Get(templateID); ok {
+		var template templateFields
+		if err := json.Unmarshal([]byte(cached), &template); err == nil {
+			return template, nil
+		}
+	}
+	template, err := t.fetchTemplate(ctx, templateID)
+	if err != nil {
+		return templateFields{}, err
+	}
+	if t.cache != nil {
+		if encoded, err := json.Marshal(template); err == nil {
+			t.cache.Set(templateID, string(encoded))
+		}
+	}
+	return template, nil
+}
+
+func (t *TemplateServiceClient) fetchTemplate(ctx context.Context, templateID string) (templateFields, error) {
+	result, err := t.cb.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET",
+			fmt.Sprintf("%s/templates/%s", t.baseUrl, templateID), nil)
+		if err != nil {
+			return templateFields{}, err
+		}
+
+		resp, err := t.httpClient.Do(req)
+		if err != nil {
+			return templateFields{}, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return templateFields{}, fmt.Errorf("template not found")
+		}
+		var body templateResponse
+		if err := decodeResponse("template-service", "GET /templates/{id}", resp.Body, &body, "id|data.id"); err != nil {
+			return templateFields{}, err
+		}
+		return body.fields(), nil
+	})
+
+	if err != nil {
+		return templateFields{}, err
+	}
+	return result.(templateFields), nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/pkg/circuitbreaker"
+	"github.com/sony/gobreaker"
+)
+
+type UserServiceClient struct {
+	baseURL    string
+	httpClient *http.Client
+	cb         *gobreaker.CircuitBreaker
+	mockMode   bool
+}
+
+func NewUserServiceClient(baseURL string, mockMode bool) *UserServiceClient {
+	return &UserServiceClient{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		cb:       circuitbreaker.NewCircuitBreaker("user-service"),
+		mockMode: mockMode,
+	}
+}
+
+// Breaker is the circuit breaker guarding calls to the user service.
+func (u *UserServiceClient) Breaker() *gobreaker.CircuitBreaker {
+	return u.cb
+}
+
+// ErrUserNotFound is returned for a user the user service doesn't have.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserServiceUnavailable is returned when the user service fails on its
+// side, which is worth retrying later.
+var ErrUserServiceUnavailable = errors.New("user service unavailable")
+
+// ValidateUser reports whether userID names an active user.
+func (u *UserServiceClient) ValidateUser(ctx context.Context, userID string) (bool, error) {
+	user, err := u.GetUser(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.Active, nil
+}
+
+// userRecord is the user as GET /users/{id} returns it. A user without
+// "active" is active.
+type userRecord struct {
+	ID          string              `json:"id"`
+	Email       string              `json:"email"`
+	Phone       string              `json:"phone"`
+	PushTokens  []string            `json:"push_tokens"`
+	Locale      string              `json:"locale"`
+	Timezone    string              `json:"timezone"`
+	Active      *bool               `json:"active"`
+	Preferences *models.Preferences `json:"preferences"`
+}
+
+// userResponse accepts the user either at the top level or nested under
+// "data", the two shapes the user service has used.
+type userResponse struct {
+	userRecord
+	Data *userRecord `json:"data"`
+}
+
+func (r userRecord) user() *models.User {
+	return &models.User{
+		ID:          r.ID,
+		Email:       r.Email,
+		Phone:       r.Phone,
+		PushTokens:  r.PushTokens,
+		Locale:      r.Locale,
+		Timezone:    r.Timezone,
+		Active:      r.Active == nil || *r.Active,
+		Preferences: r.Preferences,
+	}
+}
+
+// mockUser is the user every lookup finds in mock mode. Like the other mock
+// lookups it has no locale or timezone, so the configured defaults apply.
+func mockUser(userID string) *models.User {
+	return &models.User{
+		ID:         userID,
+		Email:      userID + "@example.com",
+		Phone:      "+15550100000",
+		PushTokens: []string{"mock-token-" + userID},
+		Active:     true,
+	}
+}
+
+// GetUser fetches the user record. It fails with ErrUserNotFound for an
+// unknown user and with ErrUserServiceUnavailable when the user service
+// answers with a 5xx. An unknown user is a good answer as far as the
+// circuit breaker is concerned.
+func (u *UserServiceClient) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	if u.mockMode {
+		log.Print("Mock mode enabled: Simulating user lookup")
+		return mockUser(userID), nil
+	}
+
+	result, err := u.cb.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET",
+			fmt.Sprintf("%s/users/%s", u.baseURL, userID), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := u.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return (*models.User)(nil), nil
+		case resp.StatusCode >= 500:
+			return nil, fmt.Errorf("%w: status %d", ErrUserServiceUnavailable, resp.StatusCode)
+		case resp.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("failed to fetch user: status %d", resp.StatusCode)
+		}
+		var body userResponse
+		if err := decodeResponse("user-service", "GET /users/{id}", resp.Body, &body, "id|data.id"); err != nil {
+			return nil, err
+		}
+		if body.Data != nil {
+			return body.Data.user(), nil
+		}
+		return body.userRecord.user(), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	user := result.(*models.User)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetPreferredLocale returns the user's preferred locale, or an empty string
+// when the user service doesn't know it.
+func (u *UserServiceClient) GetPreferredLocale(ctx context.Context, userID string) (string, error) {
+	user, err := u.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Locale, nil
+}
+
+// GetTimezone returns the user's IANA timezone, or an empty string when the
+// user service doesn't know it.
+func (u *UserServiceClient) GetTimezone(ctx context.Context, userID string) (string, error) {
+	user, err := u.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Timezone, nil
+}
+
+// userPreferencesResponse accepts the preferences either at the top level or
+// nested under "data".
+type userPreferencesResponse struct {
+	models.Preferences
+	Data *models.Preferences `json:"data"`
+}
+
+// GetPreferences returns the user's notification opt-outs.
+func (u *UserServiceClient) GetPreferences(ctx context.Context, userID string) (models.Preferences, error) {
+	if u.mockMode {
+		return models.Preferences{}, nil
+	}
+
+	result, err := u.cb.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET",
+			fmt.Sprintf("%s/users/%s/preferences", u.baseURL, userID), nil)
+		if err != nil {
+			return models.Preferences{}, err
+		}
+
+		resp, err := u.httpClient.Do(req)
+		if err != nil {
+			return models.Preferences{}, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return models.Preferences{}, fmt.Errorf("failed to fetch preferences: status %d", resp.StatusCode)
+		}
+		var body userPreferencesResponse
+		if err := decodeResponse("user-service", "GET /users/{id}/preferences", resp.Body, &body); err != nil {
+			return models.Preferences{}, err
+		}
+		if body.Data != nil {
+			return *body.Data, nil
+		}
+		return body.Preferences, nil
+	})
+
+	if err != nil {
+		return models.Preferences{}, err
+	}
+	return result.(models.Preferences), nil
+}
+
+// RemoveDeviceToken forgets a device token the push service reported gone.
+func (u *UserServiceClient) RemoveDeviceToken(ctx context.Context, userID, token string) error {
+	if u.mockMode {
+		log.Printf("Mock mode enabled: Simulating removal of a device token of user %s", userID)
+		return nil
+	}
+
+	_, err := u.cb.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+			fmt.Sprintf("%s/users/%s/devices/%s", u.baseURL, userID, url.PathEscape(token)), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := u.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		// already gone is as good as removed
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+			return nil, fmt.Errorf("failed to remove device token: status %d", resp.StatusCode)
+		}
+		return nil, nil
+	})
+	return err
+}
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/franzego/stage04/internal/cache"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrStorageDegraded is returned for a record that isn't in memory while
+// Redis is unreachable.
+var ErrStorageDegraded = errors.New("status storage degraded: redis unavailable")
+
+// Statuses is where the handlers keep status records.
+type Statuses interface {
+	// Key is where notificationID's record is stored for the caller on ctx.
+	Key(ctx context.Context, notificationID string) string
+	// StoreMany writes records and returns each as stored, in order.
+	StoreMany(ctx context.Context, records []models.NotificationStatus) ([][]byte, error)
+	// Get reads a record. A missing one is redis.Nil.
+	Get(ctx context.Context, notificationID string) (string, error)
+	// Exists reports whether a record is there.
+	Exists(ctx context.Context, notificationID string) (bool, error)
+	// Update changes a record in place, writing what with queues alongside
+	// it. A missing record is redis.Nil.
+	Update(ctx context.Context, notificationID string, change StatusChange, with StatusWrites) error
+	// Degraded reports whether records are kept somewhere other than Redis
+	// for now.
+	Degraded() bool
+}
+
+// FallbackStatuses is a StatusStore that keeps working when Redis doesn't.
+// After a run of Redis failures it is degraded: new records are kept in a
+// bounded in-memory cache instead, and read back from it, until Recover
+// finds Redis back and writes them there.
+type FallbackStatuses struct {
+	*StatusStore
+	// after is how many Redis failures in a row degrade the store.
+	after  int
+	memory *cache.LRU
+
+	mu       sync.Mutex
+	failures int
+	// pending are the records kept in memory that Redis hasn't got yet,
+	// oldest first, at most capacity of them.
+	pending  []statusWrite
+	capacity int
+	degraded atomic.Bool
+}
+
+// NewFallbackStatuses returns statuses that degrade to memory after after
+// Redis failures in a row, keeping up to capacity records there.
+func NewFallbackStatuses(statuses *StatusStore, after, capacity int) *FallbackStatuses {
+	if after <= 0 {
+		after = 1
+	}
+	return &FallbackStatuses{
+		StatusStore: statuses,
+		after:       after,
+		memory:      cache.NewLRU(capacity, statuses.ttl),
+		capacity:    capacity,
+	}
+}
+
+// Degraded reports whether records are being kept in memory.
+func (f *FallbackStatuses) Degraded() bool {
+	return f.degraded.Load()
+}
+
+// Store writes one record like StoreMany.
+func (f *FallbackStatuses) Store(ctx context.Context, record models.NotificationStatus) ([]byte, error) {
+	stored, err := f.StoreMany(ctx, []models.NotificationStatus{record})
+	if err != nil {
+		return nil, err
+	}
+	return stored[0], nil
+}
+
+// StoreMany writes records to Redis, or to memory while degraded. The
+// write that degrades the store goes to memory too.
+func (f *FallbackStatuses) StoreMany(ctx context.Context, records []models.NotificationStatus) ([][]byte, error) {
+	if !f.Degraded() {
+		stored, err := f.StatusStore.StoreMany(ctx, records)
+		if !f.observe(err) || !f.Degraded() {
+			return stored, err
+		}
+	}
+	writes, err := encodeStatuses(context.WithoutCancel(ctx), records)
+	if err != nil {
+		return nil, err
+	}
+	stored := make([][]byte, len(writes))
+	f.mu.Lock()
+	for i, w := range writes {
+		f.memory.Set(f.Key(ctx, w.record.ID), string(w.recordJSON))
+		stored[i] = w.recordJSON
+	}
+	f.pending = append(f.pending, writes...)
+	if over := len(f.pending) - f.capacity; over > 0 {
+		log.Printf("status storage degraded: dropping the %d oldest statuses waiting for redis", over)
+		f.pending = f.pending[over:]
+	}
+	f.mu.Unlock()
+	return stored, nil
+}
+
+// Get reads a record from Redis, falling back to memory when Redis can't
+// be reached. A record in neither while degraded is ErrStorageDegraded.
+func (f *FallbackStatuses) Get(ctx context.Context, notificationID string) (string, error) {
+	if !f.Degraded() {
+		value, err := f.StatusStore.Get(ctx, notificationID)
+		if !f.observe(err) {
+			return value, err
+		}
+	}
+	if value, ok := f.memory.Get(f.Key(ctx, notificationID)); ok {
+		return value, nil
+	}
+	return "", ErrStorageDegraded
+}
+
+// Exists reports whether notificationID has a record in Redis, or in
+// memory when Redis can't be reached. A record in neither while degraded
+// is ErrStorageDegraded.
+func (f *FallbackStatuses) Exists(ctx context.Context, notificationID string) (bool, error) {
+	if !f.Degraded() {
+		exists, err := f.StatusStore.Exists(ctx, notificationID)
+		if !f.observe(err) {
+			return exists, err
+		}
+	}
+	if _, ok := f.memory.Get(f.Key(ctx, notificationID)); ok {
+		return true, nil
+	}
+	return false, ErrStorageDegraded
+}
+
+// Update changes a record in Redis or, while degraded, the copy kept in
+// memory, which Recover then writes in its new state. What with queues
+// needs Redis and is left out in memory. A record in neither while
+// degraded is ErrStorageDegraded.
+func (f *FallbackStatuses) Update(ctx context.Context, notificationID string, change StatusChange, with StatusWrites) error {
+	if !f.Degraded() {
+		err := f.StatusStore.Update(ctx, notificationID, change, with)
+		if !f.observe(err) || !f.Degraded() {
+			return err
+		}
+	}
+	key := f.Key(ctx, notificationID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.memory.Get(key)
+	if !ok {
+		return ErrStorageDegraded
+	}
+	var record models.NotificationStatus
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return err
+	}
+	write, err := change(&record)
+	if err != nil || !write {
+		return err
+	}
+	writes, err := encodeStatuses(context.WithoutCancel(ctx), []models.NotificationStatus{record})
+	if err != nil {
+		return err
+	}
+	f.memory.Set(key, string(writes[0].recordJSON))
+	for i, w := range f.pending {
+		if f.Key(w.ctx, w.record.ID) == key {
+			f.pending[i] = writes[0]
+			return nil
+		}
+	}
+	f.pending = append(f.pending, writes[0])
+	if over := len(f.pending) - f.capacity; over > 0 {
+		log.Printf("status storage degraded: dropping the %d oldest statuses waiting for redis", over)
+		f.pending = f.pending[over:]
+	}
+	return nil
+}
+
+// observe counts err towards degrading the store, reporting whether it
+// means Redis couldn't be reached. Any other outcome ends the run.
+func (f *FallbackStatuses) observe(err error) bool {
+	if !unreachable(err) {
+		if err == nil || errors.Is(err, redis.Nil) {
+			f.mu.Lock()
+			f.failures = 0
+			f.mu.Unlock()
+		}
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures++
+	if f.failures >= f.after && !f.degraded.Load() {
+		log.Printf("redis failed %d times in a row, keeping statuses in memory: %v", f.failures, err)
+		f.degraded.Store(true)
+	}
+	return true
+}
+
+// unreachable reports whether err is Redis not answering, rather than an
+// answer or the caller giving up.
+func unreachable(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, redis.TxFailedErr) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+// Recover writes the records kept in memory to Redis once it answers
+// again, and stops degrading the store when none are left. It returns how
+// many it wrote. Records kept while it runs are written on the next call.
+func (f *FallbackStatuses) Recover(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	idle := len(f.pending) == 0 && !f.degraded.Load()
+	f.mu.Unlock()
+	if idle {
+		return 0, nil
+	}
+	if err := f.redis.Ping(ctx).Err(); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	writes := f.pending
+	f.pending = nil
+	f.mu.Unlock()
+	if err := f.write(ctx, writes); err != nil {
+		f.mu.Lock()
+		f.pending = append(writes, f.pending...)
+		f.mu.Unlock()
+		return 0, err
+	}
+	for _, w := range writes {
+		f.memory.Delete(f.Key(w.ctx, w.record.ID))
+	}
+
+	f.mu.Lock()
+	if len(f.pending) == 0 && f.degraded.Load() {
+		log.Printf("redis is back, wrote the %d statuses kept in memory", len(writes))
+		f.degraded.Store(false)
+		f.failures = 0
+	}
+	f.mu.Unlock()
+	return len(writes), nil
+}
+
+// Run calls Recover every interval until ctx is done.
+func (f *FallbackStatuses) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := f.Recover(ctx); err != nil && f.Degraded() {
+				log.Printf("status storage still degraded: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackStatuses_DegradesAndRecovers(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	index := NewUserIndex(client, tenantScope, 0, time.Hour)
+	statuses := NewFallbackStatuses(NewStatusStore(client, tenantScope, time.Hour, func(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, _ []byte) {
+		index.Add(ctx, pipe, record.UserID, record.ID, record.CreatedAt)
+	}), 2, 100)
+	ctx := context.Background()
+
+	_, err := statuses.StoreMany(ctx, []models.NotificationStatus{{ID: "n-0", UserID: "user123", Status: "queued"}})
+	require.NoError(t, err)
+	server.Close()
+
+	_, err = statuses.StoreMany(ctx, []models.NotificationStatus{{ID: "n-1", UserID: "user123", Status: "queued"}})
+	assert.Error(t, err, "one failure isn't an outage yet")
+	assert.False(t, statuses.Degraded())
+
+	stored, err := statuses.StoreMany(ctx, []models.NotificationStatus{{ID: "n-2", UserID: "user123", Status: "queued"}})
+	require.NoError(t, err, "the failure that degrades the store is kept in memory")
+	assert.True(t, statuses.Degraded())
+	_, err = statuses.StoreMany(ctx, []models.NotificationStatus{{ID: "n-3", UserID: "user123", Status: "queued"}})
+	require.NoError(t, err)
+
+	value, err := statuses.Get(ctx, "n-2")
+	require.NoError(t, err)
+	assert.JSONEq(t, string(stored[0]), value)
+	_, err = statuses.Get(ctx, "n-0")
+	assert.ErrorIs(t, err, ErrStorageDegraded)
+
+	_, err = statuses.Recover(ctx)
+	assert.Error(t, err)
+	assert.True(t, statuses.Degraded())
+
+	require.NoError(t, server.Restart())
+	// the client fails fast for a moment after dial errors; the probe
+	// loop just tries again
+	var written int
+	require.Eventually(t, func() bool {
+		written, err = statuses.Recover(ctx)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 2, written)
+	assert.False(t, statuses.Degraded())
+	for _, id := range []string{"n-2", "n-3"} {
+		assert.True(t, server.Exists("acme:notification:status:"+id), id)
+		assert.Equal(t, time.Hour, server.TTL("acme:notification:status:"+id))
+	}
+	members, err := server.ZMembers("acme:notification:index:user:user123")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"n-0", "n-2", "n-3"}, members)
+
+	written, err = statuses.Recover(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, written)
+}
+
+func TestFallbackStatuses_Capacity(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	statuses := NewFallbackStatuses(NewStatusStore(client, nil, time.Hour, nil), 1, 2)
+	ctx := context.Background()
+	server.Close()
+	for i := 0; i < 3; i++ {
+		_, err := statuses.StoreMany(ctx, []models.NotificationStatus{{ID: fmt.Sprintf("n-%d", i)}})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, server.Restart())
+	written, err := statuses.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, written, "the oldest is dropped")
+	assert.False(t, server.Exists("notification:status:n-0"))
+	assert.True(t, server.Exists("notification:status:n-2"))
+}
+
+func TestFallbackStatuses_UpdateInMemory(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	statuses := NewFallbackStatuses(NewStatusStore(client, nil, time.Hour, nil), 1, 100)
+	ctx := context.Background()
+	server.Close()
+	_, err := statuses.StoreMany(ctx, []models.NotificationStatus{{ID: "n-1", Status: "queued"}})
+	require.NoError(t, err)
+	require.True(t, statuses.Degraded())
+
+	exists, err := statuses.Exists(ctx, "n-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	_, err = statuses.Exists(ctx, "n-2")
+	assert.ErrorIs(t, err, ErrStorageDegraded)
+
+	withCalled := false
+	err = statuses.Update(ctx, "n-1", func(record *models.NotificationStatus) (bool, error) {
+		record.Status = "sent"
+		return true, nil
+	}, func(context.Context, redis.Pipeliner, models.NotificationStatus, []byte) { withCalled = true })
+	require.NoError(t, err)
+	assert.False(t, withCalled, "there is no Redis to queue on")
+	value, err := statuses.Get(ctx, "n-1")
+	require.NoError(t, err)
+	assert.Contains(t, value, `"status":"sent"`)
+	err = statuses.Update(ctx, "n-2", func(*models.NotificationStatus) (bool, error) { return true, nil }, nil)
+	assert.ErrorIs(t, err, ErrStorageDegraded)
+
+	require.NoError(t, server.Restart())
+	var written int
+	require.Eventually(t, func() bool {
+		written, err = statuses.Recover(ctx)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 1, written, "the update replaced the record waiting for Redis")
+	stored, err := server.Get("notification:status:n-1")
+	require.NoError(t, err)
+	assert.Contains(t, stored, `"status":"sent"`)
+}
+
+func TestUnreachable(t *testing.T) {
+	assert.False(t, unreachable(nil))
+	assert.False(t, unreachable(redis.Nil))
+	assert.False(t, unreachable(context.Canceled))
+	assert.False(t, unreachable(redis.TxFailedErr))
+	assert.True(t, unreachable(errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")))
+}
@@ -0,0 +1,11 @@
+package store
+
+// Namespace is put in front of every key the gateway keeps in Redis, so
+// deployments sharing one Redis keep apart. The empty Namespace leaves
+// keys as they are.
+type Namespace string
+
+// Key is key in the namespace.
+func (ns Namespace) Key(key string) string {
+	return string(ns) + key
+}
@@ -0,0 +1,26 @@
+package store
+
+import "context"
+
+// The operations the store labels its Redis commands with.
+const (
+	OpStatusWrite      = "status_write"
+	OpStatusRead       = "status_read"
+	OpIdempotencyCheck = "idempotency_check"
+)
+
+type operationKey struct{}
+
+// WithOperation labels the Redis commands run on ctx with op, the logical
+// operation they are part of.
+func WithOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// Operation is the operation ctx's commands are part of, or "other".
+func Operation(ctx context.Context) string {
+	if op, ok := ctx.Value(operationKey{}).(string); ok {
+		return op
+	}
+	return "other"
+}
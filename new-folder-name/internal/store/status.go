@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// StatusKey is a notification's status record.
+func StatusKey(notificationID string) string {
+	return fmt.Sprintf("notification:status:%s", notificationID)
+}
+
+// IdempotencyKey marks a notification ID as already taken by a send.
+func IdempotencyKey(notificationID string) string {
+	return fmt.Sprintf("notification:idempotency:%s", notificationID)
+}
+
+// StatusWrites queues on pipe the writes that go with a status record, such
+// as its indexes, so they land in the same transaction. recordJSON is the
+// record as stored.
+type StatusWrites func(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, recordJSON []byte)
+
+// StatusStore writes notifications' status records, kept for ttl, together
+// with what goes with each, in one MULTI per call however many records it
+// is given.
+type StatusStore struct {
+	redis *redis.Client
+	scope KeyScope
+	ttl   time.Duration
+	with  StatusWrites
+}
+
+// NewStatusStore returns the status store on client. scope places each
+// record's key; nil stores it as is. with may be nil.
+func NewStatusStore(client *redis.Client, scope KeyScope, ttl time.Duration, with StatusWrites) *StatusStore {
+	if scope == nil {
+		scope = func(_ context.Context, key string) string { return key }
+	}
+	return &StatusStore{redis: client, scope: scope, ttl: ttl, with: with}
+}
+
+// Key is where notificationID's record is stored for the caller on ctx.
+func (s *StatusStore) Key(ctx context.Context, notificationID string) string {
+	return s.scope(ctx, StatusKey(notificationID))
+}
+
+// Store writes one record. It returns the record as stored.
+func (s *StatusStore) Store(ctx context.Context, record models.NotificationStatus) ([]byte, error) {
+	stored, err := s.StoreMany(ctx, []models.NotificationStatus{record})
+	if err != nil {
+		return nil, err
+	}
+	return stored[0], nil
+}
+
+// StoreMany writes records in a single round trip and one transaction, so
+// no reader sees a record without its indexes. It returns each record as
+// stored, in order.
+func (s *StatusStore) StoreMany(ctx context.Context, records []models.NotificationStatus) ([][]byte, error) {
+	writes, err := encodeStatuses(ctx, records)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.write(ctx, writes); err != nil {
+		return nil, err
+	}
+	stored := make([][]byte, len(writes))
+	for i, w := range writes {
+		stored[i] = w.recordJSON
+	}
+	return stored, nil
+}
+
+// Get reads notificationID's record. A missing one is redis.Nil.
+func (s *StatusStore) Get(ctx context.Context, notificationID string) (string, error) {
+	return s.redis.Get(WithOperation(ctx, OpStatusRead), s.Key(ctx, notificationID)).Result()
+}
+
+// Exists reports whether notificationID has a record.
+func (s *StatusStore) Exists(ctx context.Context, notificationID string) (bool, error) {
+	n, err := s.redis.Exists(WithOperation(ctx, OpStatusRead), s.Key(ctx, notificationID)).Result()
+	return n > 0, err
+}
+
+// StatusChange edits a record read for an update. It returns false to
+// leave the record as it was.
+type StatusChange func(record *models.NotificationStatus) (bool, error)
+
+// Update reads notificationID's record, applies change and writes the
+// record back with its TTL kept, together with what with queues, in one
+// transaction. The record is read under WATCH, so a write racing the
+// update fails it with redis.TxFailedErr. A missing record is redis.Nil.
+func (s *StatusStore) Update(ctx context.Context, notificationID string, change StatusChange, with StatusWrites) error {
+	key := s.Key(ctx, notificationID)
+	return s.redis.Watch(WithOperation(ctx, OpStatusWrite), func(tx *redis.Tx) error {
+		statusJSON, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var record models.NotificationStatus
+		if err := json.Unmarshal([]byte(statusJSON), &record); err != nil {
+			return err
+		}
+		write, err := change(&record)
+		if err != nil || !write {
+			return err
+		}
+		recordJSON, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		// a record stored without a TTL gets the usual one
+		ttl, err := tx.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if ttl > 0 {
+				pipe.SetArgs(ctx, key, recordJSON, redis.SetArgs{KeepTTL: true})
+			} else {
+				pipe.Set(ctx, key, recordJSON, s.ttl)
+			}
+			if with != nil {
+				with(ctx, pipe, record, recordJSON)
+			}
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// Degraded is always false: a StatusStore has nowhere else to keep records.
+func (s *StatusStore) Degraded() bool {
+	return false
+}
+
+// statusWrite is a record to store, encoded, with the context whose scope
+// it is stored under.
+type statusWrite struct {
+	ctx        context.Context
+	record     models.NotificationStatus
+	recordJSON []byte
+}
+
+func encodeStatuses(ctx context.Context, records []models.NotificationStatus) ([]statusWrite, error) {
+	writes := make([]statusWrite, len(records))
+	for i, record := range records {
+		recordJSON, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode status of %s: %w", record.ID, err)
+		}
+		writes[i] = statusWrite{ctx: ctx, record: record, recordJSON: recordJSON}
+	}
+	return writes, nil
+}
+
+// write stores writes in one transaction, each under its own context's
+// scope.
+func (s *StatusStore) write(ctx context.Context, writes []statusWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err := s.redis.TxPipelined(WithOperation(ctx, OpStatusWrite), func(pipe redis.Pipeliner) error {
+		for _, w := range writes {
+			pipe.Set(w.ctx, s.Key(w.ctx, w.record.ID), w.recordJSON, s.ttl)
+			if s.with != nil {
+				s.with(w.ctx, pipe, w.record, w.recordJSON)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Idempotency marks notification IDs taken by a send, each for ttl.
+type Idempotency struct {
+	redis *redis.Client
+	scope KeyScope
+	ttl   time.Duration
+}
+
+// NewIdempotency returns the idempotency marks on client. scope places each
+// mark's key; nil stores it as is.
+func NewIdempotency(client *redis.Client, scope KeyScope, ttl time.Duration) *Idempotency {
+	if scope == nil {
+		scope = func(_ context.Context, key string) string { return key }
+	}
+	return &Idempotency{redis: client, scope: scope, ttl: ttl}
+}
+
+// Key is notificationID's mark for the caller on ctx.
+func (x *Idempotency) Key(ctx context.Context, notificationID string) string {
+	return x.scope(ctx, IdempotencyKey(notificationID))
+}
+
+// Claim stores record under its notification ID unless a send already
+// claimed the ID, in one SET NX so that of two sends racing for an ID only
+// one gets it. It reports whether this call claimed the ID and returns the
+// record that holds it: the loser of a race gets the winner's. A mark that
+// expires before it is read back is claimed again, once; one that can't be
+// read fails the claim rather than passing the send off as a duplicate.
+func (x *Idempotency) Claim(ctx context.Context, record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	key := x.Key(ctx, record.NotificationID)
+	ctx = WithOperation(ctx, OpIdempotencyCheck)
+	for tries := 0; ; tries++ {
+		claimed, err := x.redis.SetNX(ctx, key, payload, x.ttl).Result()
+		if err != nil {
+			return models.IdempotencyRecord{}, false, err
+		}
+		if claimed {
+			return record, true, nil
+		}
+		held, err := x.redis.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) && tries == 0 {
+			continue
+		}
+		if err != nil {
+			return models.IdempotencyRecord{}, false, fmt.Errorf("failed to read the claim on %s: %w", record.NotificationID, err)
+		}
+		return ParseIdempotencyRecord(record.NotificationID, held), false, nil
+	}
+}
+
+// ParseIdempotencyRecord reads the record held under notificationID. Marks
+// written before records were kept hold only "processing" and read as a
+// record with just the ID.
+func ParseIdempotencyRecord(notificationID, value string) models.IdempotencyRecord {
+	var record models.IdempotencyRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil || record.NotificationID == "" {
+		return models.IdempotencyRecord{NotificationID: notificationID}
+	}
+	return record
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrips counts the round trips a client makes to Redis: one per
+// command, or one per pipeline however many commands it holds.
+type roundTrips struct{ n atomic.Int64 }
+
+func (r *roundTrips) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (r *roundTrips) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		r.n.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (r *roundTrips) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		r.n.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+func newCountedClient(tb testing.TB) (*miniredis.Miniredis, *redis.Client, *roundTrips) {
+	server := miniredis.NewMiniRedis()
+	require.NoError(tb, server.Start())
+	tb.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tb.Cleanup(func() { client.Close() })
+	// connect first so the handshake isn't counted
+	require.NoError(tb, client.Ping(context.Background()).Err())
+	trips := &roundTrips{}
+	client.AddHook(trips)
+	return server, client, trips
+}
+
+func tenantScope(_ context.Context, key string) string { return "acme:" + key }
+
+func TestStatusStore_StoreMany(t *testing.T) {
+	server, client, trips := newCountedClient(t)
+	index := NewUserIndex(client, tenantScope, 0, time.Hour)
+	statuses := NewStatusStore(client, tenantScope, 2*time.Hour, func(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, _ []byte) {
+		index.Add(ctx, pipe, record.UserID, record.ID, record.CreatedAt)
+	})
+	ctx := context.Background()
+	records := []models.NotificationStatus{
+		{ID: "n-1", UserID: "user123", Status: "queued"},
+		{ID: "n-2", UserID: "user123", Status: "scheduled"},
+	}
+
+	stored, err := statuses.StoreMany(ctx, records)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), trips.n.Load())
+	require.Len(t, stored, 2)
+	for i, record := range records {
+		value, err := server.Get("acme:notification:status:" + record.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(stored[i]), value)
+		assert.Equal(t, 2*time.Hour, server.TTL("acme:notification:status:"+record.ID))
+	}
+	members, err := server.ZMembers("acme:notification:index:user:user123")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"n-1", "n-2"}, members)
+
+	stored, err = statuses.StoreMany(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+	assert.Equal(t, int64(1), trips.n.Load(), "nothing to store, nothing sent")
+}
+
+func TestStatusStore_Update(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	statuses := NewStatusStore(client, tenantScope, 2*time.Hour, nil)
+	ctx := context.Background()
+	_, err := statuses.Store(ctx, models.NotificationStatus{ID: "n-1", Status: "queued"})
+	require.NoError(t, err)
+	server.FastForward(time.Hour)
+
+	published := 0
+	err = statuses.Update(ctx, "n-1", func(record *models.NotificationStatus) (bool, error) {
+		record.Status = "sent"
+		return true, nil
+	}, func(ctx context.Context, pipe redis.Pipeliner, record models.NotificationStatus, _ []byte) {
+		assert.Equal(t, "sent", record.Status)
+		published++
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	value, err := statuses.Get(ctx, "n-1")
+	require.NoError(t, err)
+	assert.Contains(t, value, `"status":"sent"`)
+	assert.Equal(t, time.Hour, server.TTL("acme:notification:status:n-1"), "the TTL is kept")
+
+	err = statuses.Update(ctx, "n-1", func(record *models.NotificationStatus) (bool, error) {
+		record.Status = "failed"
+		return false, nil
+	}, nil)
+	require.NoError(t, err)
+	value, _ = statuses.Get(ctx, "n-1")
+	assert.Contains(t, value, `"status":"sent"`, "a change that declines isn't written")
+
+	err = statuses.Update(ctx, "missing", func(*models.NotificationStatus) (bool, error) { return true, nil }, nil)
+	assert.ErrorIs(t, err, redis.Nil)
+	exists, err := statuses.Exists(ctx, "n-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = statuses.Exists(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestIdempotency_Claim(t *testing.T) {
+	server, client, trips := newCountedClient(t)
+	marks := NewIdempotency(client, tenantScope, 3*time.Hour)
+	ctx := context.Background()
+	first := models.IdempotencyRecord{NotificationID: "n-1", AcceptedAt: time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)}
+
+	holder, claimed, err := marks.Claim(ctx, first)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, first, holder)
+	assert.Equal(t, int64(1), trips.n.Load(), "checked and marked in one round trip")
+	value, err := server.Get("acme:notification:idempotency:n-1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"notification_id":"n-1","accepted_at":"2025-11-03T09:00:00Z"}`, value)
+	assert.Equal(t, 3*time.Hour, server.TTL("acme:notification:idempotency:n-1"))
+
+	holder, claimed, err = marks.Claim(ctx, models.IdempotencyRecord{NotificationID: "n-1", AcceptedAt: first.AcceptedAt.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, first, holder, "the loser gets the winner's record")
+}
+
+func TestIdempotency_ClaimLegacyMark(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	require.NoError(t, server.Set("notification:idempotency:n-1", "processing"))
+	holder, claimed, err := NewIdempotency(client, nil, time.Hour).Claim(context.Background(), models.IdempotencyRecord{NotificationID: "n-1", AcceptedAt: time.Now()})
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, models.IdempotencyRecord{NotificationID: "n-1"}, holder)
+}
+
+// firstGet stands in for the first GET the client sends.
+type firstGet struct {
+	get  func(ctx context.Context, cmd redis.Cmder, next redis.ProcessHook) error
+	done atomic.Bool
+}
+
+func (f *firstGet) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (f *firstGet) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "get" && !f.done.Swap(true) {
+			return f.get(ctx, cmd, next)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (f *firstGet) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestIdempotency_ClaimMarkExpiresBeforeReadBack(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	require.NoError(t, server.Set("notification:idempotency:n-1", `{"notification_id":"n-1"}`))
+	client.AddHook(&firstGet{get: func(ctx context.Context, cmd redis.Cmder, next redis.ProcessHook) error {
+		server.Del("notification:idempotency:n-1")
+		return next(ctx, cmd)
+	}})
+
+	record := models.IdempotencyRecord{NotificationID: "n-1", AcceptedAt: time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)}
+	holder, claimed, err := NewIdempotency(client, nil, time.Hour).Claim(context.Background(), record)
+	require.NoError(t, err)
+	assert.True(t, claimed, "the expired mark is claimed again")
+	assert.Equal(t, record, holder)
+}
+
+func TestIdempotency_ClaimReadBackFails(t *testing.T) {
+	server, client, _ := newCountedClient(t)
+	require.NoError(t, server.Set("notification:idempotency:n-1", `{"notification_id":"n-1"}`))
+	client.AddHook(&firstGet{get: func(_ context.Context, cmd redis.Cmder, _ redis.ProcessHook) error {
+		err := fmt.Errorf("connection reset")
+		cmd.SetErr(err)
+		return err
+	}})
+
+	_, claimed, err := NewIdempotency(client, nil, time.Hour).Claim(context.Background(), models.IdempotencyRecord{NotificationID: "n-1"})
+	assert.Error(t, err, "not reported as a duplicate")
+	assert.False(t, claimed)
+}
+
+func TestIdempotency_ClaimUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	defer client.Close()
+	_, claimed, err := NewIdempotency(client, nil, time.Hour).Claim(context.Background(), models.IdempotencyRecord{NotificationID: "n-1"})
+	assert.Error(t, err)
+	assert.False(t, claimed)
+}
+
+// BenchmarkStoreStatuses compares storing a batch one record at a time,
+// each with the EXISTS and SET of the old idempotency check, against a
+// claim per record and one StoreMany.
+func BenchmarkStoreStatuses(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{1, 10, 100} {
+		records := make([]models.NotificationStatus, size)
+		for i := range records {
+			records[i] = models.NotificationStatus{ID: fmt.Sprintf("n-%d", i), UserID: "user123", Status: "queued"}
+		}
+		b.Run(fmt.Sprintf("%d/sequential", size), func(b *testing.B) {
+			_, client, trips := newCountedClient(b)
+			statuses := NewStatusStore(client, nil, time.Hour, nil)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, record := range records {
+					key := IdempotencyKey(record.ID)
+					client.Exists(ctx, key)
+					client.Set(ctx, key, "processing", time.Hour)
+					if _, err := statuses.Store(ctx, record); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(trips.n.Load())/float64(b.N), "round-trips/op")
+		})
+		b.Run(fmt.Sprintf("%d/pipelined", size), func(b *testing.B) {
+			_, client, trips := newCountedClient(b)
+			statuses := NewStatusStore(client, nil, time.Hour, nil)
+			marks := NewIdempotency(client, nil, time.Hour)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, record := range records {
+					if _, _, err := marks.Claim(ctx, models.IdempotencyRecord{NotificationID: record.ID}); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if _, err := statuses.StoreMany(ctx, records); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(trips.n.Load())/float64(b.N), "round-trips/op")
+		})
+	}
+}
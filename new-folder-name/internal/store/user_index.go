@@ -0,0 +1,82 @@
+// Package store keeps the Redis structures the handlers share behind types
+// that own their keys, so callers don't format keys inline.
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultUserIndexMaxLength is how many notifications a user's index keeps
+// when notifications.user_index_max_length is unset.
+const DefaultUserIndexMaxLength = 1000
+
+// KeyScope maps a key to where it is stored for the caller on ctx, such as
+// under the caller's tenant.
+type KeyScope func(ctx context.Context, key string) string
+
+// UserIndexKey is the sorted set of a user's notification IDs.
+func UserIndexKey(userID string) string {
+	return fmt.Sprintf("notification:index:user:%s", userID)
+}
+
+// UserIndex is each user's notifications, newest first: a sorted set of
+// notification IDs scored by creation time in unix seconds, trimmed to the
+// newest maxLength and kept for ttl after the last one was added.
+type UserIndex struct {
+	redis     *redis.Client
+	scope     KeyScope
+	maxLength int64
+	ttl       time.Duration
+}
+
+// NewUserIndex returns the user index on client. scope places each user's
+// key; nil stores it as is.
+func NewUserIndex(client *redis.Client, scope KeyScope, maxLength int64, ttl time.Duration) *UserIndex {
+	if scope == nil {
+		scope = func(_ context.Context, key string) string { return key }
+	}
+	if maxLength <= 0 {
+		maxLength = DefaultUserIndexMaxLength
+	}
+	return &UserIndex{redis: client, scope: scope, maxLength: maxLength, ttl: ttl}
+}
+
+func (x *UserIndex) key(ctx context.Context, userID string) string {
+	return x.scope(ctx, UserIndexKey(userID))
+}
+
+// Add queues on pipe the indexing of notificationID, created at createdAt,
+// under userID, so it goes in the same round trip as the status record.
+func (x *UserIndex) Add(ctx context.Context, pipe redis.Pipeliner, userID, notificationID string, createdAt time.Time) {
+	key := x.key(ctx, userID)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(createdAt.Unix()), Member: notificationID})
+	pipe.ZRemRangeByRank(ctx, key, 0, -x.maxLength-1)
+	pipe.Expire(ctx, key, x.ttl)
+}
+
+// Remove queues on pipe the removal of notificationID from userID's index.
+// The command's value is 1 if it was there.
+func (x *UserIndex) Remove(ctx context.Context, pipe redis.Pipeliner, userID, notificationID string) *redis.IntCmd {
+	return pipe.ZRem(ctx, x.key(ctx, userID), notificationID)
+}
+
+// Newest returns up to count of userID's notification IDs created at or
+// after since, newest first, skipping the first offset. A zero since reads
+// the whole index.
+func (x *UserIndex) Newest(ctx context.Context, userID string, since time.Time, offset, count int64) ([]string, error) {
+	min := "-inf"
+	if !since.IsZero() {
+		min = strconv.FormatInt(since.Unix(), 10)
+	}
+	return x.redis.ZRevRangeByScore(ctx, x.key(ctx, userID), &redis.ZRangeBy{
+		Min:    min,
+		Max:    "+inf",
+		Offset: offset,
+		Count:  count,
+	}).Result()
+}
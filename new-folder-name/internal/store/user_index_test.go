@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIndex(t *testing.T, scope KeyScope, maxLength int64) (*UserIndex, *miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewUserIndex(client, scope, maxLength, 24*time.Hour), server, client
+}
+
+func add(t *testing.T, client *redis.Client, index *UserIndex, ctx context.Context, userID, id string, createdAt time.Time) {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		index.Add(ctx, pipe, userID, id, createdAt)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestUserIndex_AddAndNewest(t *testing.T) {
+	index, server, client := newIndex(t, nil, 0)
+	ctx := context.Background()
+	base := time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)
+	for i, id := range []string{"n-1", "n-2", "n-3"} {
+		add(t, client, index, ctx, "user123", id, base.Add(time.Duration(i)*time.Minute))
+	}
+
+	score, err := server.ZScore("notification:index:user:user123", "n-2")
+	require.NoError(t, err)
+	assert.Equal(t, float64(base.Add(time.Minute).Unix()), score)
+	assert.Equal(t, 24*time.Hour, server.TTL("notification:index:user:user123"))
+
+	ids, err := index.Newest(ctx, "user123", time.Time{}, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n-3", "n-2", "n-1"}, ids)
+
+	ids, err = index.Newest(ctx, "user123", base.Add(time.Minute), 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n-3", "n-2"}, ids, "since is inclusive")
+
+	ids, err = index.Newest(ctx, "user123", time.Time{}, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n-2"}, ids)
+
+	ids, err = index.Newest(ctx, "nobody", time.Time{}, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestUserIndex_Trimmed(t *testing.T) {
+	index, server, client := newIndex(t, nil, 3)
+	ctx := context.Background()
+	base := time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		add(t, client, index, ctx, "user123", fmt.Sprintf("n-%d", i), base.Add(time.Duration(i)*time.Second))
+	}
+	members, err := server.ZMembers("notification:index:user:user123")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"n-2", "n-3", "n-4"}, members, "the oldest are dropped")
+}
+
+func TestUserIndex_Remove(t *testing.T) {
+	index, _, client := newIndex(t, nil, 0)
+	ctx := context.Background()
+	add(t, client, index, ctx, "user123", "n-1", time.Now())
+	add(t, client, index, ctx, "user123", "n-2", time.Now())
+
+	var removed, missing *redis.IntCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = index.Remove(ctx, pipe, "user123", "n-1")
+		missing = index.Remove(ctx, pipe, "user123", "n-9")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed.Val())
+	assert.Equal(t, int64(0), missing.Val())
+	ids, err := index.Newest(ctx, "user123", time.Time{}, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n-2"}, ids)
+}
+
+func TestUserIndex_Scope(t *testing.T) {
+	scope := func(ctx context.Context, key string) string { return "tenant:acme:" + key }
+	index, server, client := newIndex(t, scope, 0)
+	ctx := context.Background()
+	add(t, client, index, ctx, "user123", "n-1", time.Now())
+	assert.True(t, server.Exists("tenant:acme:notification:index:user:user123"))
+	assert.False(t, server.Exists("notification:index:user:user123"))
+}
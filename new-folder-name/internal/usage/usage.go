@@ -0,0 +1,238 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// keyTTL keeps daily counters long enough for year-over-year reports.
+	keyTTL = 400 * 24 * time.Hour
+	// maxReportDays bounds the range a single report may cover.
+	maxReportDays = 366
+	// eventBuffer is how many requests may wait to be counted before new
+	// ones are dropped rather than slowing requests down.
+	eventBuffer = 4096
+
+	queuedKey = "usage_notifications_queued"
+	dayLayout = "20060102"
+)
+
+var (
+	ErrUnknownGranularity = errors.New("granularity must be day or month")
+	ErrInvalidRange       = fmt.Errorf("from must not be after to and the range must not exceed %d days", maxReportDays)
+)
+
+// Counts are the per-client counters kept for each day.
+type Counts struct {
+	Requests     int64 `json:"requests"`
+	Successes    int64 `json:"successes"`
+	ClientErrors int64 `json:"client_errors"`
+	ServerErrors int64 `json:"server_errors"`
+	Queued       int64 `json:"notifications_queued"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.Requests += o.Requests
+	c.Successes += o.Successes
+	c.ClientErrors += o.ClientErrors
+	c.ServerErrors += o.ServerErrors
+	c.Queued += o.Queued
+}
+
+// Point is one period of a report, named "2006-01-02" or "2006-01".
+type Point struct {
+	Period string `json:"period"`
+	Counts
+}
+
+// Report is the usage time series for one client.
+type Report struct {
+	Client      string  `json:"client"`
+	Granularity string  `json:"granularity"`
+	Points      []Point `json:"points"`
+	Total       Counts  `json:"total"`
+	ErrorRate   float64 `json:"error_rate"`
+}
+
+type event struct {
+	client string
+	at     time.Time
+	status int
+	queued int64
+}
+
+// Recorder counts API usage per client. The middleware only enqueues an
+// event; Run writes the counters to Redis in the background so a slow Redis
+// never adds latency to requests.
+type Recorder struct {
+	redis  *redis.Client
+	events chan event
+	clock  clock.Clock
+	keys   store.Namespace
+}
+
+func NewRecorder(redis *redis.Client) *Recorder {
+	return &Recorder{
+		redis:  redis,
+		events: make(chan event, eventBuffer),
+		clock:  clock.System,
+	}
+}
+
+// SetClock replaces the clock requests are stamped by.
+func (r *Recorder) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// SetKeyPrefix puts the counters behind prefix, redis.key_prefix. It must
+// be called before Run.
+func (r *Recorder) SetKeyPrefix(prefix string) {
+	r.keys = store.Namespace(prefix)
+}
+
+// MarkQueued records that the current request queued n notifications.
+func MarkQueued(c *gin.Context, n int) {
+	c.Set(queuedKey, c.GetInt64(queuedKey)+int64(n))
+}
+
+// Middleware counts every authenticated request once it has completed. It
+// must run after the auth middleware so the caller is known.
+func (r *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		client := middleware.CallerID(c)
+		if client == "" {
+			return
+		}
+		e := event{client: client, at: r.clock.Now(), status: c.Writer.Status(), queued: c.GetInt64(queuedKey)}
+		select {
+		case r.events <- e:
+		default:
+			log.Printf("usage event buffer full, dropping event for %s", client)
+		}
+	}
+}
+
+// Run writes queued events to Redis until ctx is cancelled, then flushes
+// whatever is still buffered.
+func (r *Recorder) Run(ctx context.Context) {
+	// writes must survive cancellation, which only stops the loop
+	recordCtx := context.WithoutCancel(ctx)
+	for {
+		select {
+		case e := <-r.events:
+			r.record(recordCtx, e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-r.events:
+					r.record(recordCtx, e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) record(ctx context.Context, e event) {
+	key := r.keys.Key(dayKey(e.client, e.at))
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, "requests", 1)
+		switch {
+		case e.status >= 500:
+			pipe.HIncrBy(ctx, key, "server_errors", 1)
+		case e.status >= 400:
+			pipe.HIncrBy(ctx, key, "client_errors", 1)
+		default:
+			pipe.HIncrBy(ctx, key, "successes", 1)
+		}
+		if e.queued > 0 {
+			pipe.HIncrBy(ctx, key, "notifications_queued", e.queued)
+		}
+		pipe.Expire(ctx, key, keyTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to record usage for %s: %v", e.client, err)
+	}
+}
+
+// Report returns the client's usage for the days from..to inclusive, in UTC,
+// grouped by day or month.
+func (r *Recorder) Report(ctx context.Context, client string, from, to time.Time, granularity string) (Report, error) {
+	if granularity != "day" && granularity != "month" {
+		return Report{}, ErrUnknownGranularity
+	}
+	from, to = truncateDay(from), truncateDay(to)
+	if to.Before(from) || to.Sub(from) >= maxReportDays*24*time.Hour {
+		return Report{}, ErrInvalidRange
+	}
+
+	var days []time.Time
+	var cmds []*redis.MapStringStringCmd
+	_, err := r.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			days = append(days, day)
+			cmds = append(cmds, pipe.HGetAll(ctx, r.keys.Key(dayKey(client, day))))
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	report := Report{Client: client, Granularity: granularity, Points: []Point{}}
+	for i, day := range days {
+		counts := parseCounts(cmds[i].Val())
+		period := day.Format("2006-01-02")
+		if granularity == "month" {
+			period = day.Format("2006-01")
+		}
+		if n := len(report.Points); n > 0 && report.Points[n-1].Period == period {
+			report.Points[n-1].add(counts)
+		} else {
+			report.Points = append(report.Points, Point{Period: period, Counts: counts})
+		}
+		report.Total.add(counts)
+	}
+	if report.Total.Requests > 0 {
+		report.ErrorRate = float64(report.Total.ClientErrors+report.Total.ServerErrors) / float64(report.Total.Requests)
+	}
+	return report, nil
+}
+
+func parseCounts(fields map[string]string) Counts {
+	var c Counts
+	for field, ptr := range map[string]*int64{
+		"requests":             &c.Requests,
+		"successes":            &c.Successes,
+		"client_errors":        &c.ClientErrors,
+		"server_errors":        &c.ServerErrors,
+		"notifications_queued": &c.Queued,
+	} {
+		*ptr, _ = strconv.ParseInt(fields[field], 10, 64)
+	}
+	return c
+}
+
+func dayKey(client string, at time.Time) string {
+	return fmt.Sprintf("usage:client:%s:%s", client, at.UTC().Format(dayLayout))
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
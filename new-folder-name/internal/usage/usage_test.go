@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/middleware"
+	"github.com/franzego/stage04/pkg/clock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+const jwtSecret = "usage-test-secret"
+
+func token(client string) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": client}).SignedString([]byte(jwtSecret))
+	return "Bearer " + signed
+}
+
+func setupRecorder(t *testing.T) (*Recorder, *gin.Engine, *clock.Fake) {
+	gin.SetMode(gin.TestMode)
+
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	recorder := NewRecorder(redis.NewClient(&redis.Options{Addr: s.Addr()}))
+	now := clock.NewFake(time.Date(2024, 1, 30, 12, 0, 0, 0, time.UTC))
+	recorder.SetClock(now)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(middleware.AuthMiddleware(jwtSecret), recorder.Middleware())
+	api.POST("/notification/email", func(c *gin.Context) {
+		switch c.Query("outcome") {
+		case "bad":
+			c.Status(http.StatusBadRequest)
+		case "fail":
+			c.Status(http.StatusInternalServerError)
+		default:
+			MarkQueued(c, 1)
+			c.Status(http.StatusOK)
+		}
+	})
+	return recorder, router, now
+}
+
+func send(router *gin.Engine, client, outcome string) {
+	req, _ := http.NewRequest("POST", "/api/v1/notification/email?outcome="+outcome, nil)
+	if client != "" {
+		req.Header.Set("Authorization", token(client))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestRecorder_AggregatesPerClientPerDay(t *testing.T) {
+	recorder, router, now := setupRecorder(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		recorder.Run(ctx)
+		close(done)
+	}()
+
+	// Jan 30: 2 ok, 1 bad request
+	send(router, "billing", "ok")
+	send(router, "billing", "ok")
+	send(router, "billing", "bad")
+	send(router, "marketing", "ok")
+	send(router, "", "ok") // unauthenticated requests are not attributed
+
+	// Jan 31: 1 ok, 1 server error
+	now.Advance(24 * time.Hour)
+	send(router, "billing", "ok")
+	send(router, "billing", "fail")
+
+	// Feb 1: 1 ok
+	now.Advance(24 * time.Hour)
+	send(router, "billing", "ok")
+
+	cancel()
+	<-done
+
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	report, err := recorder.Report(context.Background(), "billing", day(30), day(31), "day")
+	assert.NoError(t, err)
+	assert.Equal(t, []Point{
+		{Period: "2024-01-30", Counts: Counts{Requests: 3, Successes: 2, ClientErrors: 1, Queued: 2}},
+		{Period: "2024-01-31", Counts: Counts{Requests: 2, Successes: 1, ServerErrors: 1, Queued: 1}},
+	}, report.Points)
+	assert.Equal(t, Counts{Requests: 5, Successes: 3, ClientErrors: 1, ServerErrors: 1, Queued: 3}, report.Total)
+	assert.InDelta(t, 0.4, report.ErrorRate, 1e-9)
+
+	// Days without traffic still appear so the series has no gaps
+	report, err = recorder.Report(context.Background(), "marketing", day(29), day(31), "day")
+	assert.NoError(t, err)
+	assert.Len(t, report.Points, 3)
+	assert.Equal(t, int64(1), report.Total.Requests)
+
+	report, err = recorder.Report(context.Background(), "billing", day(1), day(32), "month")
+	assert.NoError(t, err)
+	assert.Equal(t, []Point{
+		{Period: "2024-01", Counts: Counts{Requests: 5, Successes: 3, ClientErrors: 1, ServerErrors: 1, Queued: 3}},
+		{Period: "2024-02", Counts: Counts{Requests: 1, Successes: 1, Queued: 1}},
+	}, report.Points)
+}
+
+func TestRecorder_ReportValidation(t *testing.T) {
+	recorder, _, _ := setupRecorder(t)
+	ctx := context.Background()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := recorder.Report(ctx, "billing", from, from, "week")
+	assert.ErrorIs(t, err, ErrUnknownGranularity)
+
+	_, err = recorder.Report(ctx, "billing", from, from.AddDate(0, 0, -1), "day")
+	assert.ErrorIs(t, err, ErrInvalidRange)
+
+	_, err = recorder.Report(ctx, "billing", from, from.AddDate(2, 0, 0), "day")
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
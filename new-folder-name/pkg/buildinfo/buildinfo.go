@@ -0,0 +1,53 @@
+// Package buildinfo reports which build is running. Version, Commit and
+// BuildTime are set at link time:
+//
+//	go build -ldflags "-X github.com/franzego/stage04/pkg/buildinfo.Version=v1.2.3 \
+//		-X github.com/franzego/stage04/pkg/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/franzego/stage04/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime"
+)
+
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	// ConfigFingerprint identifies the effective non-secret configuration so
+	// instances can be compared for drift.
+	ConfigFingerprint string `json:"config_fingerprint,omitempty"`
+}
+
+// Get returns the build info with the given config fingerprint.
+func Get(configFingerprint string) Info {
+	return Info{
+		Version:           Version,
+		Commit:            Commit,
+		BuildTime:         BuildTime,
+		GoVersion:         runtime.Version(),
+		ConfigFingerprint: configFingerprint,
+	}
+}
+
+// Fingerprint returns a short SHA-256 hash of v's JSON encoding. Callers must
+// strip secrets from v first.
+func Fingerprint(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
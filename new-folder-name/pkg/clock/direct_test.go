@@ -0,0 +1,147 @@
+package clock
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forbidden are the functions code under internal/ reaches through a Clock
+// or an idgen.Generator instead, by import path. time.Since and time.Until
+// read the wall clock as much as time.Now does.
+var forbidden = map[string][]string{
+	"time":                   {"Now", "Since", "Until"},
+	"github.com/google/uuid": {"New", "NewString"},
+}
+
+// moduleRoot is the directory holding go.mod, above the test's.
+func moduleRoot(t *testing.T) string {
+	t.Helper()
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		require.NotEqual(t, dir, parent, "go.mod not found")
+		dir = parent
+	}
+}
+
+// TestNoDirectCalls fails on any use of time.Now, time.Since, time.Until
+// or uuid.New in the module's internal packages, outside tests, whether
+// called or kept as a function value. cmd and pkg, where clock and idgen live, may use them.
+func TestNoDirectCalls(t *testing.T) {
+	root := moduleRoot(t)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor" ||
+				filepath.Dir(path) == root && (name == "cmd" || name == "pkg")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		for _, use := range directUses(file) {
+			rel, _ := filepath.Rel(root, fset.Position(use.Pos()).Filename)
+			t.Errorf("%s:%d: %s.%s: go through a clock.Clock or idgen.Generator instead",
+				rel, fset.Position(use.Pos()).Line, use.X.(*ast.Ident).Name, use.Sel.Name)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// directUses returns the uses of forbidden functions in file, calls and
+// function values alike, whatever name their package is imported under.
+func directUses(file *ast.File) []*ast.SelectorExpr {
+	names := map[string][]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		funcs, ok := forbidden[path]
+		if !ok {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		names[name] = funcs
+	}
+	var uses []*ast.SelectorExpr
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok || pkg.Obj != nil {
+			return true
+		}
+		for _, fn := range names[pkg.Name] {
+			if sel.Sel.Name == fn {
+				uses = append(uses, sel)
+			}
+		}
+		return true
+	})
+	return uses
+}
+
+func TestDirectCalls_Detection(t *testing.T) {
+	src := `package p
+
+import (
+	"time"
+	gouuid "github.com/google/uuid"
+)
+
+func f(clock interface{ Now() time.Time }) {
+	_ = time.Now()
+	_ = gouuid.New().String()
+	_ = gouuid.NewString()
+	_ = clock.Now()
+	_ = time.Since(time.Time{})
+	_ = time.Until(time.Time{})
+	now := time.Now
+	_ = struct{ now func() time.Time }{now: time.Now}
+	_ = now
+	_ = time.Duration(0)
+}
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	require.NoError(t, err)
+	assert.Len(t, directUses(file), 7, "calls under an alias, time.Since, time.Until and time.Now as a value count; a Clock's Now doesn't")
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	assert.Equal(t, start, fake.Now())
+	fake.Advance(90 * time.Second)
+	assert.Equal(t, start.Add(90*time.Second), fake.Now())
+	fake.Set(start)
+	assert.Equal(t, start, fake.Now())
+}
@@ -0,0 +1,43 @@
+// Package idgen abstracts ID generation so tests can predict the IDs a
+// call hands out. Code under internal/ generates IDs through a Generator
+// rather than calling uuid.New.
+package idgen
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Generator hands out unique IDs.
+type Generator interface {
+	NewID() string
+}
+
+// UUID generates random (version 4) UUIDs.
+var UUID Generator = uuidGenerator{}
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string { return uuid.New().String() }
+
+// Sequence hands out UUID-shaped IDs counting up from 1:
+// 00000000-0000-4000-8000-000000000001, then ...002 and so on. It is safe
+// for concurrent use.
+type Sequence struct {
+	mu   sync.Mutex
+	next int
+}
+
+func NewSequence() *Sequence {
+	return &Sequence{next: 1}
+}
+
+func (s *Sequence) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := fmt.Sprintf("00000000-0000-4000-8000-%012d", s.next)
+	s.next++
+	return id
+}
@@ -0,0 +1,25 @@
+package idgen
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequence(t *testing.T) {
+	ids := NewSequence()
+	first, second := ids.NewID(), ids.NewID()
+	assert.Equal(t, "00000000-0000-4000-8000-000000000001", first)
+	assert.Equal(t, "00000000-0000-4000-8000-000000000002", second)
+	_, err := uuid.Parse(first)
+	require.NoError(t, err, "sequence IDs pass for UUIDs")
+}
+
+func TestUUID(t *testing.T) {
+	id := UUID.NewID()
+	_, err := uuid.Parse(id)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, UUID.NewID())
+}
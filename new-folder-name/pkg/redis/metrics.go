@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/franzego/stage04/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// commandDurationBuckets are finer below 5ms, where a command to a healthy
+// Redis lands.
+var commandDurationBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}
+
+// pipelineCommand labels a pipeline's duration, which covers every command
+// in it.
+const pipelineCommand = "pipeline"
+
+// handshake are the commands the client opens each connection with. They
+// aren't recorded: they aren't the gateway's, and older servers refuse
+// some of them every time.
+var handshake = map[string]bool{"hello": true, "auth": true, "client": true, "select": true}
+
+// Metrics is a redis.Hook recording how long each command took and how many
+// failed, by command and the store.Operation they are part of. A pipeline
+// is timed as one command, "pipeline", with each command in it that failed
+// counted by its own name. A missing key isn't a failure.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewMetrics builds the collectors and registers them with reg, the
+// gateway's registry or a test's own.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "redis_command_duration_seconds",
+			Help:    "Time taken by Redis commands, by command and the operation they are part of.",
+			Buckets: commandDurationBuckets,
+		}, []string{"command", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "redis_command_errors_total",
+			Help: "Redis commands that failed, by command and the operation they are part of.",
+		}, []string{"command", "operation"}),
+	}
+	for _, collector := range []prometheus.Collector{m.duration, m.errors} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (m *Metrics) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		if handshake[cmd.Name()] {
+			return err
+		}
+		op := store.Operation(ctx)
+		m.duration.WithLabelValues(cmd.Name(), op).Observe(time.Since(start).Seconds())
+		if failed(err) {
+			m.errors.WithLabelValues(cmd.Name(), op).Inc()
+		}
+		return err
+	}
+}
+
+func (m *Metrics) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		if len(cmds) > 0 && handshake[cmds[0].Name()] {
+			return err
+		}
+		op := store.Operation(ctx)
+		m.duration.WithLabelValues(pipelineCommand, op).Observe(time.Since(start).Seconds())
+		for _, cmd := range cmds {
+			if failed(cmd.Err()) {
+				m.errors.WithLabelValues(cmd.Name(), op).Inc()
+			}
+		}
+		return err
+	}
+}
+
+func failed(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
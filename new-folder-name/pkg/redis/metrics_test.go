@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/franzego/stage04/internal/models"
+	"github.com/franzego/stage04/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// samples is how many observations each command/operation series of the
+// named family has.
+func samples(t *testing.T, reg prometheus.Gatherer, name string) map[string]uint64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			n := metric.GetHistogram().GetSampleCount()
+			if metric.GetCounter() != nil {
+				n = uint64(metric.GetCounter().GetValue())
+			}
+			counts[labels["command"]+"/"+labels["operation"]] = n
+		}
+	}
+	return counts
+}
+
+func TestMetrics_ByCommandAndOperation(t *testing.T) {
+	server := miniredis.RunT(t)
+	reg := prometheus.NewRegistry()
+	client, err := InitRedis(config.RedisConfig{Addr: server.Addr(), Metrics: true}, reg)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	statuses := store.NewStatusStore(client, nil, time.Hour, nil)
+	_, err = statuses.Store(ctx, models.NotificationStatus{ID: "n-1", Status: "queued"})
+	require.NoError(t, err)
+	_, err = statuses.Get(ctx, "n-1")
+	require.NoError(t, err)
+	_, err = statuses.Get(ctx, "missing")
+	require.ErrorIs(t, err, redis.Nil)
+	_, _, err = store.NewIdempotency(client, nil, time.Hour).Claim(ctx, models.IdempotencyRecord{NotificationID: "n-1"})
+	require.NoError(t, err)
+	server.Set("counter", "not a number")
+	require.Error(t, client.Incr(ctx, "counter").Err())
+
+	durations := samples(t, reg, "redis_command_duration_seconds")
+	assert.Equal(t, uint64(1), durations["pipeline/status_write"])
+	assert.Equal(t, uint64(2), durations["get/status_read"])
+	assert.Equal(t, uint64(1), durations["set/idempotency_check"])
+	assert.Equal(t, uint64(1), durations["incr/other"])
+	assert.Equal(t, map[string]uint64{"incr/other": 1}, samples(t, reg, "redis_command_errors_total"),
+		"a missing key isn't an error")
+}
+
+func TestMetrics_PipelineErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	m, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+	client.AddHook(m)
+	server.Set("counter", "not a number")
+
+	ctx := store.WithOperation(context.Background(), "test")
+	_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "a", "1", 0)
+		pipe.Incr(ctx, "counter")
+		pipe.Incr(ctx, "counter")
+		return nil
+	})
+	require.Error(t, err)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.errors.WithLabelValues("incr", "test")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.errors), "set didn't fail")
+	assert.Equal(t, 1, testutil.CollectAndCount(m.duration), "the pipeline is timed once")
+}
+
+func TestInitRedis_MetricsOff(t *testing.T) {
+	server := miniredis.RunT(t)
+	reg := prometheus.NewRegistry()
+	client, err := InitRedis(config.RedisConfig{Addr: server.Addr()}, reg)
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Set(context.Background(), "probe", "1", 0).Err())
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families)
+}
+
+// BenchmarkMetricsHook writes a batch of statuses in one pipeline with and
+// without the hook, for its overhead against a real round trip.
+func BenchmarkMetricsHook(b *testing.B) {
+	ctx := context.Background()
+	records := make([]models.NotificationStatus, 10)
+	for i := range records {
+		records[i] = models.NotificationStatus{ID: fmt.Sprintf("n-%d", i), UserID: "user123", Status: "queued"}
+	}
+	for _, hooked := range []bool{false, true} {
+		b.Run(fmt.Sprintf("hook=%t", hooked), func(b *testing.B) {
+			server := miniredis.NewMiniRedis()
+			require.NoError(b, server.Start())
+			defer server.Close()
+			client, err := InitRedis(config.RedisConfig{Addr: server.Addr(), Metrics: hooked}, prometheus.NewRegistry())
+			require.NoError(b, err)
+			defer client.Close()
+			statuses := store.NewStatusStore(client, nil, time.Hour, nil)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := statuses.StoreMany(ctx, records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
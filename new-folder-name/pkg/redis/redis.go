@@ -2,28 +2,137 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
+	"net"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/franzego/stage04/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 )
 
-func InitRedis(cfg config.RedisConfig) *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr:         "redis.railway.internal:6379",
-		Password:     "GpEMHuxDTvYLZLGRwPHvBvUhrxsiVvka",
-		DB:           cfg.DB,
-		DialTimeout:  15 * time.Second,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
-	})
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := client.Ping(ctx).Err(); err != nil {
-		log.Fatalf("failed to connect to redis with addr: %s", cfg.Addr)
+// defaultConnectBackoff is the first wait between connect attempts when
+// redis.connect_backoff is unset.
+const defaultConnectBackoff = 2 * time.Second
 
+// Options builds the client options from cfg. Addr is a host:port, or a
+// redis:// or rediss:// URL whose password and database, when it gives
+// them, take the place of cfg's. TLS is on for cfg.TLS.Enabled or a
+// rediss:// URL; a CA file that can't be loaded is an error naming it.
+func Options(cfg config.RedisConfig) (*redis.Options, error) {
+	opts := &redis.Options{Addr: cfg.Addr, Password: cfg.Password, DB: cfg.DB}
+	if strings.Contains(cfg.Addr, "://") {
+		parsed, err := redis.ParseURL(cfg.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis.addr: %w", err)
+		}
+		if parsed.Password == "" {
+			parsed.Password = cfg.Password
+		}
+		if parsed.DB == 0 {
+			parsed.DB = cfg.DB
+		}
+		opts = parsed
 	}
-	log.Printf("connected to redis successfully on addr: %s", cfg.Addr)
-	return client
+	if cfg.TLS.Enabled || opts.TLSConfig != nil {
+		tlsConfig, err := tlsConfig(cfg.TLS, opts.Addr)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	opts.DialTimeout = 15 * time.Second
+	opts.ReadTimeout = 5 * time.Second
+	opts.WriteTimeout = 5 * time.Second
+	// a command's context deadline, when it has one, replaces the read and
+	// write timeouts, so a budgeted request isn't kept waiting past its
+	// deadline
+	opts.ContextTimeoutEnabled = true
+	return opts, nil
+}
+
+// tlsConfig verifies the server at addr against the system CAs, or those
+// in cfg.CACert when set.
+func tlsConfig(cfg config.RedisTLSConfig, addr string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis.tls.ca_cert %s: %w", cfg.CACert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in redis.tls.ca_cert %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// InitRedis connects to the Redis cfg names, pinging it up to
+// cfg.ConnectAttempts times with exponential backoff between attempts. When
+// every attempt fails the client is returned along with the error: it
+// connects by itself once Redis is up, so the caller may carry on
+// degraded. Only an invalid address returns no client. With cfg.Metrics on
+// and a registry to put them in, the client records its commands' latency
+// and errors there.
+func InitRedis(cfg config.RedisConfig, reg prometheus.Registerer) (*redis.Client, error) {
+	opts, err := Options(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if cfg.Metrics && reg != nil {
+		m, err := NewMetrics(reg)
+		if err != nil {
+			return nil, err
+		}
+		client.AddHook(m)
+	}
+	attempts := max(cfg.ConnectAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = client.Ping(ctx).Err()
+		cancel()
+		if err == nil {
+			log.Printf("connected to redis successfully on addr: %s", opts.Addr)
+			return client, nil
+		}
+		if attempt >= attempts {
+			return client, fmt.Errorf("failed to connect to redis with addr %s after %d attempts: %w", opts.Addr, attempt, err)
+		}
+		wait := connectBackoff(cfg, attempt)
+		log.Printf("redis connect attempt %d failed, retrying in %s: %v", attempt, wait, err)
+		time.Sleep(wait)
+	}
+}
+
+// connectBackoff is the wait after the given failed attempt, counting from
+// 1: it doubles from cfg.ConnectBackoff up to cfg.ConnectMaxBackoff.
+func connectBackoff(cfg config.RedisConfig, attempt int) time.Duration {
+	minBackoff, maxBackoff := cfg.ConnectBackoff, cfg.ConnectMaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultConnectBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	d := minBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
 }
@@ -0,0 +1,168 @@
+package redis
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/franzego/stage04/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitRedis_UsesConfiguredAddress(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("s3cret")
+
+	client, err := InitRedis(config.RedisConfig{Addr: server.Addr(), Password: "s3cret"}, nil)
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Set(context.Background(), "probe", "1", 0).Err())
+	assert.True(t, server.Exists("probe"), "written to the configured server")
+}
+
+func TestInitRedis_URL(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("s3cret")
+
+	client, err := InitRedis(config.RedisConfig{Addr: "redis://:s3cret@" + server.Addr() + "/3"}, nil)
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Set(context.Background(), "probe", "1", 0).Err())
+	server.Select(3)
+	assert.True(t, server.Exists("probe"), "written to the URL's database")
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.RedisConfig
+		addr     string
+		password string
+		db       int
+	}{
+		{"host and port", config.RedisConfig{Addr: "localhost:6379", Password: "pw", DB: 2}, "localhost:6379", "pw", 2},
+		{"url", config.RedisConfig{Addr: "redis://:urlpw@cache:6380/4", Password: "pw", DB: 2}, "cache:6380", "urlpw", 4},
+		{"url without credentials", config.RedisConfig{Addr: "redis://cache:6380", Password: "pw", DB: 2}, "cache:6380", "pw", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := Options(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.addr, opts.Addr)
+			assert.Equal(t, tt.password, opts.Password)
+			assert.Equal(t, tt.db, opts.DB)
+			assert.True(t, opts.ContextTimeoutEnabled)
+		})
+	}
+
+	_, err := Options(config.RedisConfig{Addr: "http://cache:6380"})
+	assert.ErrorContains(t, err, "invalid redis.addr")
+}
+
+// freeAddr is a local address nothing listens on yet.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+func retryConfig(addr string, attempts int) config.RedisConfig {
+	return config.RedisConfig{Addr: addr, ConnectAttempts: attempts,
+		ConnectBackoff: 10 * time.Millisecond, ConnectMaxBackoff: 40 * time.Millisecond}
+}
+
+func TestInitRedis_RetriesUntilUp(t *testing.T) {
+	addr := freeAddr(t)
+	server := miniredis.NewMiniRedis()
+	defer server.Close()
+	// Redis comes up while the gateway is retrying
+	started := make(chan error, 1)
+	time.AfterFunc(50*time.Millisecond, func() { started <- server.StartAddr(addr) })
+
+	client, err := InitRedis(retryConfig(addr, 20), nil)
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, <-started)
+	require.NoError(t, client.Ping(context.Background()).Err())
+}
+
+func TestInitRedis_GivesUp(t *testing.T) {
+	start := time.Now()
+	client, err := InitRedis(retryConfig(freeAddr(t), 3), nil)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "after 3 attempts")
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond, "waited 10ms then 20ms")
+	require.NotNil(t, client, "returned for the caller to run degraded")
+	client.Close()
+}
+
+func TestConnectBackoff(t *testing.T) {
+	cfg := config.RedisConfig{ConnectBackoff: 2 * time.Second, ConnectMaxBackoff: 16 * time.Second}
+	var waits []time.Duration
+	for attempt := 1; attempt <= 5; attempt++ {
+		waits = append(waits, connectBackoff(cfg, attempt))
+	}
+	assert.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 16 * time.Second}, waits)
+	assert.Equal(t, defaultConnectBackoff, connectBackoff(config.RedisConfig{}, 1))
+}
+
+// writeCA writes a self-signed CA certificate as PEM and returns its path.
+func writeCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), IsCA: true, BasicConstraintsValid: true,
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return path
+}
+
+func TestOptions_TLS(t *testing.T) {
+	opts, err := Options(config.RedisConfig{Addr: "cache.example.com:6380"})
+	require.NoError(t, err)
+	assert.Nil(t, opts.TLSConfig, "off unless asked for")
+
+	opts, err = Options(config.RedisConfig{Addr: "cache.example.com:6380", TLS: config.RedisTLSConfig{Enabled: true}})
+	require.NoError(t, err)
+	require.NotNil(t, opts.TLSConfig)
+	assert.Equal(t, "cache.example.com", opts.TLSConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), opts.TLSConfig.MinVersion)
+	assert.False(t, opts.TLSConfig.InsecureSkipVerify)
+	assert.Nil(t, opts.TLSConfig.RootCAs, "the system CAs")
+
+	ca := writeCA(t)
+	opts, err = Options(config.RedisConfig{Addr: "rediss://:pw@cache.example.com:6380/1",
+		TLS: config.RedisTLSConfig{CACert: ca, InsecureSkipVerify: true}})
+	require.NoError(t, err)
+	require.NotNil(t, opts.TLSConfig, "rediss:// turns it on")
+	assert.Equal(t, "cache.example.com", opts.TLSConfig.ServerName)
+	assert.NotNil(t, opts.TLSConfig.RootCAs)
+	assert.True(t, opts.TLSConfig.InsecureSkipVerify)
+}
+
+func TestOptions_TLSBadCA(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	_, err := Options(config.RedisConfig{Addr: "cache:6380", TLS: config.RedisTLSConfig{Enabled: true, CACert: missing}})
+	assert.ErrorContains(t, err, missing)
+
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a certificate"), 0o600))
+	_, err = Options(config.RedisConfig{Addr: "cache:6380", TLS: config.RedisTLSConfig{Enabled: true, CACert: garbage}})
+	assert.ErrorContains(t, err, garbage)
+}